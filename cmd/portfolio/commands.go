@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/internal/portfolio"
+	"portfolio-manager/pkg/csvutil"
+)
+
+// Exit codes of subcommands
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a headless subcommand, which initializes only the services it needs.
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"export-trades":   {"Export blotter trades to a CSV file", runExportTrades},
+	"validate-config": {"Validate the configuration file", runValidateConfig},
+	"validate-db":     {"Verify and repair the sequence numbers of the database", runValidateDb},
+	"migrate-db":      {"Copy all keys of the database to another database type", runMigrateDb},
+}
+
+// runCommand runs the named subcommand and returns its exit code.
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", name)
+		printUsage()
+		return exitUsage
+	}
+
+	if err := cmd.run(args); err != nil {
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			return exitUsage
+		}
+		fmt.Fprintf(os.Stderr, "%s failed: %s\n", name, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// newFlagSet creates the flag set of a subcommand, sharing the --config flag with the server.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFilePath := fs.String("config", "./config.yaml", "Path to the configuration file")
+	return fs, configFilePath
+}
+
+// usageError is returned by subcommands on invalid arguments.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+// runExportTrades exports the blotter trades to a CSV file, e.g. export-trades --out trades.csv --profile eu
+func runExportTrades(args []string) error {
+	fs, configFilePath := newFlagSet("export-trades")
+	out := fs.String("out", "", "Path of the CSV file to write")
+	view := fs.String("view", blotter.ViewTrades, "trades or orders")
+	profile := fs.String("profile", csvutil.ProfileDefault, "CSV format profile, default or eu")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err}
+	}
+	if *out == "" {
+		return usageError{errors.New("--out is required")}
+	}
+
+	format, err := csvutil.ParseFormatOptions(url.Values{"profile": {*profile}})
+	if err != nil {
+		return usageError{err}
+	}
+
+	cfg, logger, err := loadConfig(*configFilePath)
+	if err != nil {
+		return err
+	}
+	defer logger.CloseLogger()
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	blotterSvc := blotter.NewBlotter(db)
+	if err := blotterSvc.LoadFromDB(); err != nil {
+		return fmt.Errorf("failed to load trades: %w", err)
+	}
+
+	data, err := blotterSvc.ExportToCSVBytesByView(*view, format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *out, err)
+	}
+
+	logger.Infof("Exported %d trades to %s", len(blotterSvc.GetTrades()), *out)
+	return nil
+}
+
+// runValidateConfig loads the configuration file, applying its validation, and checks referenced files exist.
+func runValidateConfig(args []string) error {
+	fs, configFilePath := newFlagSet("validate-config")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err}
+	}
+
+	cfg, logger, err := loadConfig(*configFilePath)
+	if err != nil {
+		return err
+	}
+	defer logger.CloseLogger()
+
+	if cfg.RefDataSeedPath != "" {
+		if _, err := os.Stat(cfg.RefDataSeedPath); err != nil {
+			return fmt.Errorf("refDataSeedPath: %w", err)
+		}
+	}
+
+	for accountID, account := range cfg.IbkrAccounts {
+		if account.Trader == "" {
+			return fmt.Errorf("ibkrAccounts.%s: trader is required", accountID)
+		}
+	}
+
+	fmt.Printf("%s is valid\n", *configFilePath)
+	return nil
+}
+
+// runValidateDb verifies the head sequence numbers of the blotter and portfolio, repairing a blotter head behind its
+// trades. A portfolio ahead of the blotter cannot be repaired in place and fails the command.
+func runValidateDb(args []string) error {
+	fs, configFilePath := newFlagSet("validate-db")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err}
+	}
+
+	cfg, logger, err := loadConfig(*configFilePath)
+	if err != nil {
+		return err
+	}
+	defer logger.CloseLogger()
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Loading the trades repairs the blotter head
+	blotterSvc := blotter.NewBlotter(db)
+	if err := blotterSvc.LoadFromDB(); err != nil {
+		return fmt.Errorf("failed to load trades: %w", err)
+	}
+
+	portfolioSvc := portfolio.NewPortfolio(db, nil, nil, nil)
+	if err := portfolioSvc.VerifySequence(blotterSvc.GetCurrentSeqNum()); err != nil {
+		return err
+	}
+
+	fmt.Printf("sequence numbers are consistent, blotter head %d\n", blotterSvc.GetCurrentSeqNum())
+	return nil
+}
+
+// runMigrateDb copies all keys of one database into another, e.g. migrate-db --from leveldb --to rocksdb --to-path
+// ./portfolio-manager.rocksdb. The source defaults to the configured database. The server must be stopped, and the
+// config pointed at the new database afterwards.
+func runMigrateDb(args []string) error {
+	fs, configFilePath := newFlagSet("migrate-db")
+	from := fs.String("from", "", "Database type to copy from, defaults to db in config")
+	fromPath := fs.String("from-path", "", "Path of the database to copy from, defaults to dbPath in config")
+	to := fs.String("to", "", "Database type to copy to, leveldb or rocksdb")
+	toPath := fs.String("to-path", "", "Path of the database to copy to")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err}
+	}
+	if *to == "" || *toPath == "" {
+		return usageError{errors.New("--to and --to-path are required")}
+	}
+
+	cfg, logger, err := loadConfig(*configFilePath)
+	if err != nil {
+		return err
+	}
+	defer logger.CloseLogger()
+
+	if *from == "" {
+		*from = cfg.Db
+	}
+	if *fromPath == "" {
+		*fromPath = cfg.DbPath
+	}
+	if *fromPath == *toPath {
+		return usageError{errors.New("--to-path must differ from the source database path")}
+	}
+
+	src, err := dal.Open(*from, *fromPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", *fromPath, err)
+	}
+	defer src.Close()
+
+	dst, err := dal.Open(*to, *toPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", *toPath, err)
+	}
+	defer dst.Close()
+
+	copied, err := dal.Copy(src, dst)
+	if err != nil {
+		return fmt.Errorf("failed after copying %d keys: %w", copied, err)
+	}
+
+	fmt.Printf("copied %d keys from %s %s to %s %s\n", copied, *from, *fromPath, *to, *toPath)
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: portfolio-manager [--config path]              start the server")
+	fmt.Fprintln(os.Stderr, "       portfolio-manager <command> [--config path] [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].description)
+	}
+}
@@ -6,17 +6,27 @@ import (
 	"fmt"
 	"log"
 	"os"
-
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"portfolio-manager/internal/alerts"
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/backup"
 	"portfolio-manager/internal/blotter"
 	"portfolio-manager/internal/config"
 	"portfolio-manager/internal/dal"
 	"portfolio-manager/internal/dividends"
+	"portfolio-manager/internal/notifications"
 	"portfolio-manager/internal/portfolio"
 	"portfolio-manager/internal/server"
+	"portfolio-manager/internal/vesting"
 
 	"portfolio-manager/pkg/logging"
 	"portfolio-manager/pkg/mdata"
 	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/scheduler"
 	"portfolio-manager/pkg/types"
 )
 
@@ -27,84 +37,206 @@ import (
 // @host localhost:8080
 // @BasePath /
 
+// shutdownTimeout bounds the wait for requests in flight and running scheduled tasks on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// Subcommands run headless against the database and exit, e.g. portfolio-manager export-trades --out trades.csv
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	// Define a command-line flag for the configuration file path
 	configFilePath := flag.String("config", "./config.yaml", "Path to the configuration file")
 	flag.Parse()
 
-	// Load configuration
-	config, err := config.GetOrCreateConfig(*configFilePath)
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %s", err)
-	}
-
-	// Setup logger
-	logger, err := logging.InitializeLogger(config.VerboseLogging, config.LogFilePath)
+	// Load configuration and setup logger
+	config, logger, err := loadConfig(*configFilePath)
 	if err != nil {
-		log.Fatalf("Failed to setup logger: %s", err)
+		log.Fatal(err)
 	}
 	defer logger.CloseLogger()
+	registerReloadHooks(logger)
 
-	// Create context with logger
+	// Create context with logger, cancelled on SIGINT or SIGTERM to shut down
 	ctx := context.WithValue(context.Background(), types.LoggerKey, logger)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Log out configurations
 	logger.Info("Starting application with configuration:", *configFilePath, config)
 
 	// Initialize the database
-	var db dal.Database
-	switch config.Db {
-	case dal.LDB:
-		db, err = dal.NewLevelDB("./portfolio-manager.db")
-		if err != nil {
-			logger.Fatalf("Failed to initialize %s: %s", dal.LDB, err)
-		}
-	case dal.RDB:
-		// Add RocksDB initialization here when implemented
-		logger.Fatalf("%s is not yet implemented", dal.RDB)
-	default:
-		logger.Fatalf("Unsupported database type: %s", config.Db)
+	db, err := openDatabase(config)
+	if err != nil {
+		logger.Fatalf("%s", err)
 	}
 	defer db.Close()
 
-	// Create a new blotter service
-	blotterSvc := blotter.NewBlotter(db)
-	err = blotterSvc.LoadFromDB()
-	if err != nil {
-		logger.Fatalf("Failed to create blotter service: %s", err)
-	}
+	// Collect Prometheus metrics of the requests, market data sources, scheduled jobs and database operations
+	metrics := server.NewMetrics()
+	observedDb := dal.Observe(db, metrics.ObserveDatabase)
+
+	// Record changes to trades, dividends and reference data in the audit log
+	auditLog := audit.NewLog(observedDb)
+	auditedDb := audit.NewDatabase(observedDb, auditLog, audit.SourceAPI)
 
 	// Create a new reference data manager
-	rdata, err := rdata.NewManager(db, config.RefDataSeedPath)
+	rdata, err := rdata.NewManager(auditedDb, config.RefDataSeedPath)
 	if err != nil {
 		logging.GetLogger().Fatalf("Failed to create reference data manager")
 	}
 
+	// Create a new blotter service
+	blotterSvc := blotter.NewBlotter(auditedDb)
+	blotterSvc.SetReferenceManager(rdata)
+	err = blotterSvc.LoadFromDB()
+	if err != nil {
+		logger.Fatalf("Failed to create blotter service: %s", err)
+	}
+
 	// Create a new market data manager
-	mdata, err := mdata.NewManager(db, rdata)
+	mdata, err := mdata.NewManager(audit.WithSource(auditedDb, audit.SourceMarketData), rdata)
 	if err != nil {
 		logging.GetLogger().Fatalf("Failed to create market data manager")
 	}
 
+	mdata.SetFetchObserver(metrics.ObserveFetch)
+	mdata.SubscribeToReferenceData(rdata)
+	blotterSvc.SetMarketData(mdata)
+
 	// Create a new dividends manager
-	dividendsSvc := dividends.NewDividendsManager(db, mdata, rdata, blotterSvc)
+	dividendsSvc := dividends.NewDividendsManager(auditedDb, mdata, rdata, blotterSvc)
 
 	// Create a new portfolio service
-	portfolioSvc := portfolio.NewPortfolio(db, mdata, rdata, dividendsSvc)
+	portfolioSvc := portfolio.NewPortfolio(auditedDb, mdata, rdata, dividendsSvc)
 	err = portfolioSvc.LoadPositions()
 	if err != nil {
 		logger.Fatalf("Failed to create portfolio service: %s", err)
 	}
 	portfolioSvc.SubscribeToBlotter(blotterSvc)
 
+	// Background tasks run on the scheduler, which shutdown waits on before closing the database
+	sched := scheduler.New(ctx)
+	sched.SetObserver(metrics.ObserveJob)
+
+	// Close matured bonds daily, posting a summary to notifications, which are also sent by email or Telegram when
+	// configured
+	notificationsSvc := notifications.NewNotificationsManager(observedDb)
+	senders, err := notifications.NewSenders(config.Notifications)
+	if err != nil {
+		logger.Fatalf("Failed to create notification senders: %s", err)
+	}
+	notificationsSvc.SetSenders(senders...)
+	portfolioSvc.StartAutoCloseSchedule(sched, notificationsSvc)
+
+	// Post the ex dates of holdings falling tomorrow daily
+	dividendsSvc.StartExDividendSchedule(sched, notificationsSvc)
+
+	// Evaluate the price alerts on tickers every few minutes
+	alertsSvc := alerts.NewManager(observedDb, mdata)
+	alertsSvc.StartAlertsSchedule(sched, notificationsSvc)
+
+	// Create pending trades for employee stock plan vests as their dates pass
+	vestingSvc := vesting.NewManager(auditedDb, blotterSvc, mdata)
+	vestingSvc.StartVestingSchedule(sched, notificationsSvc)
+
+	// Snapshot the open positions daily, keeping daily snapshots for the retention and monthly thereafter, and post
+	// daily PnL moves beyond the threshold
+	portfolioSvc.StartSnapshotSchedule(sched, notificationsSvc)
+
+	// Purge trades removed beyond the retention from the recycle bin
+	blotterSvc.StartTrashPurgeSchedule(sched)
+
+	// Keep the historical data cache warm with the daily close of held and watched tickers
+	mdata.StartEndOfDayCapture(sched, portfolioSvc.GetOpenTickers)
+
 	// Start the http server to serve requests
 	addr := fmt.Sprintf("%s:%s", config.Host, config.Port)
 	srv := server.NewServer(addr, blotterSvc, portfolioSvc)
+	srv.SetNotificationsManager(notificationsSvc)
+	srv.SetAlertsManager(alertsSvc)
+	srv.SetUsersDatabase(observedDb)
+	srv.SetAuditLog(auditLog)
+	srv.SetVestingManager(vestingSvc)
+	srv.SetMetrics(metrics)
+
+	// Back up the database daily to the backup source, restores reload the blotter and then the portfolio
+	if config.Backup.Source != "" || config.Backup.Local.Path != "" {
+		snapshotter, ok := db.(dal.Snapshotter)
+		if !ok {
+			logger.Fatalf("Backup is configured but the %s database cannot be backed up", config.Db)
+		}
+		source, err := backup.NewSource(config.Backup)
+		if err != nil {
+			logger.Fatalf("Failed to create backup source: %s", err)
+		}
+		backupSvc := backup.NewService(snapshotter, source, blotterSvc, portfolioSvc)
+		backupSvc.StartBackupSchedule(sched, notificationsSvc)
+		srv.SetBackupService(backupSvc)
+	}
+
+	// Stop accepting requests once signalled, letting the requests in flight finish
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		logger.Info("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Failed to shut down server:", err)
+		}
+	}()
 
 	if err := srv.Start(ctx); err != nil {
 		logger.Error("Failed to start server:", err)
 	}
 
-	// Exit
-	os.Exit(0)
+	// Start returns as soon as shutdown begins, wait for the requests in flight and then the running scheduled tasks
+	// before the deferred close of the database
+	stop()
+	<-shutdownDone
+	stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := sched.Stop(stopCtx); err != nil {
+		logger.Error("Failed to stop scheduler:", err)
+	}
+}
+
+// loadConfig loads the configuration file and sets up the logger, shared by the server and subcommands.
+func loadConfig(configFilePath string) (*config.Config, *logging.Logger, error) {
+	cfg, err := config.GetOrCreateConfig(configFilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	logger, err := logging.InitializeLogger(cfg.VerboseLogging, cfg.LogFilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup logger: %w", err)
+	}
+	if err := logger.SetFormat(cfg.LogFormat); err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, logger, nil
+}
+
+// registerReloadHooks applies the settings of a reloaded config which are not read on every use, see
+// POST /api/v1/admin/config/reload.
+func registerReloadHooks(logger *logging.Logger) {
+	config.OnReload(func(cfg *config.Config) {
+		logger.SetVerbose(cfg.VerboseLogging)
+		mdata.ApplyRateLimitConfig()
+	})
+}
+
+// openDatabase opens the configured database. LevelDB holds an exclusive lock on the database directory, so
+// a subcommand cannot write to the database while the server is running.
+func openDatabase(cfg *config.Config) (dal.Database, error) {
+	db, err := dal.Open(cfg.Db, cfg.DbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s: %w", cfg.Db, err)
+	}
+	return db, nil
 }
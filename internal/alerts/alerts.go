@@ -0,0 +1,348 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/scheduler"
+	"portfolio-manager/pkg/types"
+
+	"github.com/google/uuid"
+)
+
+// Alert conditions on the price of the ticker
+const (
+	ConditionAbove = "above"
+	ConditionBelow = "below"
+)
+
+// Alert statuses
+const (
+	StatusActive = "active" // evaluated against the price
+	StatusFired  = "fired"  // condition met, re-armed after the cooldown when the price is back across the threshold
+)
+
+// defaultIntervalMinutes is how often alerts are evaluated when not configured
+const defaultIntervalMinutes = 5
+
+// Alert is a price alert rule on a ticker, firing once when its condition is met.
+type Alert struct {
+	ID              string  `json:"id"`
+	Ticker          string  `json:"ticker"`
+	Condition       string  `json:"condition"` // above or below
+	Price           float64 `json:"price"`
+	Book            string  `json:"book,omitempty"`            // optional, restricts the alert to users who may see the book
+	CooldownMinutes int     `json:"cooldownMinutes,omitempty"` // re-arms the alert after firing, never when 0
+	Status          string  `json:"status"`
+	CreatedAt       string  `json:"createdAt"`         // RFC3339
+	FiredAt         string  `json:"firedAt,omitempty"` // RFC3339 of the last firing
+	FiredPrice      float64 `json:"firedPrice,omitempty"`
+}
+
+// Trigger records an alert firing.
+type Trigger struct {
+	AlertID   string
+	Ticker    string
+	Condition string
+	Threshold float64
+	Price     float64
+	Book      string `json:",omitempty"`
+	FiredAt   string // RFC3339
+}
+
+// Notifier posts notifications raised by background jobs, e.g. the notifications manager.
+type Notifier interface {
+	Notify(source, message string) error
+}
+
+// PriceGetter provides the current price of a ticker, e.g. the market data manager.
+type PriceGetter interface {
+	GetAssetPrice(ticker string) (*types.AssetData, error)
+}
+
+// Manager persists price alerts and evaluates them against the current prices.
+type Manager struct {
+	db     dal.Database
+	mdata  PriceGetter
+	mu     sync.Mutex
+	logger *logging.Logger
+}
+
+// NewManager creates a new alerts manager.
+func NewManager(db dal.Database, mdata PriceGetter) *Manager {
+	return &Manager{
+		db:     db,
+		mdata:  mdata,
+		logger: logging.GetLogger(),
+	}
+}
+
+// Validate checks the alert has a ticker, a condition and a positive price.
+func (a *Alert) Validate() error {
+	if a.Ticker == "" {
+		return errors.New("ticker is required")
+	}
+	if a.Condition != ConditionAbove && a.Condition != ConditionBelow {
+		return fmt.Errorf("invalid condition %s, expected above or below", a.Condition)
+	}
+	if a.Price <= 0 {
+		return errors.New("price must be positive")
+	}
+	if a.CooldownMinutes < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+	return nil
+}
+
+// AddAlert validates and adds an active alert, returning it with its generated ID.
+func (m *Manager) AddAlert(alert Alert) (*Alert, error) {
+	alert.Ticker = strings.ToUpper(strings.TrimSpace(alert.Ticker))
+	alert.Condition = strings.ToLower(alert.Condition)
+	if err := alert.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alert.ID = uuid.New().String()
+	alert.Status = StatusActive
+	alert.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	alert.FiredAt, alert.FiredPrice = "", 0
+	if err := m.db.Put(alertKey(alert.ID), alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// GetAlert returns the alert of the ID.
+func (m *Manager) GetAlert(id string) (*Alert, error) {
+	var alert Alert
+	if err := m.db.Get(alertKey(id), &alert); err != nil {
+		return nil, fmt.Errorf("alert %s not found", id)
+	}
+	return &alert, nil
+}
+
+// GetAlerts returns the alerts visible to the user, all alerts when user is nil, sorted by ticker.
+func (m *Manager) GetAlerts(user *types.User) ([]Alert, error) {
+	alerts, err := dal.ParallelLoad[Alert](m.db, string(types.AlertKeyPrefix)+":")
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []Alert{}
+	for _, alert := range alerts {
+		if canSee(user, alert.Book) {
+			visible = append(visible, alert)
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		if visible[i].Ticker != visible[j].Ticker {
+			return visible[i].Ticker < visible[j].Ticker
+		}
+		return visible[i].CreatedAt < visible[j].CreatedAt
+	})
+	return visible, nil
+}
+
+// DeleteAlert deletes the alert of the ID, its triggers are kept.
+func (m *Manager) DeleteAlert(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.GetAlert(id); err != nil {
+		return err
+	}
+	return m.db.Delete(alertKey(id))
+}
+
+// GetTriggers returns the alert firings visible to the user, all when user is nil, newest first.
+func (m *Manager) GetTriggers(user *types.User) ([]Trigger, error) {
+	keys, err := m.db.GetAllKeysWithPrefix(string(types.AlertTriggeredKeyPrefix) + ":")
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	triggers := []Trigger{}
+	for _, key := range keys {
+		var trigger Trigger
+		if err := m.db.Get(key, &trigger); err != nil {
+			return nil, err
+		}
+		if canSee(user, trigger.Book) {
+			triggers = append(triggers, trigger)
+		}
+	}
+	return triggers, nil
+}
+
+// Evaluate evaluates the alerts against the current price of their tickers as of now. Active alerts whose condition
+// is met fire once, recording a trigger and posting it to the notifier, which may be nil. Fired alerts with a
+// cooldown are re-armed once the cooldown has passed and the price is back across the threshold, so a price
+// hovering around the threshold does not fire repeatedly. The fired alerts are returned.
+func (m *Manager) Evaluate(now time.Time, notifier Notifier) ([]Trigger, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts, err := dal.ParallelLoad[Alert](m.db, string(types.AlertKeyPrefix)+":")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].CreatedAt < alerts[j].CreatedAt })
+
+	prices := make(map[string]float64)
+	var fired []Trigger
+	var errs []error
+	for _, alert := range alerts {
+		if alert.Status == StatusFired && alert.CooldownMinutes == 0 {
+			continue
+		}
+
+		price, ok := prices[alert.Ticker]
+		if !ok {
+			data, err := m.mdata.GetAssetPrice(alert.Ticker)
+			if err != nil || data == nil {
+				errs = append(errs, fmt.Errorf("failed to get price of %s: %w", alert.Ticker, err))
+				prices[alert.Ticker] = 0
+				continue
+			}
+			price = data.Price
+			prices[alert.Ticker] = price
+		}
+		if price <= 0 {
+			continue
+		}
+
+		if alert.Status == StatusFired {
+			if !alert.rearmable(now, price) {
+				continue
+			}
+			alert.Status = StatusActive
+			if err := m.db.Put(alertKey(alert.ID), alert); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if !alert.met(price) {
+			continue
+		}
+
+		trigger, err := m.fire(&alert, price, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fired = append(fired, *trigger)
+		if notifier != nil {
+			if err := notifier.Notify("alert", trigger.message()); err != nil {
+				m.logger.Warnf("Failed to post alert notification: %v", err)
+			}
+		}
+	}
+	return fired, errors.Join(errs...)
+}
+
+// fire marks the alert fired at the price and records the trigger.
+func (m *Manager) fire(alert *Alert, price float64, now time.Time) (*Trigger, error) {
+	firedAt := now.UTC()
+	alert.Status = StatusFired
+	alert.FiredAt = firedAt.Format(time.RFC3339)
+	alert.FiredPrice = price
+	if err := m.db.Put(alertKey(alert.ID), *alert); err != nil {
+		return nil, fmt.Errorf("failed to mark alert %s fired: %w", alert.ID, err)
+	}
+
+	trigger := Trigger{
+		AlertID:   alert.ID,
+		Ticker:    alert.Ticker,
+		Condition: alert.Condition,
+		Threshold: alert.Price,
+		Price:     price,
+		Book:      alert.Book,
+		FiredAt:   alert.FiredAt,
+	}
+	// keys sort chronologically
+	key := fmt.Sprintf("%s:%s:%s", types.AlertTriggeredKeyPrefix, firedAt.Format(time.RFC3339Nano), alert.ID)
+	if err := m.db.Put(key, trigger); err != nil {
+		return nil, fmt.Errorf("failed to record trigger of alert %s: %w", alert.ID, err)
+	}
+	return &trigger, nil
+}
+
+// met returns whether the price meets the condition of the alert.
+func (a *Alert) met(price float64) bool {
+	if a.Condition == ConditionAbove {
+		return price >= a.Price
+	}
+	return price <= a.Price
+}
+
+// rearmable returns whether the fired alert may be re-armed, once its cooldown has passed and the price no longer
+// meets its condition.
+func (a *Alert) rearmable(now time.Time, price float64) bool {
+	firedAt, err := time.Parse(time.RFC3339, a.FiredAt)
+	if err != nil {
+		return !a.met(price)
+	}
+	return !now.Before(firedAt.Add(time.Duration(a.CooldownMinutes)*time.Minute)) && !a.met(price)
+}
+
+func (t Trigger) message() string {
+	message := fmt.Sprintf("%s is %s %v at %v", t.Ticker, t.Condition, t.Threshold, t.Price)
+	if t.Book != "" {
+		message += fmt.Sprintf(" (%s)", t.Book)
+	}
+	return message
+}
+
+// StartAlertsSchedule evaluates the alerts at the configured interval until the scheduler is stopped, posting the
+// fired alerts to the notifier, which may be nil.
+func (m *Manager) StartAlertsSchedule(sched *scheduler.Scheduler, notifier Notifier) {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg != nil && cfg.Alerts.Disabled {
+		m.logger.Info("Price alerts are disabled")
+		return
+	}
+
+	sched.Every("alerts", time.Duration(intervalMinutes())*time.Minute, func() error {
+		return m.runScheduledAlerts(time.Now(), notifier)
+	})
+}
+
+// runScheduledAlerts evaluates the alerts as of now, returning the errors of the evaluation.
+func (m *Manager) runScheduledAlerts(now time.Time, notifier Notifier) error {
+	fired, err := m.Evaluate(now, notifier)
+	for _, trigger := range fired {
+		m.logger.Infof("Price alert %s fired: %s", trigger.AlertID, trigger.message())
+	}
+	if err != nil {
+		m.logger.Warnf("Failed to evaluate price alerts: %v", err)
+	}
+	return err
+}
+
+// canSee returns whether the user may see an alert of the book, alerts without a book are visible to all users.
+func canSee(user *types.User, book string) bool {
+	return user == nil || book == "" || user.CanSeeBook(book)
+}
+
+func intervalMinutes() int {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.Alerts.IntervalMinutes <= 0 {
+		return defaultIntervalMinutes
+	}
+	return cfg.Alerts.IntervalMinutes
+}
+
+func alertKey(id string) string {
+	return fmt.Sprintf("%s:%s", types.AlertKeyPrefix, id)
+}
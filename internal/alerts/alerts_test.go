@@ -0,0 +1,138 @@
+package alerts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	messages []string
+}
+
+func (n *recordingNotifier) Notify(source, message string) error {
+	n.messages = append(n.messages, source+": "+message)
+	return nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *mocks.MockMarketDataManager) {
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	mdataMgr := mocks.NewMockMarketDataManager()
+	return NewManager(db, mdataMgr), mdataMgr
+}
+
+func TestAddAlertValidation(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	_, err := m.AddAlert(Alert{Ticker: "AAPL", Condition: "crosses", Price: 200})
+	assert.Error(t, err)
+	_, err = m.AddAlert(Alert{Ticker: "AAPL", Condition: ConditionAbove})
+	assert.Error(t, err)
+	_, err = m.AddAlert(Alert{Condition: ConditionAbove, Price: 200})
+	assert.Error(t, err)
+
+	alert, err := m.AddAlert(Alert{Ticker: " aapl ", Condition: "ABOVE", Price: 200, Book: "traderA"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, alert.ID)
+	assert.Equal(t, "AAPL", alert.Ticker)
+	assert.Equal(t, ConditionAbove, alert.Condition)
+	assert.Equal(t, StatusActive, alert.Status)
+
+	_, err = m.AddAlert(Alert{Ticker: "ES3", Condition: ConditionBelow, Price: 3})
+	require.NoError(t, err)
+
+	// alerts of books the user may not see are hidden, alerts without a book are visible to all
+	all, err := m.GetAlerts(nil)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+	visible, err := m.GetAlerts(&types.User{Name: "bob", Books: []string{"traderB"}})
+	assert.NoError(t, err)
+	require.Len(t, visible, 1)
+	assert.Equal(t, "ES3", visible[0].Ticker)
+
+	assert.NoError(t, m.DeleteAlert(alert.ID))
+	assert.Error(t, m.DeleteAlert(alert.ID))
+}
+
+func TestEvaluateFiresOnceAndRearmsAfterCooldown(t *testing.T) {
+	m, mdataMgr := newTestManager(t)
+	notifier := &recordingNotifier{}
+
+	oneShot, err := m.AddAlert(Alert{Ticker: "AAPL", Condition: ConditionAbove, Price: 200})
+	require.NoError(t, err)
+	rearming, err := m.AddAlert(Alert{Ticker: "ES3", Condition: ConditionBelow, Price: 3, CooldownMinutes: 60})
+	require.NoError(t, err)
+
+	now := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 199})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 3.1})
+	fired, err := m.Evaluate(now, notifier)
+	assert.NoError(t, err)
+	assert.Empty(t, fired)
+
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 201})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 2.9})
+	fired, err = m.Evaluate(now.Add(5*time.Minute), notifier)
+	assert.NoError(t, err)
+	assert.Len(t, fired, 2)
+	assert.ElementsMatch(t, []string{"alert: AAPL is above 200 at 201", "alert: ES3 is below 3 at 2.9"}, notifier.messages)
+
+	alert, err := m.GetAlert(oneShot.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFired, alert.Status)
+	assert.Equal(t, 201.0, alert.FiredPrice)
+	assert.Equal(t, "2024-06-03T09:05:00Z", alert.FiredAt)
+
+	// a price flapping around the threshold does not fire again within the cooldown
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 3.05})
+	_, err = m.Evaluate(now.Add(10*time.Minute), notifier)
+	assert.NoError(t, err)
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 2.95})
+	fired, err = m.Evaluate(now.Add(15*time.Minute), notifier)
+	assert.NoError(t, err)
+	assert.Empty(t, fired)
+
+	// once the cooldown has passed, the alert re-arms when the price is back across the threshold
+	fired, err = m.Evaluate(now.Add(2*time.Hour), notifier)
+	assert.NoError(t, err)
+	assert.Empty(t, fired)
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 3.05})
+	_, err = m.Evaluate(now.Add(2*time.Hour+5*time.Minute), notifier)
+	assert.NoError(t, err)
+	alert, err = m.GetAlert(rearming.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, alert.Status)
+
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 2.8})
+	fired, err = m.Evaluate(now.Add(2*time.Hour+10*time.Minute), nil)
+	assert.NoError(t, err)
+	require.Len(t, fired, 1)
+	assert.Equal(t, 2.8, fired[0].Price)
+
+	// triggers are recorded whether or not a notifier is set, newest first
+	triggers, err := m.GetTriggers(nil)
+	assert.NoError(t, err)
+	require.Len(t, triggers, 3)
+	assert.Equal(t, 2.8, triggers[0].Price)
+	assert.Equal(t, rearming.ID, triggers[0].AlertID)
+}
+
+func TestEvaluateReportsPriceFailures(t *testing.T) {
+	m, _ := newTestManager(t)
+	_, err := m.AddAlert(Alert{Ticker: "MISSING", Condition: ConditionAbove, Price: 1})
+	require.NoError(t, err)
+
+	fired, err := m.Evaluate(time.Now(), nil)
+	assert.ErrorContains(t, err, "MISSING")
+	assert.Empty(t, fired)
+}
@@ -0,0 +1,153 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/types"
+)
+
+// HandleAlertsGet handles listing the price alerts.
+// @Summary Get price alerts
+// @Description Retrieve the price alerts visible to the user, with their status and last firing, sorted by ticker
+// @Tags alerts
+// @Produce json
+// @Success 200 {array} Alert
+// @Failure 500 {string} string "Failed to get alerts"
+// @Router /api/v1/alerts [get]
+func HandleAlertsGet(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alerts, err := manager.GetAlerts(types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alerts)
+	}
+}
+
+// HandleAlertPost handles adding a price alert.
+// @Summary Add a price alert
+// @Description Add an alert firing once when the price of the ticker is above or below the price. With a cooldown, the alert re-arms once the cooldown has passed and the price is back across the threshold.
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param alert body Alert true "Alert with ticker, condition (above or below), price and optional book and cooldownMinutes"
+// @Success 201 {object} Alert
+// @Failure 400 {string} string "Invalid request payload"
+// @Router /api/v1/alerts [post]
+func HandleAlertPost(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if user := types.UserFromContext(r.Context()); user != nil && alert.Book != "" && !user.CanSeeBook(alert.Book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		added, err := manager.AddAlert(alert)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(added)
+	}
+}
+
+// HandleAlertDelete handles deleting a price alert.
+// @Summary Delete a price alert
+// @Tags alerts
+// @Param id path string true "Alert ID"
+// @Success 204
+// @Failure 404 {string} string "Alert not found"
+// @Router /api/v1/alerts/{id} [delete]
+func HandleAlertDelete(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1/alerts/")
+		alert, err := manager.GetAlert(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		if !canSee(types.UserFromContext(r.Context()), alert.Book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		if err := manager.DeleteAlert(id); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleTriggersGet handles listing the alert firings.
+// @Summary Get triggered alerts
+// @Description Retrieve the firings of the price alerts visible to the user, newest first, whether or not notifications are configured
+// @Tags alerts
+// @Produce json
+// @Success 200 {array} Trigger
+// @Failure 500 {string} string "Failed to get triggered alerts"
+// @Router /api/v1/alerts/triggered [get]
+func HandleTriggersGet(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		triggers, err := manager.GetTriggers(types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(triggers)
+	}
+}
+
+// RegisterHandlers registers the handlers for the alerts service.
+func RegisterHandlers(mux *http.ServeMux, manager *Manager) {
+	mux.HandleFunc("/api/v1/alerts", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleAlertsGet(manager).ServeHTTP(w, r)
+		case http.MethodPost:
+			HandleAlertPost(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/alerts/triggered", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleTriggersGet(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/alerts/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/api/v1/alerts/") == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodDelete:
+			HandleAlertDelete(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
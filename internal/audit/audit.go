@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+)
+
+// Sources of audited changes
+const (
+	SourceAPI        = "api"        // http api requests
+	SourceCSV        = "csv"        // file imports, e.g. CSV and IBKR flex queries
+	SourceMigration  = "migration"  // rewrites of existing records, e.g. ticker renames and stock splits
+	SourceScheduler  = "scheduler"  // background jobs, e.g. the auto-close of matured bonds
+	SourceMarketData = "marketdata" // dividends fetched from market data sources
+)
+
+// Operations of audited changes
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// maxSnippetLen caps the length of the before and after JSON snippets of an entry
+const maxSnippetLen = 2048
+
+// timestampLayout is a fixed width RFC3339 layout, so that entry keys sort chronologically
+const timestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Entry is an append-only record of a change to a database entity.
+type Entry struct {
+	Timestamp string `json:"timestamp"` // RFC3339 with nanoseconds
+	Operation string `json:"operation"` // create, update or delete
+	EntityKey string `json:"entityKey"` // database key of the entity, e.g. TRADE:D05.SI:1:<trade id>
+	Before    string `json:"before"`    // JSON snippet of the entity before the change, empty on create
+	After     string `json:"after"`     // JSON snippet of the entity after the change, empty on delete
+	Source    string `json:"source"`    // api, csv, migration, scheduler or marketdata
+}
+
+// Filter selects audit entries by time range and entity key prefix, empty fields match all entries.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	Entity string // entity key prefix, e.g. TRADE or TRADE:D05.SI
+}
+
+// Log persists audit entries. Recording is best-effort, failures are logged and never returned to the caller.
+type Log struct {
+	db  dal.Database
+	mu  sync.Mutex
+	seq int
+}
+
+// NewLog creates a new audit log.
+func NewLog(db dal.Database) *Log {
+	return &Log{db: db}
+}
+
+// Record appends an entry for the change of the entity, stamping it with the current time.
+func (l *Log) Record(source, operation, entityKey string, before, after []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().UTC()
+	entry := Entry{
+		Timestamp: now.Format(timestampLayout),
+		Operation: operation,
+		EntityKey: entityKey,
+		Before:    snippet(before),
+		After:     snippet(after),
+		Source:    source,
+	}
+
+	// keys sort chronologically, the sequence number orders entries recorded within the same nanosecond
+	l.seq++
+	key := fmt.Sprintf("%s:%s:%09d", types.AuditKeyPrefix, entry.Timestamp, l.seq%1_000_000_000)
+	if err := l.db.Put(key, entry); err != nil {
+		logging.GetLogger().Warnf("Failed to record audit entry for %s: %v", entityKey, err)
+	}
+}
+
+// GetEntries returns the entries matching the filter, oldest first.
+func (l *Log) GetEntries(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys, err := l.db.GetAllKeysWithPrefix(string(types.AuditKeyPrefix) + ":")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, key := range keys {
+		var entry Entry
+		if err := l.db.Get(key, &entry); err != nil {
+			return nil, err
+		}
+
+		timestamp, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			continue
+		}
+		if !filter.From.IsZero() && timestamp.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && timestamp.After(filter.To) {
+			continue
+		}
+		if filter.Entity != "" && !strings.HasPrefix(entry.EntityKey, filter.Entity) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ToCSV writes the entries to a CSV file in memory.
+func ToCSV(entries []Entry) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	if err := writer.Write([]string{"Timestamp", "Operation", "EntityKey", "Before", "After", "Source"}); err != nil {
+		return nil, fmt.Errorf("error writing CSV header: %w", err)
+	}
+	for _, entry := range entries {
+		if err := writer.Write([]string{entry.Timestamp, entry.Operation, entry.EntityKey, entry.Before, entry.After, entry.Source}); err != nil {
+			return nil, fmt.Errorf("error writing CSV row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("error flushing CSV writer: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// snippet truncates the JSON to maxSnippetLen.
+func snippet(data []byte) string {
+	if len(data) <= maxSnippetLen {
+		return string(data)
+	}
+	return string(data[:maxSnippetLen]) + "..."
+}
@@ -0,0 +1,190 @@
+package audit_test
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/csvutil"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAuditedDB(t *testing.T) (*audit.Log, *audit.Database) {
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	auditLog := audit.NewLog(db)
+	return auditLog, audit.NewDatabase(db, auditLog, audit.SourceAPI)
+}
+
+// lastEntry returns the latest audit entry of the entity key prefix.
+func lastEntry(t *testing.T, auditLog *audit.Log, entity string) audit.Entry {
+	entries, err := auditLog.GetEntries(audit.Filter{Entity: entity})
+	require.NoError(t, err)
+	require.NotEmpty(t, entries, "no audit entries for %s", entity)
+	return entries[len(entries)-1]
+}
+
+func TestBlotterMutationsAreAudited(t *testing.T) {
+	config.SetConfig(&config.Config{})
+	defer config.SetConfig(nil)
+
+	auditLog, db := setupAuditedDB(t)
+	blotterSvc := blotter.NewBlotter(db)
+	tradeDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// api
+	buy, err := blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "traderA", "dbs", "cdp", 30, 0, tradeDate)
+	require.NoError(t, err)
+	require.NoError(t, blotterSvc.AddTrade(*buy))
+
+	entry := lastEntry(t, auditLog, "TRADE:D05.SI")
+	assert.Equal(t, audit.OperationCreate, entry.Operation)
+	assert.Equal(t, audit.SourceAPI, entry.Source)
+	assert.Empty(t, entry.Before)
+	assert.Contains(t, entry.After, buy.TradeID)
+
+	// csv
+	csvData := "TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account\n" +
+		"2024-01-03T00:00:00Z,ES3.SI,buy,100,3.4,0,traderA,dbs,cdp\n"
+	require.NoError(t, blotterSvc.ImportFromCSVReaderWithFormat(csv.NewReader(strings.NewReader(csvData)), csvutil.DefaultFormat, nil))
+	entry = lastEntry(t, auditLog, "TRADE:ES3.SI")
+	assert.Equal(t, audit.OperationCreate, entry.Operation)
+	assert.Equal(t, audit.SourceCSV, entry.Source)
+
+	// scheduler
+	closed, err := blotterSvc.ClosePosition("traderA", "ES3.SI", 100, 3.5, tradeDate.AddDate(0, 0, 2), nil, audit.SourceScheduler)
+	require.NoError(t, err)
+	entry = lastEntry(t, auditLog, "TRADE:ES3.SI")
+	assert.Equal(t, audit.SourceScheduler, entry.Source)
+	assert.Contains(t, entry.After, closed[0].TradeID)
+
+	// migration
+	_, err = blotterSvc.ApplySplit("D05.SI", 2, "2024-06-01")
+	require.NoError(t, err)
+	entry = lastEntry(t, auditLog, "TRADE:D05.SI")
+	assert.Equal(t, audit.OperationUpdate, entry.Operation)
+	assert.Equal(t, audit.SourceMigration, entry.Source)
+	assert.Contains(t, entry.Before, `"Quantity":100`)
+	assert.Contains(t, entry.After, `"Quantity":200`)
+
+	// remove
+	require.NoError(t, blotterSvc.RemoveTrade(buy.TradeID))
+	entry = lastEntry(t, auditLog, "TRADE:D05.SI")
+	assert.Equal(t, audit.OperationDelete, entry.Operation)
+	assert.Contains(t, entry.Before, buy.TradeID)
+	assert.Empty(t, entry.After)
+}
+
+func TestReferenceDataMutationsAreAudited(t *testing.T) {
+	auditLog, db := setupAuditedDB(t)
+	rdataSvc, err := rdata.NewManager(db, "")
+	require.NoError(t, err)
+
+	ticker := rdata.TickerReference{ID: "D05.SI", Name: "DBS", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"}
+	_, err = rdataSvc.AddTicker(ticker)
+	require.NoError(t, err)
+	assert.Equal(t, audit.OperationCreate, lastEntry(t, auditLog, "REFDATA:D05.SI").Operation)
+
+	ticker.Name = "DBS Group"
+	require.NoError(t, rdataSvc.UpdateTicker(&ticker))
+	entry := lastEntry(t, auditLog, "REFDATA:D05.SI")
+	assert.Equal(t, audit.OperationUpdate, entry.Operation)
+	assert.Contains(t, entry.Before, `"DBS"`)
+	assert.Contains(t, entry.After, "DBS Group")
+
+	require.NoError(t, rdataSvc.DeleteTicker("D05.SI"))
+	assert.Equal(t, audit.OperationDelete, lastEntry(t, auditLog, "REFDATA:D05.SI").Operation)
+}
+
+func TestDividendsAndPositionsAreAudited(t *testing.T) {
+	auditLog, db := setupAuditedDB(t)
+
+	// dividends stored by market data sources
+	mdataDb := audit.WithSource(db, audit.SourceMarketData)
+	dividendsKey := fmt.Sprintf("%s:%s", types.DividendsKeyPrefix, "D05.SI")
+	require.NoError(t, mdataDb.Put(dividendsKey, []types.DividendsMetadata{{Ticker: "D05.SI", ExDate: "2024-05-10", Amount: 0.54}}))
+	entry := lastEntry(t, auditLog, dividendsKey)
+	assert.Equal(t, audit.SourceMarketData, entry.Source)
+
+	// positions are only audited on delete
+	positionKey := fmt.Sprintf("%s:%s:%s", types.PositionKeyPrefix, "traderA", "D05.SI")
+	require.NoError(t, db.Put(positionKey, map[string]float64{"Qty": 100}))
+	entries, err := auditLog.GetEntries(audit.Filter{Entity: string(types.PositionKeyPrefix)})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	require.NoError(t, audit.WithSource(db, audit.SourceMigration).Delete(positionKey))
+	entry = lastEntry(t, auditLog, string(types.PositionKeyPrefix))
+	assert.Equal(t, audit.OperationDelete, entry.Operation)
+	assert.Equal(t, audit.SourceMigration, entry.Source)
+	assert.Contains(t, entry.Before, `"Qty":100`)
+}
+
+func TestGetEntriesFilterAndCSV(t *testing.T) {
+	auditLog, db := setupAuditedDB(t)
+	start := time.Now()
+	require.NoError(t, db.Put("REFDATA:A", "a"))
+	require.NoError(t, db.Put("REFDATA:B", "b"))
+	require.NoError(t, db.Put("RECLAIM:A:2024-05-10:traderA", "c"))
+
+	entries, err := auditLog.GetEntries(audit.Filter{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "REFDATA:A", entries[0].EntityKey) // oldest first
+
+	entries, err = auditLog.GetEntries(audit.Filter{Entity: "REFDATA"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, err = auditLog.GetEntries(audit.Filter{From: start.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = auditLog.GetEntries(audit.Filter{To: start.Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = auditLog.GetEntries(audit.Filter{From: start.Add(-time.Minute), To: start.Add(time.Minute)})
+	require.NoError(t, err)
+	data, err := audit.ToCSV(entries)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "Timestamp,Operation,EntityKey,Before,After,Source", lines[0])
+}
+
+// failingDatabase fails all writes, standing in for an unavailable audit store.
+type failingDatabase struct {
+	dal.Database
+}
+
+func (f failingDatabase) Put(key string, v interface{}) error {
+	return errors.New("audit store unavailable")
+}
+
+func TestAuditFailureDoesNotFailMutation(t *testing.T) {
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	audited := audit.NewDatabase(db, audit.NewLog(failingDatabase{db}), audit.SourceAPI)
+	require.NoError(t, audited.Put("REFDATA:A", "a"))
+
+	var value string
+	require.NoError(t, db.Get("REFDATA:A", &value))
+	assert.Equal(t, "a", value)
+}
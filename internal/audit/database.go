@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/types"
+)
+
+// Database wraps a database, recording the changes of audited entities in the audit log. Positions are derived from
+// trades and rewritten on every trade, so only their deletes are audited.
+type Database struct {
+	dal.Database
+	log    *Log
+	source string
+}
+
+// NewDatabase wraps the database, attributing the changes made through it to the source.
+func NewDatabase(db dal.Database, log *Log, source string) *Database {
+	return &Database{Database: db, log: log, source: source}
+}
+
+// WithSource returns the database attributing changes to the source instead, when it is audited.
+func WithSource(db dal.Database, source string) dal.Database {
+	if audited, ok := db.(*Database); ok {
+		return &Database{Database: audited.Database, log: audited.log, source: source}
+	}
+	return db
+}
+
+// Put writes the value, recording the change when the key is audited.
+func (d *Database) Put(key string, v interface{}) error {
+	if !isAudited(key, OperationUpdate) {
+		return d.Database.Put(key, v)
+	}
+
+	before := d.snapshot(key)
+	if err := d.Database.Put(key, v); err != nil {
+		return err
+	}
+
+	operation := OperationUpdate
+	if before == nil {
+		operation = OperationCreate
+	}
+	after, _ := json.Marshal(v)
+	d.log.Record(d.source, operation, key, before, after)
+	return nil
+}
+
+// Delete deletes the key, recording the change when the key is audited.
+func (d *Database) Delete(key string) error {
+	if !isAudited(key, OperationDelete) {
+		return d.Database.Delete(key)
+	}
+
+	before := d.snapshot(key)
+	if err := d.Database.Delete(key); err != nil {
+		return err
+	}
+
+	d.log.Record(d.source, OperationDelete, key, before, nil)
+	return nil
+}
+
+// change is an audited change of a batch, recorded once the batch is committed.
+type change struct {
+	operation string
+	key       string
+	before    []byte
+	after     []byte
+}
+
+// batch records the audited changes of the wrapped batch once it is committed.
+type batch struct {
+	dal.Batch
+	d       *Database
+	changes []change
+}
+
+// Batch returns a batch of writes applied together on Commit, recording the audited changes after the commit.
+func (d *Database) Batch() dal.Batch {
+	return &batch{Batch: d.Database.Batch(), d: d}
+}
+
+func (b *batch) Put(key string, v interface{}) error {
+	if !isAudited(key, OperationUpdate) {
+		return b.Batch.Put(key, v)
+	}
+
+	before := b.d.snapshot(key)
+	if err := b.Batch.Put(key, v); err != nil {
+		return err
+	}
+
+	operation := OperationUpdate
+	if before == nil {
+		operation = OperationCreate
+	}
+	after, _ := json.Marshal(v)
+	b.changes = append(b.changes, change{operation, key, before, after})
+	return nil
+}
+
+func (b *batch) Delete(key string) error {
+	if !isAudited(key, OperationDelete) {
+		return b.Batch.Delete(key)
+	}
+
+	before := b.d.snapshot(key)
+	if err := b.Batch.Delete(key); err != nil {
+		return err
+	}
+
+	b.changes = append(b.changes, change{OperationDelete, key, before, nil})
+	return nil
+}
+
+func (b *batch) Commit() error {
+	if err := b.Batch.Commit(); err != nil {
+		return err
+	}
+
+	for _, c := range b.changes {
+		b.d.log.Record(b.d.source, c.operation, c.key, c.before, c.after)
+	}
+	b.changes = nil
+	return nil
+}
+
+// snapshot returns the current JSON value of the key, nil when it does not exist.
+func (d *Database) snapshot(key string) []byte {
+	var value json.RawMessage
+	if err := d.Database.Get(key, &value); err != nil || len(value) == 0 {
+		return nil
+	}
+	return value
+}
+
+// isAudited returns whether the operation on the key is audited.
+func isAudited(key, operation string) bool {
+	prefix, _, _ := strings.Cut(key, ":")
+	switch prefix {
+	case string(types.TradeKeyPrefix), string(types.DividendsKeyPrefix), string(types.CustomDividendsKeyPrefix), string(types.WithholdingTaxKeyPrefix),
+		string(types.ReclaimKeyPrefix), string(types.ReferenceDataKeyPrefix), string(types.CorporateActionKeyPrefix), string(types.VestingKeyPrefix):
+		return true
+	case string(types.PositionKeyPrefix):
+		return operation == OperationDelete
+	default:
+		return false
+	}
+}
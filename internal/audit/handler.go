@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"portfolio-manager/pkg/types"
+)
+
+// HandleAuditGet handles retrieving the audit trail.
+// @Summary Get the audit trail
+// @Description Retrieve the changes to trades, positions, dividends and reference data, oldest first, optionally filtered by time range and entity key prefix. Admin only when authentication is enabled.
+// @Tags audit
+// @Produce json,text/csv
+// @Param from query string false "From, YYYY-MM-DD or RFC3339"
+// @Param to query string false "To, YYYY-MM-DD (inclusive) or RFC3339"
+// @Param entity query string false "Entity key prefix, e.g. TRADE or REFDATA:D05.SI"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {array} Entry
+// @Failure 400 {string} string "Invalid query parameters"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/audit [get]
+func HandleAuditGet(log *Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user := types.UserFromContext(r.Context()); user != nil && !user.Admin {
+			http.Error(w, "ERROR: admin only", http.StatusForbidden)
+			return
+		}
+
+		query := r.URL.Query()
+		from, err := parseTime(query.Get("from"), false)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: invalid from: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		to, err := parseTime(query.Get("to"), true)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: invalid to: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := log.GetEntries(Filter{From: from, To: to, Entity: query.Get("entity")})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		switch query.Get("format") {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(entries)
+		case "csv":
+			data, err := ToCSV(entries)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", "attachment; filename=audit.csv")
+			w.Write(data)
+		default:
+			http.Error(w, "ERROR: unsupported format, expected json or csv", http.StatusBadRequest)
+		}
+	}
+}
+
+// parseTime parses a YYYY-MM-DD date or RFC3339 time, dates are taken at the end of the day when endOfDay is set.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected YYYY-MM-DD or RFC3339, got %s", value)
+	}
+	if endOfDay {
+		return date.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return date, nil
+}
+
+// RegisterHandlers registers the handlers for the audit trail.
+func RegisterHandlers(mux *http.ServeMux, log *Log) {
+	mux.HandleFunc("/api/v1/audit", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleAuditGet(log).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
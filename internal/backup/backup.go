@@ -0,0 +1,369 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/scheduler"
+)
+
+const (
+	archivePrefix = "portfolio-manager-"
+	archiveSuffix = ".tar.gz"
+	archiveTime   = "20060102T150405Z"
+)
+
+// LatestBackup names the newest backup on restore.
+const LatestBackup = "latest"
+
+// Reloader reloads the state held in memory from the database, called after a restore.
+type Reloader interface {
+	Reload() error
+}
+
+// Notifier posts notifications raised by background jobs, e.g. the notifications manager.
+type Notifier interface {
+	Notify(source, message string) error
+}
+
+// Service backs up the database to a backup source and restores it.
+type Service struct {
+	db        dal.Snapshotter
+	source    Source
+	reloaders []Reloader
+	ranOn     string     // day of the last scheduled backup
+	mu        sync.Mutex // serialises backups and restores
+	logger    *logging.Logger
+}
+
+// NewService creates a backup service, the reloaders are reloaded in order after a restore.
+func NewService(db dal.Snapshotter, source Source, reloaders ...Reloader) *Service {
+	return &Service{
+		db:        db,
+		source:    source,
+		reloaders: reloaders,
+		logger:    logging.GetLogger(),
+	}
+}
+
+// BackupNow archives a consistent snapshot of the database and uploads it, returning the file name of the archive.
+func (s *Service) BackupNow() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.backup(time.Now())
+}
+
+func (s *Service) backup(now time.Time) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "portfolio-backup-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshotDir := filepath.Join(tmpDir, "db")
+	if err := s.db.Snapshot(snapshotDir); err != nil {
+		return "", err
+	}
+
+	name := archivePrefix + now.UTC().Format(archiveTime) + archiveSuffix
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeArchive(pw, snapshotDir))
+	}()
+
+	err = s.source.Upload(name, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+
+	s.logger.Infof("Backed up database to %s", name)
+
+	if _, err := s.prune(now); err != nil {
+		s.logger.Warnf("Failed to prune backups: %v", err)
+	}
+	return name, nil
+}
+
+// Prune deletes the backups outside the configured retention, returning their file names.
+func (s *Service) Prune(now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.prune(now)
+}
+
+func (s *Service) prune(now time.Time) ([]string, error) {
+	retention := backupRetention()
+	if retention.Count <= 0 && retention.MaxAgeDays <= 0 {
+		return nil, nil
+	}
+
+	backups, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.AddDate(0, 0, -retention.MaxAgeDays)
+	var pruned []string
+	for i, name := range backups {
+		expired := retention.Count > 0 && i >= retention.Count
+		if retention.MaxAgeDays > 0 {
+			if takenAt, err := archiveTimestamp(name); err == nil && takenAt.Before(cutoff) {
+				expired = true
+			}
+		}
+		if !expired {
+			continue
+		}
+
+		if err := s.source.Delete(name); err != nil {
+			return pruned, err
+		}
+		s.logger.Infof("Pruned backup %s", name)
+		pruned = append(pruned, name)
+	}
+
+	return pruned, nil
+}
+
+// List returns the file names of the backups, newest first.
+func (s *Service) List() ([]string, error) {
+	names, err := s.source.List()
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	for _, name := range names {
+		if isArchiveName(name) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	return backups, nil
+}
+
+// Restore downloads the backup, verifies it opens as a database and swaps it in place of the database, keeping
+// the replaced database as <dbPath>.bak. The newest backup is restored when name is empty or "latest". The in
+// memory state of the reloaders is reloaded from the restored database. It returns the file name restored.
+func (s *Service) Restore(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "" || name == LatestBackup {
+		backups, err := s.List()
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", errors.New("no backups to restore")
+		}
+		name = backups[0]
+	}
+	if !isArchiveName(name) {
+		return "", fmt.Errorf("invalid backup file name: %s", name)
+	}
+
+	return name, s.restore(name)
+}
+
+func (s *Service) restore(name string) error {
+	archive, err := os.CreateTemp("", "portfolio-restore-*"+archiveSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create download file: %w", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := s.source.Download(name, archive); err != nil {
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	// Extract next to the database, so it can be moved into place
+	restoreDir, err := os.MkdirTemp(filepath.Dir(s.db.Path()), ".restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create restore directory: %w", err)
+	}
+	defer os.RemoveAll(restoreDir)
+
+	if err := extractArchive(archive, restoreDir); err != nil {
+		return fmt.Errorf("invalid backup %s: %w", name, err)
+	}
+	if err := s.db.Replace(restoreDir); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	s.logger.Infof("Restored database from %s, the replaced database is kept at %s.bak", name, s.db.Path())
+
+	for _, reloader := range s.reloaders {
+		if err := reloader.Reload(); err != nil {
+			return fmt.Errorf("failed to reload after restoring %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// StartBackupSchedule backs up the database once a day at the configured local time until the scheduler is
+// stopped. Scheduled backups are off when no time is configured. Failed backups are posted to the notifier, which may
+// be nil.
+func (s *Service) StartBackupSchedule(sched *scheduler.Scheduler, notifier Notifier) {
+	if backupTime() == "" {
+		s.logger.Info("Scheduled backup is disabled")
+		return
+	}
+
+	sched.Every("backup", time.Minute, func() error { return s.runScheduledBackup(time.Now(), notifier) })
+}
+
+// runScheduledBackup backs up the database if the scheduled time of now's day has passed and it has not yet run
+// that day, posting a failure to the notifier. It returns scheduler.ErrNotDue when it did not run, or the error of the
+// backup.
+func (s *Service) runScheduledBackup(now time.Time, notifier Notifier) error {
+	day := now.Format("2006-01-02")
+	scheduled, err := time.ParseInLocation("2006-01-02 15:04", day+" "+backupTime(), now.Location())
+	if err != nil {
+		s.logger.Warnf("Invalid backup time %s, scheduled backup skipped", backupTime())
+		return scheduler.ErrNotDue
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Before(scheduled) || s.ranOn == day {
+		return scheduler.ErrNotDue
+	}
+	s.ranOn = day
+
+	_, err = s.backup(now)
+	if err != nil {
+		s.logger.Errorf("Scheduled backup failed: %v", err)
+		if notifier != nil {
+			if notifyErr := notifier.Notify("backup", fmt.Sprintf("Scheduled backup of %s failed: %v", day, err)); notifyErr != nil {
+				s.logger.Warnf("Failed to post backup notification: %v", notifyErr)
+			}
+		}
+	}
+	return err
+}
+
+func backupRetention() config.BackupRetentionConfig {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil {
+		return config.BackupRetentionConfig{}
+	}
+	return cfg.Backup.Retention
+}
+
+func backupTime() string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Backup.Time
+}
+
+// archiveTimestamp returns the time of the backup from its file name.
+func archiveTimestamp(name string) (time.Time, error) {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, archivePrefix), archiveSuffix)
+	return time.Parse(archiveTime, stamp)
+}
+
+func isArchiveName(name string) bool {
+	return strings.HasPrefix(name, archivePrefix) && strings.HasSuffix(name, archiveSuffix) &&
+		filepath.Base(name) == name
+}
+
+// writeArchive writes the files of dir as a gzipped tar.
+func writeArchive(w io.Writer, dir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// extractArchive extracts the files of a gzipped tar written by writeArchive into dir.
+func extractArchive(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg || filepath.Base(header.Name) != header.Name {
+			return fmt.Errorf("unexpected entry %s", header.Name)
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, header.Name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/backup"
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	config.SetConfig(&config.Config{})
+	defer config.SetConfig(nil)
+
+	dbPath := filepath.Join(t.TempDir(), "db")
+	db, err := dal.NewLevelDB(dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	blotterSvc := blotter.NewBlotter(db)
+	tradeDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	buy, err := blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "traderA", "dbs", "cdp", 30, 0, tradeDate)
+	require.NoError(t, err)
+	require.NoError(t, blotterSvc.AddTrade(*buy))
+
+	source, err := backup.NewLocalSource(filepath.Join(t.TempDir(), "backups"))
+	require.NoError(t, err)
+	svc := backup.NewService(db, source, blotterSvc)
+
+	name, err := svc.BackupNow()
+	require.NoError(t, err)
+
+	backups, err := svc.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{name}, backups)
+
+	// changes after the backup are undone by the restore
+	sell, err := blotter.NewTrade(blotter.TradeSideSell, 50, "D05.SI", "traderA", "dbs", "cdp", 32, 0, tradeDate)
+	require.NoError(t, err)
+	require.NoError(t, blotterSvc.AddTrade(*sell))
+	require.Len(t, blotterSvc.GetTrades(), 2)
+
+	// the newest backup is restored by default
+	restored, err := svc.Restore(backup.LatestBackup)
+	require.NoError(t, err)
+	assert.Equal(t, name, restored)
+
+	trades := blotterSvc.GetTrades()
+	require.Len(t, trades, 1)
+	assert.Equal(t, buy.TradeID, trades[0].TradeID)
+
+	// the replaced database is kept, and the restored database takes writes
+	_, err = os.Stat(dbPath + ".bak")
+	assert.NoError(t, err)
+	require.NoError(t, blotterSvc.AddTrade(*sell))
+	assert.Len(t, blotterSvc.GetTrades(), 2)
+}
+
+func TestRestoreRejectsInvalidBackups(t *testing.T) {
+	config.SetConfig(&config.Config{})
+	defer config.SetConfig(nil)
+
+	dbPath := filepath.Join(t.TempDir(), "db")
+	db, err := dal.NewLevelDB(dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Put("KEY", "value"))
+
+	backupDir := filepath.Join(t.TempDir(), "backups")
+	source, err := backup.NewLocalSource(backupDir)
+	require.NoError(t, err)
+	svc := backup.NewService(db, source)
+
+	_, err = svc.Restore("")
+	assert.ErrorContains(t, err, "no backups")
+	_, err = svc.Restore("../db")
+	assert.Error(t, err)
+	_, err = svc.Restore("portfolio-manager-missing.tar.gz")
+	assert.Error(t, err)
+
+	corrupt := "portfolio-manager-20240102T000000Z.tar.gz"
+	require.NoError(t, os.WriteFile(filepath.Join(backupDir, corrupt), []byte("not an archive"), 0o644))
+	_, err = svc.Restore(corrupt)
+	assert.Error(t, err)
+
+	// the database is untouched
+	var value string
+	require.NoError(t, db.Get("KEY", &value))
+	assert.Equal(t, "value", value)
+	_, err = os.Stat(dbPath + ".bak")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPruneKeepsNewestBackups(t *testing.T) {
+	config.SetConfig(&config.Config{Backup: config.BackupConfig{Retention: config.BackupRetentionConfig{Count: 3}}})
+	defer config.SetConfig(nil)
+
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	backupDir := t.TempDir()
+	source, err := backup.NewLocalSource(backupDir)
+	require.NoError(t, err)
+	svc := backup.NewService(db, source)
+
+	now := time.Date(2024, 1, 10, 1, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		name := "portfolio-manager-" + now.AddDate(0, 0, -i).Format("20060102T150405Z") + ".tar.gz"
+		require.NoError(t, os.WriteFile(filepath.Join(backupDir, name), []byte("archive"), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(backupDir, "notes.txt"), []byte("kept"), 0o644))
+
+	pruned, err := svc.Prune(now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"portfolio-manager-20240107T010000Z.tar.gz", "portfolio-manager-20240106T010000Z.tar.gz"}, pruned)
+
+	backups, err := svc.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"portfolio-manager-20240110T010000Z.tar.gz",
+		"portfolio-manager-20240109T010000Z.tar.gz",
+		"portfolio-manager-20240108T010000Z.tar.gz",
+	}, backups)
+	assert.FileExists(t, filepath.Join(backupDir, "notes.txt"))
+
+	// backups older than the max age are pruned even within the count
+	config.SetConfig(&config.Config{Backup: config.BackupConfig{Retention: config.BackupRetentionConfig{Count: 3, MaxAgeDays: 1}}})
+	pruned, err = svc.Prune(now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"portfolio-manager-20240108T010000Z.tar.gz"}, pruned)
+}
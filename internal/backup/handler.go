@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"portfolio-manager/pkg/types"
+)
+
+// RestoreRequest names the backup to restore.
+type RestoreRequest struct {
+	Filename string `json:"filename"` // Optional, the newest backup when empty or "latest"
+}
+
+// HandleBackupNow handles backing up the database.
+// @Summary Back up the database
+// @Description Upload an archive of a consistent snapshot of the database to the backup source. Admin only when authentication is enabled.
+// @Tags backup
+// @Produce json
+// @Success 201 {object} map[string]string
+// @Failure 403 {string} string "Admin only"
+// @Failure 500 {string} string "Failed to back up"
+// @Router /api/v1/backup/now [post]
+func HandleBackupNow(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, "ERROR: admin only", http.StatusForbidden)
+			return
+		}
+
+		name, err := svc.BackupNow()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"filename": name})
+	}
+}
+
+// HandleBackupList handles listing the backups.
+// @Summary List backups
+// @Description List the file names of the backups in the backup source, newest first. Admin only when authentication is enabled.
+// @Tags backup
+// @Produce json
+// @Success 200 {array} string
+// @Failure 403 {string} string "Admin only"
+// @Failure 500 {string} string "Failed to list backups"
+// @Router /api/v1/backup/list [get]
+func HandleBackupList(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, "ERROR: admin only", http.StatusForbidden)
+			return
+		}
+
+		backups, err := svc.List()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(backups)
+	}
+}
+
+// HandleRestore handles restoring the database from a backup.
+// @Summary Restore a backup
+// @Description Download and verify the backup, the newest when filename is empty or "latest", then swap it in place of the database and reload the blotter and portfolio. The replaced database is kept as <dbPath>.bak. Admin only when authentication is enabled.
+// @Tags backup
+// @Accept json
+// @Produce json
+// @Param request body RestoreRequest true "Restore request"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/backup/restore [post]
+func HandleRestore(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, "ERROR: admin only", http.StatusForbidden)
+			return
+		}
+
+		var request RestoreRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		name, err := svc.Restore(request.Filename)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"filename": name})
+	}
+}
+
+// isAdmin returns whether the request may manage backups, anyone may when authentication is disabled.
+func isAdmin(r *http.Request) bool {
+	user := types.UserFromContext(r.Context())
+	return user == nil || user.Admin
+}
+
+// RegisterHandlers registers the handlers for the backup service.
+func RegisterHandlers(mux *http.ServeMux, svc *Service) {
+	mux.HandleFunc("/api/v1/backup/now", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleBackupNow(svc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/backup/list", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleBackupList(svc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/backup/restore", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleRestore(svc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"portfolio-manager/internal/config"
+)
+
+// Source stores backup archives by file name.
+type Source interface {
+	Upload(name string, r io.Reader) error
+	Download(name string, w io.Writer) error
+	List() ([]string, error)
+	Delete(name string) error
+}
+
+// Backup sources
+const (
+	SourceLocal = "local"
+	SourceS3    = "s3"
+)
+
+// NewSource creates the backup source named in config.
+func NewSource(cfg config.BackupConfig) (Source, error) {
+	switch cfg.Source {
+	case "", SourceLocal:
+		if cfg.Local.Path == "" {
+			return nil, errors.New("local backup source requires a path")
+		}
+		return NewLocalSource(cfg.Local.Path)
+	case SourceS3:
+		return NewS3Source(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unsupported backup source: %s", cfg.Source)
+	}
+}
+
+// uploadTempPrefix prefixes the temporary files archives are written to before being renamed into place.
+const uploadTempPrefix = ".upload-"
+
+// LocalSource stores backup archives in a directory, e.g. a mounted network drive.
+type LocalSource struct {
+	dir string
+}
+
+// NewLocalSource creates a local backup source, creating the directory if needed.
+func NewLocalSource(dir string) (*LocalSource, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory %s: %w", dir, err)
+	}
+	return &LocalSource{dir: dir}, nil
+}
+
+// Upload writes the archive to a temporary file in the directory, which is synced to disk and then renamed into
+// place, so readers and a crash never see a partially written archive under its name.
+func (s *LocalSource) Upload(name string, r io.Reader) error {
+	tmp, err := os.CreateTemp(s.dir, uploadTempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+// Download reads the archive from the directory.
+func (s *LocalSource) Download(name string, w io.Writer) error {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
+
+// List returns the names of the files in the directory, excluding uploads in progress.
+func (s *LocalSource) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), uploadTempPrefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete removes the archive from the directory.
+func (s *LocalSource) Delete(name string) error {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
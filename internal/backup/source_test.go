@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowReader returns its first part, then blocks until released before returning the rest.
+type slowReader struct {
+	first, rest io.Reader
+	read        chan struct{}
+	release     chan struct{}
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if n, err := r.first.Read(p); err != io.EOF {
+		return n, err
+	}
+	if r.read != nil {
+		close(r.read)
+		r.read = nil
+		<-r.release
+	}
+	return r.rest.Read(p)
+}
+
+func TestLocalSourceHidesUploadsInProgress(t *testing.T) {
+	dir := t.TempDir()
+	source, err := NewLocalSource(dir)
+	require.NoError(t, err)
+
+	name := "portfolio-manager-20240102T000000Z.tar.gz"
+	reader := &slowReader{
+		first:   strings.NewReader("first half, "),
+		rest:    strings.NewReader("second half"),
+		read:    make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	read := reader.read
+	uploaded := make(chan error)
+	go func() { uploaded <- source.Upload(name, reader) }()
+
+	// midway through the upload the partial file is on disk, but neither listed nor readable under its name
+	<-read
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	names, err := source.List()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	assert.Error(t, source.Download(name, io.Discard))
+
+	close(reader.release)
+	require.NoError(t, <-uploaded)
+
+	names, err = source.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{name}, names)
+
+	var buf bytes.Buffer
+	require.NoError(t, source.Download(name, &buf))
+	assert.Equal(t, "first half, second half", buf.String())
+}
@@ -2,19 +2,26 @@ package blotter
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/config"
 	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/csvutil"
 	"portfolio-manager/pkg/event"
 	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/rdata"
 	"portfolio-manager/pkg/types"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"encoding/csv"
 	"os"
-	"strconv"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
@@ -31,8 +38,12 @@ type TradeBlotter struct {
 	trades         []Trade
 	tradesByID     map[string]*Trade
 	tradesByTicker map[string][]Trade
-	currentSeqNum  int // used as a pointer to the head of the blotter
+	tradesByTag    map[string]map[string]struct{} // trade IDs by lower case tag
+	currentSeqNum  int                            // used as a pointer to the head of the blotter
 	db             dal.Database
+	rdata          rdata.ReferenceManager // optional, used to validate trades against reference data
+	mdata          MarketDataGetter       // optional, used to price value-based trades and in the FX analysis
+	bulkListener   BulkWriteListener      // optional, notified around bulk imports
 	eventBus       *event.EventBus
 	mu             sync.Mutex
 }
@@ -40,7 +51,7 @@ type TradeBlotter struct {
 // NewBlotter creates a new TradeBlotter instance.
 func NewBlotter(db dal.Database) *TradeBlotter {
 	var currentSeqNum int
-	err := db.Get(string(types.HeadSequenceBlotterKey), currentSeqNum)
+	err := db.Get(string(types.HeadSequenceBlotterKey), &currentSeqNum)
 	if err != nil {
 		currentSeqNum = -1
 	}
@@ -49,6 +60,7 @@ func NewBlotter(db dal.Database) *TradeBlotter {
 		trades:         []Trade{},
 		tradesByID:     make(map[string]*Trade),
 		tradesByTicker: make(map[string][]Trade),
+		tradesByTag:    make(map[string]map[string]struct{}),
 		currentSeqNum:  currentSeqNum,
 		db:             db,
 		eventBus:       event.NewEventBus(),
@@ -56,30 +68,65 @@ func NewBlotter(db dal.Database) *TradeBlotter {
 }
 
 func (b *TradeBlotter) LoadFromDB() error {
-	tradeKeys, err := b.db.GetAllKeysWithPrefix(string(types.TradeKeyPrefix))
+	// Read trades in a single pass and decode them concurrently, results come back in key order
+	trades, err := dal.ParallelLoad[Trade](b.db, string(types.TradeKeyPrefix))
 	if err != nil {
 		return err
 	}
 
-	for _, key := range tradeKeys {
-		var trade Trade
-		err := b.db.Get(key, &trade)
-		if err != nil {
-			return err
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Pre-size the indexes of a fresh blotter to avoid rehashing while loading
+	if len(b.trades) == 0 {
+		tickerCounts := make(map[string]int)
+		for _, trade := range trades {
+			tickerCounts[trade.Ticker]++
 		}
-		err = b.AddTradePreloaded(trade)
-		if err != nil {
-			return err
+		b.trades = make([]Trade, 0, len(trades))
+		b.tradesByID = make(map[string]*Trade, len(trades))
+		b.tradesByTicker = make(map[string][]Trade, len(tickerCounts))
+		for ticker, count := range tickerCounts {
+			b.tradesByTicker[ticker] = make([]Trade, 0, count)
 		}
 	}
 
+	// Insert in key order, the same order the serial loader used
+	for i := range trades {
+		trade := trades[i]
+		b.trades = append(b.trades, trade)
+		b.tradesByID[trade.TradeID] = &trade
+		b.tradesByTicker[trade.Ticker] = append(b.tradesByTicker[trade.Ticker], trade)
+		b.indexTags(trade)
+	}
+
 	b.sortTrades()
+	b.repairHeadSequence()
 
-	logging.GetLogger().Infof("Loaded %d trades from database", len(tradeKeys))
+	logging.GetLogger().Infof("Loaded %d trades from database", len(trades))
 
 	return nil
 }
 
+// Reload discards the trades held in memory and loads them again from the database, e.g. after a restore.
+func (b *TradeBlotter) Reload() error {
+	var currentSeqNum int
+	err := b.db.Get(string(types.HeadSequenceBlotterKey), &currentSeqNum)
+	if err != nil {
+		currentSeqNum = -1
+	}
+
+	b.mu.Lock()
+	b.trades = []Trade{}
+	b.tradesByID = make(map[string]*Trade)
+	b.tradesByTicker = make(map[string][]Trade)
+	b.tradesByTag = make(map[string]map[string]struct{})
+	b.currentSeqNum = currentSeqNum
+	b.mu.Unlock()
+
+	return b.LoadFromDB()
+}
+
 // SortTrades sorts the trades and tradesByTicker by TradeDate.
 func (b *TradeBlotter) sortTrades() {
 	logging.GetLogger().Info("Sorting trades (ascending) within the blotter")
@@ -99,15 +146,22 @@ func (b *TradeBlotter) sortTrades() {
 
 // AddTrade adds a new trade to the blotter and writes it to the database.
 func (b *TradeBlotter) AddTrade(trade Trade) error {
-	return b.addTrade(trade, false)
+	return b.AddTradeWithContext(context.Background(), trade)
+}
+
+// AddTradeWithContext adds a new trade to the blotter and writes it to the database. The context, e.g. of the
+// request adding the trade, is passed on with the new trade event so that the updates it triggers log with it.
+func (b *TradeBlotter) AddTradeWithContext(ctx context.Context, trade Trade) error {
+	return b.addTrade(ctx, trade, false, audit.SourceAPI)
 }
 
 // AddTrade adds trade from database to the blotter
 func (b *TradeBlotter) AddTradePreloaded(trade Trade) error {
-	return b.addTrade(trade, true)
+	return b.addTrade(context.Background(), trade, true, "")
 }
 
-func (b *TradeBlotter) addTrade(trade Trade, isPreLoadFromDB bool) error {
+// addTrade adds the trade to the blotter, attributing the database write to the source in the audit log.
+func (b *TradeBlotter) addTrade(ctx context.Context, trade Trade, isPreLoadFromDB bool, source string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -116,7 +170,7 @@ func (b *TradeBlotter) addTrade(trade Trade, isPreLoadFromDB bool) error {
 
 		// Write trade to the database
 		tradeKey := generateTradeKey(trade)
-		err := b.db.Put(tradeKey, trade)
+		err := audit.WithSource(b.db, source).Put(tradeKey, trade)
 		if err != nil {
 			return err
 		}
@@ -132,16 +186,18 @@ func (b *TradeBlotter) addTrade(trade Trade, isPreLoadFromDB bool) error {
 	b.trades = append(b.trades, trade)
 	b.tradesByID[trade.TradeID] = &trade
 	b.tradesByTicker[trade.Ticker] = append(b.tradesByTicker[trade.Ticker], trade)
+	b.indexTags(trade)
 
 	// Publish a new trade event
 	if !isPreLoadFromDB {
-		b.PublishNewTradeEvent(trade)
+		b.PublishNewTradeEvent(ctx, trade)
 	}
 
 	return nil
 }
 
-// RemoveTrade removes a trade from the blotter and deletes it from the database.
+// RemoveTrade removes a trade from the blotter, moving it to the recycle bin from which it can be restored until
+// purged, see RestoreTrades.
 func (b *TradeBlotter) RemoveTrade(tradeID string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -163,16 +219,22 @@ func (b *TradeBlotter) RemoveTrade(tradeID string) error {
 	// Remove trade from the indexes
 	delete(b.tradesByID, tradeID)
 	b.tradesByTicker[trade.Ticker] = removeTradeFromSlice(b.tradesByTicker[trade.Ticker], tradeID)
+	b.unindexTags(*trade)
 
-	// Remove trade from the database
-	tradeKey := generateTradeKey(*trade)
-	err := b.db.Delete(tradeKey)
-	if err != nil {
+	// Move trade to the recycle bin in the database
+	batch := b.db.Batch()
+	if err := batch.Delete(generateTradeKey(*trade)); err != nil {
+		return err
+	}
+	if err := batch.Put(trashKey(tradeID), TrashedTrade{Trade: *trade, DeletedAt: time.Now().Format(time.RFC3339)}); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
 		logging.GetLogger().Error("Failed to delete trade from database", err)
 		return err
 	}
 
-	b.PublishRemoveTradeEvent(*trade)
+	b.PublishRemoveTradeEvent(context.Background(), *trade)
 
 	return nil
 }
@@ -216,6 +278,9 @@ func (b *TradeBlotter) GetTradeByID(tradeID string) (*Trade, error) {
 
 // GetTradesByTicker returns all trades for the given ticker.
 func (b *TradeBlotter) GetTradesByTicker(ticker string) ([]Trade, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	trades, exists := b.tradesByTicker[ticker]
 	if !exists {
 		return nil, errors.New("no trades found for the given ticker")
@@ -223,6 +288,57 @@ func (b *TradeBlotter) GetTradesByTicker(ticker string) ([]Trade, error) {
 	return trades, nil
 }
 
+// SetReferenceManager sets the reference data manager used to validate trades, e.g. board lot sizes.
+func (b *TradeBlotter) SetReferenceManager(rdata rdata.ReferenceManager) {
+	b.rdata = rdata
+}
+
+// SetBulkWriteListener sets the listener notified around bulk imports, e.g. to coalesce the resulting position writes.
+func (b *TradeBlotter) SetBulkWriteListener(listener BulkWriteListener) {
+	b.bulkListener = listener
+}
+
+// SetMarketData sets the market data used to price value-based trades and as the market rate in the FX analysis.
+func (b *TradeBlotter) SetMarketData(mdata MarketDataGetter) {
+	b.mdata = mdata
+}
+
+// CheckLotSize validates that the trade quantity is a multiple of the ticker's board lot size.
+// In warn mode, or when allowOddLot is set for genuine odd-lot trades, violations are only logged.
+func (b *TradeBlotter) CheckLotSize(trade Trade, allowOddLot bool) error {
+	if b.rdata == nil {
+		return nil
+	}
+
+	tickerRef, err := b.rdata.GetTicker(trade.Ticker)
+	if err != nil {
+		// unknown tickers cannot be validated against their lot size
+		return nil
+	}
+
+	lotSize := tickerRef.GetLotSize()
+	if lots := trade.Quantity / lotSize; math.Abs(lots-math.Round(lots)) < 1e-9 {
+		return nil
+	}
+
+	err = fmt.Errorf("quantity %v of %s is not a multiple of the board lot size %v", trade.Quantity, trade.Ticker, lotSize)
+	if allowOddLot || lotSizeCheckMode() != config.LotSizeCheckBlock {
+		logging.GetLogger().Warn(err)
+		return nil
+	}
+
+	return err
+}
+
+// lotSizeCheckMode returns the configured lot size check mode, defaulting to warn.
+func lotSizeCheckMode() string {
+	cfg, err := config.GetOrCreateConfig("")
+	if err != nil || cfg == nil {
+		return config.LotSizeCheckWarn
+	}
+	return cfg.LotSizeCheck
+}
+
 // GetCurrentSeqNum returns the current sequence number.
 func (b *TradeBlotter) GetCurrentSeqNum() int {
 	return b.currentSeqNum
@@ -267,19 +383,55 @@ func (b *TradeBlotter) saveSeqNumToDAL(seqNum int) {
 	b.db.Put(string(types.HeadSequenceBlotterKey), seqNum)
 }
 
+// repairHeadSequence moves the head sequence number up to the highest sequence number of the loaded trades, which a
+// restore of an older head can leave behind, so that new trades do not reuse sequence numbers. The caller must hold
+// the lock.
+func (b *TradeBlotter) repairHeadSequence() {
+	maxSeqNum := -1
+	for _, trade := range b.trades {
+		maxSeqNum = max(maxSeqNum, trade.SeqNum)
+	}
+
+	if maxSeqNum > b.currentSeqNum {
+		logging.GetLogger().Warnf("Blotter head sequence number %d is behind trade sequence number %d, repairing", b.currentSeqNum, maxSeqNum)
+		b.currentSeqNum = maxSeqNum
+		b.saveSeqNumToDAL(maxSeqNum)
+	}
+}
+
 // Trade represents a trade in the blotter.
 type Trade struct {
-	TradeID   string  `json:"TradeID"`                       // Unique identifier for the trade
-	TradeDate string  `json:"TradeDate" validate:"required"` // Date and time of the trade
-	Ticker    string  `json:"Ticker" validate:"required"`    // Ticker symbol of the asset
-	Side      string  `json:"Side" validate:"required"`      // Buy or Sell
-	Quantity  float64 `json:"Quantity" validate:"required"`  // Quantity of the asset
-	Price     float64 `json:"Price" validate:"required"`     // Price per unit of the asset
-	Yield     float64 `json:"Yield"`                         // Yield of the asset
-	Trader    string  `json:"Trader" validate:"required"`    // Trader who executed the trade
-	Broker    string  `json:"Broker" validate:"required"`    // Broker who executed the trade
-	Account   string  `json:"Account" validate:"required"`   // Account associated with the trade (CDP, MIP, Custodian)
-	SeqNum    int     `json:"SeqNum"`                        // Sequence number
+	TradeID     string   `json:"TradeID"`                       // Unique identifier for the trade
+	TradeDate   string   `json:"TradeDate" validate:"required"` // Date and time of the trade
+	Ticker      string   `json:"Ticker" validate:"required"`    // Ticker symbol of the asset
+	Side        string   `json:"Side" validate:"required"`      // Buy or Sell
+	Quantity    float64  `json:"Quantity" validate:"required"`  // Quantity of the asset
+	Price       float64  `json:"Price" validate:"gte=0"`        // Price per unit of the asset, 0 for options expiring worthless
+	Yield       float64  `json:"Yield"`                         // Yield of the asset
+	Trader      string   `json:"Trader" validate:"required"`    // Trader who executed the trade
+	Broker      string   `json:"Broker" validate:"required"`    // Broker who executed the trade
+	Account     string   `json:"Account" validate:"required"`   // Account associated with the trade (CDP, MIP, Custodian)
+	Fx          float64  `json:"Fx"`                            // FX rate of the trade currency to the base currency, 0 if unknown
+	Fee         float64  `json:"Fee" validate:"gte=0"`          // Fees and commissions paid on the trade, in FeeCcy
+	FeeCcy      string   `json:"FeeCcy"`                        // Currency of the fee, the trade currency when empty
+	OrderID     string   `json:"OrderID"`                       // Optional order the trade was filled against, shared by partial fills
+	Notional    float64  `json:"Notional"`                      // Requested notional of value-based trades, kept for audit
+	Status      string   `json:"Status"`                        // Trade status, closed for sells generated by closing a position
+	OrigTradeID string   `json:"OrigTradeID"`                   // Buy trade offset by a closing sell
+	GrantID     string   `json:"GrantID"`                       // Employee stock plan grant of a vest
+	CreatedBy   string   `json:"CreatedBy"`                     // User who added the trade, for audit
+	Tags        []string `json:"Tags,omitempty"`                // Labels of the trade, e.g. DCA, matched case-insensitively
+	Notes       string   `json:"Notes,omitempty"`               // Free-text rationale of the trade
+	SeqNum      int      `json:"SeqNum"`                        // Sequence number
+}
+
+// FeeInTradeCcy returns the fee in the trade currency. Fees in the base currency are converted at the trade's Fx, or
+// taken as is when Fx is unknown. Fees in any other currency are taken to be in the trade currency.
+func (t Trade) FeeInTradeCcy() float64 {
+	if t.Fee == 0 || t.FeeCcy == "" || t.Fx <= 0 || !strings.EqualFold(t.FeeCcy, BaseCurrency()) {
+		return t.Fee
+	}
+	return t.Fee / t.Fx
 }
 
 // NewTrade creates a new Trade instance.
@@ -317,8 +469,16 @@ func validateTrade(trade Trade) error {
 	return validate.Struct(trade)
 }
 
+// csvHeaders are the columns of the trades CSV, csvFeeHeaders and csvNoteHeaders are optional on import for files
+// exported before fees and tags were recorded. Tags are pipe-delimited in a single column.
+var (
+	csvHeaders     = []string{"TradeDate", "Ticker", "Side", "Quantity", "Price", "Yield", "Trader", "Broker", "Account"}
+	csvFeeHeaders  = []string{"Fee", "FeeCcy"}
+	csvNoteHeaders = []string{"Tags", "Notes"}
+)
+
 // ImportFromCSV imports trades from a CSV file and adds them to the blotter.
-// Expected CSV format: TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker
+// Expected CSV format: TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account[,Fee,FeeCcy[,Tags,Notes]]
 func (b *TradeBlotter) ImportFromCSVFile(filepath string) error {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -331,58 +491,112 @@ func (b *TradeBlotter) ImportFromCSVFile(filepath string) error {
 }
 
 func (b *TradeBlotter) ImportFromCSVReader(reader *csv.Reader) error {
-	logging.GetLogger().Info("Importing trades from CSV")
+	return b.ImportFromCSVReaderWithFormat(reader, csvutil.DefaultFormat, nil)
+}
+
+// ImportFromCSVReaderWithFormat imports trades from a CSV reader, parsing dates and numbers with the given format options.
+// The reader is expected to already be configured with the matching delimiter, see csvutil.FormatOptions.NewReader.
+// The trades are recorded as created by the user, nil when authentication is disabled.
+func (b *TradeBlotter) ImportFromCSVReaderWithFormat(reader *csv.Reader, format csvutil.FormatOptions, user *types.User) error {
+	_, err := b.ImportCSV(reader, ImportOptions{Format: format}, user)
+	return err
+}
+
+// ImportCSV imports trades from a CSV reader with the import options, see ImportFromCSVReaderWithFormat, reporting the
+// trades imported and the duplicates skipped.
+func (b *TradeBlotter) ImportCSV(reader *csv.Reader, opts ImportOptions, user *types.User) (ImportResult, error) {
+	duplicates, err := ParseDuplicatePolicy(opts.Duplicates)
+	if err != nil {
+		return ImportResult{}, err
+	}
 
-	// Read and validate header
+	var rows [][]string
+	format := opts.Format
+	if opts.Profile != nil {
+		logging.GetLogger().Infof("Importing trades from CSV with import profile %s", opts.Profile.Name)
+		rows, err = readProfileRows(reader, *opts.Profile)
+		if opts.Profile.DateFormat != "" {
+			format.DateFormat = csvutil.ToGoLayout(opts.Profile.DateFormat)
+		}
+	} else {
+		logging.GetLogger().Info("Importing trades from CSV")
+		rows, err = readTradeRows(reader)
+	}
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	return b.importRows(rows, format, duplicates, user)
+}
+
+// readTradeRows reads the rows of a trades CSV after validating its header.
+func readTradeRows(reader *csv.Reader) ([][]string, error) {
 	header, err := reader.Read()
 	if err != nil {
-		return fmt.Errorf("error reading CSV header: %w", err)
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
 	}
 
-	expectedHeaders := []string{"TradeDate", "Ticker", "Side", "Quantity", "Price", "Yield", "Trader", "Broker", "Account"}
+	allHeaders := slices.Concat(csvHeaders, csvFeeHeaders, csvNoteHeaders)
+	expectedHeaders := csvHeaders
+	switch len(header) {
+	case len(csvHeaders) + len(csvFeeHeaders), len(allHeaders):
+		expectedHeaders = allHeaders[:len(header)]
+	}
 	if len(header) != len(expectedHeaders) {
-		return fmt.Errorf("invalid CSV format: expected %d columns, got %d", len(expectedHeaders), len(header))
+		return nil, fmt.Errorf("invalid CSV format: expected %d, %d or %d columns, got %d", len(csvHeaders),
+			len(csvHeaders)+len(csvFeeHeaders), len(allHeaders), len(header))
 	}
 
 	for i, h := range expectedHeaders {
 		if header[i] != h {
-			return fmt.Errorf("invalid CSV header: expected %s at position %d, got %s", h, i, header[i])
+			return nil, fmt.Errorf("invalid CSV header: expected %s at position %d, got %s", h, i, header[i])
 		}
 	}
 
-	// Read all rows and create trades
-	var trades []*Trade
-	lineNum := 1
+	var rows [][]string
 	for {
 		row, err := reader.Read()
 		if err != nil {
 			if err.Error() == "EOF" {
 				break
 			}
-			return fmt.Errorf("error reading CSV line %d: %w", lineNum, err)
+			return nil, fmt.Errorf("error reading CSV line %d: %w", len(rows)+1, err)
 		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
 
-		quantity, err := strconv.ParseFloat(row[3], 64)
+// importRows creates trades from the rows of a trades CSV, without the header, and adds them to the blotter, handling
+// trades duplicating those in the blotter with the duplicate policy. Nothing is added when any row is invalid.
+func (b *TradeBlotter) importRows(rows [][]string, format csvutil.FormatOptions, duplicates string, user *types.User) (ImportResult, error) {
+	// Create trades from all rows, unknown tickers are reported for all rows at once
+	var trades []*Trade
+	var unknownTickers []error
+	for i, row := range rows {
+		lineNum := i + 1
+		quantity, err := format.ParseFloat(row[3])
 		if err != nil {
-			return fmt.Errorf("invalid quantity at line %d: %w", lineNum, err)
+			return ImportResult{}, fmt.Errorf("invalid quantity at line %d: %w", lineNum, err)
 		}
 
-		price, err := strconv.ParseFloat(row[4], 64)
+		price, err := format.ParseFloat(row[4])
 		if err != nil {
-			return fmt.Errorf("invalid price at line %d: %w", lineNum, err)
+			return ImportResult{}, fmt.Errorf("invalid price at line %d: %w", lineNum, err)
 		}
 
 		var yield float64
 		if row[5] != "" {
-			yield, err = strconv.ParseFloat(row[5], 64)
+			yield, err = format.ParseFloat(row[5])
 			if err != nil {
-				return fmt.Errorf("invalid yield at line %d: %w", lineNum, err)
+				return ImportResult{}, fmt.Errorf("invalid yield at line %d: %w", lineNum, err)
 			}
 		}
 
-		tradeDate, err := time.Parse(time.RFC3339, row[0])
+		tradeDate, err := format.ParseDate(row[0])
 		if err != nil {
-			return fmt.Errorf("invalid trade date at line %d: %w", lineNum, err)
+			return ImportResult{}, fmt.Errorf("invalid trade date at line %d: %w", lineNum, err)
 		}
 
 		trade, err := NewTrade(
@@ -397,50 +611,202 @@ func (b *TradeBlotter) ImportFromCSVReader(reader *csv.Reader) error {
 			tradeDate,
 		)
 		if err != nil {
-			return fmt.Errorf("error creating trade at line %d: %w", lineNum, err)
+			return ImportResult{}, fmt.Errorf("error creating trade at line %d: %w", lineNum, err)
+		}
+
+		if len(row) > len(csvHeaders) && row[9] != "" {
+			trade.Fee, err = format.ParseFloat(row[9])
+			if err != nil || trade.Fee < 0 {
+				return ImportResult{}, fmt.Errorf("invalid fee at line %d, must be a non-negative number", lineNum)
+			}
+			trade.FeeCcy = strings.ToUpper(row[10])
+		}
+
+		if len(row) > len(csvHeaders)+len(csvFeeHeaders) {
+			trade.Tags = NormalizeTags(strings.Split(row[11], tagsCsvSeparator))
+			trade.Notes = row[12]
+		}
+
+		if err := b.CheckTicker(trade.Ticker); err != nil {
+			unknownTickers = append(unknownTickers, fmt.Errorf("line %d: %w", lineNum, err))
+		}
+
+		if err := b.CheckLotSize(*trade, false); err != nil {
+			return ImportResult{}, fmt.Errorf("invalid quantity at line %d: %w", lineNum, err)
 		}
 
 		trades = append(trades, trade)
-		lineNum++
+	}
+
+	if len(unknownTickers) > 0 {
+		return ImportResult{}, fmt.Errorf("invalid tickers: %w", errors.Join(unknownTickers...))
+	}
+
+	trades, result, err := b.handleDuplicates(trades, duplicates)
+	if err != nil {
+		return result, err
 	}
 
 	// Add all trades after validation
+	if err := b.addTrades(trades, user); err != nil {
+		return ImportResult{}, err
+	}
+	result.Imported = len(trades)
+	return result, nil
+}
+
+// addTrades adds the trades of a bulk import, notifying the bulk write listener around them.
+func (b *TradeBlotter) addTrades(trades []*Trade, user *types.User) error {
+	if err := AuthorizeTrades(trades, user); err != nil {
+		return err
+	}
+
+	if b.bulkListener != nil {
+		b.bulkListener.BeginBulkWrites()
+		defer b.bulkListener.EndBulkWrites()
+	}
+
+	if err := b.writeTrades(trades, audit.SourceCSV); err != nil {
+		return fmt.Errorf("error adding trades: %w", err)
+	}
+
+	b.sortTrades()
+
+	return nil
+}
+
+// writeTrades writes the trades and the head sequence number in a single batch, attributing the writes to the source
+// in the audit log. Either all trades are added, or none when the batch fails.
+func (b *TradeBlotter) writeTrades(trades []*Trade, source string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch := audit.WithSource(b.db, source).Batch()
+	seqNum := b.currentSeqNum
+	added := make([]Trade, 0, len(trades))
 	for _, trade := range trades {
-		if err := b.AddTrade(*trade); err != nil {
-			return fmt.Errorf("error adding trades: %w", err)
+		if _, exists := b.tradesByID[trade.TradeID]; exists {
+			return fmt.Errorf("trade %s already exists. call RemoveTrade instead", trade.TradeID)
+		}
+
+		seqNum++
+		added = append(added, *trade)
+		added[len(added)-1].SeqNum = seqNum
+		if err := batch.Put(generateTradeKey(added[len(added)-1]), added[len(added)-1]); err != nil {
+			return err
 		}
 	}
+	if err := batch.Put(string(types.HeadSequenceBlotterKey), seqNum); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	b.currentSeqNum = seqNum
+
+	for i := range added {
+		trade := added[i]
+		b.trades = append(b.trades, trade)
+		b.tradesByID[trade.TradeID] = &trade
+		b.tradesByTicker[trade.Ticker] = append(b.tradesByTicker[trade.Ticker], trade)
+		b.indexTags(trade)
+		b.PublishNewTradeEvent(context.Background(), trade)
+	}
 
-	b.sortTrades()
+	return nil
+}
+
+// UpdateTrade replaces the trade in the blotter sharing its TradeID, e.g. to correct its Fx, see updateTrades.
+func (b *TradeBlotter) UpdateTrade(trade Trade) error {
+	return b.updateTrades([]Trade{trade}, audit.SourceAPI)
+}
+
+// updateTrades replaces the trades in the blotter sharing their TradeIDs in a single batch, attributing the writes to
+// the source in the audit log. Either all trades are updated, or none when the batch fails. Positions are not
+// recomputed, so the fields they derive from must not change, and neither may the sequence number of a trade.
+func (b *TradeBlotter) updateTrades(trades []Trade, source string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch := audit.WithSource(b.db, source).Batch()
+	for _, trade := range trades {
+		existing, exists := b.tradesByID[trade.TradeID]
+		if !exists {
+			return fmt.Errorf("trade %s not found", trade.TradeID)
+		}
+		if trade.Ticker != existing.Ticker || trade.Trader != existing.Trader || trade.Side != existing.Side ||
+			trade.Quantity != existing.Quantity || trade.Price != existing.Price || trade.TradeDate != existing.TradeDate {
+			return fmt.Errorf("trade %s: ticker, book, side, quantity, price and trade date cannot be updated, remove and re-add the trade instead", trade.TradeID)
+		}
+
+		trade.SeqNum = existing.SeqNum
+		if err := batch.Put(generateTradeKey(trade), trade); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	updated := make(map[string]Trade, len(trades))
+	for _, trade := range trades {
+		trade.SeqNum = b.tradesByID[trade.TradeID].SeqNum
+		updated[trade.TradeID] = trade
+	}
+	for i := range b.trades {
+		if trade, ok := updated[b.trades[i].TradeID]; ok {
+			b.trades[i] = trade
+		}
+	}
+	b.rebuildIndexes()
 
 	return nil
 }
 
 // ExportToCSVBytes exports all trades to a CSV file in memory and returns it as a byte slice.
 func (b *TradeBlotter) ExportToCSVBytes() ([]byte, error) {
+	return b.ExportToCSVBytesWithFormat(csvutil.DefaultFormat)
+}
+
+// ExportToCSVBytesWithFormat exports all trades to a CSV file in memory, formatting dates and numbers with the given format options.
+func (b *TradeBlotter) ExportToCSVBytesWithFormat(format csvutil.FormatOptions) ([]byte, error) {
 	logging.GetLogger().Info("Exporting trades to CSV in memory")
+	return exportTradesToCSVBytes(b.trades, format)
+}
+
+// exportTradesToCSVBytes writes the trades to a CSV file in memory.
+func exportTradesToCSVBytes(trades []Trade, format csvutil.FormatOptions) ([]byte, error) {
 
 	var buf bytes.Buffer
-	writer := csv.NewWriter(&buf)
+	writer := format.NewWriter(&buf)
 
 	// Write header
-	err := writer.Write([]string{"TradeDate", "Ticker", "Side", "Quantity", "Price", "Yield", "Trader", "Broker", "Account"})
+	err := writer.Write(slices.Concat(csvHeaders, csvFeeHeaders, csvNoteHeaders))
 	if err != nil {
 		return nil, fmt.Errorf("error writing CSV header: %w", err)
 	}
 
 	// Write trades
-	for _, trade := range b.trades {
+	for _, trade := range trades {
+		tradeDate, err := format.FormatDate(trade.TradeDate)
+		if err != nil {
+			return nil, fmt.Errorf("error formatting trade date: %w", err)
+		}
+
 		err = writer.Write([]string{
-			trade.TradeDate,
+			tradeDate,
 			trade.Ticker,
 			trade.Side,
-			strconv.FormatFloat(trade.Quantity, 'f', -1, 64),
-			strconv.FormatFloat(trade.Price, 'f', -1, 64),
-			strconv.FormatFloat(trade.Yield, 'f', -1, 64),
+			format.FormatFloat(trade.Quantity),
+			format.FormatFloat(trade.Price),
+			format.FormatFloat(trade.Yield),
 			trade.Trader,
 			trade.Broker,
 			trade.Account,
+			format.FormatFloat(trade.Fee),
+			trade.FeeCcy,
+			strings.Join(trade.Tags, tagsCsvSeparator),
+			trade.Notes,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("error writing trade to CSV: %w", err)
@@ -1,22 +1,36 @@
 package blotter_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"portfolio-manager/internal/audit"
 	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
 	"portfolio-manager/internal/dal"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/csvutil"
 	"portfolio-manager/pkg/event"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func setupTempDB(t *testing.T) (dal.Database, string) {
 	dbPath := filepath.Join(os.TempDir(), "testdb_"+t.Name())
-	db, err := dal.NewLevelDB(dbPath)
+	db, err := dal.Open(dal.TestDbType(), dbPath)
 	if err != nil {
 		t.Fatalf("Failed to create temp database: %v", err)
 	}
@@ -104,6 +118,124 @@ func TestRemoveTrade(t *testing.T) {
 	assert.Equal(t, 0, len(trades))
 }
 
+func TestRecycleBin(t *testing.T) {
+	config.SetConfig(&config.Config{TrashRetentionDays: 7})
+	defer config.SetConfig(nil)
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	first, _ := createTestTrade()
+	second, _ := blotter.NewTrade("buy", 10, "ES3.SI", "traderB", "dbs", "cdp", 3.4, 0.0, time.Now())
+	assert.NoError(t, blotterSvc.AddTrade(*first))
+	assert.NoError(t, blotterSvc.AddTrade(*second))
+	removed, _ := blotterSvc.GetTradeByID(first.TradeID)
+	seqNum := removed.SeqNum
+
+	assert.NoError(t, blotterSvc.RemoveTrade(first.TradeID))
+	assert.NoError(t, blotterSvc.RemoveTrade(second.TradeID))
+	trash, err := blotterSvc.GetTrash()
+	assert.NoError(t, err)
+	assert.Len(t, trash, 2)
+
+	// nothing is restored when any trade is missing from the recycle bin, or in a book the user may not trade in
+	_, err = blotterSvc.RestoreTrades([]string{first.TradeID, "unknown"}, nil)
+	assert.ErrorContains(t, err, "not found in the recycle bin")
+	_, err = blotterSvc.RestoreTrades([]string{first.TradeID}, &types.User{Name: "bob", Books: []string{"traderB"}})
+	assert.ErrorIs(t, err, blotter.ErrBookNotAllowed)
+	assert.Empty(t, blotterSvc.GetTrades())
+
+	restored, err := blotterSvc.RestoreTrades([]string{first.TradeID}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, restored, 1)
+	trade, err := blotterSvc.GetTradeByID(first.TradeID)
+	assert.NoError(t, err)
+	assert.Equal(t, seqNum, trade.SeqNum)
+
+	// restored trades are written back to the database
+	reloaded := blotter.NewBlotter(db)
+	assert.NoError(t, reloaded.LoadFromDB())
+	assert.Len(t, reloaded.GetTrades(), 1)
+
+	// trades removed beyond the retention are purged
+	purged, err := blotterSvc.PurgeTrash(time.Now().AddDate(0, 0, 6))
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = blotterSvc.PurgeTrash(time.Now().AddDate(0, 0, 8))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	trash, err = blotterSvc.GetTrash()
+	assert.NoError(t, err)
+	assert.Empty(t, trash)
+}
+
+func TestTradeHandlersScopedToUser(t *testing.T) {
+	config.SetConfig(&config.Config{TrashRetentionDays: 7})
+	defer config.SetConfig(nil)
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	for _, trader := range []string{"alice", "bob", "bob"} {
+		trade, _ := blotter.NewTrade("buy", 10, "ES3.SI", trader, "dbs", "cdp", 3.4, 0.0, time.Now())
+		assert.NoError(t, blotterSvc.AddTrade(*trade))
+	}
+	removed, _ := blotter.NewTrade("buy", 10, "D05.SI", "bob", "dbs", "cdp", 30.0, 0.0, time.Now())
+	assert.NoError(t, blotterSvc.AddTrade(*removed))
+	assert.NoError(t, blotterSvc.RemoveTrade(removed.TradeID))
+
+	alice := &types.User{Name: "alice", Books: []string{"alice"}}
+	serve := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), types.UserKey, alice))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+
+	var trades []blotter.Trade
+	assert.NoError(t, json.NewDecoder(serve(blotter.HandleTradeGet(blotterSvc), "/api/v1/blotter/trade").Body).Decode(&trades))
+	assert.Len(t, trades, 1)
+	assert.Equal(t, "alice", trades[0].Trader)
+
+	var trash []blotter.TrashedTrade
+	assert.NoError(t, json.NewDecoder(serve(blotter.HandleTrashGet(blotterSvc), "/api/v1/blotter/trash").Body).Decode(&trash))
+	assert.Empty(t, trash)
+
+	records, err := csv.NewReader(serve(blotter.HandleTradeExportCSV(blotterSvc), "/api/v1/blotter/export").Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2) // header and alice's trade
+}
+
+func TestAuthorizeBooks(t *testing.T) {
+	authorize := func(user *types.User, books []string) ([]string, int) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/reports/tax", nil)
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), types.UserKey, user))
+		}
+		rr := httptest.NewRecorder()
+		books, _ = blotter.AuthorizeBooks(rr, req, books)
+		return books, rr.Code
+	}
+
+	books, status := authorize(nil, nil)
+	assert.Nil(t, books)
+	assert.Equal(t, http.StatusOK, status)
+
+	// non-admin users default to their books and may only see those
+	alice := &types.User{Name: "alice", Books: []string{"alice", "joint"}}
+	books, _ = authorize(alice, nil)
+	assert.Equal(t, []string{"alice", "joint"}, books)
+	_, status = authorize(alice, []string{"alice", "bob"})
+	assert.Equal(t, http.StatusForbidden, status)
+	_, status = authorize(&types.User{Name: "carol"}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	books, _ = authorize(&types.User{Name: "admin", Admin: true}, []string{"bob"})
+	assert.Equal(t, []string{"bob"}, books)
+}
+
 func TestCreateTradeWithInvalidSide(t *testing.T) {
 	trade, err := blotter.NewTrade("buysell", 100, "AAPL", "traderA", "dbs", "cdp", 150.0, 0.0, time.Now())
 	assert.Error(t, err)
@@ -158,6 +290,31 @@ func TestEventPublishingOnAddTrade(t *testing.T) {
 	assert.True(t, eventPublished, "Expected event to be published when trade is added")
 }
 
+func TestEventCarriesContextOfAddTrade(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	trade, err := createTestTrade()
+	assert.NoError(t, err)
+
+	received := make(chan context.Context, 1)
+	blotterSvc.Subscribe(blotter.NewTradeEvent, event.NewEventHandler(func(handler event.Event) {
+		received <- handler.Ctx
+	}))
+
+	logger := logging.GetLogger().WithRequestID("req-1")
+	ctx := context.WithValue(context.Background(), types.LoggerKey, logger)
+	assert.NoError(t, blotterSvc.AddTradeWithContext(ctx, *trade))
+
+	select {
+	case eventCtx := <-received:
+		assert.Equal(t, "req-1", logging.FromContext(eventCtx).RequestID())
+	case <-time.After(time.Second):
+		t.Fatal("Expected event to be published when trade is added")
+	}
+}
+
 func TestEventPublishingOnRemoveTrade(t *testing.T) {
 	db, dbPath := setupTempDB(t)
 	defer cleanupTempDB(t, db, dbPath)
@@ -271,3 +428,836 @@ func TestImportFromCSVFile(t *testing.T) {
 	trades := blotterSvc.GetTrades()
 	assert.Equal(t, len(expectedTrades), len(trades))
 }
+
+func BenchmarkLoadFromDB(b *testing.B) {
+	dbPath := filepath.Join(os.TempDir(), "testdb_"+b.Name())
+	db, err := dal.NewLevelDB(dbPath)
+	if err != nil {
+		b.Fatalf("Failed to create temp database: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Generate trades across a handful of tickers
+	tickers := []string{"AAPL", "GOOG", "MSFT", "ES3", "D05"}
+	seed := blotter.NewBlotter(db)
+	tradeDate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 30000; i++ {
+		trade, err := blotter.NewTrade(blotter.TradeSideBuy, 100, tickers[i%len(tickers)], "traderA", "dbs", "cdp", 150.0, 0.0, tradeDate.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			b.Fatalf("Failed to create trade: %v", err)
+		}
+		if err := seed.AddTrade(*trade); err != nil {
+			b.Fatalf("Failed to add trade: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		blotterSvc := blotter.NewBlotter(db)
+		if err := blotterSvc.LoadFromDB(); err != nil {
+			b.Fatalf("Failed to load trades: %v", err)
+		}
+	}
+}
+
+func TestLoadFromDB(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	tradeDate := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, ticker := range []string{"AAPL", "GOOG", "AAPL", "MSFT", "GOOG", "AAPL"} {
+		trade, err := blotter.NewTrade(blotter.TradeSideBuy, 100, ticker, "traderA", "dbs", "cdp", 150.0, 0.0, tradeDate.AddDate(0, 0, -i))
+		assert.NoError(t, err)
+		err = blotterSvc.AddTrade(*trade)
+		assert.NoError(t, err)
+	}
+
+	loaded := blotter.NewBlotter(db)
+	err := loaded.LoadFromDB()
+	assert.NoError(t, err)
+
+	// Loaded trades are sorted by trade date
+	trades := loaded.GetTrades()
+	assert.Equal(t, 6, len(trades))
+	for i := 1; i < len(trades); i++ {
+		assert.True(t, trades[i-1].TradeDate <= trades[i].TradeDate)
+	}
+
+	for _, ticker := range []string{"AAPL", "GOOG", "MSFT"} {
+		tickerTrades, err := loaded.GetTradesByTicker(ticker)
+		assert.NoError(t, err)
+		for i := 1; i < len(tickerTrades); i++ {
+			assert.True(t, tickerTrades[i-1].TradeDate <= tickerTrades[i].TradeDate)
+		}
+	}
+
+	for _, trade := range blotterSvc.GetTrades() {
+		loadedTrade, err := loaded.GetTradeByID(trade.TradeID)
+		assert.NoError(t, err)
+		assert.Equal(t, trade, *loadedTrade)
+	}
+}
+
+func TestLoadFromDBRepairsStaleHeadSequence(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	for i := 0; i < 3; i++ {
+		trade, err := createTestTrade()
+		assert.NoError(t, err)
+		assert.NoError(t, blotterSvc.AddTrade(*trade))
+	}
+
+	// a restore of an older head leaves it behind the trades
+	assert.NoError(t, db.Put(string(types.HeadSequenceBlotterKey), 0))
+
+	loaded := blotter.NewBlotter(db)
+	assert.NoError(t, loaded.LoadFromDB())
+	assert.Equal(t, 2, loaded.GetCurrentSeqNum())
+
+	var head int
+	assert.NoError(t, db.Get(string(types.HeadSequenceBlotterKey), &head))
+	assert.Equal(t, 2, head)
+
+	// new trades do not reuse sequence numbers
+	trade, err := createTestTrade()
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.AddTrade(*trade))
+	seen := make(map[int]bool)
+	for _, trade := range loaded.GetTrades() {
+		assert.False(t, seen[trade.SeqNum], "duplicate sequence number %d", trade.SeqNum)
+		seen[trade.SeqNum] = true
+	}
+	assert.Len(t, seen, 4)
+}
+
+func TestCheckLotSize(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	refMgr := mocks.NewMockReferenceManager()
+	refMgr.AddTicker(rdata.TickerReference{ID: "ES3", YahooTicker: "ES3.SI", AssetClass: rdata.AssetClassEquities})
+
+	blotterSvc := blotter.NewBlotter(db)
+	blotterSvc.SetReferenceManager(refMgr)
+
+	config.SetConfig(&config.Config{LotSizeCheck: config.LotSizeCheckBlock})
+	defer config.SetConfig(nil)
+
+	boardLot, err := blotter.NewTrade("buy", 300, "ES3", "traderA", "dbs", "cdp", 3.5, 0.0, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, blotterSvc.CheckLotSize(*boardLot, false))
+
+	oddLot, err := blotter.NewTrade("buy", 350, "ES3", "traderA", "dbs", "cdp", 3.5, 0.0, time.Now())
+	assert.NoError(t, err)
+	assert.Error(t, blotterSvc.CheckLotSize(*oddLot, false))
+	assert.NoError(t, blotterSvc.CheckLotSize(*oddLot, true))
+
+	// US equities default to a lot size of 1
+	usTrade, err := blotter.NewTrade("buy", 7, "AAPL", "traderA", "dbs", "cdp", 150.0, 0.0, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, blotterSvc.CheckLotSize(*usTrade, false))
+
+	// Warn mode only logs odd lots
+	config.SetConfig(&config.Config{LotSizeCheck: config.LotSizeCheckWarn})
+	assert.NoError(t, blotterSvc.CheckLotSize(*oddLot, false))
+}
+
+// failingBatchDatabase fails the commit of every batch.
+type failingBatchDatabase struct {
+	dal.Database
+}
+
+type failingBatch struct {
+	dal.Batch
+}
+
+func (db failingBatchDatabase) Batch() dal.Batch {
+	return failingBatch{db.Database.Batch()}
+}
+
+func (failingBatch) Commit() error {
+	return errors.New("disk full")
+}
+
+func TestImportFromCSVIsAllOrNothing(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	csvContent := "TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account\n" +
+		"2023-10-12T07:20:50Z,AAPL,buy,100,150.0,0.0,trader1,broker1,cdp\n" +
+		"2023-10-13T07:20:50Z,GOOG,buy,200,186.53,,trader2,broker2,cdp\n"
+
+	// a failed batch adds no trades and leaves the sequence number untouched
+	failing := blotter.NewBlotter(failingBatchDatabase{db})
+	err := failing.ImportFromCSVReader(csv.NewReader(strings.NewReader(csvContent)))
+	assert.ErrorContains(t, err, "disk full")
+	assert.Empty(t, failing.GetTrades())
+	assert.Equal(t, -1, failing.GetCurrentSeqNum())
+	keys, err := db.GetAllKeysWithPrefix(string(types.TradeKeyPrefix))
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	// the trades and the head sequence number are written together
+	blotterSvc := blotter.NewBlotter(db)
+	assert.NoError(t, blotterSvc.ImportFromCSVReader(csv.NewReader(strings.NewReader(csvContent))))
+	reloaded := blotter.NewBlotter(db)
+	assert.NoError(t, reloaded.LoadFromDB())
+	assert.Len(t, reloaded.GetTrades(), 2)
+	assert.Equal(t, 1, reloaded.GetCurrentSeqNum())
+}
+
+func TestExportImportCSVRoundTripEUFormat(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	tradeDate := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	trade, err := blotter.NewTrade("buy", 1500, "ES3.SI", "traderA", "dbs", "cdp", 3.456, 0.0, tradeDate)
+	assert.NoError(t, err)
+	trade.Fee = 4.5
+	assert.NoError(t, blotterSvc.AddTrade(*trade))
+
+	exported, err := blotterSvc.ExportToCSVBytesWithFormat(csvutil.EUFormat)
+	assert.NoError(t, err)
+	assert.Contains(t, string(exported), "15/03/2024;ES3.SI;buy;1500;3,456;0;traderA;dbs;cdp;4,5;")
+
+	dbPath2 := dbPath + "_import"
+	db2, err := dal.NewLevelDB(dbPath2)
+	assert.NoError(t, err)
+	defer cleanupTempDB(t, db2, dbPath2)
+
+	imported := blotter.NewBlotter(db2)
+	err = imported.ImportFromCSVReaderWithFormat(csvutil.EUFormat.NewReader(bytes.NewReader(exported)), csvutil.EUFormat, nil)
+	assert.NoError(t, err)
+
+	trades := imported.GetTrades()
+	assert.Len(t, trades, 1)
+	assert.Equal(t, trade.TradeDate, trades[0].TradeDate)
+	assert.Equal(t, trade.Quantity, trades[0].Quantity)
+	assert.Equal(t, trade.Price, trades[0].Price)
+	assert.Equal(t, trade.Fee, trades[0].Fee)
+}
+
+func TestImportFeeColumns(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	csvData := "TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account,Fee,FeeCcy\n" +
+		"2024-03-15T00:00:00Z,AAPL,buy,10,150,0,traderA,ibkr,ibkr,1.5,sgd\n" +
+		"2024-03-15T00:00:00Z,ES3.SI,buy,100,3.4,0,traderA,dbs,cdp,,\n"
+	assert.NoError(t, blotterSvc.ImportFromCSVReader(csv.NewReader(strings.NewReader(csvData))))
+
+	trades := blotterSvc.GetTrades()
+	assert.Len(t, trades, 2)
+	assert.Equal(t, 1.5, trades[0].Fee)
+	assert.Equal(t, "SGD", trades[0].FeeCcy)
+	assert.Zero(t, trades[1].Fee)
+
+	// fees in the base currency are converted at the trade's Fx
+	trades[0].Fx = 1.25
+	assert.InDelta(t, 1.2, trades[0].FeeInTradeCcy(), 1e-9)
+
+	negative := "TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account,Fee,FeeCcy\n" +
+		"2024-03-15T00:00:00Z,AAPL,buy,10,150,0,traderA,ibkr,ibkr,-1,\n"
+	assert.ErrorContains(t, blotterSvc.ImportFromCSVReader(csv.NewReader(strings.NewReader(negative))), "invalid fee at line 1")
+}
+
+func TestTradeTags(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	csvData := "TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account,Fee,FeeCcy,Tags,Notes\n" +
+		"2024-03-15T00:00:00Z,AAPL,buy,10,150,0,traderA,ibkr,ibkr,,,DCA| speculative |dca,monthly buy\n" +
+		"2024-04-15T00:00:00Z,ES3.SI,buy,100,3.4,0,traderA,dbs,cdp,,,,\n"
+	assert.NoError(t, blotterSvc.ImportFromCSVReader(csv.NewReader(strings.NewReader(csvData))))
+
+	trades := blotterSvc.GetTrades()
+	assert.Equal(t, []string{"DCA", "speculative"}, trades[0].Tags)
+	assert.Equal(t, "monthly buy", trades[0].Notes)
+	assert.Empty(t, trades[1].Tags)
+
+	trade, _ := blotter.NewTrade("buy", 10, "AAPL", "traderA", "ibkr", "ibkr", 160.0, 0.0, time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC))
+	trade.Tags = []string{"dca"}
+	assert.NoError(t, blotterSvc.AddTrade(*trade))
+
+	// tags match case-insensitively, in trade date order
+	tagged := blotterSvc.GetTradesByTag("Dca")
+	assert.Len(t, tagged, 2)
+	assert.Equal(t, 150.0, tagged[0].Price)
+	assert.Equal(t, 160.0, tagged[1].Price)
+	assert.Len(t, blotterSvc.GetTradesByFilter(blotter.TradeFilter{Tag: "SPECULATIVE"}), 1)
+
+	assert.NoError(t, blotterSvc.RemoveTrade(trade.TradeID))
+	assert.Len(t, blotterSvc.GetTradesByTag("dca"), 1)
+	assert.Empty(t, blotterSvc.GetTradesByTag("unknown"))
+
+	// tags and notes survive the CSV round trip
+	data, err := blotterSvc.ExportToCSVBytes()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "DCA|speculative,monthly buy")
+
+	reloaded := blotter.NewBlotter(db)
+	assert.NoError(t, reloaded.LoadFromDB())
+	assert.Len(t, reloaded.GetTradesByTag("speculative"), 1)
+}
+
+func TestImportWithProfile(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	profile, err := blotterSvc.GetImportProfile("DBSVickers")
+	assert.NoError(t, err)
+	assert.True(t, profile.BuiltIn)
+
+	// columns are matched by name in any order, unknown columns are ignored
+	csvData := "Ref No,Buy/Sell,Stock Code,Trade Date,Price,Quantity,Total Charges,Currency\n" +
+		"R1,B,D05.SI,15/03/2024,35.5,100,25.1,SGD\n" +
+		"R2,S,ES3.SI,16/03/2024,3.4,200,,SGD\n"
+	err = blotterSvc.ImportFromCSVReaderWithProfile(csv.NewReader(strings.NewReader(csvData)), profile, csvutil.DefaultFormat, nil)
+	assert.NoError(t, err)
+
+	trades := blotterSvc.GetTrades()
+	assert.Len(t, trades, 2)
+	assert.Equal(t, "2024-03-15T00:00:00Z", trades[0].TradeDate)
+	assert.Equal(t, "buy", trades[0].Side)
+	assert.Equal(t, 25.1, trades[0].Fee)
+	assert.Equal(t, "dbsvickers", trades[0].Broker)
+	assert.Equal(t, "sell", trades[1].Side)
+	assert.Equal(t, 200.0, trades[1].Quantity)
+
+	// a saved profile shadows the built-in one, missing required fields are reported per row
+	_, err = blotterSvc.SaveImportProfile(blotter.ImportProfile{
+		Name:    "DBSVickers",
+		Columns: map[string]string{"Date": "TradeDate", "Code": "Ticker", "Side": "Side", "Qty": "Quantity", "Px": "Price"},
+		Sides:   map[string]string{"B": "buy"},
+	})
+	assert.NoError(t, err)
+	profile, err = blotterSvc.GetImportProfile("dbsvickers")
+	assert.NoError(t, err)
+	assert.False(t, profile.BuiltIn)
+
+	csvData = "Date,Code,Side,Qty,Px\n2024-03-15T00:00:00Z,D05.SI,B,100,35.5\n2024-03-16T00:00:00Z,,B,100,35.5\n"
+	err = blotterSvc.ImportFromCSVReaderWithProfile(csv.NewReader(strings.NewReader(csvData)), profile, csvutil.DefaultFormat, nil)
+	assert.ErrorContains(t, err, "line 1: missing Trader")
+	assert.ErrorContains(t, err, "line 2: missing Ticker")
+	assert.Len(t, blotterSvc.GetTrades(), 2)
+
+	_, err = blotterSvc.SaveImportProfile(blotter.ImportProfile{Name: "broker", Columns: map[string]string{"Date": "When"}})
+	assert.ErrorContains(t, err, "unknown trade field When")
+	_, err = blotterSvc.SaveImportProfile(blotter.ImportProfile{Name: "eu", Columns: map[string]string{"Date": "TradeDate"}})
+	assert.ErrorContains(t, err, "reserved")
+
+	assert.NoError(t, blotterSvc.DeleteImportProfile("dbsvickers"))
+	profile, err = blotterSvc.GetImportProfile("dbsvickers")
+	assert.NoError(t, err)
+	assert.True(t, profile.BuiltIn)
+	profiles, err := blotterSvc.GetImportProfiles()
+	assert.NoError(t, err)
+	assert.Len(t, profiles, 3)
+}
+
+func TestImportDuplicates(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	header := "TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account\n"
+	march := "2024-03-15T00:00:00Z,ES3.SI,buy,100,3.4,0,traderA,dbs,cdp\n"
+	assert.NoError(t, blotterSvc.ImportFromCSVReader(csv.NewReader(strings.NewReader(header+march+march))))
+
+	// the identical March fills were imported before, only April is new
+	overlap := header + march + march + "2024-04-15T10:00:00Z,ES3.SI,buy,100,3.4,0,traderA,dbs,cdp\n"
+	_, err := blotterSvc.ImportCSV(csv.NewReader(strings.NewReader(overlap)),
+		blotter.ImportOptions{Format: csvutil.DefaultFormat, Duplicates: blotter.DuplicatesFail}, nil)
+	assert.ErrorIs(t, err, blotter.ErrDuplicateTrades)
+	assert.ErrorContains(t, err, "at lines 1, 2")
+	assert.Len(t, blotterSvc.GetTrades(), 2)
+
+	result, err := blotterSvc.ImportCSV(csv.NewReader(strings.NewReader(overlap)),
+		blotter.ImportOptions{Format: csvutil.DefaultFormat, Duplicates: blotter.DuplicatesSkip}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, blotter.ImportResult{Imported: 1, Skipped: 2, DuplicateLines: []int{1, 2}}, result)
+	assert.Len(t, blotterSvc.GetTrades(), 3)
+
+	// the same trade in another book is not a duplicate
+	otherBook := header + "2024-03-15T00:00:00Z,ES3.SI,buy,100,3.4,0,traderB,dbs,cdp\n"
+	result, err = blotterSvc.ImportCSV(csv.NewReader(strings.NewReader(otherBook)),
+		blotter.ImportOptions{Format: csvutil.DefaultFormat, Duplicates: blotter.DuplicatesSkip}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Imported)
+
+	result, err = blotterSvc.ImportCSV(csv.NewReader(strings.NewReader(header+march)),
+		blotter.ImportOptions{Format: csvutil.DefaultFormat}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, blotter.ImportResult{Imported: 1}, result)
+	assert.Len(t, blotterSvc.GetTrades(), 5)
+
+	_, err = blotterSvc.ImportCSV(csv.NewReader(strings.NewReader(header+march)),
+		blotter.ImportOptions{Format: csvutil.DefaultFormat, Duplicates: "ignore"}, nil)
+	assert.ErrorContains(t, err, "unsupported duplicates policy")
+}
+
+func TestOrderPostDuplicates(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	fill := `{"tradeDate":"2024-03-15T00:00:00Z","ticker":"ES3.SI","side":"buy","quantity":100,"price":3.4,"trader":"traderA","broker":"dbs","account":"cdp"}`
+	order := `{"fills":[` + fill + `]}`
+	post := func(body, duplicates string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/blotter/order?duplicates="+duplicates, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		blotter.HandleOrderPost(blotterSvc).ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusCreated, post(order, "").Code)
+
+	// re-posting the order with a new fill only adds the new fill
+	newFill := strings.Replace(fill, "2024-03-15", "2024-04-15", 1)
+	rr := post(`{"fills":[`+fill+`,`+newFill+`]}`, blotter.DuplicatesSkip)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response blotter.OrderResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.OrderID)
+	assert.Equal(t, blotter.ImportResult{Imported: 1, Skipped: 1, DuplicateLines: []int{1}}, response.ImportResult)
+	assert.Len(t, blotterSvc.GetTrades(), 2)
+
+	rr = post(order, blotter.DuplicatesSkip)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	response = blotter.OrderResponse{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Empty(t, response.OrderID)
+	assert.Equal(t, 1, response.Skipped)
+
+	assert.Equal(t, http.StatusConflict, post(order, blotter.DuplicatesFail).Code)
+	assert.Equal(t, http.StatusBadRequest, post(order, "ignore").Code)
+	assert.Len(t, blotterSvc.GetTrades(), 2)
+}
+
+func TestImportRecordsActingUser(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+	csvData := "TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account\n" +
+		"2024-03-15T00:00:00Z,ES3.SI,buy,100,3.4,0,alice,dbs,cdp\n"
+
+	bob := &types.User{Name: "bob", Books: []string{"bob"}}
+	err := blotterSvc.ImportFromCSVReaderWithFormat(csv.NewReader(strings.NewReader(csvData)), csvutil.DefaultFormat, bob)
+	assert.ErrorIs(t, err, blotter.ErrBookNotAllowed)
+	assert.Empty(t, blotterSvc.GetTrades())
+
+	alice := &types.User{Name: "alice", Books: []string{"alice"}}
+	err = blotterSvc.ImportFromCSVReaderWithFormat(csv.NewReader(strings.NewReader(csvData)), csvutil.DefaultFormat, alice)
+	assert.NoError(t, err)
+
+	trades := blotterSvc.GetTrades()
+	assert.Len(t, trades, 1)
+	assert.Equal(t, "alice", trades[0].CreatedBy)
+}
+
+func TestAddOrderAndCollapse(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	tradeBlotter := blotter.NewBlotter(db)
+	first, err := blotter.NewTrade("buy", 300, "D05.SI", "traderA", "dbs", "cdp", 30.0, 0.0, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	second, err := blotter.NewTrade("buy", 100, "D05.SI", "traderA", "dbs", "cdp", 34.0, 0.0, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	other, err := blotter.NewTrade("buy", 100, "AAPL", "traderA", "dbs", "cdp", 150.0, 0.0, time.Now())
+	assert.NoError(t, err)
+
+	first.Fee, second.Fee = 1.5, 0.5
+	orderID, err := tradeBlotter.AddOrder("", []blotter.Trade{*first, *second})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, orderID)
+	assert.NoError(t, tradeBlotter.AddTrade(*other))
+
+	// the fills are added in a single batch, none when any fails
+	retry, err := blotter.NewTrade("buy", 100, "D05.SI", "traderA", "dbs", "cdp", 34.0, 0.0, time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	_, err = tradeBlotter.AddOrder("", []blotter.Trade{*retry, *second})
+	assert.Error(t, err)
+	assert.Len(t, tradeBlotter.GetTrades(), 3)
+
+	trades, err := tradeBlotter.GetTradesByView(blotter.ViewTrades)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 3)
+	assert.Equal(t, orderID, trades[0].OrderID)
+	assert.Equal(t, orderID, trades[1].OrderID)
+
+	orders, err := tradeBlotter.GetTradesByView(blotter.ViewOrders)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.Equal(t, orderID, orders[0].TradeID)
+	assert.Equal(t, 400.0, orders[0].Quantity)
+	assert.InDelta(t, 31.0, orders[0].Price, 1e-9)
+	assert.Equal(t, 2.0, orders[0].Fee)
+	assert.Equal(t, first.TradeDate, orders[0].TradeDate)
+	assert.Equal(t, other.TradeID, orders[1].TradeID)
+
+	// fills of the same order id in different books are separate orders
+	fills := []blotter.Trade{trades[0], trades[1]}
+	assert.Len(t, blotter.CollapseOrders(fills), 1)
+	fills[1].Trader = "traderB"
+	assert.Len(t, blotter.CollapseOrders(fills), 2)
+
+	_, err = tradeBlotter.GetTradesByView("unknown")
+	assert.Error(t, err)
+}
+
+func TestAddOrderRejectsMixedFills(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	tradeBlotter := blotter.NewBlotter(db)
+	buy, _ := blotter.NewTrade("buy", 100, "D05.SI", "traderA", "dbs", "cdp", 30.0, 0.0, time.Now())
+	sell, _ := blotter.NewTrade("sell", 100, "D05.SI", "traderA", "dbs", "cdp", 30.0, 0.0, time.Now())
+
+	_, err := tradeBlotter.AddOrder("order-1", []blotter.Trade{*buy, *sell})
+	assert.Error(t, err)
+	assert.Empty(t, tradeBlotter.GetTrades())
+}
+
+func TestAnalyzeFx(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	config.SetConfig(&config.Config{BaseCcy: "SGD"})
+	defer config.SetConfig(nil)
+
+	refMgr := mocks.NewMockReferenceManager()
+	refMgr.AddTicker(rdata.TickerReference{ID: "AAPL", Ccy: "USD"})
+	refMgr.AddTicker(rdata.TickerReference{ID: "ES3", Ccy: "SGD"})
+	mdataMgr := mocks.NewMockMarketDataManager()
+	mdataMgr.HistoricalData["USD-SGD"] = []*types.AssetData{
+		{Ticker: "USD-SGD", Price: 1.34, Timestamp: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC).Unix()},
+		{Ticker: "USD-SGD", Price: 1.36, Timestamp: time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC).Unix()},
+		{Ticker: "USD-SGD", Price: 1.35, Timestamp: time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+
+	tradeBlotter := blotter.NewBlotter(db)
+	tradeBlotter.SetReferenceManager(refMgr)
+	tradeBlotter.SetMarketData(mdataMgr)
+
+	addTrade := func(ticker string, qty, price, fx float64, date time.Time) {
+		trade, err := blotter.NewTrade("buy", qty, ticker, "traderA", "ibkr", "ibkr", price, 0.0, date)
+		assert.NoError(t, err)
+		trade.Fx = fx
+		assert.NoError(t, tradeBlotter.AddTrade(*trade))
+	}
+	addTrade("AAPL", 10, 100, 1.35, time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC))  // notional 1000
+	addTrade("AAPL", 10, 300, 1.39, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)) // notional 3000
+	addTrade("AAPL", 10, 100, 1.3501, time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC))
+	addTrade("AAPL", 10, 100, 0, time.Date(2024, 2, 6, 0, 0, 0, 0, time.UTC))     // missing fx
+	addTrade("ES3", 100, 3, 1, time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC))       // base currency
+	addTrade("AAPL", 10, 100, 1.30, time.Date(2023, 12, 5, 0, 0, 0, 0, time.UTC)) // other year
+
+	analysis, err := tradeBlotter.AnalyzeFx("usd", 2024, 50, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", analysis.Ccy)
+	assert.Equal(t, "SGD", analysis.BaseCcy)
+	assert.Equal(t, 1, analysis.ExcludedTrades)
+	assert.Len(t, analysis.Months, 2)
+
+	jan := analysis.Months[0]
+	assert.Equal(t, "2024-01", jan.Month)
+	assert.Equal(t, 2, jan.Trades)
+	assert.InDelta(t, 1.38, jan.AchievedRate, 1e-9)
+	assert.InDelta(t, 1.35, jan.MarketRate, 1e-9)
+	assert.InDelta(t, 222.22, jan.SpreadBps, 0.01)
+	assert.True(t, jan.Flagged)
+
+	feb := analysis.Months[1]
+	assert.Equal(t, "2024-02", feb.Month)
+	assert.InDelta(t, 0.74, feb.SpreadBps, 0.01)
+	assert.False(t, feb.Flagged)
+
+	// users only see the trades of their books
+	analysis, err = tradeBlotter.AnalyzeFx("usd", 2024, 50, &types.User{Name: "bob", Books: []string{"traderB"}})
+	assert.NoError(t, err)
+	assert.Empty(t, analysis.Months)
+
+	_, err = tradeBlotter.AnalyzeFx("SGD", 2024, 50, nil)
+	assert.Error(t, err)
+}
+
+func TestFxInferenceAndBackfill(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	config.SetConfig(&config.Config{BaseCcy: "SGD"})
+	defer config.SetConfig(nil)
+
+	refMgr := mocks.NewMockReferenceManager()
+	refMgr.AddTicker(rdata.TickerReference{ID: "AAPL", Ccy: "USD"})
+	refMgr.AddTicker(rdata.TickerReference{ID: "ES3", Ccy: "SGD"})
+	refMgr.AddTicker(rdata.TickerReference{ID: "0700", Ccy: "HKD"})
+	mdataMgr := mocks.NewMockMarketDataManager()
+	mdataMgr.HistoricalData["USD-SGD"] = []*types.AssetData{
+		{Ticker: "USD-SGD", Price: 1.34, Timestamp: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC).Unix()}, // friday
+		{Ticker: "USD-SGD", Price: 1.36, Timestamp: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+	mdataMgr.SetAssetPrice("USD-SGD", &types.AssetData{Ticker: "USD-SGD", Price: 1.40})
+
+	tradeBlotter := blotter.NewBlotter(db)
+	tradeBlotter.SetReferenceManager(refMgr)
+	tradeBlotter.SetMarketData(mdataMgr)
+
+	// weekends carry the friday close, the base currency is 1
+	fx, err := tradeBlotter.InferFx("usd", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.34, fx)
+	fx, err = tradeBlotter.InferFx("SGD", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, fx)
+	_, err = tradeBlotter.InferFx("USD", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Error(t, err)
+
+	addTrade := func(ticker, trader string, qty, price, fx float64, date time.Time) *blotter.Trade {
+		trade, err := blotter.NewTrade("buy", qty, ticker, trader, "ibkr", "ibkr", price, 0.0, date)
+		assert.NoError(t, err)
+		trade.Fx = fx
+		assert.NoError(t, tradeBlotter.AddTrade(*trade))
+		return trade
+	}
+	missing := addTrade("AAPL", "traderA", 10, 100, 0, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC))
+	addTrade("AAPL", "traderA", 30, 100, 1.30, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	addTrade("ES3", "traderA", 100, 3, 0, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC))
+	addTrade("0700", "traderA", 100, 300, 0, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)) // no fx history
+	addTrade("AAPL", "traderB", 10, 100, 0, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC))
+
+	// a dry run proposes the rates of the books the user may see without changing the trades
+	user := &types.User{Name: "alice", Books: []string{"traderA"}}
+	report, err := tradeBlotter.BackfillFx(true, user)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Len(t, report.Trades, 2)
+	assert.Len(t, report.Warnings, 1)
+	trade, _ := tradeBlotter.GetTradeByID(missing.TradeID)
+	assert.Equal(t, 0.0, trade.Fx)
+
+	report, err = tradeBlotter.BackfillFx(false, user)
+	assert.NoError(t, err)
+	assert.Len(t, report.Trades, 2)
+	trade, _ = tradeBlotter.GetTradeByID(missing.TradeID)
+	assert.Equal(t, 1.36, trade.Fx)
+
+	// the rates survive a reload from the database
+	reloaded := blotter.NewBlotter(db)
+	assert.NoError(t, reloaded.LoadFromDB())
+	trade, _ = reloaded.GetTradeByID(missing.TradeID)
+	assert.Equal(t, 1.36, trade.Fx)
+
+	// trades are updated in place, but not the fields positions derive from
+	updated := *trade
+	updated.Notes = "fx backfilled"
+	assert.NoError(t, reloaded.UpdateTrade(updated))
+	trade, _ = reloaded.GetTradeByID(missing.TradeID)
+	assert.Equal(t, "fx backfilled", trade.Notes)
+	updated.Quantity = 20
+	assert.Error(t, reloaded.UpdateTrade(updated))
+
+	// 30 bought at 1.30 and 10 at 1.36
+	average, err := tradeBlotter.AverageFxRate("USD", user)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, average.Trades)
+	assert.InDelta(t, 1.315, average.AverageRate, 1e-9)
+	assert.Equal(t, 1.40, average.CurrentRate)
+	assert.InDelta(t, 6.4639, average.ChangePct, 1e-4)
+
+	// the other book's trade is left without fx
+	average, err = tradeBlotter.AverageFxRate("USD", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, average.ExcludedTrades)
+
+	_, err = tradeBlotter.AverageFxRate("SGD", nil)
+	assert.Error(t, err)
+}
+
+func TestQuantityForNotional(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	refMgr := mocks.NewMockReferenceManager()
+	refMgr.AddTicker(rdata.TickerReference{ID: "ES3", YahooTicker: "ES3.SI", AssetClass: rdata.AssetClassEquities})
+	refMgr.AddTicker(rdata.TickerReference{ID: "AAPL", YahooTicker: "AAPL", AssetClass: rdata.AssetClassEquities})
+	mdataMgr := mocks.NewMockMarketDataManager()
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 150})
+
+	tradeBlotter := blotter.NewBlotter(db)
+	tradeBlotter.SetReferenceManager(refMgr)
+
+	// sgx board lot of 100
+	qty, price, remainder, err := tradeBlotter.QuantityForNotional("ES3", 10000, 3.3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3000.0, qty)
+	assert.Equal(t, 3.3, price)
+	assert.InDelta(t, 100.0, remainder, 1e-9)
+
+	// below one lot
+	_, _, _, err = tradeBlotter.QuantityForNotional("ES3", 300, 3.3)
+	assert.Error(t, err)
+
+	// price is required without market data
+	_, _, _, err = tradeBlotter.QuantityForNotional("AAPL", 1000, 0)
+	assert.Error(t, err)
+
+	tradeBlotter.SetMarketData(mdataMgr)
+	qty, price, remainder, err = tradeBlotter.QuantityForNotional("AAPL", 1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 6.0, qty)
+	assert.Equal(t, 150.0, price)
+	assert.InDelta(t, 100.0, remainder, 1e-9)
+}
+
+func TestClosePositionOldestFirst(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	tradeBlotter := blotter.NewBlotter(db)
+	addTrade := func(side string, qty float64, trader string, date time.Time) *blotter.Trade {
+		trade, err := blotter.NewTrade(side, qty, "ES3", trader, "dbs", "cdp", 3.0, 0.0, date)
+		assert.NoError(t, err)
+		assert.NoError(t, tradeBlotter.AddTrade(*trade))
+		return trade
+	}
+	oldest := addTrade("buy", 100, "traderA", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	newest := addTrade("buy", 300, "traderA", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	addTrade("buy", 500, "traderB", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)) // other book
+	addTrade("sell", 50, "traderA", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) // naked sell offsets the oldest buy
+
+	_, err := tradeBlotter.ClosePosition("traderA", "ES3", 400, 3.5, time.Now(), nil, audit.SourceAPI)
+	assert.Error(t, err, "closing more than the open quantity")
+
+	closed, err := tradeBlotter.ClosePosition("traderA", "ES3", 150, 3.5, time.Now(), nil, audit.SourceAPI)
+	assert.NoError(t, err)
+	assert.Len(t, closed, 2)
+	assert.Equal(t, oldest.TradeID, closed[0].OrigTradeID)
+	assert.Equal(t, 50.0, closed[0].Quantity)
+	assert.Equal(t, newest.TradeID, closed[1].OrigTradeID)
+	assert.Equal(t, 100.0, closed[1].Quantity)
+	for _, trade := range closed {
+		assert.Equal(t, blotter.TradeSideSell, trade.Side)
+		assert.Equal(t, blotter.TradeStatusClosed, trade.Status)
+		assert.Equal(t, closed[0].OrderID, trade.OrderID)
+	}
+
+	lots := tradeBlotter.OpenLots("traderA", "ES3")
+	assert.Len(t, lots, 1)
+	assert.Equal(t, newest.TradeID, lots[0].Trade.TradeID)
+	assert.Equal(t, 200.0, lots[0].OpenQty)
+}
+
+func TestStrictTickerValidation(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	refMgr := mocks.NewMockReferenceManager()
+	refMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities})
+	refMgr.AddTicker(rdata.TickerReference{ID: "O39.SI", AssetClass: rdata.AssetClassEquities})
+	refMgr.AddTicker(rdata.TickerReference{ID: "AAPL", AssetClass: rdata.AssetClassEquities})
+
+	blotterSvc := blotter.NewBlotter(db)
+	blotterSvc.SetReferenceManager(refMgr)
+
+	// disabled by default for users who load trades before reference data
+	assert.NoError(t, blotterSvc.CheckTicker("DO5.SI"))
+
+	config.SetConfig(&config.Config{StrictTickerValidation: true})
+	defer config.SetConfig(nil)
+
+	assert.NoError(t, blotterSvc.CheckTicker("D05.SI"))
+
+	var unknownTicker *blotter.UnknownTickerError
+	assert.ErrorAs(t, blotterSvc.CheckTicker("DO5.SI"), &unknownTicker)
+	assert.Equal(t, []string{"D05.SI"}, unknownTicker.Suggestions)
+
+	assert.ErrorAs(t, blotterSvc.CheckTicker("ZZZZZZ"), &unknownTicker)
+	assert.Empty(t, unknownTicker.Suggestions)
+
+	// csv import reports every row with an unknown ticker and imports nothing
+	csvContent := [][]string{
+		{"TradeDate", "Ticker", "Side", "Quantity", "Price", "Yield", "Trader", "Broker", "Account"},
+		{"2023-10-12T07:20:50Z", "DO5.SI", "buy", "100", "30.0", "", "trader1", "dbs", "cdp"},
+		{"2023-10-12T07:20:50Z", "AAPL", "buy", "10", "150.0", "", "trader1", "ibkr", "ibkr"},
+		{"2023-10-12T07:20:50Z", "APPL", "buy", "10", "150.0", "", "trader1", "ibkr", "ibkr"},
+	}
+	filePath := createMockCSVFile(t, csvContent)
+	defer os.Remove(filePath)
+
+	err := blotterSvc.ImportFromCSVFile(filePath)
+	assert.ErrorContains(t, err, "line 1: unknown ticker DO5.SI, did you mean D05.SI")
+	assert.ErrorContains(t, err, "line 3: unknown ticker APPL, did you mean AAPL")
+	assert.Empty(t, blotterSvc.GetTrades())
+}
+
+func TestSavedViews(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	refMgr := mocks.NewMockReferenceManager()
+	refMgr.AddTicker(rdata.TickerReference{ID: "ES3.SI", AssetClass: rdata.AssetClassEquities})
+	refMgr.AddTicker(rdata.TickerReference{ID: "BTC-USD", AssetClass: rdata.AssetClassCrypto})
+	blotterSvc := blotter.NewBlotter(db)
+	blotterSvc.SetReferenceManager(refMgr)
+	for _, trade := range []struct{ ticker, trader string }{{"ES3.SI", "alice"}, {"BTC-USD", "alice"}, {"ES3.SI", "bob"}, {"ES3.SI", "carol"}} {
+		newTrade, _ := blotter.NewTrade("buy", 10, trade.ticker, trade.trader, "dbs", "cdp", 3.4, 0.0, time.Now())
+		assert.NoError(t, blotterSvc.AddTrade(*newTrade))
+	}
+
+	serve := func(handler http.HandlerFunc, method, target, body string, user *types.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), types.UserKey, user))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// names are lower cased, and an asset class cannot be both included and excluded
+	rr := serve(blotter.HandleSavedViewPut(blotterSvc), http.MethodPut, "/api/v1/blotter/saved-views/Retirement",
+		`{"books":["alice","bob"],"excludeAssetClasses":["crypto"]}`, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = serve(blotter.HandleSavedViewPut(blotterSvc), http.MethodPut, "/api/v1/blotter/saved-views/bad",
+		`{"includeAssetClasses":["eq"],"excludeAssetClasses":["eq"]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var views []blotter.SavedView
+	assert.NoError(t, json.NewDecoder(serve(blotter.HandleSavedViewsGet(blotterSvc), http.MethodGet, "/api/v1/blotter/saved-views", "", nil).Body).Decode(&views))
+	assert.Equal(t, []blotter.SavedView{{Name: "retirement", Books: []string{"alice", "bob"}, ExcludeAssetClasses: []string{"crypto"}}}, views)
+
+	// the view narrows the trades to its books and asset classes, and never widens the books of the user
+	var trades []blotter.Trade
+	rr = serve(blotter.HandleTradeGet(blotterSvc), http.MethodGet, "/api/v1/blotter/trade?saved_view=retirement", "", nil)
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&trades))
+	assert.Len(t, trades, 2)
+	for _, trade := range trades {
+		assert.Equal(t, "ES3.SI", trade.Ticker)
+		assert.NotEqual(t, "carol", trade.Trader)
+	}
+
+	rr = serve(blotter.HandleTradeGet(blotterSvc), http.MethodGet, "/api/v1/blotter/trade?saved_view=retirement", "", &types.User{Name: "alice", Books: []string{"alice"}})
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&trades))
+	assert.Len(t, trades, 1)
+
+	rr = serve(blotter.HandleTradeGet(blotterSvc), http.MethodGet, "/api/v1/blotter/trade?saved_view=bogus", "", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serve(blotter.HandleSavedViewDelete(blotterSvc), http.MethodDelete, "/api/v1/blotter/saved-views/retirement", "", nil)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = serve(blotter.HandleSavedViewGet(blotterSvc), http.MethodGet, "/api/v1/blotter/saved-views/retirement", "", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = serve(blotter.HandleSavedViewDelete(blotterSvc), http.MethodDelete, "/api/v1/blotter/saved-views/retirement", "", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,131 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"portfolio-manager/pkg/types"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Trade statuses
+const (
+	TradeStatusClosed  = "closed"  // sell generated to close an open buy, linked via OrigTradeID
+	TradeStatusPending = "pending" // vest awaiting confirmation of its price, not yet in the blotter
+	TradeStatusVested  = "vested"  // buy generated by the vest of an employee stock plan grant, linked via GrantID
+)
+
+// OpenLot is a buy trade along with its quantity not yet offset by sells.
+type OpenLot struct {
+	Trade   Trade
+	OpenQty float64
+}
+
+// OpenLots returns the buy trades of the trader's ticker which are still open, oldest first. Sells linked to a buy via
+// OrigTradeID offset that buy, while unlinked sells offset the oldest open buys.
+func (b *TradeBlotter) OpenLots(trader, ticker string) []OpenLot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lots []OpenLot
+	lotIdx := make(map[string]int)
+	var linked, unlinked []Trade
+	for _, trade := range b.tradesByTicker[ticker] {
+		if trade.Trader != trader {
+			continue
+		}
+		switch {
+		case trade.Side == TradeSideBuy:
+			lotIdx[trade.TradeID] = len(lots)
+			lots = append(lots, OpenLot{Trade: trade, OpenQty: trade.Quantity})
+		case trade.OrigTradeID != "":
+			linked = append(linked, trade)
+		default:
+			unlinked = append(unlinked, trade)
+		}
+	}
+
+	for _, sell := range linked {
+		if idx, ok := lotIdx[sell.OrigTradeID]; ok {
+			lots[idx].OpenQty -= sell.Quantity
+		} else {
+			unlinked = append(unlinked, sell)
+		}
+	}
+	for _, sell := range unlinked {
+		remaining := sell.Quantity
+		for i := range lots {
+			if remaining <= 0 {
+				break
+			}
+			offset := min(lots[i].OpenQty, remaining)
+			if offset <= 0 {
+				continue
+			}
+			lots[i].OpenQty -= offset
+			remaining -= offset
+		}
+	}
+
+	var open []OpenLot
+	for _, lot := range lots {
+		if lot.OpenQty > 0 {
+			open = append(open, lot)
+		}
+	}
+	return open
+}
+
+// ClosePosition closes quantity of the trader's ticker at the price, generating one sell per open buy it offsets,
+// oldest first. The sells are marked closed, linked to their buy via OrigTradeID and share an OrderID, so they
+// collapse into a single row in the orders view. Closing more than the open quantity is rejected.
+// The sells are recorded as created by the user, nil when authentication is disabled or for system closes, and
+// attributed to the source in the audit log.
+func (b *TradeBlotter) ClosePosition(trader, ticker string, quantity, price float64, tradeDate time.Time, user *types.User, source string) ([]Trade, error) {
+	if quantity <= 0 {
+		return nil, errors.New("quantity must be positive")
+	}
+	if user != nil && !user.CanSeeBook(trader) {
+		return nil, fmt.Errorf("%w: user %s may not trade in book %s", ErrBookNotAllowed, user.Name, trader)
+	}
+
+	lots := b.OpenLots(trader, ticker)
+	openQty := 0.0
+	for _, lot := range lots {
+		openQty += lot.OpenQty
+	}
+	if quantity > openQty {
+		return nil, fmt.Errorf("cannot close %v %s, only %v is open for %s", quantity, ticker, openQty, trader)
+	}
+
+	var sells []Trade
+	remaining := quantity
+	for _, lot := range lots {
+		if remaining <= 0 {
+			break
+		}
+		closeQty := min(lot.OpenQty, remaining)
+		sell, err := NewTrade(TradeSideSell, closeQty, ticker, trader, lot.Trade.Broker, lot.Trade.Account, price, 0, tradeDate)
+		if err != nil {
+			return nil, err
+		}
+		sell.Status = TradeStatusClosed
+		sell.OrigTradeID = lot.Trade.TradeID
+		if user != nil {
+			sell.CreatedBy = user.Name
+		}
+		sells = append(sells, *sell)
+		remaining -= closeQty
+	}
+
+	orderID := uuid.New().String()
+	if _, err := b.addOrder(orderID, sells, source); err != nil {
+		return nil, err
+	}
+	for i := range sells {
+		sells[i].OrderID = orderID
+	}
+
+	return sells, nil
+}
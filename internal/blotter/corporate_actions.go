@@ -0,0 +1,103 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"portfolio-manager/internal/audit"
+)
+
+// RenameTicker moves the trades of the from ticker dated before the effective date (YYYY-MM-DD) to the to ticker, e.g.
+// after a change of symbol. An empty effective date moves all trades. The moved trades are returned with their new ticker, and
+// in dry run mode nothing is changed. Trade keys embed the ticker, so each trade is rewritten under a new key.
+func (b *TradeBlotter) RenameTicker(from, to string, effectiveDate string, dryRun bool) ([]Trade, error) {
+	if from == "" || to == "" {
+		return nil, errors.New("from and to tickers are required")
+	}
+	if from == to {
+		return nil, errors.New("from and to tickers must differ")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	db := audit.WithSource(b.db, audit.SourceMigration)
+	var renamed []Trade
+	for i := range b.trades {
+		trade := &b.trades[i]
+		if trade.Ticker != from {
+			continue
+		}
+		if effectiveDate != "" && trade.TradeDate[:min(len(trade.TradeDate), len("2006-01-02"))] >= effectiveDate {
+			continue
+		}
+
+		if !dryRun {
+			oldKey := generateTradeKey(*trade)
+			trade.Ticker = to
+			if err := db.Put(generateTradeKey(*trade), *trade); err != nil {
+				return nil, fmt.Errorf("error writing trade %s: %w", trade.TradeID, err)
+			}
+			if err := db.Delete(oldKey); err != nil {
+				return nil, fmt.Errorf("error deleting trade %s: %w", trade.TradeID, err)
+			}
+		}
+
+		moved := *trade
+		moved.Ticker = to
+		renamed = append(renamed, moved)
+	}
+
+	if !dryRun && len(renamed) > 0 {
+		b.rebuildIndexes()
+	}
+
+	return renamed, nil
+}
+
+// rebuildIndexes rebuilds the trade indexes from the trades slice. The caller must hold the lock.
+func (b *TradeBlotter) rebuildIndexes() {
+	b.tradesByID = make(map[string]*Trade, len(b.trades))
+	b.tradesByTicker = make(map[string][]Trade)
+	b.tradesByTag = make(map[string]map[string]struct{})
+	for i := range b.trades {
+		trade := b.trades[i]
+		b.tradesByID[trade.TradeID] = &trade
+		b.tradesByTicker[trade.Ticker] = append(b.tradesByTicker[trade.Ticker], trade)
+		b.indexTags(trade)
+	}
+}
+
+// ApplySplit adjusts the trades of the ticker dated before the effective date (YYYY-MM-DD) for a stock split, where
+// ratio is the number of new shares per old share, e.g. 10 for a 1:10 split or 0.1 for a 10:1 reverse split.
+// Quantities are multiplied and prices divided by the ratio, preserving each trade's notional. The adjusted trades
+// are returned.
+func (b *TradeBlotter) ApplySplit(ticker string, ratio float64, effectiveDate string) ([]Trade, error) {
+	if ratio <= 0 || ratio == 1 {
+		return nil, fmt.Errorf("invalid split ratio %v", ratio)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	db := audit.WithSource(b.db, audit.SourceMigration)
+	var adjusted []Trade
+	for i := range b.trades {
+		trade := &b.trades[i]
+		if trade.Ticker != ticker || trade.TradeDate[:min(len(trade.TradeDate), len("2006-01-02"))] >= effectiveDate {
+			continue
+		}
+
+		trade.Quantity *= ratio
+		trade.Price /= ratio
+		if err := db.Put(generateTradeKey(*trade), *trade); err != nil {
+			return nil, fmt.Errorf("error writing trade %s: %w", trade.TradeID, err)
+		}
+		adjusted = append(adjusted, *trade)
+	}
+
+	if len(adjusted) > 0 {
+		b.rebuildIndexes()
+	}
+
+	return adjusted, nil
+}
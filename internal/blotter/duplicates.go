@@ -0,0 +1,106 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"portfolio-manager/pkg/csvutil"
+	"portfolio-manager/pkg/logging"
+)
+
+// Duplicate policies of an import, applied to trades duplicating those already in the blotter
+const (
+	DuplicatesImport = "import-anyway"
+	DuplicatesSkip   = "skip"
+	DuplicatesFail   = "fail"
+)
+
+// ErrDuplicateTrades is returned when an import with the fail duplicate policy contains duplicate trades.
+var ErrDuplicateTrades = errors.New("duplicate trades")
+
+// ImportOptions controls how a CSV is imported.
+type ImportOptions struct {
+	Format     csvutil.FormatOptions
+	Profile    *ImportProfile // maps the columns of a broker's export, the trades CSV is expected when nil
+	Duplicates string         // duplicate policy, defaults to DuplicatesImport
+}
+
+// ImportResult reports the trades added by an import and the duplicates skipped.
+type ImportResult struct {
+	Imported       int   `json:"imported"`
+	Skipped        int   `json:"skipped"`
+	DuplicateLines []int `json:"duplicateLines,omitempty"` // lines of the duplicates, counting rows after the header from 1
+}
+
+// ParseDuplicatePolicy validates the duplicate policy, defaulting to DuplicatesImport.
+func ParseDuplicatePolicy(policy string) (string, error) {
+	switch strings.ToLower(policy) {
+	case "", DuplicatesImport:
+		return DuplicatesImport, nil
+	case DuplicatesSkip:
+		return DuplicatesSkip, nil
+	case DuplicatesFail:
+		return DuplicatesFail, nil
+	default:
+		return "", fmt.Errorf("unsupported duplicates policy %s, expected %s, %s or %s", policy, DuplicatesSkip,
+			DuplicatesImport, DuplicatesFail)
+	}
+}
+
+// fingerprint identifies the trade by ticker, side, trade date, quantity, price and book, i.e. the fields a broker
+// export repeats when re-imported.
+func (t Trade) fingerprint() string {
+	tradeDate := t.TradeDate
+	if len(tradeDate) > len("2006-01-02") {
+		tradeDate = tradeDate[:len("2006-01-02")]
+	}
+	return strings.Join([]string{
+		strings.ToUpper(t.Ticker), t.Side, tradeDate,
+		strconv.FormatFloat(t.Quantity, 'f', -1, 64), strconv.FormatFloat(t.Price, 'f', -1, 64), t.Trader,
+	}, "|")
+}
+
+// handleDuplicates applies the duplicate policy to the imported trades, returning the trades to add. A trade in the
+// blotter is matched by one imported trade only, so identical fills are duplicates only as often as they were
+// imported before.
+func (b *TradeBlotter) handleDuplicates(trades []*Trade, duplicates string) ([]*Trade, ImportResult, error) {
+	if duplicates == DuplicatesImport {
+		return trades, ImportResult{}, nil
+	}
+
+	b.mu.Lock()
+	existing := make(map[string]int, len(b.trades))
+	for _, trade := range b.trades {
+		existing[trade.fingerprint()]++
+	}
+	b.mu.Unlock()
+
+	var result ImportResult
+	kept := make([]*Trade, 0, len(trades))
+	for i, trade := range trades {
+		fingerprint := trade.fingerprint()
+		if existing[fingerprint] > 0 {
+			existing[fingerprint]--
+			result.DuplicateLines = append(result.DuplicateLines, i+1)
+			continue
+		}
+		kept = append(kept, trade)
+	}
+
+	if len(result.DuplicateLines) == 0 {
+		return trades, result, nil
+	}
+	if duplicates == DuplicatesFail {
+		lines := make([]string, len(result.DuplicateLines))
+		for i, line := range result.DuplicateLines {
+			lines[i] = strconv.Itoa(line)
+		}
+		return nil, result, fmt.Errorf("%w at lines %s", ErrDuplicateTrades, strings.Join(lines, ", "))
+	}
+
+	result.Skipped = len(result.DuplicateLines)
+	logging.GetLogger().Infof("Skipping %d duplicate trades", result.Skipped)
+	return kept, result, nil
+}
@@ -1,6 +1,10 @@
 package blotter
 
-import "portfolio-manager/pkg/event"
+import (
+	"context"
+
+	"portfolio-manager/pkg/event"
+)
 
 // Define event names
 const (
@@ -13,18 +17,20 @@ type NewTradeEventPayload struct {
 	Trade Trade
 }
 
-// PublishNewTradeEvent publishes a new trade event.
-func (b *TradeBlotter) PublishNewTradeEvent(trade Trade) {
+// PublishNewTradeEvent publishes a new trade event, along with the context of the change.
+func (b *TradeBlotter) PublishNewTradeEvent(ctx context.Context, trade Trade) {
 	event := event.Event{
+		Ctx:  ctx,
 		Name: NewTradeEvent,
 		Data: NewTradeEventPayload{Trade: trade},
 	}
 	b.eventBus.Publish(event)
 }
 
-// PublishNewTradeEvent publishes a new trade event.
-func (b *TradeBlotter) PublishRemoveTradeEvent(trade Trade) {
+// PublishRemoveTradeEvent publishes a remove trade event, along with the context of the change.
+func (b *TradeBlotter) PublishRemoveTradeEvent(ctx context.Context, trade Trade) {
 	event := event.Event{
+		Ctx:  ctx,
 		Name: RemoveTradeEvent,
 		Data: NewTradeEventPayload{Trade: trade},
 	}
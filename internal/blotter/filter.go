@@ -0,0 +1,110 @@
+package blotter
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPageSize is the number of rows per page when not requested
+const DefaultPageSize = 50
+
+// TradeFilter filters the trades in the blotter, empty fields match all trades.
+type TradeFilter struct {
+	Ticker string
+	Trader string
+	Tag    string // matched case-insensitively
+	From   string // inclusive trade date, YYYY-MM-DD
+	To     string // inclusive trade date, YYYY-MM-DD
+}
+
+// Page is a page of rows along with the total number of rows matched.
+type Page[T any] struct {
+	Rows     []T
+	Total    int
+	Page     int
+	PageSize int
+}
+
+// ParseTradeFilter parses the ticker, trader, tag, from and to query parameters.
+func ParseTradeFilter(query url.Values) (TradeFilter, error) {
+	filter := TradeFilter{
+		Ticker: strings.ToUpper(query.Get("ticker")),
+		Trader: query.Get("trader"),
+		Tag:    query.Get("tag"),
+		From:   query.Get("from"),
+		To:     query.Get("to"),
+	}
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return TradeFilter{}, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", date)
+		}
+	}
+	return filter, nil
+}
+
+// ParsePagination parses the 1-based page and pageSize query parameters.
+func ParsePagination(query url.Values) (int, int, error) {
+	page, pageSize := 1, DefaultPageSize
+	var err error
+	if p := query.Get("page"); p != "" {
+		if page, err = strconv.Atoi(p); err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive number")
+		}
+	}
+	if ps := query.Get("pageSize"); ps != "" {
+		if pageSize, err = strconv.Atoi(ps); err != nil || pageSize < 1 {
+			return 0, 0, fmt.Errorf("pageSize must be a positive number")
+		}
+	}
+	return page, pageSize, nil
+}
+
+// Matches returns whether the trade passes the filter.
+func (f TradeFilter) Matches(trade Trade) bool {
+	if f.Ticker != "" && trade.Ticker != f.Ticker {
+		return false
+	}
+	if f.Trader != "" && trade.Trader != f.Trader {
+		return false
+	}
+	if f.Tag != "" && !trade.HasTag(f.Tag) {
+		return false
+	}
+	tradeDate := trade.TradeDate[:min(len(trade.TradeDate), len("2006-01-02"))]
+	if f.From != "" && tradeDate < f.From {
+		return false
+	}
+	if f.To != "" && tradeDate > f.To {
+		return false
+	}
+	return true
+}
+
+// GetTradesByFilter returns the trades passing the filter, in trade date order.
+func (b *TradeBlotter) GetTradesByFilter(filter TradeFilter) []Trade {
+	var trades []Trade
+	for _, trade := range b.GetTrades() {
+		if filter.Matches(trade) {
+			trades = append(trades, trade)
+		}
+	}
+	return trades
+}
+
+// Paginate returns the 1-based page of rows.
+func Paginate[T any](rows []T, page, pageSize int) Page[T] {
+	start := min((page-1)*pageSize, len(rows))
+	end := min(start+pageSize, len(rows))
+	return Page[T]{
+		Rows:     rows[start:end],
+		Total:    len(rows),
+		Page:     page,
+		PageSize: pageSize,
+	}
+}
@@ -0,0 +1,148 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/types"
+)
+
+// DefaultFxSpreadThresholdBps flags months where the achieved FX rate deviates from the market rate by more than this
+const DefaultFxSpreadThresholdBps = 50.0
+
+// FxMonth compares the achieved FX rate of a month's trades against the month's average market rate.
+type FxMonth struct {
+	Month        string  // yyyy-mm
+	Trades       int     // trades with Fx in the month
+	Notional     float64 // in the trade currency
+	AchievedRate float64 // notional weighted Fx of the trades
+	MarketRate   float64 // average daily close, 0 if unavailable
+	SpreadBps    float64 // (achieved - market) / market in basis points
+	Flagged      bool    // spread exceeds the threshold
+}
+
+// FxAnalysis holds the monthly achieved versus market FX rates of a currency against the base currency.
+type FxAnalysis struct {
+	Ccy            string
+	BaseCcy        string
+	Year           int
+	ThresholdBps   float64
+	Months         []FxMonth
+	ExcludedTrades int // trades in the currency without Fx
+	Warnings       []string
+}
+
+// AnalyzeFx computes the notional weighted FX rate achieved on trades in ccy per month of the year, compared against
+// the month's average market rate of the <ccy>-<base> ticker. Trades in ccy without Fx are excluded and counted. Only
+// the trades in the books the user may see are analyzed, all trades when user is nil.
+func (b *TradeBlotter) AnalyzeFx(ccy string, year int, thresholdBps float64, user *types.User) (*FxAnalysis, error) {
+	if b.rdata == nil {
+		return nil, errors.New("reference data is required to determine trade currencies")
+	}
+
+	ccy = strings.ToUpper(ccy)
+	baseCcy := BaseCurrency()
+	if ccy == baseCcy {
+		return nil, fmt.Errorf("%s is the base currency", ccy)
+	}
+
+	analysis := &FxAnalysis{
+		Ccy:          ccy,
+		BaseCcy:      baseCcy,
+		Year:         year,
+		ThresholdBps: thresholdBps,
+		Months:       []FxMonth{},
+	}
+
+	months := make(map[string]*FxMonth)
+	weighted := make(map[string]float64)
+	for _, trade := range FilterTradesForUser(b.GetTrades(), user) {
+		tradeDate, err := time.Parse(time.RFC3339, trade.TradeDate)
+		if err != nil || tradeDate.Year() != year {
+			continue
+		}
+
+		tickerRef, err := b.rdata.GetTicker(trade.Ticker)
+		if err != nil || tickerRef.Ccy != ccy {
+			continue
+		}
+
+		if trade.Fx <= 0 {
+			analysis.ExcludedTrades++
+			continue
+		}
+
+		month := tradeDate.Format("2006-01")
+		if _, ok := months[month]; !ok {
+			months[month] = &FxMonth{Month: month}
+		}
+		notional := trade.Quantity * trade.Price
+		months[month].Trades++
+		months[month].Notional += notional
+		weighted[month] += notional * trade.Fx
+	}
+
+	marketRates, err := b.monthlyMarketRates(ccy, baseCcy, year)
+	if err != nil {
+		analysis.Warnings = append(analysis.Warnings, err.Error())
+	}
+
+	for month, fxMonth := range months {
+		if fxMonth.Notional != 0 {
+			fxMonth.AchievedRate = weighted[month] / fxMonth.Notional
+		}
+		if marketRate, ok := marketRates[month]; ok && marketRate != 0 {
+			fxMonth.MarketRate = marketRate
+			fxMonth.SpreadBps = (fxMonth.AchievedRate - marketRate) / marketRate * 10000
+			fxMonth.Flagged = thresholdBps > 0 && (fxMonth.SpreadBps > thresholdBps || fxMonth.SpreadBps < -thresholdBps)
+		}
+		analysis.Months = append(analysis.Months, *fxMonth)
+	}
+
+	sort.Slice(analysis.Months, func(i, j int) bool {
+		return analysis.Months[i].Month < analysis.Months[j].Month
+	})
+	return analysis, nil
+}
+
+// monthlyMarketRates returns the average daily close of the <ccy>-<base> ticker for each month of the year.
+func (b *TradeBlotter) monthlyMarketRates(ccy, baseCcy string, year int) (map[string]float64, error) {
+	if b.mdata == nil {
+		return nil, errors.New("fx history is not available, market rates are omitted")
+	}
+
+	ticker := fmt.Sprintf("%s-%s", ccy, baseCcy)
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0).Add(-time.Second)
+	history, err := b.mdata.GetHistoricalData(ticker, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fx history for %s: %w", ticker, err)
+	}
+
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, bar := range history {
+		month := time.Unix(bar.Timestamp, 0).UTC().Format("2006-01")
+		sums[month] += bar.Price
+		counts[month]++
+	}
+
+	rates := make(map[string]float64, len(sums))
+	for month, sum := range sums {
+		rates[month] = sum / float64(counts[month])
+	}
+	return rates, nil
+}
+
+// BaseCurrency returns the configured base currency of the portfolio.
+func BaseCurrency() string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.BaseCcy == "" {
+		return config.DefaultBaseCcy
+	}
+	return strings.ToUpper(cfg.BaseCcy)
+}
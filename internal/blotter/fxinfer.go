@@ -0,0 +1,194 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/pkg/types"
+)
+
+// fxInferLookback is how far before the trade date the last close of the FX rate is looked up, covering weekends and
+// holidays
+const fxInferLookback = 7 * 24 * time.Hour
+
+// InferFx returns the rate of ccy to the base currency on the date, the last close of the <ccy>-<base> ticker on or
+// before it. The base currency is 1.
+func (b *TradeBlotter) InferFx(ccy string, date time.Time) (float64, error) {
+	ccy = strings.ToUpper(ccy)
+	baseCcy := BaseCurrency()
+	if ccy == "" || ccy == baseCcy {
+		return 1, nil
+	}
+	if b.mdata == nil {
+		return 0, errors.New("fx history is not available")
+	}
+
+	ticker := fmt.Sprintf("%s-%s", ccy, baseCcy)
+	to := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 0, time.UTC)
+	history, err := b.mdata.GetHistoricalData(ticker, to.Add(-fxInferLookback).Unix(), to.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get fx history for %s: %w", ticker, err)
+	}
+
+	var rate float64
+	var rateTime int64
+	for _, bar := range history {
+		if bar.Timestamp <= to.Unix() && bar.Timestamp >= rateTime {
+			rate, rateTime = bar.Price, bar.Timestamp
+		}
+	}
+	if rateTime == 0 || rate <= 0 {
+		return 0, fmt.Errorf("no close of %s on or before %s", ticker, date.Format("2006-01-02"))
+	}
+	return rate, nil
+}
+
+// FxBackfill is the FX rate inferred for a trade entered without one.
+type FxBackfill struct {
+	TradeID   string
+	TradeDate string
+	Ticker    string
+	Trader    string
+	Ccy       string
+	Fx        float64
+}
+
+// FxBackfillReport lists the FX rates inferred for trades without one, which are written unless it is a dry run.
+type FxBackfillReport struct {
+	DryRun   bool
+	Trades   []FxBackfill
+	Warnings []string // trades whose FX rate could not be inferred
+}
+
+// BackfillFx infers the FX rate of the trades without one from the close of their trade date, for the books the user
+// may see, all books when user is nil. Trades in the base currency are set to 1. In dry run mode the proposed rates
+// are returned without changing the trades.
+func (b *TradeBlotter) BackfillFx(dryRun bool, user *types.User) (*FxBackfillReport, error) {
+	if b.rdata == nil {
+		return nil, errors.New("reference data is required to determine trade currencies")
+	}
+
+	report := &FxBackfillReport{DryRun: dryRun, Trades: []FxBackfill{}}
+	for _, trade := range b.GetTrades() {
+		if trade.Fx > 0 || (user != nil && !user.CanSeeBook(trade.Trader)) {
+			continue
+		}
+
+		tickerRef, err := b.rdata.GetTicker(trade.Ticker)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %s: no reference data", trade.TradeID, trade.Ticker))
+			continue
+		}
+		tradeDate, err := time.Parse(time.RFC3339, trade.TradeDate)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %s: invalid trade date %s", trade.TradeID, trade.Ticker, trade.TradeDate))
+			continue
+		}
+		fx, err := b.InferFx(tickerRef.Ccy, tradeDate)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %s: %v", trade.TradeID, trade.Ticker, err))
+			continue
+		}
+
+		report.Trades = append(report.Trades, FxBackfill{
+			TradeID:   trade.TradeID,
+			TradeDate: trade.TradeDate,
+			Ticker:    trade.Ticker,
+			Trader:    trade.Trader,
+			Ccy:       tickerRef.Ccy,
+			Fx:        fx,
+		})
+	}
+
+	if dryRun || len(report.Trades) == 0 {
+		return report, nil
+	}
+	return report, b.setFx(report.Trades)
+}
+
+// setFx writes the FX rates onto the trades in a single batch, all or nothing. Positions are kept in the trade
+// currency, so they are unaffected.
+func (b *TradeBlotter) setFx(backfills []FxBackfill) error {
+	trades := make([]Trade, 0, len(backfills))
+	for _, backfill := range backfills {
+		existing, err := b.GetTradeByID(backfill.TradeID)
+		if err != nil {
+			return fmt.Errorf("error updating trade %s: %w", backfill.TradeID, err)
+		}
+		if existing.Fx > 0 {
+			continue
+		}
+		trade := *existing
+		trade.Fx = backfill.Fx
+		trades = append(trades, trade)
+	}
+
+	return b.updateTrades(trades, audit.SourceMigration)
+}
+
+// AverageFx is the FX rate achieved across the buys of a currency, compared against the current rate.
+type AverageFx struct {
+	Ccy            string
+	BaseCcy        string
+	Trades         int     // buys with Fx
+	Notional       float64 // in the trade currency
+	AverageRate    float64 // notional weighted Fx of the buys
+	CurrentRate    float64 // 0 if unavailable
+	ChangePct      float64 // (current - average) / average in percent, positive when the currency appreciated
+	ExcludedTrades int     // buys in the currency without Fx
+	Warnings       []string
+}
+
+// AverageFxRate returns the notional weighted FX rate achieved across the buys in ccy of the books the user may see,
+// all books when user is nil, against the current rate of the <ccy>-<base> ticker.
+func (b *TradeBlotter) AverageFxRate(ccy string, user *types.User) (*AverageFx, error) {
+	if b.rdata == nil {
+		return nil, errors.New("reference data is required to determine trade currencies")
+	}
+
+	ccy = strings.ToUpper(ccy)
+	baseCcy := BaseCurrency()
+	if ccy == baseCcy {
+		return nil, fmt.Errorf("%s is the base currency", ccy)
+	}
+
+	average := &AverageFx{Ccy: ccy, BaseCcy: baseCcy}
+	var weighted float64
+	for _, trade := range b.GetTrades() {
+		if trade.Side != TradeSideBuy || (user != nil && !user.CanSeeBook(trade.Trader)) {
+			continue
+		}
+		tickerRef, err := b.rdata.GetTicker(trade.Ticker)
+		if err != nil || tickerRef.Ccy != ccy {
+			continue
+		}
+		if trade.Fx <= 0 {
+			average.ExcludedTrades++
+			continue
+		}
+
+		notional := trade.Quantity * trade.Price
+		average.Trades++
+		average.Notional += notional
+		weighted += notional * trade.Fx
+	}
+	if average.Notional != 0 {
+		average.AverageRate = weighted / average.Notional
+	}
+
+	if b.mdata == nil {
+		average.Warnings = append(average.Warnings, "market data is not available, current rate is omitted")
+	} else if current, err := b.mdata.GetAssetPrice(fmt.Sprintf("%s-%s", ccy, baseCcy)); err != nil {
+		average.Warnings = append(average.Warnings, fmt.Sprintf("failed to get current rate: %v", err))
+	} else {
+		average.CurrentRate = current.Price
+		if average.AverageRate != 0 {
+			average.ChangePct = (average.CurrentRate - average.AverageRate) / average.AverageRate * 100
+		}
+	}
+
+	return average, nil
+}
@@ -1,37 +1,55 @@
 package blotter
 
 import (
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"portfolio-manager/pkg/csvutil"
 	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // TradeRequest represents the request payload for a trade.
 type TradeRequest struct {
-	TradeDate string  `json:"tradeDate"`
-	Ticker    string  `json:"ticker"`
-	Side      string  `json:"side"`
-	Quantity  float64 `json:"quantity"`
-	Price     float64 `json:"price"`
-	Yield     float64 `json:"yield"`
-	Trader    string  `json:"trader"`
-	Broker    string  `json:"broker"`
-	Account   string  `json:"account"`
-	SeqNum    int     `json:"seqNum"` // Sequence number
+	TradeDate string   `json:"tradeDate"`
+	Ticker    string   `json:"ticker"`
+	Side      string   `json:"side"`
+	Quantity  float64  `json:"quantity"`
+	Notional  float64  `json:"notional"` // Alternative to quantity, the quantity is derived from the price and lot size
+	Price     float64  `json:"price"`
+	Yield     float64  `json:"yield"`
+	Trader    string   `json:"trader"`
+	Broker    string   `json:"broker"`
+	Account   string   `json:"account"`
+	Fee       float64  `json:"fee"`    // Fees and commissions paid on the trade
+	FeeCcy    string   `json:"feeCcy"` // Currency of the fee, the trade currency when empty
+	Tags      []string `json:"tags"`   // Labels of the trade, e.g. DCA or tax-loss-harvest
+	Notes     string   `json:"notes"`  // Free-text rationale of the trade
+	SeqNum    int      `json:"seqNum"` // Sequence number
+
+	AllowOddLot bool `json:"allowOddLot"` // Skip board lot validation for genuine odd-lot trades
+}
+
+// NotionalTradeResponse represents the response of a value-based trade, with the uninvested remainder.
+type NotionalTradeResponse struct {
+	Trade
+	Remainder float64 `json:"Remainder"` // Notional left uninvested after rounding down to the lot size
 }
 
 // HandleTradePost handles the addition of trades to the blotter service.
 // @Summary Add a new trade
-// @Description Add a new trade to the blotter
+// @Description Add a new trade to the blotter. When notional is given instead of quantity, the quantity is derived from the price (current market price if omitted) rounded down to the lot size, and the uninvested remainder is returned.
 // @Tags trades
 // @Accept  json
 // @Produce  json
 // @Param   trade  body  TradeRequest  true  "Trade Request"
 // @Success 201 {object} Trade
 // @Failure 400 {string} string "Invalid request payload"
+// @Failure 422 {object} UnknownTickerError "Unknown ticker, with close matches"
 // @Failure 500 {string} string "Failed to add trade"
 // @Router /api/v1/blotter/trade [post]
 func HandleTradePost(blotter *TradeBlotter) http.HandlerFunc {
@@ -43,63 +61,287 @@ func HandleTradePost(blotter *TradeBlotter) http.HandlerFunc {
 			return
 		}
 
-		tradeDate, err := time.Parse(time.RFC3339, tradeRequest.TradeDate)
-		if err != nil {
-			http.Error(w, "ERROR: Invalid trade date format", http.StatusBadRequest)
+		trade, err := newTradeFromRequest(blotter, tradeRequest)
+		var unknownTicker *UnknownTickerError
+		if errors.As(err, &unknownTicker) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(unknownTicker)
 			return
 		}
-
-		trade, err := NewTrade(
-			tradeRequest.Side,
-			tradeRequest.Quantity,
-			tradeRequest.Ticker,
-			tradeRequest.Trader,
-			tradeRequest.Broker,
-			tradeRequest.Account,
-			tradeRequest.Price,
-			tradeRequest.Yield,
-			tradeDate)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
 			return
 		}
 
-		err = blotter.AddTrade(*trade)
+		if err := AuthorizeTrades([]*Trade{trade}, types.UserFromContext(r.Context())); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusForbidden)
+			return
+		}
+
+		err = blotter.AddTradeWithContext(r.Context(), *trade)
 		if err != nil {
-			logging.GetLogger().Error("Failed to add trade", err)
+			logging.FromContext(r.Context()).Error("Failed to add trade", err)
 			http.Error(w, "ERROR: Failed to add trade", http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
+		if tradeRequest.Notional > 0 {
+			json.NewEncoder(w).Encode(NotionalTradeResponse{
+				Trade:     *trade,
+				Remainder: trade.Notional - trade.Quantity*trade.Price,
+			})
+			return
+		}
 		json.NewEncoder(w).Encode(trade)
 	}
 }
 
+// OrderRequest represents the request payload for an order filled across multiple executions.
+type OrderRequest struct {
+	OrderID string         `json:"orderId"` // Optional, generated when empty
+	Fills   []TradeRequest `json:"fills"`
+}
+
+// OrderResponse reports the OrderID stamped on the fills added, and the fills skipped as duplicates.
+type OrderResponse struct {
+	OrderID string `json:"orderId"` // empty when every fill is skipped
+	ImportResult
+}
+
+// HandleOrderPost handles the addition of an order's fills to the blotter service.
+// @Summary Add an order with partial fills
+// @Description Add the fills of a single order to the blotter, stamping them with the same OrderID. Duplicate lines are the fills' positions in the order, counting from 1.
+// @Tags trades
+// @Accept  json
+// @Produce  json
+// @Param   order  body  OrderRequest  true  "Order Request"
+// @Param   duplicates  query  string  false  "Fills duplicating trades in the blotter by ticker, side, date, quantity, price and book: import-anyway (default), skip or fail"
+// @Success 201 {object} OrderResponse
+// @Success 200 {object} OrderResponse "Every fill skipped as a duplicate"
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Book not allowed"
+// @Failure 409 {string} string "Duplicate fills with the fail policy"
+// @Router /api/v1/blotter/order [post]
+func HandleOrderPost(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var orderRequest OrderRequest
+		err := json.NewDecoder(r.Body).Decode(&orderRequest)
+		if err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		fills := make([]*Trade, 0, len(orderRequest.Fills))
+		for i, fillRequest := range orderRequest.Fills {
+			fill, err := newTradeFromRequest(blotter, fillRequest)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("ERROR: fill %d: %s", i+1, err.Error()), http.StatusBadRequest)
+				return
+			}
+			fills = append(fills, fill)
+		}
+
+		duplicates, err := ParseDuplicatePolicy(r.URL.Query().Get("duplicates"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if err := AuthorizeTrades(fills, types.UserFromContext(r.Context())); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusForbidden)
+			return
+		}
+
+		fills, result, err := blotter.handleDuplicates(fills, duplicates)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), importErrorStatus(err))
+			return
+		}
+
+		response := OrderResponse{ImportResult: result}
+		w.Header().Set("Content-Type", "application/json")
+		if len(fills) == 0 && result.Skipped > 0 {
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response.OrderID, err = blotter.AddOrder(orderRequest.OrderID, derefTrades(fills))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		response.Imported = len(fills)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// newTradeFromRequest creates and validates a trade from the request payload.
+func newTradeFromRequest(blotter *TradeBlotter, tradeRequest TradeRequest) (*Trade, error) {
+	tradeDate, err := time.Parse(time.RFC3339, tradeRequest.TradeDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trade date format")
+	}
+
+	if err := blotter.CheckTicker(tradeRequest.Ticker); err != nil {
+		return nil, err
+	}
+
+	if tradeRequest.Notional < 0 {
+		return nil, fmt.Errorf("notional must be positive")
+	}
+	if tradeRequest.Fee < 0 {
+		return nil, fmt.Errorf("fee must not be negative")
+	}
+	if tradeRequest.Notional > 0 {
+		quantity, price, _, err := blotter.QuantityForNotional(tradeRequest.Ticker, tradeRequest.Notional, tradeRequest.Price)
+		if err != nil {
+			return nil, err
+		}
+		if tradeRequest.Quantity != 0 && tradeRequest.Quantity != quantity {
+			return nil, fmt.Errorf("quantity %v is inconsistent with notional %v, which buys %v at %v", tradeRequest.Quantity, tradeRequest.Notional, quantity, price)
+		}
+		tradeRequest.Quantity = quantity
+		tradeRequest.Price = price
+	}
+
+	trade, err := NewTrade(
+		tradeRequest.Side,
+		tradeRequest.Quantity,
+		tradeRequest.Ticker,
+		tradeRequest.Trader,
+		tradeRequest.Broker,
+		tradeRequest.Account,
+		tradeRequest.Price,
+		tradeRequest.Yield,
+		tradeDate)
+	if err != nil {
+		return nil, err
+	}
+	trade.Notional = tradeRequest.Notional
+	trade.Fee = tradeRequest.Fee
+	trade.FeeCcy = strings.ToUpper(tradeRequest.FeeCcy)
+	trade.Tags = NormalizeTags(tradeRequest.Tags)
+	trade.Notes = tradeRequest.Notes
+	if err := validateTags(trade.Tags); err != nil {
+		return nil, err
+	}
+
+	err = blotter.CheckLotSize(*trade, tradeRequest.AllowOddLot)
+	if err != nil {
+		return nil, err
+	}
+
+	return trade, nil
+}
+
+// derefTrades returns copies of the trades.
+func derefTrades(trades []*Trade) []Trade {
+	copies := make([]Trade, 0, len(trades))
+	for _, trade := range trades {
+		copies = append(copies, *trade)
+	}
+	return copies
+}
+
+// importErrorStatus returns the status code of a failed import, forbidden for books the user may not trade in and
+// conflict for duplicate trades rejected by the fail policy.
+func importErrorStatus(err error) int {
+	if errors.Is(err, ErrBookNotAllowed) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, ErrDuplicateTrades) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// AuthorizeBook returns whether the user of the request, if any, may see the book (trader), rejecting the request
+// otherwise.
+func AuthorizeBook(w http.ResponseWriter, r *http.Request, book string) bool {
+	if user := types.UserFromContext(r.Context()); user != nil && !user.CanSeeBook(book) {
+		http.Error(w, fmt.Sprintf("ERROR: %s: user %s may not see book %s", ErrBookNotAllowed, user.Name, book), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// AuthorizeBooks returns the books of the request, defaulting to the books of a non-admin user, rejecting the request
+// when the user may not see any of them. All books are allowed when authentication is disabled.
+func AuthorizeBooks(w http.ResponseWriter, r *http.Request, books []string) ([]string, bool) {
+	user := types.UserFromContext(r.Context())
+	if user == nil || user.Admin {
+		return books, true
+	}
+
+	if len(books) == 0 {
+		books = user.Books
+	}
+	for _, book := range books {
+		if !AuthorizeBook(w, r, book) {
+			return nil, false
+		}
+	}
+	if len(books) == 0 {
+		http.Error(w, fmt.Sprintf("ERROR: user %s has no books", user.Name), http.StatusForbidden)
+		return nil, false
+	}
+	return books, true
+}
+
 // HandleTradeGet handles retrieving trades from the blotter service.
 // @Summary Get all trades
-// @Description Retrieve all trades from the blotter
+// @Description Retrieve all trades from the blotter in the books of the API key's user, optionally those with a tag, and optionally collapsing partial fills into orders
 // @Tags trades
 // @Produce  json
+// @Param   view  query  string  false  "trades (default) or orders"
+// @Param   tag   query  string  false  "Tag of the trades, case-insensitive"
+// @Param   saved_view  query  string  false  "Saved view of the books, asset classes and tag of the trades, see /api/v1/blotter/saved-views"
 // @Success 200 {array} Trade
+// @Failure 400 {string} string "Unsupported view"
+// @Failure 404 {string} string "Saved view not found"
 // @Router /api/v1/blotter/trade [get]
 func HandleTradeGet(blotter *TradeBlotter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		trades := blotter.GetTrades()
+		saved, ok := SavedViewFromQuery(w, r, blotter)
+		if !ok {
+			return
+		}
+
+		var trades []Trade
+		var err error
+		if saved == nil {
+			trades, err = blotter.GetTradesByViewAndTag(r.URL.Query().Get("view"), r.URL.Query().Get("tag"))
+		} else {
+			trades, err = blotter.GetTradesInView(r.URL.Query().Get("view"), saved, r.URL.Query().Get("tag"))
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(trades)
+		json.NewEncoder(w).Encode(FilterTradesForUser(trades, types.UserFromContext(r.Context())))
 	}
 }
 
 // HandleTradeImportCSV handles importing trades from a CSV file
 // @Summary Import trades from CSV
-// @Description Import trades from a CSV file
+// @Description Import trades from a CSV file. An import profile, e.g. moomoo, maps the columns of a broker's export onto the trade fields, see /api/v1/blotter/import/profiles.
 // @Tags trades
 // @Accept  multipart/form-data
 // @Produce  json
 // @Param   file  formData  file  true  "CSV file"
-// @Success 200 {string} string "OK"
+// @Param   profile  query  string  false  "Format profile (default, eu) or import profile (e.g. dbsvickers, moomoo, tiger)"
+// @Param   dateFormat  query  string  false  "Date format, e.g. DD/MM/YYYY"
+// @Param   decimalSeparator  query  string  false  "Decimal separator (. or ,)"
+// @Param   delimiter  query  string  false  "Field delimiter"
+// @Param   duplicates  query  string  false  "Trades duplicating those in the blotter by ticker, side, date, quantity, price and book: import-anyway (default), skip or fail"
+// @Success 200 {object} ImportResult
 // @Failure 400 {string} string "Failed to get file from request"
+// @Failure 409 {string} string "Duplicate trades with the fail policy"
 // @Failure 500 {string} string "Failed to import trades"
 // @Router /api/v1/blotter/import [post]
 func HandleTradeImportCSV(blotter *TradeBlotter) http.HandlerFunc {
@@ -111,28 +353,341 @@ func HandleTradeImportCSV(blotter *TradeBlotter) http.HandlerFunc {
 		}
 		defer file.Close()
 
-		reader := csv.NewReader(file)
-		err = blotter.ImportFromCSVReader(reader)
+		query := r.URL.Query()
+		var profile *ImportProfile
+		switch name := strings.ToLower(query.Get("profile")); name {
+		case "", csvutil.ProfileDefault, csvutil.ProfileEU:
+		default:
+			importProfile, err := blotter.GetImportProfile(name)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+				return
+			}
+			profile = &importProfile
+			query.Del("profile")
+		}
+
+		format, err := csvutil.ParseFormatOptions(query)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		opts := ImportOptions{Format: format, Profile: profile, Duplicates: query.Get("duplicates")}
+		result, err := blotter.ImportCSV(format.NewReader(file), opts, types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), importErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// HandleImportProfilesGet handles listing the import profiles.
+// @Summary Get the import profiles
+// @Description Get the built-in and saved profiles mapping the columns of broker CSV exports onto the trade fields
+// @Tags trades
+// @Produce  json
+// @Success 200 {array} ImportProfile
+// @Failure 500 {string} string "Failed to get import profiles"
+// @Router /api/v1/blotter/import/profiles [get]
+func HandleImportProfilesGet(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profiles, err := blotter.GetImportProfiles()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profiles)
+	}
+}
+
+// HandleImportProfilePut handles saving an import profile.
+// @Summary Save an import profile
+// @Description Save a profile mapping the columns of a broker's CSV export onto the trade fields, named as the columns of the trades CSV. A profile saved under the name of a built-in profile takes precedence over it.
+// @Tags trades
+// @Accept  json
+// @Produce  json
+// @Param   name  path  string  true  "Profile name, e.g. moomoo"
+// @Param   profile  body  ImportProfile  true  "Column mapping, date format, side values and defaults"
+// @Success 200 {object} ImportProfile
+// @Failure 400 {string} string "Invalid import profile"
+// @Router /api/v1/blotter/import/profiles/{name} [put]
+func HandleImportProfilePut(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var profile ImportProfile
+		if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		profile.Name = importProfileNameFromPath(r)
+
+		profile, err := blotter.SaveImportProfile(profile)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	}
+}
+
+// HandleImportProfileDelete handles deleting a saved import profile.
+// @Summary Delete an import profile
+// @Description Delete a saved import profile, a built-in profile of the same name applies again
+// @Tags trades
+// @Param   name  path  string  true  "Profile name"
+// @Success 204
+// @Failure 404 {string} string "Import profile not found"
+// @Router /api/v1/blotter/import/profiles/{name} [delete]
+func HandleImportProfileDelete(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := blotter.DeleteImportProfile(importProfileNameFromPath(r)); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// importProfileNameFromPath returns the profile name of /api/v1/blotter/import/profiles/{name}.
+func importProfileNameFromPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/api/v1/blotter/import/profiles/")
+}
+
+// HandleSavedViewsGet handles listing the saved views.
+// @Summary Get the saved views
+// @Description Get the named views of books, asset classes and a tag, applied with the saved_view parameter of the trades, IRR, TWR and breakdown
+// @Tags trades
+// @Produce  json
+// @Success 200 {array} SavedView
+// @Failure 500 {string} string "Failed to get saved views"
+// @Router /api/v1/blotter/saved-views [get]
+func HandleSavedViewsGet(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		views, err := blotter.GetSavedViews()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(views)
+	}
+}
+
+// HandleSavedViewGet handles retrieving a saved view.
+// @Summary Get a saved view
+// @Description Get the books, asset classes and tag of a saved view
+// @Tags trades
+// @Produce  json
+// @Param   name  path  string  true  "View name, e.g. retirement"
+// @Success 200 {object} SavedView
+// @Failure 404 {string} string "Saved view not found"
+// @Router /api/v1/blotter/saved-views/{name} [get]
+func HandleSavedViewGet(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		view, err := blotter.GetSavedView(savedViewNameFromPath(r))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+	}
+}
+
+// HandleSavedViewPut handles saving a view.
+// @Summary Save a view
+// @Description Save a named view of books, asset classes to include or exclude and a tag, replacing a view of the same name. Empty books and included asset classes mean all of them. A view narrows the books of the API key's user, never widens them.
+// @Tags trades
+// @Accept  json
+// @Produce  json
+// @Param   name  path  string  true  "View name, e.g. retirement"
+// @Param   view  body  SavedView  true  "Books, asset classes and tag"
+// @Success 200 {object} SavedView
+// @Failure 400 {string} string "Invalid saved view"
+// @Router /api/v1/blotter/saved-views/{name} [put]
+func HandleSavedViewPut(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var view SavedView
+		if err := json.NewDecoder(r.Body).Decode(&view); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		view.Name = savedViewNameFromPath(r)
+
+		view, err := blotter.SaveSavedView(view)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+	}
+}
+
+// HandleSavedViewDelete handles deleting a saved view.
+// @Summary Delete a saved view
+// @Description Delete a saved view
+// @Tags trades
+// @Param   name  path  string  true  "View name"
+// @Success 204
+// @Failure 404 {string} string "Saved view not found"
+// @Router /api/v1/blotter/saved-views/{name} [delete]
+func HandleSavedViewDelete(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := blotter.DeleteSavedView(savedViewNameFromPath(r)); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// savedViewNameFromPath returns the view name of /api/v1/blotter/saved-views/{name}.
+func savedViewNameFromPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/api/v1/blotter/saved-views/")
+}
 
-		w.WriteHeader(http.StatusOK)
+// SavedViewFromQuery returns the saved view named by the saved_view query parameter, nil when there is none. It
+// writes a 404 and returns false when no view has the name.
+func SavedViewFromQuery(w http.ResponseWriter, r *http.Request, blotter *TradeBlotter) (*SavedView, bool) {
+	name := r.URL.Query().Get("saved_view")
+	if name == "" {
+		return nil, true
+	}
+
+	view, err := blotter.GetSavedView(name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+		return nil, false
+	}
+	return view, true
+}
+
+// HandleTradeImportIbkr handles importing trades from an IBKR Flex Query export
+// @Summary Import trades from an IBKR Flex Query
+// @Description Import trades from an IBKR Flex Query XML or CSV export. Commissions are folded into the trade price.
+// @Tags trades
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param   file  formData  file  true  "Flex Query XML or CSV file"
+// @Param   dryRun  query  bool  false  "Return the parsed trades without committing them"
+// @Param   duplicates  query  string  false  "Trades duplicating those in the blotter by ticker, side, date, quantity, price and book: import-anyway (default), skip or fail"
+// @Success 200 {array} Trade
+// @Failure 409 {string} string "Duplicate trades with the fail policy"
+// @Failure 400 {string} string "Failed to get file from request"
+// @Router /api/v1/blotter/import/ibkr [post]
+func HandleTradeImportIbkr(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "ERROR: Failed to get file from request", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+		trades, err := blotter.ImportFromIbkrFlexQuery(file, dryRun, r.URL.Query().Get("duplicates"), types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), importErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(trades)
+	}
+}
+
+// RestoreTradesRequest represents the request payload restoring trades from the recycle bin.
+type RestoreTradesRequest struct {
+	TradeIDs []string `json:"tradeIds"`
+}
+
+// HandleTrashGet handles listing the trades in the recycle bin.
+// @Summary Get the recycle bin
+// @Description Get the trades removed from the books of the API key's user, most recently removed first, which are kept until purged after trashRetentionDays
+// @Tags trades
+// @Produce  json
+// @Success 200 {array} TrashedTrade
+// @Failure 500 {string} string "Failed to get the recycle bin"
+// @Router /api/v1/blotter/trash [get]
+func HandleTrashGet(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trash, err := blotter.GetTrash()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if user := types.UserFromContext(r.Context()); user != nil {
+			visible := make([]TrashedTrade, 0, len(trash))
+			for _, trashed := range trash {
+				if user.CanSeeBook(trashed.Trade.Trader) {
+					visible = append(visible, trashed)
+				}
+			}
+			trash = visible
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(trash)
+	}
+}
+
+// HandleTrashRestore handles restoring trades from the recycle bin.
+// @Summary Restore trades from the recycle bin
+// @Description Move trades back from the recycle bin into the blotter with their original trade IDs and sequence numbers. Nothing is restored when any trade is missing from the recycle bin.
+// @Tags trades
+// @Accept  json
+// @Produce  json
+// @Param   request  body  RestoreTradesRequest  true  "Trade IDs to restore"
+// @Success 200 {array} Trade
+// @Failure 400 {string} string "Trade not in the recycle bin"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/blotter/trash/restore [post]
+func HandleTrashRestore(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request RestoreTradesRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.TradeIDs) == 0 {
+			http.Error(w, "ERROR: Invalid request payload, tradeIds are required", http.StatusBadRequest)
+			return
+		}
+
+		trades, err := blotter.RestoreTrades(request.TradeIDs, types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), importErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(trades)
 	}
 }
 
 // HandleTradeExportCSV handles exporting trades to a CSV file
 // @Summary Export trades to CSV
-// @Description Export all trades to a CSV file
+// @Description Export all trades in the books of the API key's user to a CSV file
 // @Tags trades
 // @Produce  text/csv
+// @Param   profile  query  string  false  "Format profile (default, eu)"
+// @Param   dateFormat  query  string  false  "Date format, e.g. DD/MM/YYYY"
+// @Param   decimalSeparator  query  string  false  "Decimal separator (. or ,)"
+// @Param   delimiter  query  string  false  "Field delimiter"
+// @Param   view  query  string  false  "trades (default) or orders"
 // @Success 200 {file} file "trades.csv"
+// @Failure 400 {string} string "Invalid format options"
 // @Failure 500 {string} string "Failed to export trades"
 // @Router /api/v1/blotter/export [get]
 func HandleTradeExportCSV(blotter *TradeBlotter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		trades, err := blotter.ExportToCSVBytes()
+		format, err := csvutil.ParseFormatOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		trades, err := blotter.ExportToCSVBytesByViewForUser(r.URL.Query().Get("view"), format, types.UserFromContext(r.Context()))
 		if err != nil {
 			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
 			return
@@ -145,6 +700,144 @@ func HandleTradeExportCSV(blotter *TradeBlotter) http.HandlerFunc {
 	}
 }
 
+// HandleFxAnalysis handles the analysis of achieved versus market FX rates.
+// @Summary Analyze achieved FX rates
+// @Description Compare the notional weighted FX rate achieved on trades in a currency, in the books of the API key's user, per month against the month's average market rate
+// @Tags trades
+// @Produce  json
+// @Param   ccy  query  string  true  "Trade currency, e.g. USD"
+// @Param   year  query  int  true  "Year, e.g. 2024"
+// @Param   thresholdBps  query  number  false  "Flag months with a spread beyond this many basis points, defaults to 50"
+// @Success 200 {object} FxAnalysis
+// @Failure 400 {string} string "Invalid query parameters"
+// @Router /api/v1/blotter/fx-analysis [get]
+func HandleFxAnalysis(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		ccy := query.Get("ccy")
+		if ccy == "" {
+			http.Error(w, "ERROR: ccy is required", http.StatusBadRequest)
+			return
+		}
+
+		year, err := strconv.Atoi(query.Get("year"))
+		if err != nil {
+			http.Error(w, "ERROR: year must be a number, e.g. 2024", http.StatusBadRequest)
+			return
+		}
+
+		thresholdBps := DefaultFxSpreadThresholdBps
+		if threshold := query.Get("thresholdBps"); threshold != "" {
+			thresholdBps, err = strconv.ParseFloat(threshold, 64)
+			if err != nil {
+				http.Error(w, "ERROR: thresholdBps must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		analysis, err := blotter.AnalyzeFx(ccy, year, thresholdBps, types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(analysis)
+	}
+}
+
+// HandleFxInfer handles inferring the FX rate of a currency on a trade date.
+// @Summary Infer the FX rate on a date
+// @Description Infer the rate of a currency to the base currency on a trade date from the last close on or before it, e.g. for trades entered without Fx
+// @Tags fx
+// @Produce  json
+// @Param   ccy  query  string  true  "Trade currency, e.g. USD"
+// @Param   date  query  string  true  "Trade date (YYYY-MM-DD)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Invalid query parameters"
+// @Failure 404 {string} string "No FX rate on or before the date"
+// @Router /api/v1/fx/infer [get]
+func HandleFxInfer(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		ccy := query.Get("ccy")
+		if ccy == "" {
+			http.Error(w, "ERROR: ccy is required", http.StatusBadRequest)
+			return
+		}
+		date, err := time.Parse("2006-01-02", query.Get("date"))
+		if err != nil {
+			http.Error(w, "ERROR: date must be in the format YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+
+		fx, err := blotter.InferFx(ccy, date)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ccy":     strings.ToUpper(ccy),
+			"baseCcy": BaseCurrency(),
+			"date":    date.Format("2006-01-02"),
+			"fx":      fx,
+		})
+	}
+}
+
+// HandleFxBackfill handles backfilling the FX rate of trades entered without one.
+// @Summary Backfill missing FX rates
+// @Description Infer the FX rate of trades without one from the close of their trade date and write it onto the trades, or only list the proposed rates in dry run mode
+// @Tags fx
+// @Produce  json
+// @Param   dryRun  query  bool  false  "List the proposed rates without changing the trades"
+// @Success 200 {object} FxBackfillReport
+// @Failure 400 {string} string "Failed to backfill"
+// @Router /api/v1/fx/backfill [post]
+func HandleFxBackfill(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+		report, err := blotter.BackfillFx(dryRun, types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleFxAverage handles the average FX rate achieved across the buys of a currency.
+// @Summary Get the average FX rate achieved
+// @Description Get the notional weighted FX rate achieved across all buys of a currency, compared against the current rate
+// @Tags fx
+// @Produce  json
+// @Param   ccy  query  string  true  "Trade currency, e.g. USD"
+// @Success 200 {object} AverageFx
+// @Failure 400 {string} string "Invalid query parameters"
+// @Router /api/v1/fx/average [get]
+func HandleFxAverage(blotter *TradeBlotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ccy := r.URL.Query().Get("ccy")
+		if ccy == "" {
+			http.Error(w, "ERROR: ccy is required", http.StatusBadRequest)
+			return
+		}
+
+		average, err := blotter.AverageFxRate(ccy, types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(average)
+	}
+}
+
 // RegisterHandlers registers the handlers for the blotter service.
 func RegisterHandlers(mux *http.ServeMux, blotter *TradeBlotter) {
 	mux.HandleFunc("/api/v1/blotter/trade", func(w http.ResponseWriter, r *http.Request) {
@@ -158,6 +851,14 @@ func RegisterHandlers(mux *http.ServeMux, blotter *TradeBlotter) {
 		}
 	})
 
+	mux.HandleFunc("/api/v1/blotter/order", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleOrderPost(blotter).ServeHTTP(w, r)
+	})
+
 	mux.HandleFunc("/api/v1/blotter/import", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
@@ -166,6 +867,54 @@ func RegisterHandlers(mux *http.ServeMux, blotter *TradeBlotter) {
 		HandleTradeImportCSV(blotter).ServeHTTP(w, r)
 	})
 
+	mux.HandleFunc("/api/v1/blotter/import/profiles", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleImportProfilesGet(blotter).ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/blotter/import/profiles/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			HandleImportProfilePut(blotter).ServeHTTP(w, r)
+		case http.MethodDelete:
+			HandleImportProfileDelete(blotter).ServeHTTP(w, r)
+		default:
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/blotter/saved-views", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleSavedViewsGet(blotter).ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/blotter/saved-views/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleSavedViewGet(blotter).ServeHTTP(w, r)
+		case http.MethodPut:
+			HandleSavedViewPut(blotter).ServeHTTP(w, r)
+		case http.MethodDelete:
+			HandleSavedViewDelete(blotter).ServeHTTP(w, r)
+		default:
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/blotter/import/ibkr", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleTradeImportIbkr(blotter).ServeHTTP(w, r)
+	})
+
 	mux.HandleFunc("/api/v1/blotter/export", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
@@ -173,4 +922,52 @@ func RegisterHandlers(mux *http.ServeMux, blotter *TradeBlotter) {
 		}
 		HandleTradeExportCSV(blotter).ServeHTTP(w, r)
 	})
+
+	mux.HandleFunc("/api/v1/blotter/trash", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleTrashGet(blotter).ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/blotter/trash/restore", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleTrashRestore(blotter).ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/blotter/fx-analysis", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleFxAnalysis(blotter).ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/fx/infer", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleFxInfer(blotter).ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/fx/backfill", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleFxBackfill(blotter).ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/fx/average", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "ERROR: Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		HandleFxAverage(blotter).ServeHTTP(w, r)
+	})
 }
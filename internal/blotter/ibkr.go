@@ -0,0 +1,261 @@
+package blotter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IbkrBroker is the default broker assigned to trades imported from Interactive Brokers.
+const IbkrBroker = "IBKR"
+
+// ibkrFill represents a single execution from an IBKR Flex Query trades section.
+type ibkrFill struct {
+	AccountID    string  `xml:"accountId,attr"`
+	Symbol       string  `xml:"symbol,attr"`
+	TradeDate    string  `xml:"tradeDate,attr"`
+	BuySell      string  `xml:"buySell,attr"`
+	Quantity     float64 `xml:"quantity,attr"`
+	TradePrice   float64 `xml:"tradePrice,attr"`
+	IBCommission float64 `xml:"ibCommission,attr"`
+	FxRateToBase float64 `xml:"fxRateToBase,attr"`
+}
+
+// ibkrFlexQueryResponse is the XML document returned by an IBKR Flex Query.
+type ibkrFlexQueryResponse struct {
+	Statements []struct {
+		Trades []ibkrFill `xml:"Trades>Trade"`
+	} `xml:"FlexStatements>FlexStatement"`
+}
+
+// ibkrCsvColumns maps the IBKR Flex Query CSV headers onto the fill fields.
+var ibkrCsvColumns = map[string]func(fill *ibkrFill, value string) error{
+	"ClientAccountID": func(fill *ibkrFill, value string) error { fill.AccountID = value; return nil },
+	"Symbol":          func(fill *ibkrFill, value string) error { fill.Symbol = value; return nil },
+	"TradeDate":       func(fill *ibkrFill, value string) error { fill.TradeDate = value; return nil },
+	"Buy/Sell":        func(fill *ibkrFill, value string) error { fill.BuySell = value; return nil },
+	"Quantity":        func(fill *ibkrFill, value string) error { return parseIbkrFloat(value, &fill.Quantity) },
+	"TradePrice":      func(fill *ibkrFill, value string) error { return parseIbkrFloat(value, &fill.TradePrice) },
+	"IBCommission":    func(fill *ibkrFill, value string) error { return parseIbkrFloat(value, &fill.IBCommission) },
+	"FXRateToBase":    func(fill *ibkrFill, value string) error { return parseIbkrFloat(value, &fill.FxRateToBase) },
+}
+
+// ParseIbkrFlexQuery parses an IBKR Flex Query trades export, in either XML or CSV format, into trades.
+// Commissions are recorded as trade fees and accounts are mapped to trader, broker and account via config.
+func ParseIbkrFlexQuery(r io.Reader) ([]*Trade, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading flex query: %w", err)
+	}
+
+	var fills []ibkrFill
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		fills, err = parseIbkrXml(data)
+	} else {
+		fills, err = parseIbkrCsv(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts map[string]config.IbkrAccount
+	if cfg, err := config.GetOrCreateConfig(""); err == nil && cfg != nil {
+		accounts = cfg.IbkrAccounts
+	}
+
+	trades := make([]*Trade, 0, len(fills))
+	for i, fill := range fills {
+		trade, err := fill.toTrade(accounts)
+		if err != nil {
+			return nil, fmt.Errorf("error creating trade from fill %d: %w", i+1, err)
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, nil
+}
+
+// ImportFromIbkrFlexQuery parses an IBKR Flex Query export and adds the trades to the blotter, handling trades
+// duplicating those in the blotter with the duplicate policy, see ImportCSV. The trades added are returned.
+// Tickers and board lots are validated as in ImportCSV, unknown tickers are reported for all fills at once, and nothing
+// is imported when any trade is invalid. When dryRun is set, the validated trades are returned without being committed.
+func (b *TradeBlotter) ImportFromIbkrFlexQuery(r io.Reader, dryRun bool, duplicates string, user *types.User) ([]*Trade, error) {
+	logging.GetLogger().Info("Importing trades from IBKR flex query")
+
+	trades, err := ParseIbkrFlexQuery(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknownTickers []error
+	for i, trade := range trades {
+		if err := b.CheckTicker(trade.Ticker); err != nil {
+			unknownTickers = append(unknownTickers, fmt.Errorf("fill %d: %w", i+1, err))
+		}
+		if err := b.CheckLotSize(*trade, false); err != nil {
+			return nil, fmt.Errorf("invalid quantity of fill %d: %w", i+1, err)
+		}
+	}
+	if len(unknownTickers) > 0 {
+		return nil, fmt.Errorf("invalid tickers: %w", errors.Join(unknownTickers...))
+	}
+
+	if dryRun {
+		return trades, nil
+	}
+
+	duplicates, err = ParseDuplicatePolicy(duplicates)
+	if err != nil {
+		return nil, err
+	}
+	trades, _, err = b.handleDuplicates(trades, duplicates)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.addTrades(trades, user); err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+func parseIbkrXml(data []byte) ([]ibkrFill, error) {
+	var response ibkrFlexQueryResponse
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("invalid flex query xml: %w", err)
+	}
+
+	var fills []ibkrFill
+	for _, statement := range response.Statements {
+		fills = append(fills, statement.Trades...)
+	}
+	return fills, nil
+}
+
+func parseIbkrCsv(data []byte) ([]ibkrFill, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	for _, required := range []string{"Symbol", "TradeDate", "Quantity", "TradePrice"} {
+		found := false
+		for _, h := range header {
+			if h == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid flex query CSV: missing %s column", required)
+		}
+	}
+
+	var fills []ibkrFill
+	lineNum := 1
+	for {
+		row, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("error reading CSV line %d: %w", lineNum, err)
+		}
+
+		// flex queries repeat the header row for every statement
+		if len(row) > 0 && row[0] == header[0] {
+			continue
+		}
+
+		var fill ibkrFill
+		for i, h := range header {
+			setter, ok := ibkrCsvColumns[h]
+			if !ok || i >= len(row) {
+				continue
+			}
+			if err := setter(&fill, row[i]); err != nil {
+				return nil, fmt.Errorf("invalid %s at line %d: %w", h, lineNum, err)
+			}
+		}
+
+		fills = append(fills, fill)
+		lineNum++
+	}
+
+	return fills, nil
+}
+
+func parseIbkrFloat(value string, f *float64) error {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+	if value == "" {
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*f = v
+	return nil
+}
+
+// toTrade converts the fill into a trade, recording the commission as its fee in the trade currency.
+func (fill ibkrFill) toTrade(accounts map[string]config.IbkrAccount) (*Trade, error) {
+	side := TradeSideBuy
+	if strings.EqualFold(fill.BuySell, "SELL") || (fill.BuySell == "" && fill.Quantity < 0) {
+		side = TradeSideSell
+	}
+
+	qty := math.Abs(fill.Quantity)
+	if qty == 0 {
+		return nil, errors.New("quantity is required")
+	}
+
+	tradeDate, err := parseIbkrDate(fill.TradeDate)
+	if err != nil {
+		return nil, err
+	}
+
+	account, ok := accounts[fill.AccountID]
+	if !ok {
+		account = config.IbkrAccount{Trader: fill.AccountID, Broker: IbkrBroker, Account: fill.AccountID}
+	}
+
+	trade, err := NewTrade(side, qty, strings.ToUpper(fill.Symbol), account.Trader, account.Broker, account.Account, fill.TradePrice, 0, tradeDate)
+	if err != nil {
+		return nil, err
+	}
+	trade.Fx = fill.FxRateToBase
+	trade.Fee = math.Abs(fill.IBCommission) // reported as a negative amount
+
+	return trade, nil
+}
+
+// parseIbkrDate parses the trade date formats used by flex queries, e.g. 20240115 or 2024-01-15.
+func parseIbkrDate(date string) (time.Time, error) {
+	date = strings.TrimSpace(date)
+	if idx := strings.IndexAny(date, ";, "); idx > 0 {
+		date = date[:idx] // strip time component, e.g. 20240115;093000
+	}
+
+	for _, layout := range []string{"20060102", "2006-01-02"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid trade date %q", date)
+}
@@ -0,0 +1,109 @@
+package blotter_test
+
+import (
+	"strings"
+	"testing"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/rdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ibkrFlexQueryXml = `<FlexQueryResponse queryName="trades" type="AF">
+<FlexStatements count="1">
+<FlexStatement accountId="U1234567" fromDate="20240101" toDate="20240131">
+<Trades>
+<Trade accountId="U1234567" currency="USD" fxRateToBase="1.34" symbol="AAPL" tradeDate="20240115" quantity="10" tradePrice="185.5" ibCommission="-1" buySell="BUY" />
+<Trade accountId="U1234567" currency="USD" fxRateToBase="1.35" symbol="MSFT" tradeDate="20240116" quantity="-5" tradePrice="390" ibCommission="-2.5" buySell="SELL" />
+</Trades>
+</FlexStatement>
+</FlexStatements>
+</FlexQueryResponse>`
+
+const ibkrFlexQueryCsv = `"ClientAccountID","Symbol","TradeDate","Quantity","TradePrice","IBCommission","Buy/Sell","FXRateToBase"
+"U7654321","AAPL","20240115","10","185.5","-1","BUY","1.34"
+"U7654321","MSFT","2024-01-16","-5","390","-2.5","SELL","1.35"
+`
+
+func TestParseIbkrFlexQueryXml(t *testing.T) {
+	config.SetConfig(&config.Config{IbkrAccounts: map[string]config.IbkrAccount{
+		"U1234567": {Trader: "traderA", Broker: "ibkr", Account: "margin"},
+	}})
+	defer config.SetConfig(nil)
+
+	trades, err := blotter.ParseIbkrFlexQuery(strings.NewReader(ibkrFlexQueryXml))
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+
+	assert.Equal(t, "AAPL", trades[0].Ticker)
+	assert.Equal(t, blotter.TradeSideBuy, trades[0].Side)
+	assert.Equal(t, 10.0, trades[0].Quantity)
+	assert.Equal(t, 185.5, trades[0].Price)
+	assert.Equal(t, 1.0, trades[0].Fee) // commission recorded as the fee
+	assert.Equal(t, 1.34, trades[0].Fx)
+	assert.Equal(t, "traderA", trades[0].Trader)
+	assert.Equal(t, "ibkr", trades[0].Broker)
+	assert.Equal(t, "margin", trades[0].Account)
+	assert.Equal(t, "2024-01-15T00:00:00Z", trades[0].TradeDate)
+
+	assert.Equal(t, blotter.TradeSideSell, trades[1].Side)
+	assert.Equal(t, 5.0, trades[1].Quantity)
+	assert.Equal(t, 390.0, trades[1].Price)
+	assert.Equal(t, 2.5, trades[1].Fee)
+}
+
+func TestParseIbkrFlexQueryCsv(t *testing.T) {
+	trades, err := blotter.ParseIbkrFlexQuery(strings.NewReader(ibkrFlexQueryCsv))
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+
+	// unmapped accounts fall back to the IBKR account id
+	assert.Equal(t, "U7654321", trades[0].Trader)
+	assert.Equal(t, blotter.IbkrBroker, trades[0].Broker)
+	assert.Equal(t, "U7654321", trades[0].Account)
+	assert.Equal(t, "2024-01-16T00:00:00Z", trades[1].TradeDate)
+	assert.Equal(t, blotter.TradeSideSell, trades[1].Side)
+}
+
+func TestImportFromIbkrFlexQueryDryRun(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	blotterSvc := blotter.NewBlotter(db)
+
+	trades, err := blotterSvc.ImportFromIbkrFlexQuery(strings.NewReader(ibkrFlexQueryCsv), true, "", nil)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	assert.Empty(t, blotterSvc.GetTrades())
+
+	trades, err = blotterSvc.ImportFromIbkrFlexQuery(strings.NewReader(ibkrFlexQueryCsv), false, "", nil)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	assert.Len(t, blotterSvc.GetTrades(), 2)
+}
+
+func TestImportFromIbkrFlexQueryValidatesTrades(t *testing.T) {
+	db, dbPath := setupTempDB(t)
+	defer cleanupTempDB(t, db, dbPath)
+
+	refMgr := mocks.NewMockReferenceManager()
+	refMgr.AddTicker(rdata.TickerReference{ID: "AAPL", AssetClass: rdata.AssetClassEquities, LotSize: 100})
+	blotterSvc := blotter.NewBlotter(db)
+	blotterSvc.SetReferenceManager(refMgr)
+
+	config.SetConfig(&config.Config{StrictTickerValidation: true})
+	defer config.SetConfig(nil)
+
+	_, err := blotterSvc.ImportFromIbkrFlexQuery(strings.NewReader(ibkrFlexQueryCsv), true, "", nil)
+	assert.ErrorContains(t, err, "fill 2: unknown ticker MSFT")
+
+	refMgr.AddTicker(rdata.TickerReference{ID: "MSFT", AssetClass: rdata.AssetClassEquities})
+	config.SetConfig(&config.Config{StrictTickerValidation: true, LotSizeCheck: config.LotSizeCheckBlock})
+	_, err = blotterSvc.ImportFromIbkrFlexQuery(strings.NewReader(ibkrFlexQueryCsv), false, "", nil)
+	assert.ErrorContains(t, err, "invalid quantity of fill 1")
+	assert.Empty(t, blotterSvc.GetTrades())
+}
@@ -1,6 +1,10 @@
 package blotter
 
-import "encoding/csv"
+import (
+	"encoding/csv"
+
+	"portfolio-manager/pkg/types"
+)
 
 type TradeAdder interface {
 	AddTrade(trade Trade) error
@@ -24,3 +28,15 @@ type TradeImporter interface {
 	ImportFromCSVFile(filepath string) error
 	ImportFromCSVReader(reader *csv.Reader) error
 }
+
+// MarketDataGetter provides the market data used by the blotter, e.g. the market data manager.
+type MarketDataGetter interface {
+	GetAssetPrice(ticker string) (*types.AssetData, error)
+	GetHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error)
+}
+
+// BulkWriteListener is notified around bulk imports, so subscribers to trade events can coalesce their writes.
+type BulkWriteListener interface {
+	BeginBulkWrites()
+	EndBulkWrites()
+}
@@ -0,0 +1,46 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// QuantityForNotional returns the quantity of the ticker which can be bought with the notional at the price, rounded
+// down to the board lot size, along with the price used and the uninvested remainder. The current market price is
+// used when price is not provided.
+func (b *TradeBlotter) QuantityForNotional(ticker string, notional, price float64) (float64, float64, float64, error) {
+	if notional <= 0 {
+		return 0, 0, 0, errors.New("notional must be positive")
+	}
+
+	if price <= 0 {
+		if b.mdata == nil {
+			return 0, 0, 0, errors.New("price is required when market data is not available")
+		}
+		assetData, err := b.mdata.GetAssetPrice(ticker)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to get price of %s: %w", ticker, err)
+		}
+		price = assetData.Price
+	}
+	if price <= 0 {
+		return 0, 0, 0, fmt.Errorf("invalid price %v for %s", price, ticker)
+	}
+
+	lotSize := 1.0
+	if b.rdata != nil {
+		if tickerRef, err := b.rdata.GetTicker(ticker); err == nil {
+			lotSize = tickerRef.GetLotSize()
+		}
+	}
+
+	// guard against floating point error, e.g. 1000 / 0.1 = 9999.999...
+	lots := math.Floor(notional/price/lotSize + 1e-9)
+	quantity := lots * lotSize
+	if quantity <= 0 {
+		return 0, 0, 0, fmt.Errorf("notional %v is below one lot of %v %s at %v", notional, lotSize, ticker, price)
+	}
+
+	return quantity, price, notional - quantity*price, nil
+}
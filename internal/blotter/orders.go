@@ -0,0 +1,134 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/pkg/csvutil"
+	"portfolio-manager/pkg/types"
+
+	"github.com/google/uuid"
+)
+
+// Blotter views
+const (
+	ViewTrades = "trades" // granular view, one row per fill
+	ViewOrders = "orders" // fills collapsed into synthetic order rows
+)
+
+// AddOrder adds the fills of a single order to the blotter, stamping them with the same OrderID.
+// A new OrderID is generated when orderID is empty. All fills must share the same ticker and side.
+func (b *TradeBlotter) AddOrder(orderID string, fills []Trade) (string, error) {
+	return b.addOrder(orderID, fills, audit.SourceAPI)
+}
+
+// addOrder adds the fills of the order, attributing the database writes to the source in the audit log.
+func (b *TradeBlotter) addOrder(orderID string, fills []Trade, source string) (string, error) {
+	if len(fills) == 0 {
+		return "", errors.New("order must have at least one fill")
+	}
+
+	for _, fill := range fills[1:] {
+		if fill.Ticker != fills[0].Ticker || fill.Side != fills[0].Side {
+			return "", errors.New("all fills of an order must share the same ticker and side")
+		}
+	}
+
+	if orderID == "" {
+		orderID = uuid.New().String()
+	}
+
+	// all fills are written in a single batch, so a failure never leaves a partial order
+	trades := make([]*Trade, len(fills))
+	for i, fill := range fills {
+		fill.OrderID = orderID
+		trades[i] = &fill
+	}
+	if err := b.writeTrades(trades, source); err != nil {
+		return "", fmt.Errorf("error adding fills of order %s: %w", orderID, err)
+	}
+
+	b.mu.Lock()
+	b.sortTrades()
+	b.mu.Unlock()
+
+	return orderID, nil
+}
+
+// GetTradesByView returns the trades in the blotter, collapsing partial fills into orders for the orders view.
+func (b *TradeBlotter) GetTradesByView(view string) ([]Trade, error) {
+	return b.GetTradesByViewAndTag(view, "")
+}
+
+// GetTradesByViewAndTag returns the trades in the blotter with the tag, all trades when tag is empty, collapsing
+// partial fills into orders for the orders view.
+func (b *TradeBlotter) GetTradesByViewAndTag(view, tag string) ([]Trade, error) {
+	trades := b.GetTrades()
+	if tag != "" {
+		trades = b.GetTradesByTag(tag)
+	}
+
+	switch view {
+	case "", ViewTrades:
+		return trades, nil
+	case ViewOrders:
+		return CollapseOrders(trades), nil
+	default:
+		return nil, fmt.Errorf("unsupported view %s", view)
+	}
+}
+
+// ExportToCSVBytesByView exports the trades of the given view to a CSV file in memory.
+func (b *TradeBlotter) ExportToCSVBytesByView(view string, format csvutil.FormatOptions) ([]byte, error) {
+	return b.ExportToCSVBytesByViewForUser(view, format, nil)
+}
+
+// ExportToCSVBytesByViewForUser exports the trades of the given view in the books (traders) the user may see to a
+// CSV file in memory, all trades when user is nil.
+func (b *TradeBlotter) ExportToCSVBytesByViewForUser(view string, format csvutil.FormatOptions, user *types.User) ([]byte, error) {
+	trades, err := b.GetTradesByView(view)
+	if err != nil {
+		return nil, err
+	}
+	return exportTradesToCSVBytes(FilterTradesForUser(trades, user), format)
+}
+
+// CollapseOrders collapses fills sharing an OrderID and book (trader) into a synthetic order row with the aggregate
+// quantity and fees and quantity weighted average price, dated at the first fill. Trades without an OrderID are
+// returned as-is.
+// The underlying trades remain the source of truth, the synthetic rows are never persisted.
+func CollapseOrders(trades []Trade) []Trade {
+	var collapsed []Trade
+	orderIdx := make(map[string]int)
+
+	for _, trade := range trades {
+		if trade.OrderID == "" {
+			collapsed = append(collapsed, trade)
+			continue
+		}
+
+		key := trade.Trader + "|" + trade.OrderID
+		idx, exists := orderIdx[key]
+		if !exists {
+			order := trade
+			order.TradeID = trade.OrderID
+			orderIdx[key] = len(collapsed)
+			collapsed = append(collapsed, order)
+			continue
+		}
+
+		order := &collapsed[idx]
+		notional := order.Price*order.Quantity + trade.Price*trade.Quantity
+		order.Quantity += trade.Quantity
+		order.Fee += trade.Fee
+		if order.Quantity != 0 {
+			order.Price = notional / order.Quantity
+		}
+		if trade.TradeDate < order.TradeDate {
+			order.TradeDate = trade.TradeDate
+		}
+		order.SeqNum = max(order.SeqNum, trade.SeqNum)
+	}
+
+	return collapsed
+}
@@ -0,0 +1,242 @@
+package blotter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"portfolio-manager/pkg/csvutil"
+	"portfolio-manager/pkg/types"
+)
+
+// ImportProfile maps the columns of a broker's CSV export onto the trade fields, so that the export is imported
+// without reshaping it into the trades CSV first.
+type ImportProfile struct {
+	Name string `json:"name"`
+	// Columns maps the source column names to the trade fields, named as the columns of the trades CSV, e.g.
+	// "Trade Date": "TradeDate". Source columns not mapped are ignored.
+	Columns map[string]string `json:"columns"`
+	// DateFormat is the format of the trade dates, e.g. DD/MM/YYYY, defaulting to the format options of the import
+	DateFormat string `json:"dateFormat,omitempty"`
+	// Sides maps the source side values to buy or sell, e.g. "B": "buy", matched case-insensitively. Values not
+	// mapped are lower cased.
+	Sides map[string]string `json:"sides,omitempty"`
+	// Defaults holds the values of trade fields missing from the export, e.g. "Broker": "moomoo"
+	Defaults map[string]string `json:"defaults,omitempty"`
+	BuiltIn  bool              `json:"builtIn"`
+}
+
+// builtInImportProfiles map the default English exports of brokers without an API import. A profile saved under the
+// same name takes precedence, e.g. when the broker changes its export.
+var builtInImportProfiles = []ImportProfile{
+	{
+		Name: "dbsvickers",
+		Columns: map[string]string{
+			"Trade Date": "TradeDate", "Stock Code": "Ticker", "Buy/Sell": "Side", "Quantity": "Quantity",
+			"Price": "Price", "Total Charges": "Fee", "Currency": "FeeCcy",
+		},
+		DateFormat: "DD/MM/YYYY",
+		Sides:      map[string]string{"B": TradeSideBuy, "S": TradeSideSell},
+		Defaults:   map[string]string{"Broker": "dbsvickers", "Trader": "default", "Account": "cash"},
+	},
+	{
+		Name: "moomoo",
+		Columns: map[string]string{
+			"Fill Time": "TradeDate", "Symbol": "Ticker", "Side": "Side", "Fill Qty": "Quantity",
+			"Fill Price": "Price", "Fees": "Fee", "Currency": "FeeCcy",
+		},
+		DateFormat: "YYYY-MM-DD hh:mm:ss",
+		Defaults:   map[string]string{"Broker": "moomoo", "Trader": "default", "Account": "cash"},
+	},
+	{
+		Name: "tiger",
+		Columns: map[string]string{
+			"Trade Time": "TradeDate", "Symbol": "Ticker", "Action": "Side", "Quantity": "Quantity",
+			"Price": "Price", "Commission": "Fee", "Currency": "FeeCcy",
+		},
+		DateFormat: "YYYY-MM-DD hh:mm:ss",
+		Sides:      map[string]string{"BUY": TradeSideBuy, "SELL": TradeSideSell},
+		Defaults:   map[string]string{"Broker": "tiger", "Trader": "default", "Account": "cash"},
+	},
+}
+
+// requiredImportFields are the trade fields each imported row needs, from a column or a default
+var requiredImportFields = []string{"TradeDate", "Ticker", "Side", "Quantity", "Price", "Trader", "Broker", "Account"}
+
+// GetImportProfiles returns the built-in and saved import profiles by name.
+func (b *TradeBlotter) GetImportProfiles() ([]ImportProfile, error) {
+	profiles := make(map[string]ImportProfile)
+	for _, profile := range builtInImportProfiles {
+		profile.BuiltIn = true
+		profiles[profile.Name] = profile
+	}
+
+	keys, err := b.db.GetAllKeysWithPrefix(string(types.ImportProfileKeyPrefix) + ":")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		var profile ImportProfile
+		if err := b.db.Get(key, &profile); err != nil {
+			return nil, err
+		}
+		profiles[profile.Name] = profile
+	}
+
+	result := make([]ImportProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		result = append(result, profile)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// GetImportProfile returns the import profile with the name, the saved one when it shadows a built-in profile.
+func (b *TradeBlotter) GetImportProfile(name string) (ImportProfile, error) {
+	name = strings.ToLower(name)
+	var profile ImportProfile
+	if err := b.db.Get(importProfileKey(name), &profile); err == nil {
+		return profile, nil
+	}
+	for _, profile := range builtInImportProfiles {
+		if profile.Name == name {
+			profile.BuiltIn = true
+			return profile, nil
+		}
+	}
+	return ImportProfile{}, fmt.Errorf("import profile %s not found", name)
+}
+
+// SaveImportProfile validates and saves the import profile under its lower cased name.
+func (b *TradeBlotter) SaveImportProfile(profile ImportProfile) (ImportProfile, error) {
+	profile.Name = strings.ToLower(strings.TrimSpace(profile.Name))
+	profile.BuiltIn = false
+	if err := validateImportProfile(profile); err != nil {
+		return ImportProfile{}, err
+	}
+	if err := b.db.Put(importProfileKey(profile.Name), profile); err != nil {
+		return ImportProfile{}, err
+	}
+	return profile, nil
+}
+
+// DeleteImportProfile deletes the saved import profile, a built-in profile it shadowed applies again.
+func (b *TradeBlotter) DeleteImportProfile(name string) error {
+	key := importProfileKey(strings.ToLower(name))
+	var profile ImportProfile
+	if err := b.db.Get(key, &profile); err != nil {
+		return fmt.Errorf("import profile %s not found", name)
+	}
+	return b.db.Delete(key)
+}
+
+// ImportFromCSVReaderWithProfile imports trades from a broker's CSV export, mapping its columns onto the trade fields
+// with the profile before the trades are validated as in ImportFromCSVReaderWithFormat. Rows missing a required
+// field are reported for all rows at once, and nothing is imported.
+func (b *TradeBlotter) ImportFromCSVReaderWithProfile(reader *csv.Reader, profile ImportProfile, format csvutil.FormatOptions, user *types.User) error {
+	_, err := b.ImportCSV(reader, ImportOptions{Format: format, Profile: &profile}, user)
+	return err
+}
+
+// readProfileRows reads the rows of a broker's CSV export as rows of the trades CSV, mapping the columns with the
+// profile.
+func readProfileRows(reader *csv.Reader, profile ImportProfile) ([][]string, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	// Index the source columns of each trade field, unknown columns are ignored
+	allHeaders := slices.Concat(csvHeaders, csvFeeHeaders, csvNoteHeaders)
+	columns := make(map[string]int)
+	for i, column := range header {
+		if field, ok := profile.Columns[strings.TrimSpace(column)]; ok {
+			columns[field] = i
+		}
+	}
+
+	sides := make(map[string]string, len(profile.Sides))
+	for value, side := range profile.Sides {
+		sides[strings.ToLower(value)] = side
+	}
+
+	var rows [][]string
+	var missing []error
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if err.Error() == "EOF" {
+				break
+			}
+			return nil, fmt.Errorf("error reading CSV line %d: %w", len(rows)+1, err)
+		}
+		lineNum := len(rows) + 1
+
+		row := make([]string, len(allHeaders))
+		for i, field := range allHeaders {
+			if column, ok := columns[field]; ok && column < len(record) {
+				row[i] = strings.TrimSpace(record[column])
+			}
+			if row[i] == "" {
+				row[i] = profile.Defaults[field]
+			}
+		}
+		if side, ok := sides[strings.ToLower(row[2])]; ok {
+			row[2] = side
+		} else {
+			row[2] = strings.ToLower(row[2])
+		}
+
+		for i, field := range allHeaders {
+			if row[i] == "" && slices.Contains(requiredImportFields, field) {
+				missing = append(missing, fmt.Errorf("line %d: missing %s", lineNum, field))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("invalid rows: %w", errors.Join(missing...))
+	}
+
+	return rows, nil
+}
+
+// validateImportProfile checks the profile maps onto trade fields and sides only.
+func validateImportProfile(profile ImportProfile) error {
+	if profile.Name == "" {
+		return errors.New("import profile name is required")
+	}
+	if profile.Name == csvutil.ProfileDefault || profile.Name == csvutil.ProfileEU {
+		return fmt.Errorf("import profile name %s is reserved for a format profile", profile.Name)
+	}
+	if len(profile.Columns) == 0 {
+		return errors.New("import profile requires columns")
+	}
+
+	allHeaders := slices.Concat(csvHeaders, csvFeeHeaders, csvNoteHeaders)
+	for column, field := range profile.Columns {
+		if !slices.Contains(allHeaders, field) {
+			return fmt.Errorf("column %s maps to unknown trade field %s, expected one of %s", column, field,
+				strings.Join(allHeaders, ", "))
+		}
+	}
+	for field := range profile.Defaults {
+		if !slices.Contains(allHeaders, field) {
+			return fmt.Errorf("default of unknown trade field %s, expected one of %s", field, strings.Join(allHeaders, ", "))
+		}
+	}
+	for value, side := range profile.Sides {
+		if !isValidSide(side) {
+			return fmt.Errorf("side %s maps to %s, expected buy or sell", value, side)
+		}
+	}
+	return nil
+}
+
+func importProfileKey(name string) string {
+	return fmt.Sprintf("%s:%s", types.ImportProfileKeyPrefix, name)
+}
@@ -0,0 +1,88 @@
+package blotter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tagsCsvSeparator separates the tags of a trade in the Tags column of the trades CSV
+const tagsCsvSeparator = "|"
+
+// NormalizeTags trims the tags, dropping empty tags and duplicates differing only by case, the first spelling wins.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[strings.ToLower(tag)]; ok {
+			continue
+		}
+		seen[strings.ToLower(tag)] = struct{}{}
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// validateTags checks the tags can be exported to the trades CSV.
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if strings.Contains(tag, tagsCsvSeparator) {
+			return fmt.Errorf("tag %q must not contain %s", tag, tagsCsvSeparator)
+		}
+	}
+	return nil
+}
+
+// HasTag returns whether the trade is tagged with the tag, case-insensitively.
+func (t Trade) HasTag(tag string) bool {
+	for _, tradeTag := range t.Tags {
+		if strings.EqualFold(tradeTag, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTradesByTag returns the trades tagged with the tag, case-insensitively, in trade date order.
+func (b *TradeBlotter) GetTradesByTag(tag string) []Trade {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tradeIDs := b.tradesByTag[strings.ToLower(strings.TrimSpace(tag))]
+	if len(tradeIDs) == 0 {
+		return nil
+	}
+
+	trades := make([]Trade, 0, len(tradeIDs))
+	for _, trade := range b.trades {
+		if _, ok := tradeIDs[trade.TradeID]; ok {
+			trades = append(trades, trade)
+		}
+	}
+	return trades
+}
+
+// indexTags adds the trade to the index of its tags. The caller must hold the lock.
+func (b *TradeBlotter) indexTags(trade Trade) {
+	for _, tag := range trade.Tags {
+		key := strings.ToLower(tag)
+		if b.tradesByTag[key] == nil {
+			b.tradesByTag[key] = make(map[string]struct{})
+		}
+		b.tradesByTag[key][trade.TradeID] = struct{}{}
+	}
+}
+
+// unindexTags removes the trade from the index of its tags. The caller must hold the lock.
+func (b *TradeBlotter) unindexTags(trade Trade) {
+	for _, tag := range trade.Tags {
+		key := strings.ToLower(tag)
+		delete(b.tradesByTag[key], trade.TradeID)
+		if len(b.tradesByTag[key]) == 0 {
+			delete(b.tradesByTag, key)
+		}
+	}
+}
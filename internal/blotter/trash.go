@@ -0,0 +1,152 @@
+package blotter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/scheduler"
+	"portfolio-manager/pkg/types"
+)
+
+// DefaultTrashRetentionDays is the number of days removed trades are kept in the recycle bin when not configured
+const DefaultTrashRetentionDays = 30
+
+// TrashedTrade is a trade removed from the blotter, kept in the recycle bin until restored or purged.
+type TrashedTrade struct {
+	Trade     Trade  `json:"trade"`
+	DeletedAt string `json:"deletedAt"` // RFC3339
+}
+
+// GetTrash returns the trades in the recycle bin, most recently removed first.
+func (b *TradeBlotter) GetTrash() ([]TrashedTrade, error) {
+	keys, err := b.db.GetAllKeysWithPrefix(string(types.TrashKeyPrefix) + ":")
+	if err != nil {
+		return nil, err
+	}
+
+	trash := make([]TrashedTrade, 0, len(keys))
+	for _, key := range keys {
+		var trashed TrashedTrade
+		if err := b.db.Get(key, &trashed); err != nil {
+			return nil, err
+		}
+		trash = append(trash, trashed)
+	}
+	sort.SliceStable(trash, func(i, j int) bool { return trash[i].DeletedAt > trash[j].DeletedAt })
+	return trash, nil
+}
+
+// RestoreTrades moves the trades out of the recycle bin back into the blotter, keeping their trade IDs and sequence
+// numbers. Nothing is restored when any of the trades is missing from the recycle bin, or in a book the user, nil
+// when authentication is disabled, may not trade in.
+//
+// No new trade events are published, as positions are not reduced when trades are removed and so still include
+// the restored trades.
+func (b *TradeBlotter) RestoreTrades(tradeIDs []string, user *types.User) ([]Trade, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch := audit.WithSource(b.db, audit.SourceAPI).Batch()
+	restored := make([]Trade, 0, len(tradeIDs))
+	seen := make(map[string]struct{}, len(tradeIDs))
+	for _, tradeID := range tradeIDs {
+		if _, ok := seen[tradeID]; ok {
+			continue
+		}
+		seen[tradeID] = struct{}{}
+
+		var trashed TrashedTrade
+		if err := b.db.Get(trashKey(tradeID), &trashed); err != nil {
+			return nil, fmt.Errorf("trade %s not found in the recycle bin", tradeID)
+		}
+		trade := trashed.Trade
+		if user != nil && !user.CanSeeBook(trade.Trader) {
+			return nil, fmt.Errorf("%w: user %s may not trade in book %s", ErrBookNotAllowed, user.Name, trade.Trader)
+		}
+		if _, exists := b.tradesByID[trade.TradeID]; exists {
+			return nil, fmt.Errorf("trade %s already exists", trade.TradeID)
+		}
+
+		if err := batch.Put(generateTradeKey(trade), trade); err != nil {
+			return nil, err
+		}
+		if err := batch.Delete(trashKey(tradeID)); err != nil {
+			return nil, err
+		}
+		restored = append(restored, trade)
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, err
+	}
+
+	for i := range restored {
+		trade := restored[i]
+		b.trades = append(b.trades, trade)
+		b.tradesByID[trade.TradeID] = &trade
+		b.tradesByTicker[trade.Ticker] = append(b.tradesByTicker[trade.Ticker], trade)
+		b.indexTags(trade)
+	}
+	b.sortTrades()
+
+	logging.GetLogger().Infof("Restored %d trades from the recycle bin", len(restored))
+	return restored, nil
+}
+
+// PurgeTrash deletes the trades removed before the retention, returning the number of trades purged.
+func (b *TradeBlotter) PurgeTrash(now time.Time) (int, error) {
+	trash, err := b.GetTrash()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := now.AddDate(0, 0, -trashRetentionDays())
+	batch := b.db.Batch()
+	purged := 0
+	for _, trashed := range trash {
+		deletedAt, err := time.Parse(time.RFC3339, trashed.DeletedAt)
+		if err != nil || !deletedAt.Before(cutoff) {
+			continue
+		}
+		if err := batch.Delete(trashKey(trashed.Trade.TradeID)); err != nil {
+			return 0, err
+		}
+		purged++
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+
+	logging.GetLogger().Infof("Purged %d trades from the recycle bin", purged)
+	return purged, nil
+}
+
+// StartTrashPurgeSchedule purges the recycle bin of trades past the retention hourly until the scheduler is stopped.
+func (b *TradeBlotter) StartTrashPurgeSchedule(sched *scheduler.Scheduler) {
+	sched.Every("trash_purge", time.Hour, func() error {
+		_, err := b.PurgeTrash(time.Now())
+		if err != nil {
+			logging.GetLogger().Errorf("Scheduled recycle bin purge failed: %v", err)
+		}
+		return err
+	})
+}
+
+// trashRetentionDays returns the configured number of days removed trades are kept in the recycle bin.
+func trashRetentionDays() int {
+	cfg, err := config.GetOrCreateConfig("")
+	if err != nil || cfg == nil || cfg.TrashRetentionDays <= 0 {
+		return DefaultTrashRetentionDays
+	}
+	return cfg.TrashRetentionDays
+}
+
+func trashKey(tradeID string) string {
+	return fmt.Sprintf("%s:%s", types.TrashKeyPrefix, tradeID)
+}
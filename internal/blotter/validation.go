@@ -0,0 +1,115 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/common"
+	"portfolio-manager/pkg/types"
+)
+
+// maxTickerSuggestions caps the close matches suggested for an unknown ticker
+const maxTickerSuggestions = 5
+
+// maxTickerSuggestionDistance is the largest edit distance of a suggested ticker
+const maxTickerSuggestionDistance = 2
+
+// ErrBookNotAllowed is returned when the acting user may not trade in the book of a trade.
+var ErrBookNotAllowed = errors.New("book not allowed")
+
+// AuthorizeTrades checks the user may trade in the books (traders) of the trades, and records the user on the trades
+// for audit. A nil user, when authentication is disabled, is allowed all books.
+func AuthorizeTrades(trades []*Trade, user *types.User) error {
+	if user == nil {
+		return nil
+	}
+
+	for _, trade := range trades {
+		if !user.CanSeeBook(trade.Trader) {
+			return fmt.Errorf("%w: user %s may not trade in book %s", ErrBookNotAllowed, user.Name, trade.Trader)
+		}
+		trade.CreatedBy = user.Name
+	}
+	return nil
+}
+
+// FilterTradesForUser returns the trades in the books (traders) the user may see, all trades when user is nil.
+func FilterTradesForUser(trades []Trade, user *types.User) []Trade {
+	if user == nil {
+		return trades
+	}
+
+	visible := make([]Trade, 0, len(trades))
+	for _, trade := range trades {
+		if user.CanSeeBook(trade.Trader) {
+			visible = append(visible, trade)
+		}
+	}
+	return visible
+}
+
+// UnknownTickerError is returned when strict ticker validation rejects a ticker missing from reference data.
+type UnknownTickerError struct {
+	Ticker      string
+	Suggestions []string // close matches among the known tickers
+}
+
+func (e *UnknownTickerError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("unknown ticker %s", e.Ticker)
+	}
+	return fmt.Sprintf("unknown ticker %s, did you mean %s", e.Ticker, strings.Join(e.Suggestions, ", "))
+}
+
+// CheckTicker validates that the ticker exists in reference data when strictTickerValidation is enabled, returning
+// an UnknownTickerError with close matches otherwise.
+func (b *TradeBlotter) CheckTicker(ticker string) error {
+	if b.rdata == nil || !strictTickerValidation() {
+		return nil
+	}
+
+	if _, err := b.rdata.GetTicker(ticker); err == nil {
+		return nil
+	}
+
+	known, err := b.rdata.GetAllTickers()
+	if err != nil {
+		return fmt.Errorf("failed to validate ticker %s: %w", ticker, err)
+	}
+
+	return &UnknownTickerError{Ticker: ticker, Suggestions: suggestTickers(ticker, known)}
+}
+
+// suggestTickers returns the known tickers sharing a prefix with, or within a small edit distance of, the ticker,
+// closest first.
+func suggestTickers[T any](ticker string, known map[string]T) []string {
+	ticker = strings.ToUpper(ticker)
+	distances := make(map[string]int)
+	for id := range known {
+		distance := common.Levenshtein(ticker, id)
+		prefix, _, _ := strings.Cut(ticker, ".")
+		if distance <= maxTickerSuggestionDistance || (len(prefix) >= 2 && strings.HasPrefix(id, prefix)) {
+			distances[id] = distance
+		}
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for id := range distances {
+		suggestions = append(suggestions, id)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	return suggestions[:min(len(suggestions), maxTickerSuggestions)]
+}
+
+func strictTickerValidation() bool {
+	cfg, _ := config.GetOrCreateConfig("")
+	return cfg != nil && cfg.StrictTickerValidation
+}
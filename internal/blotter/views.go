@@ -0,0 +1,138 @@
+package blotter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"portfolio-manager/pkg/types"
+)
+
+// ErrSavedViewNotFound is returned when no saved view has the name.
+var ErrSavedViewNotFound = errors.New("saved view not found")
+
+// SavedView is a named slice of the portfolio, e.g. "retirement" of books A and B excluding crypto, applied to the
+// trades, IRR, TWR and breakdown in place of repeating the filters. It narrows the books the user may see, never
+// widens them.
+type SavedView struct {
+	Name  string   `json:"name"`
+	Books []string `json:"books,omitempty"` // all books when empty
+	// IncludeAssetClasses keeps the tickers of these asset classes only, all when empty
+	IncludeAssetClasses []string `json:"includeAssetClasses,omitempty"`
+	ExcludeAssetClasses []string `json:"excludeAssetClasses,omitempty"`
+	Tag                 string   `json:"tag,omitempty"` // tag of the trades, matched case-insensitively
+}
+
+// Includes reports whether the view includes the book's holdings of a ticker of the asset class. A nil view includes
+// everything.
+func (v *SavedView) Includes(book, assetClass string) bool {
+	if v == nil {
+		return true
+	}
+	if len(v.Books) > 0 && !slices.Contains(v.Books, book) {
+		return false
+	}
+	if len(v.IncludeAssetClasses) > 0 && !slices.Contains(v.IncludeAssetClasses, assetClass) {
+		return false
+	}
+	return !slices.Contains(v.ExcludeAssetClasses, assetClass)
+}
+
+// IncludesTrade reports whether the view includes the trade in a ticker of the asset class, which must also have the
+// tag of the view.
+func (v *SavedView) IncludesTrade(trade Trade, assetClass string) bool {
+	return v.Includes(trade.Trader, assetClass) && (v == nil || v.Tag == "" || trade.HasTag(v.Tag))
+}
+
+// GetSavedViews returns the saved views by name.
+func (b *TradeBlotter) GetSavedViews() ([]SavedView, error) {
+	keys, err := b.db.GetAllKeysWithPrefix(string(types.SavedViewKeyPrefix) + ":")
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]SavedView, 0, len(keys))
+	for _, key := range keys {
+		var view SavedView
+		if err := b.db.Get(key, &view); err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views, nil
+}
+
+// GetSavedView returns the saved view with the name, matched case-insensitively.
+func (b *TradeBlotter) GetSavedView(name string) (*SavedView, error) {
+	var view SavedView
+	if err := b.db.Get(savedViewKey(strings.ToLower(name)), &view); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSavedViewNotFound, name)
+	}
+	return &view, nil
+}
+
+// SaveSavedView validates and saves the view under its lower cased name, replacing a view of the same name.
+func (b *TradeBlotter) SaveSavedView(view SavedView) (SavedView, error) {
+	view.Name = strings.ToLower(strings.TrimSpace(view.Name))
+	if view.Name == "" {
+		return SavedView{}, errors.New("saved view needs a name")
+	}
+	for _, assetClass := range view.IncludeAssetClasses {
+		if slices.Contains(view.ExcludeAssetClasses, assetClass) {
+			return SavedView{}, fmt.Errorf("asset class %s is both included and excluded", assetClass)
+		}
+	}
+	if err := b.db.Put(savedViewKey(view.Name), view); err != nil {
+		return SavedView{}, err
+	}
+	return view, nil
+}
+
+// DeleteSavedView deletes the saved view with the name.
+func (b *TradeBlotter) DeleteSavedView(name string) error {
+	key := savedViewKey(strings.ToLower(name))
+	var view SavedView
+	if err := b.db.Get(key, &view); err != nil {
+		return fmt.Errorf("%w: %s", ErrSavedViewNotFound, name)
+	}
+	return b.db.Delete(key)
+}
+
+// GetTradesInView returns the trades included in the saved view, all trades when it is nil, which also have the tag
+// when it is not empty, collapsing partial fills into orders for the orders view.
+func (b *TradeBlotter) GetTradesInView(view string, saved *SavedView, tag string) ([]Trade, error) {
+	var trades []Trade
+	for _, trade := range b.GetTrades() {
+		if saved.IncludesTrade(trade, b.assetClass(trade.Ticker)) && (tag == "" || trade.HasTag(tag)) {
+			trades = append(trades, trade)
+		}
+	}
+
+	switch view {
+	case "", ViewTrades:
+		return trades, nil
+	case ViewOrders:
+		return CollapseOrders(trades), nil
+	default:
+		return nil, fmt.Errorf("unsupported view %s", view)
+	}
+}
+
+// assetClass returns the asset class of the ticker, empty when it has no reference data.
+func (b *TradeBlotter) assetClass(ticker string) string {
+	if b.rdata == nil {
+		return ""
+	}
+	tickerRef, err := b.rdata.GetTicker(ticker)
+	if err != nil {
+		return ""
+	}
+	return tickerRef.AssetClass
+}
+
+func savedViewKey(name string) string {
+	return fmt.Sprintf("%s:%s", types.SavedViewKeyPrefix, name)
+}
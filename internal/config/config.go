@@ -3,81 +3,388 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 // Config represents the application configuration.
 type Config struct {
-	VerboseLogging     bool    `yaml:"verboseLogging"`
-	LogFilePath        string  `yaml:"logFilePath"`
-	Host               string  `yaml:"host"`
-	Port               string  `yaml:"port"`
-	Db                 string  `yaml:"db"`
-	DbPath             string  `yaml:"dbPath"`
-	RefDataSeedPath    string  `yaml:"refDataSeedPath"`
-	DivWitholdingTaxSG float64 `yaml:"divWitholdingTaxSG"`
-	DivWitholdingTaxUS float64 `yaml:"divWitholdingTaxUS"`
-	DivWitholdingTaxHK float64 `yaml:"divWitholdingTaxHK"`
-	DivWitholdingTaxIE float64 `yaml:"divWitholdingTaxIE"`
-}
-
-// Implement the Stringer interface for Config
+	VerboseLogging      bool    `yaml:"verboseLogging"`
+	LogFilePath         string  `yaml:"logFilePath"`
+	LogFormat           string  `yaml:"logFormat"` // text or json
+	Host                string  `yaml:"host"`
+	Port                string  `yaml:"port"`
+	BaseCcy             string  `yaml:"baseCcy"`
+	EnrichConcurrency   int     `yaml:"enrichConcurrency"` // positions enriched concurrently
+	Db                  string  `yaml:"db"`
+	DbPath              string  `yaml:"dbPath"`
+	RefDataSeedPath     string  `yaml:"refDataSeedPath"`
+	DivWitholdingTaxSG  float64 `yaml:"divWitholdingTaxSG"`
+	DivWitholdingTaxUS  float64 `yaml:"divWitholdingTaxUS"`
+	DivWitholdingTaxHK  float64 `yaml:"divWitholdingTaxHK"`
+	DivWitholdingTaxIE  float64 `yaml:"divWitholdingTaxIE"`
+	DivSpecialThreshold float64 `yaml:"divSpecialThreshold"`
+	LotSizeCheck        string  `yaml:"lotSizeCheck"`
+	CoinGeckoCacheTtl   int     `yaml:"coinGeckoCacheTtl"` // seconds
+	PriceStaleAfter     int     `yaml:"priceStaleAfter"`   // hours, prices older than this fall back to the next source
+
+	// WithholdingTax is the withholding tax rate on dividends per domicile, e.g. US: 0.3, taking precedence over the
+	// divWitholdingTax fields. Tickers taxed at a different rate, e.g. under a tax treaty, are overridden via the API
+	WithholdingTax map[string]float64 `yaml:"withholdingTax"`
+
+	IbkrAccounts map[string]IbkrAccount `yaml:"ibkrAccounts"`
+	MarketData   MarketDataConfig       `yaml:"marketData"`
+
+	// PriceSources overrides the order in which price sources are tried per asset class, e.g. eq: [yahoo, sgx, google]
+	PriceSources map[string][]string `yaml:"priceSources"`
+
+	// StrictTickerValidation rejects trades in tickers missing from reference data, with close matches suggested
+	StrictTickerValidation bool `yaml:"strictTickerValidation"`
+
+	// AutoCloseSubClasses opts bond sub classes into closing at maturity, e.g. [govies, fd]
+	AutoCloseSubClasses []string `yaml:"autoCloseSubClasses"`
+
+	// AutoCloseSchedule runs the auto-close of matured bonds daily
+	AutoCloseSchedule AutoCloseScheduleConfig `yaml:"autoCloseSchedule"`
+
+	// PositionSnapshot stores the open positions daily, answering what was held on a past date
+	PositionSnapshot PositionSnapshotConfig `yaml:"positionSnapshot"`
+
+	// TrashRetentionDays is the number of days removed trades are kept in the recycle bin before being purged,
+	// defaults to 30
+	TrashRetentionDays int `yaml:"trashRetentionDays"`
+
+	// RebalanceTolerance is the drift of an allocation from its target weight beyond which rebalancing trades are
+	// suggested, e.g. 0.05 for 5 percentage points
+	RebalanceTolerance float64 `yaml:"rebalanceTolerance"`
+
+	// EnrichmentStrategies overrides how positions of an asset class are valued, e.g. cmdty: manual-only
+	EnrichmentStrategies map[string]string `yaml:"enrichmentStrategies"`
+
+	// ApiKeys maps API keys to users, /api/v1 routes require an API key when any is configured
+	ApiKeys map[string]types.User `yaml:"apiKeys"`
+
+	// Backup uploads archives of the database to the backup source daily
+	Backup BackupConfig `yaml:"backup"`
+
+	// Notifications sends the notifications of background jobs by email or Telegram
+	Notifications NotificationsConfig `yaml:"notifications"`
+
+	// Alerts evaluates the price alert rules on tickers
+	Alerts AlertsConfig `yaml:"alerts"`
+}
+
+// IbkrAccount maps an Interactive Brokers account id to the blotter trader, broker and account.
+type IbkrAccount struct {
+	Trader  string `yaml:"trader"`
+	Broker  string `yaml:"broker"`
+	Account string `yaml:"account"`
+}
+
+// MarketDataConfig holds the market data source settings.
+type MarketDataConfig struct {
+	RateLimits map[string]int   `yaml:"rateLimits"` // minimum milliseconds between requests per source, e.g. yahoo: 500
+	EodCapture EodCaptureConfig `yaml:"eodCapture"`
+
+	ManualPriceStaleAfter int `yaml:"manualPriceStaleAfter"` // days, manual prices older than this are flagged as stale
+}
+
+// EodCaptureConfig holds the settings of the daily capture of closes into the historical data cache.
+type EodCaptureConfig struct {
+	Disabled  bool              `yaml:"disabled"`
+	Times     map[string]string `yaml:"times"`     // UTC capture time (HH:MM) per domicile, after the market close
+	Watchlist []string          `yaml:"watchlist"` // tickers captured in addition to those with open positions
+}
+
+// AutoCloseScheduleConfig holds the settings of the daily auto-close of matured bonds.
+type AutoCloseScheduleConfig struct {
+	Disabled bool   `yaml:"disabled"`
+	Time     string `yaml:"time"`   // local time (HH:MM) of the daily run
+	Notify   bool   `yaml:"notify"` // post a summary of closed trades to notifications
+}
+
+// PositionSnapshotConfig holds the settings of the daily snapshot of the open positions.
+type PositionSnapshotConfig struct {
+	Disabled           bool   `yaml:"disabled"`
+	Time               string `yaml:"time"`               // local time (HH:MM) of the daily snapshot
+	DailyRetentionDays int    `yaml:"dailyRetentionDays"` // snapshots older than this are thinned to the last of each month
+	NetWorth           bool   `yaml:"netWorth"`           // also snapshot the net worth daily, for charting
+}
+
+// BackupConfig holds the settings of the database backups.
+type BackupConfig struct {
+	Source    string                `yaml:"source"` // backup source, local or s3, defaults to local
+	Time      string                `yaml:"time"`   // local time (HH:MM) of the daily backup, scheduled backups are off when empty
+	Retention BackupRetentionConfig `yaml:"retention"`
+	Local     LocalBackupConfig     `yaml:"local"`
+	S3        S3BackupConfig        `yaml:"s3"`
+}
+
+// BackupRetentionConfig holds how many backups are kept, older backups are pruned after each backup.
+type BackupRetentionConfig struct {
+	Count      int `yaml:"count"`      // newest backups kept, all when 0
+	MaxAgeDays int `yaml:"maxAgeDays"` // backups older than this are pruned, never when 0
+}
+
+// LocalBackupConfig holds the settings of the local directory backup source.
+type LocalBackupConfig struct {
+	Path string `yaml:"path"` // directory of the backups, e.g. a NAS mount
+}
+
+// S3BackupConfig holds the settings of the S3 compatible backup source, e.g. AWS S3 or MinIO.
+type S3BackupConfig struct {
+	Endpoint  string `yaml:"endpoint"` // e.g. http://minio.local:9000, defaults to AWS S3 in the region
+	Region    string `yaml:"region"`   // defaults to us-east-1
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`    // folder of the backups within the bucket
+	PathStyle bool   `yaml:"pathStyle"` // address the bucket in the path rather than the host, usually needed by MinIO
+	AccessKey string `yaml:"accessKey"` // defaults to AWS_ACCESS_KEY_ID
+	SecretKey string `yaml:"secretKey"` // defaults to AWS_SECRET_ACCESS_KEY
+}
+
+// NotificationsConfig holds the senders of notifications and which events are sent.
+type NotificationsConfig struct {
+	Events         []string       `yaml:"events"`         // sources sent, e.g. [autoclose, backup, exdividend, pnl], all when empty
+	ExDividendTime string         `yaml:"exDividendTime"` // local time (HH:MM) of the daily check for ex dates of holdings tomorrow
+	PnLMovePct     float64        `yaml:"pnlMovePct"`     // notify when the total PnL moves more than this percent of the market value in a day, off when 0
+	SMTP           SMTPConfig     `yaml:"smtp"`
+	Telegram       TelegramConfig `yaml:"telegram"`
+}
+
+// SMTPConfig holds the settings of the email sender, which is off when no host is configured.
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"` // defaults to 587
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"` // defaults to SMTP_PASSWORD
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// TelegramConfig holds the settings of the Telegram bot sender, which is off when no chat is configured.
+type TelegramConfig struct {
+	BotToken string `yaml:"botToken"` // defaults to TELEGRAM_BOT_TOKEN
+	ChatID   string `yaml:"chatId"`
+}
+
+// AlertsConfig holds the settings of the evaluation of price alerts.
+type AlertsConfig struct {
+	Disabled        bool `yaml:"disabled"`
+	IntervalMinutes int  `yaml:"intervalMinutes"` // minutes between evaluations, defaults to 5
+}
+
+// DefaultBaseCcy is the base currency of the portfolio when not configured
+const DefaultBaseCcy = "SGD"
+
+// DefaultEnrichConcurrency is the number of positions enriched concurrently when not configured
+const DefaultEnrichConcurrency = 8
+
+// Lot size check modes applied to trade quantities
+const (
+	LotSizeCheckWarn  = "warn"
+	LotSizeCheckBlock = "block"
+)
+
+// Implement the Stringer interface for Config, with the secrets redacted as the config is logged on startup
 func (c Config) String() string {
-	jConfig, _ := json.MarshalIndent(c, "", "\t")
+	jConfig, _ := json.MarshalIndent(c.Redacted(), "", "\t")
 	return string(jConfig)
 }
 
 var (
-	instance *Config
-	once     sync.Once
-	err      error
+	instance   *Config
+	instanceMu sync.RWMutex
+	configPath string // file the config was loaded from, re-read by Reload
+	metadata   Metadata
+	once       sync.Once
+	err        error
+
+	reloadHooks []func(*Config)
 )
 
+// restartKeys are the settings read once on startup, e.g. to open the database or build the notification senders.
+// A reload changing any of them is rejected.
+var restartKeys = map[string]bool{
+	"host": true, "port": true, "db": true, "dbPath": true, "logFilePath": true, "logFormat": true,
+	"refDataSeedPath": true, "backup": true, "notifications": true, "alerts": true,
+}
+
+// secretKeys are the settings whose values are left out of the changes of a reload
+var secretKeys = map[string]bool{"apiKeys": true}
+
+// Change is a setting changed by a reload, with its values as JSON. Values of secret settings are left out.
+type Change struct {
+	Key    string `json:"key"` // yaml key of the setting, e.g. marketData
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
 // SetConfig sets the singleton Config instance, for testing purposes. Else, config is usually read from a file and created via GetOrCreateConfig.
 func SetConfig(cfg *Config) {
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
 	instance = cfg
 }
 
 // GetOrCreateConfig returns the singleton Config instance, and instantiates it if it hasn't already been done so.
 func GetOrCreateConfig(path string) (*Config, error) {
 	once.Do(func() {
+		instanceMu.Lock()
+		defer instanceMu.Unlock()
 		if instance == nil {
-			var file []byte
-			file, err = os.ReadFile(path)
-			if err != nil {
-				return
+			var provenance map[string]string
+			instance, provenance, err = load(path)
+			configPath = path
+			if err == nil {
+				metadata = Metadata{Path: path, LoadedAt: time.Now(), Provenance: provenance}
 			}
+		}
+	})
 
-			config := Config{}
-			err = yaml.Unmarshal(file, &config)
-			if err != nil {
-				return
-			}
+	instanceMu.RLock()
+	defer instanceMu.RUnlock()
+	return instance, err
+}
 
-			// Set default value for Host if not provided
-			if config.Host == "" {
-				config.Host = "localhost"
-			}
+// OnReload registers a hook called with the new config after each successful reload, e.g. to apply the rate limits.
+func OnReload(hook func(*Config)) {
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
 
-			// Validate the database field
-			if config.Db == "" {
-				config.Db = dal.LDB
-			}
-			if config.Db != dal.LDB && config.Db != dal.RDB {
-				err = errors.New("invalid db type: must be 'leveldb' or 'rocksdb'")
-				return
-			}
-			if config.DbPath == "" {
-				config.DbPath = "./portfolio-manager.db"
-			}
+// Reload re-reads the config file and swaps in the new config, returning the settings which changed. Nothing is
+// changed when the file is invalid or changes a setting read once on startup, such as the port or the database path.
+// Callers of GetOrCreateConfig see the new config from then on, and the reload hooks are called with it.
+func Reload() ([]Change, error) {
+	instanceMu.Lock()
+	if configPath == "" {
+		instanceMu.Unlock()
+		return nil, errors.New("config was not loaded from a file")
+	}
+	next, provenance, loadErr := load(configPath)
+	if loadErr != nil {
+		instanceMu.Unlock()
+		return nil, loadErr
+	}
 
-			instance = &config
+	changes := diff(instance, next)
+	var restart []string
+	for _, change := range changes {
+		if restartKeys[change.Key] {
+			restart = append(restart, change.Key)
 		}
-	})
+	}
+	if len(restart) > 0 {
+		instanceMu.Unlock()
+		return nil, fmt.Errorf("changes to %s require a restart, nothing was reloaded", strings.Join(restart, ", "))
+	}
 
-	return instance, err
+	instance = next
+	metadata = Metadata{Path: configPath, LoadedAt: time.Now(), Provenance: provenance}
+	hooks := slices.Clone(reloadHooks)
+	instanceMu.Unlock()
+
+	for _, hook := range hooks {
+		hook(next)
+	}
+	return changes, nil
+}
+
+// diff returns the top level settings which differ between the configs, in the order of the Config fields.
+func diff(current, next *Config) []Change {
+	if current == nil {
+		current = &Config{}
+	}
+
+	var changes []Change
+	before, after := reflect.ValueOf(*current), reflect.ValueOf(*next)
+	for i := 0; i < before.NumField(); i++ {
+		if reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			continue
+		}
+
+		change := Change{Key: before.Type().Field(i).Tag.Get("yaml")}
+		if !secretKeys[change.Key] {
+			beforeJSON, _ := json.Marshal(before.Field(i).Interface())
+			afterJSON, _ := json.Marshal(after.Field(i).Interface())
+			change.Before, change.After = string(beforeJSON), string(afterJSON)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// load reads and validates the config file, filling in the defaults. The provenance of the settings is returned
+// alongside.
+func load(path string) (*Config, map[string]string, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := Config{}
+	err = yaml.Unmarshal(file, &config)
+	if err != nil {
+		return nil, nil, err
+	}
+	fromFile := config
+
+	// Set default value for Host if not provided
+	if config.Host == "" {
+		config.Host = "localhost"
+	}
+
+	if config.BaseCcy == "" {
+		config.BaseCcy = DefaultBaseCcy
+	}
+
+	// Validate the database field
+	if config.Db == "" {
+		config.Db = dal.LDB
+	}
+	if config.Db != dal.LDB && config.Db != dal.RDB {
+		return nil, nil, errors.New("invalid db type: must be 'leveldb' or 'rocksdb'")
+	}
+	if config.DbPath == "" {
+		config.DbPath = "./portfolio-manager.db"
+	}
+
+	// Validate the lot size check mode
+	if config.LotSizeCheck == "" {
+		config.LotSizeCheck = LotSizeCheckWarn
+	}
+	if config.LotSizeCheck != LotSizeCheckWarn && config.LotSizeCheck != LotSizeCheckBlock {
+		return nil, nil, errors.New("invalid lotSizeCheck: must be 'warn' or 'block'")
+	}
+
+	if config.LogFormat == "" {
+		config.LogFormat = logging.FormatText
+	}
+	if config.LogFormat != logging.FormatText && config.LogFormat != logging.FormatJSON {
+		return nil, nil, errors.New("invalid logFormat: must be 'text' or 'json'")
+	}
+
+	if config.CoinGeckoCacheTtl <= 0 {
+		config.CoinGeckoCacheTtl = 300
+	}
+	if config.PriceStaleAfter == 0 {
+		config.PriceStaleAfter = 96 // covers weekends and public holidays, negative disables the check
+	}
+
+	provenance, err := provenanceOf(file, fromFile, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &config, provenance, nil
 }
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	write("port: 8080\nverboseLogging: false\napiKeys:\n  old:\n    name: alice\n")
+	cfg, _, err := load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	SetConfig(cfg)
+	configPath = path
+	defer func() {
+		SetConfig(nil)
+		configPath = ""
+		reloadHooks = nil
+	}()
+
+	var reloaded *Config
+	OnReload(func(cfg *Config) { reloaded = cfg })
+
+	// Settings read once on startup are rejected
+	write("port: 9090\nverboseLogging: true\napiKeys:\n  old:\n    name: alice\n")
+	if _, err := Reload(); err == nil {
+		t.Fatal("Expected changing the port to be rejected")
+	}
+	if current, _ := GetOrCreateConfig(""); current.VerboseLogging || reloaded != nil {
+		t.Error("Expected nothing to be reloaded when the port changes")
+	}
+
+	write("port: 8080\nverboseLogging: true\napiKeys:\n  new:\n    name: alice\n")
+	changes, err := Reload()
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Key != "verboseLogging" || changes[0].Before != "false" || changes[0].After != "true" {
+		t.Errorf("Unexpected change %+v", changes[0])
+	}
+	if changes[1].Key != "apiKeys" || changes[1].Before != "" || changes[1].After != "" {
+		t.Errorf("Expected the api keys to be left out of the changes, got %+v", changes[1])
+	}
+
+	if current, _ := GetOrCreateConfig(""); !current.VerboseLogging {
+		t.Error("Expected the reloaded config to be served")
+	}
+	if reloaded == nil || !reloaded.VerboseLogging {
+		t.Error("Expected the reload hook to be called with the new config")
+	}
+}
+
+func TestRedactedAndProvenance(t *testing.T) {
+	t.Setenv("SMTP_PASSWORD", "env-smtp-password")
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "port: 8080\napiKeys:\n  admin-key-1234:\n    name: alice\n" +
+		"backup:\n  s3:\n    accessKey: AKIAEXAMPLE9876\n    secretKey: short\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, provenance, err := load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	redacted := cfg.Redacted()
+	if _, ok := redacted.ApiKeys["****1234"]; !ok || len(redacted.ApiKeys) != 1 {
+		t.Errorf("Expected the api key to be redacted, got %v", redacted.ApiKeys)
+	}
+	if redacted.Backup.S3.AccessKey != "****9876" || redacted.Backup.S3.SecretKey != "****" {
+		t.Errorf("Expected the s3 credentials to be redacted, got %+v", redacted.Backup.S3)
+	}
+	if redacted.Notifications.SMTP.Password != "****word" {
+		t.Errorf("Expected the smtp password from the environment to be redacted, got %q", redacted.Notifications.SMTP.Password)
+	}
+	if _, ok := cfg.ApiKeys["admin-key-1234"]; !ok || cfg.Backup.S3.SecretKey != "short" {
+		t.Error("Expected redacting to leave the config untouched")
+	}
+	for _, secret := range []string{"admin-key-1234", "AKIAEXAMPLE9876", "env-smtp-password"} {
+		if strings.Contains(cfg.String(), secret) {
+			t.Errorf("Expected %s to be redacted from the logged config", secret)
+		}
+	}
+
+	for key, expected := range map[string]string{
+		"port":                        ProvenanceFile,
+		"apiKeys":                     ProvenanceFile,
+		"host":                        ProvenanceDefault,
+		"dbPath":                      ProvenanceDefault,
+		"backup.s3.accessKey":         ProvenanceFile,
+		"notifications.smtp.password": ProvenanceEnv,
+	} {
+		if provenance[key] != expected {
+			t.Errorf("Expected %s from %s, got %q", key, expected, provenance[key])
+		}
+	}
+	for _, key := range []string{"alerts", "notifications.telegram.botToken"} {
+		if _, ok := provenance[key]; ok {
+			t.Errorf("Expected unset %s to be missing from the provenance", key)
+		}
+	}
+}
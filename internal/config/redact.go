@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"portfolio-manager/pkg/types"
+)
+
+// Provenance of a setting, i.e. where its effective value came from
+const (
+	ProvenanceFile    = "file"
+	ProvenanceEnv     = "env"
+	ProvenanceDefault = "default"
+)
+
+// secretEnvs are the environment variables read for the secrets missing from the config file, by yaml path
+var secretEnvs = map[string]string{
+	"notifications.smtp.password":     "SMTP_PASSWORD",
+	"notifications.telegram.botToken": "TELEGRAM_BOT_TOKEN",
+	"backup.s3.accessKey":             "AWS_ACCESS_KEY_ID",
+	"backup.s3.secretKey":             "AWS_SECRET_ACCESS_KEY",
+}
+
+// Metadata describes the loaded config.
+type Metadata struct {
+	Path     string    `json:"path"`
+	LoadedAt time.Time `json:"loadedAt"` // time of the last load or reload
+	// Provenance maps the yaml path of each configured setting, e.g. port or notifications.smtp.password, to whether
+	// it came from the file, an environment variable or a default. Settings left unset are missing.
+	Provenance map[string]string `json:"provenance"`
+}
+
+// GetMetadata returns the metadata of the loaded config, which is empty when the config was not loaded from a file.
+func GetMetadata() Metadata {
+	instanceMu.RLock()
+	defer instanceMu.RUnlock()
+	return metadata
+}
+
+// Redacted returns a copy of the config which is safe to display. Secrets, including those read from environment
+// variables by the notification senders and the backup source, are shortened to their last 4 characters, and so are
+// the API keys.
+func (c Config) Redacted() Config {
+	for path, secret := range c.secrets() {
+		if *secret == "" {
+			*secret = os.Getenv(secretEnvs[path])
+		}
+		*secret = redact(*secret)
+	}
+
+	if c.ApiKeys != nil {
+		apiKeys := make(map[string]types.User, len(c.ApiKeys))
+		for key, user := range c.ApiKeys {
+			apiKeys[redact(key)] = user
+		}
+		c.ApiKeys = apiKeys
+	}
+	return c
+}
+
+// secrets returns the secret settings of the config by yaml path.
+func (c *Config) secrets() map[string]*string {
+	return map[string]*string{
+		"notifications.smtp.password":     &c.Notifications.SMTP.Password,
+		"notifications.telegram.botToken": &c.Notifications.Telegram.BotToken,
+		"backup.s3.accessKey":             &c.Backup.S3.AccessKey,
+		"backup.s3.secretKey":             &c.Backup.S3.SecretKey,
+	}
+}
+
+// redact shortens the secret to its last 4 characters, secrets of 8 characters or less are hidden entirely.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+// provenanceOf returns where the settings came from, given the config file, the config as read from the file and the
+// effective config with the defaults filled in.
+func provenanceOf(file []byte, fromFile, effective Config) (map[string]string, error) {
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(file, &keys); err != nil {
+		return nil, err
+	}
+
+	provenance := make(map[string]string)
+	read, filled := reflect.ValueOf(fromFile), reflect.ValueOf(effective)
+	for i := 0; i < read.NumField(); i++ {
+		key := read.Type().Field(i).Tag.Get("yaml")
+		if !reflect.DeepEqual(read.Field(i).Interface(), filled.Field(i).Interface()) {
+			provenance[key] = ProvenanceDefault
+		} else if _, ok := keys[key]; ok {
+			provenance[key] = ProvenanceFile
+		}
+	}
+
+	for path, secret := range effective.secrets() {
+		if *secret != "" {
+			provenance[path] = ProvenanceFile
+		} else if os.Getenv(secretEnvs[path]) != "" {
+			provenance[path] = ProvenanceEnv
+		}
+	}
+	return provenance, nil
+}
@@ -1,5 +1,11 @@
 package dal
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
 // Database defines the interface for database operations.
 type Database interface {
 	Close() error
@@ -7,9 +13,88 @@ type Database interface {
 	Put(key string, v interface{}) error
 	Delete(key string) error
 	GetAllKeysWithPrefix(prefix string) ([]string, error)
+	Iterate(prefix string, fn func(key string, value []byte) error) error
+	Batch() Batch
+}
+
+// Batch collects writes which are applied together on Commit, all or nothing. Nothing is written before Commit, so
+// an abandoned batch leaves the database untouched.
+type Batch interface {
+	Put(key string, v interface{}) error
+	Delete(key string) error
+	Commit() error
+}
+
+// Snapshotter is a database which can be backed up and restored while in use, implemented by LevelDB and RocksDB.
+type Snapshotter interface {
+	// Snapshot writes a consistent copy of the database to dir, which must not exist yet, without pausing writes.
+	Snapshot(dir string) error
+	// Replace verifies the database at dir, written by Snapshot, and swaps it in for the database, keeping the
+	// replaced database at <path>.bak. dir must be on the same filesystem as the database.
+	Replace(dir string) error
+	// Path returns the directory of the database.
+	Path() string
 }
 
 const (
 	LDB = "leveldb"
 	RDB = "rocksdb"
 )
+
+// Open opens the database of the given type at dbPath.
+func Open(dbType, dbPath string) (Database, error) {
+	switch dbType {
+	case LDB:
+		db, err := NewLevelDB(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case RDB:
+		return openRocksDB(dbPath)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+// copyBatchSize is the number of keys Copy writes per batch.
+const copyBatchSize = 1000
+
+// Copy copies every key of src to dst in batches, returning the number of keys copied. Values are copied as the raw
+// JSON both backends store, so they are not decoded into their types. On error, the keys of the batches committed
+// so far remain in dst.
+func Copy(src, dst Database) (int, error) {
+	keys, err := src.GetAllKeysWithPrefix("")
+	if err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for start := 0; start < len(keys); start += copyBatchSize {
+		end := min(start+copyBatchSize, len(keys))
+		batch := dst.Batch()
+		for _, key := range keys[start:end] {
+			var value json.RawMessage
+			if err := src.Get(key, &value); err != nil {
+				return copied, err
+			}
+			if err := batch.Put(key, value); err != nil {
+				return copied, err
+			}
+		}
+		if err := batch.Commit(); err != nil {
+			return copied, err
+		}
+		copied = end
+	}
+	return copied, nil
+}
+
+// TestDbType returns the database type the integration tests run against, set with the PORTFOLIO_TEST_DB environment
+// variable, e.g. PORTFOLIO_TEST_DB=rocksdb go test -tags rocksdb ./...
+func TestDbType() string {
+	if dbType := os.Getenv("PORTFOLIO_TEST_DB"); dbType != "" {
+		return dbType
+	}
+	return LDB
+}
@@ -0,0 +1,212 @@
+package dal
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	Name  string
+	Value float64
+}
+
+// testDbTypes are the backends the interface tests run against, RocksDB is added when built with the rocksdb tag.
+var testDbTypes = []string{LDB}
+
+func TestDatabase(t *testing.T) {
+	for _, dbType := range testDbTypes {
+		t.Run(dbType, func(t *testing.T) {
+			db, err := Open(dbType, filepath.Join(t.TempDir(), "db"))
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.Put("TRADE:2", record{"b", 2}))
+			require.NoError(t, db.Put("TRADE:1", record{"a", 1}))
+			require.NoError(t, db.Put("TRADES", record{"c", 3}))
+			require.NoError(t, db.Put("POSITION:1", record{"d", 4}))
+
+			var got record
+			require.NoError(t, db.Get("TRADE:1", &got))
+			assert.Equal(t, record{"a", 1}, got)
+			assert.Error(t, db.Get("TRADE:3", &got))
+
+			// keys come back in order
+			keys, err := db.GetAllKeysWithPrefix("TRADE:")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"TRADE:1", "TRADE:2"}, keys)
+
+			var iterated []string
+			require.NoError(t, db.Iterate("TRADE:", func(key string, value []byte) error {
+				iterated = append(iterated, key+"="+string(value))
+				return nil
+			}))
+			assert.Equal(t, []string{`TRADE:1={"Name":"a","Value":1}`, `TRADE:2={"Name":"b","Value":2}`}, iterated)
+
+			// iteration stops at the first error
+			stop := errors.New("stop")
+			calls := 0
+			assert.ErrorIs(t, db.Iterate("", func(string, []byte) error { calls++; return stop }), stop)
+			assert.Equal(t, 1, calls)
+
+			loaded, err := ParallelLoad[record](db, "TRADE:")
+			require.NoError(t, err)
+			assert.Equal(t, []record{{"a", 1}, {"b", 2}}, loaded)
+
+			require.NoError(t, db.Delete("TRADE:1"))
+			assert.Error(t, db.Get("TRADE:1", &got))
+			keys, err = db.GetAllKeysWithPrefix("")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"POSITION:1", "TRADE:2", "TRADES"}, keys)
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	for _, dbType := range testDbTypes {
+		t.Run(dbType, func(t *testing.T) {
+			db, err := Open(dbType, filepath.Join(t.TempDir(), "db"))
+			require.NoError(t, err)
+			defer db.Close()
+			require.NoError(t, db.Put("TRADE:1", record{"a", 1}))
+
+			batch := db.Batch()
+			require.NoError(t, batch.Put("TRADE:2", record{"b", 2}))
+			require.NoError(t, batch.Delete("TRADE:1"))
+
+			// nothing is written before the commit
+			var got record
+			assert.Error(t, db.Get("TRADE:2", &got))
+			require.NoError(t, db.Get("TRADE:1", &got))
+
+			require.NoError(t, batch.Commit())
+			keys, err := db.GetAllKeysWithPrefix("TRADE:")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"TRADE:2"}, keys)
+
+			// values that cannot be encoded are rejected when added
+			assert.Error(t, db.Batch().Put("TRADE:3", func() {}))
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	for _, dbType := range testDbTypes {
+		t.Run(dbType, func(t *testing.T) {
+			src, err := NewLevelDB(filepath.Join(t.TempDir(), "src"))
+			require.NoError(t, err)
+			defer src.Close()
+			dst, err := Open(dbType, filepath.Join(t.TempDir(), "dst"))
+			require.NoError(t, err)
+			defer dst.Close()
+
+			require.NoError(t, src.Put("TRADE:1", record{"a", 1}))
+			require.NoError(t, src.Put("HEAD_SEQ", 7))
+
+			copied, err := Copy(src, dst)
+			require.NoError(t, err)
+			assert.Equal(t, 2, copied)
+
+			var got record
+			require.NoError(t, dst.Get("TRADE:1", &got))
+			assert.Equal(t, record{"a", 1}, got)
+			var seqNum int
+			require.NoError(t, dst.Get("HEAD_SEQ", &seqNum))
+			assert.Equal(t, 7, seqNum)
+		})
+	}
+}
+
+func TestSnapshotAndReplace(t *testing.T) {
+	for _, dbType := range testDbTypes {
+		t.Run(dbType, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dbType, filepath.Join(dir, "db"))
+			require.NoError(t, err)
+			defer db.Close()
+			snapshotter, ok := db.(Snapshotter)
+			require.True(t, ok, "%s cannot be backed up", dbType)
+
+			require.NoError(t, db.Put("KEY", "before"))
+			require.NoError(t, snapshotter.Snapshot(filepath.Join(dir, "snapshot")))
+			require.NoError(t, db.Put("KEY", "after"))
+
+			// a directory which is not a database leaves the database untouched
+			assert.Error(t, snapshotter.Replace(t.TempDir()))
+			var value string
+			require.NoError(t, db.Get("KEY", &value))
+			assert.Equal(t, "after", value)
+
+			require.NoError(t, snapshotter.Replace(filepath.Join(dir, "snapshot")))
+			require.NoError(t, db.Get("KEY", &value))
+			assert.Equal(t, "before", value)
+			assert.DirExists(t, snapshotter.Path()+".bak")
+		})
+	}
+}
+
+func TestOpenUnsupported(t *testing.T) {
+	_, err := Open("mysql", t.TempDir())
+	assert.ErrorContains(t, err, "unsupported")
+}
+
+// BenchmarkLoad compares listing the keys then reading each value, against reading keys and values in a single pass.
+func BenchmarkLoad(b *testing.B) {
+	db, err := NewLevelDB(filepath.Join(b.TempDir(), "db"))
+	require.NoError(b, err)
+	defer db.Close()
+
+	batch := db.Batch()
+	for i := 0; i < 30000; i++ {
+		require.NoError(b, batch.Put(fmt.Sprintf("TRADE:%06d", i), record{"trade", float64(i)}))
+	}
+	require.NoError(b, batch.Commit())
+
+	b.Run("keys-then-get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			keys, err := db.GetAllKeysWithPrefix("TRADE:")
+			require.NoError(b, err)
+			_, err = ParallelGet[record](db, keys)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("iterate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := ParallelLoad[record](db, "TRADE:")
+			require.NoError(b, err)
+		}
+	})
+}
+
+func TestObserve(t *testing.T) {
+	ldb, err := NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	require.NoError(t, err)
+	defer ldb.Close()
+
+	var operations []string
+	db := Observe(ldb, func(operation string, duration time.Duration) {
+		operations = append(operations, operation)
+	})
+
+	require.NoError(t, db.Put("TRADE:1", record{"a", 1}))
+	var got record
+	require.NoError(t, db.Get("TRADE:1", &got))
+	_, err = db.GetAllKeysWithPrefix("TRADE:")
+	require.NoError(t, err)
+	require.NoError(t, db.Iterate("TRADE:", func(key string, value []byte) error { return nil }))
+
+	// batch writes are observed once on commit
+	batch := db.Batch()
+	require.NoError(t, batch.Put("TRADE:2", record{"b", 2}))
+	require.NoError(t, batch.Delete("TRADE:1"))
+	require.NoError(t, batch.Commit())
+	require.NoError(t, db.Delete("TRADE:2"))
+
+	assert.Equal(t, []string{OperationPut, OperationGet, OperationKeys, OperationIterate, OperationBatchCommit, OperationDelete}, operations)
+}
@@ -3,13 +3,18 @@ package dal
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type LevelDB struct {
-	db *leveldb.DB
+	db   *leveldb.DB
+	path string
+	mu   sync.RWMutex // held exclusively while the database is being replaced
 }
 
 func NewLevelDB(dbPath string) (*LevelDB, error) {
@@ -17,14 +22,19 @@ func NewLevelDB(dbPath string) (*LevelDB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open LevelDB: %w", err)
 	}
-	return &LevelDB{db}, nil
+	return &LevelDB{db: db, path: dbPath}, nil
 }
 
 func (l *LevelDB) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.db.Close()
 }
 
 func (l *LevelDB) Get(key string, v interface{}) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	data, err := l.db.Get([]byte(key), nil)
 	if err != nil {
 		return fmt.Errorf("failed to get data for key %s: %w", key, err)
@@ -43,6 +53,9 @@ func (l *LevelDB) Put(key string, v interface{}) error {
 		return fmt.Errorf("failed to marshal data for key %s: %w", key, err)
 	}
 
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	err = l.db.Put([]byte(key), data, nil)
 	if err != nil {
 		return fmt.Errorf("failed to put data for key %s: %w", key, err)
@@ -52,6 +65,9 @@ func (l *LevelDB) Put(key string, v interface{}) error {
 }
 
 func (l *LevelDB) Delete(key string) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	err := l.db.Delete([]byte(key), nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete data for key %s: %w", key, err)
@@ -60,8 +76,48 @@ func (l *LevelDB) Delete(key string) error {
 	return nil
 }
 
+// levelDBBatch collects writes into a goleveldb batch, which LevelDB applies atomically.
+type levelDBBatch struct {
+	l     *LevelDB
+	batch *leveldb.Batch
+}
+
+// Batch returns a batch of writes applied together on Commit.
+func (l *LevelDB) Batch() Batch {
+	return &levelDBBatch{l: l, batch: new(leveldb.Batch)}
+}
+
+func (b *levelDBBatch) Put(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data for key %s: %w", key, err)
+	}
+
+	b.batch.Put([]byte(key), data)
+	return nil
+}
+
+func (b *levelDBBatch) Delete(key string) error {
+	b.batch.Delete([]byte(key))
+	return nil
+}
+
+func (b *levelDBBatch) Commit() error {
+	b.l.mu.RLock()
+	defer b.l.mu.RUnlock()
+
+	if err := b.l.db.Write(b.batch, nil); err != nil {
+		return fmt.Errorf("failed to write batch of %d changes: %w", b.batch.Len(), err)
+	}
+	b.batch.Reset()
+	return nil
+}
+
 // GetAllKeysWithPrefix retrieves all keys with the specified prefix.
 func (l *LevelDB) GetAllKeysWithPrefix(prefix string) ([]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
 	defer iter.Release()
 
@@ -76,3 +132,134 @@ func (l *LevelDB) GetAllKeysWithPrefix(prefix string) ([]string, error) {
 
 	return keys, nil
 }
+
+// Iterate calls fn with each key with the prefix and its JSON value in key order, stopping at the first error of fn.
+// The value is only valid during the call.
+func (l *LevelDB) Iterate(prefix string, fn func(key string, value []byte) error) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if err := fn(string(iter.Key()), iter.Value()); err != nil {
+			return err
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate over keys with prefix %s: %w", prefix, err)
+	}
+
+	return nil
+}
+
+// Snapshot copies a consistent snapshot of the database into a new LevelDB at dir, without pausing writes.
+func (l *LevelDB) Snapshot(dir string) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot, err := l.db.GetSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to take snapshot: %w", err)
+	}
+	defer snapshot.Release()
+
+	target, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot database: %w", err)
+	}
+	defer target.Close()
+
+	iter := snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Put(iter.Key(), iter.Value())
+		if batch.Len() >= 1000 {
+			if err := target.Write(batch, nil); err != nil {
+				return fmt.Errorf("failed to write snapshot: %w", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate over snapshot: %w", err)
+	}
+
+	if err := target.Write(batch, nil); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Replace swaps the database with the LevelDB at dir, which must be on the same filesystem as the database.
+// The database is untouched when dir is not a readable LevelDB. The replaced database is kept at <path>.bak, and put
+// back if the new database cannot be opened.
+func (l *LevelDB) Replace(dir string) error {
+	if err := verifyLevelDB(dir); err != nil {
+		return fmt.Errorf("invalid LevelDB at %s: %w", dir, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.db.Close(); err != nil {
+		return fmt.Errorf("failed to close LevelDB: %w", err)
+	}
+
+	backupPath := l.path + ".bak"
+	if err := os.RemoveAll(backupPath); err != nil {
+		return l.reopen(fmt.Errorf("failed to remove %s: %w", backupPath, err))
+	}
+	if err := os.Rename(l.path, backupPath); err != nil {
+		return l.reopen(fmt.Errorf("failed to move database to %s: %w", backupPath, err))
+	}
+	if err := os.Rename(dir, l.path); err != nil {
+		os.Rename(backupPath, l.path)
+		return l.reopen(fmt.Errorf("failed to move %s into place: %w", dir, err))
+	}
+
+	db, err := leveldb.OpenFile(l.path, nil)
+	if err != nil {
+		os.RemoveAll(l.path)
+		os.Rename(backupPath, l.path)
+		return l.reopen(fmt.Errorf("failed to open replaced LevelDB: %w", err))
+	}
+	l.db = db
+
+	return nil
+}
+
+// Path returns the directory of the database.
+func (l *LevelDB) Path() string {
+	return l.path
+}
+
+// verifyLevelDB checks that dir opens as a LevelDB and all of its entries can be read.
+func verifyLevelDB(dir string) error {
+	db, err := leveldb.OpenFile(dir, &opt.Options{ErrorIfMissing: true, Strict: opt.StrictAll})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+	}
+	return iter.Error()
+}
+
+// reopen reopens the database at its path after a failed replace, returning the cause of the failure.
+func (l *LevelDB) reopen(cause error) error {
+	db, err := leveldb.OpenFile(l.path, nil)
+	if err != nil {
+		return fmt.Errorf("%w, and failed to reopen LevelDB: %v", cause, err)
+	}
+	l.db = db
+	return cause
+}
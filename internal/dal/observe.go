@@ -0,0 +1,70 @@
+package dal
+
+import "time"
+
+// Operations of the database reported to the observer
+const (
+	OperationGet         = "get"
+	OperationPut         = "put"
+	OperationDelete      = "delete"
+	OperationKeys        = "keys"
+	OperationIterate     = "iterate"
+	OperationBatchCommit = "batch_commit"
+)
+
+// Observer is called after each operation of the database with its duration.
+type Observer func(operation string, duration time.Duration)
+
+// Observe returns the database reporting the duration of its operations to the observer. Iterate is timed including
+// the callbacks, and batch writes are timed once on Commit.
+func Observe(db Database, observer Observer) Database {
+	return &observedDatabase{Database: db, observer: observer}
+}
+
+type observedDatabase struct {
+	Database
+	observer Observer
+}
+
+func (d *observedDatabase) observe(operation string, start time.Time) {
+	d.observer(operation, time.Since(start))
+}
+
+func (d *observedDatabase) Get(key string, v interface{}) error {
+	defer d.observe(OperationGet, time.Now())
+	return d.Database.Get(key, v)
+}
+
+func (d *observedDatabase) Put(key string, v interface{}) error {
+	defer d.observe(OperationPut, time.Now())
+	return d.Database.Put(key, v)
+}
+
+func (d *observedDatabase) Delete(key string) error {
+	defer d.observe(OperationDelete, time.Now())
+	return d.Database.Delete(key)
+}
+
+func (d *observedDatabase) GetAllKeysWithPrefix(prefix string) ([]string, error) {
+	defer d.observe(OperationKeys, time.Now())
+	return d.Database.GetAllKeysWithPrefix(prefix)
+}
+
+func (d *observedDatabase) Iterate(prefix string, fn func(key string, value []byte) error) error {
+	defer d.observe(OperationIterate, time.Now())
+	return d.Database.Iterate(prefix, fn)
+}
+
+func (d *observedDatabase) Batch() Batch {
+	return &observedBatch{Batch: d.Database.Batch(), db: d}
+}
+
+type observedBatch struct {
+	Batch
+	db *observedDatabase
+}
+
+func (b *observedBatch) Commit() error {
+	defer b.db.observe(OperationBatchCommit, time.Now())
+	return b.Batch.Commit()
+}
@@ -0,0 +1,90 @@
+package dal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ParallelGet retrieves and decodes the values for the given keys using a bounded pool of workers.
+// Results are returned in the same order as the keys, so callers can rely on the key ordering of the database.
+func ParallelGet[T any](db Database, keys []string) ([]T, error) {
+	values := make([]T, len(keys))
+	err := parallelFor(len(keys), func(i int) error {
+		return db.Get(keys[i], &values[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// ParallelLoad reads the values of the keys with the prefix in a single pass of the database, then decodes them
+// using a bounded pool of workers. Results are returned in key order, like ParallelGet, which needs a read per key
+// on top of listing the keys.
+func ParallelLoad[T any](db Database, prefix string) ([]T, error) {
+	var keys []string
+	var data [][]byte
+	err := db.Iterate(prefix, func(key string, value []byte) error {
+		keys = append(keys, key)
+		data = append(data, bytes.Clone(value))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]T, len(data))
+	err = parallelFor(len(data), func(i int) error {
+		if err := json.Unmarshal(data[i], &values[i]); err != nil {
+			return fmt.Errorf("failed to unmarshal data for key %s: %w", keys[i], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// parallelFor calls fn for the indexes 0 to n-1, split into contiguous ranges over a bounded pool of workers. Each
+// worker stops at its first error, and the first error by range is returned.
+func parallelFor(n int, fn func(i int) error) error {
+	if n == 0 {
+		return nil
+	}
+
+	workers := min(runtime.NumCPU(), n)
+	batchSize := (n + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for w := 0; w < workers; w++ {
+		start := w * batchSize
+		end := min(start+batchSize, n)
+		if start >= end {
+			break
+		}
+
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				if err := fn(i); err != nil {
+					errs[w] = err
+					return
+				}
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+//go:build rocksdb
+
+package dal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/linxGnu/grocksdb"
+)
+
+// RocksDB stores values JSON encoded like LevelDB. It needs the RocksDB C library, so it is only built with the
+// rocksdb build tag.
+type RocksDB struct {
+	db   *grocksdb.DB
+	ro   *grocksdb.ReadOptions
+	wo   *grocksdb.WriteOptions
+	path string
+	mu   sync.RWMutex // held exclusively while the database is being replaced
+}
+
+// openRocksDB opens the RocksDB for Open.
+func openRocksDB(dbPath string) (Database, error) {
+	db, err := NewRocksDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func NewRocksDB(dbPath string) (*RocksDB, error) {
+	db, err := openRocksDBFile(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RocksDB: %w", err)
+	}
+	return &RocksDB{db: db, ro: grocksdb.NewDefaultReadOptions(), wo: grocksdb.NewDefaultWriteOptions(), path: dbPath}, nil
+}
+
+// openRocksDBFile opens the RocksDB at dbPath, creating it if missing.
+func openRocksDBFile(dbPath string) (*grocksdb.DB, error) {
+	opts := grocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+	opts.SetCreateIfMissing(true)
+
+	return grocksdb.OpenDb(opts, dbPath)
+}
+
+func (r *RocksDB) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.db.Close()
+	r.ro.Destroy()
+	r.wo.Destroy()
+	return nil
+}
+
+func (r *RocksDB) Get(key string, v interface{}) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	value, err := r.db.Get(r.ro, []byte(key))
+	if err != nil {
+		return fmt.Errorf("failed to get data for key %s: %w", key, err)
+	}
+	defer value.Free()
+
+	if !value.Exists() {
+		return fmt.Errorf("failed to get data for key %s: not found", key)
+	}
+
+	if err = json.Unmarshal(value.Data(), v); err != nil {
+		return fmt.Errorf("failed to unmarshal data for key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (r *RocksDB) Put(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data for key %s: %w", key, err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err = r.db.Put(r.wo, []byte(key), data); err != nil {
+		return fmt.Errorf("failed to put data for key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (r *RocksDB) Delete(key string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err := r.db.Delete(r.wo, []byte(key)); err != nil {
+		return fmt.Errorf("failed to delete data for key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// rocksDBBatch collects writes into a RocksDB write batch, which RocksDB applies atomically.
+type rocksDBBatch struct {
+	r     *RocksDB
+	batch *grocksdb.WriteBatch
+}
+
+// Batch returns a batch of writes applied together on Commit.
+func (r *RocksDB) Batch() Batch {
+	return &rocksDBBatch{r: r, batch: grocksdb.NewWriteBatch()}
+}
+
+func (b *rocksDBBatch) Put(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data for key %s: %w", key, err)
+	}
+
+	b.batch.Put([]byte(key), data)
+	return nil
+}
+
+func (b *rocksDBBatch) Delete(key string) error {
+	b.batch.Delete([]byte(key))
+	return nil
+}
+
+// Commit writes the batch and releases it, the batch cannot be reused.
+func (b *rocksDBBatch) Commit() error {
+	defer b.batch.Destroy()
+
+	b.r.mu.RLock()
+	defer b.r.mu.RUnlock()
+
+	if err := b.r.db.Write(b.r.wo, b.batch); err != nil {
+		return fmt.Errorf("failed to write batch of %d changes: %w", b.batch.Count(), err)
+	}
+	return nil
+}
+
+func (r *RocksDB) GetAllKeysWithPrefix(prefix string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	iter := r.db.NewIterator(r.ro)
+	defer iter.Close()
+
+	var keys []string
+	for iter.Seek([]byte(prefix)); iter.ValidForPrefix([]byte(prefix)); iter.Next() {
+		keys = append(keys, string(iter.Key().Data()))
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over keys with prefix %s: %w", prefix, err)
+	}
+
+	return keys, nil
+}
+
+// Iterate calls fn with each key with the prefix and its JSON value in key order, stopping at the first error of fn.
+// The value is only valid during the call.
+func (r *RocksDB) Iterate(prefix string, fn func(key string, value []byte) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	iter := r.db.NewIterator(r.ro)
+	defer iter.Close()
+
+	for iter.Seek([]byte(prefix)); iter.ValidForPrefix([]byte(prefix)); iter.Next() {
+		if err := fn(string(iter.Key().Data()), iter.Value().Data()); err != nil {
+			return err
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to iterate over keys with prefix %s: %w", prefix, err)
+	}
+
+	return nil
+}
+
+// Snapshot writes a checkpoint of the database to dir, which must not exist yet, without pausing writes. The table
+// files of the checkpoint are hard links when dir is on the same filesystem as the database.
+func (r *RocksDB) Snapshot(dir string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	checkpoint, err := r.db.NewCheckpoint()
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	defer checkpoint.Destroy()
+
+	if err := checkpoint.CreateCheckpoint(dir, 0); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Replace swaps the database with the RocksDB at dir, which must be on the same filesystem as the database.
+// The database is untouched when dir is not a readable RocksDB. The replaced database is kept at <path>.bak, and put
+// back if the new database cannot be opened.
+func (r *RocksDB) Replace(dir string) error {
+	if err := verifyRocksDB(dir); err != nil {
+		return fmt.Errorf("invalid RocksDB at %s: %w", dir, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.db.Close()
+
+	backupPath := r.path + ".bak"
+	if err := os.RemoveAll(backupPath); err != nil {
+		return r.reopen(fmt.Errorf("failed to remove %s: %w", backupPath, err))
+	}
+	if err := os.Rename(r.path, backupPath); err != nil {
+		return r.reopen(fmt.Errorf("failed to move database to %s: %w", backupPath, err))
+	}
+	if err := os.Rename(dir, r.path); err != nil {
+		os.Rename(backupPath, r.path)
+		return r.reopen(fmt.Errorf("failed to move %s into place: %w", dir, err))
+	}
+
+	db, err := openRocksDBFile(r.path)
+	if err != nil {
+		os.RemoveAll(r.path)
+		os.Rename(backupPath, r.path)
+		return r.reopen(fmt.Errorf("failed to open replaced RocksDB: %w", err))
+	}
+	r.db = db
+
+	return nil
+}
+
+// Path returns the directory of the database.
+func (r *RocksDB) Path() string {
+	return r.path
+}
+
+// verifyRocksDB checks that dir opens as a RocksDB and all of its entries can be read.
+func verifyRocksDB(dir string) error {
+	opts := grocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+	opts.SetParanoidChecks(true)
+
+	db, err := grocksdb.OpenDbForReadOnly(opts, dir, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ro := grocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetVerifyChecksums(true)
+
+	iter := db.NewIterator(ro)
+	defer iter.Close()
+	for iter.SeekToFirst(); iter.Valid(); iter.Next() {
+	}
+	return iter.Err()
+}
+
+// reopen reopens the database at its path after a failed replace, returning the cause of the failure.
+func (r *RocksDB) reopen(cause error) error {
+	db, err := openRocksDBFile(r.path)
+	if err != nil {
+		return fmt.Errorf("%w, and failed to reopen RocksDB: %v", cause, err)
+	}
+	r.db = db
+	return cause
+}
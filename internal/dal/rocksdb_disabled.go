@@ -0,0 +1,10 @@
+//go:build !rocksdb
+
+package dal
+
+import "fmt"
+
+// openRocksDB fails without the rocksdb build tag, as RocksDB needs the RocksDB C library, see rocksdb.go.
+func openRocksDB(string) (Database, error) {
+	return nil, fmt.Errorf("%s support is not built in, rebuild with -tags rocksdb", RDB)
+}
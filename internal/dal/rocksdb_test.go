@@ -0,0 +1,7 @@
+//go:build rocksdb
+
+package dal
+
+func init() {
+	testDbTypes = append(testDbTypes, RDB)
+}
@@ -0,0 +1,140 @@
+package dividends
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/scheduler"
+)
+
+// CalendarEntry represents an ex-dividend date of a held ticker.
+type CalendarEntry struct {
+	ExDate          string
+	PayDate         string `json:",omitempty"` // empty when unknown
+	Ticker          string
+	Name            string
+	AmountPerShare  float64
+	Qty             float64
+	EstimatedPayout float64
+}
+
+// DividendsCalendar holds the ex-dividend dates within a date range, and tickers whose sources failed.
+type DividendsCalendar struct {
+	Entries  []CalendarEntry
+	Warnings []string
+}
+
+// GetDividendsCalendar returns the ex-dividend dates of open positions between from and to (inclusive), including
+// future-dated entries, sorted by date, of the books (traders), all books when empty. Tickers whose dividend sources
+// fail are reported as warnings.
+func (dm *DividendsManager) GetDividendsCalendar(from, to time.Time, books []string) (*DividendsCalendar, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("invalid date range: %s is before %s", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+
+	fromStr := from.Format("2006-01-02")
+	toStr := to.Format("2006-01-02")
+	calendar := &DividendsCalendar{Entries: []CalendarEntry{}}
+
+	for ticker, qty := range dm.openQuantities(books) {
+		tickerRef, err := dm.rdata.GetTicker(ticker)
+		if err != nil {
+			calendar.Warnings = append(calendar.Warnings, fmt.Sprintf("%s: %v", ticker, err))
+			continue
+		}
+
+		dividends, err := dm.mdata.GetDividendsMetadataFromTickerRef(tickerRef)
+		if err != nil {
+			calendar.Warnings = append(calendar.Warnings, fmt.Sprintf("%s: %v", ticker, err))
+			continue
+		}
+
+		for _, dividend := range dividends {
+			if dividend.ExDate < fromStr || dividend.ExDate > toStr {
+				continue
+			}
+			calendar.Entries = append(calendar.Entries, CalendarEntry{
+				ExDate:          dividend.ExDate,
+				PayDate:         dividend.PayDate,
+				Ticker:          ticker,
+				Name:            tickerRef.Name,
+				AmountPerShare:  dividend.Amount,
+				Qty:             qty,
+				EstimatedPayout: qty * dividend.Amount * (1 - dividend.WithholdingTax),
+			})
+		}
+	}
+
+	sort.Slice(calendar.Entries, func(i, j int) bool {
+		if calendar.Entries[i].ExDate == calendar.Entries[j].ExDate {
+			return calendar.Entries[i].Ticker < calendar.Entries[j].Ticker
+		}
+		return calendar.Entries[i].ExDate < calendar.Entries[j].ExDate
+	})
+	sort.Strings(calendar.Warnings)
+
+	return calendar, nil
+}
+
+// defaultExDividendTime is the local time of the daily check for ex dates of holdings tomorrow when not configured
+const defaultExDividendTime = "08:00"
+
+// Notifier posts notifications raised by background jobs, e.g. the notifications manager.
+type Notifier interface {
+	Notify(source, message string) error
+}
+
+// StartExDividendSchedule posts the ex dates of open positions falling tomorrow to the notifier once a day at the
+// configured local time until the scheduler is stopped.
+func (dm *DividendsManager) StartExDividendSchedule(sched *scheduler.Scheduler, notifier Notifier) {
+	sched.Every("exdividend", time.Minute, func() error { return dm.runScheduledExDividend(time.Now(), notifier) })
+}
+
+// runScheduledExDividend posts the ex dates of the day after now if the scheduled time of now's day has passed and it
+// has not yet run that day. It returns scheduler.ErrNotDue when it did not run.
+func (dm *DividendsManager) runScheduledExDividend(now time.Time, notifier Notifier) error {
+	day := now.Format("2006-01-02")
+	scheduled, err := time.ParseInLocation("2006-01-02 15:04", day+" "+exDividendTime(), now.Location())
+	if err != nil {
+		logging.GetLogger().Warnf("Invalid ex-dividend check time %s, using %s", exDividendTime(), defaultExDividendTime)
+		scheduled, _ = time.ParseInLocation("2006-01-02 15:04", day+" "+defaultExDividendTime, now.Location())
+	}
+
+	dm.mu.Lock()
+	due := !now.Before(scheduled) && dm.exDividendRanOn != day
+	if due {
+		dm.exDividendRanOn = day
+	}
+	dm.mu.Unlock()
+	if !due {
+		return scheduler.ErrNotDue
+	}
+
+	tomorrow := now.AddDate(0, 0, 1)
+	calendar, err := dm.GetDividendsCalendar(tomorrow, tomorrow, nil)
+	if err != nil {
+		return err
+	}
+	if len(calendar.Entries) == 0 || notifier == nil {
+		return nil
+	}
+
+	var summary []string
+	for _, entry := range calendar.Entries {
+		summary = append(summary, fmt.Sprintf("%s %v per share on %v held, about %.2f", entry.Ticker, entry.AmountPerShare, entry.Qty, entry.EstimatedPayout))
+	}
+	message := fmt.Sprintf("Ex-dividend tomorrow (%s): %s", tomorrow.Format("2006-01-02"), strings.Join(summary, ", "))
+	return notifier.Notify("exdividend", message)
+}
+
+func exDividendTime() string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.Notifications.ExDividendTime == "" {
+		return defaultExDividendTime
+	}
+	return cfg.Notifications.ExDividendTime
+}
@@ -3,16 +3,22 @@ package dividends
 import (
 	"encoding/json"
 	"net/http"
+	"portfolio-manager/internal/blotter"
 	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // HandlePostDividends handles retrieving dividends for a single ticker.
 // @Summary Get dividends for a single ticker
-// @Description Get dividends for a single ticker
+// @Description Get dividends for a single ticker, optionally including the withholding tax expected to be reclaimed
 // @Tags dividends
 // @Accept  json
 // @Produce  json
 // @Param   ticker  body  string  true  "Ticker symbol"
+// @Param   includeReclaims  body  bool  false  "Include expected withholding tax reclaims in the amounts"
 // @Success 200 {array} Dividends
 // @Failure 400 {string} string "ticker is required"
 // @Failure 500 {string} string "failed to calculate dividends"
@@ -20,7 +26,8 @@ import (
 func HandlePostDividends(manager *DividendsManager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var request struct {
-			Ticker string `json:"ticker"`
+			Ticker          string `json:"ticker"`
+			IncludeReclaims bool   `json:"includeReclaims"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, "invalid request payload", http.StatusBadRequest)
@@ -32,9 +39,13 @@ func HandlePostDividends(manager *DividendsManager) http.HandlerFunc {
 			return
 		}
 
-		dividends, err := manager.CalculateDividendsForSingleTicker(request.Ticker)
+		calculate := manager.CalculateDividendsForSingleTicker
+		if request.IncludeReclaims {
+			calculate = manager.CalculateDividendsForSingleTickerWithReclaims
+		}
+		dividends, err := calculate(request.Ticker)
 		if err != nil {
-			logging.GetLogger().Error("Failed to calculate dividends", err)
+			logging.FromContext(r.Context()).Error("Failed to calculate dividends", err)
 			http.Error(w, "failed to calculate dividends", http.StatusInternalServerError)
 			return
 		}
@@ -44,6 +55,228 @@ func HandlePostDividends(manager *DividendsManager) http.HandlerFunc {
 	}
 }
 
+// HandleGetDividendsProjection handles projecting dividend income of open positions.
+// @Summary Project dividend income
+// @Description Project expected dividend and coupon payments of open positions, per ticker and aggregated per month
+// @Tags dividends
+// @Produce  json
+// @Param   book  query  string  false  "Comma separated books (traders) to project, defaults to the books of the API key's user"
+// @Param   months  query  int  false  "Projection horizon in months, defaults to 12"
+// @Success 200 {object} DividendsProjection
+// @Failure 400 {string} string "invalid months"
+// @Failure 403 {string} string "Book not allowed"
+// @Failure 500 {string} string "failed to project dividends"
+// @Router /api/v1/dividends/projection [get]
+func HandleGetDividendsProjection(manager *DividendsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		months := 12
+		if m := r.URL.Query().Get("months"); m != "" {
+			var err error
+			months, err = strconv.Atoi(m)
+			if err != nil || months <= 0 {
+				http.Error(w, "invalid months", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var books []string
+		if book := r.URL.Query().Get("book"); book != "" {
+			books = strings.Split(book, ",")
+		}
+		books, ok := blotter.AuthorizeBooks(w, r, books)
+		if !ok {
+			return
+		}
+
+		projection, err := manager.ProjectDividends(books, months)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to project dividends", err)
+			http.Error(w, "failed to project dividends", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projection)
+	}
+}
+
+// HandleGetDividendsCalendar handles retrieving the ex-dividend calendar of held tickers.
+// @Summary Get the ex-dividend calendar
+// @Description Get ex-dividend dates of open positions in the books of the API key's user within a date range, with estimated payouts based on current quantity
+// @Tags dividends
+// @Produce  json
+// @Param   from  query  string  true  "Start date (YYYYMMDD)"
+// @Param   to  query  string  true  "End date (YYYYMMDD)"
+// @Success 200 {object} DividendsCalendar
+// @Failure 400 {string} string "invalid from or to date"
+// @Failure 403 {string} string "User has no books"
+// @Router /api/v1/dividends/calendar [get]
+func HandleGetDividendsCalendar(manager *DividendsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, err := time.Parse("20060102", r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "invalid from date, expected YYYYMMDD", http.StatusBadRequest)
+			return
+		}
+
+		to, err := time.Parse("20060102", r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "invalid to date, expected YYYYMMDD", http.StatusBadRequest)
+			return
+		}
+
+		books, ok := blotter.AuthorizeBooks(w, r, nil)
+		if !ok {
+			return
+		}
+
+		calendar, err := manager.GetDividendsCalendar(from, to, books)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(calendar)
+	}
+}
+
+// ReclaimRequest marks a dividend event of a book as eligible for a withholding tax reclaim.
+type ReclaimRequest struct {
+	Ticker         string  `json:"ticker"`
+	ExDate         string  `json:"exDate"` // YYYY-MM-DD
+	Book           string  `json:"book"`
+	ExpectedAmount float64 `json:"expectedAmount"`
+	ExpiryDate     string  `json:"expiryDate"` // optional, YYYY-MM-DD
+}
+
+// ReclaimUpdateRequest records the submission or receipt of a withholding tax reclaim.
+type ReclaimUpdateRequest struct {
+	Ticker         string  `json:"ticker"`
+	ExDate         string  `json:"exDate"`
+	Book           string  `json:"book"`
+	SubmittedDate  string  `json:"submittedDate"`
+	ReceivedDate   string  `json:"receivedDate"`
+	ReceivedAmount float64 `json:"receivedAmount"`
+}
+
+// HandleGetReclaims handles listing withholding tax reclaims.
+// @Summary Get withholding tax reclaims
+// @Description Get the withholding tax reclaims of the books of the API key's user with their status (outstanding, received or expired)
+// @Tags dividends
+// @Produce  json
+// @Success 200 {array} Reclaim
+// @Failure 500 {string} string "failed to get reclaims"
+// @Router /api/v1/dividends/reclaims [get]
+func HandleGetReclaims(manager *DividendsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reclaims, err := manager.GetReclaimsForUser(types.UserFromContext(r.Context()))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to get reclaims", err)
+			http.Error(w, "failed to get reclaims", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reclaims)
+	}
+}
+
+// HandlePostReclaim handles marking a dividend event as eligible for a withholding tax reclaim.
+// @Summary Mark a dividend event as reclaim eligible
+// @Description Mark the dividend event of a book's ticker on the ex date as eligible for a reclaim of the expected amount, which cannot exceed the tax withheld on the entitlement quantity
+// @Tags dividends
+// @Accept  json
+// @Produce  json
+// @Param   request  body  ReclaimRequest  true  "Reclaim request"
+// @Success 201 {object} Reclaim
+// @Failure 400 {string} string "invalid request payload"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/dividends/reclaims [post]
+func HandlePostReclaim(manager *DividendsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ReclaimRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if !blotter.AuthorizeBook(w, r, request.Book) {
+			return
+		}
+
+		reclaim, err := manager.MarkReclaimEligible(request.Ticker, request.ExDate, request.Book, request.ExpectedAmount, request.ExpiryDate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(reclaim)
+	}
+}
+
+// HandlePutReclaim handles recording the submission or receipt of a withholding tax reclaim.
+// @Summary Update a withholding tax reclaim
+// @Description Record the submission date, or the receipt date and amount, of a withholding tax reclaim
+// @Tags dividends
+// @Accept  json
+// @Produce  json
+// @Param   request  body  ReclaimUpdateRequest  true  "Reclaim update request"
+// @Success 200 {object} Reclaim
+// @Failure 400 {string} string "invalid request payload"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/dividends/reclaims [put]
+func HandlePutReclaim(manager *DividendsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ReclaimUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if !blotter.AuthorizeBook(w, r, request.Book) {
+			return
+		}
+
+		reclaim, err := manager.UpdateReclaim(request.Ticker, request.ExDate, request.Book, ReclaimUpdate{
+			SubmittedDate:  request.SubmittedDate,
+			ReceivedDate:   request.ReceivedDate,
+			ReceivedAmount: request.ReceivedAmount,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reclaim)
+	}
+}
+
+// HandleGetReclaimsSummary handles summarising withholding tax reclaims.
+// @Summary Summarise withholding tax reclaims
+// @Description Get the outstanding, received and expired reclaim amounts per year (of the ex date) and market of the books of the API key's user
+// @Tags dividends
+// @Produce  json
+// @Success 200 {array} ReclaimSummary
+// @Failure 500 {string} string "failed to summarise reclaims"
+// @Router /api/v1/dividends/reclaims/summary [get]
+func HandleGetReclaimsSummary(manager *DividendsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summary, err := manager.GetReclaimsSummary(types.UserFromContext(r.Context()))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to summarise reclaims", err)
+			http.Error(w, "failed to summarise reclaims", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
 // RegisterHandlers registers the handlers for the dividends service.
 func RegisterHandlers(mux *http.ServeMux, manager *DividendsManager) {
 	mux.HandleFunc("/api/v1/dividends", func(w http.ResponseWriter, r *http.Request) {
@@ -54,4 +287,44 @@ func RegisterHandlers(mux *http.ServeMux, manager *DividendsManager) {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+
+	mux.HandleFunc("/api/v1/dividends/calendar", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleGetDividendsCalendar(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/dividends/projection", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleGetDividendsProjection(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/dividends/reclaims", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleGetReclaims(manager).ServeHTTP(w, r)
+		case http.MethodPost:
+			HandlePostReclaim(manager).ServeHTTP(w, r)
+		case http.MethodPut:
+			HandlePutReclaim(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/dividends/reclaims/summary", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleGetReclaimsSummary(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 }
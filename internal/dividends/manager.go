@@ -7,19 +7,30 @@ import (
 	"portfolio-manager/pkg/common"
 	"portfolio-manager/pkg/mdata"
 	"portfolio-manager/pkg/rdata"
+	"sync"
 )
 
 type DividendsManager struct {
-	db      dal.Database
-	mdata   mdata.MarketDataManager
-	rdata   rdata.ReferenceManager
-	blotter blotter.TradeGetter
+	db              dal.Database
+	mdata           mdata.MarketDataManager
+	rdata           rdata.ReferenceManager
+	blotter         blotter.TradeGetter
+	exDividendRanOn string // day of the last scheduled ex-dividend check
+	mu              sync.Mutex
 }
 
 type Dividends struct {
 	ExDate         string
+	PayDate        string  `json:",omitempty"` // cash settlement date, empty when unknown
+	Qty            float64 // entitlement quantity on the ex date, negative for shorts
 	Amount         float64
 	AmountPerShare float64
+	WithholdingTax float64 // in decimal, withheld from the dividends of long positions only
+	Reclaim        float64 // withholding tax expected to be reclaimed, included in Amount when requested
+	// Split of Amount when known by the data source, e.g. the capital return of REIT distributions
+	Income        *float64 `json:",omitempty"`
+	CapitalReturn *float64 `json:",omitempty"`
+	Other         *float64 `json:",omitempty"`
 }
 
 func NewDividendsManager(db dal.Database, mdata mdata.MarketDataManager, rdata rdata.ReferenceManager, blotter blotter.TradeGetter) *DividendsManager {
@@ -31,7 +42,14 @@ func NewDividendsManager(db dal.Database, mdata mdata.MarketDataManager, rdata r
 	}
 }
 
+// CalculateDividendsForSingleTicker calculates the dividends of the ticker across all books.
 func (dm *DividendsManager) CalculateDividendsForSingleTicker(ticker string) ([]Dividends, error) {
+	return dm.CalculateDividendsForBook(ticker, "")
+}
+
+// CalculateDividendsForBook calculates the dividends of the ticker on the quantity held by the book, all books when
+// book is empty.
+func (dm *DividendsManager) CalculateDividendsForBook(ticker, book string) ([]Dividends, error) {
 	// Get dividends.sg ticker from ticker reference
 	tickerRef, err := dm.rdata.GetTicker(ticker)
 	if err != nil {
@@ -68,6 +86,9 @@ func (dm *DividendsManager) CalculateDividendsForSingleTicker(ticker string) ([]
 		// Calculate total dividend amount for trades with TradeDate < ExDate
 		totalQty := 0.0
 		for i := 0; i < idx; i++ {
+			if book != "" && trades[i].Trader != book {
+				continue
+			}
 			if trades[i].Side == blotter.TradeSideBuy {
 				totalQty += trades[i].Quantity
 			} else {
@@ -75,15 +96,45 @@ func (dm *DividendsManager) CalculateDividendsForSingleTicker(ticker string) ([]
 			}
 		}
 
-		totalAmount := totalQty * dividend.Amount * (1 - dividend.WithholdingTax)
-		if totalAmount > 0 {
+		// short positions pay the gross dividend to the lender of the shares, so the amount is a negative cost
+		factor := totalQty
+		if totalQty > 0 {
+			factor *= 1 - dividend.WithholdingTax
+		}
+		totalAmount := factor * dividend.Amount
+		if totalAmount != 0 {
 			allDividends = append(allDividends, Dividends{
 				ExDate:         dividend.ExDate,
+				PayDate:        dividend.PayDate,
+				Qty:            totalQty,
 				Amount:         totalAmount,
 				AmountPerShare: dividend.Amount,
+				WithholdingTax: dividend.WithholdingTax,
+				Income:         scaleComponent(dividend.Income, factor),
+				CapitalReturn:  scaleComponent(dividend.CapitalReturn, factor),
+				Other:          scaleComponent(dividend.Other, factor),
 			})
 		}
 	}
 
 	return allDividends, nil
 }
+
+// scaleComponent returns the component of the dividend per share scaled to the position, nil when unknown.
+func scaleComponent(perShare *float64, factor float64) *float64 {
+	if perShare == nil {
+		return nil
+	}
+	amount := *perShare * factor
+	return &amount
+}
+
+// CalculateDividendsForSingleTickerWithReclaims calculates the dividends of the ticker like
+// CalculateDividendsForSingleTicker, net of the withholding tax expected to be reclaimed.
+func (dm *DividendsManager) CalculateDividendsForSingleTickerWithReclaims(ticker string) ([]Dividends, error) {
+	dividends, err := dm.CalculateDividendsForSingleTicker(ticker)
+	if err != nil {
+		return nil, err
+	}
+	return dm.addReclaims(ticker, dividends)
+}
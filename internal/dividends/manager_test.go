@@ -1,11 +1,20 @@
 package dividends
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dal"
 	"portfolio-manager/internal/mocks"
 	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/scheduler"
 	"portfolio-manager/pkg/types"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -49,8 +58,8 @@ func TestCalculateDividendsForSingleTickerOnlyBuys(t *testing.T) {
 	assert.Len(t, dividends, 2)
 
 	expectedDividends := []Dividends{
-		{ExDate: "2023-01-01", Amount: 70.0, AmountPerShare: 1.0},
-		{ExDate: "2023-02-01", Amount: 420.0, AmountPerShare: 2.0},
+		{ExDate: "2023-01-01", Qty: 100, Amount: 70.0, AmountPerShare: 1.0, WithholdingTax: 0.3},
+		{ExDate: "2023-02-01", Qty: 300, Amount: 420.0, AmountPerShare: 2.0, WithholdingTax: 0.3},
 	}
 
 	assert.Equal(t, expectedDividends, dividends)
@@ -72,12 +81,53 @@ func TestCalculateDividendsForSingleTickerBuysAndSells(t *testing.T) {
 	assert.Len(t, dividends, 1)
 
 	expectedDividends := []Dividends{
-		{ExDate: "2023-01-01", Amount: 70.0, AmountPerShare: 1.0},
+		{ExDate: "2023-01-01", Qty: 100, Amount: 70.0, AmountPerShare: 1.0, WithholdingTax: 0.3},
 	}
 
 	assert.Equal(t, expectedDividends, dividends)
 }
 
+func TestCalculateDividendsForSingleTickerShort(t *testing.T) {
+	dm, _, blotterMgr, err := setup()
+	assert.NoError(t, err)
+
+	blotterMgr.SetTrades("AAPL", []blotter.Trade{
+		{Ticker: "AAPL", TradeDate: "2022-12-31", Quantity: 100, TradeID: "1", Side: blotter.TradeSideSell},
+	})
+
+	dividends, err := dm.CalculateDividendsForSingleTicker("AAPL")
+	assert.NoError(t, err)
+
+	// shorts pay the gross dividend, without withholding tax
+	expectedDividends := []Dividends{
+		{ExDate: "2023-01-01", Qty: -100, Amount: -100.0, AmountPerShare: 1.0, WithholdingTax: 0.3},
+		{ExDate: "2023-02-01", Qty: -100, Amount: -200.0, AmountPerShare: 2.0, WithholdingTax: 0.3},
+	}
+	assert.Equal(t, expectedDividends, dividends)
+}
+
+func TestCalculateDividendsWithComponents(t *testing.T) {
+	dm, mdataMgr, _, err := setup()
+	assert.NoError(t, err)
+
+	income, capitalReturn := 0.8, 0.2
+	mdataMgr.SetDividendMetadata("AAPL", []types.DividendsMetadata{
+		{Ticker: "AAPL", ExDate: "2023-01-01", Amount: 1.0, WithholdingTax: 0.3, Income: &income, CapitalReturn: &capitalReturn},
+		{Ticker: "AAPL", ExDate: "2023-02-01", Amount: 2.0, WithholdingTax: 0.3},
+	})
+
+	dividends, err := dm.CalculateDividendsForSingleTicker("AAPL")
+	assert.NoError(t, err)
+	assert.Len(t, dividends, 2)
+
+	// components are aggregated per position like the amount, and left nil when unknown
+	assert.InDelta(t, 56.0, *dividends[0].Income, 1e-9)
+	assert.InDelta(t, 14.0, *dividends[0].CapitalReturn, 1e-9)
+	assert.Nil(t, dividends[0].Other)
+	assert.Nil(t, dividends[1].Income)
+	assert.Nil(t, dividends[1].CapitalReturn)
+}
+
 func TestCalculateDividendsForSSB(t *testing.T) {
 	dm, mdataMgr, blotterMgr, err := setup()
 	assert.NoError(t, err)
@@ -114,3 +164,138 @@ func TestCalculateDividendsForSSB(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, dividends, 0)
 }
+
+func TestGetDividendsCalendar(t *testing.T) {
+	dm, mdataMgr, blotterMgr, err := setup()
+	assert.NoError(t, err)
+
+	dm.rdata.AddTicker(rdata.TickerReference{ID: "AAPL", Name: "Apple", DividendsSgTicker: "AAPL"})
+	blotterMgr.SetTrades("MSFT", []blotter.Trade{
+		{Ticker: "MSFT", TradeDate: "2022-12-31", Quantity: 10, TradeID: "3", Side: blotter.TradeSideBuy},
+	})
+	mdataMgr.SetDividendMetadata("AAPL", []types.DividendsMetadata{
+		{Ticker: "AAPL", ExDate: "2023-01-01", Amount: 1.0, WithholdingTax: 0.3},
+		{Ticker: "AAPL", ExDate: "2099-02-01", Amount: 5.0, WithholdingTax: 0.3},
+		{Ticker: "AAPL", ExDate: "2099-05-01", Amount: 2.0, WithholdingTax: 0.3},
+	})
+
+	calendar, err := dm.GetDividendsCalendar(time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2099, 3, 31, 0, 0, 0, 0, time.UTC), nil)
+	assert.NoError(t, err)
+
+	expected := []CalendarEntry{
+		{ExDate: "2099-02-01", Ticker: "AAPL", Name: "Apple", AmountPerShare: 5.0, Qty: 300, EstimatedPayout: 1050},
+	}
+	assert.Equal(t, expected, calendar.Entries)
+
+	// MSFT has no reference data, it is reported instead of failing the calendar
+	assert.Len(t, calendar.Warnings, 1)
+	assert.Contains(t, calendar.Warnings[0], "MSFT")
+}
+
+func TestReclaims(t *testing.T) {
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mdataMgr := mocks.NewMockMarketDataManager()
+	mdataMgr.SetDividendMetadata("AAPL", []types.DividendsMetadata{
+		{Ticker: "AAPL", ExDate: "2023-01-01", Amount: 1.0, WithholdingTax: 0.3},
+		{Ticker: "AAPL", ExDate: "2024-01-01", Amount: 1.0, WithholdingTax: 0.3},
+	})
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAPL", DividendsSgTicker: "AAPL", Domicile: "US"})
+	blotterMgr := mocks.NewMockTradeGetterBlotter()
+	blotterMgr.SetTrades("AAPL", []blotter.Trade{
+		{Ticker: "AAPL", TradeDate: "2022-12-31", Quantity: 100, TradeID: "1", Trader: "traderA", Side: blotter.TradeSideBuy},
+		{Ticker: "AAPL", TradeDate: "2022-12-31", Quantity: 50, TradeID: "2", Trader: "traderB", Side: blotter.TradeSideBuy},
+	})
+	dm := NewDividendsManager(db, mdataMgr, rdataMgr, blotterMgr)
+
+	// reclaims are capped at the tax withheld on the book's entitlement, 100 * 1.0 * 0.3
+	_, err = dm.MarkReclaimEligible("AAPL", "2023-01-01", "traderA", 31, "")
+	assert.Error(t, err)
+	_, err = dm.MarkReclaimEligible("AAPL", "2023-01-05", "traderA", 10, "")
+	assert.Error(t, err)
+
+	reclaim, err := dm.MarkReclaimEligible("AAPL", "2023-01-01", "traderA", 15, "")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), reclaim.Qty)
+	assert.InDelta(t, 30, reclaim.WithheldAmount, 1e-9)
+	assert.Equal(t, ReclaimStatusOutstanding, reclaim.Status)
+
+	_, err = dm.MarkReclaimEligible("AAPL", "2024-01-01", "traderB", 7.5, "2024-06-30")
+	assert.NoError(t, err)
+	_, err = dm.MarkReclaimEligible("AAPL", "2024-01-01", "traderA", 15, "2099-12-31")
+	assert.NoError(t, err)
+
+	reclaim, err = dm.UpdateReclaim("AAPL", "2023-01-01", "traderA", ReclaimUpdate{SubmittedDate: "2023-02-01"})
+	assert.NoError(t, err)
+	assert.Equal(t, ReclaimStatusOutstanding, reclaim.Status)
+	reclaim, err = dm.UpdateReclaim("AAPL", "2023-01-01", "traderA", ReclaimUpdate{ReceivedDate: "2023-09-01", ReceivedAmount: 14})
+	assert.NoError(t, err)
+	assert.Equal(t, ReclaimStatusReceived, reclaim.Status)
+	assert.Equal(t, "2023-02-01", reclaim.SubmittedDate)
+
+	summary, err := dm.GetReclaimsSummary(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ReclaimSummary{
+		{Year: "2023", Market: "US", Received: 14},
+		{Year: "2024", Market: "US", Outstanding: 15, Expired: 7.5},
+	}, summary)
+
+	// users only see and update the reclaims of their books
+	user := &types.User{Name: "bob", Books: []string{"traderB"}}
+	summary, err = dm.GetReclaimsSummary(user)
+	assert.NoError(t, err)
+	assert.Equal(t, []ReclaimSummary{{Year: "2024", Market: "US", Expired: 7.5}}, summary)
+
+	body := `{"ticker":"AAPL","exDate":"2023-01-01","book":"traderA","receivedAmount":1}`
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/dividends/reclaims", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), types.UserKey, user))
+	rr := httptest.NewRecorder()
+	HandlePutReclaim(dm).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/dividends/reclaims", nil)
+	req = req.WithContext(context.WithValue(req.Context(), types.UserKey, user))
+	rr = httptest.NewRecorder()
+	HandleGetReclaims(dm).ServeHTTP(rr, req)
+	var reclaims []Reclaim
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &reclaims))
+	assert.Len(t, reclaims, 1)
+	assert.Equal(t, "traderB", reclaims[0].Book)
+
+	// income net of reclaims adds received and outstanding reclaims, expired ones are lost
+	dividends, err := dm.CalculateDividendsForSingleTickerWithReclaims("AAPL")
+	assert.NoError(t, err)
+	assert.Len(t, dividends, 2)
+	assert.Equal(t, float64(14), dividends[0].Reclaim)
+	assert.InDelta(t, 150*0.7+14, dividends[0].Amount, 1e-9)
+	assert.Equal(t, float64(15), dividends[1].Reclaim)
+}
+
+type recordingNotifier struct {
+	messages []string
+}
+
+func (n *recordingNotifier) Notify(source, message string) error {
+	n.messages = append(n.messages, source+": "+message)
+	return nil
+}
+
+func TestScheduledExDividend(t *testing.T) {
+	dm, _, _, err := setup()
+	assert.NoError(t, err)
+	notifier := &recordingNotifier{}
+
+	// the check runs once a day after the default time, for the ex dates of the next day
+	assert.ErrorIs(t, dm.runScheduledExDividend(time.Date(2099, 1, 31, 7, 0, 0, 0, time.Local), notifier), scheduler.ErrNotDue)
+	assert.NoError(t, dm.runScheduledExDividend(time.Date(2099, 1, 31, 9, 0, 0, 0, time.Local), notifier))
+	assert.ErrorIs(t, dm.runScheduledExDividend(time.Date(2099, 1, 31, 10, 0, 0, 0, time.Local), notifier), scheduler.ErrNotDue)
+	assert.Len(t, notifier.messages, 1)
+	assert.Contains(t, notifier.messages[0], "exdividend: Ex-dividend tomorrow (2099-02-01): AAPL 5 per share on 300 held")
+
+	// nothing is posted on days without ex dates the next day
+	assert.NoError(t, dm.runScheduledExDividend(time.Date(2099, 2, 1, 9, 0, 0, 0, time.Local), notifier))
+	assert.Len(t, notifier.messages, 1)
+}
@@ -0,0 +1,224 @@
+package dividends
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/common"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// defaultSpecialDividendThreshold excludes dividends larger than this multiple of the median as special dividends
+const defaultSpecialDividendThreshold = 2.0
+
+// ProjectedDividend represents an expected dividend or coupon payment.
+type ProjectedDividend struct {
+	Ticker         string
+	ExDate         string
+	PayDate        string `json:",omitempty"` // expected pay date, empty when unknown
+	Qty            float64
+	AmountPerShare float64
+	Amount         float64
+}
+
+// DividendsProjection holds projected payments per ticker and their monthly (yyyy-mm) aggregates.
+type DividendsProjection struct {
+	Tickers  map[string][]ProjectedDividend
+	Monthly  map[string]float64
+	Warnings []string
+}
+
+// ProjectDividends projects dividend and coupon income of open positions over the next horizonMonths.
+// Equities repeat the regular dividends of the last 12 months, while bonds with coupon rate and maturity in
+// reference data follow a semi-annual coupon schedule. No books (traders) projects across all books.
+func (dm *DividendsManager) ProjectDividends(books []string, horizonMonths int) (*DividendsProjection, error) {
+	if horizonMonths <= 0 {
+		return nil, fmt.Errorf("horizon must be positive, got %d", horizonMonths)
+	}
+
+	now := time.Now()
+	horizon := now.AddDate(0, horizonMonths, 0)
+	projection := &DividendsProjection{
+		Tickers: make(map[string][]ProjectedDividend),
+		Monthly: make(map[string]float64),
+	}
+
+	for ticker, qty := range dm.openQuantities(books) {
+		tickerRef, err := dm.rdata.GetTicker(ticker)
+		if err != nil {
+			projection.Warnings = append(projection.Warnings, fmt.Sprintf("%s: %v", ticker, err))
+			continue
+		}
+
+		var projected []ProjectedDividend
+		if tickerRef.AssetClass == rdata.AssetClassBonds && tickerRef.CouponRate > 0 && tickerRef.MaturityDate != "" {
+			projected, err = projectCoupons(tickerRef, qty, now, horizon)
+		} else {
+			projected, err = dm.projectFromMetadata(tickerRef, qty, now, horizon)
+		}
+		if err != nil {
+			logging.GetLogger().Warnf("Failed to project dividends for ticker %s: %v", ticker, err)
+			projection.Warnings = append(projection.Warnings, fmt.Sprintf("%s: %v", ticker, err))
+			continue
+		}
+
+		if len(projected) == 0 {
+			continue
+		}
+		projection.Tickers[ticker] = projected
+		for _, dividend := range projected {
+			projection.Monthly[dividend.ExDate[:7]] += dividend.Amount
+		}
+	}
+
+	return projection, nil
+}
+
+// openQuantities returns the current quantity of each open position in the books, all books when empty, derived
+// from the blotter.
+func (dm *DividendsManager) openQuantities(books []string) map[string]float64 {
+	quantities := make(map[string]float64)
+	for _, trade := range dm.blotter.GetTrades() {
+		if len(books) > 0 && !slices.Contains(books, trade.Trader) {
+			continue
+		}
+		if trade.Side == blotter.TradeSideBuy {
+			quantities[trade.Ticker] += trade.Quantity
+		} else {
+			quantities[trade.Ticker] -= trade.Quantity
+		}
+	}
+
+	for ticker, qty := range quantities {
+		if qty <= 0 {
+			delete(quantities, ticker)
+		}
+	}
+	return quantities
+}
+
+// projectFromMetadata projects dividends using known future entries (e.g. SSB coupons), or else by repeating the
+// regular dividends paid over the last 12 months.
+func (dm *DividendsManager) projectFromMetadata(tickerRef rdata.TickerReference, qty float64, now, horizon time.Time) ([]ProjectedDividend, error) {
+	if tickerRef.DividendsSgTicker == "" && tickerRef.YahooTicker == "" && !common.IsSSB(tickerRef.ID) && !common.IsSgTBill(tickerRef.ID) {
+		return nil, nil
+	}
+
+	metadata, err := dm.mdata.GetDividendsMetadataFromTickerRef(tickerRef)
+	if err != nil {
+		return nil, err
+	}
+
+	nowStr := now.Format("2006-01-02")
+	horizonStr := horizon.Format("2006-01-02")
+	lastYearStr := now.AddDate(-1, 0, 0).Format("2006-01-02")
+
+	var projected []ProjectedDividend
+	var lastYear []types.DividendsMetadata
+	for _, dividend := range metadata {
+		switch {
+		case dividend.ExDate > nowStr && dividend.ExDate <= horizonStr:
+			// already announced or scheduled, e.g. SSB coupons
+			projected = append(projected, newProjectedDividend(tickerRef.ID, dividend.ExDate, dividend.PayDate, qty, dividend))
+		case dividend.ExDate > lastYearStr && dividend.ExDate <= nowStr:
+			lastYear = append(lastYear, dividend)
+		}
+	}
+	if len(projected) > 0 {
+		return projected, nil
+	}
+
+	// repeat last year's regular dividends on the same dates each year until the horizon
+	for _, dividend := range excludeSpecialDividends(lastYear, specialDividendThreshold()) {
+		exDate, err := time.Parse("2006-01-02", dividend.ExDate)
+		if err != nil {
+			continue
+		}
+		payDate, _ := time.Parse("2006-01-02", dividend.PayDate)
+		for years := 1; !exDate.AddDate(years, 0, 0).After(horizon); years++ {
+			// paid on the same date as last year
+			var projectedPayDate string
+			if !payDate.IsZero() {
+				projectedPayDate = payDate.AddDate(years, 0, 0).Format("2006-01-02")
+			}
+			projected = append(projected, newProjectedDividend(tickerRef.ID, exDate.AddDate(years, 0, 0).Format("2006-01-02"), projectedPayDate, qty, dividend))
+		}
+	}
+
+	sort.Slice(projected, func(i, j int) bool {
+		return projected[i].ExDate < projected[j].ExDate
+	})
+	return projected, nil
+}
+
+// projectCoupons projects semi-annual coupons counting back from the bond's maturity date.
+func projectCoupons(tickerRef rdata.TickerReference, qty float64, now, horizon time.Time) ([]ProjectedDividend, error) {
+	maturity, err := time.Parse("2006-01-02", tickerRef.MaturityDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maturity date %s: %w", tickerRef.MaturityDate, err)
+	}
+
+	coupon := types.DividendsMetadata{Amount: tickerRef.CouponRate / 2} // per 100 notional, semi-annual
+	var projected []ProjectedDividend
+	for d := maturity; d.After(now); d = d.AddDate(0, -6, 0) {
+		if !d.After(horizon) {
+			projected = append(projected, newProjectedDividend(tickerRef.ID, d.Format("2006-01-02"), "", qty, coupon))
+		}
+	}
+
+	sort.Slice(projected, func(i, j int) bool {
+		return projected[i].ExDate < projected[j].ExDate
+	})
+	return projected, nil
+}
+
+// excludeSpecialDividends drops dividends larger than threshold times the median dividend.
+func excludeSpecialDividends(dividends []types.DividendsMetadata, threshold float64) []types.DividendsMetadata {
+	if len(dividends) < 2 || threshold <= 0 {
+		return dividends
+	}
+
+	amounts := make([]float64, len(dividends))
+	for i, dividend := range dividends {
+		amounts[i] = dividend.Amount
+	}
+	sort.Float64s(amounts)
+	median := amounts[len(amounts)/2]
+	if len(amounts)%2 == 0 {
+		median = (amounts[len(amounts)/2-1] + amounts[len(amounts)/2]) / 2
+	}
+
+	var regular []types.DividendsMetadata
+	for _, dividend := range dividends {
+		if dividend.Amount <= median*threshold {
+			regular = append(regular, dividend)
+		}
+	}
+	return regular
+}
+
+func newProjectedDividend(ticker, exDate, payDate string, qty float64, dividend types.DividendsMetadata) ProjectedDividend {
+	return ProjectedDividend{
+		Ticker:         ticker,
+		ExDate:         exDate,
+		PayDate:        payDate,
+		Qty:            qty,
+		AmountPerShare: dividend.Amount,
+		Amount:         qty * dividend.Amount * (1 - dividend.WithholdingTax),
+	}
+}
+
+// specialDividendThreshold returns the configured special dividend threshold.
+func specialDividendThreshold() float64 {
+	cfg, err := config.GetOrCreateConfig("")
+	if err != nil || cfg == nil || cfg.DivSpecialThreshold <= 0 {
+		return defaultSpecialDividendThreshold
+	}
+	return cfg.DivSpecialThreshold
+}
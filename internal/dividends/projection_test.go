@@ -0,0 +1,78 @@
+package dividends
+
+import (
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectDividendsRepeatsRegularDividends(t *testing.T) {
+	dm, mdataMgr, _, err := setup()
+	require.NoError(t, err)
+
+	now := time.Now()
+	date := func(months int) string { return now.AddDate(0, months, 0).Format("2006-01-02") }
+	mdataMgr.SetDividendMetadata("AAPL", []types.DividendsMetadata{
+		{Ticker: "AAPL", ExDate: date(-15), Amount: 1.0, WithholdingTax: 0.3}, // older than 12 months
+		{Ticker: "AAPL", ExDate: date(-9), Amount: 1.0, WithholdingTax: 0.3},
+		{Ticker: "AAPL", ExDate: date(-6), Amount: 5.0, WithholdingTax: 0.3}, // special dividend
+		{Ticker: "AAPL", ExDate: date(-3), PayDate: now.AddDate(0, -3, 14).Format("2006-01-02"), Amount: 1.2, WithholdingTax: 0.3},
+	})
+
+	projection, err := dm.ProjectDividends(nil, 12)
+	require.NoError(t, err)
+
+	projected := projection.Tickers["AAPL"]
+	require.Len(t, projected, 2)
+	assert.Equal(t, date(3), projected[0].ExDate)
+	assert.Equal(t, 300.0, projected[0].Qty)
+	assert.InDelta(t, 300*1.0*0.7, projected[0].Amount, 1e-9)
+	assert.Equal(t, date(9), projected[1].ExDate)
+	assert.InDelta(t, 300*1.2*0.7, projected[1].Amount, 1e-9)
+
+	// pay dates are repeated like the ex dates when known
+	assert.Empty(t, projected[0].PayDate)
+	assert.Equal(t, now.AddDate(0, -3, 14).AddDate(1, 0, 0).Format("2006-01-02"), projected[1].PayDate)
+
+	assert.InDelta(t, 300*1.0*0.7, projection.Monthly[date(3)[:7]], 1e-9)
+}
+
+func TestProjectDividendsBondCoupons(t *testing.T) {
+	dm, _, blotterMgr, err := setup()
+	require.NoError(t, err)
+
+	maturity := time.Now().AddDate(2, 0, 0).Format("2006-01-02")
+	dm.rdata.AddTicker(rdata.TickerReference{
+		ID:           "TEMB",
+		AssetClass:   rdata.AssetClassBonds,
+		CouponRate:   1.8,
+		MaturityDate: maturity,
+	})
+	blotterMgr.SetTrades("TEMB", []blotter.Trade{
+		{Ticker: "TEMB", TradeDate: "2023-01-01", Quantity: 1000, TradeID: "3", Side: blotter.TradeSideBuy, Trader: "traderA"},
+	})
+
+	projection, err := dm.ProjectDividends([]string{"traderA"}, 12)
+	require.NoError(t, err)
+	assert.NotContains(t, projection.Tickers, "AAPL", "AAPL trades belong to another book")
+
+	coupons := projection.Tickers["TEMB"]
+	require.Len(t, coupons, 2)
+	for _, coupon := range coupons {
+		assert.Equal(t, 0.9, coupon.AmountPerShare)
+		assert.Equal(t, 900.0, coupon.Amount)
+	}
+}
+
+func TestProjectDividendsInvalidHorizon(t *testing.T) {
+	dm, _, _, err := setup()
+	require.NoError(t, err)
+
+	_, err = dm.ProjectDividends(nil, 0)
+	assert.Error(t, err)
+}
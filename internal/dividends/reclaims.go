@@ -0,0 +1,298 @@
+package dividends
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/types"
+)
+
+// Reclaim statuses, derived from the recorded dates
+const (
+	ReclaimStatusOutstanding = "outstanding"
+	ReclaimStatusReceived    = "received"
+	ReclaimStatusExpired     = "expired" // not received by the expiry date
+)
+
+// Reclaim tracks the reclaim of tax withheld on a dividend event of a book, e.g. under a tax treaty.
+type Reclaim struct {
+	Ticker         string
+	ExDate         string
+	Book           string
+	Market         string  // domicile of the ticker
+	Qty            float64 // entitlement quantity on the ex date
+	WithheldAmount float64
+	ExpectedAmount float64
+	ExpiryDate     string // optional deadline to receive the reclaim
+	SubmittedDate  string
+	ReceivedDate   string
+	ReceivedAmount float64
+	Status         string
+}
+
+// ReclaimUpdate records the progress of a reclaim, empty fields are left unchanged.
+type ReclaimUpdate struct {
+	SubmittedDate  string
+	ReceivedDate   string
+	ReceivedAmount float64
+}
+
+// ReclaimSummary aggregates reclaim amounts of a year (of the ex date) and market.
+type ReclaimSummary struct {
+	Year        string
+	Market      string
+	Outstanding float64 // expected amount of reclaims not yet received
+	Received    float64 // received amount
+	Expired     float64 // expected amount of reclaims not received by their expiry date
+}
+
+// MarkReclaimEligible marks the dividend event of the book's ticker on the ex date as eligible for a reclaim of the
+// expected amount, which cannot exceed the tax withheld on the entitlement quantity.
+func (dm *DividendsManager) MarkReclaimEligible(ticker, exDate, book string, expectedAmount float64, expiryDate string) (*Reclaim, error) {
+	ticker = strings.ToUpper(ticker)
+	if book == "" {
+		return nil, errors.New("book is required")
+	}
+	if expectedAmount <= 0 {
+		return nil, errors.New("expected amount must be positive")
+	}
+	if expiryDate != "" {
+		if _, err := time.Parse("2006-01-02", expiryDate); err != nil {
+			return nil, fmt.Errorf("invalid expiry date %s, expected YYYY-MM-DD", expiryDate)
+		}
+	}
+
+	tickerRef, err := dm.rdata.GetTicker(ticker)
+	if err != nil {
+		return nil, err
+	}
+
+	dividends, err := dm.mdata.GetDividendsMetadataFromTickerRef(tickerRef)
+	if err != nil {
+		return nil, err
+	}
+	var dividend *types.DividendsMetadata
+	for i := range dividends {
+		if dividends[i].ExDate == exDate {
+			dividend = &dividends[i]
+			break
+		}
+	}
+	if dividend == nil {
+		return nil, fmt.Errorf("no dividend of %s with ex date %s", ticker, exDate)
+	}
+
+	qty, err := dm.entitlementQuantity(ticker, book, exDate)
+	if err != nil {
+		return nil, err
+	}
+	withheld := qty * dividend.Amount * dividend.WithholdingTax
+	if expectedAmount > withheld {
+		return nil, fmt.Errorf("expected amount %.2f exceeds the tax withheld of %.2f", expectedAmount, withheld)
+	}
+
+	reclaim := Reclaim{
+		Ticker:         ticker,
+		ExDate:         exDate,
+		Book:           book,
+		Market:         tickerRef.Domicile,
+		Qty:            qty,
+		WithheldAmount: withheld,
+		ExpectedAmount: expectedAmount,
+		ExpiryDate:     expiryDate,
+	}
+	if existing, err := dm.getReclaim(ticker, exDate, book); err == nil {
+		reclaim.SubmittedDate = existing.SubmittedDate
+		reclaim.ReceivedDate = existing.ReceivedDate
+		reclaim.ReceivedAmount = existing.ReceivedAmount
+	}
+
+	if err := dm.db.Put(reclaimKey(ticker, exDate, book), reclaim); err != nil {
+		return nil, err
+	}
+	reclaim.Status = reclaim.status(time.Now())
+	return &reclaim, nil
+}
+
+// UpdateReclaim records the submission or receipt of a reclaim.
+func (dm *DividendsManager) UpdateReclaim(ticker, exDate, book string, update ReclaimUpdate) (*Reclaim, error) {
+	ticker = strings.ToUpper(ticker)
+	reclaim, err := dm.getReclaim(ticker, exDate, book)
+	if err != nil {
+		return nil, fmt.Errorf("no reclaim of %s with ex date %s in book %s", ticker, exDate, book)
+	}
+
+	for _, date := range []string{update.SubmittedDate, update.ReceivedDate} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return nil, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", date)
+		}
+	}
+	if update.SubmittedDate != "" {
+		reclaim.SubmittedDate = update.SubmittedDate
+	}
+	if update.ReceivedDate != "" {
+		reclaim.ReceivedDate = update.ReceivedDate
+		reclaim.ReceivedAmount = update.ReceivedAmount
+	}
+
+	if err := dm.db.Put(reclaimKey(ticker, exDate, book), reclaim); err != nil {
+		return nil, err
+	}
+	reclaim.Status = reclaim.status(time.Now())
+	return reclaim, nil
+}
+
+// GetReclaims returns all reclaims sorted by ex date, with their status as of now.
+func (dm *DividendsManager) GetReclaims() ([]Reclaim, error) {
+	reclaims, err := dal.ParallelLoad[Reclaim](dm.db, string(types.ReclaimKeyPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range reclaims {
+		reclaims[i].Status = reclaims[i].status(now)
+	}
+	sort.Slice(reclaims, func(i, j int) bool {
+		if reclaims[i].ExDate != reclaims[j].ExDate {
+			return reclaims[i].ExDate < reclaims[j].ExDate
+		}
+		return reclaims[i].Ticker < reclaims[j].Ticker
+	})
+	return reclaims, nil
+}
+
+// GetReclaimsForUser returns the reclaims of the books the user may see, all reclaims when user is nil.
+func (dm *DividendsManager) GetReclaimsForUser(user *types.User) ([]Reclaim, error) {
+	reclaims, err := dm.GetReclaims()
+	if err != nil || user == nil {
+		return reclaims, err
+	}
+
+	visible := make([]Reclaim, 0, len(reclaims))
+	for _, reclaim := range reclaims {
+		if user.CanSeeBook(reclaim.Book) {
+			visible = append(visible, reclaim)
+		}
+	}
+	return visible, nil
+}
+
+// GetReclaimsSummary aggregates the outstanding, received and expired reclaim amounts per year and market of the
+// books the user may see, all books when user is nil.
+func (dm *DividendsManager) GetReclaimsSummary(user *types.User) ([]ReclaimSummary, error) {
+	reclaims, err := dm.GetReclaimsForUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []ReclaimSummary{}
+	idx := make(map[[2]string]int)
+	for _, reclaim := range reclaims {
+		bucket := [2]string{reclaim.ExDate[:min(len(reclaim.ExDate), 4)], reclaim.Market}
+		i, ok := idx[bucket]
+		if !ok {
+			i = len(summaries)
+			idx[bucket] = i
+			summaries = append(summaries, ReclaimSummary{Year: bucket[0], Market: bucket[1]})
+		}
+
+		switch reclaim.Status {
+		case ReclaimStatusOutstanding:
+			summaries[i].Outstanding += reclaim.ExpectedAmount
+		case ReclaimStatusReceived:
+			summaries[i].Received += reclaim.ReceivedAmount
+		case ReclaimStatusExpired:
+			summaries[i].Expired += reclaim.ExpectedAmount
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Year != summaries[j].Year {
+			return summaries[i].Year < summaries[j].Year
+		}
+		return summaries[i].Market < summaries[j].Market
+	})
+	return summaries, nil
+}
+
+// addReclaims adds the reclaims of the ticker across books to its dividends, using the received amount once
+// received and the expected amount while outstanding. Expired reclaims add nothing.
+func (dm *DividendsManager) addReclaims(ticker string, dividends []Dividends) ([]Dividends, error) {
+	reclaims, err := dm.GetReclaims()
+	if err != nil {
+		return nil, err
+	}
+
+	byExDate := make(map[string]float64)
+	for _, reclaim := range reclaims {
+		if reclaim.Ticker != ticker {
+			continue
+		}
+		switch reclaim.Status {
+		case ReclaimStatusOutstanding:
+			byExDate[reclaim.ExDate] += reclaim.ExpectedAmount
+		case ReclaimStatusReceived:
+			byExDate[reclaim.ExDate] += reclaim.ReceivedAmount
+		}
+	}
+
+	for i := range dividends {
+		dividends[i].Reclaim = byExDate[dividends[i].ExDate]
+		dividends[i].Amount += dividends[i].Reclaim
+	}
+	return dividends, nil
+}
+
+// entitlementQuantity returns the quantity of the ticker held by the book before the ex date.
+func (dm *DividendsManager) entitlementQuantity(ticker, book, exDate string) (float64, error) {
+	trades, err := dm.blotter.GetTradesByTicker(ticker)
+	if err != nil {
+		return 0, err
+	}
+
+	qty := 0.0
+	for _, trade := range trades[:SearchEarliestTradeIndexAfterExDate(trades, exDate)] {
+		if trade.Trader != book {
+			continue
+		}
+		if trade.Side == blotter.TradeSideBuy {
+			qty += trade.Quantity
+		} else {
+			qty -= trade.Quantity
+		}
+	}
+	if qty <= 0 {
+		return 0, fmt.Errorf("book %s held no %s before %s", book, ticker, exDate)
+	}
+	return qty, nil
+}
+
+func (dm *DividendsManager) getReclaim(ticker, exDate, book string) (*Reclaim, error) {
+	var reclaim Reclaim
+	if err := dm.db.Get(reclaimKey(ticker, exDate, book), &reclaim); err != nil {
+		return nil, err
+	}
+	return &reclaim, nil
+}
+
+// status derives the status of the reclaim as of now.
+func (r Reclaim) status(now time.Time) string {
+	switch {
+	case r.ReceivedDate != "":
+		return ReclaimStatusReceived
+	case r.ExpiryDate != "" && r.ExpiryDate < now.Format("2006-01-02"):
+		return ReclaimStatusExpired
+	default:
+		return ReclaimStatusOutstanding
+	}
+}
+
+func reclaimKey(ticker, exDate, book string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", types.ReclaimKeyPrefix, ticker, exDate, book)
+}
@@ -0,0 +1,210 @@
+package grafana
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/portfolio"
+	"portfolio-manager/pkg/mdata"
+	"portfolio-manager/pkg/types"
+)
+
+// Supported target prefixes, e.g. price:D05.SI or mv:core
+const (
+	TargetPrice = "price"
+	TargetMv    = "mv"
+)
+
+// TargetPortfolio is the name of the mv target summing all books the user may see, i.e. mv:portfolio
+const TargetPortfolio = "portfolio"
+
+// MvHistoryGetter provides the market value history of the mv targets, e.g. the portfolio service.
+type MvHistoryGetter interface {
+	GetMvHistory(user *types.User, book string, from, to time.Time) ([]portfolio.MvPoint, error)
+}
+
+// Service maps Grafana SimpleJSON targets onto the market data, blotter and portfolio services. It is read-only.
+type Service struct {
+	mdata     mdata.MarketDataManager
+	blotter   blotter.TradeGetter
+	positions MvHistoryGetter // optional, mv targets are unsupported when nil
+}
+
+// TimeRange is the dashboard time range sent by Grafana.
+type TimeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Target is a single query target sent by Grafana.
+type Target struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+}
+
+// QueryRequest is the body of a SimpleJSON /query request.
+type QueryRequest struct {
+	Range         TimeRange `json:"range"`
+	Targets       []Target  `json:"targets"`
+	MaxDataPoints int       `json:"maxDataPoints"`
+}
+
+// TimeSeries is a SimpleJSON time series response, each datapoint is [value, unix millis].
+type TimeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// AnnotationRequest is the body of a SimpleJSON /annotations request.
+type AnnotationRequest struct {
+	Range      TimeRange `json:"range"`
+	Annotation struct {
+		Name  string `json:"name"`
+		Query string `json:"query"` // optional ticker filter
+	} `json:"annotation"`
+}
+
+// Annotation is a SimpleJSON annotation, used to surface trades as events.
+type Annotation struct {
+	Annotation interface{} `json:"annotation"`
+	Time       int64       `json:"time"`
+	Title      string      `json:"title"`
+	Text       string      `json:"text"`
+	Tags       []string    `json:"tags"`
+}
+
+// NewService creates a new Grafana compatibility service.
+func NewService(mdata mdata.MarketDataManager, blotter blotter.TradeGetter, positions MvHistoryGetter) *Service {
+	return &Service{
+		mdata:     mdata,
+		blotter:   blotter,
+		positions: positions,
+	}
+}
+
+// Search returns the available targets of the tickers traded in the books the user may see, all books when user is
+// nil, optionally filtered by a case insensitive substring.
+func (s *Service) Search(filter string, user *types.User) []string {
+	candidates := make(map[string]struct{})
+	for _, trade := range blotter.FilterTradesForUser(s.blotter.GetTrades(), user) {
+		candidates[fmt.Sprintf("%s:%s", TargetPrice, trade.Ticker)] = struct{}{}
+		if s.positions != nil {
+			candidates[fmt.Sprintf("%s:%s", TargetMv, trade.Trader)] = struct{}{}
+			candidates[fmt.Sprintf("%s:%s", TargetMv, TargetPortfolio)] = struct{}{}
+		}
+	}
+
+	var targets []string
+	for target := range candidates {
+		if filter == "" || strings.Contains(strings.ToLower(target), strings.ToLower(filter)) {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Query returns the time series of each target within the time range, downsampled to maxDataPoints. The mv targets
+// chart the daily position snapshots of a book, or of the books the user may see for mv:portfolio, all books when
+// user is nil.
+func (s *Service) Query(req QueryRequest, user *types.User) ([]TimeSeries, error) {
+	var series []TimeSeries
+	for _, target := range req.Targets {
+		kind, name, found := strings.Cut(target.Target, ":")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid target %s, expected <kind>:<name>", target.Target)
+		}
+
+		switch kind {
+		case TargetPrice:
+			data, err := s.mdata.GetHistoricalData(name, req.Range.From.Unix(), req.Range.To.Unix())
+			if err != nil {
+				return nil, fmt.Errorf("failed to get prices for %s: %w", name, err)
+			}
+
+			datapoints := make([][2]float64, 0, len(data))
+			for _, d := range data {
+				datapoints = append(datapoints, [2]float64{d.Price, float64(d.Timestamp * 1000)})
+			}
+			series = append(series, TimeSeries{Target: target.Target, Datapoints: downsample(datapoints, req.MaxDataPoints)})
+		case TargetMv:
+			if s.positions == nil {
+				return nil, errors.New("mv targets are not available without the portfolio service")
+			}
+			book := name
+			if book == TargetPortfolio {
+				book = ""
+			} else if user != nil && !user.CanSeeBook(book) {
+				return nil, fmt.Errorf("%w: user %s may not see book %s", blotter.ErrBookNotAllowed, user.Name, book)
+			}
+
+			points, err := s.positions.GetMvHistory(user, book, req.Range.From, req.Range.To)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get market values of %s: %w", name, err)
+			}
+
+			datapoints := make([][2]float64, 0, len(points))
+			for _, point := range points {
+				date, err := time.Parse("2006-01-02", point.Date)
+				if err != nil {
+					continue
+				}
+				datapoints = append(datapoints, [2]float64{point.Mv, float64(date.UnixMilli())})
+			}
+			series = append(series, TimeSeries{Target: target.Target, Datapoints: downsample(datapoints, req.MaxDataPoints)})
+		default:
+			return nil, fmt.Errorf("unsupported target kind %s", kind)
+		}
+	}
+
+	return series, nil
+}
+
+// Annotations returns the trades within the time range in the books the user may see, all books when user is nil,
+// as annotations.
+func (s *Service) Annotations(req AnnotationRequest, user *types.User) ([]Annotation, error) {
+	if req.Range.To.Before(req.Range.From) {
+		return nil, errors.New("invalid time range")
+	}
+
+	ticker := strings.ToUpper(strings.TrimSpace(req.Annotation.Query))
+	annotations := []Annotation{}
+	for _, trade := range blotter.FilterTradesForUser(s.blotter.GetTrades(), user) {
+		if ticker != "" && trade.Ticker != ticker {
+			continue
+		}
+
+		tradeDate, err := time.Parse(time.RFC3339, trade.TradeDate)
+		if err != nil || tradeDate.Before(req.Range.From) || tradeDate.After(req.Range.To) {
+			continue
+		}
+
+		annotations = append(annotations, Annotation{
+			Annotation: req.Annotation,
+			Time:       tradeDate.UnixMilli(),
+			Title:      fmt.Sprintf("%s %s", strings.ToUpper(trade.Side), trade.Ticker),
+			Text:       fmt.Sprintf("%s %v %s @ %v (%s)", trade.Side, trade.Quantity, trade.Ticker, trade.Price, trade.Trader),
+			Tags:       []string{trade.Side, trade.Ticker, trade.Trader},
+		})
+	}
+
+	return annotations, nil
+}
+
+// downsample reduces the datapoints to at most maxDataPoints, keeping the last datapoint of each bucket.
+func downsample(datapoints [][2]float64, maxDataPoints int) [][2]float64 {
+	if maxDataPoints <= 0 || len(datapoints) <= maxDataPoints {
+		return datapoints
+	}
+
+	bucketSize := (len(datapoints) + maxDataPoints - 1) / maxDataPoints
+	sampled := make([][2]float64, 0, maxDataPoints)
+	for end := bucketSize; end < len(datapoints)+bucketSize; end += bucketSize {
+		sampled = append(sampled, datapoints[min(end, len(datapoints))-1])
+	}
+	return sampled
+}
@@ -0,0 +1,138 @@
+package grafana
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/internal/portfolio"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMvHistory serves fixed market values per book.
+type fakeMvHistory map[string][]portfolio.MvPoint
+
+func (f fakeMvHistory) GetMvHistory(user *types.User, book string, from, to time.Time) ([]portfolio.MvPoint, error) {
+	if book != "" {
+		return f[book], nil
+	}
+
+	totals := make(map[string]float64)
+	for trader, points := range f {
+		if user != nil && !user.CanSeeBook(trader) {
+			continue
+		}
+		for _, point := range points {
+			totals[point.Date] += point.Mv
+		}
+	}
+	var points []portfolio.MvPoint
+	for date, mv := range totals {
+		points = append(points, portfolio.MvPoint{Date: date, Mv: mv})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Date < points[j].Date })
+	return points, nil
+}
+
+func setup() (*Service, *mocks.MockMarketDataManager, *mocks.MockTradeGetterBlotter) {
+	mdataMgr := mocks.NewMockMarketDataManager()
+	blotterMgr := mocks.NewMockTradeGetterBlotter()
+	blotterMgr.SetTrades("AAPL", []blotter.Trade{
+		{Ticker: "AAPL", TradeDate: "2024-01-02T00:00:00Z", Side: blotter.TradeSideBuy, Quantity: 10, Price: 185, Trader: "traderA"},
+		{Ticker: "AAPL", TradeDate: "2024-03-01T00:00:00Z", Side: blotter.TradeSideSell, Quantity: 5, Price: 180, Trader: "traderA"},
+	})
+	blotterMgr.SetTrades("D05.SI", []blotter.Trade{
+		{Ticker: "D05.SI", TradeDate: "2024-01-10T00:00:00Z", Side: blotter.TradeSideBuy, Quantity: 100, Price: 33, Trader: "traderA"},
+	})
+
+	positions := fakeMvHistory{
+		"traderA": {{Date: "2024-01-02", Mv: 100}, {Date: "2024-01-03", Mv: 110}},
+		"traderB": {{Date: "2024-01-02", Mv: 50}},
+	}
+	return NewService(mdataMgr, blotterMgr, positions), mdataMgr, blotterMgr
+}
+
+func TestSearch(t *testing.T) {
+	svc, _, _ := setup()
+
+	assert.Equal(t, []string{"mv:portfolio", "mv:traderA", "price:AAPL", "price:D05.SI"}, svc.Search("", nil))
+	assert.Equal(t, []string{"price:D05.SI"}, svc.Search("d05", nil))
+	assert.Empty(t, svc.Search("", &types.User{Name: "bob", Books: []string{"traderB"}}))
+}
+
+func TestQueryDownsamples(t *testing.T) {
+	svc, mdataMgr, _ := setup()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var data []*types.AssetData
+	for i := 0; i < 10; i++ {
+		data = append(data, &types.AssetData{Ticker: "D05.SI", Price: float64(30 + i), Timestamp: start.AddDate(0, 0, i).Unix()})
+	}
+	mdataMgr.HistoricalData["D05.SI"] = data
+
+	series, err := svc.Query(QueryRequest{
+		Range:         TimeRange{From: start, To: start.AddDate(0, 0, 10)},
+		Targets:       []Target{{Target: "price:D05.SI"}},
+		MaxDataPoints: 3,
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.Equal(t, "price:D05.SI", series[0].Target)
+	assert.Len(t, series[0].Datapoints, 3)
+
+	// the last datapoint is always kept
+	last := series[0].Datapoints[2]
+	assert.Equal(t, 39.0, last[0])
+	assert.Equal(t, float64(start.AddDate(0, 0, 9).UnixMilli()), last[1])
+
+	_, err = svc.Query(QueryRequest{Targets: []Target{{Target: "irr:portfolio"}}}, nil)
+	assert.Error(t, err)
+}
+
+func TestQueryMv(t *testing.T) {
+	svc, _, _ := setup()
+
+	req := QueryRequest{Targets: []Target{{Target: "mv:traderA"}, {Target: "mv:portfolio"}}}
+	series, err := svc.Query(req, nil)
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	day := float64(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).UnixMilli())
+	assert.Equal(t, [][2]float64{{100, day}, {110, day + 24*60*60*1000}}, series[0].Datapoints)
+	assert.Equal(t, [2]float64{150, day}, series[1].Datapoints[0])
+
+	// users only chart the books they may see
+	bob := &types.User{Name: "bob", Books: []string{"traderB"}}
+	_, err = svc.Query(req, bob)
+	assert.ErrorIs(t, err, blotter.ErrBookNotAllowed)
+	series, err = svc.Query(QueryRequest{Targets: []Target{{Target: "mv:portfolio"}}}, bob)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]float64{{50, day}}, series[0].Datapoints)
+}
+
+func TestAnnotations(t *testing.T) {
+	svc, _, _ := setup()
+
+	req := AnnotationRequest{Range: TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}}
+	annotations, err := svc.Annotations(req, nil)
+	require.NoError(t, err)
+	assert.Len(t, annotations, 2)
+
+	// users only see the trades of their books
+	annotations, err = svc.Annotations(req, &types.User{Name: "bob", Books: []string{"traderB"}})
+	require.NoError(t, err)
+	assert.Empty(t, annotations)
+
+	req.Annotation.Query = "aapl"
+	annotations, err = svc.Annotations(req, nil)
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	assert.Equal(t, "BUY AAPL", annotations[0].Title)
+}
@@ -0,0 +1,145 @@
+package grafana
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/types"
+)
+
+// HandleTestConnection handles the Grafana datasource connection test.
+// @Summary Grafana datasource connection test
+// @Description Returns 200 so the Grafana SimpleJSON datasource can verify connectivity
+// @Tags grafana
+// @Success 200 {string} string "OK"
+// @Router /api/v1/grafana/ [get]
+func HandleTestConnection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// HandleSearch handles listing the available targets.
+// @Summary Search Grafana targets
+// @Description List the available targets of the tickers and books traded in the books of the API key's user, e.g. price:D05.SI, mv:core or mv:portfolio
+// @Tags grafana
+// @Accept json
+// @Produce json
+// @Success 200 {array} string
+// @Router /api/v1/grafana/search [post]
+func HandleSearch(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Target string `json:"target"`
+		}
+		// body is optional for search
+		json.NewDecoder(r.Body).Decode(&request)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(svc.Search(request.Target, types.UserFromContext(r.Context())))
+	}
+}
+
+// HandleQuery handles querying time series for the requested targets.
+// @Summary Query Grafana time series
+// @Description Returns the time series of each target within the time range, downsampled to maxDataPoints. The mv targets chart the market value of the daily position snapshots.
+// @Tags grafana
+// @Accept json
+// @Produce json
+// @Param request body QueryRequest true "Query request"
+// @Success 200 {array} TimeSeries
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/grafana/query [post]
+func HandleQuery(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request QueryRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		series, err := svc.Query(request, types.UserFromContext(r.Context()))
+		if errors.Is(err, blotter.ErrBookNotAllowed) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+	}
+}
+
+// HandleAnnotations handles returning trades as annotations.
+// @Summary Grafana trade annotations
+// @Description Returns buys and sells in the books of the API key's user within the time range as annotations, optionally filtered by ticker in the annotation query
+// @Tags grafana
+// @Accept json
+// @Produce json
+// @Param request body AnnotationRequest true "Annotation request"
+// @Success 200 {array} Annotation
+// @Failure 400 {string} string "Invalid request payload"
+// @Router /api/v1/grafana/annotations [post]
+func HandleAnnotations(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request AnnotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		annotations, err := svc.Annotations(request, types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(annotations)
+	}
+}
+
+// RegisterHandlers registers the handlers for the Grafana compatibility service.
+func RegisterHandlers(mux *http.ServeMux, svc *Service) {
+	mux.HandleFunc("/api/v1/grafana/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/grafana/" {
+			http.NotFound(w, r)
+			return
+		}
+		HandleTestConnection().ServeHTTP(w, r)
+	})
+
+	mux.HandleFunc("/api/v1/grafana/search", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleSearch(svc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/grafana/query", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleQuery(svc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/grafana/annotations", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleAnnotations(svc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
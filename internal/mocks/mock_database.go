@@ -1,6 +1,10 @@
 package mocks
 
-import "github.com/stretchr/testify/mock"
+import (
+	"portfolio-manager/internal/dal"
+
+	"github.com/stretchr/testify/mock"
+)
 
 // MockDatabase implements dal.Database for testing
 type MockDatabase struct {
@@ -31,4 +35,42 @@ func (m *MockDatabase) GetAllKeysWithPrefix(prefix string) ([]string, error) {
 	return args.Get(0).([]string), args.Error(1)
 }
 
+// Iterate passes the arguments to the expectation, whose Run calls fn with the key/value pairs of the test.
+func (m *MockDatabase) Iterate(prefix string, fn func(key string, value []byte) error) error {
+	args := m.Called(prefix, fn)
+	return args.Error(0)
+}
+
 func (m *MockDatabase) Close() error { return nil }
+
+// Batch returns a batch which applies its writes through Put and Delete on Commit, so the expectations set on them
+// also cover batched writes. Unlike a real batch, a failing write leaves the earlier writes of the batch applied.
+func (m *MockDatabase) Batch() dal.Batch {
+	return &MockBatch{db: m}
+}
+
+// MockBatch implements dal.Batch for testing
+type MockBatch struct {
+	db     *MockDatabase
+	writes []func() error
+}
+
+func (b *MockBatch) Put(key string, value interface{}) error {
+	b.writes = append(b.writes, func() error { return b.db.Put(key, value) })
+	return nil
+}
+
+func (b *MockBatch) Delete(key string) error {
+	b.writes = append(b.writes, func() error { return b.db.Delete(key) })
+	return nil
+}
+
+func (b *MockBatch) Commit() error {
+	for _, write := range b.writes {
+		if err := write(); err != nil {
+			return err
+		}
+	}
+	b.writes = nil
+	return nil
+}
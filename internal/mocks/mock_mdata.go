@@ -2,6 +2,9 @@ package mocks
 
 import (
 	"errors"
+	"io"
+	"time"
+
 	"portfolio-manager/pkg/rdata"
 	"portfolio-manager/pkg/types"
 )
@@ -38,6 +41,14 @@ func (m *MockMarketDataManager) GetAssetPrice(ticker string) (*types.AssetData,
 	return nil, errors.New("mock: unable to fetch stock price")
 }
 
+// GetCachedAssetPrice returns mock asset price data, which is always cached
+func (m *MockMarketDataManager) GetCachedAssetPrice(ticker string) (*types.AssetData, error) {
+	if data, ok := m.AssetPriceData[ticker]; ok {
+		return data, nil
+	}
+	return nil, errors.New("mock: no cached price")
+}
+
 // GetHistoricalData returns mock historical data
 func (m *MockMarketDataManager) GetHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error) {
 	if data, ok := m.HistoricalData[ticker]; ok {
@@ -61,6 +72,90 @@ func (m *MockMarketDataManager) GetDividendsMetadataFromTickerRef(tickerRef rdat
 	return nil, errors.New("mock: unable to fetch dividends metadata")
 }
 
+// InvalidateHistoricalData removes mock historical data
+func (m *MockMarketDataManager) InvalidateHistoricalData(ticker string) error {
+	delete(m.HistoricalData, ticker)
+	return nil
+}
+
+// MoveDividendsMetadata moves mock dividends metadata between ticker ids
+func (m *MockMarketDataManager) MoveDividendsMetadata(from, to rdata.TickerReference, dryRun bool) ([]string, error) {
+	if _, ok := m.DividendsMetadata[from.ID]; !ok {
+		return nil, nil
+	}
+	if !dryRun {
+		m.DividendsMetadata[to.ID] = append(m.DividendsMetadata[to.ID], m.DividendsMetadata[from.ID]...)
+		delete(m.DividendsMetadata, from.ID)
+	}
+	return []string{from.ID + " -> " + to.ID}, nil
+}
+
+// RepairHistoricalGaps mocks repairing gaps in historical data, there are none to repair
+func (m *MockMarketDataManager) RepairHistoricalGaps(ticker string) ([]string, error) {
+	return nil, nil
+}
+
+// GetStats returns empty mock stats
+func (m *MockMarketDataManager) GetStats() types.MarketDataStats {
+	return types.MarketDataStats{}
+}
+
+// SetPriceOverride sets the mock asset price of the ticker
+func (m *MockMarketDataManager) SetPriceOverride(ticker string, price float64, asOf time.Time) (*types.AssetData, error) {
+	data := &types.AssetData{Ticker: ticker, Price: price, Timestamp: asOf.Unix(), Source: "manual"}
+	m.AssetPriceData[ticker] = data
+	return data, nil
+}
+
+// ImportPriceOverrides is not supported by the mock
+func (m *MockMarketDataManager) ImportPriceOverrides(ticker string, r io.Reader) (int, error) {
+	return 0, errors.New("mock: import not supported")
+}
+
+// GetPriceOverrides returns the mock asset price of the ticker
+func (m *MockMarketDataManager) GetPriceOverrides(ticker string) ([]*types.AssetData, error) {
+	if data, ok := m.AssetPriceData[ticker]; ok {
+		return []*types.AssetData{data}, nil
+	}
+	return nil, nil
+}
+
+// DeletePriceOverride deletes the mock asset price of the ticker
+func (m *MockMarketDataManager) DeletePriceOverride(ticker string) error {
+	delete(m.AssetPriceData, ticker)
+	return nil
+}
+
+// ImportCustomDividends is not supported by the mock
+func (m *MockMarketDataManager) ImportCustomDividends(ticker string, r io.Reader) (int, error) {
+	return 0, errors.New("mock: import not supported")
+}
+
+// GetCustomDividends returns no custom dividends, set the mock dividends metadata instead
+func (m *MockMarketDataManager) GetCustomDividends(ticker string) ([]types.DividendsMetadata, error) {
+	return nil, nil
+}
+
+// DeleteCustomDividends is a no-op in the mock
+func (m *MockMarketDataManager) DeleteCustomDividends(ticker string) error {
+	return nil
+}
+
+// GetWithholdingTaxRules returns no rules, set the withholding tax of the mock dividends metadata instead
+func (m *MockMarketDataManager) GetWithholdingTaxRules() (types.WithholdingTaxRules, error) {
+	return types.WithholdingTaxRules{Domiciles: map[string]float64{}, Tickers: map[string]float64{}}, nil
+}
+
+// SetWithholdingTaxOverride is not supported by the mock
+func (m *MockMarketDataManager) SetWithholdingTaxOverride(ticker string, rate float64) error {
+	return errors.New("mock: withholding tax overrides not supported")
+}
+
+// DeleteWithholdingTaxOverride is a no-op in the mock
+func (m *MockMarketDataManager) DeleteWithholdingTaxOverride(ticker string) error {
+	return nil
+}
+
 // SetDividendMetadata sets mock dividends metadata
 func (m *MockMarketDataManager) SetDividendMetadata(ticker string, data []types.DividendsMetadata) {
 	m.DividendsMetadata[ticker] = data
@@ -0,0 +1,94 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"portfolio-manager/pkg/types"
+)
+
+// defaultTestMessage is sent by the test endpoint when no message is given
+const defaultTestMessage = "Test notification, the sender is configured correctly"
+
+// HandleNotificationsGet handles retrieving notifications.
+// @Summary Get notifications
+// @Description Retrieve notifications raised by background jobs, e.g. the scheduled auto-close, newest first
+// @Tags notifications
+// @Produce json
+// @Success 200 {array} Notification
+// @Failure 500 {string} string "Failed to get notifications"
+// @Router /api/v1/notifications [get]
+func HandleNotificationsGet(manager *NotificationsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notifications, err := manager.GetNotifications()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notifications)
+	}
+}
+
+// HandleNotifyTestPost handles sending a test notification.
+// @Summary Send a test notification
+// @Description Send a test message with each configured sender, e.g. email and Telegram, to verify their configuration
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body object false "Optional message, {\"message\": \"...\"}"
+// @Success 200 {array} SendResult
+// @Failure 400 {string} string "No senders configured"
+// @Router /api/v1/notify/test [post]
+func HandleNotifyTestPost(manager *NotificationsManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Message string `json:"message"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+				return
+			}
+		}
+		if request.Message == "" {
+			request.Message = defaultTestMessage
+		}
+
+		results, err := manager.SendTest(request.Message)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// RegisterHandlers registers the handlers for the notifications service.
+func RegisterHandlers(mux *http.ServeMux, manager *NotificationsManager) {
+	mux.HandleFunc("/api/v1/notifications", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleNotificationsGet(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/notify/test", func(w http.ResponseWriter, r *http.Request) {
+		if user := types.UserFromContext(r.Context()); user != nil && !user.Admin {
+			http.Error(w, "ERROR: admin only", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			HandleNotifyTestPost(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
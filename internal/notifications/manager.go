@@ -0,0 +1,148 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+
+	"github.com/google/uuid"
+)
+
+// Notification is a message raised by a background job for the user to review.
+type Notification struct {
+	ID        string
+	Source    string // job which raised the notification, e.g. autoclose
+	Message   string
+	CreatedAt string // RFC3339
+}
+
+// SendResult is the outcome of sending a notification with a sender, Error is empty on success.
+type SendResult struct {
+	Sender string
+	Error  string `json:",omitempty"`
+}
+
+// NotificationsManager persists notifications raised by background jobs, and sends those of the enabled events.
+type NotificationsManager struct {
+	db      dal.Database
+	senders []Sender
+	mu      sync.Mutex
+	logger  *logging.Logger
+}
+
+// NewNotificationsManager creates a new notifications manager.
+func NewNotificationsManager(db dal.Database) *NotificationsManager {
+	return &NotificationsManager{db: db, logger: logging.GetLogger()}
+}
+
+// SetSenders sets the senders notifications are sent with.
+func (nm *NotificationsManager) SetSenders(senders ...Sender) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.senders = senders
+}
+
+// Notify persists a notification from the source, and sends it when the source is an enabled event. Failures to
+// send are logged rather than returned, as the notification is persisted.
+func (nm *NotificationsManager) Notify(source, message string) error {
+	if err := nm.persist(source, message); err != nil {
+		return err
+	}
+	if !eventEnabled(source) {
+		return nil
+	}
+
+	for _, result := range nm.send(source, message) {
+		if result.Error != "" {
+			nm.logger.Warnf("Failed to send %s notification with %s: %s", source, result.Sender, result.Error)
+		}
+	}
+	return nil
+}
+
+// SendTest sends a test message with each sender, to verify their configuration.
+func (nm *NotificationsManager) SendTest(message string) ([]SendResult, error) {
+	results := nm.send("test", message)
+	if len(results) == 0 {
+		return nil, errors.New("no notification senders are configured")
+	}
+	return results, nil
+}
+
+// send sends the message with each sender.
+func (nm *NotificationsManager) send(source, message string) []SendResult {
+	nm.mu.Lock()
+	senders := nm.senders
+	nm.mu.Unlock()
+
+	subject := fmt.Sprintf("Portfolio Manager: %s", source)
+	results := make([]SendResult, 0, len(senders))
+	for _, sender := range senders {
+		result := SendResult{Sender: sender.Name()}
+		if err := sender.Send(subject, message); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (nm *NotificationsManager) persist(source, message string) error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	now := time.Now().UTC()
+	notification := Notification{
+		ID:        uuid.New().String(),
+		Source:    source,
+		Message:   message,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+
+	// keys sort chronologically
+	key := fmt.Sprintf("%s:%s:%s", types.NotificationKeyPrefix, now.Format(time.RFC3339Nano), notification.ID)
+	return nm.db.Put(key, notification)
+}
+
+// GetNotifications returns all notifications, newest first.
+func (nm *NotificationsManager) GetNotifications() ([]Notification, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	keys, err := nm.db.GetAllKeysWithPrefix(string(types.NotificationKeyPrefix) + ":")
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	notifications := make([]Notification, 0, len(keys))
+	for _, key := range keys {
+		var notification Notification
+		if err := nm.db.Get(key, &notification); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+// eventEnabled returns whether notifications of the source are sent, all are when no events are configured.
+func eventEnabled(source string) bool {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || len(cfg.Notifications.Events) == 0 {
+		return true
+	}
+	for _, event := range cfg.Notifications.Events {
+		if event == source {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package notifications_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/internal/notifications"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyAndGetNotifications(t *testing.T) {
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "notifications.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	manager := notifications.NewNotificationsManager(db)
+	notifs, err := manager.GetNotifications()
+	assert.NoError(t, err)
+	assert.Empty(t, notifs)
+
+	assert.NoError(t, manager.Notify("autoclose", "first"))
+	assert.NoError(t, manager.Notify("autoclose", "second"))
+
+	notifs, err = manager.GetNotifications()
+	assert.NoError(t, err)
+	assert.Len(t, notifs, 2)
+	assert.Equal(t, "second", notifs[0].Message)
+	assert.Equal(t, "first", notifs[1].Message)
+	assert.Equal(t, "autoclose", notifs[0].Source)
+	assert.NotEmpty(t, notifs[0].ID)
+}
+
+type fakeSender struct {
+	err      error
+	subjects []string
+}
+
+func (s *fakeSender) Name() string {
+	return "fake"
+}
+
+func (s *fakeSender) Send(subject, message string) error {
+	s.subjects = append(s.subjects, subject)
+	return s.err
+}
+
+func TestNotifySendsEnabledEvents(t *testing.T) {
+	config.SetConfig(&config.Config{Notifications: config.NotificationsConfig{Events: []string{"backup"}}})
+	defer config.SetConfig(nil)
+
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "notifications.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	manager := notifications.NewNotificationsManager(db)
+	_, err = manager.SendTest("hello")
+	assert.Error(t, err)
+
+	sender := &fakeSender{}
+	manager.SetSenders(sender)
+	assert.NoError(t, manager.Notify("autoclose", "closed"))
+	assert.NoError(t, manager.Notify("backup", "failed"))
+	assert.Equal(t, []string{"Portfolio Manager: backup"}, sender.subjects)
+
+	// every notification is persisted, and failures to send do not fail it
+	sender.err = errors.New("unreachable")
+	assert.NoError(t, manager.Notify("backup", "failed again"))
+	notifs, err := manager.GetNotifications()
+	assert.NoError(t, err)
+	assert.Len(t, notifs, 3)
+
+	results, err := manager.SendTest("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []notifications.SendResult{{Sender: "fake", Error: "unreachable"}}, results)
+}
@@ -0,0 +1,159 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/config"
+)
+
+const (
+	defaultSMTPPort    = 587
+	defaultTelegramURL = "https://api.telegram.org"
+)
+
+// Sender delivers notifications outside the application, e.g. by email.
+type Sender interface {
+	Name() string
+	Send(subject, message string) error
+}
+
+// NewSenders creates the senders configured, none when neither SMTP nor Telegram is configured. Credentials missing
+// from config are read from the SMTP_PASSWORD and TELEGRAM_BOT_TOKEN environment variables.
+func NewSenders(cfg config.NotificationsConfig) ([]Sender, error) {
+	var senders []Sender
+	if cfg.SMTP.Host != "" {
+		sender, err := NewSMTPSender(cfg.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, sender)
+	}
+	if cfg.Telegram.ChatID != "" {
+		sender, err := NewTelegramSender(cfg.Telegram)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, sender)
+	}
+	return senders, nil
+}
+
+// SMTPSender emails notifications through an SMTP server, with STARTTLS when the server offers it.
+type SMTPSender struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPSender creates an email sender.
+func NewSMTPSender(cfg config.SMTPConfig) (*SMTPSender, error) {
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("smtp sender requires a from and to address")
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	password := cfg.Password
+	if password == "" {
+		password = os.Getenv("SMTP_PASSWORD")
+	}
+
+	return &SMTPSender{
+		addr:     net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		host:     cfg.Host,
+		username: cfg.Username,
+		password: password,
+		from:     cfg.From,
+		to:       cfg.To,
+	}, nil
+}
+
+// Name returns the name of the sender.
+func (s *SMTPSender) Name() string {
+	return "smtp"
+}
+
+// Send emails the message to the recipients.
+func (s *SMTPSender) Send(subject, message string) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.from, strings.Join(s.to, ", "), subject, message)
+	if err := smtp.SendMail(s.addr, auth, s.from, s.to, []byte(body)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// TelegramSender posts notifications to a Telegram chat through a bot.
+type TelegramSender struct {
+	baseURL string
+	token   string
+	chatID  string
+	client  *http.Client
+}
+
+// NewTelegramSender creates a Telegram bot sender.
+func NewTelegramSender(cfg config.TelegramConfig) (*TelegramSender, error) {
+	token := cfg.BotToken
+	if token == "" {
+		token = os.Getenv("TELEGRAM_BOT_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("telegram sender requires a bot token")
+	}
+
+	return &TelegramSender{
+		baseURL: defaultTelegramURL,
+		token:   token,
+		chatID:  cfg.ChatID,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name returns the name of the sender.
+func (s *TelegramSender) Name() string {
+	return "telegram"
+}
+
+// Send posts the message to the chat.
+func (s *TelegramSender) Send(subject, message string) error {
+	payload, err := json.Marshal(map[string]string{"chat_id": s.chatID, "text": subject + "\n\n" + message})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(fmt.Sprintf("%s/bot%s/sendMessage", s.baseURL, s.token), "application/json", bytes.NewReader(payload))
+	if err != nil {
+		// the url holds the bot token, so it is left out of the error
+		return errors.New("failed to reach telegram")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Description string `json:"description"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return fmt.Errorf("telegram returned %s: %s", resp.Status, result.Description)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"portfolio-manager/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelegramSender(t *testing.T) {
+	var path string
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["chat_id"] != "42" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewTelegramSender(config.TelegramConfig{BotToken: "token", ChatID: "42"})
+	require.NoError(t, err)
+	sender.baseURL = server.URL
+
+	assert.NoError(t, sender.Send("Portfolio Manager: test", "hello"))
+	assert.Equal(t, "/bottoken/sendMessage", path)
+	assert.Equal(t, "Portfolio Manager: test\n\nhello", payload["text"])
+
+	sender.chatID = "7"
+	assert.ErrorContains(t, sender.Send("Portfolio Manager: test", "hello"), "chat not found")
+}
+
+func TestNewSenders(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+
+	senders, err := NewSenders(config.NotificationsConfig{})
+	assert.NoError(t, err)
+	assert.Empty(t, senders)
+
+	_, err = NewSenders(config.NotificationsConfig{Telegram: config.TelegramConfig{ChatID: "42"}})
+	assert.Error(t, err)
+	_, err = NewSenders(config.NotificationsConfig{SMTP: config.SMTPConfig{Host: "smtp.example.com"}})
+	assert.Error(t, err)
+
+	senders, err = NewSenders(config.NotificationsConfig{
+		SMTP:     config.SMTPConfig{Host: "smtp.example.com", From: "pm@example.com", To: []string{"me@example.com"}},
+		Telegram: config.TelegramConfig{BotToken: "token", ChatID: "42"},
+	})
+	assert.NoError(t, err)
+	require.Len(t, senders, 2)
+	assert.Equal(t, "smtp.example.com:587", senders[0].(*SMTPSender).addr)
+	assert.Equal(t, "telegram", senders[1].Name())
+}
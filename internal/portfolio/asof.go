@@ -0,0 +1,196 @@
+package portfolio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+)
+
+// asOfPriceLookback is how far back the last close before the as-of date is searched, covering weekends and holidays.
+const asOfPriceLookback = 10 * 24 * time.Hour
+
+// AsOfHolding is a holding of a book as of a date, valued at that date's close. Amounts are in the ticker's currency,
+// except those suffixed Base, which are converted at that date's FX rate.
+type AsOfHolding struct {
+	Book               string
+	Ticker             string
+	Ccy                string
+	Qty                float64
+	AvgCost            float64
+	CostBasis          float64
+	Close              float64
+	Mv                 float64
+	UnrealizedGain     float64
+	Fx                 float64 // rate of the currency to the base currency
+	CostBasisBase      float64
+	MvBase             float64
+	UnrealizedGainBase float64
+}
+
+// AsOfReport holds the holdings as of a date and their totals in the base currency.
+type AsOfReport struct {
+	Date                string
+	BaseCcy             string
+	Holdings            []AsOfHolding
+	TotalCostBasis      float64
+	TotalMv             float64
+	TotalUnrealizedGain float64
+	Warnings            []string // holdings which could not be valued, excluded from the totals
+}
+
+// GetAsOfReport replays the blotter up to and including the date to derive the quantity and average cost of each
+// holding, and values them with the close and FX rate of that date. Holdings closed by the date are excluded. An
+// empty books filter includes all books.
+func (p *Portfolio) GetAsOfReport(date time.Time, books []string) (*AsOfReport, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+
+	dateStr := date.Format("2006-01-02")
+	bookFilter := make(map[string]struct{}, len(books))
+	for _, book := range books {
+		bookFilter[book] = struct{}{}
+	}
+
+	positions := make(map[[2]string]*Position)
+	for _, trade := range p.blotter.GetTradesByFilter(blotter.TradeFilter{To: dateStr}) {
+		if _, ok := bookFilter[trade.Trader]; len(bookFilter) > 0 && !ok {
+			continue
+		}
+		key := [2]string{trade.Trader, trade.Ticker}
+		if _, ok := positions[key]; !ok {
+			positions[key] = &Position{Trader: trade.Trader, Ticker: trade.Ticker}
+		}
+		applyTrade(positions[key], &trade, p.contractMultiplier(trade.Ticker))
+	}
+
+	report := &AsOfReport{Date: dateStr, BaseCcy: blotter.BaseCurrency(), Holdings: []AsOfHolding{}}
+	for _, position := range positions {
+		if position.Qty == 0 {
+			continue
+		}
+
+		holding, err := p.valueAsOf(position, date, report.BaseCcy)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %s: %v", position.Trader, position.Ticker, err))
+			continue
+		}
+		report.Holdings = append(report.Holdings, *holding)
+		report.TotalCostBasis += holding.CostBasisBase
+		report.TotalMv += holding.MvBase
+		report.TotalUnrealizedGain += holding.UnrealizedGainBase
+	}
+
+	sort.Slice(report.Holdings, func(i, j int) bool {
+		if report.Holdings[i].Book != report.Holdings[j].Book {
+			return report.Holdings[i].Book < report.Holdings[j].Book
+		}
+		return report.Holdings[i].Ticker < report.Holdings[j].Ticker
+	})
+	sort.Strings(report.Warnings)
+	return report, nil
+}
+
+// valueAsOf values the position with the close and FX rate of the date, priced according to its enrichment strategy.
+func (p *Portfolio) valueAsOf(position *Position, date time.Time, baseCcy string) (*AsOfHolding, error) {
+	tickerRef, err := p.rdata.GetTicker(position.Ticker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reference data: %w", err)
+	}
+
+	var price float64
+	switch p.enrichmentStrategy(tickerRef.AssetClass) {
+	case EnrichParValued:
+		price = 1
+	case EnrichManualOnly:
+		price = position.AvgPx
+	default:
+		price, err = p.closeAsOf(position.Ticker, date)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fx := 1.0
+	if tickerRef.Ccy != "" && tickerRef.Ccy != baseCcy {
+		fx, err = p.closeAsOf(fmt.Sprintf("%s-%s", tickerRef.Ccy, baseCcy), date)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	multiplier := tickerRef.GetContractMultiplier()
+	costBasis := position.AvgPx * position.Qty * multiplier
+	mv := price * position.Qty * multiplier
+	return &AsOfHolding{
+		Book:               position.Trader,
+		Ticker:             position.Ticker,
+		Ccy:                tickerRef.Ccy,
+		Qty:                position.Qty,
+		AvgCost:            position.AvgPx,
+		CostBasis:          costBasis,
+		Close:              price,
+		Mv:                 mv,
+		UnrealizedGain:     mv - costBasis,
+		Fx:                 fx,
+		CostBasisBase:      costBasis * fx,
+		MvBase:             mv * fx,
+		UnrealizedGainBase: (mv - costBasis) * fx,
+	}, nil
+}
+
+// closeAsOf returns the last close of the ticker on or before the date.
+func (p *Portfolio) closeAsOf(ticker string, date time.Time) (float64, error) {
+	to := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 0, time.UTC)
+	history, err := p.mdata.GetHistoricalData(ticker, to.Add(-asOfPriceLookback).Unix(), to.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get historical prices of %s: %w", ticker, err)
+	}
+
+	var last float64
+	var lastTime int64
+	for _, bar := range history {
+		if bar.Timestamp <= to.Unix() && bar.Timestamp >= lastTime {
+			last, lastTime = bar.Price, bar.Timestamp
+		}
+	}
+	if lastTime == 0 {
+		return 0, fmt.Errorf("no close of %s on or before %s", ticker, date.Format("2006-01-02"))
+	}
+	return last, nil
+}
+
+// ToCSV writes the holdings of the report followed by a total row.
+func (r *AsOfReport) ToCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := []string{"Book", "Ticker", "Ccy", "Qty", "AvgCost", "CostBasis", "Close", "Mv", "UnrealizedGain", "Fx",
+		"CostBasis" + r.BaseCcy, "Mv" + r.BaseCcy, "UnrealizedGain" + r.BaseCcy}
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("error writing CSV header: %w", err)
+	}
+
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	for _, h := range r.Holdings {
+		record := []string{h.Book, h.Ticker, h.Ccy, format(h.Qty), format(h.AvgCost), format(h.CostBasis), format(h.Close),
+			format(h.Mv), format(h.UnrealizedGain), format(h.Fx), format(h.CostBasisBase), format(h.MvBase), format(h.UnrealizedGainBase)}
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("error writing CSV record: %w", err)
+		}
+	}
+
+	total := []string{"Total", "", r.BaseCcy, "", "", "", "", "", "", "", format(r.TotalCostBasis), format(r.TotalMv), format(r.TotalUnrealizedGain)}
+	if err := writer.Write(total); err != nil {
+		return nil, fmt.Errorf("error writing CSV record: %w", err)
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
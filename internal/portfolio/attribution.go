@@ -0,0 +1,191 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"portfolio-manager/internal/blotter"
+)
+
+// Attribution decomposes PnL in the base currency. With local prices p0 and p1 and FX rates x0 and x1 of the
+// currency to the base currency, q * (p1*x1 - p0*x0) is the sum of the local price return q * (p1-p0) * x0, the FX
+// return q * p0 * (x1-x0) and the cross term q * (p1-p0) * (x1-x0).
+type Attribution struct {
+	Price     float64
+	Fx        float64
+	Cross     float64
+	Dividends float64 // converted at the current FX rate
+	Total     float64
+}
+
+func (a *Attribution) add(other Attribution) {
+	a.Price += other.Price
+	a.Fx += other.Fx
+	a.Cross += other.Cross
+	a.Dividends += other.Dividends
+	a.Total += other.Total
+}
+
+// attribute adds the return of qty bought at p0 and x0 and sold, or valued, at p1 and x1.
+func (a *Attribution) attribute(qty, p0, x0, p1, x1 float64) {
+	a.Price += qty * (p1 - p0) * x0
+	a.Fx += qty * p0 * (x1 - x0)
+	a.Cross += qty * (p1 - p0) * (x1 - x0)
+}
+
+// PositionAttribution is the attribution of the realized and unrealized PnL of a position.
+type PositionAttribution struct {
+	Book   string
+	Ticker string
+	Ccy    string
+	Qty    float64
+	Attribution
+	FxDefaulted bool // trades without an FX rate were attributed at 1
+}
+
+// AttributionReport holds the attribution of the positions of a book, and its totals per currency and overall.
+type AttributionReport struct {
+	Book      string
+	BaseCcy   string
+	Positions []PositionAttribution
+	ByCcy     map[string]Attribution
+	Total     Attribution
+	Warnings  []string
+}
+
+// GetAttribution decomposes the PnL of each position of the book in the base currency into local price return, FX
+// return, cross term and dividends. Trades are attributed at the FX rate stored on the trade, open quantities are
+// valued at the current price and FX rate. Closed quantities are attributed at the price and FX rate of the closing
+// trade against the average cost and FX rate of the position. Trades in a foreign currency without an FX rate are
+// attributed at 1 and flagged.
+func (p *Portfolio) GetAttribution(book string) (*AttributionReport, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+
+	positions, err := p.GetPositions(book)
+	if err != nil {
+		// positions which fail to enrich are reported below when left without a market value
+		p.logger.Warnf("Failed to enrich positions for attribution: %v", err)
+	}
+	current := make(map[string]*Position, len(positions))
+	for _, position := range positions {
+		current[position.Ticker] = position
+	}
+
+	report := &AttributionReport{
+		Book:      book,
+		BaseCcy:   blotter.BaseCurrency(),
+		Positions: []PositionAttribution{},
+		ByCcy:     make(map[string]Attribution),
+	}
+
+	lots := make(map[string]*attributionLot)
+	attributions := make(map[string]*PositionAttribution)
+	for _, trade := range p.blotter.GetTradesByFilter(blotter.TradeFilter{Trader: book}) {
+		attribution, ok := attributions[trade.Ticker]
+		if !ok {
+			tickerRef, err := p.rdata.GetTicker(trade.Ticker)
+			if err != nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s: no reference data, excluded", trade.Ticker))
+				attributions[trade.Ticker] = nil
+				continue
+			}
+			attribution = &PositionAttribution{Book: book, Ticker: trade.Ticker, Ccy: tickerRef.Ccy}
+			attributions[trade.Ticker] = attribution
+			lots[trade.Ticker] = &attributionLot{}
+		}
+		if attribution == nil {
+			continue
+		}
+
+		fx := trade.Fx
+		if attribution.Ccy == "" || attribution.Ccy == report.BaseCcy {
+			fx = 1
+		} else if fx <= 0 {
+			fx = 1
+			attribution.FxDefaulted = true
+		}
+
+		// lots are tracked in units of the underlying, so contract multipliers carry through the attribution
+		qty := trade.Quantity * p.contractMultiplier(trade.Ticker)
+		if trade.Side == blotter.TradeSideSell {
+			qty = -qty
+		}
+		lots[trade.Ticker].apply(qty, trade.Price, fx, &attribution.Attribution)
+	}
+
+	for ticker, attribution := range attributions {
+		if attribution == nil {
+			continue
+		}
+		if attribution.FxDefaulted {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: trades without an FX rate attributed at 1", ticker))
+		}
+
+		fx, err := p.fxToBase(attribution.Ccy, report.BaseCcy)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %v, excluded", ticker, err))
+			continue
+		}
+
+		lot := lots[ticker]
+		attribution.Qty = lot.qty / p.contractMultiplier(ticker)
+		position := current[ticker]
+		if lot.qty != 0 {
+			if position == nil || position.Qty == 0 || position.Mv == 0 {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s: no price, open quantity excluded", ticker))
+			} else {
+				attribution.attribute(lot.qty, lot.avgPx, lot.avgFx, position.Mv/lot.qty, fx)
+			}
+		}
+		if position != nil {
+			attribution.Dividends = position.Dividends * fx
+		}
+		attribution.Total = attribution.Price + attribution.Fx + attribution.Cross + attribution.Dividends
+
+		report.Positions = append(report.Positions, *attribution)
+		byCcy := report.ByCcy[attribution.Ccy]
+		byCcy.add(attribution.Attribution)
+		report.ByCcy[attribution.Ccy] = byCcy
+		report.Total.add(attribution.Attribution)
+	}
+
+	sort.Slice(report.Positions, func(i, j int) bool { return report.Positions[i].Ticker < report.Positions[j].Ticker })
+	sort.Strings(report.Warnings)
+	return report, nil
+}
+
+// attributionLot tracks the quantity of a position with its average cost and the cost weighted average FX rate.
+type attributionLot struct {
+	qty   float64
+	avgPx float64
+	avgFx float64
+}
+
+// apply applies a trade of qty, negative for sells, attributing the return of the quantity it closes.
+func (l *attributionLot) apply(qty, px, fx float64, attribution *Attribution) {
+	if l.qty == 0 || (l.qty > 0) == (qty > 0) {
+		cost := l.qty*l.avgPx + qty*px
+		if cost != 0 {
+			l.avgFx = (l.qty*l.avgPx*l.avgFx + qty*px*fx) / cost
+		} else {
+			l.avgFx = fx
+		}
+		l.qty += qty
+		l.avgPx = cost / l.qty
+		return
+	}
+
+	closed := math.Copysign(math.Min(math.Abs(qty), math.Abs(l.qty)), l.qty)
+	attribution.attribute(closed, l.avgPx, l.avgFx, px, fx)
+	l.qty -= closed
+	if remaining := qty + closed; remaining != 0 {
+		// the trade flips the position, the remainder opens at the trade's price and FX rate
+		l.qty, l.avgPx, l.avgFx = remaining, px, fx
+	} else if l.qty == 0 {
+		l.avgPx, l.avgFx = 0, 0
+	}
+}
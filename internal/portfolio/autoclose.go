@@ -0,0 +1,230 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/scheduler"
+)
+
+// bondPar is the redemption price of bonds, which are quoted per 100 notional
+const bondPar = 100.0
+
+// defaultAutoCloseTime is the local time of the daily auto-close when not configured
+const defaultAutoCloseTime = "09:00"
+
+// Notifier posts notifications raised by background jobs, e.g. the notifications manager.
+type Notifier interface {
+	Notify(source, message string) error
+}
+
+// defaultAutoCloseSubClasses are the bond sub classes closed at maturity when not configured
+var defaultAutoCloseSubClasses = []string{rdata.AssetSubClassGovies}
+
+// AutoCloseTrades closes the open positions of bonds which matured, and of derivatives which expired, on or before
+// asOf. Bonds are closed when their asset sub class is opted in via config, with the closing sells booked on the
+// maturity date at par plus the final coupon, where dividends metadata has a coupon on the maturity date. Derivatives
+// are closed on their expiry at the settlement price, see settlementPx. Running it again closes nothing further.
+func (p *Portfolio) AutoCloseTrades(asOf time.Time) ([]blotter.Trade, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+
+	type holding struct {
+		trader, ticker string
+		short          bool
+	}
+	var holdings []holding
+	p.mu.Lock()
+	for trader, tickers := range p.positions {
+		for ticker, position := range tickers {
+			if position.Qty != 0 {
+				holdings = append(holdings, holding{trader, ticker, position.Qty < 0})
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	subClasses := autoCloseSubClasses()
+	var closed []blotter.Trade
+	var errs []error
+	for _, h := range holdings {
+		tickerRef, err := p.rdata.GetTicker(h.ticker)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get reference data for %s: %w", h.ticker, err))
+			continue
+		}
+		isBond := tickerRef.AssetClass == rdata.AssetClassBonds && slices.Contains(subClasses, tickerRef.AssetSubClass)
+		isDerivative := tickerRef.AssetClass == rdata.AssetClassDerivatives
+		if !isBond && !isDerivative {
+			continue
+		}
+		if tickerRef.MaturityDate == "" {
+			p.logger.Warnf("Unable to auto close %s, no maturity date in reference data", h.ticker)
+			continue
+		}
+
+		maturity, err := time.Parse("2006-01-02", tickerRef.MaturityDate)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid maturity date %s of %s: %w", tickerRef.MaturityDate, h.ticker, err))
+			continue
+		}
+		if maturity.After(asOf) {
+			continue
+		}
+		if h.short {
+			// closing sells only offset open buys, shorts are left to be covered by hand
+			if isDerivative {
+				p.logger.Warnf("Unable to auto close short %s of %s expired on %s, cover it manually", h.ticker, h.trader, tickerRef.MaturityDate)
+			}
+			continue
+		}
+
+		// the blotter is the source of truth, positions are updated asynchronously from its events
+		openQty := 0.0
+		for _, lot := range p.blotter.OpenLots(h.trader, h.ticker) {
+			openQty += lot.OpenQty
+		}
+		if openQty <= 0 {
+			continue
+		}
+
+		price := bondPar + p.finalCoupon(tickerRef)
+		if isDerivative {
+			if price, err = p.settlementPx(tickerRef); err != nil {
+				errs = append(errs, fmt.Errorf("failed to settle %s of %s: %w", h.ticker, h.trader, err))
+				continue
+			}
+		}
+
+		trades, err := p.blotter.ClosePosition(h.trader, h.ticker, openQty, price, maturity, nil, audit.SourceScheduler)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to auto close %s of %s: %w", h.ticker, h.trader, err))
+			continue
+		}
+		p.logger.Infof("Auto closed %v %s of %s matured on %s", openQty, h.ticker, h.trader, tickerRef.MaturityDate)
+		closed = append(closed, trades...)
+	}
+
+	return closed, errors.Join(errs...)
+}
+
+// settlementPx returns the price an expired derivative settles at. Options settle at their intrinsic value against the
+// price of the underlying, which is 0 when they expire out of the money, and futures at their last price.
+func (p *Portfolio) settlementPx(tickerRef rdata.TickerReference) (float64, error) {
+	if tickerRef.AssetSubClass != rdata.AssetSubClassOption {
+		assetData, err := p.mdata.GetAssetPrice(tickerRef.ID)
+		if err != nil {
+			return 0, err
+		}
+		return assetData.Price, nil
+	}
+
+	if tickerRef.StrikePrice <= 0 || tickerRef.CallPut == "" {
+		return 0, errors.New("option has no strike price or call/put in reference data")
+	}
+	assetData, err := p.mdata.GetAssetPrice(tickerRef.UnderlyingTicker)
+	if err != nil {
+		return 0, fmt.Errorf("failed to price underlying %s: %w", tickerRef.UnderlyingTicker, err)
+	}
+	if tickerRef.CallPut == "call" {
+		return max(assetData.Price-tickerRef.StrikePrice, 0), nil
+	}
+	return max(tickerRef.StrikePrice-assetData.Price, 0), nil
+}
+
+// finalCoupon returns the coupon paid on the maturity date of the bond, or 0 if unknown.
+func (p *Portfolio) finalCoupon(tickerRef rdata.TickerReference) float64 {
+	metadata, err := p.mdata.GetDividendsMetadataFromTickerRef(tickerRef)
+	if err != nil {
+		p.logger.Warnf("Failed to get final coupon of %s, closing at par: %v", tickerRef.ID, err)
+		return 0
+	}
+
+	for _, dividend := range metadata {
+		if dividend.ExDate == tickerRef.MaturityDate {
+			return dividend.Amount
+		}
+	}
+	return 0
+}
+
+// autoCloseSubClasses returns the bond sub classes which are closed at maturity.
+func autoCloseSubClasses() []string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.AutoCloseSubClasses == nil {
+		return defaultAutoCloseSubClasses
+	}
+	return cfg.AutoCloseSubClasses
+}
+
+// StartAutoCloseSchedule runs AutoCloseTrades once a day at the configured local time until the scheduler is
+// stopped. A summary of the closed trades is posted to the notifier when enabled in config, notifier may be nil.
+func (p *Portfolio) StartAutoCloseSchedule(sched *scheduler.Scheduler, notifier Notifier) {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg != nil && cfg.AutoCloseSchedule.Disabled {
+		p.logger.Info("Scheduled auto-close is disabled")
+		return
+	}
+
+	sched.Every("autoclose", time.Minute, func() error { return p.runScheduledAutoClose(time.Now(), notifier) })
+}
+
+// runScheduledAutoClose runs the auto-close if the scheduled time of now's day has passed and it has not yet run
+// that day. It returns scheduler.ErrNotDue when it did not run, or the error of the auto-close.
+func (p *Portfolio) runScheduledAutoClose(now time.Time, notifier Notifier) error {
+	day := now.Format("2006-01-02")
+	scheduled, err := time.ParseInLocation("2006-01-02 15:04", day+" "+autoCloseTime(), now.Location())
+	if err != nil {
+		p.logger.Warnf("Invalid auto-close time %s, using %s", autoCloseTime(), defaultAutoCloseTime)
+		scheduled, _ = time.ParseInLocation("2006-01-02 15:04", day+" "+defaultAutoCloseTime, now.Location())
+	}
+
+	p.mu.Lock()
+	due := !now.Before(scheduled) && p.autoCloseRanOn != day
+	if due {
+		p.autoCloseRanOn = day
+	}
+	p.mu.Unlock()
+	if !due {
+		return scheduler.ErrNotDue
+	}
+
+	closed, err := p.AutoCloseTrades(now)
+	if err != nil {
+		p.logger.Errorf("Scheduled auto-close failed: %v", err)
+	}
+	if len(closed) == 0 {
+		return err
+	}
+
+	var summary []string
+	for _, trade := range closed {
+		p.logger.Infof("Scheduled auto-close closed %v %s of %s, tradeID: %s", trade.Quantity, trade.Ticker, trade.Trader, trade.TradeID)
+		summary = append(summary, fmt.Sprintf("%v %s of %s at %v", trade.Quantity, trade.Ticker, trade.Trader, trade.Price))
+	}
+
+	cfg, _ := config.GetOrCreateConfig("")
+	if notifier != nil && cfg != nil && cfg.AutoCloseSchedule.Notify {
+		message := fmt.Sprintf("Auto closed %d matured trade(s): %s", len(closed), strings.Join(summary, ", "))
+		if err := notifier.Notify("autoclose", message); err != nil {
+			p.logger.Warnf("Failed to post auto-close notification: %v", err)
+		}
+	}
+	return err
+}
+
+func autoCloseTime() string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.AutoCloseSchedule.Time == "" {
+		return defaultAutoCloseTime
+	}
+	return cfg.AutoCloseSchedule.Time
+}
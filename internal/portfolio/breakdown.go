@@ -0,0 +1,137 @@
+package portfolio
+
+import (
+	"fmt"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/types"
+)
+
+// Groupings of the breakdown
+const (
+	GroupByBook       = "book"
+	GroupByAssetClass = "assetClass"
+	GroupByCcy        = "ccy"
+)
+
+// GroupMetrics are the metrics of the positions and cashflows of a group of the breakdown.
+type GroupMetrics struct {
+	Mv        float64
+	PnL       float64
+	PricePaid float64 // total paid for the open positions
+	Dividends float64 // dividends and coupons received
+	IRR       *float64
+}
+
+// Breakdown is the portfolio metrics computed per group, with the weight of each group in the market value of the
+// open positions.
+type Breakdown struct {
+	GroupBy string
+	Groups  map[string]GroupMetrics
+	Weights map[string]float64
+}
+
+// GetBreakdown returns the metrics of the books the user may see as of asOf, all books when user is nil, computed per
+// group from the positions and cashflows of the group. Like the summary, market values of different currencies are
+// summed as is.
+func (p *Portfolio) GetBreakdown(user *types.User, groupBy string, asOf time.Time) (*Breakdown, error) {
+	return p.GetBreakdownForView(user, groupBy, asOf, nil)
+}
+
+// GetBreakdownForView returns the breakdown like GetBreakdown, of the books, asset classes and tag of the saved view
+// only when view is not nil. With a tag, the metrics of an open position are its share held by the tagged trades, like
+// the terminal value of the IRR, and closed positions are left out as their PnL is not split by trade.
+func (p *Portfolio) GetBreakdownForView(user *types.User, groupBy string, asOf time.Time, view *blotter.SavedView) (*Breakdown, error) {
+	if !isValidGroupBy(groupBy) {
+		return nil, fmt.Errorf("unsupported group_by %s, must be one of %s, %s or %s", groupBy, GroupByBook, GroupByAssetClass, GroupByCcy)
+	}
+
+	flows, err := p.cashflows(user, asOf, view)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := p.GetPositionsForUser(user)
+	if err != nil {
+		// positions which fail to enrich are valued as of their last enrichment, like the terminal cashflows
+		p.logger.Warnf("Failed to enrich positions for the breakdown: %v", err)
+	}
+
+	groups := make(map[string]GroupMetrics)
+	var totalMv float64
+	taggedQty := p.taggedQty(user, asOf, view)
+	for _, position := range positions {
+		if !view.Includes(position.Trader, p.assetClass(position.Ticker)) {
+			continue
+		}
+		share := 1.0
+		if taggedQty != nil {
+			if position.Qty == 0 || taggedQty[position.Trader+":"+position.Ticker] == 0 {
+				continue
+			}
+			share = taggedQty[position.Trader+":"+position.Ticker] / position.Qty
+		}
+
+		key := p.groupKey(groupBy, position.Trader, position.Ticker)
+		group := groups[key]
+		group.PnL += position.PnL * share
+		if position.Qty != 0 {
+			group.Mv += position.Mv * share
+			group.PricePaid += position.TotalPaid * share
+			totalMv += position.Mv * share
+		}
+		groups[key] = group
+	}
+
+	groupFlows := make(map[string][]Cashflow)
+	for _, flow := range flows {
+		key := p.groupKey(groupBy, flow.Book, flow.Ticker)
+		groupFlows[key] = append(groupFlows[key], flow)
+		if flow.Component == ComponentDividend || flow.Component == ComponentCoupon {
+			group := groups[key]
+			group.Dividends += flow.Amount
+			groups[key] = group
+		}
+	}
+	for key, flows := range groupFlows {
+		if irr, err := XIRR(flows); err == nil {
+			group := groups[key]
+			group.IRR = &irr
+			groups[key] = group
+		}
+	}
+
+	breakdown := &Breakdown{GroupBy: groupBy, Groups: groups, Weights: make(map[string]float64)}
+	for key, group := range groups {
+		if totalMv != 0 {
+			breakdown.Weights[key] = group.Mv / totalMv
+		}
+	}
+	return breakdown, nil
+}
+
+// groupKey returns the group of the book's ticker, tickers missing from reference data are grouped under an empty
+// asset class or currency.
+func (p *Portfolio) groupKey(groupBy, book, ticker string) string {
+	if groupBy == GroupByBook {
+		return book
+	}
+
+	tickerRef, err := p.rdata.GetTicker(ticker)
+	if err != nil {
+		return ""
+	}
+	if groupBy == GroupByAssetClass {
+		return tickerRef.AssetClass
+	}
+	return tickerRef.Ccy
+}
+
+func isValidGroupBy(groupBy string) bool {
+	switch groupBy {
+	case GroupByBook, GroupByAssetClass, GroupByCcy:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,119 @@
+package portfolio
+
+import (
+	"errors"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+)
+
+// bulkFlushDelay is the quiet period after a bulk import ends before the deferred positions are written. Trade
+// events are delivered asynchronously, so some still arrive after the import itself has returned.
+const bulkFlushDelay = 100 * time.Millisecond
+
+// bulkWrites tracks the positions whose writes are deferred during bulk imports.
+type bulkWrites struct {
+	depth int                  // nested bulk imports in progress
+	dirty map[string]*Position // position key to position, nil unless writes are being deferred
+	timer *time.Timer          // flushes the dirty positions once the last bulk import has ended
+}
+
+// BeginBulkWrites defers position writes until the matching EndBulkWrites, so a bulk import writes each affected
+// position and the sequence number once rather than once per trade.
+func (p *Portfolio) BeginBulkWrites() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bulk.depth++
+	if p.bulk.timer != nil {
+		p.bulk.timer.Stop()
+		p.bulk.timer = nil
+	}
+	if p.bulk.dirty == nil {
+		p.bulk.dirty = make(map[string]*Position)
+	}
+}
+
+// EndBulkWrites flushes the deferred positions once no trade events have arrived for bulkFlushDelay.
+func (p *Portfolio) EndBulkWrites() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bulk.depth == 0 {
+		return
+	}
+	p.bulk.depth--
+	if p.bulk.depth == 0 {
+		p.scheduleBulkFlush()
+	}
+}
+
+// scheduleBulkFlush (re)starts the quiet period after which the deferred positions are flushed. The caller must hold
+// the lock.
+func (p *Portfolio) scheduleBulkFlush() {
+	if p.bulk.timer != nil {
+		p.bulk.timer.Reset(bulkFlushDelay)
+		return
+	}
+	p.bulk.timer = time.AfterFunc(bulkFlushDelay, func() {
+		if err := p.flushBulkWrites(); err != nil {
+			p.logger.Errorf("Failed to flush positions: %v", err)
+		}
+	})
+}
+
+// flushBulkWrites writes the deferred positions, followed by the sequence number. Positions which fail to write are
+// retried with the next flush. Should the flush not complete, the sequence number is left behind, and the positions
+// not written are recovered by replaying the blotter on restart.
+func (p *Portfolio) flushBulkWrites() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bulk.depth > 0 || p.bulk.dirty == nil {
+		return nil
+	}
+	p.bulk.timer = nil
+
+	var errs []error
+	for key, position := range p.bulk.dirty {
+		if err := p.db.Put(key, position); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(p.bulk.dirty, key)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	p.saveSeqNumToDAL(p.currentSeqNum)
+	p.bulk.dirty = nil
+	return nil
+}
+
+// deferPositionWrite defers the write of the position while bulk writes are in progress, postponing the flush while
+// trade events keep arriving. The caller must hold the lock.
+func (p *Portfolio) deferPositionWrite(key string, position *Position) bool {
+	if p.bulk.dirty == nil {
+		return false
+	}
+
+	p.bulk.dirty[key] = position
+	if p.bulk.depth == 0 {
+		p.scheduleBulkFlush()
+	}
+	return true
+}
+
+// isTradeApplied reports whether the trade is already included in its persisted position.
+func (p *Portfolio) isTradeApplied(trade *blotter.Trade) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if tickers, ok := p.positions[trade.Trader]; ok {
+		if position, ok := tickers[trade.Ticker]; ok {
+			return trade.SeqNum <= position.SeqNum
+		}
+	}
+	return false
+}
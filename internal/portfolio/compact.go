@@ -0,0 +1,64 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Position views
+const (
+	ViewFull    = "full"
+	ViewCompact = "compact" // trimmed for mobile clients
+)
+
+// CompactPosition is a position trimmed to the fields shown on mobile, with numbers rounded and zeros omitted.
+type CompactPosition struct {
+	Ticker string  `json:"ticker"`
+	Name   string  `json:"name,omitempty"`
+	Qty    float64 `json:"qty,omitempty"`
+	Px     float64 `json:"px,omitempty"`
+	Mv     float64 `json:"mv,omitempty"`
+	PnL    float64 `json:"pnl,omitempty"`
+}
+
+// CompactPositions converts enriched positions into the compact view, sorted by market value descending.
+// The positions are not enriched again, so they must come from the same enrichment pass.
+func CompactPositions(positions []*Position) []CompactPosition {
+	compact := make([]CompactPosition, 0, len(positions))
+	for _, position := range positions {
+		compact = append(compact, CompactPosition{
+			Ticker: position.Ticker,
+			Name:   position.name,
+			Qty:    roundTo(position.Qty, 4),
+			Px:     roundTo(position.px, 4),
+			Mv:     roundTo(position.Mv, 2),
+			PnL:    roundTo(position.PnL, 2),
+		})
+	}
+
+	sort.SliceStable(compact, func(i, j int) bool {
+		if compact[i].Mv != compact[j].Mv {
+			return compact[i].Mv > compact[j].Mv
+		}
+		return compact[i].Ticker < compact[j].Ticker
+	})
+	return compact
+}
+
+// positionsView returns the positions in the requested view.
+func positionsView(positions []*Position, view string) (any, error) {
+	switch view {
+	case "", ViewFull:
+		return positions, nil
+	case ViewCompact:
+		return CompactPositions(positions), nil
+	default:
+		return nil, fmt.Errorf("unsupported view %s", view)
+	}
+}
+
+func roundTo(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,90 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/types"
+)
+
+// Supported corporate action types
+const (
+	CorporateActionSplit = "split"
+)
+
+// CorporateAction is a corporate action applied to the blotter. Trades are adjusted in place, so the action is
+// persisted to record the adjustment and to prevent it from being applied twice.
+type CorporateAction struct {
+	Type          string   `json:"type"`
+	Ticker        string   `json:"ticker"`
+	Ratio         float64  `json:"ratio"`         // new shares per old share, e.g. 10 for a 1:10 split
+	EffectiveDate string   `json:"effectiveDate"` // YYYY-MM-DD, trades dated before are adjusted
+	TradeIDs      []string `json:"tradeIds"`      // trades adjusted
+	AppliedAt     string   `json:"appliedAt"`
+}
+
+// ApplyCorporateAction applies the corporate action to the blotter trades dated before its effective date and
+// recomputes the affected positions. For a split, quantities are multiplied and prices divided by the ratio, leaving
+// the cost basis unchanged, which matches the split adjusted historical prices.
+func (p *Portfolio) ApplyCorporateAction(action CorporateAction) (*CorporateAction, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+	if action.Type != CorporateActionSplit {
+		return nil, fmt.Errorf("unsupported corporate action type %s", action.Type)
+	}
+	if _, err := time.Parse("2006-01-02", action.EffectiveDate); err != nil {
+		return nil, fmt.Errorf("invalid effective date %s, expected YYYY-MM-DD", action.EffectiveDate)
+	}
+
+	action.Ticker = strings.ToUpper(strings.TrimSpace(action.Ticker))
+	key := corporateActionKey(action)
+	var existing CorporateAction
+	if err := p.db.Get(key, &existing); err == nil {
+		return nil, fmt.Errorf("%s of %s effective %s was already applied at %s", action.Type, action.Ticker, action.EffectiveDate, existing.AppliedAt)
+	}
+
+	trades, err := p.blotter.ApplySplit(action.Ticker, action.Ratio, action.EffectiveDate)
+	if err != nil {
+		return nil, err
+	}
+
+	action.TradeIDs = []string{}
+	traders := make(map[string]struct{})
+	for _, trade := range trades {
+		action.TradeIDs = append(action.TradeIDs, trade.TradeID)
+		traders[trade.Trader] = struct{}{}
+	}
+	action.AppliedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := p.db.Put(key, action); err != nil {
+		return nil, err
+	}
+
+	for trader := range traders {
+		if err := p.rebuildPosition(trader, action.Ticker); err != nil {
+			return nil, err
+		}
+	}
+
+	return &action, nil
+}
+
+// GetCorporateActions returns the corporate actions applied, ordered by effective date.
+func (p *Portfolio) GetCorporateActions() ([]CorporateAction, error) {
+	actions, err := dal.ParallelLoad[CorporateAction](p.db, string(types.CorporateActionKeyPrefix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].EffectiveDate < actions[j].EffectiveDate
+	})
+	return actions, nil
+}
+
+func corporateActionKey(action CorporateAction) string {
+	return fmt.Sprintf("%s:%s:%s:%s", types.CorporateActionKeyPrefix, action.Ticker, action.EffectiveDate, action.Type)
+}
@@ -0,0 +1,76 @@
+package portfolio
+
+import (
+	"errors"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/types"
+)
+
+// EnrichedTrade is a blotter trade decorated for display, fields which cannot be enriched are null.
+type EnrichedTrade struct {
+	blotter.Trade
+	TickerName   *string  `json:"TickerName"`
+	Ccy          *string  `json:"Ccy"`
+	Px           *float64 `json:"Px"`           // current price, from cache only
+	PositionOpen *bool    `json:"PositionOpen"` // whether the trader still holds the ticker
+}
+
+// GetEnrichedTrades returns a page of the filtered blotter trades in the books (traders) the user may see, all books
+// when user is nil, each decorated with reference data, the cached
+// price and whether the position is still open. Prices are never fetched from upstream, only the requested page is
+// enriched, and reference data and prices are looked up once per ticker.
+func (p *Portfolio) GetEnrichedTrades(filter blotter.TradeFilter, user *types.User, page, pageSize int) (blotter.Page[EnrichedTrade], error) {
+	if p.blotter == nil {
+		return blotter.Page[EnrichedTrade]{}, errors.New("portfolio is not subscribed to a blotter")
+	}
+
+	trades := blotter.Paginate(blotter.FilterTradesForUser(p.blotter.GetTradesByFilter(filter), user), page, pageSize)
+
+	type tickerInfo struct {
+		name, ccy *string
+		px        *float64
+	}
+	infos := make(map[string]tickerInfo)
+	enriched := make([]EnrichedTrade, len(trades.Rows))
+	for i, trade := range trades.Rows {
+		info, ok := infos[trade.Ticker]
+		if !ok {
+			if tickerRef, err := p.rdata.GetTicker(trade.Ticker); err == nil {
+				info.name, info.ccy = &tickerRef.Name, &tickerRef.Ccy
+			}
+			if assetData, err := p.mdata.GetCachedAssetPrice(trade.Ticker); err == nil {
+				info.px = &assetData.Price
+			}
+			infos[trade.Ticker] = info
+		}
+
+		enriched[i] = EnrichedTrade{
+			Trade:        trade,
+			TickerName:   info.name,
+			Ccy:          info.ccy,
+			Px:           info.px,
+			PositionOpen: p.isPositionOpen(trade.Trader, trade.Ticker),
+		}
+	}
+
+	return blotter.Page[EnrichedTrade]{
+		Rows:     enriched,
+		Total:    trades.Total,
+		Page:     trades.Page,
+		PageSize: trades.PageSize,
+	}, nil
+}
+
+// isPositionOpen returns whether the trader holds the ticker, or nil if the position is unknown.
+func (p *Portfolio) isPositionOpen(trader, ticker string) *bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	position, ok := p.positions[trader][ticker]
+	if !ok {
+		return nil
+	}
+	open := position.Qty != 0
+	return &open
+}
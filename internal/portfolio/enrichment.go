@@ -0,0 +1,70 @@
+package portfolio
+
+import (
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/rdata"
+)
+
+// Enrichment strategies, determining how positions of an asset class are valued
+const (
+	EnrichPriceWithDividends = "priceable-with-dividends" // market priced, dividends or coupons accrue to PnL
+	EnrichPriceNoDividends   = "priceable-no-dividends"   // market priced, no income
+	EnrichParValued          = "par-valued"               // valued at par of 1 per unit, e.g. cash
+	EnrichManualOnly         = "manual-only"              // not market priced, carried at cost
+)
+
+// defaultEnrichmentStrategies maps asset classes to their enrichment strategy, overridable via enrichmentStrategies in config.
+var defaultEnrichmentStrategies = map[string]string{
+	rdata.AssetClassEquities:    EnrichPriceWithDividends,
+	rdata.AssetClassBonds:       EnrichPriceWithDividends,
+	rdata.AssetClassCommodities: EnrichPriceNoDividends,
+	rdata.AssetClassCrypto:      EnrichPriceNoDividends,
+	rdata.AssetClassDerivatives: EnrichPriceNoDividends,
+	rdata.AssetClassFX:          EnrichPriceNoDividends,
+	rdata.AssetClassCash:        EnrichParValued,
+}
+
+// enrichmentStrategy returns the enrichment strategy of the asset class. Unknown asset classes fall back to
+// priceable-no-dividends with a warning, rather than failing the enrichment.
+func (p *Portfolio) enrichmentStrategy(assetClass string) string {
+	if cfg, _ := config.GetOrCreateConfig(""); cfg != nil {
+		if strategy, ok := cfg.EnrichmentStrategies[assetClass]; ok {
+			if isValidEnrichmentStrategy(strategy) {
+				return strategy
+			}
+			p.logger.Warnf("Invalid enrichment strategy %s configured for asset class %s, using default", strategy, assetClass)
+		}
+	}
+
+	if strategy, ok := defaultEnrichmentStrategies[assetClass]; ok {
+		return strategy
+	}
+
+	p.logger.Warnf("Asset class %s has no enrichment strategy, defaulting to %s", assetClass, EnrichPriceNoDividends)
+	return EnrichPriceNoDividends
+}
+
+// priceByStrategy returns the unit price of the position according to the enrichment strategy.
+func (p *Portfolio) priceByStrategy(strategy string, position *Position) (float64, error) {
+	switch strategy {
+	case EnrichParValued:
+		return 1, nil
+	case EnrichManualOnly:
+		return position.AvgPx, nil
+	default:
+		assetData, err := p.mdata.GetAssetPrice(position.Ticker)
+		if err != nil {
+			return 0, err
+		}
+		return assetData.Price, nil
+	}
+}
+
+func isValidEnrichmentStrategy(strategy string) bool {
+	switch strategy {
+	case EnrichPriceWithDividends, EnrichPriceNoDividends, EnrichParValued, EnrichManualOnly:
+		return true
+	default:
+		return false
+	}
+}
@@ -6,29 +6,884 @@ package portfolio
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"portfolio-manager/internal/blotter"
 	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ClosePositionRequest represents the request to close a position by quantity.
+type ClosePositionRequest struct {
+	Book      string  `json:"book"` // Trader holding the position
+	Ticker    string  `json:"ticker"`
+	Quantity  float64 `json:"quantity"`
+	Price     float64 `json:"price"`
+	TradeDate string  `json:"tradeDate"`
+}
+
+// TickerRenameRequest is the request body of a ticker rename.
+type TickerRenameRequest struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	EffectiveDate string `json:"effectiveDate"` // YYYY-MM-DD, trades dated before are renamed, empty for all
+}
+
 // HandlePositionsGet handles retrieving all positions from the portfolio service.
 // @Summary Get all portfolio positions
-// @Description Retrieves all positions currently in the portfolio
+// @Description Retrieves all positions currently in the portfolio, limited to the books of the API key's user. The compact view returns only ticker, name, qty, px, mv and pnl, rounded and sorted by mv descending.
 // @Tags portfolio
 // @Produce json
+// @Param book query string false "Book (trader) to filter by"
+// @Param view query string false "View of the positions: full (default) or compact"
 // @Success 200 {array} Position
+// @Failure 400 {string} string "Unsupported view"
+// @Failure 403 {string} string "Book not allowed"
 // @Failure 500 {object} error
 // @Router /api/v1/portfolio/positions [get]
 func HandlePositionsGet(portfolio *Portfolio) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		positions, err := portfolio.GetAllPositions()
+		user := types.UserFromContext(r.Context())
+		book := r.URL.Query().Get("book")
+
+		var positions []*Position
+		var err error
+		if book != "" {
+			if user != nil && !user.CanSeeBook(book) {
+				http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+				return
+			}
+			positions, err = portfolio.GetPositions(book)
+		} else {
+			positions, err = portfolio.GetPositionsForUser(user)
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("Failed to get positions: %v", err)
+		}
+
+		view, err := positionsView(positions, r.URL.Query().Get("view"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+	}
+}
+
+// HandleSummaryGet handles retrieving the summary of the portfolio.
+// @Summary Get the portfolio summary
+// @Description Aggregates the market value, PnL and dividends of the positions, limited to the books of the API key's user. BreakEvenMovePct is the uniform percentage move in the prices of the open positions which leaves zero total PnL, null when nothing is open.
+// @Tags portfolio
+// @Produce json
+// @Param book query string false "Book (trader) to filter by"
+// @Success 200 {object} Summary
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/portfolio/summary [get]
+func HandleSummaryGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := types.UserFromContext(r.Context())
+		book := r.URL.Query().Get("book")
+		if book != "" && user != nil && !user.CanSeeBook(book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		summary, err := portfolio.GetSummary(user, book)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("Failed to get positions for summary: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
+// HandleIRRGet handles the IRR of the portfolio.
+// @Summary Get the IRR of the portfolio
+// @Description Annualized internal rate of return of the books of the API key's user as of today, from the trades, dividends, coupons and the market value of the open positions. Components can be excluded, e.g. dividend and coupon for the price return only. The response sums the cashflows of each component, excluded ones included. IRR is null when the included cashflows have no solution.
+// @Tags portfolio
+// @Produce json
+// @Param exclude query string false "Comma separated components to exclude: principal, fee, dividend, coupon, terminal"
+// @Param tag query string false "Tag of the trades to include, e.g. DCA, defaults to all trades"
+// @Param saved_view query string false "Saved view of the books, asset classes and tag to include, see /api/v1/blotter/saved-views"
+// @Success 200 {object} IRRReport
+// @Failure 400 {string} string "Unsupported component"
+// @Failure 404 {string} string "Saved view not found"
+// @Router /api/v1/portfolio/irr [get]
+func HandleIRRGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var exclude []string
+		if components := r.URL.Query().Get("exclude"); components != "" {
+			exclude = strings.Split(components, ",")
+		}
+		view, ok := viewFromQuery(w, r, portfolio)
+		if !ok {
+			return
+		}
+
+		report, err := portfolio.GetIRRForView(types.UserFromContext(r.Context()), time.Now(), exclude, view)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleTWRGet handles the TWR of the portfolio.
+// @Summary Get the TWR of the portfolio
+// @Description Cumulative and annualized time-weighted return of the books of the API key's user from the first trade to today. The period is broken at every trade date and the sub-period returns, from the historical closes and the dividends and coupons going ex, are chained, so unlike the IRR the timing of buys and sells does not move it. Returns are null when no period starts with a market value.
+// @Tags portfolio
+// @Produce json
+// @Param tag query string false "Tag of the trades to include, e.g. DCA, defaults to all trades"
+// @Param saved_view query string false "Saved view of the books, asset classes and tag to include, see /api/v1/blotter/saved-views"
+// @Success 200 {object} TWRReport
+// @Failure 404 {string} string "Saved view not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /api/v1/portfolio/twr [get]
+func HandleTWRGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		view, ok := viewFromQuery(w, r, portfolio)
+		if !ok {
+			return
+		}
+
+		report, err := portfolio.GetTWR(types.UserFromContext(r.Context()), time.Now(), view)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleBreakdownGet handles the breakdown of the portfolio metrics per group.
+// @Summary Get the portfolio metrics per book, asset class or currency
+// @Description Market value, PnL, price paid, dividends and IRR of the books of the API key's user as of today, computed per group from the positions and cashflows of the group, with each group's weight in the market value of the open positions. Dividends are split between books by the quantity each held before the ex-date.
+// @Tags portfolio
+// @Produce json
+// @Param group_by query string true "book, assetClass or ccy"
+// @Param tag query string false "Tag of the trades to include, e.g. DCA, defaults to all trades"
+// @Param saved_view query string false "Saved view of the books, asset classes and tag to include, see /api/v1/blotter/saved-views"
+// @Success 200 {object} Breakdown
+// @Failure 400 {string} string "Unsupported group_by"
+// @Failure 404 {string} string "Saved view not found"
+// @Router /api/v1/portfolio/breakdown [get]
+func HandleBreakdownGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		view, ok := viewFromQuery(w, r, portfolio)
+		if !ok {
+			return
+		}
+
+		breakdown, err := portfolio.GetBreakdownForView(types.UserFromContext(r.Context()), r.URL.Query().Get("group_by"), time.Now(), view)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(breakdown)
+	}
+}
+
+// viewFromQuery returns the saved view named by the saved_view query parameter, with the tag of the tag parameter when
+// the view has none, or a view of the tag alone. It is nil when neither is given. It writes an error and returns false
+// when no view has the name, or the tags of the view and the parameter differ.
+func viewFromQuery(w http.ResponseWriter, r *http.Request, portfolio *Portfolio) (*blotter.SavedView, bool) {
+	tag := r.URL.Query().Get("tag")
+	if r.URL.Query().Get("saved_view") == "" || portfolio.blotter == nil {
+		if tag == "" {
+			return nil, true
+		}
+		return &blotter.SavedView{Tag: tag}, true
+	}
+
+	view, ok := blotter.SavedViewFromQuery(w, r, portfolio.blotter)
+	if !ok {
+		return nil, false
+	}
+	if tag != "" && view.Tag != "" && !strings.EqualFold(tag, view.Tag) {
+		http.Error(w, fmt.Sprintf("ERROR: tag %s differs from the tag %s of saved view %s", tag, view.Tag, view.Name), http.StatusBadRequest)
+		return nil, false
+	}
+	if tag != "" {
+		view.Tag = tag
+	}
+	return view, true
+}
+
+// HandleTargetsPut handles setting the target allocation of a book.
+// @Summary Set the target allocation of a book
+// @Description Stores the target weights of the book per asset class (e.g. eq, bond, cash) or ticker, which must add up to 1. A position is allocated to its ticker's weight when it has one, otherwise to its asset class's.
+// @Tags portfolio
+// @Accept json
+// @Produce json
+// @Param request body Targets true "Target allocation"
+// @Success 200 {object} Targets
+// @Failure 400 {string} string "Invalid targets"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/portfolio/targets [put]
+func HandleTargetsPut(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var targets Targets
+		if err := json.NewDecoder(r.Body).Decode(&targets); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		user := types.UserFromContext(r.Context())
+		if user != nil && !user.CanSeeBook(targets.Book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		if err := portfolio.SetTargets(targets); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(targets)
+	}
+}
+
+// HandleTargetsGet handles retrieving the target allocation of a book.
+// @Summary Get the target allocation of a book
+// @Description Retrieve the target weights of the book per asset class or ticker
+// @Tags portfolio
+// @Produce json
+// @Param book query string true "Book (trader)"
+// @Success 200 {object} Targets
+// @Failure 403 {string} string "Book not allowed"
+// @Failure 404 {string} string "No targets for the book"
+// @Router /api/v1/portfolio/targets [get]
+func HandleTargetsGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		book := r.URL.Query().Get("book")
+		user := types.UserFromContext(r.Context())
+		if user != nil && !user.CanSeeBook(book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		targets, err := portfolio.GetTargets(book)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(targets)
+	}
+}
+
+// HandleRebalanceGet handles the rebalancing suggestions of a book.
+// @Summary Get rebalancing suggestions of a book
+// @Description Compares the market value weights of the open positions of the book in the base currency against its targets, suggesting buy and sell notionals per ticker in the base currency which bring the allocations drifting beyond the tolerance back to target. Positions without a price or FX rate are excluded and reported in Warnings.
+// @Tags portfolio
+// @Produce json
+// @Param book query string true "Book (trader)"
+// @Param tolerance query number false "Drift from the target weight left alone, e.g. 0.05, defaults to rebalanceTolerance in config"
+// @Success 200 {object} RebalanceReport
+// @Failure 400 {string} string "No targets for the book"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/portfolio/rebalance [get]
+func HandleRebalanceGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		book := r.URL.Query().Get("book")
+		user := types.UserFromContext(r.Context())
+		if user != nil && !user.CanSeeBook(book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		var tolerance float64
+		if value := r.URL.Query().Get("tolerance"); value != "" {
+			var err error
+			tolerance, err = strconv.ParseFloat(value, 64)
+			if err != nil || tolerance < 0 {
+				http.Error(w, "ERROR: invalid tolerance", http.StatusBadRequest)
+				return
+			}
+		}
+
+		report, err := portfolio.Rebalance(book, tolerance)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleClosePost handles closing a position by quantity.
+// @Summary Close a position by quantity
+// @Description Books sell trades with status closed against the open buy trades they offset, oldest first, linked via OrigTradeID. Closing more than the open quantity is rejected.
+// @Tags portfolio
+// @Accept json
+// @Produce json
+// @Param request body ClosePositionRequest true "Close position request"
+// @Success 201 {array} blotter.Trade
+// @Failure 400 {string} string "Invalid request payload"
+// @Router /api/v1/portfolio/close [post]
+func HandleClosePost(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ClosePositionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		tradeDate, err := time.Parse(time.RFC3339, request.TradeDate)
+		if err != nil {
+			http.Error(w, "ERROR: invalid trade date format", http.StatusBadRequest)
+			return
+		}
+
+		trades, err := portfolio.ClosePosition(request.Book, request.Ticker, request.Quantity, request.Price, tradeDate, types.UserFromContext(r.Context()))
+		if errors.Is(err, blotter.ErrBookNotAllowed) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(trades)
+	}
+}
+
+// HandleEnrichedTradesGet handles retrieving blotter trades decorated for display.
+// @Summary Get enriched trades
+// @Description Retrieve a page of blotter trades in the books of the API key's user, each with the ticker name and currency from reference data, the cached price (never fetched upstream) and whether the position is still open. Missing enrichment data is null.
+// @Tags trades
+// @Produce json
+// @Param ticker query string false "Ticker"
+// @Param trader query string false "Trader"
+// @Param tag query string false "Tag, case-insensitive"
+// @Param from query string false "From trade date, YYYY-MM-DD"
+// @Param to query string false "To trade date, YYYY-MM-DD"
+// @Param page query int false "Page, starting from 1"
+// @Param pageSize query int false "Rows per page, defaults to 50"
+// @Success 200 {object} blotter.Page[EnrichedTrade]
+// @Failure 400 {string} string "Invalid query parameters"
+// @Router /api/v1/blotter/trades/enriched [get]
+func HandleEnrichedTradesGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := blotter.ParseTradeFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		page, pageSize, err := blotter.ParsePagination(r.URL.Query())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		trades, err := portfolio.GetEnrichedTrades(filter, types.UserFromContext(r.Context()), page, pageSize)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(trades)
+	}
+}
+
+// HandleTickerRenamePost handles renaming a ticker, e.g. after a change of symbol.
+// @Summary Rename a ticker
+// @Description Moves the blotter trades of a ticker dated before the effective date to another ticker, which must exist in reference data, merging the affected positions and moving the dividends metadata. Returns the records changed, or which would change in dry run mode. Admin only.
+// @Tags Reference
+// @Accept json
+// @Produce json
+// @Param request body TickerRenameRequest true "Ticker rename request"
+// @Param dryRun query bool false "Return the records which would change without changing them"
+// @Success 200 {object} TickerRename
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/rdata/ticker/rename [post]
+func HandleTickerRenamePost(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		var request TickerRenameRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if request.EffectiveDate != "" {
+			if _, err := time.Parse("2006-01-02", request.EffectiveDate); err != nil {
+				http.Error(w, "ERROR: invalid effective date format, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+		rename, err := portfolio.RenameTicker(request.From, request.To, request.EffectiveDate, dryRun)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rename)
+	}
+}
+
+// HandleCorporateActionPost handles applying a corporate action.
+// @Summary Apply a corporate action
+// @Description Applies a corporate action to the blotter trades dated before its effective date and recomputes the affected positions. For a split, ratio is the number of new shares per old share, e.g. 10 for a 1:10 split, and quantities are multiplied and prices divided by it. An action is applied once. Admin only.
+// @Tags portfolio
+// @Accept json
+// @Produce json
+// @Param request body CorporateAction true "Corporate action, only type, ticker, ratio and effectiveDate are read"
+// @Success 201 {object} CorporateAction
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/portfolio/corporate-action [post]
+func HandleCorporateActionPost(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		var request CorporateAction
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		action, err := portfolio.ApplyCorporateAction(request)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(action)
+	}
+}
+
+// HandleCorporateActionsGet handles retrieving the corporate actions applied.
+// @Summary Get corporate actions
+// @Description Retrieve the corporate actions applied, ordered by effective date
+// @Tags portfolio
+// @Produce json
+// @Success 200 {array} CorporateAction
+// @Failure 500 {string} string "Failed to get corporate actions"
+// @Router /api/v1/portfolio/corporate-action [get]
+func HandleCorporateActionsGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actions, err := portfolio.GetCorporateActions()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(actions)
+	}
+}
+
+// HandleHistoricalPositionsGet handles the position snapshot as of a date.
+// @Summary Get the positions held on a date
+// @Description Retrieves the nearest daily snapshot of the open positions at or before the date, with the ticker, book, currency, quantity, market value and average price of each. Snapshots older than the daily retention are thinned to the last of each month.
+// @Tags portfolio
+// @Produce json
+// @Param date query string true "Date, YYYY-MM-DD"
+// @Success 200 {object} PositionSnapshot
+// @Failure 400 {string} string "Invalid date"
+// @Failure 404 {string} string "No snapshot at or before the date"
+// @Router /api/v1/historical/positions [get]
+func HandleHistoricalPositionsGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+		if err != nil {
+			http.Error(w, "ERROR: invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+
+		snapshot, err := portfolio.GetPositionSnapshot(types.UserFromContext(r.Context()), date)
+		if errors.Is(err, ErrNoSnapshot) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+	}
+}
+
+// HandleTickerHistoryGet handles the history of the holding of a ticker in a book for charting.
+// @Summary Get the history of a holding
+// @Description Replays the trades of the ticker in the book to derive the quantity held and cost basis at the end of each day, valued with the close of the day from historical data. Days without a close carry forward the last close. Weekly and monthly granularities keep the last day of each week or month.
+// @Tags portfolio
+// @Produce json
+// @Param book path string true "Book (trader)"
+// @Param ticker path string true "Ticker"
+// @Param from query string false "First date, YYYY-MM-DD, defaults to a year before to"
+// @Param to query string false "Last date, YYYY-MM-DD, defaults to today"
+// @Param granularity query string false "daily (default), weekly or monthly"
+// @Success 200 {object} TickerHistory
+// @Failure 400 {string} string "Invalid request"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/portfolio/history/{book}/{ticker} [get]
+func HandleTickerHistoryGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		book, ticker, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/portfolio/history/"), "/")
+		if !ok || book == "" || ticker == "" || strings.Contains(ticker, "/") {
+			http.Error(w, "ERROR: expected /api/v1/portfolio/history/{book}/{ticker}", http.StatusBadRequest)
+			return
+		}
+		ticker = strings.ToUpper(ticker)
+
+		user := types.UserFromContext(r.Context())
+		if user != nil && !user.CanSeeBook(book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		to := time.Now().UTC()
+		if value := r.URL.Query().Get("to"); value != "" {
+			var err error
+			if to, err = time.Parse("2006-01-02", value); err != nil {
+				http.Error(w, "ERROR: invalid to, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+		from := to.AddDate(-1, 0, 0)
+		if value := r.URL.Query().Get("from"); value != "" {
+			var err error
+			if from, err = time.Parse("2006-01-02", value); err != nil {
+				http.Error(w, "ERROR: invalid from, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+
+		history, err := portfolio.GetTickerHistory(book, ticker, from, to, r.URL.Query().Get("granularity"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	}
+}
+
+// HandleAttributionGet handles the performance attribution of a book.
+// @Summary Get the performance attribution of a book
+// @Description Decomposes the PnL of each position of the book in the base currency into local price return, FX return, cross term and dividends, per position, per currency and in total. Trades are attributed at their stored FX rate, trades in a foreign currency without one are attributed at 1 and flagged with FxDefaulted.
+// @Tags portfolio
+// @Produce json
+// @Param book query string true "Book (trader)"
+// @Success 200 {object} AttributionReport
+// @Failure 400 {string} string "Book is required"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/metrics/attribution [get]
+func HandleAttributionGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		book := r.URL.Query().Get("book")
+		if book == "" {
+			http.Error(w, "ERROR: book is required", http.StatusBadRequest)
+			return
+		}
+		user := types.UserFromContext(r.Context())
+		if user != nil && !user.CanSeeBook(book) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", blotter.ErrBookNotAllowed.Error()), http.StatusForbidden)
+			return
+		}
+
+		report, err := portfolio.GetAttribution(book)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleNetWorthGet handles the consolidated net worth.
+// @Summary Get the net worth
+// @Description Market value of each book excluding cash, cash balances per currency and external assets, converted to the base currency at the cached FX rates, with a total. External assets are only included for admins.
+// @Tags networth
+// @Produce json
+// @Success 200 {object} NetWorth
+// @Router /api/v1/networth [get]
+func HandleNetWorthGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		netWorth, err := portfolio.GetNetWorth(types.UserFromContext(r.Context()), time.Now())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(netWorth)
+	}
+}
+
+// HandleExternalAssetPost handles storing an external asset.
+// @Summary Store an external asset
+// @Description Store an asset held outside the books, e.g. property, CPF or bank balances, replacing one of the same name
+// @Tags networth
+// @Accept json
+// @Produce json
+// @Param asset body ExternalAsset true "External asset, asOf defaults to today and ccy to the base currency"
+// @Success 200 {object} ExternalAsset
+// @Failure 400 {string} string "Invalid external asset"
+// @Failure 403 {string} string "Admins only"
+// @Router /api/v1/networth/external [post]
+func HandleExternalAssetPost(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var asset ExternalAsset
+		if err := json.NewDecoder(r.Body).Decode(&asset); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		stored, err := portfolio.SetExternalAsset(asset)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stored)
+	}
+}
+
+// HandleExternalAssetsGet handles listing the external assets.
+// @Summary List the external assets
+// @Description List the assets held outside the books
+// @Tags networth
+// @Produce json
+// @Success 200 {array} ExternalAsset
+// @Failure 403 {string} string "Admins only"
+// @Router /api/v1/networth/external [get]
+func HandleExternalAssetsGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assets, err := portfolio.GetExternalAssets()
 		if err != nil {
-			logging.GetLogger().Errorf("Failed to get positions: %v", err)
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(assets)
+	}
+}
+
+// HandleExternalAssetDelete handles deleting an external asset.
+// @Summary Delete an external asset
+// @Description Delete the asset held outside the books of the name
+// @Tags networth
+// @Param name query string true "Name of the external asset"
+// @Success 204 "No content"
+// @Failure 400 {string} string "Name is required"
+// @Failure 403 {string} string "Admins only"
+// @Router /api/v1/networth/external [delete]
+func HandleExternalAssetDelete(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "ERROR: name is required", http.StatusBadRequest)
+			return
 		}
+
+		if err := portfolio.DeleteExternalAsset(name); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleNetWorthHistoryGet handles the history of the net worth for charting.
+// @Summary Get the net worth history
+// @Description Total net worth of each daily snapshot within the range, stored by the scheduled position snapshot when positionSnapshot.netWorth is enabled
+// @Tags networth
+// @Produce json
+// @Param from query string false "From date, YYYY-MM-DD, defaults to one year before to"
+// @Param to query string false "To date, YYYY-MM-DD, defaults to today"
+// @Success 200 {array} NetWorthPoint
+// @Failure 400 {string} string "Invalid date"
+// @Failure 403 {string} string "Admins only"
+// @Router /api/v1/networth/history [get]
+func HandleNetWorthHistoryGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		to := time.Now()
+		if toStr := r.URL.Query().Get("to"); toStr != "" {
+			var err error
+			if to, err = time.Parse("2006-01-02", toStr); err != nil {
+				http.Error(w, "ERROR: invalid to, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+		from := to.AddDate(-1, 0, 0)
+		if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+			var err error
+			if from, err = time.Parse("2006-01-02", fromStr); err != nil {
+				http.Error(w, "ERROR: invalid from, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+
+		points, err := portfolio.GetNetWorthHistory(from, to)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(positions)
+		json.NewEncoder(w).Encode(points)
 	}
 }
 
+// HandleAsOfGet handles the cost basis report of holdings as of a date.
+// @Summary Get holdings as of a date
+// @Description Replays the blotter up to and including the date to derive the quantity and average cost of each holding, valued with the close and FX rate of that date. Holdings closed by the date are excluded.
+// @Tags portfolio
+// @Produce json,text/csv
+// @Param date query string true "As-of date, YYYY-MM-DD"
+// @Param book_filter query string false "Comma separated books (traders), defaults to all books"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} AsOfReport
+// @Failure 400 {string} string "Invalid date"
+// @Router /api/v1/portfolio/asof [get]
+func HandleAsOfGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+		if err != nil {
+			http.Error(w, "ERROR: invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+
+		var books []string
+		if bookFilter := r.URL.Query().Get("book_filter"); bookFilter != "" {
+			books = strings.Split(bookFilter, ",")
+		}
+		books, ok := blotter.AuthorizeBooks(w, r, books)
+		if !ok {
+			return
+		}
+
+		report, err := portfolio.GetAsOfReport(date, books)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+		case "csv":
+			data, err := report.ToCSV()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=holdings_%s.csv", report.Date))
+			w.Write(data)
+		default:
+			http.Error(w, "ERROR: unsupported format, expected json or csv", http.StatusBadRequest)
+		}
+	}
+}
+
+// HandleTaxReportGet handles the tax report of a calendar year.
+// @Summary Get the tax report of a year
+// @Description Reports the gross and net dividends with their withholding tax, by ex date, and the realized gains of closing trades in the year per book and ticker, with totals per domicile and overall in the base currency.
+// @Tags reports
+// @Produce json,text/csv
+// @Param year query int true "Calendar year"
+// @Param book query string false "Comma separated books (traders), defaults to all books"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} TaxReport
+// @Failure 400 {string} string "Invalid year"
+// @Router /api/v1/reports/tax [get]
+func HandleTaxReportGet(portfolio *Portfolio) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		year, err := strconv.Atoi(r.URL.Query().Get("year"))
+		if err != nil {
+			http.Error(w, "ERROR: invalid year", http.StatusBadRequest)
+			return
+		}
+
+		var books []string
+		if book := r.URL.Query().Get("book"); book != "" {
+			books = strings.Split(book, ",")
+		}
+		books, ok := blotter.AuthorizeBooks(w, r, books)
+		if !ok {
+			return
+		}
+
+		report, err := portfolio.GetTaxReport(year, books)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+		case "csv":
+			data, err := report.ToCSV()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=tax_%d.csv", report.Year))
+			w.Write(data)
+		default:
+			http.Error(w, "ERROR: unsupported format, expected json or csv", http.StatusBadRequest)
+		}
+	}
+}
+
+// isAdmin returns whether the user of the request is an admin, rejecting the request otherwise.
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if user := types.UserFromContext(r.Context()); user != nil && !user.Admin {
+		http.Error(w, "ERROR: admin only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // RegisterHandlers registers the handlers for the portfolio service.
 func RegisterHandlers(mux *http.ServeMux, portfolio *Portfolio) {
 	mux.HandleFunc("/api/v1/portfolio/positions", func(w http.ResponseWriter, r *http.Request) {
@@ -39,4 +894,181 @@ func RegisterHandlers(mux *http.ServeMux, portfolio *Portfolio) {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+
+	mux.HandleFunc("/api/v1/portfolio/summary", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleSummaryGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/irr", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleIRRGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/twr", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleTWRGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/breakdown", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleBreakdownGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/targets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleTargetsGet(portfolio).ServeHTTP(w, r)
+		case http.MethodPut:
+			HandleTargetsPut(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/rebalance", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleRebalanceGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/historical/positions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleHistoricalPositionsGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/history/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleTickerHistoryGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/metrics/attribution", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleAttributionGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/networth", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleNetWorthGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// external assets and the history of the total are personal rather than of a book, so they are for admins only
+	mux.HandleFunc("/api/v1/networth/external", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			HandleExternalAssetsGet(portfolio).ServeHTTP(w, r)
+		case http.MethodPost:
+			HandleExternalAssetPost(portfolio).ServeHTTP(w, r)
+		case http.MethodDelete:
+			HandleExternalAssetDelete(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/networth/history", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			HandleNetWorthHistoryGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/asof", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleAsOfGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/reports/tax", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleTaxReportGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/corporate-action", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleCorporateActionsGet(portfolio).ServeHTTP(w, r)
+		case http.MethodPost:
+			HandleCorporateActionPost(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/rdata/ticker/rename", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleTickerRenamePost(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/blotter/trades/enriched", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleEnrichedTradesGet(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/portfolio/close", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleClosePost(portfolio).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 }
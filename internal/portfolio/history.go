@@ -0,0 +1,164 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+)
+
+// Granularities of the ticker history
+const (
+	GranularityDaily   = "daily"
+	GranularityWeekly  = "weekly"
+	GranularityMonthly = "monthly"
+)
+
+// maxHistoryDays bounds the range of the ticker history, about 20 years of daily points
+const maxHistoryDays = 20 * 366
+
+// HistoryPoint is the holding of a ticker in a book at the end of a day, in the ticker's currency. Close carries
+// forward the last close over days without one, e.g. weekends and holidays, and is 0 before the first close.
+type HistoryPoint struct {
+	Date      string
+	Qty       float64
+	Close     float64
+	Mv        float64
+	CostBasis float64
+}
+
+// TickerHistory is the daily, weekly or monthly history of the holding of a ticker in a book.
+type TickerHistory struct {
+	Book        string
+	Ticker      string
+	Ccy         string
+	Granularity string
+	Points      []HistoryPoint
+}
+
+// GetTickerHistory replays the trades of the ticker in the book to derive the quantity held and cost basis at the end
+// of each day from from to to, valuing it with the close of the day from the historical data. Weekly and monthly
+// granularities keep the last day of each week or month.
+func (p *Portfolio) GetTickerHistory(book, ticker string, from, to time.Time, granularity string) (*TickerHistory, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+	if granularity == "" {
+		granularity = GranularityDaily
+	}
+	if granularity != GranularityDaily && granularity != GranularityWeekly && granularity != GranularityMonthly {
+		return nil, fmt.Errorf("unsupported granularity %s, must be one of %s, %s or %s", granularity, GranularityDaily, GranularityWeekly, GranularityMonthly)
+	}
+	if to.Before(from) {
+		return nil, errors.New("from must not be after to")
+	}
+	if to.Sub(from) > maxHistoryDays*24*time.Hour {
+		return nil, fmt.Errorf("range must not exceed %d days", maxHistoryDays)
+	}
+
+	tickerRef, err := p.rdata.GetTicker(ticker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reference data for %s: %w", ticker, err)
+	}
+
+	strategy := p.enrichmentStrategy(tickerRef.AssetClass)
+	multiplier := tickerRef.GetContractMultiplier()
+	trades := p.blotter.GetTradesByFilter(blotter.TradeFilter{Ticker: ticker, Trader: book, To: to.Format("2006-01-02")})
+	closes, err := p.historicalCloses(ticker, from, to, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &TickerHistory{Book: book, Ticker: ticker, Ccy: tickerRef.Ccy, Granularity: granularity, Points: []HistoryPoint{}}
+	position := &Position{Trader: book, Ticker: ticker}
+	var lastClose float64
+	for day := truncateToDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		for len(trades) > 0 && trades[0].TradeDate[:min(len(trades[0].TradeDate), len(date))] <= date {
+			applyTrade(position, &trades[0], multiplier)
+			trades = trades[1:]
+		}
+		for len(closes) > 0 && closes[0].date <= date {
+			lastClose = closes[0].price
+			closes = closes[1:]
+		}
+
+		price := lastClose
+		switch strategy {
+		case EnrichParValued:
+			price = 1
+		case EnrichManualOnly:
+			price = position.AvgPx
+		}
+		history.Points = append(history.Points, HistoryPoint{
+			Date:      date,
+			Qty:       position.Qty,
+			Close:     price,
+			Mv:        price * position.Qty * multiplier,
+			CostBasis: position.AvgPx * position.Qty * multiplier,
+		})
+	}
+
+	history.Points = downsample(history.Points, granularity)
+	return history, nil
+}
+
+type dailyClose struct {
+	date  string
+	price float64
+}
+
+// historicalCloses returns the closes of the ticker in date order from the lookback before from to to, so the first
+// day carries forward the last close before it. Tickers which are not priced from market data have none.
+func (p *Portfolio) historicalCloses(ticker string, from, to time.Time, strategy string) ([]dailyClose, error) {
+	if strategy == EnrichParValued || strategy == EnrichManualOnly {
+		return nil, nil
+	}
+
+	end := time.Date(to.Year(), to.Month(), to.Day(), 23, 59, 59, 0, time.UTC)
+	bars, err := p.mdata.GetHistoricalData(ticker, truncateToDay(from).Add(-asOfPriceLookback).Unix(), end.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get historical prices of %s: %w", ticker, err)
+	}
+
+	closes := make([]dailyClose, 0, len(bars))
+	for _, bar := range bars {
+		if bar.Timestamp > end.Unix() {
+			continue
+		}
+		closes = append(closes, dailyClose{date: time.Unix(bar.Timestamp, 0).UTC().Format("2006-01-02"), price: bar.Price})
+	}
+	sort.SliceStable(closes, func(i, j int) bool { return closes[i].date < closes[j].date })
+	return closes, nil
+}
+
+// downsample keeps the last point of each week, starting on Monday, or month. The last point is kept as is, so the
+// latest period may end before its last day.
+func downsample(points []HistoryPoint, granularity string) []HistoryPoint {
+	if granularity == GranularityDaily {
+		return points
+	}
+
+	period := func(date string) string {
+		day, _ := time.Parse("2006-01-02", date)
+		if granularity == GranularityMonthly {
+			return day.Format("2006-01")
+		}
+		year, week := day.ISOWeek()
+		return fmt.Sprintf("%d-%02d", year, week)
+	}
+
+	var sampled []HistoryPoint
+	for i, point := range points {
+		if i == len(points)-1 || period(points[i+1].Date) != period(point.Date) {
+			sampled = append(sampled, point)
+		}
+	}
+	return sampled
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,308 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dividends"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// Cashflow components, from the point of view of the investor
+const (
+	ComponentPrincipal = "principal" // trade consideration, negative for buys
+	ComponentFee       = "fee"       // trade fees and commissions
+	ComponentDividend  = "dividend"
+	ComponentCoupon    = "coupon"   // dividends of bonds
+	ComponentTerminal  = "terminal" // market value of the open positions as of the IRR date
+)
+
+// Cashflow is a dated flow of the portfolio tagged with its component, in the currency of the ticker like the positions.
+type Cashflow struct {
+	Date      string // YYYY-MM-DD
+	Ticker    string
+	Book      string
+	Component string
+	Amount    float64
+}
+
+// IRRReport is the annualized internal rate of return of the portfolio, computed over the cashflows of the included
+// components. Components sums the cashflows of every component, excluded ones included.
+type IRRReport struct {
+	IRR        *float64 // nil when the included cashflows have no solution, e.g. no outflow and inflow
+	Excluded   []string
+	Components map[string]float64
+}
+
+// GetIRR returns the IRR of the books the user may see as of asOf, all books when user is nil, excluding the cashflows
+// of the given components. E.g. excluding dividends and coupons gives the IRR of the price return only.
+func (p *Portfolio) GetIRR(user *types.User, asOf time.Time, exclude []string) (*IRRReport, error) {
+	return p.GetIRRForTag(user, asOf, exclude, "")
+}
+
+// GetIRRForTag returns the IRR like GetIRR, of the trades with the tag only when tag is not empty, e.g. the IRR of the
+// trades tagged DCA.
+func (p *Portfolio) GetIRRForTag(user *types.User, asOf time.Time, exclude []string, tag string) (*IRRReport, error) {
+	var view *blotter.SavedView
+	if tag != "" {
+		view = &blotter.SavedView{Tag: tag}
+	}
+	return p.GetIRRForView(user, asOf, exclude, view)
+}
+
+// GetIRRForView returns the IRR like GetIRR, of the books, asset classes and tag of the saved view only when view is
+// not nil.
+func (p *Portfolio) GetIRRForView(user *types.User, asOf time.Time, exclude []string, view *blotter.SavedView) (*IRRReport, error) {
+	for _, component := range exclude {
+		if !isValidComponent(component) {
+			return nil, fmt.Errorf("unsupported cashflow component %s", component)
+		}
+	}
+
+	flows, err := p.cashflows(user, asOf, view)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IRRReport{Excluded: exclude, Components: make(map[string]float64)}
+	var included []Cashflow
+	for _, flow := range flows {
+		report.Components[flow.Component] += flow.Amount
+		if !slices.Contains(exclude, flow.Component) {
+			included = append(included, flow)
+		}
+	}
+
+	if irr, err := XIRR(included); err == nil {
+		report.IRR = &irr
+	}
+	return report, nil
+}
+
+// Cashflows returns the cashflows of the books the user may see up to asOf: the trades, the dividends and coupons
+// received, and the market value of the open positions as a terminal flow at asOf. Dividends are calculated per
+// ticker like those of the positions, and split between the books by the quantity each held before the ex-date. They
+// flow on their pay date when known, else the ex-date, and those entitled but not yet paid at asOf flow at asOf.
+func (p *Portfolio) Cashflows(user *types.User, asOf time.Time) ([]Cashflow, error) {
+	return p.cashflows(user, asOf, nil)
+}
+
+// cashflows returns the cashflows like Cashflows, of the trades included in the view only when view is not nil. When
+// the view has a tag, the dividends are those of the quantity held by the tagged trades, and the terminal flow the
+// market value of that quantity.
+func (p *Portfolio) cashflows(user *types.User, asOf time.Time, view *blotter.SavedView) ([]Cashflow, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+
+	var flows []Cashflow
+	tickers := make(map[string]bool)
+	books := make(map[string]bool)
+	for _, trade := range p.blotter.GetTrades() {
+		if user != nil && !user.CanSeeBook(trade.Trader) {
+			continue
+		}
+		if !view.IncludesTrade(trade, p.assetClass(trade.Ticker)) {
+			continue
+		}
+
+		tradeDate, err := time.Parse(time.RFC3339, trade.TradeDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trade date of trade %s: %w", trade.TradeID, err)
+		}
+		if tradeDate.After(asOf) {
+			continue
+		}
+
+		amount := trade.Quantity * trade.Price * p.contractMultiplier(trade.Ticker)
+		if trade.Side == blotter.TradeSideBuy {
+			amount = -amount
+		}
+		flows = append(flows, Cashflow{Date: tradeDate.Format(time.DateOnly), Ticker: trade.Ticker, Book: trade.Trader, Component: ComponentPrincipal, Amount: amount})
+		if fee := trade.FeeInTradeCcy(); fee != 0 {
+			flows = append(flows, Cashflow{Date: tradeDate.Format(time.DateOnly), Ticker: trade.Ticker, Book: trade.Trader, Component: ComponentFee, Amount: -fee})
+		}
+		tickers[trade.Ticker] = true
+		books[trade.Trader] = true
+	}
+
+	if p.dividendsMgr != nil {
+		for ticker := range tickers {
+			component := ComponentDividend
+			if tickerRef, err := p.rdata.GetTicker(ticker); err == nil && tickerRef.AssetClass == rdata.AssetClassBonds {
+				component = ComponentCoupon
+			}
+
+			dividends, err := p.dividendsMgr.CalculateDividendsForSingleTicker(ticker)
+			if err != nil {
+				// tickers without dividends data are expected, e.g. crypto
+				continue
+			}
+			trades, err := p.blotter.GetTradesByTicker(ticker)
+			if err != nil {
+				return nil, err
+			}
+			if view != nil && view.Tag != "" {
+				trades = slices.DeleteFunc(slices.Clone(trades), func(trade blotter.Trade) bool { return !trade.HasTag(view.Tag) })
+			}
+			for _, dividend := range dividends {
+				if dividend.ExDate > asOf.Format(time.DateOnly) {
+					continue
+				}
+
+				date := dividend.ExDate
+				if dividend.PayDate > date {
+					date = min(dividend.PayDate, asOf.Format(time.DateOnly))
+				}
+				held := qtyHeldBefore(trades, dividend.ExDate)
+				for book, qty := range held {
+					if !books[book] || qty == 0 {
+						continue
+					}
+					flows = append(flows, Cashflow{Date: date, Ticker: ticker, Book: book, Component: component, Amount: bookDividend(dividend, qty)})
+				}
+			}
+		}
+	}
+
+	positions, err := p.GetPositionsForUser(user)
+	if err != nil {
+		// positions which fail to enrich are valued as of their last enrichment
+		p.logger.Warnf("Failed to enrich positions for the terminal value: %v", err)
+	}
+	taggedQty := p.taggedQty(user, asOf, view)
+	for _, position := range positions {
+		if position.Qty == 0 || !view.Includes(position.Trader, p.assetClass(position.Ticker)) {
+			continue
+		}
+		mv := position.Mv
+		if taggedQty != nil {
+			qty := taggedQty[position.Trader+":"+position.Ticker]
+			if qty == 0 {
+				continue
+			}
+			mv *= qty / position.Qty
+		}
+		flows = append(flows, Cashflow{Date: asOf.Format(time.DateOnly), Ticker: position.Ticker, Book: position.Trader, Component: ComponentTerminal, Amount: mv})
+	}
+
+	sort.SliceStable(flows, func(i, j int) bool { return flows[i].Date < flows[j].Date })
+	return flows, nil
+}
+
+// taggedQty returns the quantity bought net of sold by the trades with the tag of the view up to asOf, by book and
+// ticker, nil when the view has no tag.
+func (p *Portfolio) taggedQty(user *types.User, asOf time.Time, view *blotter.SavedView) map[string]float64 {
+	if view == nil || view.Tag == "" {
+		return nil
+	}
+
+	qty := make(map[string]float64)
+	for _, trade := range p.blotter.GetTradesByTag(view.Tag) {
+		if user != nil && !user.CanSeeBook(trade.Trader) {
+			continue
+		}
+		if tradeDate, err := time.Parse(time.RFC3339, trade.TradeDate); err != nil || tradeDate.After(asOf) {
+			continue
+		}
+		if trade.Side == blotter.TradeSideBuy {
+			qty[trade.Trader+":"+trade.Ticker] += trade.Quantity
+		} else {
+			qty[trade.Trader+":"+trade.Ticker] -= trade.Quantity
+		}
+	}
+	return qty
+}
+
+// qtyHeldBefore returns the quantity of each book held before the ex-date, from trades dated before it like the
+// dividends are calculated. Quantities are negative for shorts.
+func qtyHeldBefore(trades []blotter.Trade, exDate string) map[string]float64 {
+	held := make(map[string]float64)
+	for _, trade := range trades {
+		if trade.TradeDate >= exDate {
+			continue
+		}
+		qty := trade.Quantity
+		if trade.Side != blotter.TradeSideBuy {
+			qty = -qty
+		}
+		held[trade.Trader] += qty
+	}
+	return held
+}
+
+// bookDividend returns the dividend of a book holding qty before the ex-date, net of withholding tax for longs and the
+// gross dividend paid to the lender of the shares for shorts.
+func bookDividend(dividend dividends.Dividends, qty float64) float64 {
+	if qty < 0 {
+		return qty * dividend.AmountPerShare
+	}
+	return qty * dividend.AmountPerShare * (1 - dividend.WithholdingTax)
+}
+
+// XIRR returns the annualized rate at which the net present value of the cashflows is zero, found by bisection.
+// The cashflows need both an outflow and an inflow.
+func XIRR(flows []Cashflow) (float64, error) {
+	var hasOutflow, hasInflow bool
+	for _, flow := range flows {
+		hasOutflow = hasOutflow || flow.Amount < 0
+		hasInflow = hasInflow || flow.Amount > 0
+	}
+	if !hasOutflow || !hasInflow {
+		return 0, errors.New("cashflows need both an outflow and an inflow")
+	}
+
+	dates := make([]time.Time, len(flows))
+	for i, flow := range flows {
+		date, err := time.Parse(time.DateOnly, flow.Date)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cashflow date %s: %w", flow.Date, err)
+		}
+		dates[i] = date
+	}
+	start := slices.MinFunc(dates, func(a, b time.Time) int { return a.Compare(b) })
+	years := make([]float64, len(flows))
+	for i, date := range dates {
+		years[i] = date.Sub(start).Hours() / 24 / 365
+	}
+
+	npv := func(rate float64) float64 {
+		var total float64
+		for i, flow := range flows {
+			total += flow.Amount / math.Pow(1+rate, years[i])
+		}
+		return total
+	}
+
+	low, high := -0.9999, 1.0
+	for npv(low)*npv(high) > 0 {
+		if high > 1e6 {
+			return 0, errors.New("cashflows have no IRR")
+		}
+		high *= 2
+	}
+	for i := 0; i < 200 && high-low > 1e-10; i++ {
+		mid := (low + high) / 2
+		if npv(low)*npv(mid) <= 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return (low + high) / 2, nil
+}
+
+func isValidComponent(component string) bool {
+	switch component {
+	case ComponentPrincipal, ComponentFee, ComponentDividend, ComponentCoupon, ComponentTerminal:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,231 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// ExternalAsset is an asset held outside the books, e.g. property, CPF or bank balances, entered by hand.
+type ExternalAsset struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Ccy   string  `json:"ccy"`
+	AsOf  string  `json:"asOf"` // YYYY-MM-DD of the valuation
+}
+
+// NetWorthItem is a component of the net worth in its currency and the base currency.
+type NetWorthItem struct {
+	Name   string
+	Ccy    string
+	Value  float64
+	Fx     float64
+	Base   float64
+	AsOf   string `json:",omitempty"` // external assets only
+	Source string // book, cash or external
+}
+
+// Sources of the net worth items
+const (
+	NetWorthSourceBook     = "book"
+	NetWorthSourceCash     = "cash"
+	NetWorthSourceExternal = "external"
+)
+
+// NetWorth is the market value of the books, excluding cash, the cash balances and the external assets, converted to
+// the base currency.
+type NetWorth struct {
+	Date     string
+	BaseCcy  string
+	Books    []NetWorthItem // per book and currency
+	Cash     []NetWorthItem // per currency
+	External []NetWorthItem
+	Total    float64
+	Warnings []string // items which could not be converted, excluded from the total
+}
+
+// SetExternalAsset stores the external asset, replacing one of the same name, and returns it as stored. The currency
+// defaults to the base currency and the valuation date to today.
+func (p *Portfolio) SetExternalAsset(asset ExternalAsset) (*ExternalAsset, error) {
+	asset.Name = strings.TrimSpace(asset.Name)
+	asset.Ccy = strings.ToUpper(asset.Ccy)
+	if asset.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if asset.Ccy == "" {
+		asset.Ccy = blotter.BaseCurrency()
+	}
+	if asset.AsOf == "" {
+		asset.AsOf = time.Now().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", asset.AsOf); err != nil {
+		return nil, fmt.Errorf("invalid asOf %s, expected YYYY-MM-DD", asset.AsOf)
+	}
+	if err := p.db.Put(externalAssetKey(asset.Name), asset); err != nil {
+		return nil, fmt.Errorf("failed to store external asset %s: %w", asset.Name, err)
+	}
+	return &asset, nil
+}
+
+// DeleteExternalAsset deletes the external asset of the name.
+func (p *Portfolio) DeleteExternalAsset(name string) error {
+	return p.db.Delete(externalAssetKey(name))
+}
+
+// GetExternalAssets returns the external assets sorted by name.
+func (p *Portfolio) GetExternalAssets() ([]ExternalAsset, error) {
+	keys, err := p.db.GetAllKeysWithPrefix(string(types.ExternalAssetKeyPrefix) + ":")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list external assets: %w", err)
+	}
+
+	assets := []ExternalAsset{}
+	for _, key := range keys {
+		var asset ExternalAsset
+		if err := p.db.Get(key, &asset); err != nil {
+			return nil, fmt.Errorf("failed to get external asset %s: %w", key, err)
+		}
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Name < assets[j].Name })
+	return assets, nil
+}
+
+// GetNetWorth returns the net worth of the books the user may see, all books when user is nil. External assets are
+// personal rather than of a book, so they are only included for admins and when authentication is disabled.
+// Positions are converted at the cached FX rates, falling back to the market data sources.
+func (p *Portfolio) GetNetWorth(user *types.User, now time.Time) (*NetWorth, error) {
+	positions, err := p.GetPositionsForUser(user)
+	if err != nil {
+		// positions which fail to enrich are valued as of their last enrichment
+		p.logger.Warnf("Failed to enrich positions for the net worth: %v", err)
+	}
+
+	netWorth := &NetWorth{Date: now.Format("2006-01-02"), BaseCcy: blotter.BaseCurrency(), Books: []NetWorthItem{}, Cash: []NetWorthItem{}, External: []NetWorthItem{}}
+	books := make(map[[2]string]float64)
+	cash := make(map[string]float64)
+	for _, position := range positions {
+		if position.Qty == 0 {
+			continue
+		}
+		if position.AssetClass == rdata.AssetClassCash {
+			cash[position.Ccy] += position.Mv
+		} else {
+			books[[2]string{position.Trader, position.Ccy}] += position.Mv
+		}
+	}
+
+	for key, mv := range books {
+		netWorth.Books = append(netWorth.Books, p.netWorthItem(netWorth, key[0], key[1], mv, NetWorthSourceBook))
+	}
+	for ccy, balance := range cash {
+		netWorth.Cash = append(netWorth.Cash, p.netWorthItem(netWorth, ccy, ccy, balance, NetWorthSourceCash))
+	}
+
+	if user == nil || user.Admin {
+		assets, err := p.GetExternalAssets()
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range assets {
+			item := p.netWorthItem(netWorth, asset.Name, asset.Ccy, asset.Value, NetWorthSourceExternal)
+			item.AsOf = asset.AsOf
+			netWorth.External = append(netWorth.External, item)
+		}
+	}
+
+	for _, items := range [][]NetWorthItem{netWorth.Books, netWorth.Cash, netWorth.External} {
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].Name != items[j].Name {
+				return items[i].Name < items[j].Name
+			}
+			return items[i].Ccy < items[j].Ccy
+		})
+	}
+	sort.Strings(netWorth.Warnings)
+	return netWorth, nil
+}
+
+// netWorthItem converts the value to the base currency, adding it to the total of the net worth or a warning when
+// there is no rate.
+func (p *Portfolio) netWorthItem(netWorth *NetWorth, name, ccy string, value float64, source string) NetWorthItem {
+	item := NetWorthItem{Name: name, Ccy: ccy, Value: value, Source: source}
+	fx, err := p.cachedFxToBase(ccy, netWorth.BaseCcy)
+	if err != nil {
+		netWorth.Warnings = append(netWorth.Warnings, fmt.Sprintf("%s %s %s: %v, excluded", source, name, ccy, err))
+		return item
+	}
+	item.Fx = fx
+	item.Base = value * fx
+	netWorth.Total += item.Base
+	return item
+}
+
+// cachedFxToBase returns the rate of ccy to the base currency last served by the market data service, fetching it
+// when not cached.
+func (p *Portfolio) cachedFxToBase(ccy, baseCcy string) (float64, error) {
+	if ccy == "" || ccy == baseCcy {
+		return 1, nil
+	}
+	if data, err := p.mdata.GetCachedAssetPrice(fmt.Sprintf("%s-%s", ccy, baseCcy)); err == nil && data != nil && data.Price != 0 {
+		return data.Price, nil
+	}
+	return p.fxToBase(ccy, baseCcy)
+}
+
+// StoreNetWorthSnapshot stores the net worth of all books as of now under the day of now, replacing an earlier
+// snapshot of the day.
+func (p *Portfolio) StoreNetWorthSnapshot(now time.Time) (*NetWorth, error) {
+	netWorth, err := p.GetNetWorth(nil, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.db.Put(netWorthKey(netWorth.Date), netWorth); err != nil {
+		return nil, fmt.Errorf("failed to store net worth snapshot of %s: %w", netWorth.Date, err)
+	}
+	return netWorth, nil
+}
+
+// NetWorthPoint is the total net worth of a day, for charting.
+type NetWorthPoint struct {
+	Date  string
+	Total float64
+}
+
+// GetNetWorthHistory returns the total of the daily net worth snapshots from from to to, inclusive, in date order.
+func (p *Portfolio) GetNetWorthHistory(from, to time.Time) ([]NetWorthPoint, error) {
+	prefix := string(types.NetWorthKeyPrefix) + ":"
+	keys, err := p.db.GetAllKeysWithPrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list net worth snapshots: %w", err)
+	}
+	sort.Strings(keys)
+
+	fromDate, toDate := from.Format("2006-01-02"), to.Format("2006-01-02")
+	points := []NetWorthPoint{}
+	for _, key := range keys {
+		date := strings.TrimPrefix(key, prefix)
+		if date < fromDate || date > toDate {
+			continue
+		}
+		var netWorth NetWorth
+		if err := p.db.Get(key, &netWorth); err != nil {
+			return nil, fmt.Errorf("failed to get net worth snapshot of %s: %w", date, err)
+		}
+		points = append(points, NetWorthPoint{Date: date, Total: netWorth.Total})
+	}
+	return points, nil
+}
+
+func externalAssetKey(name string) string {
+	return fmt.Sprintf("%s:%s", types.ExternalAssetKeyPrefix, name)
+}
+
+func netWorthKey(date string) string {
+	return fmt.Sprintf("%s:%s", types.NetWorthKeyPrefix, date)
+}
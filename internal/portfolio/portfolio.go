@@ -1,10 +1,15 @@
 package portfolio
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"portfolio-manager/internal/audit"
 	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
 	"portfolio-manager/internal/dal"
 	"portfolio-manager/internal/dividends"
 	"portfolio-manager/pkg/event"
@@ -20,28 +25,38 @@ type Position struct {
 	Ccy           string
 	AssetClass    string
 	AssetSubClass string
-	Qty           float64
-	Mv            float64
+	Qty           float64 // negative for shorts
+	Mv            float64 // negative for shorts, the cost to cover at the current price
 	PnL           float64
 	Dividends     float64
 	AvgPx         float64
 	TotalPaid     float64
+	BreakEvenPx   *float64 // price at which closing the position leaves zero PnL, nil when closed
+	SeqNum        int      // sequence number of the last blotter trade applied
+
+	name string  // from reference data, set on enrichment for the compact view
+	px   float64 // price the position was valued at, set on enrichment for the compact view
 }
 
 type Portfolio struct {
-	positions     map[string]map[string]*Position // map[trader]map[ticker]*Position
-	currentSeqNum int                             // used as a pointer to point to the last blotter trade that was processed
-	db            dal.Database
-	mdata         mdata.MarketDataManager
-	rdata         rdata.ReferenceManager
-	dividendsMgr  *dividends.DividendsManager
-	mu            sync.Mutex
-	logger        *logging.Logger
+	positions      map[string]map[string]*Position // map[trader]map[ticker]*Position
+	currentSeqNum  int                             // used as a pointer to point to the last blotter trade that was processed
+	db             dal.Database
+	mdata          mdata.MarketDataManager
+	rdata          rdata.ReferenceManager
+	dividendsMgr   *dividends.DividendsManager
+	blotter        *blotter.TradeBlotter // set on subscribing, used to book trades which close positions
+	autoCloseRanOn string                // day of the last scheduled auto-close
+	snapshotRanOn  string                // day of the last scheduled position snapshot
+	bulk           bulkWrites            // position writes deferred during bulk imports
+	needsRebuild   bool                  // positions include trades ahead of the blotter head
+	mu             sync.Mutex
+	logger         *logging.Logger
 }
 
 func NewPortfolio(db dal.Database, mdata mdata.MarketDataManager, rdata rdata.ReferenceManager, dividendsSvc *dividends.DividendsManager) *Portfolio {
 	var currentSeqNum int
-	err := db.Get(string(types.HeadSequencePortfolioKey), currentSeqNum)
+	err := db.Get(string(types.HeadSequencePortfolioKey), &currentSeqNum)
 	if err != nil {
 		currentSeqNum = -1
 	}
@@ -59,28 +74,48 @@ func NewPortfolio(db dal.Database, mdata mdata.MarketDataManager, rdata rdata.Re
 
 // LoadPositions loads the positions from the database.
 func (p *Portfolio) LoadPositions() error {
-	positionKeys, err := p.db.GetAllKeysWithPrefix(string(types.PositionKeyPrefix))
+	// Read positions in a single pass and decode them concurrently, results come back in key order
+	positions, err := dal.ParallelLoad[Position](p.db, string(types.PositionKeyPrefix))
 	if err != nil {
 		return err
 	}
 
-	for _, key := range positionKeys {
-		var position Position
-		err := p.db.Get(key, &position)
-		if err != nil {
-			return err
-		}
-		err = p.updatePositionFromDb(&position)
+	for i := range positions {
+		err = p.updatePositionFromDb(&positions[i])
 		if err != nil {
 			return err
 		}
 	}
 
-	p.logger.Infof("Loaded %d positions from database", len(positionKeys))
+	p.logger.Infof("Loaded %d positions from database", len(positions))
 
 	return nil
 }
 
+// Reload discards the positions held in memory and loads them again from the database, e.g. after a restore.
+func (p *Portfolio) Reload() error {
+	var currentSeqNum int
+	err := p.db.Get(string(types.HeadSequencePortfolioKey), &currentSeqNum)
+	if err != nil {
+		currentSeqNum = -1
+	}
+
+	p.mu.Lock()
+	p.positions = make(map[string]map[string]*Position)
+	p.currentSeqNum = currentSeqNum
+	p.mu.Unlock()
+
+	if err := p.LoadPositions(); err != nil {
+		return err
+	}
+	if p.blotter != nil {
+		if err := p.VerifySequence(p.blotter.GetCurrentSeqNum()); err != nil {
+			p.logger.Errorf("%v", err)
+		}
+	}
+	return nil
+}
+
 // GetMdataManager returns the market data manager.
 func (p *Portfolio) GetMdataManager() mdata.MarketDataManager {
 	return p.mdata
@@ -98,22 +133,62 @@ func (p *Portfolio) GetDividendsManager() *dividends.DividendsManager {
 
 // SubscribeToBlotter subscribes to the blotter service and listens for new trade events.
 func (p *Portfolio) SubscribeToBlotter(blotterSvc *blotter.TradeBlotter) {
+	p.blotter = blotterSvc
+
 	// Check if the currentSeqNum is less than the current sequence number of the blotter, i
 	// if it is, replay the trades from the blotter starting from the currentSeqNum
+	// Positions persisted ahead of the sequence number, e.g. by a bulk flush which did not complete, skip the
+	// trades they already include
 	blotterSeqNum := blotterSvc.GetCurrentSeqNum()
+	if err := p.VerifySequence(blotterSeqNum); err != nil {
+		p.logger.Errorf("%v", err)
+	}
 	if p.currentSeqNum < blotterSeqNum {
-		blotterSvc.GetTradesBySeqNumRangeWithCallback(p.currentSeqNum+1, blotterSeqNum, func(trade blotter.Trade) { p.updatePosition(&trade) })
+		p.BeginBulkWrites()
+		blotterSvc.GetTradesBySeqNumRangeWithCallback(p.currentSeqNum+1, blotterSeqNum, func(trade blotter.Trade) {
+			if !p.isTradeApplied(&trade) {
+				p.updatePosition(&trade)
+			}
+		})
+		p.EndBulkWrites()
 	}
 
+	blotterSvc.SetBulkWriteListener(p)
+
 	blotterSvc.Subscribe(blotter.NewTradeEvent, event.NewEventHandler(func(e event.Event) {
 		trade := e.Data.(blotter.NewTradeEventPayload).Trade
-		p.logger.Infof("Received new trade event. tradeID: %s ticker: %s, tradeDate: %s", trade.TradeID, trade.Ticker, trade.TradeDate)
+		logger := p.logger
+		if e.Ctx != nil {
+			logger = logging.FromContext(e.Ctx)
+		}
+		logger.Infof("Received new trade event. tradeID: %s ticker: %s, tradeDate: %s", trade.TradeID, trade.Ticker, trade.TradeDate)
 		p.updatePosition(&trade)
 	}))
 
 	p.logger.Info("Subscribed to blotter service")
 }
 
+// VerifySequence checks the head sequence number of the portfolio is not ahead of the blotter's, which happens when
+// positions include trades missing from the blotter, e.g. after restoring an older blotter. Such positions are
+// flagged for a rebuild, see NeedsRebuild.
+func (p *Portfolio) VerifySequence(blotterSeqNum int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.needsRebuild = p.currentSeqNum > blotterSeqNum
+	if p.needsRebuild {
+		return fmt.Errorf("portfolio head sequence number %d is ahead of blotter head sequence number %d, positions need a rebuild", p.currentSeqNum, blotterSeqNum)
+	}
+	return nil
+}
+
+// NeedsRebuild reports whether the positions were found ahead of the blotter by VerifySequence.
+func (p *Portfolio) NeedsRebuild() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.needsRebuild
+}
+
 func (p *Portfolio) updatePositionFromDb(position *Position) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -136,6 +211,7 @@ func (p *Portfolio) updatePositionFromDb(position *Position) error {
 	positionToUpdate.Dividends = position.Dividends
 	positionToUpdate.AvgPx = position.AvgPx
 	positionToUpdate.TotalPaid = position.TotalPaid
+	positionToUpdate.SeqNum = position.SeqNum
 
 	return nil
 }
@@ -147,11 +223,6 @@ func (p *Portfolio) updatePosition(trade *blotter.Trade) error {
 	trader := trade.Trader
 	ticker := trade.Ticker
 
-	qty := trade.Quantity
-	if trade.Side == blotter.TradeSideSell {
-		qty = qty * -1
-	}
-
 	if _, ok := p.positions[trader]; !ok {
 		p.positions[trader] = make(map[string]*Position)
 	}
@@ -161,30 +232,77 @@ func (p *Portfolio) updatePosition(trade *blotter.Trade) error {
 	}
 
 	position := p.positions[trader][ticker]
-	totalPaid := position.AvgPx*position.Qty + trade.Price*qty // qty is negative for sell trades
-	position.TotalPaid = totalPaid
-	position.Qty += qty
+	applyTrade(position, trade, p.contractMultiplier(ticker))
 
-	if position.Qty == 0 {
-		position.AvgPx = 0
-	} else {
-		position.AvgPx = totalPaid / position.Qty
+	// Write position to the database, unless deferred until the end of a bulk import
+	positionKey := generatePositionKey(trade)
+	if p.deferPositionWrite(positionKey, position) {
+		p.currentSeqNum = max(p.currentSeqNum, trade.SeqNum)
+		return nil
 	}
 
-	// Write position to the database
-	positionKey := generatePositionKey(trade)
 	err := p.db.Put(positionKey, position)
 	if err != nil {
 		return err
 	}
 
 	if trade.SeqNum > p.currentSeqNum {
+		p.currentSeqNum = trade.SeqNum
 		p.saveSeqNumToDAL(trade.SeqNum)
 	}
 
 	return nil
 }
 
+// applyTrade updates the quantity, average price and total paid of the position with the trade. Fees add to the total
+// paid of buys and sells alike, raising the average price of buys and lowering the proceeds of sells. The total paid
+// is in the ticker's currency, i.e. scaled by the contract multiplier of derivatives, while the average price is
+// per unit as quoted.
+func applyTrade(position *Position, trade *blotter.Trade, multiplier float64) {
+	qty := trade.Quantity
+	if trade.Side == blotter.TradeSideSell {
+		qty = qty * -1
+	}
+
+	totalPaid := (position.AvgPx*position.Qty+trade.Price*qty)*multiplier + trade.FeeInTradeCcy() // qty is negative for sell trades
+	position.TotalPaid = totalPaid
+	position.Qty += qty
+
+	if position.Qty == 0 {
+		position.AvgPx = 0
+	} else {
+		position.AvgPx = totalPaid / (position.Qty * multiplier)
+	}
+
+	if trade.SeqNum > position.SeqNum {
+		position.SeqNum = trade.SeqNum
+	}
+}
+
+// contractMultiplier returns the contract multiplier of the ticker, 1 when it has no reference data.
+func (p *Portfolio) contractMultiplier(ticker string) float64 {
+	if p.rdata == nil {
+		return 1
+	}
+	tickerRef, err := p.rdata.GetTicker(ticker)
+	if err != nil {
+		return 1
+	}
+	return tickerRef.GetContractMultiplier()
+}
+
+// assetClass returns the asset class of the ticker, empty when it has no reference data.
+func (p *Portfolio) assetClass(ticker string) string {
+	if p.rdata == nil {
+		return ""
+	}
+	tickerRef, err := p.rdata.GetTicker(ticker)
+	if err != nil {
+		return ""
+	}
+	return tickerRef.AssetClass
+}
+
 func (p *Portfolio) GetPosition(trader, ticker string) (*Position, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -213,12 +331,20 @@ func (p *Portfolio) GetPositions(trader string) ([]*Position, error) {
 }
 
 func (p *Portfolio) GetAllPositions() ([]*Position, error) {
+	return p.GetPositionsForUser(nil)
+}
+
+// GetPositionsForUser returns the positions in the books (traders) the user may see, all positions when user is nil.
+func (p *Portfolio) GetPositionsForUser(user *types.User) ([]*Position, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	var positions []*Position
-	for _, traders := range p.positions {
-		for _, position := range traders {
+	for trader, tickers := range p.positions {
+		if user != nil && !user.CanSeeBook(trader) {
+			continue
+		}
+		for _, position := range tickers {
 			positions = append(positions, position)
 		}
 	}
@@ -226,10 +352,59 @@ func (p *Portfolio) GetAllPositions() ([]*Position, error) {
 	return positions, err
 }
 
+// ClosePosition closes quantity of the book's (trader) ticker, booking sells in the blotter against the open buys
+// they offset, oldest first, on behalf of the user. Closing more than the open quantity is rejected.
+func (p *Portfolio) ClosePosition(book, ticker string, quantity, price float64, tradeDate time.Time, user *types.User) ([]blotter.Trade, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+	return p.blotter.ClosePosition(book, ticker, quantity, price, tradeDate, user, audit.SourceAPI)
+}
+
+// GetOpenTickers returns the distinct tickers with an open position across traders, without enriching positions.
+func (p *Portfolio) GetOpenTickers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var tickers []string
+	for _, traders := range p.positions {
+		for ticker, position := range traders {
+			if _, ok := seen[ticker]; ok || position.Qty == 0 {
+				continue
+			}
+			seen[ticker] = struct{}{}
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// enrichPositions enriches the positions concurrently with a bounded pool of workers, collecting errors per position.
 func (p *Portfolio) enrichPositions(positions []*Position) error {
+	positionErrs := make([]error, len(positions))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(enrichConcurrency(), len(positions)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				positionErrs[i] = p.enrichPosition(positions[i])
+			}
+		}()
+	}
+	for i := range positions {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
 	var errs []error
-	for _, position := range positions {
-		if err := p.enrichPosition(position); err != nil {
+	for _, err := range positionErrs {
+		if err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -243,11 +418,18 @@ func (p *Portfolio) enrichPositions(positions []*Position) error {
 func (p *Portfolio) enrichPosition(position *Position) error {
 	tickerRef, err := p.rdata.GetTicker(position.Ticker)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get reference data for %s: %w", position.Ticker, err)
 	}
 
-	switch tickerRef.AssetClass {
-	case rdata.AssetClassEquities, rdata.AssetClassBonds:
+	if tickerRef.AssetClass == "" {
+		// we allow this since we want somethimes want tests to skip position computation,
+		// but leave a warning anyway, in case this happens in production
+		p.logger.Warnf("Asset class not found for ticker %s", position.Ticker)
+		return nil
+	}
+
+	strategy := p.enrichmentStrategy(tickerRef.AssetClass)
+	if strategy == EnrichPriceWithDividends {
 		// get dividends
 		dividends, err := p.dividendsMgr.CalculateDividendsForSingleTicker(position.Ticker)
 		if err != nil {
@@ -259,34 +441,52 @@ func (p *Portfolio) enrichPosition(position *Position) error {
 				position.Dividends += dividend.Amount
 			}
 		}
+	}
 
-		if position.Qty == 0 {
-			// when the position is closed, the PnL is the total paid + dividends
-			position.PnL = (position.TotalPaid * -1) + position.Dividends
-		} else {
-			assetData, err := p.mdata.GetAssetPrice(position.Ticker)
-			if err != nil {
-				return err
-			}
-
-			position.Mv = position.Qty * assetData.Price
-			position.PnL = (assetData.Price-position.AvgPx)*position.Qty + position.Dividends
+	if position.Qty == 0 {
+		// when the position is closed, the PnL is the total paid + dividends
+		position.PnL = (position.TotalPaid * -1) + position.Dividends
+		position.px = 0
+		position.BreakEvenPx = nil
+	} else {
+		price, err := p.priceByStrategy(strategy, position)
+		if err != nil {
+			return fmt.Errorf("failed to price %s: %w", position.Ticker, err)
 		}
-	case "":
-		// we allow this since we want somethimes want tests to skip position computation,
-		// but leave a warning anyway, in case this happens in production
-		p.logger.Warnf("Asset class not found for ticker %s", position.Ticker)
-		return nil
-	default:
-		return fmt.Errorf("asset class %s not supported", tickerRef.AssetClass)
+
+		multiplier := tickerRef.GetContractMultiplier()
+		position.px = price
+		position.Mv = position.Qty * price * multiplier
+		position.PnL = (price-position.AvgPx)*position.Qty*multiplier + position.Dividends
+		position.BreakEvenPx = breakEvenPx(position, multiplier)
 	}
 
+	position.name = tickerRef.Name
 	position.Ccy = tickerRef.Ccy
 	position.AssetClass = tickerRef.AssetClass
 	position.AssetSubClass = tickerRef.AssetSubClass
 	return nil
 }
 
+// breakEvenPx returns the price at which closing the position leaves zero PnL, netting off the dividends received.
+// Qty and TotalPaid are negative for shorts, so the same formula gives a lower price for shorts paying dividends.
+func breakEvenPx(position *Position, multiplier float64) *float64 {
+	if position.Qty == 0 {
+		return nil
+	}
+	px := (position.TotalPaid - position.Dividends) / (position.Qty * multiplier)
+	return &px
+}
+
+// enrichConcurrency returns the configured number of positions enriched concurrently.
+func enrichConcurrency() int {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.EnrichConcurrency <= 0 {
+		return config.DefaultEnrichConcurrency
+	}
+	return cfg.EnrichConcurrency
+}
+
 // saveSeqNumToDAL saves the current sequence number to the DAL database.
 func (p *Portfolio) saveSeqNumToDAL(seqNum int) {
 	// Implement the logic to save seqNum to the DAL database
@@ -1,14 +1,30 @@
 package portfolio
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
 	"portfolio-manager/internal/dividends"
 	"portfolio-manager/internal/mocks"
 	"portfolio-manager/pkg/mdata"
 	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/scheduler"
 	"portfolio-manager/pkg/types"
 
 	"github.com/stretchr/testify/assert"
@@ -136,6 +152,307 @@ func TestGetPositions(t *testing.T) {
 	allPositions, err := p.GetAllPositions()
 	assert.NoError(t, err)
 	assert.Len(t, allPositions, 3)
+
+	// Test GetPositionsForUser limits positions to the user's books
+	userPositions, err := p.GetPositionsForUser(&types.User{Name: "bob", Books: []string{"trader2"}})
+	assert.NoError(t, err)
+	assert.Len(t, userPositions, 1)
+	assert.Equal(t, "MSFT", userPositions[0].Ticker)
+}
+
+func TestEnrichCryptoPosition(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "BTC-USD", AssetClass: rdata.AssetClassCrypto, Ccy: "USD", CoinGeckoTicker: "bitcoin"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "FOO-USD", AssetClass: rdata.AssetClassCrypto, Ccy: "USD", CoinGeckoTicker: "foo"})
+	mdataMgr.SetAssetPrice("BTC-USD", &types.AssetData{Ticker: "BTC-USD", Price: 60000, Currency: "USD"})
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+
+	position := &Position{Ticker: "BTC-USD", Qty: 0.5, AvgPx: 40000}
+	assert.NoError(t, p.enrichPosition(position))
+	assert.Equal(t, 30000.0, position.Mv)
+	assert.Equal(t, 10000.0, position.PnL)
+	assert.Equal(t, rdata.AssetClassCrypto, position.AssetClass)
+
+	// unpriceable coins report the ticker instead of failing silently
+	err := p.enrichPosition(&Position{Ticker: "FOO-USD", Qty: 1})
+	assert.ErrorContains(t, err, "FOO-USD")
+}
+
+func TestEnrichPositionByAssetClassStrategy(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "GLD", AssetClass: rdata.AssetClassCommodities, AssetSubClass: rdata.AssetSubClassETF, Ccy: "USD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ART", AssetClass: "collectible", Ccy: "USD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "SGD", AssetClass: rdata.AssetClassCash, Ccy: "SGD"})
+	mdataMgr.SetAssetPrice("GLD", &types.AssetData{Ticker: "GLD", Price: 200})
+	mdataMgr.SetAssetPrice("ART", &types.AssetData{Ticker: "ART", Price: 50})
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+
+	// commodity ETF is priced without dividends
+	gld := &Position{Ticker: "GLD", Qty: 10, AvgPx: 180}
+	assert.NoError(t, p.enrichPosition(gld))
+	assert.Equal(t, 2000.0, gld.Mv)
+	assert.Equal(t, 200.0, gld.PnL)
+	assert.Equal(t, rdata.AssetSubClassETF, gld.AssetSubClass)
+
+	// unknown asset class falls back to priceable without dividends instead of erroring
+	art := &Position{Ticker: "ART", Qty: 2, AvgPx: 40}
+	assert.NoError(t, p.enrichPosition(art))
+	assert.Equal(t, 100.0, art.Mv)
+	assert.Equal(t, 20.0, art.PnL)
+
+	// cash is valued at par
+	cash := &Position{Ticker: "SGD", Qty: 1000, AvgPx: 1}
+	assert.NoError(t, p.enrichPosition(cash))
+	assert.Equal(t, 1000.0, cash.Mv)
+	assert.Equal(t, 0.0, cash.PnL)
+}
+
+func TestBreakEvenPx(t *testing.T) {
+	// long 100 at 50 having received 200 of dividends breaks even 2 lower
+	long := &Position{Qty: 100, AvgPx: 50, TotalPaid: 5000, Dividends: 200}
+	assert.InDelta(t, 48.0, *breakEvenPx(long, 1), 1e-9)
+
+	// short 100 at 50 having paid 200 of dividends must buy back 2 lower
+	short := &Position{Qty: -100, AvgPx: 50, TotalPaid: -5000, Dividends: -200}
+	assert.InDelta(t, 48.0, *breakEvenPx(short, 1), 1e-9)
+
+	// closed positions have no break-even
+	assert.Nil(t, breakEvenPx(&Position{TotalPaid: -300}, 1))
+
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "GLD", AssetClass: rdata.AssetClassCommodities, Ccy: "USD"})
+	mdataMgr.SetAssetPrice("GLD", &types.AssetData{Ticker: "GLD", Price: 200})
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+
+	// selling at the break-even price leaves zero PnL
+	gld := &Position{Ticker: "GLD", Qty: 10, AvgPx: 180, TotalPaid: 1800}
+	assert.NoError(t, p.enrichPosition(gld))
+	assert.InDelta(t, 180.0, *gld.BreakEvenPx, 1e-9)
+
+	gld.Qty, gld.TotalPaid = 0, -200
+	assert.NoError(t, p.enrichPosition(gld))
+	assert.Nil(t, gld.BreakEvenPx)
+}
+
+func TestSummarize(t *testing.T) {
+	summary := Summarize([]*Position{
+		{Ticker: "A", Qty: 100, Mv: 4000, PnL: -1000},
+		{Ticker: "B", Qty: 10, Mv: 1000, PnL: 200, Dividends: 50},
+		{Ticker: "C", Mv: 999, PnL: -200}, // closed, the stale market value is ignored
+	})
+	assert.Equal(t, 5000.0, summary.Mv)
+	assert.Equal(t, -1000.0, summary.PnL)
+	assert.Equal(t, 50.0, summary.Dividends)
+	assert.Equal(t, 2, summary.OpenPositions)
+	assert.InDelta(t, 20.0, *summary.BreakEvenMovePct, 1e-9)
+
+	assert.Nil(t, Summarize([]*Position{{Ticker: "C", PnL: -200}}).BreakEvenMovePct)
+}
+
+func TestXIRR(t *testing.T) {
+	irr, err := XIRR([]Cashflow{{Date: "2023-01-01", Amount: -100}, {Date: "2024-01-01", Amount: 110}})
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.10, irr, 1e-6)
+
+	_, err = XIRR([]Cashflow{{Date: "2023-01-01", Amount: 100}})
+	assert.Error(t, err)
+}
+
+func TestGetIRRExcludingDividends(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", DividendsSgTicker: "D05"})
+	mdataMgr.SetAssetPrice("D05.SI", &types.AssetData{Ticker: "D05.SI", Price: 10})
+	mdataMgr.SetDividendMetadata("D05.SI", []types.DividendsMetadata{{Ticker: "D05.SI", ExDate: "2023-07-03", Amount: 0.5}})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "trader1", "dbs", "cdp", 10.0, 0.0, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	asOf := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	total, err := p.GetIRR(nil, asOf, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{ComponentPrincipal: -1000, ComponentDividend: 50, ComponentTerminal: 1000}, total.Components)
+
+	// the price is unchanged, so the price return alone is zero and the dividends make up the total return
+	priceOnly, err := p.GetIRR(nil, asOf, []string{ComponentDividend, ComponentCoupon})
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.0, *priceOnly.IRR, 1e-6)
+	assert.Greater(t, *total.IRR, *priceOnly.IRR)
+	assert.InDelta(t, 0.0506, *total.IRR, 1e-3)
+	assert.Equal(t, total.Components, priceOnly.Components)
+
+	// only income and no outflow has no IRR
+	income, err := p.GetIRR(nil, asOf, []string{ComponentPrincipal})
+	assert.NoError(t, err)
+	assert.Nil(t, income.IRR)
+
+	_, err = p.GetIRR(nil, asOf, []string{"bogus"})
+	assert.Error(t, err)
+}
+
+func TestGetIRRForTag(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", DividendsSgTicker: "D05"})
+	mdataMgr.SetAssetPrice("D05.SI", &types.AssetData{Ticker: "D05.SI", Price: 12})
+	mdataMgr.SetDividendMetadata("D05.SI", []types.DividendsMetadata{{Ticker: "D05.SI", ExDate: "2023-07-03", Amount: 0.5}})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	dca := must(blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "trader1", "dbs", "cdp", 10.0, 0.0, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)))
+	dca.Tags = []string{"DCA"}
+	assert.NoError(t, blotterSvc.AddTrade(*dca))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 300, "D05.SI", "trader1", "dbs", "cdp", 11.0, 0.0, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	// the dividends and the terminal value are those of the quantity of the tagged trades
+	asOf := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	report, err := p.GetIRRForTag(nil, asOf, nil, "dca")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{ComponentPrincipal: -1000, ComponentDividend: 50, ComponentTerminal: 1200}, report.Components)
+
+	total, err := p.GetIRR(nil, asOf, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{ComponentPrincipal: -4300, ComponentDividend: 200, ComponentTerminal: 4800}, total.Components)
+
+	untagged, err := p.GetIRRForTag(nil, asOf, nil, "speculative")
+	assert.NoError(t, err)
+	assert.Empty(t, untagged.Components)
+	assert.Nil(t, untagged.IRR)
+}
+
+func TestMetricsForSavedView(t *testing.T) {
+	db := newLevelDB(t)
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ES3", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "BTC-USD", AssetClass: rdata.AssetClassCrypto, Ccy: "USD"})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 4})
+	mdataMgr.SetAssetPrice("BTC-USD", &types.AssetData{Ticker: "BTC-USD", Price: 50000})
+	blotterSvc := blotter.NewBlotter(db)
+	blotterSvc.SetReferenceManager(rdataMgr)
+	p := NewPortfolio(db, mdataMgr, rdataMgr, dividends.NewDividendsManager(db, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	tradeDate := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	dca := must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", "trader1", "dbs", "cdp", 3.0, 0.0, tradeDate))
+	dca.Tags = []string{"DCA"}
+	assert.NoError(t, blotterSvc.AddTrade(*dca))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 300, "ES3", "trader1", "dbs", "cdp", 3.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 1, "BTC-USD", "trader1", "coinbase", "spot", 20000.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", "trader2", "dbs", "cdp", 3.0, 0.0, tradeDate))))
+	waitForPositions(t, p, map[string]float64{"trader1:ES3": 400, "trader1:BTC-USD": 1, "trader2:ES3": 100})
+
+	// the view keeps the equities of trader1
+	asOf := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	view, err := blotterSvc.SaveSavedView(blotter.SavedView{Name: "Retirement", Books: []string{"trader1"}, ExcludeAssetClasses: []string{rdata.AssetClassCrypto}})
+	assert.NoError(t, err)
+	irr, err := p.GetIRRForView(nil, asOf, nil, &view)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{ComponentPrincipal: -1200, ComponentTerminal: 1600}, irr.Components)
+
+	breakdown, err := p.GetBreakdownForView(nil, GroupByAssetClass, asOf, &view)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{rdata.AssetClassEquities}, slices.Collect(maps.Keys(breakdown.Groups)))
+	assert.InDelta(t, 1600, breakdown.Groups[rdata.AssetClassEquities].Mv, 1e-9)
+
+	// with a tag, an open position counts for the quantity of its tagged trades
+	view.Tag = "dca"
+	breakdown, err = p.GetBreakdownForView(nil, GroupByBook, asOf, &view)
+	assert.NoError(t, err)
+	assert.InDelta(t, 400, breakdown.Groups["trader1"].Mv, 1e-9)
+	assert.InDelta(t, 300, breakdown.Groups["trader1"].PricePaid, 1e-9)
+
+	// the endpoints take the saved view by name, with a tag of the query on top of it
+	serve := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		HandleBreakdownGet(p).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+	var tagged Breakdown
+	rr := serve("/api/v1/portfolio/breakdown?group_by=book&saved_view=retirement&tag=DCA")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&tagged))
+	assert.InDelta(t, 400, tagged.Groups["trader1"].Mv, 1e-9)
+	assert.Equal(t, http.StatusNotFound, serve("/api/v1/portfolio/breakdown?group_by=book&saved_view=bogus").Code)
+}
+
+func TestGetTWR(t *testing.T) {
+	db := newLevelDB(t)
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", DividendsSgTicker: "D05"})
+	mdataMgr.SetAssetPrice("D05.SI", &types.AssetData{Ticker: "D05.SI", Price: 15})
+	mdataMgr.SetDividendMetadata("D05.SI", []types.DividendsMetadata{{Ticker: "D05.SI", ExDate: "2023-10-02", Amount: 0.5}})
+	mdataMgr.HistoricalData["D05.SI"] = []*types.AssetData{
+		{Ticker: "D05.SI", Price: 10, Timestamp: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC).Unix()},
+		{Ticker: "D05.SI", Price: 12, Timestamp: time.Date(2023, 7, 3, 0, 0, 0, 0, time.UTC).Unix()},
+		{Ticker: "D05.SI", Price: 15, Timestamp: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+	blotterSvc := blotter.NewBlotter(db)
+	p := NewPortfolio(db, mdataMgr, rdataMgr, dividends.NewDividendsManager(db, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "trader1", "dbs", "cdp", 10.0, 0.0, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "trader1", "dbs", "cdp", 12.0, 0.0, time.Date(2023, 7, 3, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	// 1000 grows to 1200 before the second buy, then 2400 grows to 3000 plus 100 of dividends: 1.2 * 3100 / 2400
+	asOf := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	report, err := p.GetTWR(nil, asOf, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-01-02", report.From)
+	assert.Equal(t, "2024-01-02", report.To)
+	assert.Equal(t, 2, report.Periods)
+	assert.InDelta(t, 0.55, *report.Cumulative, 1e-9)
+	assert.InDelta(t, 0.55, *report.Annualized, 1e-3)
+	assert.Empty(t, report.Warnings)
+
+	// the IRR weights the second, larger buy, so the two returns differ
+	irr, err := p.GetIRR(nil, asOf, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, *report.Annualized, *irr.IRR)
+
+	// books the user may not see are excluded
+	report, err = p.GetTWR(&types.User{Name: "trader2", Books: []string{"trader2"}}, asOf, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, report.Cumulative)
+	assert.Nil(t, report.Annualized)
+
+	// the daily snapshot records the cumulative TWR, and older snapshots without it decode to zero
+	snapshot, err := p.StorePositionSnapshot(asOf)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.55, snapshot.TWR, 1e-9)
+
+	assert.NoError(t, db.Put(snapshotKey("2023-12-29"), map[string]any{"Date": "2023-12-29", "Positions": []any{}, "Mv": 3000}))
+	old, err := p.GetPositionSnapshot(nil, time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Zero(t, old.TWR)
+}
+
+func TestEnrichmentStrategyConfigOverride(t *testing.T) {
+	config.SetConfig(&config.Config{EnrichmentStrategies: map[string]string{
+		rdata.AssetClassCommodities: EnrichManualOnly,
+		rdata.AssetClassCrypto:      "bogus",
+	}})
+	defer config.SetConfig(nil)
+
+	p, _ := createTestPortfolio()
+	assert.Equal(t, EnrichManualOnly, p.enrichmentStrategy(rdata.AssetClassCommodities))
+	assert.Equal(t, EnrichPriceNoDividends, p.enrichmentStrategy(rdata.AssetClassCrypto))
+	assert.Equal(t, EnrichPriceWithDividends, p.enrichmentStrategy(rdata.AssetClassEquities))
 }
 
 func TestLoadPositions(t *testing.T) {
@@ -143,9 +460,6 @@ func TestLoadPositions(t *testing.T) {
 	mockDB.On("Get", string(types.HeadSequencePortfolioKey), mock.Anything).Return(nil)
 	mockDB.On("Get", mock.AnythingOfType("string"), mock.AnythingOfType("*rdata.TickerReference")).Return(nil)
 	mockDB.On("GetAllKeysWithPrefix", string(types.ReferenceDataKeyPrefix), mock.Anything).Return([]string{}, nil)
-	mockDB.On("GetAllKeysWithPrefix", string(types.PositionKeyPrefix)).Return([]string{
-		string(types.PositionKeyPrefix) + ":trader1:AAPL",
-	}, nil)
 
 	position := &Position{
 		Ticker: "AAPL",
@@ -155,9 +469,9 @@ func TestLoadPositions(t *testing.T) {
 		PnL:    1000,
 		AvgPx:  150.0,
 	}
-	mockDB.On("Get", string(types.PositionKeyPrefix)+":trader1:AAPL", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
-		pos := args.Get(1).(*Position)
-		*pos = *position
+	mockDB.On("Iterate", string(types.PositionKeyPrefix), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		fn := args.Get(1).(func(string, []byte) error)
+		fn(string(types.PositionKeyPrefix)+":trader1:AAPL", must(json.Marshal(position)))
 	})
 
 	p := createTestPortfolioWithDb(mockDB)
@@ -210,3 +524,1218 @@ func must[T any](v T, err error) T {
 	}
 	return v
 }
+
+// slowMarketDataManager simulates upstream latency on a cold cache.
+type slowMarketDataManager struct {
+	*mocks.MockMarketDataManager
+	delay time.Duration
+}
+
+func (m *slowMarketDataManager) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	time.Sleep(m.delay)
+	return m.MockMarketDataManager.GetAssetPrice(ticker)
+}
+
+func newEnrichBenchmarkPortfolio(numTickers int) (*Portfolio, []*Position) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := &slowMarketDataManager{MockMarketDataManager: mocks.NewMockMarketDataManager(), delay: 5 * time.Millisecond}
+	rdataMgr := mocks.NewMockReferenceManager()
+
+	positions := make([]*Position, numTickers)
+	for i := range positions {
+		ticker := fmt.Sprintf("T%02d", i)
+		rdataMgr.AddTicker(rdata.TickerReference{ID: ticker, AssetClass: rdata.AssetClassCommodities, Ccy: "USD"})
+		mdataMgr.SetAssetPrice(ticker, &types.AssetData{Ticker: ticker, Price: 10})
+		positions[i] = &Position{Ticker: ticker, Qty: 1, AvgPx: 5}
+	}
+
+	return NewPortfolio(mockDB, mdataMgr, rdataMgr, nil), positions
+}
+
+func TestEnrichPositionsConcurrently(t *testing.T) {
+	p, positions := newEnrichBenchmarkPortfolio(20)
+	positions = append(positions, &Position{Ticker: "UNKNOWN", Qty: 1})
+
+	err := p.enrichPositions(positions)
+	assert.ErrorContains(t, err, "UNKNOWN")
+	for _, position := range positions[:20] {
+		assert.Equal(t, 10.0, position.Mv)
+		assert.Equal(t, 5.0, position.PnL)
+	}
+}
+
+func TestCompactPositions(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+
+	positions := make([]*Position, 0, 100)
+	for i := 0; i < 100; i++ {
+		ticker := fmt.Sprintf("T%02d", i)
+		rdataMgr.AddTicker(rdata.TickerReference{ID: ticker, Name: "Ticker " + ticker, AssetClass: rdata.AssetClassCommodities, Ccy: "USD"})
+		mdataMgr.SetAssetPrice(ticker, &types.AssetData{Ticker: ticker, Price: 10.0 / 3})
+		positions = append(positions, &Position{Ticker: ticker, Trader: "traderA", Qty: float64(i + 1), AvgPx: 1.23456789, TotalPaid: 1.23456789 * float64(i+1)})
+	}
+	assert.NoError(t, p.enrichPositions(positions))
+
+	compact := CompactPositions(positions)
+	assert.Len(t, compact, 100)
+	assert.Equal(t, CompactPosition{Ticker: "T99", Name: "Ticker T99", Qty: 100, Px: 3.3333, Mv: 333.33, PnL: 209.88}, compact[0])
+	for i := 1; i < len(compact); i++ {
+		assert.GreaterOrEqual(t, compact[i-1].Mv, compact[i].Mv)
+	}
+
+	// the compact view stays under 40% of the full payload, guard against it growing
+	full, err := json.Marshal(positions)
+	assert.NoError(t, err)
+	trimmed, err := json.Marshal(compact)
+	assert.NoError(t, err)
+	assert.Less(t, len(trimmed)*5, len(full)*2, "compact %d bytes, full %d bytes", len(trimmed), len(full))
+
+	_, err = positionsView(positions, "bogus")
+	assert.Error(t, err)
+}
+
+func BenchmarkEnrichPositions(b *testing.B) {
+	defer config.SetConfig(nil)
+
+	for _, concurrency := range []int{1, config.DefaultEnrichConcurrency} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			config.SetConfig(&config.Config{EnrichConcurrency: concurrency})
+			p, positions := newEnrichBenchmarkPortfolio(60)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := p.enrichPositions(positions); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoCloseTrades(t *testing.T) {
+	config.SetConfig(&config.Config{AutoCloseSubClasses: []string{rdata.AssetSubClassGovies, rdata.AssetSubClassFD}})
+	defer config.SetConfig(nil)
+
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "SBJAN24", AssetClass: rdata.AssetClassBonds, AssetSubClass: rdata.AssetSubClassGovies, Ccy: "SGD", MaturityDate: "2024-01-01"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "SBJAN34", AssetClass: rdata.AssetClassBonds, AssetSubClass: rdata.AssetSubClassGovies, Ccy: "SGD", MaturityDate: "2034-01-01"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "FD", AssetClass: rdata.AssetClassBonds, AssetSubClass: rdata.AssetSubClassFD, Ccy: "SGD"})
+	mdataMgr.SetDividendMetadata("SBJAN24", []types.DividendsMetadata{
+		{Ticker: "SBJAN24", ExDate: "2023-07-01", Amount: 1.5},
+		{Ticker: "SBJAN24", ExDate: "2024-01-01", Amount: 1.6},
+	})
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p.SubscribeToBlotter(blotterSvc)
+
+	for _, ticker := range []string{"SBJAN24", "SBJAN34", "FD"} {
+		trade := must(blotter.NewTrade(blotter.TradeSideBuy, 500, ticker, "trader1", "dbs", "cdp", 100.0, 0.0, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.NoError(t, blotterSvc.AddTrade(*trade))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// only the matured SSB is closed, at par plus the final coupon, the bond lacking maturity data is skipped
+	asOf := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	closed, err := p.AutoCloseTrades(asOf)
+	assert.NoError(t, err)
+	assert.Len(t, closed, 1)
+	assert.Equal(t, "SBJAN24", closed[0].Ticker)
+	assert.Equal(t, 500.0, closed[0].Quantity)
+	assert.Equal(t, 101.6, closed[0].Price)
+	assert.Equal(t, blotter.TradeStatusClosed, closed[0].Status)
+	assert.Equal(t, "2024-01-01T00:00:00Z", closed[0].TradeDate)
+
+	// idempotent when run again
+	closed, err = p.AutoCloseTrades(asOf)
+	assert.NoError(t, err)
+	assert.Empty(t, closed)
+}
+
+// cacheOnlyMarketDataManager fails on upstream price fetches.
+type cacheOnlyMarketDataManager struct {
+	*mocks.MockMarketDataManager
+	t *testing.T
+}
+
+func (m *cacheOnlyMarketDataManager) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	m.t.Errorf("unexpected upstream price fetch of %s", ticker)
+	return nil, fmt.Errorf("unexpected upstream price fetch of %s", ticker)
+}
+
+func TestGetEnrichedTrades(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := &cacheOnlyMarketDataManager{MockMarketDataManager: mocks.NewMockMarketDataManager(), t: t}
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ES3", Name: "STI ETF", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 3.5})
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+	p.blotter = blotter.NewBlotter(mockDB)
+
+	addTrade := func(side, ticker string, day int) {
+		trade := must(blotter.NewTrade(side, 100, ticker, "trader1", "dbs", "cdp", 3.0, 0.0, time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)))
+		assert.NoError(t, p.blotter.AddTrade(*trade))
+		assert.NoError(t, p.updatePosition(trade))
+	}
+	addTrade(blotter.TradeSideBuy, "ES3", 1)
+	addTrade(blotter.TradeSideBuy, "UNKNOWN", 2)
+	addTrade(blotter.TradeSideSell, "UNKNOWN", 3)
+
+	trades, err := p.GetEnrichedTrades(blotter.TradeFilter{}, nil, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, trades.Total)
+	assert.Len(t, trades.Rows, 2)
+
+	es3 := trades.Rows[0]
+	assert.Equal(t, "STI ETF", *es3.TickerName)
+	assert.Equal(t, "SGD", *es3.Ccy)
+	assert.Equal(t, 3.5, *es3.Px)
+	assert.True(t, *es3.PositionOpen)
+
+	// missing reference data and prices degrade to nulls
+	unknown := trades.Rows[1]
+	assert.Nil(t, unknown.TickerName)
+	assert.Nil(t, unknown.Ccy)
+	assert.Nil(t, unknown.Px)
+	assert.False(t, *unknown.PositionOpen)
+
+	trades, err = p.GetEnrichedTrades(blotter.TradeFilter{Ticker: "UNKNOWN", From: "2024-01-03"}, nil, 1, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, trades.Total)
+	assert.Equal(t, blotter.TradeSideSell, trades.Rows[0].Side)
+}
+
+func TestEnrichedTradesHandlerScopedToUser(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	p := NewPortfolio(mockDB, mocks.NewMockMarketDataManager(), mocks.NewMockReferenceManager(), nil)
+	p.blotter = blotter.NewBlotter(mockDB)
+	for _, trader := range []string{"alice", "bob", "bob"} {
+		trade := must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", trader, "dbs", "cdp", 3.0, 0.0, time.Now()))
+		assert.NoError(t, p.blotter.AddTrade(*trade))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/blotter/trades/enriched", nil)
+	req = req.WithContext(context.WithValue(req.Context(), types.UserKey, &types.User{Name: "alice", Books: []string{"alice"}}))
+	rr := httptest.NewRecorder()
+	HandleEnrichedTradesGet(p).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var trades blotter.Page[EnrichedTrade]
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&trades))
+	assert.Equal(t, 1, trades.Total)
+	assert.Equal(t, "alice", trades.Rows[0].Trader)
+}
+
+func BenchmarkBlotterPage(b *testing.B) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := &slowMarketDataManager{MockMarketDataManager: mocks.NewMockMarketDataManager(), delay: 5 * time.Millisecond}
+	rdataMgr := mocks.NewMockReferenceManager()
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+	p.blotter = blotter.NewBlotter(mockDB)
+	for i := 0; i < 50; i++ {
+		ticker := fmt.Sprintf("T%02d", i%20)
+		rdataMgr.AddTicker(rdata.TickerReference{ID: ticker, AssetClass: rdata.AssetClassCommodities, Ccy: "USD"})
+		mdataMgr.SetAssetPrice(ticker, &types.AssetData{Ticker: ticker, Price: 10})
+		trade := must(blotter.NewTrade(blotter.TradeSideBuy, 1, ticker, "trader1", "dbs", "cdp", 5.0, 0.0, time.Now()))
+		p.blotter.AddTrade(*trade)
+		p.updatePosition(trade)
+	}
+
+	b.Run("separate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p.blotter.GetTrades()
+			p.GetAllPositions()
+			rdataMgr.GetAllTickers()
+		}
+	})
+	b.Run("enriched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := p.GetEnrichedTrades(blotter.TradeFilter{}, nil, 1, 50); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+type recordingNotifier struct {
+	messages []string
+}
+
+func (n *recordingNotifier) Notify(source, message string) error {
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func TestScheduledAutoCloseRunsOncePerDay(t *testing.T) {
+	config.SetConfig(&config.Config{AutoCloseSchedule: config.AutoCloseScheduleConfig{Time: "08:30", Notify: true}})
+	defer config.SetConfig(nil)
+
+	_, mockDB := createTestPortfolio()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "BS24100X", AssetClass: rdata.AssetClassBonds, AssetSubClass: rdata.AssetSubClassGovies, Ccy: "SGD", MaturityDate: "2024-06-01"})
+	p := NewPortfolio(mockDB, mocks.NewMockMarketDataManager(), rdataMgr, nil)
+	p.blotter = blotter.NewBlotter(mockDB)
+	trade := must(blotter.NewTrade(blotter.TradeSideBuy, 1000, "BS24100X", "trader1", "dbs", "cdp", 98.0, 0.0, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.NoError(t, p.blotter.AddTrade(*trade))
+	assert.NoError(t, p.updatePosition(trade))
+
+	notifier := &recordingNotifier{}
+	assert.ErrorIs(t, p.runScheduledAutoClose(time.Date(2024, 6, 3, 8, 0, 0, 0, time.Local), notifier), scheduler.ErrNotDue)
+	assert.NoError(t, p.runScheduledAutoClose(time.Date(2024, 6, 3, 8, 30, 0, 0, time.Local), notifier))
+	assert.ErrorIs(t, p.runScheduledAutoClose(time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local), notifier), scheduler.ErrNotDue)
+	assert.Len(t, notifier.messages, 1)
+	assert.Contains(t, notifier.messages[0], "BS24100X")
+
+	// runs again the next day but closes nothing further
+	assert.NoError(t, p.runScheduledAutoClose(time.Date(2024, 6, 4, 9, 0, 0, 0, time.Local), notifier))
+	assert.Len(t, notifier.messages, 1)
+	assert.Empty(t, p.blotter.OpenLots("trader1", "BS24100X"))
+}
+
+// countingDatabase counts position and sequence number writes, failing position writes beyond positionPutLimit to
+// simulate a crash midway through a flush.
+type countingDatabase struct {
+	dal.Database
+	mu               sync.Mutex
+	positionPuts     int
+	seqNumPuts       int
+	positionPutLimit int // negative for no limit
+}
+
+func (db *countingDatabase) Put(key string, value interface{}) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(key, string(types.PositionKeyPrefix)):
+		if db.positionPutLimit >= 0 && db.positionPuts >= db.positionPutLimit {
+			return errors.New("crashed")
+		}
+		db.positionPuts++
+	case key == string(types.HeadSequencePortfolioKey):
+		db.seqNumPuts++
+	}
+	return db.Database.Put(key, value)
+}
+
+func (db *countingDatabase) counts() (int, int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.positionPuts, db.seqNumPuts
+}
+
+const bulkImportCSV = `TradeDate,Ticker,Side,Quantity,Price,Yield,Trader,Broker,Account
+2024-01-02T00:00:00Z,AAPL,buy,10,150,,trader1,dbs,cdp
+2024-01-03T00:00:00Z,AAPL,buy,10,160,,trader1,dbs,cdp
+2024-01-04T00:00:00Z,MSFT,buy,5,300,,trader1,dbs,cdp
+2024-01-05T00:00:00Z,AAPL,sell,5,170,,trader1,dbs,cdp
+2024-01-06T00:00:00Z,GOOG,buy,20,100,,trader1,dbs,cdp
+2024-01-07T00:00:00Z,MSFT,buy,5,310,,trader1,dbs,cdp
+`
+
+func newLevelDB(t *testing.T) dal.Database {
+	db, err := dal.Open(dal.TestDbType(), filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// waitForPositions waits until the trade events, applied asynchronously, bring the positions keyed by trader:ticker
+// to the expected quantities and any deferred bulk writes are flushed, so the test neither races the updates nor
+// closes the database under a pending flush.
+func waitForPositions(t *testing.T, p *Portfolio, expected map[string]float64) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.bulk.dirty != nil || p.bulk.timer != nil {
+			return false
+		}
+		for key, qty := range expected {
+			trader, ticker, _ := strings.Cut(key, ":")
+			if position, ok := p.positions[trader][ticker]; !ok || position.Qty != qty {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// positionQty returns the quantity of the trader's position in the ticker, read under the lock the trade events
+// update it with.
+func positionQty(p *Portfolio, trader, ticker string) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if position, ok := p.positions[trader][ticker]; ok {
+		return position.Qty
+	}
+	return 0
+}
+
+func TestVerifySequenceFlagsPortfolioAhead(t *testing.T) {
+	db := newLevelDB(t)
+	blotterSvc := blotter.NewBlotter(db)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 10, "AAPL", "trader1", "broker1", "cdp", 150.0, 0.0, time.Now()))))
+	}
+
+	consistent := NewPortfolio(db, nil, nil, nil)
+	consistent.SubscribeToBlotter(blotterSvc)
+	assert.False(t, consistent.NeedsRebuild())
+
+	// positions which include trades missing from a restored blotter
+	assert.NoError(t, db.Put(string(types.HeadSequencePortfolioKey), 5))
+	ahead := NewPortfolio(db, nil, nil, nil)
+	assert.Error(t, ahead.VerifySequence(blotterSvc.GetCurrentSeqNum()))
+	assert.True(t, ahead.NeedsRebuild())
+}
+
+func TestBulkImportCoalescesPositionWrites(t *testing.T) {
+	db := &countingDatabase{Database: newLevelDB(t), positionPutLimit: -1}
+	p := NewPortfolio(db, mocks.NewMockMarketDataManager(), mocks.NewMockReferenceManager(), nil)
+	blotterSvc := blotter.NewBlotter(db)
+	p.SubscribeToBlotter(blotterSvc)
+
+	assert.NoError(t, blotterSvc.ImportFromCSVReader(csv.NewReader(strings.NewReader(bulkImportCSV))))
+	time.Sleep(bulkFlushDelay + 200*time.Millisecond)
+
+	positionPuts, seqNumPuts := db.counts()
+	assert.Equal(t, 3, positionPuts)
+	assert.Equal(t, 1, seqNumPuts)
+
+	var seqNum int
+	assert.NoError(t, db.Get(string(types.HeadSequencePortfolioKey), &seqNum))
+	assert.Equal(t, blotterSvc.GetCurrentSeqNum(), seqNum)
+	assert.Equal(t, float64(15), p.positions["trader1"]["AAPL"].Qty)
+}
+
+func TestInterruptedBulkFlushRecoversOnReplay(t *testing.T) {
+	db := &countingDatabase{Database: newLevelDB(t), positionPutLimit: 1}
+	p := NewPortfolio(db, mocks.NewMockMarketDataManager(), mocks.NewMockReferenceManager(), nil)
+	blotterSvc := blotter.NewBlotter(db)
+	p.SubscribeToBlotter(blotterSvc)
+
+	assert.NoError(t, blotterSvc.ImportFromCSVReader(csv.NewReader(strings.NewReader(bulkImportCSV))))
+	time.Sleep(bulkFlushDelay + 200*time.Millisecond)
+
+	// only one of the three positions makes it to the database, and the sequence number is left behind
+	positionPuts, seqNumPuts := db.counts()
+	assert.Equal(t, 1, positionPuts)
+	assert.Equal(t, 0, seqNumPuts)
+
+	// restart, the blotter replay recovers the lost positions without double counting the flushed one
+	restarted := NewPortfolio(db.Database, mocks.NewMockMarketDataManager(), mocks.NewMockReferenceManager(), nil)
+	assert.NoError(t, restarted.LoadPositions())
+	restartedBlotter := blotter.NewBlotter(db.Database)
+	assert.NoError(t, restartedBlotter.LoadFromDB())
+	restarted.SubscribeToBlotter(restartedBlotter)
+
+	expected := map[string]float64{"AAPL": 15, "MSFT": 10, "GOOG": 20}
+	restarted.mu.Lock()
+	defer restarted.mu.Unlock()
+	assert.Len(t, restarted.positions["trader1"], len(expected))
+	for ticker, qty := range expected {
+		assert.Equal(t, qty, restarted.positions["trader1"][ticker].Qty, ticker)
+	}
+}
+
+func TestRenameTicker(t *testing.T) {
+	db := newLevelDB(t)
+	mdataMgr := mocks.NewMockMarketDataManager()
+	mdataMgr.SetDividendMetadata("OLD", []types.DividendsMetadata{{Ticker: "OLD", ExDate: "2024-01-15", Amount: 0.1}})
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "OLD", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "NEW", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	p := NewPortfolio(db, mdataMgr, rdataMgr, nil)
+	blotterSvc := blotter.NewBlotter(db)
+	p.SubscribeToBlotter(blotterSvc)
+
+	for _, trade := range []struct {
+		trader, ticker string
+		qty            float64
+		date           time.Time
+	}{
+		{"trader1", "OLD", 100, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"trader2", "OLD", 10, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"trader1", "NEW", 50, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"trader1", "OLD", 5, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, trade.qty, trade.ticker, trade.trader, "dbs", "cdp", 1.0, 0.0, trade.date))))
+	}
+	waitForPositions(t, p, map[string]float64{"trader1:OLD": 105, "trader2:OLD": 10, "trader1:NEW": 50})
+
+	// dry run lists the changes without making them
+	rename, err := p.RenameTicker("old", "new", "2024-03-15", true)
+	assert.NoError(t, err)
+	assert.Len(t, rename.Trades, 2)
+	assert.Equal(t, []string{"trader1:OLD -> trader1:NEW", "trader2:OLD -> trader2:NEW"}, rename.Positions)
+	assert.Equal(t, []string{"OLD -> NEW"}, rename.Dividends)
+	assert.Len(t, must(blotterSvc.GetTradesByTicker("OLD")), 3)
+	assert.Equal(t, float64(105), positionQty(p, "trader1", "OLD"))
+
+	// trades dated on or after the effective date keep the old ticker
+	_, err = p.RenameTicker("OLD", "NEW", "2024-03-15", false)
+	assert.NoError(t, err)
+	assert.Len(t, must(blotterSvc.GetTradesByTicker("OLD")), 1)
+	assert.Len(t, must(blotterSvc.GetTradesByTicker("NEW")), 3)
+	assert.Equal(t, float64(150), positionQty(p, "trader1", "NEW"))
+	assert.Equal(t, float64(5), positionQty(p, "trader1", "OLD"))
+	assert.Equal(t, float64(10), positionQty(p, "trader2", "NEW"))
+	p.mu.Lock()
+	assert.NotContains(t, p.positions["trader2"], "OLD")
+	p.mu.Unlock()
+	assert.Contains(t, mdataMgr.DividendsMetadata, "NEW")
+
+	keys, err := db.GetAllKeysWithPrefix(fmt.Sprintf("%s:OLD:", types.TradeKeyPrefix))
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	_, err = p.RenameTicker("OLD", "UNKNOWN", "", false)
+	assert.Error(t, err)
+}
+
+func TestTickerChangesAdminOnly(t *testing.T) {
+	p := NewPortfolio(newLevelDB(t), mocks.NewMockMarketDataManager(), mocks.NewMockReferenceManager(), nil)
+	alice := &types.User{Name: "alice", Books: []string{"alice"}}
+
+	for target, handler := range map[string]http.HandlerFunc{
+		"/api/v1/rdata/ticker/rename":        HandleTickerRenamePost(p),
+		"/api/v1/portfolio/corporate-action": HandleCorporateActionPost(p),
+	} {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"from":"OLD","to":"NEW"}`))
+		req = req.WithContext(context.WithValue(req.Context(), types.UserKey, alice))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code, target)
+	}
+}
+
+func TestSplitPreservesPnL(t *testing.T) {
+	db := newLevelDB(t)
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "XYZ", AssetClass: rdata.AssetClassEquities, Ccy: "USD"})
+	blotterSvc := blotter.NewBlotter(db)
+	p := NewPortfolio(db, mdataMgr, rdataMgr, dividends.NewDividendsManager(db, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "XYZ", "trader1", "dbs", "cdp", 50.0, 0.0, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "XYZ", "trader1", "dbs", "cdp", 70.0, 0.0, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	mdataMgr.SetAssetPrice("XYZ", &types.AssetData{Ticker: "XYZ", Price: 65})
+	before := *must(p.GetPosition("trader1", "XYZ"))
+	assert.Equal(t, 13000.0, before.Mv)
+	assert.Equal(t, 1000.0, before.PnL)
+
+	// 1:10 split, the market price is split adjusted
+	action, err := p.ApplyCorporateAction(CorporateAction{Type: CorporateActionSplit, Ticker: "xyz", Ratio: 10, EffectiveDate: "2024-03-01"})
+	assert.NoError(t, err)
+	assert.Len(t, action.TradeIDs, 2)
+	mdataMgr.SetAssetPrice("XYZ", &types.AssetData{Ticker: "XYZ", Price: 6.5})
+
+	after := must(p.GetPosition("trader1", "XYZ"))
+	assert.Equal(t, 2000.0, after.Qty)
+	assert.InDelta(t, 6.0, after.AvgPx, 1e-9)
+	assert.InDelta(t, before.Mv, after.Mv, 1e-9)
+	assert.InDelta(t, before.PnL, after.PnL, 1e-9)
+
+	// applied once
+	_, err = p.ApplyCorporateAction(CorporateAction{Type: CorporateActionSplit, Ticker: "XYZ", Ratio: 10, EffectiveDate: "2024-03-01"})
+	assert.Error(t, err)
+
+	// reloading the blotter and positions from the database gives the same numbers
+	reloadedBlotter := blotter.NewBlotter(db)
+	assert.NoError(t, reloadedBlotter.LoadFromDB())
+	for _, trade := range reloadedBlotter.GetTrades() {
+		assert.Equal(t, 1000.0, trade.Quantity)
+	}
+	reloaded := NewPortfolio(db, mdataMgr, rdataMgr, nil)
+	assert.NoError(t, reloaded.LoadPositions())
+	assert.Equal(t, 2000.0, reloaded.positions["trader1"]["XYZ"].Qty)
+	assert.Len(t, must(reloaded.GetCorporateActions()), 1)
+}
+
+func TestGetAsOfReport(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAA", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "BBB", AssetClass: rdata.AssetClassEquities, Ccy: "USD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "CCC", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	bar := func(ticker string, day time.Time, price float64) *types.AssetData {
+		return &types.AssetData{Ticker: ticker, Price: price, Timestamp: day.Add(12 * time.Hour).Unix()}
+	}
+	mdataMgr.HistoricalData["AAA"] = []*types.AssetData{
+		bar("AAA", time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC), 11),
+		bar("AAA", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), 12),
+		bar("AAA", time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), 13),
+	}
+	mdataMgr.HistoricalData["BBB"] = []*types.AssetData{bar("BBB", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), 110)}
+	mdataMgr.HistoricalData["USD-SGD"] = []*types.AssetData{bar("USD-SGD", time.Date(2024, 12, 27, 0, 0, 0, 0, time.UTC), 1.35)}
+
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p.SubscribeToBlotter(blotterSvc)
+	for _, trade := range []struct {
+		trader, ticker, side string
+		qty, price           float64
+		date                 time.Time
+	}{
+		{"trader1", "AAA", blotter.TradeSideBuy, 100, 10, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"trader1", "AAA", blotter.TradeSideSell, 40, 12, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)}, // on the date, included
+		{"trader1", "BBB", blotter.TradeSideBuy, 10, 100, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"trader1", "CCC", blotter.TradeSideBuy, 5, 1, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"trader1", "CCC", blotter.TradeSideSell, 5, 2, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}, // closed before the date
+		{"trader1", "AAA", blotter.TradeSideBuy, 1, 13, time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)}, // after the date
+		{"trader2", "AAA", blotter.TradeSideBuy, 50, 9, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(trade.side, trade.qty, trade.ticker, trade.trader, "dbs", "cdp", trade.price, 0.0, trade.date))))
+	}
+
+	report, err := p.GetAsOfReport(time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), []string{"trader1"})
+	assert.NoError(t, err)
+	assert.Empty(t, report.Warnings)
+	assert.Len(t, report.Holdings, 2)
+
+	aaa := report.Holdings[0]
+	assert.Equal(t, "AAA", aaa.Ticker)
+	assert.Equal(t, 60.0, aaa.Qty)
+	assert.InDelta(t, 520, aaa.CostBasis, 1e-9)
+	assert.Equal(t, 12.0, aaa.Close)
+	assert.InDelta(t, 200, aaa.UnrealizedGain, 1e-9)
+
+	bbb := report.Holdings[1]
+	assert.Equal(t, 1.35, bbb.Fx)
+	assert.InDelta(t, 1350, bbb.CostBasisBase, 1e-9)
+	assert.InDelta(t, 1485, bbb.MvBase, 1e-9)
+
+	assert.InDelta(t, 1870, report.TotalCostBasis, 1e-9)
+	assert.InDelta(t, 2205, report.TotalMv, 1e-9)
+	assert.InDelta(t, 335, report.TotalUnrealizedGain, 1e-9)
+
+	data, err := report.ToCSV()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "trader1,AAA,SGD,60,")
+	assert.Contains(t, string(data), "Total,,SGD,")
+}
+
+func TestGetBreakdown(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", DividendsSgTicker: "D05"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAPL", AssetClass: rdata.AssetClassEquities, Ccy: "USD"})
+	mdataMgr.SetAssetPrice("D05.SI", &types.AssetData{Ticker: "D05.SI", Price: 10})
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 100})
+	mdataMgr.SetDividendMetadata("D05.SI", []types.DividendsMetadata{{Ticker: "D05.SI", ExDate: "2023-07-03", Amount: 0.5}})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	tradeDate := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "trader1", "dbs", "cdp", 10.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 300, "D05.SI", "trader2", "dbs", "cdp", 10.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 10, "AAPL", "trader2", "ibkr", "ibkr", 80.0, 0.0, tradeDate))))
+	time.Sleep(100 * time.Millisecond)
+
+	asOf := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	byBook, err := p.GetBreakdown(nil, GroupByBook, asOf)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, byBook.Groups["trader1"].Mv)
+	assert.Equal(t, 4000.0, byBook.Groups["trader2"].Mv)
+	assert.Equal(t, 3800.0, byBook.Groups["trader2"].PricePaid)
+	assert.InDelta(t, 0.2, byBook.Weights["trader1"], 1e-9)
+	assert.InDelta(t, 0.8, byBook.Weights["trader2"], 1e-9)
+
+	// dividends are split by the quantity each book held before the ex-date
+	assert.InDelta(t, 50.0, byBook.Groups["trader1"].Dividends, 1e-9)
+	assert.InDelta(t, 150.0, byBook.Groups["trader2"].Dividends, 1e-9)
+
+	// the IRR of a group is that of its own cashflows
+	total, err := p.GetIRR(&types.User{Name: "trader1", Books: []string{"trader1"}}, asOf, nil)
+	assert.NoError(t, err)
+	assert.InDelta(t, *total.IRR, *byBook.Groups["trader1"].IRR, 1e-9)
+	assert.InDelta(t, 0.0506, *byBook.Groups["trader1"].IRR, 1e-3)
+
+	byCcy, err := p.GetBreakdown(nil, GroupByCcy, asOf)
+	assert.NoError(t, err)
+	assert.Equal(t, 4000.0, byCcy.Groups["SGD"].Mv)
+	assert.Equal(t, 200.0, byCcy.Groups["USD"].PnL)
+	assert.InDelta(t, 0.2, byCcy.Weights["USD"], 1e-9)
+
+	byAssetClass, err := p.GetBreakdown(nil, GroupByAssetClass, asOf)
+	assert.NoError(t, err)
+	assert.Len(t, byAssetClass.Groups, 1)
+	assert.InDelta(t, 1.0, byAssetClass.Weights[rdata.AssetClassEquities], 1e-9)
+
+	_, err = p.GetBreakdown(nil, "sector", asOf)
+	assert.Error(t, err)
+}
+
+func TestRebalance(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	targets := Targets{Book: "trader1", Weights: map[string]float64{rdata.AssetClassEquities: 0.6, rdata.AssetClassBonds: 0.4}}
+	mockDB.On("Get", "TARGETS:trader1", mock.AnythingOfType("*portfolio.Targets")).Run(func(args mock.Arguments) {
+		*args.Get(1).(*Targets) = targets
+	}).Return(nil)
+	mockDB.On("Get", "TARGETS:trader2", mock.AnythingOfType("*portfolio.Targets")).Return(errors.New("not found"))
+
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAPL", AssetClass: rdata.AssetClassEquities, Ccy: "USD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "A35", AssetClass: rdata.AssetClassBonds, Ccy: "SGD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ART", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	mdataMgr.SetAssetPrice("D05.SI", &types.AssetData{Ticker: "D05.SI", Price: 10})
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 100})
+	mdataMgr.SetAssetPrice("A35", &types.AssetData{Ticker: "A35", Price: 100})
+	mdataMgr.SetAssetPrice("USD-SGD", &types.AssetData{Ticker: "USD-SGD", Price: 1.5})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	tradeDate := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "trader1", "dbs", "cdp", 10.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 10, "AAPL", "trader1", "ibkr", "ibkr", 80.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 5, "A35", "trader1", "dbs", "cdp", 100.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 1, "ART", "trader1", "dbs", "cdp", 50.0, 0.0, tradeDate))))
+	time.Sleep(100 * time.Millisecond)
+
+	// equities are 2500 of 3000 in SGD, so 700 are sold by market value into bonds
+	report, err := p.Rebalance("trader1", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "SGD", report.BaseCcy)
+	assert.Equal(t, defaultRebalanceTolerance, report.Tolerance)
+	assert.InDelta(t, 3000.0, report.TotalMvBase, 1e-9)
+	assert.Len(t, report.Allocations, 2)
+	assert.Equal(t, rdata.AssetClassBonds, report.Allocations[0].Key)
+	assert.InDelta(t, -0.4+1.0/6, report.Allocations[0].Drift, 1e-9)
+	assert.Len(t, report.Trades, 3)
+	assert.Equal(t, RebalanceTrade{Key: rdata.AssetClassBonds, Ticker: "A35", Side: blotter.TradeSideBuy, NotionalBase: 700}, roundTrade(report.Trades[0]))
+	assert.Equal(t, RebalanceTrade{Key: rdata.AssetClassEquities, Ticker: "AAPL", Side: blotter.TradeSideSell, NotionalBase: 420}, roundTrade(report.Trades[1]))
+	assert.Equal(t, RebalanceTrade{Key: rdata.AssetClassEquities, Ticker: "D05.SI", Side: blotter.TradeSideSell, NotionalBase: 280}, roundTrade(report.Trades[2]))
+	assert.Equal(t, []string{"ART: no price, excluded"}, report.Warnings)
+
+	// nothing to trade within the tolerance band
+	report, err = p.Rebalance("trader1", 0.25)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Trades)
+
+	_, err = p.Rebalance("trader2", 0)
+	assert.Error(t, err)
+
+	assert.NoError(t, p.SetTargets(targets))
+	assert.Error(t, p.SetTargets(Targets{Weights: targets.Weights}))
+	assert.Error(t, p.SetTargets(Targets{Book: "trader1", Weights: map[string]float64{rdata.AssetClassEquities: 0.6}}))
+	assert.Error(t, p.SetTargets(Targets{Book: "trader1", Weights: map[string]float64{rdata.AssetClassEquities: 1.5, rdata.AssetClassBonds: -0.5}}))
+}
+
+func roundTrade(trade RebalanceTrade) RebalanceTrade {
+	trade.NotionalBase = math.Round(trade.NotionalBase*100) / 100
+	return trade
+}
+
+func TestPositionSnapshots(t *testing.T) {
+	config.SetConfig(&config.Config{PositionSnapshot: config.PositionSnapshotConfig{Time: "23:00", DailyRetentionDays: 30}})
+	defer config.SetConfig(nil)
+
+	db := newLevelDB(t)
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ES3", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 4})
+	blotterSvc := blotter.NewBlotter(db)
+	p := NewPortfolio(db, mdataMgr, rdataMgr, dividends.NewDividendsManager(db, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", "trader1", "dbs", "cdp", 3.0, 0.0, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 50, "ES3", "trader2", "dbs", "cdp", 3.0, 0.0, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	// the scheduled snapshot runs once a day after the configured time
+	assert.ErrorIs(t, p.runScheduledSnapshot(time.Date(2024, 6, 28, 22, 0, 0, 0, time.Local), nil), scheduler.ErrNotDue)
+	assert.NoError(t, p.runScheduledSnapshot(time.Date(2024, 6, 28, 23, 0, 0, 0, time.Local), nil))
+	assert.ErrorIs(t, p.runScheduledSnapshot(time.Date(2024, 6, 28, 23, 30, 0, 0, time.Local), nil), scheduler.ErrNotDue)
+
+	snapshot, err := p.GetPositionSnapshot(nil, time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-06-28", snapshot.Date)
+	assert.Equal(t, []SnapshotPosition{
+		{Book: "trader1", Ticker: "ES3", Ccy: "SGD", Qty: 100, Mv: 400, AvgPx: 3},
+		{Book: "trader2", Ticker: "ES3", Ccy: "SGD", Qty: 50, Mv: 200, AvgPx: 3},
+	}, snapshot.Positions)
+
+	snapshot, err = p.GetPositionSnapshot(&types.User{Name: "trader1", Books: []string{"trader1"}}, time.Date(2024, 6, 28, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.Positions, 1)
+
+	_, err = p.GetPositionSnapshot(nil, time.Date(2024, 6, 27, 0, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, ErrNoSnapshot)
+
+	// the market values of the snapshots chart a book, or all books the user may see
+	from, to := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []MvPoint{{Date: "2024-06-28", Mv: 200}}, must(p.GetMvHistory(nil, "trader2", from, to)))
+	assert.Equal(t, []MvPoint{{Date: "2024-06-28", Mv: 600}}, must(p.GetMvHistory(nil, "", from, to)))
+	assert.Equal(t, []MvPoint{{Date: "2024-06-28", Mv: 400}}, must(p.GetMvHistory(&types.User{Name: "trader1", Books: []string{"trader1"}}, "", from, to)))
+	assert.Empty(t, must(p.GetMvHistory(nil, "", from, from)))
+
+	// snapshots beyond the daily retention are thinned to the last of each month
+	for _, date := range []time.Time{
+		time.Date(2024, 6, 29, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 7, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 8, 20, 0, 0, 0, 0, time.UTC),
+	} {
+		must(p.StorePositionSnapshot(date))
+	}
+	pruned, err := p.PruneSnapshots(time.Date(2024, 8, 25, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2024-06-28", "2024-07-01"}, pruned)
+	assert.Equal(t, []string{"2024-06-29", "2024-07-31", "2024-08-20"}, must(p.snapshotDates()))
+}
+
+func TestGetTickerHistory(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAA", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	bar := func(day time.Time, price float64) *types.AssetData {
+		return &types.AssetData{Ticker: "AAA", Price: price, Timestamp: day.Add(12 * time.Hour).Unix()}
+	}
+	mdataMgr.HistoricalData["AAA"] = []*types.AssetData{
+		bar(time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC), 9),
+		bar(time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC), 11),
+		bar(time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC), 12),
+	}
+
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, nil)
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p.SubscribeToBlotter(blotterSvc)
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "AAA", "trader1", "dbs", "cdp", 10.0, 0.0, time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideSell, 40, "AAA", "trader1", "dbs", "cdp", 12.0, 0.0, time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC)))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 10, "AAA", "trader2", "dbs", "cdp", 10.0, 0.0, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)))))
+
+	from, to := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC)
+	history, err := p.GetTickerHistory("trader1", "AAA", from, to, "")
+	assert.NoError(t, err)
+	assert.Equal(t, GranularityDaily, history.Granularity)
+	assert.Equal(t, []HistoryPoint{
+		{Date: "2024-06-01", Close: 9},                                     // the close before the range carries forward
+		{Date: "2024-06-02", Qty: 100, Close: 9, Mv: 900, CostBasis: 1000}, // no close on a weekend
+		{Date: "2024-06-03", Qty: 100, Close: 11, Mv: 1100, CostBasis: 1000},
+		{Date: "2024-06-04", Qty: 100, Close: 11, Mv: 1100, CostBasis: 1000},
+		{Date: "2024-06-05", Qty: 60, Close: 12, Mv: 720, CostBasis: 520},
+	}, history.Points)
+
+	// the last day of each week, 2024-06-02 being a Sunday
+	history, err = p.GetTickerHistory("trader1", "AAA", from, to, GranularityWeekly)
+	assert.NoError(t, err)
+	assert.Len(t, history.Points, 2)
+	assert.Equal(t, "2024-06-02", history.Points[0].Date)
+	assert.Equal(t, "2024-06-05", history.Points[1].Date)
+
+	history, err = p.GetTickerHistory("trader1", "AAA", from, to, GranularityMonthly)
+	assert.NoError(t, err)
+	assert.Len(t, history.Points, 1)
+
+	_, err = p.GetTickerHistory("trader1", "AAA", from, to, "hourly")
+	assert.Error(t, err)
+	_, err = p.GetTickerHistory("trader1", "AAA", to, from, "")
+	assert.Error(t, err)
+}
+
+func TestGetAttribution(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAPL", AssetClass: rdata.AssetClassEquities, Ccy: "USD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "MSFT", AssetClass: rdata.AssetClassEquities, Ccy: "USD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ES3", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 130})
+	mdataMgr.SetAssetPrice("MSFT", &types.AssetData{Ticker: "MSFT", Price: 210})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 4})
+	mdataMgr.SetAssetPrice("USD-SGD", &types.AssetData{Ticker: "USD-SGD", Price: 1.35})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	for _, trade := range []struct {
+		ticker, side string
+		qty, price   float64
+		fx           float64
+		date         time.Time
+	}{
+		{"AAPL", blotter.TradeSideBuy, 10, 100, 1.3, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"AAPL", blotter.TradeSideSell, 4, 120, 1.4, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"MSFT", blotter.TradeSideBuy, 5, 200, 0, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, // imported without Fx
+		{"ES3", blotter.TradeSideBuy, 100, 3, 0, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		newTrade := must(blotter.NewTrade(trade.side, trade.qty, trade.ticker, "trader1", "ibkr", "ibkr", trade.price, 0.0, trade.date))
+		newTrade.Fx = trade.fx
+		assert.NoError(t, blotterSvc.AddTrade(*newTrade))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	report, err := p.GetAttribution("trader1")
+	assert.NoError(t, err)
+	assert.Len(t, report.Positions, 3)
+
+	// 4 sold at 120 and 1.4, 6 valued at 130 and 1.35, against 100 and 1.3
+	aapl := report.Positions[0]
+	assert.Equal(t, "AAPL", aapl.Ticker)
+	assert.Equal(t, 6.0, aapl.Qty)
+	assert.InDelta(t, 338, aapl.Price, 1e-9)
+	assert.InDelta(t, 70, aapl.Fx, 1e-9)
+	assert.InDelta(t, 17, aapl.Cross, 1e-9)
+	assert.InDelta(t, 4*(120*1.4-130)+6*(130*1.35-130), aapl.Total, 1e-9)
+	assert.False(t, aapl.FxDefaulted)
+
+	es3 := report.Positions[1]
+	assert.InDelta(t, 100, es3.Price, 1e-9)
+	assert.Zero(t, es3.Fx)
+	assert.False(t, es3.FxDefaulted)
+
+	msft := report.Positions[2]
+	assert.True(t, msft.FxDefaulted)
+	assert.InDelta(t, 50, msft.Price, 1e-9)
+	assert.InDelta(t, 350, msft.Fx, 1e-9)
+	assert.Equal(t, []string{"MSFT: trades without an FX rate attributed at 1"}, report.Warnings)
+
+	assert.InDelta(t, aapl.Total+msft.Total, report.ByCcy["USD"].Total, 1e-9)
+	assert.InDelta(t, 100, report.ByCcy["SGD"].Total, 1e-9)
+	assert.InDelta(t, aapl.Total+msft.Total+es3.Total, report.Total.Total, 1e-9)
+}
+
+func TestFeesAddToCostAndCashflows(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ES3", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 4})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	buy := must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", "trader1", "dbs", "cdp", 3.0, 0.0, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))
+	buy.Fee = 10
+	sell := must(blotter.NewTrade(blotter.TradeSideSell, 50, "ES3", "trader1", "dbs", "cdp", 4.0, 0.0, time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)))
+	sell.Fee = 5
+	assert.NoError(t, blotterSvc.AddTrade(*buy))
+	assert.NoError(t, blotterSvc.AddTrade(*sell))
+	time.Sleep(100 * time.Millisecond)
+
+	position := must(p.GetPosition("trader1", "ES3"))
+	assert.InDelta(t, 115.0, position.TotalPaid, 1e-9) // 310 paid less 200 received, plus 5 on the sale
+	assert.InDelta(t, 2.3, position.AvgPx, 1e-9)
+	assert.InDelta(t, 85.0, position.PnL, 1e-9)
+
+	report, err := p.GetIRR(nil, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, -15.0, report.Components[ComponentFee])
+	assert.Equal(t, -100.0, report.Components[ComponentPrincipal])
+}
+
+func TestShortPositions(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", DividendsSgTicker: "D05"})
+	mdataMgr.SetAssetPrice("D05.SI", &types.AssetData{Ticker: "D05.SI", Price: 8})
+	mdataMgr.SetDividendMetadata("D05.SI", []types.DividendsMetadata{{Ticker: "D05.SI", ExDate: "2023-07-03", Amount: 0.5, WithholdingTax: 0.1}})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+	trade := func(side string, qty, price float64, date time.Time) {
+		assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(side, qty, "D05.SI", "trader1", "dbs", "cdp", price, 0.0, date))))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// open short, paying the gross dividend to the lender
+	trade(blotter.TradeSideSell, 100, 10, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+	position := must(p.GetPosition("trader1", "D05.SI"))
+	assert.Equal(t, -100.0, position.Qty)
+	assert.Equal(t, 10.0, position.AvgPx)
+	assert.Equal(t, -800.0, position.Mv)
+	assert.InDelta(t, -50.0, position.Dividends, 1e-9)
+	assert.InDelta(t, 150.0, position.PnL, 1e-9) // 200 from the fall in price less the dividend
+
+	// partial cover, 40 realized at 1 each
+	trade(blotter.TradeSideBuy, 40, 9, time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC))
+	position = must(p.GetPosition("trader1", "D05.SI"))
+	assert.Equal(t, -60.0, position.Qty)
+	assert.InDelta(t, 40+120-50, position.PnL, 1e-9)
+
+	// flip to long in one trade, covering 60 at 3 each and buying 40 at 7
+	trade(blotter.TradeSideBuy, 100, 7, time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC))
+	position = must(p.GetPosition("trader1", "D05.SI"))
+	assert.Equal(t, 40.0, position.Qty)
+	assert.Equal(t, 320.0, position.Mv)
+	assert.InDelta(t, 40+180+40-50, position.PnL, 1e-9)
+
+	// the short sale is an inflow and the dividend an outflow
+	flows, err := p.Cashflows(nil, time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, Cashflow{Date: "2023-01-02", Ticker: "D05.SI", Book: "trader1", Component: ComponentPrincipal, Amount: 1000}, flows[0])
+	assert.Equal(t, Cashflow{Date: "2023-07-03", Ticker: "D05.SI", Book: "trader1", Component: ComponentDividend, Amount: -50}, flows[1])
+	var total float64
+	for _, flow := range flows {
+		total += flow.Amount
+	}
+	assert.InDelta(t, position.PnL, total, 1e-9)
+}
+
+func TestDividendCashflowsOnPayDate(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "D05.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", DividendsSgTicker: "D05"})
+	mdataMgr.SetAssetPrice("D05.SI", &types.AssetData{Ticker: "D05.SI", Price: 8})
+	mdataMgr.SetDividendMetadata("D05.SI", []types.DividendsMetadata{
+		{Ticker: "D05.SI", ExDate: "2023-05-02", PayDate: "2023-05-25", Amount: 0.5},
+		{Ticker: "D05.SI", ExDate: "2023-08-01", Amount: 0.5},
+		{Ticker: "D05.SI", ExDate: "2023-12-20", PayDate: "2024-01-10", Amount: 0.5},
+	})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "D05.SI", "trader1", "dbs", "cdp", 7, 0.0, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	// dividends flow on the pay date when known, else the ex date, and those not yet paid at asOf flow at asOf
+	flows, err := p.Cashflows(nil, time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	var dates []string
+	for _, flow := range flows {
+		if flow.Component == ComponentDividend {
+			dates = append(dates, flow.Date)
+		}
+	}
+	assert.Equal(t, []string{"2023-05-25", "2023-08-01", "2023-12-31"}, dates)
+}
+
+func TestDerivativePositions(t *testing.T) {
+	_, mockDB := createTestPortfolio()
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "NKZ24", UnderlyingTicker: "NK", AssetClass: rdata.AssetClassDerivatives, AssetSubClass: rdata.AssetSubClassFuture,
+		Ccy: "JPY", MaturityDate: "2024-12-12", ContractMultiplier: 500})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAPL241220C00250000", UnderlyingTicker: "AAPL", AssetClass: rdata.AssetClassDerivatives, AssetSubClass: rdata.AssetSubClassOption,
+		Ccy: "USD", MaturityDate: "2024-12-20", StrikePrice: 250, CallPut: "call", ContractMultiplier: 100})
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 240})
+	blotterSvc := blotter.NewBlotter(mockDB)
+	p := NewPortfolio(mockDB, mdataMgr, rdataMgr, dividends.NewDividendsManager(mockDB, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	future := must(blotter.NewTrade(blotter.TradeSideBuy, 2, "NKZ24", "trader1", "ibkr", "ibkr", 38000, 0.0, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)))
+	future.Fee = 1000
+	assert.NoError(t, blotterSvc.AddTrade(*future))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 3, "AAPL241220C00250000", "trader1", "ibkr", "ibkr", 4.5, 0.0, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	// without a price from the sources, enrichment uses the manual price
+	_, err := p.GetPosition("trader1", "NKZ24")
+	assert.Error(t, err)
+	_, err = mdataMgr.SetPriceOverride("NKZ24", 38100, time.Now())
+	assert.NoError(t, err)
+
+	// market value and PnL scale with the contract multiplier, the fee adds to the cost per contract unit
+	position := must(p.GetPosition("trader1", "NKZ24"))
+	assert.Equal(t, 2*38100*500.0, position.Mv)
+	assert.InDelta(t, 38001, position.AvgPx, 1e-9)
+	assert.InDelta(t, 2*38001*500.0, position.TotalPaid, 1e-6)
+	assert.InDelta(t, 2*100*500-1000.0, position.PnL, 1e-6)
+	assert.InDelta(t, 38001, *position.BreakEvenPx, 1e-9)
+
+	// on expiry, the future settles at its last price and the out of the money call at 0
+	closed, err := p.AutoCloseTrades(time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Len(t, closed, 2)
+	prices := map[string]float64{}
+	for _, trade := range closed {
+		prices[trade.Ticker] = trade.Price
+	}
+	assert.Equal(t, map[string]float64{"NKZ24": 38100, "AAPL241220C00250000": 0}, prices)
+	time.Sleep(100 * time.Millisecond)
+
+	position = must(p.GetPosition("trader1", "AAPL241220C00250000"))
+	assert.Equal(t, 0.0, position.Qty)
+	assert.InDelta(t, -3*4.5*100, position.PnL, 1e-9)
+}
+
+func TestNetWorth(t *testing.T) {
+	db := newLevelDB(t)
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ES3", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAPL", AssetClass: rdata.AssetClassEquities, Ccy: "USD"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "USD", AssetClass: rdata.AssetClassCash, Ccy: "USD"})
+	mdataMgr.SetAssetPrice("ES3", &types.AssetData{Ticker: "ES3", Price: 4})
+	mdataMgr.SetAssetPrice("AAPL", &types.AssetData{Ticker: "AAPL", Price: 200})
+	mdataMgr.SetAssetPrice("USD-SGD", &types.AssetData{Ticker: "USD-SGD", Price: 1.35})
+	blotterSvc := blotter.NewBlotter(db)
+	p := NewPortfolio(db, mdataMgr, rdataMgr, dividends.NewDividendsManager(db, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	tradeDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", "trader1", "dbs", "cdp", 3.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 10, "AAPL", "trader2", "ibkr", "ibkr", 150.0, 0.0, tradeDate))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 1000, "USD", "trader2", "ibkr", "ibkr", 1.0, 0.0, tradeDate))))
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := p.SetExternalAsset(ExternalAsset{Name: " ", Value: 1})
+	assert.Error(t, err)
+	_, err = p.SetExternalAsset(ExternalAsset{Name: "CPF", Value: 1, AsOf: "30/06/2024"})
+	assert.Error(t, err)
+	asset, err := p.SetExternalAsset(ExternalAsset{Name: "Brokerage", Value: 2000, Ccy: "usd", AsOf: "2024-06-30"})
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", asset.Ccy)
+	asset, err = p.SetExternalAsset(ExternalAsset{Name: "CPF", Value: 50000})
+	assert.NoError(t, err)
+	assert.Equal(t, "SGD", asset.Ccy)
+	assert.NotEmpty(t, asset.AsOf)
+
+	now := time.Date(2024, 7, 1, 23, 0, 0, 0, time.UTC)
+	netWorth, err := p.GetNetWorth(nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "SGD", netWorth.BaseCcy)
+	assert.Equal(t, []NetWorthItem{
+		{Name: "trader1", Ccy: "SGD", Value: 400, Fx: 1, Base: 400, Source: NetWorthSourceBook},
+		{Name: "trader2", Ccy: "USD", Value: 2000, Fx: 1.35, Base: 2700, Source: NetWorthSourceBook},
+	}, netWorth.Books)
+	assert.Equal(t, []NetWorthItem{{Name: "USD", Ccy: "USD", Value: 1000, Fx: 1.35, Base: 1350, Source: NetWorthSourceCash}}, netWorth.Cash)
+	assert.Len(t, netWorth.External, 2)
+	assert.Equal(t, "Brokerage", netWorth.External[0].Name)
+	assert.Equal(t, 2700.0, netWorth.External[0].Base)
+	assert.InDelta(t, 400+2700+1350+2700+50000, netWorth.Total, 1e-9)
+	assert.Empty(t, netWorth.Warnings)
+
+	// external assets are only visible to admins
+	netWorth, err = p.GetNetWorth(&types.User{Name: "trader1", Books: []string{"trader1"}}, now)
+	assert.NoError(t, err)
+	assert.Len(t, netWorth.Books, 1)
+	assert.Empty(t, netWorth.Cash)
+	assert.Empty(t, netWorth.External)
+	assert.Equal(t, 400.0, netWorth.Total)
+
+	// daily snapshots are charted by their total
+	_, err = p.StoreNetWorthSnapshot(now)
+	assert.NoError(t, err)
+	assert.NoError(t, p.DeleteExternalAsset("CPF"))
+	_, err = p.StoreNetWorthSnapshot(now.AddDate(0, 0, 1))
+	assert.NoError(t, err)
+	history, err := p.GetNetWorthHistory(now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "2024-07-01", history[0].Date)
+	assert.InDelta(t, 57150.0, history[0].Total, 1e-9)
+	assert.InDelta(t, 7150.0, history[1].Total, 1e-9)
+}
+
+func TestTaxReport(t *testing.T) {
+	db := newLevelDB(t)
+	mdataMgr := mocks.NewMockMarketDataManager()
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "AAPL", AssetClass: rdata.AssetClassEquities, Ccy: "USD", Domicile: "US", DividendsSgTicker: "AAPL"})
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "ES3", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", Domicile: "SG"})
+	income, capitalReturn := 0.8, 0.2
+	mdataMgr.SetDividendMetadata("AAPL", []types.DividendsMetadata{
+		{Ticker: "AAPL", ExDate: "2023-12-28", Amount: 1, WithholdingTax: 0.3},
+		{Ticker: "AAPL", ExDate: "2024-02-01", Amount: 1, WithholdingTax: 0.3},
+		{Ticker: "AAPL", ExDate: "2024-12-30", Amount: 1, WithholdingTax: 0.3, Income: &income, CapitalReturn: &capitalReturn},
+	})
+	mdataMgr.HistoricalData["USD-SGD"] = []*types.AssetData{
+		{Ticker: "USD-SGD", Price: 1.32, Timestamp: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC).Unix()},
+		{Ticker: "USD-SGD", Price: 1.36, Timestamp: time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+	blotterSvc := blotter.NewBlotter(db)
+	blotterSvc.SetMarketData(mdataMgr)
+	p := NewPortfolio(db, mdataMgr, rdataMgr, dividends.NewDividendsManager(db, mdataMgr, rdataMgr, blotterSvc))
+	p.SubscribeToBlotter(blotterSvc)
+
+	buy := must(blotter.NewTrade(blotter.TradeSideBuy, 100, "AAPL", "trader1", "ibkr", "ibkr", 100.0, 0.0, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)))
+	buy.Fx = 1.30
+	sell := must(blotter.NewTrade(blotter.TradeSideSell, 60, "AAPL", "trader1", "ibkr", "ibkr", 150.0, 0.0, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)))
+	sell.Fx, sell.Fee = 1.35, 6
+	assert.NoError(t, blotterSvc.AddTrade(*buy))
+	assert.NoError(t, blotterSvc.AddTrade(*sell))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", "trader2", "dbs", "cdp", 3.0, 0.0, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideSell, 100, "ES3", "trader2", "dbs", "cdp", 3.5, 0.0, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)))))
+	assert.NoError(t, blotterSvc.AddTrade(*must(blotter.NewTrade(blotter.TradeSideBuy, 100, "ES3", "trader2", "dbs", "cdp", 4.0, 0.0, time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)))))
+	time.Sleep(100 * time.Millisecond)
+
+	report, err := p.GetTaxReport(2024, nil)
+	assert.NoError(t, err)
+	assert.Len(t, report.Lines, 2)
+	assert.Empty(t, report.Warnings)
+	assert.NotEmpty(t, report.Notes)
+
+	// the lot opened in 2023 is realized in 2024 net of the closing fee, dividends of 2024 ex dates only
+	aapl := report.Lines[0]
+	assert.Equal(t, "AAPL", aapl.Ticker)
+	assert.Equal(t, 60.0, aapl.RealizedQty)
+	assert.InDelta(t, 60*(149.9-100), aapl.RealizedGain, 1e-9)
+	assert.InDelta(t, 60*(149.9*1.35-100*1.30), aapl.RealizedGainBase, 1e-9)
+	assert.InDelta(t, 140.0, aapl.DividendsGross, 1e-9)
+	assert.InDelta(t, 42.0, aapl.WithholdingTax, 1e-9)
+	assert.InDelta(t, 98.0, aapl.DividendsNet, 1e-9)
+	assert.InDelta(t, 100*1.32+40*1.36, aapl.DividendsGrossBase, 1e-9)
+	assert.InDelta(t, 70*1.32+28*1.36, aapl.DividendsNetBase, 1e-9)
+
+	// the gross dividend without a split is income, the split one is reported gross like its amount
+	assert.InDelta(t, 100+40*0.8, aapl.DividendsIncome, 1e-9)
+	assert.InDelta(t, 40*0.2, aapl.DividendsCapitalReturn, 1e-9)
+	assert.InDelta(t, 40*0.2*1.36, aapl.DividendsCapitalReturnBase, 1e-9)
+
+	es3 := report.Lines[1]
+	assert.Equal(t, "ES3", es3.Ticker)
+	assert.InDelta(t, 50.0, es3.RealizedGainBase, 1e-9)
+
+	assert.Len(t, report.ByDomicile, 2)
+	assert.Equal(t, "SG", report.ByDomicile[0].Domicile)
+	assert.InDelta(t, 50.0, report.ByDomicile[0].RealizedGain, 1e-9)
+	assert.Equal(t, "US", report.ByDomicile[1].Domicile)
+	assert.InDelta(t, 30*1.32+12*1.36, report.ByDomicile[1].WithholdingTax, 1e-9)
+	assert.InDelta(t, 50+aapl.RealizedGainBase, report.Total.RealizedGain, 1e-9)
+	assert.InDelta(t, 40*0.2*1.36, report.Total.DividendsCapitalReturn, 1e-9)
+
+	// books filter the report
+	report, err = p.GetTaxReport(2024, []string{"trader2"})
+	assert.NoError(t, err)
+	assert.Len(t, report.Lines, 1)
+
+	csv, err := report.ToCSV()
+	assert.NoError(t, err)
+	assert.Contains(t, string(csv), "trader2,ES3,SGD,SG,0,0,0,100,50,0,0,0,50")
+	assert.Contains(t, string(csv), "Total SG,")
+
+	_, err = p.GetTaxReport(0, nil)
+	assert.Error(t, err)
+}
+
+func TestPnLMoveNotification(t *testing.T) {
+	config.SetConfig(&config.Config{Notifications: config.NotificationsConfig{PnLMovePct: 5}})
+	defer config.SetConfig(nil)
+
+	_, mockDB := createTestPortfolio()
+	p := NewPortfolio(mockDB, mocks.NewMockMarketDataManager(), mocks.NewMockReferenceManager(), nil)
+	notifier := &recordingNotifier{}
+	previous := &PositionSnapshot{Date: "2024-06-27", Mv: 10000, PnL: 1000}
+
+	// moves within the threshold are not posted
+	p.notifyPnLMove(previous, &PositionSnapshot{Date: "2024-06-28", Mv: 10400, PnL: 1400}, notifier)
+	assert.Empty(t, notifier.messages)
+
+	p.notifyPnLMove(previous, &PositionSnapshot{Date: "2024-06-28", Mv: 9200, PnL: 200}, notifier)
+	assert.Equal(t, []string{"PnL moved -800.00 (-8.00% of the market value) from 2024-06-27 to 2024-06-28"}, notifier.messages)
+
+	// snapshots stored before the totals were recorded are skipped
+	p.notifyPnLMove(&PositionSnapshot{Date: "2024-06-27"}, &PositionSnapshot{Date: "2024-06-28", Mv: 9200, PnL: 200}, notifier)
+	assert.Len(t, notifier.messages, 1)
+}
@@ -0,0 +1,222 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/types"
+)
+
+// defaultRebalanceTolerance is the drift from the target weight within which an allocation is left alone
+const defaultRebalanceTolerance = 0.05
+
+// Targets are the target allocation of a book, as weights per asset class or ticker adding up to 1. A position is
+// allocated to its ticker's weight when it has one, otherwise to its asset class's.
+type Targets struct {
+	Book    string             `json:"book"`
+	Weights map[string]float64 `json:"weights"`
+}
+
+// Allocation is the current weight of a target in the market value of the book.
+type Allocation struct {
+	Key    string  // asset class or ticker
+	MvBase float64 // market value in the base currency
+	Weight float64
+	Target float64
+	Drift  float64 // Weight - Target
+}
+
+// RebalanceTrade is a suggested trade to bring an allocation back to its target. Ticker is empty when the book
+// holds nothing of an underweight asset class, so there is no ticker to suggest.
+type RebalanceTrade struct {
+	Key          string
+	Ticker       string
+	Side         string
+	NotionalBase float64 // in the base currency
+}
+
+// RebalanceReport compares the allocations of a book against its targets.
+type RebalanceReport struct {
+	Book        string
+	BaseCcy     string
+	TotalMvBase float64
+	Tolerance   float64
+	Allocations []Allocation
+	Trades      []RebalanceTrade
+	Warnings    []string // positions excluded from the allocations, e.g. without a price
+}
+
+// SetTargets validates and stores the target allocation of the book.
+func (p *Portfolio) SetTargets(targets Targets) error {
+	if targets.Book == "" {
+		return errors.New("book is required")
+	}
+	if len(targets.Weights) == 0 {
+		return errors.New("weights are required")
+	}
+
+	var total float64
+	for key, weight := range targets.Weights {
+		if key == "" {
+			return errors.New("weights need an asset class or ticker")
+		}
+		if weight < 0 || weight > 1 {
+			return fmt.Errorf("weight of %s must be between 0 and 1", key)
+		}
+		total += weight
+	}
+	if math.Abs(total-1) > 1e-6 {
+		return fmt.Errorf("weights must add up to 1, got %v", total)
+	}
+
+	return p.db.Put(targetsKey(targets.Book), targets)
+}
+
+// GetTargets returns the target allocation of the book.
+func (p *Portfolio) GetTargets(book string) (*Targets, error) {
+	var targets Targets
+	if err := p.db.Get(targetsKey(book), &targets); err != nil {
+		return nil, fmt.Errorf("no targets for book %s", book)
+	}
+	return &targets, nil
+}
+
+// Rebalance compares the market value weights of the open positions of the book against its targets, suggesting
+// trades in the base currency for the allocations which drift beyond the tolerance, 0 for the configured tolerance.
+// Trades bring an allocation back to its target and are split between its tickers by market value. Positions without
+// a price or FX rate are excluded with a warning.
+func (p *Portfolio) Rebalance(book string, tolerance float64) (*RebalanceReport, error) {
+	targets, err := p.GetTargets(book)
+	if err != nil {
+		return nil, err
+	}
+	if tolerance <= 0 {
+		tolerance = rebalanceTolerance()
+	}
+
+	positions, err := p.GetPositions(book)
+	if err != nil {
+		// positions which fail to enrich are reported below when left without a market value
+		p.logger.Warnf("Failed to enrich positions for rebalancing: %v", err)
+	}
+
+	report := &RebalanceReport{Book: book, BaseCcy: blotter.BaseCurrency(), Tolerance: tolerance}
+	mvByKey := make(map[string]float64)
+	mvByTicker := make(map[string]map[string]float64)
+	for _, position := range positions {
+		if position.Qty == 0 {
+			continue
+		}
+		if position.Mv == 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: no price, excluded", position.Ticker))
+			continue
+		}
+
+		tickerRef, err := p.rdata.GetTicker(position.Ticker)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: no reference data, excluded", position.Ticker))
+			continue
+		}
+		fx, err := p.fxToBase(tickerRef.Ccy, report.BaseCcy)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %v, excluded", position.Ticker, err))
+			continue
+		}
+
+		key := tickerRef.AssetClass
+		if _, ok := targets.Weights[position.Ticker]; ok {
+			key = position.Ticker
+		}
+		mvBase := position.Mv * fx
+		mvByKey[key] += mvBase
+		if mvByTicker[key] == nil {
+			mvByTicker[key] = make(map[string]float64)
+		}
+		mvByTicker[key][position.Ticker] += mvBase
+		report.TotalMvBase += mvBase
+	}
+
+	keys := make(map[string]bool)
+	for key := range targets.Weights {
+		keys[key] = true
+	}
+	for key := range mvByKey {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		allocation := Allocation{Key: key, MvBase: mvByKey[key], Target: targets.Weights[key]}
+		if report.TotalMvBase != 0 {
+			allocation.Weight = allocation.MvBase / report.TotalMvBase
+		}
+		allocation.Drift = allocation.Weight - allocation.Target
+		report.Allocations = append(report.Allocations, allocation)
+
+		if report.TotalMvBase == 0 || math.Abs(allocation.Drift) <= tolerance {
+			continue
+		}
+		report.Trades = append(report.Trades, rebalanceTrades(allocation, -allocation.Drift*report.TotalMvBase, mvByTicker[key])...)
+	}
+
+	sort.Slice(report.Allocations, func(i, j int) bool { return report.Allocations[i].Key < report.Allocations[j].Key })
+	sort.Slice(report.Trades, func(i, j int) bool {
+		if report.Trades[i].Key != report.Trades[j].Key {
+			return report.Trades[i].Key < report.Trades[j].Key
+		}
+		return report.Trades[i].Ticker < report.Trades[j].Ticker
+	})
+	sort.Strings(report.Warnings)
+	return report, nil
+}
+
+// rebalanceTrades splits the notional to buy, or sell when negative, between the tickers of the allocation by their
+// market value.
+func rebalanceTrades(allocation Allocation, notional float64, mvByTicker map[string]float64) []RebalanceTrade {
+	side := blotter.TradeSideBuy
+	if notional < 0 {
+		side = blotter.TradeSideSell
+	}
+
+	if len(mvByTicker) == 0 {
+		return []RebalanceTrade{{Key: allocation.Key, Side: side, NotionalBase: math.Abs(notional)}}
+	}
+
+	var trades []RebalanceTrade
+	for ticker, mv := range mvByTicker {
+		trades = append(trades, RebalanceTrade{
+			Key:          allocation.Key,
+			Ticker:       ticker,
+			Side:         side,
+			NotionalBase: math.Abs(notional) * mv / allocation.MvBase,
+		})
+	}
+	return trades
+}
+
+// fxToBase returns the spot rate converting the currency to the base currency.
+func (p *Portfolio) fxToBase(ccy, baseCcy string) (float64, error) {
+	if ccy == "" || ccy == baseCcy {
+		return 1, nil
+	}
+	data, err := p.mdata.GetAssetPrice(fmt.Sprintf("%s-%s", ccy, baseCcy))
+	if err != nil || data == nil || data.Price == 0 {
+		return 0, fmt.Errorf("no %s-%s rate", ccy, baseCcy)
+	}
+	return data.Price, nil
+}
+
+func rebalanceTolerance() float64 {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.RebalanceTolerance <= 0 {
+		return defaultRebalanceTolerance
+	}
+	return cfg.RebalanceTolerance
+}
+
+func targetsKey(book string) string {
+	return fmt.Sprintf("%s:%s", types.TargetsKeyPrefix, book)
+}
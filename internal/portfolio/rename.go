@@ -0,0 +1,111 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/blotter"
+)
+
+// TickerRename lists the records changed, or to be changed in dry run mode, by a ticker rename.
+type TickerRename struct {
+	From          string          `json:"from"`
+	To            string          `json:"to"`
+	EffectiveDate string          `json:"effectiveDate,omitempty"`
+	DryRun        bool            `json:"dryRun"`
+	Trades        []blotter.Trade `json:"trades"`    // trades moved, with their new ticker
+	Positions     []string        `json:"positions"` // positions merged, as "trader:from -> trader:to"
+	Dividends     []string        `json:"dividends"` // dividends metadata keys moved
+}
+
+// RenameTicker moves the blotter trades of the from ticker dated before the effective date (YYYY-MM-DD, empty for all)
+// to the to ticker, e.g. after a change of symbol, merging the affected positions and moving the dividends metadata.
+// The to ticker must exist in reference data. In dry run mode the records which would change are returned without
+// changing them.
+func (p *Portfolio) RenameTicker(from, to, effectiveDate string, dryRun bool) (*TickerRename, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+
+	from = strings.ToUpper(strings.TrimSpace(from))
+	to = strings.ToUpper(strings.TrimSpace(to))
+	toRef, err := p.rdata.GetTicker(to)
+	if err != nil {
+		return nil, fmt.Errorf("ticker %s not found in reference data, add it before renaming: %w", to, err)
+	}
+
+	trades, err := p.blotter.RenameTicker(from, to, effectiveDate, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	rename := &TickerRename{
+		From:          from,
+		To:            to,
+		EffectiveDate: effectiveDate,
+		DryRun:        dryRun,
+		Trades:        trades,
+		Positions:     []string{},
+		Dividends:     []string{},
+	}
+
+	traders := make(map[string]struct{})
+	for _, trade := range trades {
+		traders[trade.Trader] = struct{}{}
+	}
+	for trader := range traders {
+		rename.Positions = append(rename.Positions, fmt.Sprintf("%s:%s -> %s:%s", trader, from, trader, to))
+		if !dryRun {
+			if err := p.rebuildPosition(trader, from); err != nil {
+				return nil, err
+			}
+			if err := p.rebuildPosition(trader, to); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(rename.Positions)
+
+	// dividends metadata is keyed by the data source tickers of the old reference data, which may be gone
+	if fromRef, err := p.rdata.GetTicker(from); err == nil {
+		moved, err := p.mdata.MoveDividendsMetadata(fromRef, toRef, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move dividends metadata: %w", err)
+		}
+		rename.Dividends = append(rename.Dividends, moved...)
+	} else {
+		p.logger.Warnf("Reference data of ticker %s not found, dividends metadata not moved", from)
+	}
+
+	return rename, nil
+}
+
+// rebuildPosition recomputes the trader's position in the ticker from the blotter, in sequence number order. The
+// position is removed when no trades remain.
+func (p *Portfolio) rebuildPosition(trader, ticker string) error {
+	trades := p.blotter.GetTradesByFilter(blotter.TradeFilter{Ticker: ticker, Trader: trader})
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].SeqNum < trades[j].SeqNum
+	})
+
+	key := generatePositionKey(&blotter.Trade{Trader: trader, Ticker: ticker})
+	p.mu.Lock()
+	if tickers, ok := p.positions[trader]; ok {
+		delete(tickers, ticker)
+	}
+	delete(p.bulk.dirty, key)
+	p.mu.Unlock()
+
+	if len(trades) == 0 {
+		return audit.WithSource(p.db, audit.SourceMigration).Delete(key)
+	}
+	for i := range trades {
+		if err := p.updatePosition(&trades[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/scheduler"
+	"portfolio-manager/pkg/types"
+)
+
+const (
+	// defaultSnapshotTime is the local time of the daily position snapshot when not configured, after the closes of
+	// the day are captured
+	defaultSnapshotTime = "23:30"
+
+	// defaultSnapshotDailyRetentionDays is how long daily snapshots are kept when not configured, older snapshots are
+	// thinned to the last of each month
+	defaultSnapshotDailyRetentionDays = 90
+)
+
+// ErrNoSnapshot is returned when there is no position snapshot at or before a date.
+var ErrNoSnapshot = errors.New("no position snapshot at or before the date")
+
+// SnapshotPosition is an open position as of a snapshot.
+type SnapshotPosition struct {
+	Book   string
+	Ticker string
+	Ccy    string
+	Qty    float64
+	Mv     float64
+	AvgPx  float64
+}
+
+// PositionSnapshot is the open positions across books as of the end of a day.
+type PositionSnapshot struct {
+	Date      string // YYYY-MM-DD
+	Positions []SnapshotPosition
+	Mv        float64 `json:",omitempty"` // total of the open positions, summed across currencies like the summary
+	PnL       float64 `json:",omitempty"` // total of all positions, including closed ones
+	TWR       float64 `json:",omitempty"` // cumulative TWR of all books since the first trade, 0 in older snapshots
+}
+
+// StorePositionSnapshot stores the open positions valued as of now under the day of now, replacing an earlier
+// snapshot of the day.
+func (p *Portfolio) StorePositionSnapshot(now time.Time) (*PositionSnapshot, error) {
+	positions, err := p.GetAllPositions()
+	if err != nil {
+		// positions which fail to enrich are stored as of their last enrichment
+		p.logger.Warnf("Failed to enrich positions for the snapshot: %v", err)
+	}
+
+	summary := Summarize(positions)
+	snapshot := &PositionSnapshot{Date: now.Format("2006-01-02"), Positions: []SnapshotPosition{}, Mv: summary.Mv, PnL: summary.PnL}
+	for _, position := range positions {
+		if position.Qty == 0 {
+			continue
+		}
+		snapshot.Positions = append(snapshot.Positions, SnapshotPosition{
+			Book:   position.Trader,
+			Ticker: position.Ticker,
+			Ccy:    position.Ccy,
+			Qty:    position.Qty,
+			Mv:     position.Mv,
+			AvgPx:  position.AvgPx,
+		})
+	}
+	sort.Slice(snapshot.Positions, func(i, j int) bool {
+		if snapshot.Positions[i].Book != snapshot.Positions[j].Book {
+			return snapshot.Positions[i].Book < snapshot.Positions[j].Book
+		}
+		return snapshot.Positions[i].Ticker < snapshot.Positions[j].Ticker
+	})
+
+	if twr, err := p.GetTWR(nil, now, nil); err != nil {
+		p.logger.Warnf("Failed to calculate the TWR for the snapshot: %v", err)
+	} else if twr.Cumulative != nil {
+		snapshot.TWR = *twr.Cumulative
+	}
+
+	if err := p.db.Put(snapshotKey(snapshot.Date), snapshot); err != nil {
+		return nil, fmt.Errorf("failed to store position snapshot of %s: %w", snapshot.Date, err)
+	}
+	return snapshot, nil
+}
+
+// GetPositionSnapshot returns the nearest position snapshot at or before the date, with the positions of the books
+// the user may see, all books when user is nil.
+func (p *Portfolio) GetPositionSnapshot(user *types.User, date time.Time) (*PositionSnapshot, error) {
+	dates, err := p.snapshotDates()
+	if err != nil {
+		return nil, err
+	}
+
+	day := date.Format("2006-01-02")
+	i := sort.SearchStrings(dates, day)
+	if i == len(dates) || dates[i] != day {
+		i--
+	}
+	if i < 0 {
+		return nil, ErrNoSnapshot
+	}
+
+	var snapshot PositionSnapshot
+	if err := p.db.Get(snapshotKey(dates[i]), &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to get position snapshot of %s: %w", dates[i], err)
+	}
+
+	positions := []SnapshotPosition{}
+	for _, position := range snapshot.Positions {
+		if user == nil || user.CanSeeBook(position.Book) {
+			positions = append(positions, position)
+		}
+	}
+	snapshot.Positions = positions
+	return &snapshot, nil
+}
+
+// MvPoint is the market value of the open positions in a day's position snapshot, for charting.
+type MvPoint struct {
+	Date string
+	Mv   float64
+}
+
+// GetMvHistory returns the market value of the open positions of the book in the position snapshots from from to to,
+// inclusive, in date order. An empty book sums the books the user may see, all books when user is nil. Market values
+// are summed across currencies like the summary.
+func (p *Portfolio) GetMvHistory(user *types.User, book string, from, to time.Time) ([]MvPoint, error) {
+	dates, err := p.snapshotDates()
+	if err != nil {
+		return nil, err
+	}
+
+	fromDate, toDate := from.Format("2006-01-02"), to.Format("2006-01-02")
+	points := []MvPoint{}
+	for _, date := range dates {
+		if date < fromDate || date > toDate {
+			continue
+		}
+		var snapshot PositionSnapshot
+		if err := p.db.Get(snapshotKey(date), &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to get position snapshot of %s: %w", date, err)
+		}
+
+		point := MvPoint{Date: date}
+		for _, position := range snapshot.Positions {
+			if (book == "" || position.Book == book) && (user == nil || user.CanSeeBook(position.Book)) {
+				point.Mv += position.Mv
+			}
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// PruneSnapshots deletes the position snapshots outside the retention, returning their dates. Snapshots within the
+// configured days of now are kept daily, older snapshots are thinned to the last of each month.
+func (p *Portfolio) PruneSnapshots(now time.Time) ([]string, error) {
+	dates, err := p.snapshotDates()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.AddDate(0, 0, -snapshotDailyRetentionDays()).Format("2006-01-02")
+	var pruned []string
+	var errs []error
+	for i, date := range dates {
+		// dates are sorted, so the last snapshot of a month is followed by one of another month
+		lastOfMonth := i == len(dates)-1 || dates[i+1][:7] != date[:7]
+		if date >= cutoff || lastOfMonth {
+			continue
+		}
+		if err := p.db.Delete(snapshotKey(date)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete position snapshot of %s: %w", date, err))
+			continue
+		}
+		pruned = append(pruned, date)
+	}
+	return pruned, errors.Join(errs...)
+}
+
+// snapshotDates returns the sorted dates of the stored position snapshots.
+func (p *Portfolio) snapshotDates() ([]string, error) {
+	prefix := string(types.SnapshotKeyPrefix) + ":"
+	keys, err := p.db.GetAllKeysWithPrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list position snapshots: %w", err)
+	}
+
+	dates := make([]string, 0, len(keys))
+	for _, key := range keys {
+		dates = append(dates, strings.TrimPrefix(key, prefix))
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+// StartSnapshotSchedule stores a position snapshot, and a net worth snapshot when enabled, and prunes the position
+// snapshots outside the retention once a day at the configured local time until the scheduler is stopped. A move in
+// the total PnL since the previous snapshot beyond the configured threshold is posted to the notifier, which may be
+// nil.
+func (p *Portfolio) StartSnapshotSchedule(sched *scheduler.Scheduler, notifier Notifier) {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg != nil && cfg.PositionSnapshot.Disabled {
+		p.logger.Info("Scheduled position snapshot is disabled")
+		return
+	}
+
+	sched.Every("position_snapshot", time.Minute, func() error { return p.runScheduledSnapshot(time.Now(), notifier) })
+}
+
+// runScheduledSnapshot stores the snapshot if the scheduled time of now's day has passed and it has not yet run that
+// day. It returns scheduler.ErrNotDue when it did not run, or the error of the snapshot.
+func (p *Portfolio) runScheduledSnapshot(now time.Time, notifier Notifier) error {
+	day := now.Format("2006-01-02")
+	scheduled, err := time.ParseInLocation("2006-01-02 15:04", day+" "+snapshotTime(), now.Location())
+	if err != nil {
+		p.logger.Warnf("Invalid position snapshot time %s, using %s", snapshotTime(), defaultSnapshotTime)
+		scheduled, _ = time.ParseInLocation("2006-01-02 15:04", day+" "+defaultSnapshotTime, now.Location())
+	}
+
+	p.mu.Lock()
+	due := !now.Before(scheduled) && p.snapshotRanOn != day
+	if due {
+		p.snapshotRanOn = day
+	}
+	p.mu.Unlock()
+	if !due {
+		return scheduler.ErrNotDue
+	}
+
+	previous, _ := p.GetPositionSnapshot(nil, now.AddDate(0, 0, -1))
+	snapshot, err := p.StorePositionSnapshot(now)
+	if err != nil {
+		p.logger.Errorf("Scheduled position snapshot failed: %v", err)
+		return err
+	}
+	p.logger.Infof("Stored position snapshot of %s with %d position(s)", snapshot.Date, len(snapshot.Positions))
+	p.notifyPnLMove(previous, snapshot, notifier)
+
+	if cfg, _ := config.GetOrCreateConfig(""); cfg != nil && cfg.PositionSnapshot.NetWorth {
+		if netWorth, err := p.StoreNetWorthSnapshot(now); err != nil {
+			p.logger.Errorf("Scheduled net worth snapshot failed: %v", err)
+		} else {
+			p.logger.Infof("Stored net worth snapshot of %s, total %.2f %s", netWorth.Date, netWorth.Total, netWorth.BaseCcy)
+		}
+	}
+
+	pruned, err := p.PruneSnapshots(now)
+	if len(pruned) > 0 {
+		p.logger.Infof("Pruned %d position snapshot(s) outside the retention", len(pruned))
+	}
+	if err != nil {
+		p.logger.Warnf("Failed to prune position snapshots: %v", err)
+	}
+	return err
+}
+
+// notifyPnLMove posts the move in the total PnL between the snapshots to the notifier when it exceeds the configured
+// percentage of the market value of the previous snapshot.
+func (p *Portfolio) notifyPnLMove(previous, snapshot *PositionSnapshot, notifier Notifier) {
+	threshold := pnlMovePct()
+	if notifier == nil || threshold <= 0 || previous == nil || previous.Mv == 0 || previous.Date == snapshot.Date {
+		return
+	}
+
+	move := snapshot.PnL - previous.PnL
+	movePct := move / math.Abs(previous.Mv) * 100
+	if math.Abs(movePct) <= threshold {
+		return
+	}
+
+	message := fmt.Sprintf("PnL moved %+.2f (%+.2f%% of the market value) from %s to %s", move, movePct, previous.Date, snapshot.Date)
+	if err := notifier.Notify("pnl", message); err != nil {
+		p.logger.Warnf("Failed to post PnL notification: %v", err)
+	}
+}
+
+func pnlMovePct() float64 {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil {
+		return 0
+	}
+	return cfg.Notifications.PnLMovePct
+}
+
+func snapshotTime() string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.PositionSnapshot.Time == "" {
+		return defaultSnapshotTime
+	}
+	return cfg.PositionSnapshot.Time
+}
+
+func snapshotDailyRetentionDays() int {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.PositionSnapshot.DailyRetentionDays <= 0 {
+		return defaultSnapshotDailyRetentionDays
+	}
+	return cfg.PositionSnapshot.DailyRetentionDays
+}
+
+func snapshotKey(date string) string {
+	return fmt.Sprintf("%s:%s", types.SnapshotKeyPrefix, date)
+}
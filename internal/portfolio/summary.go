@@ -0,0 +1,44 @@
+package portfolio
+
+import "portfolio-manager/pkg/types"
+
+// Summary aggregates the enriched positions of one or more books.
+type Summary struct {
+	Mv               float64
+	PnL              float64
+	Dividends        float64
+	OpenPositions    int
+	BreakEvenMovePct *float64 // uniform move in the prices of the open positions which leaves zero total PnL, nil when nothing is open
+}
+
+// Summarize aggregates enriched positions. The break-even move includes the PnL of closed positions, since selling
+// everything at the break-even prices must also make up for it.
+func Summarize(positions []*Position) Summary {
+	var summary Summary
+	for _, position := range positions {
+		summary.PnL += position.PnL
+		summary.Dividends += position.Dividends
+		if position.Qty != 0 {
+			summary.Mv += position.Mv
+			summary.OpenPositions++
+		}
+	}
+
+	if summary.OpenPositions > 0 && summary.Mv != 0 {
+		movePct := -summary.PnL / summary.Mv * 100
+		summary.BreakEvenMovePct = &movePct
+	}
+	return summary
+}
+
+// GetSummary returns the summary of the books visible to the user, or of a single book when given.
+func (p *Portfolio) GetSummary(user *types.User, book string) (Summary, error) {
+	var positions []*Position
+	var err error
+	if book != "" {
+		positions, err = p.GetPositions(book)
+	} else {
+		positions, err = p.GetPositionsForUser(user)
+	}
+	return Summarize(positions), err
+}
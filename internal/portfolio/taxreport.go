@@ -0,0 +1,313 @@
+package portfolio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dividends"
+)
+
+// Notes on how the tax report attributes amounts to the year, returned with every report.
+var taxReportNotes = []string{
+	"dividends are attributed to the year of their ex date, which may differ from the year they were paid",
+	"realized gains are attributed to the year of the closing trade, against the average cost of the lots it closes including those opened in earlier years",
+	"amounts in the base currency are converted at the FX rate of the trade, or the close of the ex date for dividends",
+	"gross dividends are split into income, capital return and other when known, else reported as income",
+}
+
+// TaxLine holds the dividends and realized gains of a ticker in a book for the year. Amounts are in the ticker's
+// currency, except those suffixed Base.
+type TaxLine struct {
+	Book               string
+	Ticker             string
+	Ccy                string
+	Domicile           string
+	DividendsGross     float64
+	WithholdingTax     float64
+	DividendsNet       float64
+	RealizedQty        float64 // quantity closed in the year
+	RealizedGain       float64 // net of fees
+	DividendsGrossBase float64
+	WithholdingTaxBase float64
+	DividendsNetBase   float64
+	RealizedGainBase   float64
+	// split of the gross dividends, e.g. the capital return of REIT distributions
+	DividendsIncome            float64
+	DividendsCapitalReturn     float64
+	DividendsOther             float64
+	DividendsCapitalReturnBase float64
+}
+
+// TaxSummary totals the tax lines in the base currency, per domicile or overall.
+type TaxSummary struct {
+	Domicile       string `json:",omitempty"`
+	DividendsGross float64
+	WithholdingTax float64
+	DividendsNet   float64
+	RealizedGain   float64
+	// capital return included in the gross dividends
+	DividendsCapitalReturn float64
+}
+
+func (s *TaxSummary) add(line TaxLine) {
+	s.DividendsGross += line.DividendsGrossBase
+	s.WithholdingTax += line.WithholdingTaxBase
+	s.DividendsNet += line.DividendsNetBase
+	s.RealizedGain += line.RealizedGainBase
+	s.DividendsCapitalReturn += line.DividendsCapitalReturnBase
+}
+
+// TaxReport holds the dividends and realized gains of a calendar year per book and ticker, with totals per domicile
+// and overall in the base currency.
+type TaxReport struct {
+	Year       int
+	BaseCcy    string
+	Lines      []TaxLine
+	ByDomicile []TaxSummary
+	Total      TaxSummary
+	Notes      []string
+	Warnings   []string
+}
+
+// GetTaxReport reports the dividends with their withholding tax and the realized gains of the books in the calendar
+// year, all books when books is empty. Dividends are calculated by the dividends manager on the quantity held by each
+// book, and gains are realized against the average cost of the position like the PnL attribution.
+func (p *Portfolio) GetTaxReport(year int, books []string) (*TaxReport, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+	if year < 1900 || year > 9999 {
+		return nil, fmt.Errorf("invalid year %d", year)
+	}
+
+	bookFilter := make(map[string]struct{}, len(books))
+	for _, book := range books {
+		bookFilter[book] = struct{}{}
+	}
+
+	report := &TaxReport{Year: year, BaseCcy: blotter.BaseCurrency(), Lines: []TaxLine{}, ByDomicile: []TaxSummary{}, Notes: taxReportNotes}
+	yearStart := fmt.Sprintf("%04d-01-01", year)
+	yearEnd := fmt.Sprintf("%04d-12-31", year)
+
+	lines := make(map[[2]string]*TaxLine)
+	lots := make(map[[2]string]*attributionLot)
+	for _, trade := range p.blotter.GetTradesByFilter(blotter.TradeFilter{To: yearEnd}) {
+		if _, ok := bookFilter[trade.Trader]; len(bookFilter) > 0 && !ok {
+			continue
+		}
+
+		key := [2]string{trade.Trader, trade.Ticker}
+		line, ok := lines[key]
+		if !ok {
+			tickerRef, err := p.rdata.GetTicker(trade.Ticker)
+			if err != nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s %s: no reference data, excluded", trade.Trader, trade.Ticker))
+				lines[key] = nil
+				continue
+			}
+			line = &TaxLine{Book: trade.Trader, Ticker: trade.Ticker, Ccy: tickerRef.Ccy, Domicile: tickerRef.Domicile}
+			lines[key] = line
+			lots[key] = &attributionLot{}
+		}
+		if line == nil {
+			continue
+		}
+
+		tradeDate := trade.TradeDate[:min(len(trade.TradeDate), 10)]
+		fx := p.taxFx(report, line, trade.Fx, tradeDate)
+
+		// fees are folded into the price so they add to the cost of opening trades and reduce the proceeds of closing ones
+		qty := trade.Quantity * p.contractMultiplier(trade.Ticker)
+		if trade.Side == blotter.TradeSideSell {
+			qty = -qty
+		}
+		px := trade.Price
+		if qty != 0 {
+			px += trade.FeeInTradeCcy() / qty
+		}
+
+		lot := lots[key]
+		closed := 0.0
+		if lot.qty != 0 && (lot.qty > 0) != (qty > 0) {
+			closed = math.Min(math.Abs(qty), math.Abs(lot.qty))
+		}
+		avgFx := lot.avgFx
+		var realized Attribution
+		lot.apply(qty, px, fx, &realized)
+		if tradeDate < yearStart || closed == 0 {
+			continue
+		}
+
+		// the local price return is attributed at the average FX rate of the lot
+		line.RealizedQty += closed / p.contractMultiplier(trade.Ticker)
+		line.RealizedGainBase += realized.Price + realized.Fx + realized.Cross
+		if avgFx != 0 {
+			line.RealizedGain += realized.Price / avgFx
+		}
+	}
+
+	for _, line := range lines {
+		if line == nil {
+			continue
+		}
+		p.addTaxDividends(report, line, yearStart, yearEnd)
+		if line.RealizedQty == 0 && line.DividendsGross == 0 && line.DividendsNet == 0 {
+			continue
+		}
+		report.Lines = append(report.Lines, *line)
+	}
+
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].Book != report.Lines[j].Book {
+			return report.Lines[i].Book < report.Lines[j].Book
+		}
+		return report.Lines[i].Ticker < report.Lines[j].Ticker
+	})
+
+	byDomicile := make(map[string]*TaxSummary)
+	for _, line := range report.Lines {
+		summary, ok := byDomicile[line.Domicile]
+		if !ok {
+			summary = &TaxSummary{Domicile: line.Domicile}
+			byDomicile[line.Domicile] = summary
+		}
+		summary.add(line)
+		report.Total.add(line)
+	}
+	for _, summary := range byDomicile {
+		report.ByDomicile = append(report.ByDomicile, *summary)
+	}
+	sort.Slice(report.ByDomicile, func(i, j int) bool { return report.ByDomicile[i].Domicile < report.ByDomicile[j].Domicile })
+	sort.Strings(report.Warnings)
+	return report, nil
+}
+
+// addTaxDividends adds the dividends of the line's ticker held by its book with an ex date in the year.
+func (p *Portfolio) addTaxDividends(report *TaxReport, line *TaxLine, yearStart, yearEnd string) {
+	tickerRef, err := p.rdata.GetTicker(line.Ticker)
+	if err != nil || p.dividendsMgr == nil || p.enrichmentStrategy(tickerRef.AssetClass) != EnrichPriceWithDividends {
+		return
+	}
+
+	dividends, err := p.dividendsMgr.CalculateDividendsForBook(line.Ticker, line.Book)
+	if err != nil {
+		// tickers without dividends data are expected, e.g. growth stocks
+		return
+	}
+	for _, dividend := range dividends {
+		if dividend.ExDate < yearStart || dividend.ExDate > yearEnd {
+			continue
+		}
+
+		// shorts pay the gross dividend to the lender, nothing is withheld
+		gross := dividend.Qty * dividend.AmountPerShare
+		withheld := gross - dividend.Amount
+		fx := p.taxFx(report, line, 0, dividend.ExDate)
+
+		line.DividendsGross += gross
+		line.WithholdingTax += withheld
+		line.DividendsNet += dividend.Amount
+		line.DividendsGrossBase += gross * fx
+		line.WithholdingTaxBase += withheld * fx
+		line.DividendsNetBase += dividend.Amount * fx
+
+		income, capitalReturn, other := grossComponents(dividend, gross)
+		line.DividendsIncome += income
+		line.DividendsCapitalReturn += capitalReturn
+		line.DividendsOther += other
+		line.DividendsCapitalReturnBase += capitalReturn * fx
+	}
+}
+
+// grossComponents splits the gross dividend into income, capital return and other like its net components, all income
+// when the split is unknown.
+func grossComponents(dividend dividends.Dividends, gross float64) (income, capitalReturn, other float64) {
+	if dividend.Income == nil && dividend.CapitalReturn == nil && dividend.Other == nil {
+		return gross, 0, 0
+	}
+	if dividend.Amount == 0 {
+		return 0, 0, 0
+	}
+
+	ratio := gross / dividend.Amount
+	for _, component := range []struct {
+		net   *float64
+		gross *float64
+	}{
+		{dividend.Income, &income},
+		{dividend.CapitalReturn, &capitalReturn},
+		{dividend.Other, &other},
+	} {
+		if component.net != nil {
+			*component.gross = *component.net * ratio
+		}
+	}
+	return income, capitalReturn, other
+}
+
+// taxFx returns the FX rate of the line's currency to the base currency on the date, the given rate when set, else
+// inferred from the close of the date. Amounts which cannot be converted are converted at 1 with a warning.
+func (p *Portfolio) taxFx(report *TaxReport, line *TaxLine, fx float64, date string) float64 {
+	if line.Ccy == "" || line.Ccy == report.BaseCcy {
+		return 1
+	}
+	if fx > 0 {
+		return fx
+	}
+
+	day, err := time.Parse("2006-01-02", date)
+	if err == nil {
+		fx, err = p.blotter.InferFx(line.Ccy, day)
+	}
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%s %s: no FX rate on %s, converted at 1", line.Book, line.Ticker, date))
+		return 1
+	}
+	return fx
+}
+
+// ToCSV writes the lines of the report followed by a total row per domicile and overall.
+func (r *TaxReport) ToCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := []string{"Book", "Ticker", "Ccy", "Domicile", "DividendsGross", "WithholdingTax", "DividendsNet", "RealizedQty",
+		"RealizedGain", "DividendsGross" + r.BaseCcy, "WithholdingTax" + r.BaseCcy, "DividendsNet" + r.BaseCcy, "RealizedGain" + r.BaseCcy,
+		"DividendsIncome", "DividendsCapitalReturn", "DividendsOther", "DividendsCapitalReturn" + r.BaseCcy}
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("error writing CSV header: %w", err)
+	}
+
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	for _, l := range r.Lines {
+		record := []string{l.Book, l.Ticker, l.Ccy, l.Domicile, format(l.DividendsGross), format(l.WithholdingTax),
+			format(l.DividendsNet), format(l.RealizedQty), format(l.RealizedGain), format(l.DividendsGrossBase),
+			format(l.WithholdingTaxBase), format(l.DividendsNetBase), format(l.RealizedGainBase), format(l.DividendsIncome),
+			format(l.DividendsCapitalReturn), format(l.DividendsOther), format(l.DividendsCapitalReturnBase)}
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("error writing CSV record: %w", err)
+		}
+	}
+
+	for _, s := range append(append([]TaxSummary{}, r.ByDomicile...), r.Total) {
+		label := "Total"
+		if s.Domicile != "" {
+			label = "Total " + s.Domicile
+		}
+		total := []string{label, "", r.BaseCcy, s.Domicile, "", "", "", "", "", format(s.DividendsGross), format(s.WithholdingTax),
+			format(s.DividendsNet), format(s.RealizedGain), "", "", "", format(s.DividendsCapitalReturn)}
+		if err := writer.Write(total); err != nil {
+			return nil, fmt.Errorf("error writing CSV record: %w", err)
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
@@ -0,0 +1,209 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/types"
+)
+
+// TWRReport is the time-weighted return of the portfolio from its first trade to the as-of date. Unlike the IRR it
+// is not weighted by the amounts traded, so the timing of buys and sells does not move it.
+type TWRReport struct {
+	From       string   // date of the first trade, YYYY-MM-DD
+	To         string   // as-of date, YYYY-MM-DD
+	Cumulative *float64 // nil when no period starts with a market value, e.g. no trades
+	Annualized *float64 // nil like Cumulative, or when the cumulative return is a loss of 100% or more
+	Periods    int      // sub-periods chained, one per trade date with a market value before it
+	Warnings   []string // tickers without historical prices, valued at their last trade price instead
+}
+
+// GetTWR returns the TWR of the books the user may see as of asOf, all books when user is nil, of the trades included in
+// the saved view only when view is not nil. The period is broken at every trade date. Each sub-period returns the change of the
+// market value at the close of its end, net of the amounts traded that day, plus the dividends and coupons going ex
+// in it, over the market value at the close of its start. Positions are valued with the historical closes like the
+// ticker history, and summed across currencies like the IRR.
+func (p *Portfolio) GetTWR(user *types.User, asOf time.Time, view *blotter.SavedView) (*TWRReport, error) {
+	if p.blotter == nil {
+		return nil, errors.New("portfolio is not subscribed to a blotter")
+	}
+
+	report := &TWRReport{To: asOf.Format(time.DateOnly)}
+	var trades []blotter.Trade
+	tradeDates := make(map[string]string) // by trade id
+	for _, trade := range p.blotter.GetTrades() {
+		if user != nil && !user.CanSeeBook(trade.Trader) {
+			continue
+		}
+		if !view.IncludesTrade(trade, p.assetClass(trade.Ticker)) {
+			continue
+		}
+
+		tradeDate, err := time.Parse(time.RFC3339, trade.TradeDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trade date of trade %s: %w", trade.TradeID, err)
+		}
+		if tradeDate.After(asOf) {
+			continue
+		}
+		trades = append(trades, trade)
+		tradeDates[trade.TradeID] = tradeDate.Format(time.DateOnly)
+	}
+	if len(trades) == 0 {
+		return report, nil
+	}
+	sort.SliceStable(trades, func(i, j int) bool { return tradeDates[trades[i].TradeID] < tradeDates[trades[j].TradeID] })
+	report.From = tradeDates[trades[0].TradeID]
+
+	from, _ := time.Parse(time.DateOnly, report.From)
+	closes := make(map[string][]dailyClose)
+	strategies := make(map[string]string)
+	for _, trade := range trades {
+		if _, ok := strategies[trade.Ticker]; ok {
+			continue
+		}
+		strategies[trade.Ticker] = ""
+		if tickerRef, err := p.rdata.GetTicker(trade.Ticker); err == nil {
+			strategies[trade.Ticker] = p.enrichmentStrategy(tickerRef.AssetClass)
+		}
+		tickerCloses, err := p.historicalCloses(trade.Ticker, from, asOf, strategies[trade.Ticker])
+		if err != nil {
+			p.logger.Warnf("Failed to get closes for the TWR: %v", err)
+		}
+		closes[trade.Ticker] = tickerCloses
+	}
+
+	income := p.incomeByExDate(trades, asOf)
+	incomeDates := make([]string, 0, len(income))
+	for date := range income {
+		incomeDates = append(incomeDates, date)
+	}
+	sort.Strings(incomeDates)
+
+	positions := make(map[[2]string]*Position)
+	lastTradePx := make(map[string]float64)
+	value := func(date string) float64 {
+		var mv float64
+		for _, position := range positions {
+			if position.Qty == 0 {
+				continue
+			}
+			price := lastTradePx[position.Ticker]
+			switch strategies[position.Ticker] {
+			case EnrichParValued:
+				price = 1
+			case EnrichManualOnly:
+				price = position.AvgPx
+			default:
+				tickerCloses := closes[position.Ticker]
+				if i := sort.Search(len(tickerCloses), func(i int) bool { return tickerCloses[i].date > date }); i > 0 {
+					price = tickerCloses[i-1].price
+				}
+			}
+			mv += price * position.Qty * p.contractMultiplier(position.Ticker)
+		}
+		return mv
+	}
+
+	growth := 1.0
+	var startMv float64
+	var startDate string
+	for len(trades) > 0 || startDate < report.To {
+		date := report.To
+		if len(trades) > 0 {
+			date = tradeDates[trades[0].TradeID]
+		}
+
+		// the amount put in the portfolio by the trades of the day, negative when taken out
+		var contributed float64
+		for len(trades) > 0 && tradeDates[trades[0].TradeID] == date {
+			trade := trades[0]
+			key := [2]string{trade.Trader, trade.Ticker}
+			if _, ok := positions[key]; !ok {
+				positions[key] = &Position{Trader: trade.Trader, Ticker: trade.Ticker}
+			}
+			applyTrade(positions[key], &trade, p.contractMultiplier(trade.Ticker))
+			lastTradePx[trade.Ticker] = trade.Price
+
+			amount := trade.Quantity * trade.Price * p.contractMultiplier(trade.Ticker)
+			if trade.Side != blotter.TradeSideBuy {
+				amount = -amount
+			}
+			contributed += amount + trade.FeeInTradeCcy()
+			trades = trades[1:]
+		}
+
+		var received float64
+		for len(incomeDates) > 0 && incomeDates[0] <= date {
+			if incomeDates[0] > startDate {
+				received += income[incomeDates[0]]
+			}
+			incomeDates = incomeDates[1:]
+		}
+
+		endMv := value(date)
+		if startMv != 0 {
+			// shorts have a negative market value, which gains as it rises towards zero
+			growth *= 1 + (endMv-contributed+received-startMv)/math.Abs(startMv)
+			report.Periods++
+		}
+		startMv, startDate = endMv, date
+	}
+
+	for ticker, tickerCloses := range closes {
+		if len(tickerCloses) == 0 && strategies[ticker] != EnrichParValued && strategies[ticker] != EnrichManualOnly {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: no historical prices, valued at the last trade price", ticker))
+		}
+	}
+	sort.Strings(report.Warnings)
+
+	if report.Periods == 0 {
+		return report, nil
+	}
+	cumulative := growth - 1
+	report.Cumulative = &cumulative
+	if growth > 0 {
+		annualized := cumulative
+		if days := asOf.Sub(from).Hours() / 24; days > 0 {
+			annualized = math.Pow(growth, 365/days) - 1
+		}
+		report.Annualized = &annualized
+	}
+	return report, nil
+}
+
+// incomeByExDate returns the dividends and coupons of the trades' books by ex-date up to asOf, split between the books
+// by the quantity each held before the ex-date like the IRR cashflows.
+func (p *Portfolio) incomeByExDate(trades []blotter.Trade, asOf time.Time) map[string]float64 {
+	income := make(map[string]float64)
+	if p.dividendsMgr == nil {
+		return income
+	}
+
+	byTicker := make(map[string][]blotter.Trade)
+	for _, trade := range trades {
+		byTicker[trade.Ticker] = append(byTicker[trade.Ticker], trade)
+	}
+	for ticker, tickerTrades := range byTicker {
+		dividends, err := p.dividendsMgr.CalculateDividendsForSingleTicker(ticker)
+		if err != nil {
+			// tickers without dividends data are expected, e.g. crypto
+			continue
+		}
+		for _, dividend := range dividends {
+			if dividend.ExDate > asOf.Format(time.DateOnly) {
+				continue
+			}
+			for _, qty := range qtyHeldBefore(tickerTrades, dividend.ExDate) {
+				if qty != 0 {
+					income[dividend.ExDate] += bookDividend(dividend, qty)
+				}
+			}
+		}
+	}
+	return income
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+)
+
+// configEntityPrefix is the audit entity key prefix of the config settings changed by a reload
+const configEntityPrefix = "CONFIG"
+
+// Notifier posts notifications, e.g. the notifications manager.
+type Notifier interface {
+	Notify(source, message string) error
+}
+
+// ConfigReloadResponse lists the settings changed by a config reload.
+type ConfigReloadResponse struct {
+	Changes []config.Change `json:"changes"`
+}
+
+// ConfigResponse is the effective config with its metadata.
+type ConfigResponse struct {
+	config.Metadata
+	Config config.Config `json:"config"`
+}
+
+// HandleGetConfig handles getting the effective config.
+// @Summary Get the effective config
+// @Description Get the config the server is running with, with secrets such as API keys, the SMTP password, the Telegram bot token and the S3 credentials shortened to their last 4 characters. Includes the config file path, the time it was loaded and whether each setting came from the file, an environment variable or a default. Admin only.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} ConfigResponse
+// @Failure 403 {string} string "Admin only"
+// @Failure 500 {string} string "Config not loaded"
+// @Router /api/v1/admin/config [get]
+func HandleGetConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg, err := config.GetOrCreateConfig("")
+		if err != nil || cfg == nil {
+			http.Error(w, "ERROR: config not loaded", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ConfigResponse{Metadata: config.GetMetadata(), Config: cfg.Redacted()})
+	}
+}
+
+// HandleConfigReload handles reloading the config file.
+// @Summary Reload the config
+// @Description Re-read the config file and apply the changed settings without a restart, e.g. rate limits, log verbosity, schedule times and API keys. Changes to settings read once on startup, such as the port, the database, backups, notifications and alerts, are rejected and nothing is reloaded. Each applied change is recorded in the audit log and notified. Admin only.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} ConfigReloadResponse
+// @Failure 400 {string} string "Invalid config or settings requiring a restart"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/admin/config/reload [post]
+func HandleConfigReload(auditLog *audit.Log, notifier Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		changes, err := config.Reload()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		keys := make([]string, 0, len(changes))
+		for _, change := range changes {
+			keys = append(keys, change.Key)
+			if auditLog != nil {
+				auditLog.Record(audit.SourceAPI, audit.OperationUpdate, configEntityPrefix+":"+change.Key,
+					[]byte(change.Before), []byte(change.After))
+			}
+		}
+		if len(changes) > 0 {
+			logging.FromContext(r.Context()).Infof("Reloaded config, changed %s", strings.Join(keys, ", "))
+			if notifier != nil {
+				if err := notifier.Notify("config", fmt.Sprintf("Config reloaded, changed %s", strings.Join(keys, ", "))); err != nil {
+					logging.FromContext(r.Context()).Warnf("Failed to post config reload notification: %v", err)
+				}
+			}
+		}
+
+		if changes == nil {
+			changes = []config.Change{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ConfigReloadResponse{Changes: changes})
+	}
+}
+
+// registerAdminHandlers registers the admin only handlers managing the server.
+func registerAdminHandlers(mux *http.ServeMux, auditLog *audit.Log, notifier Notifier) {
+	mux.HandleFunc("/api/v1/admin/config", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			HandleGetConfig().ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/admin/config/reload", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			HandleConfigReload(auditLog, notifier).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// isAdmin returns whether the user of the request is an admin, rejecting the request otherwise.
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if user := types.UserFromContext(r.Context()); user != nil && !user.Admin {
+		http.Error(w, "ERROR: admin only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/types"
+)
+
+// UserStore authenticates API keys against the keys in config and the users bucket in the database.
+// Only a hash of the keys of database users is stored, the key itself is returned once when the user is added.
+type UserStore struct {
+	db dal.Database // optional, only config keys are used when nil
+
+	mu       sync.RWMutex
+	hasUsers bool // whether any user is in the database, cached to avoid a scan per request
+}
+
+// NewUserStore creates a new UserStore.
+func NewUserStore(db dal.Database) *UserStore {
+	store := &UserStore{db: db}
+	if db != nil {
+		keys, err := db.GetAllKeysWithPrefix(string(types.UserKeyPrefix) + ":")
+		store.hasUsers = err != nil || len(keys) > 0 // fail closed when the users cannot be read
+	}
+	return store
+}
+
+// Enabled returns whether authentication is enabled, which is when any API key is configured or any user is in the
+// database, so that adding a user never leaves the API open to requests without a key.
+func (s *UserStore) Enabled() bool {
+	if cfg, err := config.GetOrCreateConfig(""); err == nil && cfg != nil && len(cfg.ApiKeys) > 0 {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hasUsers
+}
+
+// Authenticate returns the user of the API key.
+func (s *UserStore) Authenticate(apiKey string) (*types.User, error) {
+	if apiKey == "" {
+		return nil, errors.New("missing api key")
+	}
+
+	cfg, err := config.GetOrCreateConfig("")
+	if err == nil && cfg != nil {
+		if user, exists := cfg.ApiKeys[apiKey]; exists {
+			return &user, nil
+		}
+	}
+
+	if s.db != nil {
+		var user types.User
+		if err := s.db.Get(userKey(apiKey), &user); err == nil {
+			return &user, nil
+		}
+	}
+
+	return nil, errors.New("invalid api key")
+}
+
+// AddUser adds a user to the database and returns its newly generated API key.
+func (s *UserStore) AddUser(user types.User) (string, error) {
+	if s.db == nil {
+		return "", errors.New("users database is not available")
+	}
+	if user.Name == "" {
+		return "", errors.New("user name is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, err := s.GetUsers()
+	if err != nil {
+		return "", err
+	}
+	for _, existing := range users {
+		if existing.Name == user.Name {
+			return "", fmt.Errorf("user %s already exists", user.Name)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	apiKey := hex.EncodeToString(secret)
+
+	if err := s.db.Put(userKey(apiKey), user); err != nil {
+		return "", err
+	}
+	s.hasUsers = true
+	return apiKey, nil
+}
+
+// GetUsers returns the users in the database, config users are not included.
+func (s *UserStore) GetUsers() ([]types.User, error) {
+	users := []types.User{}
+	if s.db == nil {
+		return users, nil
+	}
+
+	keys, err := s.db.GetAllKeysWithPrefix(string(types.UserKeyPrefix) + ":")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		var user types.User
+		if err := s.db.Get(key, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// DeleteUser deletes the user from the database, revoking its API key.
+func (s *UserStore) DeleteUser(name string) error {
+	if s.db == nil {
+		return errors.New("users database is not available")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.db.GetAllKeysWithPrefix(string(types.UserKeyPrefix) + ":")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var user types.User
+		if err := s.db.Get(key, &user); err != nil {
+			return err
+		}
+		if user.Name == name {
+			if err := s.db.Delete(key); err != nil {
+				return err
+			}
+			s.hasUsers = len(keys) > 1
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s not found", name)
+}
+
+// userKey returns the database key of the API key, keyed by its hash.
+func userKey(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return fmt.Sprintf("%s:%s", types.UserKeyPrefix, hex.EncodeToString(hash[:]))
+}
+
+// bearerToken returns the API key of the Authorization header, e.g. Authorization: Bearer <key>.
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// HandleUsersGet handles listing the users in the database.
+// @Summary List users
+// @Description List the users in the database, without their API keys. Admin only.
+// @Tags users
+// @Produce json
+// @Success 200 {array} types.User
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/users [get]
+func HandleUsersGet(store *UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := store.GetUsers()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+	}
+}
+
+// HandleUserPost handles adding a user to the database.
+// @Summary Add a user
+// @Description Add a user with the books it may see, returning its API key which is not retrievable afterwards. Admin only.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body types.User true "User"
+// @Success 201 {object} map[string]string
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/users [post]
+func HandleUserPost(store *UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var user types.User
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		apiKey, err := store.AddUser(user)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"name": user.Name, "apiKey": apiKey})
+	}
+}
+
+// HandleUserDelete handles deleting a user from the database.
+// @Summary Delete a user
+// @Description Delete a user from the database, revoking its API key. Admin only.
+// @Tags users
+// @Param name query string true "User name"
+// @Success 204
+// @Failure 404 {string} string "User not found"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/users [delete]
+func HandleUserDelete(store *UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := store.DeleteUser(r.URL.Query().Get("name")); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// registerUserHandlers registers the admin only handlers managing users.
+func registerUserHandlers(mux *http.ServeMux, store *UserStore) {
+	mux.HandleFunc("/api/v1/users", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			HandleUsersGet(store).ServeHTTP(w, r)
+		case http.MethodPost:
+			HandleUserPost(store).ServeHTTP(w, r)
+		case http.MethodDelete:
+			HandleUserDelete(store).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
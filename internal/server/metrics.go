@@ -0,0 +1,149 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metric names are referenced by dashboards, so they should not be renamed.
+const (
+	metricsNamespace = "portfolio"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+
+	unmatchedRoute = "unmatched"
+)
+
+// Metrics holds the Prometheus collectors exposed on /metrics, of the HTTP requests, market data sources, blotter,
+// scheduled jobs and database operations.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequestDuration *prometheus.HistogramVec
+	fetchDuration       *prometheus.HistogramVec
+	fetchErrors         *prometheus.CounterVec
+	jobRuns             *prometheus.CounterVec
+	dbOperationDuration *prometheus.HistogramVec
+}
+
+// NewMetrics creates the collectors on a registry of their own, along with the Go runtime and process collectors.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "marketdata",
+			Name:      "fetch_duration_seconds",
+			Help:      "Duration of the requests to the market data sources by source and operation.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"source", "operation"}),
+		fetchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "marketdata",
+			Name:      "fetch_errors_total",
+			Help:      "Failed requests to the market data sources by source and operation.",
+		}, []string{"source", "operation"}),
+		jobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "scheduler",
+			Name:      "job_runs_total",
+			Help:      "Runs of the scheduled jobs by job and result, success or failure.",
+		}, []string{"job", "result"}),
+		dbOperationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "db",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the database operations by operation.",
+			Buckets:   []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+		}, []string{"operation"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequestDuration,
+		m.fetchDuration,
+		m.fetchErrors,
+		m.jobRuns,
+		m.dbOperationDuration,
+	)
+	return m
+}
+
+// Handler returns the handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveFetch records a request to a market data source, it is an mdata.FetchObserver.
+func (m *Metrics) ObserveFetch(source, operation string, duration time.Duration, err error) {
+	m.fetchDuration.WithLabelValues(source, operation).Observe(duration.Seconds())
+	if err != nil {
+		m.fetchErrors.WithLabelValues(source, operation).Inc()
+	}
+}
+
+// ObserveJob records a run of a scheduled job, it is a scheduler.Observer.
+func (m *Metrics) ObserveJob(job string, duration time.Duration, err error) {
+	result := resultSuccess
+	if err != nil {
+		result = resultFailure
+	}
+	m.jobRuns.WithLabelValues(job, result).Inc()
+}
+
+// ObserveDatabase records a database operation, it is a dal.Observer.
+func (m *Metrics) ObserveDatabase(operation string, duration time.Duration) {
+	m.dbOperationDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// registerTradeCount registers the gauge of the number of trades in the blotter, read on each scrape.
+func (m *Metrics) registerTradeCount(count func() int) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "blotter",
+		Name:      "trades",
+		Help:      "Number of trades in the blotter.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// metricsMiddleware records the duration of the requests by the route pattern of the mux which serves them, rather
+// than by path, so that the number of series stays bounded.
+func metricsMiddleware(next http.Handler, mux *http.ServeMux, metrics *Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		metrics.httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder records the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
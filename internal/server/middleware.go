@@ -2,16 +2,44 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-// loggingMiddleware logs details about the request.
-func loggingMiddleware(next http.Handler, logger *logging.Logger) http.Handler {
+// RequestIDHeader carries the correlation ID of a request, taken from the request when set by a proxy and echoed in
+// the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the length of request IDs taken from requests.
+const maxRequestIDLength = 128
+
+// requestIDMiddleware tags the request with a correlation ID, adding a logger tagged with the ID to the request
+// context so that handlers and the services they call log with it.
+func requestIDMiddleware(next http.Handler, logger *logging.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := context.WithValue(r.Context(), types.LoggerKey, logger.WithRequestID(requestID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// loggingMiddleware logs details about the request, with the logger of the request context.
+func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
 		start := time.Now()
 		clientIP := r.RemoteAddr
 		method := r.Method
@@ -39,3 +67,23 @@ func loggingMiddleware(next http.Handler, logger *logging.Logger) http.Handler {
 		logger.Info(fmt.Sprintf("Completed request: method=%s uri=%s client_ip=%s duration=%s", method, uri, clientIP, duration))
 	})
 }
+
+// authMiddleware validates the API key in the Authorization header of /api/v1 routes, adding its user to the
+// request context. Requests are let through unauthenticated when no API keys are configured and no users are added.
+func authMiddleware(next http.Handler, store *UserStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/v1/") || !store.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := store.Authenticate(bearerToken(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), types.UserKey, user)))
+	})
+}
@@ -2,12 +2,20 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"portfolio-manager/internal/alerts"
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/backup"
 	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dal"
 	"portfolio-manager/internal/dividends"
+	"portfolio-manager/internal/grafana"
+	"portfolio-manager/internal/notifications"
 	"portfolio-manager/internal/portfolio"
+	"portfolio-manager/internal/vesting"
 	"portfolio-manager/pkg/logging"
 	"portfolio-manager/pkg/mdata"
 	"portfolio-manager/pkg/rdata"
@@ -23,17 +31,66 @@ type Server struct {
 	Addr      string
 	blotter   *blotter.TradeBlotter
 	portfolio *portfolio.Portfolio
+
+	notifications *notifications.NotificationsManager // optional
+	alerts        *alerts.Manager                     // optional
+	audit         *audit.Log                          // optional
+	vesting       *vesting.Manager                    // optional
+	backup        *backup.Service                     // optional
+	metrics       *Metrics                            // optional
+	users         *UserStore
+	httpServer    *http.Server
 }
 
 // NewServer creates a new Server instance.
 func NewServer(addr string, blotterSvc *blotter.TradeBlotter, portfolioSvc *portfolio.Portfolio) *Server {
 	return &Server{
-		Addr:      addr,
-		blotter:   blotterSvc,
-		portfolio: portfolioSvc,
+		Addr:       addr,
+		blotter:    blotterSvc,
+		portfolio:  portfolioSvc,
+		users:      NewUserStore(nil),
+		httpServer: &http.Server{Addr: addr},
+	}
+}
+
+// SetNotificationsManager sets the notifications manager, whose handlers are registered when set.
+func (s *Server) SetNotificationsManager(notificationsSvc *notifications.NotificationsManager) {
+	s.notifications = notificationsSvc
+}
+
+// SetAlertsManager sets the price alerts manager, whose handlers are registered when set.
+func (s *Server) SetAlertsManager(alertsSvc *alerts.Manager) {
+	s.alerts = alertsSvc
+}
+
+// SetAuditLog sets the audit log, whose handlers are registered when set.
+func (s *Server) SetAuditLog(auditLog *audit.Log) {
+	s.audit = auditLog
+}
+
+// SetVestingManager sets the vesting manager, whose handlers are registered when set.
+func (s *Server) SetVestingManager(vestingSvc *vesting.Manager) {
+	s.vesting = vestingSvc
+}
+
+// SetBackupService sets the backup service, whose handlers are registered when set.
+func (s *Server) SetBackupService(backupSvc *backup.Service) {
+	s.backup = backupSvc
+}
+
+// SetMetrics sets the metrics, which are served on /metrics along with the metrics of the requests when set.
+func (s *Server) SetMetrics(metrics *Metrics) {
+	s.metrics = metrics
+	if s.blotter != nil {
+		metrics.registerTradeCount(func() int { return len(s.blotter.GetTrades()) })
 	}
 }
 
+// SetUsersDatabase sets the database holding the users bucket, in addition to the API keys in config.
+func (s *Server) SetUsersDatabase(db dal.Database) {
+	s.users = NewUserStore(db)
+}
+
 // health check handler
 func upcheckHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/" || r.URL.Path == "/actuator/health" {
@@ -60,15 +117,64 @@ func (s *Server) Start(ctx context.Context) error {
 		mdata.RegisterHandlers(mux, s.portfolio.GetMdataManager())
 		rdata.RegisterHandlers(mux, s.portfolio.GetRdataManager())
 		dividends.RegisterHandlers(mux, s.portfolio.GetDividendsManager())
+		if s.blotter != nil {
+			grafana.RegisterHandlers(mux, grafana.NewService(s.portfolio.GetMdataManager(), s.blotter, s.portfolio))
+		}
+	}
+
+	if s.notifications != nil {
+		notifications.RegisterHandlers(mux, s.notifications)
 	}
 
+	if s.alerts != nil {
+		alerts.RegisterHandlers(mux, s.alerts)
+	}
+
+	if s.vesting != nil {
+		vesting.RegisterHandlers(mux, s.vesting)
+	}
+
+	if s.audit != nil {
+		audit.RegisterHandlers(mux, s.audit)
+	}
+
+	if s.backup != nil {
+		backup.RegisterHandlers(mux, s.backup)
+	}
+
+	registerUserHandlers(mux, s.users)
+
+	var notifier Notifier
+	if s.notifications != nil {
+		notifier = s.notifications
+	}
+	registerAdminHandlers(mux, s.audit, notifier)
+
 	// Swagger registration
 	mux.Handle("/swagger/", httpSwagger.WrapHandler)
 
-	// Wrap mux with loggingMiddleware
-	loggedMux := loggingMiddleware(mux, logger)
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics.Handler())
+	}
+
+	// Wrap mux with authMiddleware, then loggingMiddleware so rejected requests are logged too, then tag requests with
+	// their ID for the logs
+	var loggedMux http.Handler = requestIDMiddleware(loggingMiddleware(authMiddleware(mux, s.users)), logger)
+	if s.metrics != nil {
+		loggedMux = metricsMiddleware(loggedMux, mux, s.metrics)
+	}
 
 	logger.Info("Starting server on", fmt.Sprintf("http://%s", s.Addr))
 	logger.Info("Swagger UI available at", fmt.Sprintf("http://%s/swagger/index.html", s.Addr))
-	return http.ListenAndServe(s.Addr, loggedMux)
+	s.httpServer.Handler = loggedMux
+	if err := s.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for the requests in flight to finish, until ctx is done.
+// Start returns once the server is shut down.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
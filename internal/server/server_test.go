@@ -2,11 +2,16 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/dal"
 	"portfolio-manager/pkg/logging"
 	"portfolio-manager/pkg/types"
 )
@@ -70,3 +75,246 @@ func TestStart(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+// TestShutdown tests that Start returns without error once the server is shut down.
+func TestShutdown(t *testing.T) {
+	logger, err := logging.InitializeLogger(true, "")
+	if err != nil {
+		t.Fatalf("could not initialize logger: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), types.LoggerKey, logger)
+	srv := NewServer("127.0.0.1:0", nil, nil)
+
+	started := make(chan error, 1)
+	go func() {
+		started <- srv.Start(ctx)
+	}()
+
+	// Give the server a moment to start
+	<-time.After(time.Millisecond * 100)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("could not shut down server: %v", err)
+	}
+
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Errorf("Start returned an error after shutdown: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after shutdown")
+	}
+}
+
+// TestAuthMiddleware tests API key authentication of /api/v1 routes against config and database users.
+func TestAuthMiddleware(t *testing.T) {
+	config.SetConfig(&config.Config{
+		ApiKeys: map[string]types.User{
+			"admin-key": {Name: "admin", Admin: true},
+			"alice-key": {Name: "alice", Books: []string{"alice"}},
+		},
+	})
+	defer config.SetConfig(nil)
+
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("could not create db: %v", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db)
+	bobKey, err := store.AddUser(types.User{Name: "bob", Books: []string{"bob"}})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+	if _, err := store.AddUser(types.User{Name: "bob"}); err == nil {
+		t.Errorf("expected duplicate user to be rejected")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", upcheckHandler)
+	mux.HandleFunc("/api/v1/whoami", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, types.UserFromContext(r.Context()).Name)
+	})
+	registerUserHandlers(mux, store)
+	handler := authMiddleware(mux, store)
+
+	serve := func(method, path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		apiKey string
+		status int
+		body   string
+	}{
+		{"health check is open", http.MethodGet, "/", "", http.StatusOK, "I'm up!"},
+		{"missing key", http.MethodGet, "/api/v1/whoami", "", http.StatusUnauthorized, ""},
+		{"invalid key", http.MethodGet, "/api/v1/whoami", "wrong-key", http.StatusUnauthorized, ""},
+		{"config key", http.MethodGet, "/api/v1/whoami", "alice-key", http.StatusOK, "alice"},
+		{"database key", http.MethodGet, "/api/v1/whoami", bobKey, http.StatusOK, "bob"},
+		{"users are admin only", http.MethodGet, "/api/v1/users", "alice-key", http.StatusForbidden, ""},
+		{"admin lists users", http.MethodGet, "/api/v1/users", "admin-key", http.StatusOK, ""},
+		{"admin deletes user", http.MethodDelete, "/api/v1/users?name=bob", "admin-key", http.StatusNoContent, ""},
+		{"deleted key is revoked", http.MethodGet, "/api/v1/whoami", bobKey, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.method, tt.path, tt.apiKey)
+			if rr.Code != tt.status {
+				t.Errorf("got status %v want %v: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.body != "" && rr.Body.String() != tt.body {
+				t.Errorf("got body %q want %q", rr.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+// TestAuthMiddlewareDisabled tests requests are let through when no API keys are configured.
+func TestAuthMiddlewareDisabled(t *testing.T) {
+	config.SetConfig(&config.Config{})
+	defer config.SetConfig(nil)
+
+	handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if types.UserFromContext(r.Context()) != nil {
+			t.Errorf("expected no user when authentication is disabled")
+		}
+	}), NewUserStore(nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/positions", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+// TestAuthMiddlewareDatabaseUsers tests a user added while no API keys are configured enables authentication.
+func TestAuthMiddlewareDatabaseUsers(t *testing.T) {
+	config.SetConfig(&config.Config{})
+	defer config.SetConfig(nil)
+
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("could not create db: %v", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db)
+	handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), store)
+	serve := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/positions", nil)
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if status := serve(""); status != http.StatusOK {
+		t.Errorf("got status %v want %v before any user is added", status, http.StatusOK)
+	}
+
+	apiKey, err := store.AddUser(types.User{Name: "bob", Books: []string{"bob"}})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+	if status := serve(""); status != http.StatusUnauthorized {
+		t.Errorf("got status %v want %v without a key once a user is added", status, http.StatusUnauthorized)
+	}
+	if status := serve(apiKey); status != http.StatusOK {
+		t.Errorf("got status %v want %v with the user's key", status, http.StatusOK)
+	}
+	if !NewUserStore(db).Enabled() {
+		t.Error("expected authentication enabled on restart with users in the database")
+	}
+
+	if err := store.DeleteUser("bob"); err != nil {
+		t.Fatalf("could not delete user: %v", err)
+	}
+	if status := serve(""); status != http.StatusOK {
+		t.Errorf("got status %v want %v once the last user is deleted", status, http.StatusOK)
+	}
+}
+
+// TestMetrics tests that requests are recorded by route pattern and served in the Prometheus format.
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.registerTradeCount(func() int { return 3 })
+	metrics.ObserveFetch("yahoo", "price", time.Second, fmt.Errorf("rate limited"))
+	metrics.ObserveJob("backup", time.Second, nil)
+	metrics.ObserveDatabase("get", time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/blotter/trade/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "ERROR: trade not found", http.StatusNotFound)
+	})
+	mux.Handle("/metrics", metrics.Handler())
+	handler := metricsMiddleware(mux, mux, metrics)
+
+	for _, id := range []string{"a", "b"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/blotter/trade/"+id, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+
+	for _, expected := range []string{
+		`portfolio_http_request_duration_seconds_count{method="GET",route="/api/v1/blotter/trade/{id}",status="404"} 2`,
+		`portfolio_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+		`portfolio_marketdata_fetch_duration_seconds_count{operation="price",source="yahoo"} 1`,
+		`portfolio_marketdata_fetch_errors_total{operation="price",source="yahoo"} 1`,
+		`portfolio_scheduler_job_runs_total{job="backup",result="success"} 1`,
+		`portfolio_db_operation_duration_seconds_count{operation="get"} 1`,
+		`portfolio_blotter_trades 3`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("metrics missing %s", expected)
+		}
+	}
+}
+
+// TestRequestIDMiddleware tests that requests get a correlation ID, which handlers log with and which is echoed back.
+func TestRequestIDMiddleware(t *testing.T) {
+	logger, err := logging.InitializeLogger(true, "")
+	if err != nil {
+		t.Fatalf("could not initialize logger: %v", err)
+	}
+
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, logging.FromContext(r.Context()).RequestID())
+	}), logger)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	generated := rr.Header().Get(RequestIDHeader)
+	if generated == "" || rr.Body.String() != generated {
+		t.Errorf("expected the handler to log with the generated request ID %q, got %q", generated, rr.Body.String())
+	}
+
+	// IDs set upstream, e.g. by a proxy, are kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "upstream-id")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get(RequestIDHeader) != "upstream-id" || rr.Body.String() != "upstream-id" {
+		t.Errorf("expected the upstream request ID to be kept, got header %q body %q", rr.Header().Get(RequestIDHeader), rr.Body.String())
+	}
+}
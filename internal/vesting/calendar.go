@@ -0,0 +1,99 @@
+package vesting
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"portfolio-manager/pkg/types"
+)
+
+// CalendarEntry represents a vest within the calendar's date range.
+type CalendarEntry struct {
+	Date           string
+	GrantID        string
+	Ticker         string
+	Trader         string
+	Units          float64
+	Status         string
+	EstimatedValue float64 // units at the current price, or the trade price once pending
+}
+
+// VestingCalendar holds the vests within a date range, and tickers whose prices failed.
+type VestingCalendar struct {
+	Entries  []CalendarEntry
+	Warnings []string
+}
+
+// GetVestingCalendar returns the vests between from and to (inclusive) of the schedules the user may see, all
+// schedules when user is nil, sorted by date and valued at the current price of the ticker. Tickers whose prices
+// fail are reported as warnings.
+func (m *Manager) GetVestingCalendar(from, to time.Time, user *types.User) (*VestingCalendar, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("invalid date range: %s is before %s", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+
+	schedules, err := m.GetSchedulesForUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	fromStr := from.Format("2006-01-02")
+	toStr := to.Format("2006-01-02")
+	calendar := &VestingCalendar{Entries: []CalendarEntry{}}
+	prices := make(map[string]float64)
+	failed := make(map[string]struct{})
+
+	for _, schedule := range schedules {
+		for _, tranche := range schedule.Tranches {
+			if tranche.Date < fromStr || tranche.Date > toStr {
+				continue
+			}
+
+			entry := CalendarEntry{
+				Date:    tranche.Date,
+				GrantID: schedule.GrantID,
+				Ticker:  schedule.Ticker,
+				Trader:  schedule.Trader,
+				Units:   tranche.Units,
+				Status:  tranche.Status,
+			}
+			if tranche.Trade != nil {
+				entry.EstimatedValue = tranche.Units * tranche.Trade.Price
+			} else if price, err := m.currentPrice(schedule.Ticker, prices); err == nil {
+				entry.EstimatedValue = tranche.Units * price
+			} else if _, warned := failed[schedule.Ticker]; !warned {
+				failed[schedule.Ticker] = struct{}{}
+				calendar.Warnings = append(calendar.Warnings, fmt.Sprintf("%s: %v", schedule.Ticker, err))
+			}
+			calendar.Entries = append(calendar.Entries, entry)
+		}
+	}
+
+	sort.SliceStable(calendar.Entries, func(i, j int) bool {
+		if calendar.Entries[i].Date == calendar.Entries[j].Date {
+			return calendar.Entries[i].Ticker < calendar.Entries[j].Ticker
+		}
+		return calendar.Entries[i].Date < calendar.Entries[j].Date
+	})
+	sort.Strings(calendar.Warnings)
+
+	return calendar, nil
+}
+
+// currentPrice returns the current price of the ticker, memoized in prices.
+func (m *Manager) currentPrice(ticker string, prices map[string]float64) (float64, error) {
+	if price, ok := prices[ticker]; ok {
+		return price, nil
+	}
+	if m.mdata == nil {
+		return 0, fmt.Errorf("market data is not available")
+	}
+
+	data, err := m.mdata.GetAssetPrice(ticker)
+	if err != nil {
+		return 0, err
+	}
+	prices[ticker] = data.Price
+	return data.Price, nil
+}
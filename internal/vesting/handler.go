@@ -0,0 +1,337 @@
+package vesting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/pkg/types"
+)
+
+// ConfirmVestRequest confirms a pending vest, optionally overriding its price.
+type ConfirmVestRequest struct {
+	TradeID string  `json:"tradeId"`
+	Price   float64 `json:"price"` // Optional, defaults to the close of the vest date
+}
+
+// HandleSchedulesGet handles listing the vesting schedules.
+// @Summary Get vesting schedules
+// @Description Retrieve the employee stock plan vesting schedules in the books of the API key's user with the status of their tranches, ordered by grant date
+// @Tags vesting
+// @Produce json
+// @Success 200 {array} Schedule
+// @Failure 500 {string} string "Failed to get schedules"
+// @Router /api/v1/vesting/schedules [get]
+func HandleSchedulesGet(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schedules, err := manager.GetSchedulesForUser(types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedules)
+	}
+}
+
+// HandleSchedulePost handles adding a vesting schedule.
+// @Summary Add a vesting schedule
+// @Description Add the vesting schedule of a grant, whose tranches must add up to the total units. The grant ID is generated when empty.
+// @Tags vesting
+// @Accept json
+// @Produce json
+// @Param schedule body Schedule true "Vesting schedule"
+// @Success 201 {object} map[string]string
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/vesting/schedule [post]
+func HandleSchedulePost(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var schedule Schedule
+		if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if !blotter.AuthorizeBook(w, r, schedule.Trader) {
+			return
+		}
+
+		grantID, err := manager.AddSchedule(schedule)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"grantId": grantID})
+	}
+}
+
+// HandleScheduleGet handles retrieving the vesting schedule of a grant.
+// @Summary Get a vesting schedule
+// @Tags vesting
+// @Produce json
+// @Param grantId path string true "Grant ID"
+// @Success 200 {object} Schedule
+// @Failure 403 {string} string "Book not allowed"
+// @Failure 404 {string} string "Grant not found"
+// @Router /api/v1/vesting/schedule/{grantId} [get]
+func HandleScheduleGet(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schedule, ok := authorizedSchedule(w, r, manager)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+	}
+}
+
+// HandleSchedulePut handles replacing the vesting schedule of a grant.
+// @Summary Update a vesting schedule
+// @Description Replace the vesting schedule of a grant. Tranches which already vested must be kept unchanged.
+// @Tags vesting
+// @Accept json
+// @Produce json
+// @Param grantId path string true "Grant ID"
+// @Param schedule body Schedule true "Vesting schedule"
+// @Success 200 {object} Schedule
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Book not allowed"
+// @Failure 404 {string} string "Grant not found"
+// @Router /api/v1/vesting/schedule/{grantId} [put]
+func HandleSchedulePut(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var schedule Schedule
+		if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		schedule.GrantID = grantIDFromPath(r)
+
+		if _, ok := authorizedSchedule(w, r, manager); !ok || !blotter.AuthorizeBook(w, r, schedule.Trader) {
+			return
+		}
+
+		if err := manager.UpdateSchedule(schedule); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		updated, err := manager.GetSchedule(schedule.GrantID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+// HandleScheduleDelete handles deleting the vesting schedule of a grant.
+// @Summary Delete a vesting schedule
+// @Description Delete the vesting schedule of a grant, rejected once any of its vests is confirmed
+// @Tags vesting
+// @Param grantId path string true "Grant ID"
+// @Success 204
+// @Failure 400 {string} string "Grant has confirmed vests"
+// @Failure 403 {string} string "Book not allowed"
+// @Failure 404 {string} string "Grant not found"
+// @Router /api/v1/vesting/schedule/{grantId} [delete]
+func HandleScheduleDelete(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizedSchedule(w, r, manager); !ok {
+			return
+		}
+
+		if err := manager.DeleteSchedule(grantIDFromPath(r)); err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandlePendingGet handles listing the vests awaiting confirmation.
+// @Summary Get pending vests
+// @Description Retrieve the pending buy trades in the books of the API key's user created for vests whose date passed, priced at the close of the vest date
+// @Tags vesting
+// @Produce json
+// @Success 200 {array} blotter.Trade
+// @Failure 500 {string} string "Failed to get pending vests"
+// @Router /api/v1/vesting/pending [get]
+func HandlePendingGet(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trades, err := manager.GetPendingTrades()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blotter.FilterTradesForUser(trades, types.UserFromContext(r.Context())))
+	}
+}
+
+// HandleConfirmPost handles confirming a pending vest.
+// @Summary Confirm a pending vest
+// @Description Add a pending vest to the blotter as a buy with status vested, linked to its grant via GrantID, optionally overriding its price
+// @Tags vesting
+// @Accept json
+// @Produce json
+// @Param request body ConfirmVestRequest true "Confirm vest request"
+// @Success 201 {object} blotter.Trade
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Book not allowed"
+// @Router /api/v1/vesting/confirm [post]
+func HandleConfirmPost(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ConfirmVestRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "ERROR: Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		trade, err := manager.ConfirmVest(request.TradeID, request.Price, types.UserFromContext(r.Context()))
+		if errors.Is(err, blotter.ErrBookNotAllowed) {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(trade)
+	}
+}
+
+// HandleCalendarGet handles retrieving the vesting calendar.
+// @Summary Get the vesting calendar
+// @Description Get the vests in the books of the API key's user within a date range, valued at the current price until priced on the vest date
+// @Tags vesting
+// @Produce json
+// @Param from query string true "Start date (YYYYMMDD)"
+// @Param to query string true "End date (YYYYMMDD)"
+// @Success 200 {object} VestingCalendar
+// @Failure 400 {string} string "Invalid from or to date"
+// @Router /api/v1/vesting/calendar [get]
+func HandleCalendarGet(manager *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, err := time.Parse("20060102", r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "ERROR: invalid from date, expected YYYYMMDD", http.StatusBadRequest)
+			return
+		}
+
+		to, err := time.Parse("20060102", r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "ERROR: invalid to date, expected YYYYMMDD", http.StatusBadRequest)
+			return
+		}
+
+		calendar, err := manager.GetVestingCalendar(from, to, types.UserFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(calendar)
+	}
+}
+
+// authorizedSchedule returns the schedule of the grant in the path, rejecting the request when it is not found or
+// the user may not see its book.
+func authorizedSchedule(w http.ResponseWriter, r *http.Request, manager *Manager) (*Schedule, bool) {
+	schedule, err := manager.GetSchedule(grantIDFromPath(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ERROR: %s", err.Error()), http.StatusNotFound)
+		return nil, false
+	}
+	if !blotter.AuthorizeBook(w, r, schedule.Trader) {
+		return nil, false
+	}
+	return schedule, true
+}
+
+// grantIDFromPath returns the grant ID of /api/v1/vesting/schedule/{grantId}.
+func grantIDFromPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/api/v1/vesting/schedule/")
+}
+
+// RegisterHandlers registers the handlers for the vesting service.
+func RegisterHandlers(mux *http.ServeMux, manager *Manager) {
+	mux.HandleFunc("/api/v1/vesting/schedules", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleSchedulesGet(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/vesting/schedule", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleSchedulePost(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/vesting/schedule/", func(w http.ResponseWriter, r *http.Request) {
+		if grantIDFromPath(r) == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			HandleScheduleGet(manager).ServeHTTP(w, r)
+		case http.MethodPut:
+			HandleSchedulePut(manager).ServeHTTP(w, r)
+		case http.MethodDelete:
+			HandleScheduleDelete(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/vesting/pending", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandlePendingGet(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/vesting/confirm", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleConfirmPost(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/vesting/calendar", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleCalendarGet(manager).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
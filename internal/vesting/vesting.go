@@ -0,0 +1,451 @@
+package vesting
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/scheduler"
+	"portfolio-manager/pkg/types"
+
+	"github.com/google/uuid"
+)
+
+// Tranche statuses
+const (
+	TrancheUpcoming  = "upcoming"  // vest date not yet passed
+	TranchePending   = "pending"   // vested, with a pending trade awaiting confirmation of its price
+	TrancheConfirmed = "confirmed" // pending trade confirmed and added to the blotter
+)
+
+// closeLookback is how far back the closing price of a vest date is searched, covering weekends and holidays
+const closeLookback = 10 * 24 * time.Hour
+
+// Tranche is a single vest of a grant.
+type Tranche struct {
+	Date   string         `json:"date"`  // YYYY-MM-DD
+	Units  float64        `json:"units"` // units vesting on the date
+	Status string         `json:"status"`
+	Trade  *blotter.Trade `json:"trade,omitempty"` // pending or confirmed buy trade of the vest
+}
+
+// Schedule is the vesting schedule of an employee stock plan grant, e.g. RSUs vesting quarterly.
+type Schedule struct {
+	GrantID    string    `json:"grantId"` // generated when empty, stamped on the trades of the vests
+	GrantDate  string    `json:"grantDate"`
+	Ticker     string    `json:"ticker"`
+	TotalUnits float64   `json:"totalUnits"`
+	Tranches   []Tranche `json:"tranches"`
+	Trader     string    `json:"trader"` // book the units vest into
+	Broker     string    `json:"broker"`
+	Account    string    `json:"account"`
+}
+
+// Notifier posts notifications raised by background jobs, e.g. the notifications manager.
+type Notifier interface {
+	Notify(source, message string) error
+}
+
+// Manager persists vesting schedules and creates pending trades for their vests.
+type Manager struct {
+	db      dal.Database
+	blotter blotter.TradeAdder
+	mdata   blotter.MarketDataGetter
+	mu      sync.Mutex
+	logger  *logging.Logger
+}
+
+// NewManager creates a new vesting manager.
+func NewManager(db dal.Database, blotter blotter.TradeAdder, mdata blotter.MarketDataGetter) *Manager {
+	return &Manager{
+		db:      db,
+		blotter: blotter,
+		mdata:   mdata,
+		logger:  logging.GetLogger(),
+	}
+}
+
+// Validate checks the schedule is complete, and that its tranches vest on distinct dates from the grant date and
+// add up to the total units.
+func (s *Schedule) Validate() error {
+	if s.Ticker == "" || s.Trader == "" || s.Broker == "" || s.Account == "" {
+		return errors.New("ticker, trader, broker and account are required")
+	}
+	if _, err := time.Parse("2006-01-02", s.GrantDate); err != nil {
+		return fmt.Errorf("invalid grant date %s, expected YYYY-MM-DD", s.GrantDate)
+	}
+	if s.TotalUnits <= 0 {
+		return errors.New("total units must be positive")
+	}
+	if len(s.Tranches) == 0 {
+		return errors.New("at least one tranche is required")
+	}
+
+	dates := make(map[string]struct{}, len(s.Tranches))
+	units := 0.0
+	for _, tranche := range s.Tranches {
+		if _, err := time.Parse("2006-01-02", tranche.Date); err != nil {
+			return fmt.Errorf("invalid tranche date %s, expected YYYY-MM-DD", tranche.Date)
+		}
+		if tranche.Date < s.GrantDate {
+			return fmt.Errorf("tranche date %s is before the grant date %s", tranche.Date, s.GrantDate)
+		}
+		if _, exists := dates[tranche.Date]; exists {
+			return fmt.Errorf("duplicate tranche date %s", tranche.Date)
+		}
+		if tranche.Units <= 0 {
+			return fmt.Errorf("units of tranche %s must be positive", tranche.Date)
+		}
+		dates[tranche.Date] = struct{}{}
+		units += tranche.Units
+	}
+	if math.Abs(units-s.TotalUnits) > 1e-9 {
+		return fmt.Errorf("tranche units add up to %v, expected total units %v", units, s.TotalUnits)
+	}
+	return nil
+}
+
+// AddSchedule validates and adds a schedule, with all its tranches upcoming. The grant ID is returned.
+func (m *Manager) AddSchedule(schedule Schedule) (string, error) {
+	if err := schedule.Validate(); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if schedule.GrantID == "" {
+		schedule.GrantID = uuid.New().String()
+	}
+	if _, err := m.getSchedule(schedule.GrantID); err == nil {
+		return "", fmt.Errorf("grant %s already exists", schedule.GrantID)
+	}
+
+	for i := range schedule.Tranches {
+		schedule.Tranches[i].Status = TrancheUpcoming
+		schedule.Tranches[i].Trade = nil
+	}
+	sortTranches(&schedule)
+
+	if err := m.db.Put(scheduleKey(schedule.GrantID), schedule); err != nil {
+		return "", err
+	}
+	return schedule.GrantID, nil
+}
+
+// UpdateSchedule replaces the schedule of the grant. Tranches which already vested must be kept as they are, their
+// status and trade are carried over.
+func (m *Manager) UpdateSchedule(schedule Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.getSchedule(schedule.GrantID)
+	if err != nil {
+		return err
+	}
+
+	tranches := make(map[string]*Tranche, len(schedule.Tranches))
+	for i := range schedule.Tranches {
+		schedule.Tranches[i].Status = TrancheUpcoming
+		schedule.Tranches[i].Trade = nil
+		tranches[schedule.Tranches[i].Date] = &schedule.Tranches[i]
+	}
+	for _, vested := range existing.Tranches {
+		if vested.Status == TrancheUpcoming {
+			continue
+		}
+		tranche, exists := tranches[vested.Date]
+		if !exists || tranche.Units != vested.Units {
+			return fmt.Errorf("tranche %s already vested and cannot be changed", vested.Date)
+		}
+		*tranche = vested
+	}
+	if schedule.Ticker != existing.Ticker || schedule.Trader != existing.Trader {
+		for _, tranche := range existing.Tranches {
+			if tranche.Status != TrancheUpcoming {
+				return errors.New("ticker and trader cannot be changed once a tranche vested")
+			}
+		}
+	}
+	sortTranches(&schedule)
+
+	return m.db.Put(scheduleKey(schedule.GrantID), schedule)
+}
+
+// DeleteSchedule deletes the schedule of the grant, which is rejected once a tranche is confirmed, as its trade
+// links back to the grant.
+func (m *Manager) DeleteSchedule(grantID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, err := m.getSchedule(grantID)
+	if err != nil {
+		return err
+	}
+	for _, tranche := range schedule.Tranches {
+		if tranche.Status == TrancheConfirmed {
+			return fmt.Errorf("grant %s has confirmed vests and cannot be deleted", grantID)
+		}
+	}
+	return m.db.Delete(scheduleKey(grantID))
+}
+
+// GetSchedule returns the schedule of the grant.
+func (m *Manager) GetSchedule(grantID string) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getSchedule(grantID)
+}
+
+// GetSchedules returns all schedules, ordered by grant date.
+func (m *Manager) GetSchedules() ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getSchedules()
+}
+
+// GetSchedulesForUser returns the schedules in the books (traders) the user may see, all schedules when user is nil.
+func (m *Manager) GetSchedulesForUser(user *types.User) ([]Schedule, error) {
+	schedules, err := m.GetSchedules()
+	if err != nil || user == nil {
+		return schedules, err
+	}
+
+	visible := make([]Schedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		if user.CanSeeBook(schedule.Trader) {
+			visible = append(visible, schedule)
+		}
+	}
+	return visible, nil
+}
+
+// GetPendingTrades returns the trades of vests awaiting confirmation, ordered by vest date.
+func (m *Manager) GetPendingTrades() ([]blotter.Trade, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules, err := m.getSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	trades := []blotter.Trade{}
+	for _, schedule := range schedules {
+		for _, tranche := range schedule.Tranches {
+			if tranche.Status == TranchePending && tranche.Trade != nil {
+				trades = append(trades, *tranche.Trade)
+			}
+		}
+	}
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].TradeDate < trades[j].TradeDate
+	})
+	return trades, nil
+}
+
+// ProcessVests creates a pending buy trade for each upcoming tranche vesting on or before asOf, at the close of the
+// vest date. When the close is unavailable the price is left at zero, to be filled in on confirmation. Running it
+// again creates nothing further. The pending trades are returned.
+func (m *Manager) ProcessVests(asOf time.Time) ([]blotter.Trade, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules, err := m.getSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	asOfStr := asOf.Format("2006-01-02")
+	db := audit.WithSource(m.db, audit.SourceScheduler)
+	var pending []blotter.Trade
+	var errs []error
+	for _, schedule := range schedules {
+		vested := false
+		for i := range schedule.Tranches {
+			tranche := &schedule.Tranches[i]
+			if tranche.Status != TrancheUpcoming || tranche.Date > asOfStr {
+				continue
+			}
+
+			vestDate, _ := time.Parse("2006-01-02", tranche.Date)
+			price, err := m.closeOn(schedule.Ticker, vestDate)
+			if err != nil {
+				m.logger.Warnf("Unable to price vest of grant %s on %s, confirm it with a price: %v", schedule.GrantID, tranche.Date, err)
+			}
+
+			// built directly rather than via blotter.NewTrade, as the price may be unknown until confirmed
+			trade := &blotter.Trade{
+				TradeID:   uuid.New().String(),
+				TradeDate: vestDate.Format(time.RFC3339),
+				Ticker:    schedule.Ticker,
+				Side:      blotter.TradeSideBuy,
+				Quantity:  tranche.Units,
+				Price:     price,
+				Trader:    schedule.Trader,
+				Broker:    schedule.Broker,
+				Account:   schedule.Account,
+				Status:    blotter.TradeStatusPending,
+				GrantID:   schedule.GrantID,
+			}
+
+			tranche.Status = TranchePending
+			tranche.Trade = trade
+			pending = append(pending, *trade)
+			vested = true
+		}
+
+		if vested {
+			if err := db.Put(scheduleKey(schedule.GrantID), schedule); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return pending, errors.Join(errs...)
+}
+
+// ConfirmVest adds the pending trade to the blotter as a vested buy on behalf of the user, optionally overriding its
+// price. The confirmed trade is returned.
+func (m *Manager) ConfirmVest(tradeID string, price float64, user *types.User) (*blotter.Trade, error) {
+	if price < 0 {
+		return nil, errors.New("price must not be negative")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules, err := m.getSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schedule := range schedules {
+		for i := range schedule.Tranches {
+			tranche := &schedule.Tranches[i]
+			if tranche.Trade == nil || tranche.Trade.TradeID != tradeID {
+				continue
+			}
+			if tranche.Status != TranchePending {
+				return nil, fmt.Errorf("vest %s is already %s", tradeID, tranche.Status)
+			}
+
+			trade := *tranche.Trade
+			if price > 0 {
+				trade.Price = price
+			}
+			if trade.Price <= 0 {
+				return nil, fmt.Errorf("vest %s has no closing price, confirm it with a price", tradeID)
+			}
+			trade.Status = blotter.TradeStatusVested
+			if err := blotter.AuthorizeTrades([]*blotter.Trade{&trade}, user); err != nil {
+				return nil, err
+			}
+			if err := m.blotter.AddTrade(trade); err != nil {
+				return nil, fmt.Errorf("failed to add vest %s to the blotter: %w", tradeID, err)
+			}
+
+			tranche.Status = TrancheConfirmed
+			tranche.Trade = &trade
+			if err := m.db.Put(scheduleKey(schedule.GrantID), schedule); err != nil {
+				return nil, err
+			}
+			return &trade, nil
+		}
+	}
+
+	return nil, fmt.Errorf("pending vest %s not found", tradeID)
+}
+
+// StartVestingSchedule processes vests hourly until the scheduler is stopped, posting a summary of the pending
+// trades to the notifier, which may be nil.
+func (m *Manager) StartVestingSchedule(sched *scheduler.Scheduler, notifier Notifier) {
+	sched.Every("vesting", time.Hour, func() error { return m.runScheduledVests(time.Now(), notifier) })
+}
+
+// runScheduledVests processes the vests due by now, posting a summary of the pending trades to the notifier. It
+// returns the error of processing the vests.
+func (m *Manager) runScheduledVests(now time.Time, notifier Notifier) error {
+	pending, err := m.ProcessVests(now)
+	if err != nil {
+		m.logger.Errorf("Scheduled vesting failed: %v", err)
+	}
+	if len(pending) == 0 || notifier == nil {
+		return err
+	}
+
+	var summary []string
+	for _, trade := range pending {
+		summary = append(summary, fmt.Sprintf("%v %s into %s at %v, tradeID: %s", trade.Quantity, trade.Ticker, trade.Trader, trade.Price, trade.TradeID))
+	}
+	message := fmt.Sprintf("%d vest(s) awaiting confirmation: %s", len(pending), strings.Join(summary, ", "))
+	if err := notifier.Notify("vesting", message); err != nil {
+		m.logger.Warnf("Failed to post vesting notification: %v", err)
+	}
+	return err
+}
+
+// closeOn returns the last close of the ticker on or before the date.
+func (m *Manager) closeOn(ticker string, date time.Time) (float64, error) {
+	if m.mdata == nil {
+		return 0, errors.New("market data is not available")
+	}
+
+	to := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 0, time.UTC)
+	history, err := m.mdata.GetHistoricalData(ticker, to.Add(-closeLookback).Unix(), to.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get historical prices of %s: %w", ticker, err)
+	}
+
+	var last *types.AssetData
+	for _, data := range history {
+		if data.Timestamp <= to.Unix() && (last == nil || data.Timestamp > last.Timestamp) {
+			last = data
+		}
+	}
+	if last == nil {
+		return 0, fmt.Errorf("no close of %s on or before %s", ticker, date.Format("2006-01-02"))
+	}
+	return last.Price, nil
+}
+
+func (m *Manager) getSchedule(grantID string) (*Schedule, error) {
+	var schedule Schedule
+	if err := m.db.Get(scheduleKey(grantID), &schedule); err != nil {
+		return nil, fmt.Errorf("grant %s not found", grantID)
+	}
+	return &schedule, nil
+}
+
+func (m *Manager) getSchedules() ([]Schedule, error) {
+	schedules, err := dal.ParallelLoad[Schedule](m.db, string(types.VestingKeyPrefix)+":")
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(schedules, func(i, j int) bool {
+		return schedules[i].GrantDate < schedules[j].GrantDate
+	})
+	return schedules, nil
+}
+
+func sortTranches(schedule *Schedule) {
+	sort.Slice(schedule.Tranches, func(i, j int) bool {
+		return schedule.Tranches[i].Date < schedule.Tranches[j].Date
+	})
+}
+
+func scheduleKey(grantID string) string {
+	return fmt.Sprintf("%s:%s", types.VestingKeyPrefix, grantID)
+}
@@ -0,0 +1,213 @@
+package vesting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/blotter"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager(t *testing.T) (*Manager, *blotter.TradeBlotter, *mocks.MockMarketDataManager) {
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	mdataMgr := mocks.NewMockMarketDataManager()
+	blotterSvc := blotter.NewBlotter(db)
+	return NewManager(db, blotterSvc, mdataMgr), blotterSvc, mdataMgr
+}
+
+func quarterlySchedule() Schedule {
+	return Schedule{
+		GrantID:    "grant-1",
+		GrantDate:  "2024-01-15",
+		Ticker:     "AAPL",
+		TotalUnits: 40,
+		Tranches: []Tranche{
+			{Date: "2024-07-15", Units: 10},
+			{Date: "2024-04-15", Units: 10},
+			{Date: "2024-10-15", Units: 10},
+			{Date: "2025-01-15", Units: 10},
+		},
+		Trader:  "traderA",
+		Broker:  "schwab",
+		Account: "espp",
+	}
+}
+
+func unixAt(date string) int64 {
+	t, _ := time.Parse("2006-01-02", date)
+	return t.Add(21 * time.Hour).Unix()
+}
+
+func TestScheduleValidation(t *testing.T) {
+	manager, _, _ := newTestManager(t)
+
+	schedule := quarterlySchedule()
+	schedule.TotalUnits = 50
+	_, err := manager.AddSchedule(schedule)
+	assert.ErrorContains(t, err, "add up to 40")
+
+	schedule = quarterlySchedule()
+	schedule.Tranches[0].Date = "2023-12-31"
+	_, err = manager.AddSchedule(schedule)
+	assert.ErrorContains(t, err, "before the grant date")
+
+	grantID, err := manager.AddSchedule(quarterlySchedule())
+	require.NoError(t, err)
+	assert.Equal(t, "grant-1", grantID)
+
+	_, err = manager.AddSchedule(quarterlySchedule())
+	assert.ErrorContains(t, err, "already exists")
+
+	stored, err := manager.GetSchedule("grant-1")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-04-15", stored.Tranches[0].Date) // sorted by date
+	assert.Equal(t, TrancheUpcoming, stored.Tranches[0].Status)
+}
+
+func TestProcessAndConfirmVests(t *testing.T) {
+	manager, blotterSvc, mdataMgr := newTestManager(t)
+	mdataMgr.HistoricalData["AAPL"] = []*types.AssetData{
+		{Ticker: "AAPL", Price: 168, Timestamp: unixAt("2024-04-12")},
+		{Ticker: "AAPL", Price: 172.5, Timestamp: unixAt("2024-04-15")},
+		{Ticker: "AAPL", Price: 175, Timestamp: unixAt("2024-04-16")},
+	}
+
+	_, err := manager.AddSchedule(quarterlySchedule())
+	require.NoError(t, err)
+
+	// only the tranche whose date passed vests, at that day's close
+	pending, err := manager.ProcessVests(time.Date(2024, 4, 16, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, 10.0, pending[0].Quantity)
+	assert.Equal(t, 172.5, pending[0].Price)
+	assert.Equal(t, blotter.TradeStatusPending, pending[0].Status)
+	assert.Equal(t, "grant-1", pending[0].GrantID)
+	assert.Empty(t, blotterSvc.GetTrades(), "pending vests are not in the blotter")
+
+	// processing again creates nothing further
+	again, err := manager.ProcessVests(time.Date(2024, 4, 17, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	pendingTrades, err := manager.GetPendingTrades()
+	require.NoError(t, err)
+	assert.Len(t, pendingTrades, 1)
+
+	// confirming with an edited price adds the vest to the blotter, linked to the grant
+	_, err = manager.ConfirmVest(pending[0].TradeID, 173, &types.User{Name: "bob", Books: []string{"traderB"}})
+	assert.ErrorIs(t, err, blotter.ErrBookNotAllowed)
+
+	confirmed, err := manager.ConfirmVest(pending[0].TradeID, 173, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 173.0, confirmed.Price)
+	assert.Equal(t, blotter.TradeStatusVested, confirmed.Status)
+
+	trade, err := blotterSvc.GetTradeByID(pending[0].TradeID)
+	require.NoError(t, err)
+	assert.Equal(t, "grant-1", trade.GrantID)
+
+	_, err = manager.ConfirmVest(pending[0].TradeID, 0, nil)
+	assert.ErrorContains(t, err, "already confirmed")
+
+	// confirmed tranches cannot be changed nor the grant deleted
+	schedule := quarterlySchedule()
+	schedule.Tranches[1].Units = 5
+	schedule.Tranches[2].Units = 15
+	assert.ErrorContains(t, manager.UpdateSchedule(schedule), "already vested")
+	assert.ErrorContains(t, manager.DeleteSchedule("grant-1"), "confirmed vests")
+}
+
+func TestConfirmVestWithoutClose(t *testing.T) {
+	manager, _, _ := newTestManager(t)
+	_, err := manager.AddSchedule(quarterlySchedule())
+	require.NoError(t, err)
+
+	pending, err := manager.ProcessVests(time.Date(2024, 4, 16, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Zero(t, pending[0].Price)
+
+	_, err = manager.ConfirmVest(pending[0].TradeID, 0, nil)
+	assert.ErrorContains(t, err, "confirm it with a price")
+
+	confirmed, err := manager.ConfirmVest(pending[0].TradeID, 170, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 170.0, confirmed.Price)
+}
+
+func TestVestingCalendar(t *testing.T) {
+	manager, _, mdataMgr := newTestManager(t)
+	mdataMgr.AssetPriceData["AAPL"] = &types.AssetData{Ticker: "AAPL", Price: 200}
+
+	_, err := manager.AddSchedule(quarterlySchedule())
+	require.NoError(t, err)
+
+	calendar, err := manager.GetVestingCalendar(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), nil)
+	require.NoError(t, err)
+	require.Len(t, calendar.Entries, 2)
+	assert.Equal(t, "2024-07-15", calendar.Entries[0].Date)
+	assert.Equal(t, TrancheUpcoming, calendar.Entries[0].Status)
+	assert.Equal(t, 2000.0, calendar.Entries[0].EstimatedValue)
+	assert.Empty(t, calendar.Warnings)
+}
+
+func TestHandlersScopeSchedulesToUserBooks(t *testing.T) {
+	manager, _, _ := newTestManager(t)
+	_, err := manager.AddSchedule(quarterlySchedule())
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, manager)
+	serve := func(method, path, body string, user *types.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), types.UserKey, user))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	owner := &types.User{Name: "alice", Books: []string{"traderA"}}
+	other := &types.User{Name: "bob", Books: []string{"traderB"}}
+
+	rr := serve(http.MethodGet, "/api/v1/vesting/schedules", "", owner)
+	var schedules []Schedule
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schedules))
+	assert.Len(t, schedules, 1)
+
+	rr = serve(http.MethodGet, "/api/v1/vesting/schedules", "", other)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schedules))
+	assert.Empty(t, schedules)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/vesting/schedule/grant-1", "", owner).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/vesting/schedule/grant-1", "", other).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "/api/v1/vesting/schedule/grant-1", "", other).Code)
+
+	// schedules can neither be added to nor moved into books the user may not see
+	schedule := quarterlySchedule()
+	schedule.GrantID = "grant-2"
+	schedule.Trader = "traderB"
+	body, err := json.Marshal(schedule)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/api/v1/vesting/schedule", string(body), owner).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/v1/vesting/schedule/grant-1", string(body), owner).Code)
+
+	rr = serve(http.MethodGet, "/api/v1/vesting/calendar?from=20240101&to=20251231", "", other)
+	var calendar VestingCalendar
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &calendar))
+	assert.Empty(t, calendar.Entries)
+}
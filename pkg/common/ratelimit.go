@@ -0,0 +1,77 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out calls to an external API by a minimum interval.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing one call per interval.
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval}
+}
+
+// Wait blocks until the next call is allowed.
+func (r *RateLimiter) Wait() {
+	r.mu.Lock()
+	now := time.Now()
+	wait := r.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	r.next = now.Add(wait + r.interval)
+	r.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+var (
+	rateLimitersMu     sync.Mutex
+	rateLimiters       = make(map[string]*RateLimiter)
+	rateLimitIntervals = make(map[string]time.Duration)
+)
+
+// SetRateLimitIntervals overrides the rate limit intervals of the given sources, e.g. from config. Limiters which
+// already exist are updated in place.
+func SetRateLimitIntervals(intervals map[string]time.Duration) {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	for source, interval := range intervals {
+		rateLimitIntervals[source] = interval
+		if limiter, ok := rateLimiters[source]; ok {
+			limiter.setInterval(interval)
+		}
+	}
+}
+
+// GetRateLimiter returns the rate limiter of the source, shared by all its callers. It is created with the
+// configured interval of the source, or else defaultInterval. Different sources never wait on each other.
+func GetRateLimiter(source string, defaultInterval time.Duration) *RateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	if limiter, ok := rateLimiters[source]; ok {
+		return limiter
+	}
+
+	interval := defaultInterval
+	if configured, ok := rateLimitIntervals[source]; ok {
+		interval = configured
+	}
+	limiter := NewRateLimiter(interval)
+	rateLimiters[source] = limiter
+	return limiter
+}
+
+func (r *RateLimiter) setInterval(interval time.Duration) {
+	r.mu.Lock()
+	r.interval = interval
+	r.mu.Unlock()
+}
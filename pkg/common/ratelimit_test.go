@@ -0,0 +1,67 @@
+package common
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterSpacesCalls(t *testing.T) {
+	limiter := NewRateLimiter(50 * time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.Wait()
+	}
+
+	// first call is immediate, the next two wait one interval each
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestGetRateLimiterIsSharedPerSource(t *testing.T) {
+	a := GetRateLimiter("test-shared", time.Second)
+	b := GetRateLimiter("test-shared", time.Minute)
+	c := GetRateLimiter("test-other", time.Second)
+
+	assert.Same(t, a, b)
+	assert.NotSame(t, a, c)
+	assert.Equal(t, time.Second, a.interval)
+}
+
+func TestSetRateLimitIntervals(t *testing.T) {
+	existing := GetRateLimiter("test-existing", time.Second)
+	SetRateLimitIntervals(map[string]time.Duration{
+		"test-existing":   10 * time.Millisecond,
+		"test-configured": 20 * time.Millisecond,
+	})
+
+	assert.Equal(t, 10*time.Millisecond, existing.interval)
+	assert.Equal(t, 20*time.Millisecond, GetRateLimiter("test-configured", time.Second).interval)
+}
+
+func TestRateLimitersOfDifferentSourcesDoNotSerialize(t *testing.T) {
+	interval := 100 * time.Millisecond
+	sources := []string{"test-concurrent-a", "test-concurrent-b", "test-concurrent-c"}
+	callsPerSource := 3
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		limiter := GetRateLimiter(source, interval)
+		for i := 0; i < callsPerSource; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				limiter.Wait()
+			}()
+		}
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// each source needs (callsPerSource - 1) intervals, a single shared limiter would need 8
+	assert.GreaterOrEqual(t, elapsed, time.Duration(callsPerSource-1)*interval)
+	assert.Less(t, elapsed, time.Duration(len(sources)*callsPerSource-1)*interval/2)
+}
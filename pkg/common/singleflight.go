@@ -0,0 +1,54 @@
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FlightGroup dedupes concurrent calls with the same key, so they share the result of a single call.
+type FlightGroup[T any] struct {
+	mu      sync.Mutex
+	calls   map[string]*flightCall[T]
+	deduped atomic.Int64
+}
+
+type flightCall[T any] struct {
+	wg  sync.WaitGroup
+	val T
+	err error
+}
+
+// Do executes fn for the key, unless a call for the same key is already in flight, in which case it waits for
+// that call and returns its result. shared reports whether the result came from another caller's call.
+func (g *FlightGroup[T]) Do(key string, fn func() (T, error)) (val T, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[T])
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		g.deduped.Add(1)
+		call.wg.Wait()
+		return call.val, call.err, true
+	}
+
+	call := &flightCall[T]{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.val, call.err = fn()
+	return call.val, call.err, false
+}
+
+// Deduped returns the number of calls which shared the result of an in-flight call.
+func (g *FlightGroup[T]) Deduped() int64 {
+	return g.deduped.Load()
+}
@@ -0,0 +1,16 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, Levenshtein("D05.SI", "D05.SI"))
+	assert.Equal(t, 1, Levenshtein("DO5.SI", "D05.SI"))
+	assert.Equal(t, 1, Levenshtein("APPL", "AAPL"))
+	assert.Equal(t, 2, Levenshtein("ES3", "E3S"))
+	assert.Equal(t, 3, Levenshtein("", "ES3"))
+	assert.Equal(t, 3, Levenshtein("kitten", "sitting"))
+}
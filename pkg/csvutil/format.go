@@ -0,0 +1,158 @@
+package csvutil
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Supported format profiles
+const (
+	ProfileDefault = "default"
+	ProfileEU      = "eu"
+)
+
+// FormatOptions controls how dates and numbers are written to and read from CSV files.
+type FormatOptions struct {
+	DateFormat       string // Go time layout, dates are written as-is when empty
+	DecimalSeparator string // "." or ","
+	Delimiter        rune   // field delimiter
+}
+
+// DefaultFormat keeps RFC3339 dates, dot decimals and comma delimited fields.
+var DefaultFormat = FormatOptions{
+	DateFormat:       "",
+	DecimalSeparator: ".",
+	Delimiter:        ',',
+}
+
+// EUFormat uses DD/MM/YYYY dates, comma decimals and semicolon delimited fields.
+var EUFormat = FormatOptions{
+	DateFormat:       "02/01/2006",
+	DecimalSeparator: ",",
+	Delimiter:        ';',
+}
+
+// ParseFormatOptions builds the format options from the query parameters of an export or import request.
+// A profile (default, eu) can be selected and individually overridden with dateFormat (e.g. DD/MM/YYYY),
+// decimalSeparator and delimiter.
+func ParseFormatOptions(query url.Values) (FormatOptions, error) {
+	opts := DefaultFormat
+	switch strings.ToLower(query.Get("profile")) {
+	case "", ProfileDefault:
+	case ProfileEU:
+		opts = EUFormat
+	default:
+		return opts, fmt.Errorf("unsupported format profile: %s", query.Get("profile"))
+	}
+
+	if dateFormat := query.Get("dateFormat"); dateFormat != "" {
+		opts.DateFormat = ToGoLayout(dateFormat)
+	}
+
+	if sep := query.Get("decimalSeparator"); sep != "" {
+		if sep != "." && sep != "," {
+			return opts, fmt.Errorf("unsupported decimal separator: %s", sep)
+		}
+		opts.DecimalSeparator = sep
+	}
+
+	if delimiter := query.Get("delimiter"); delimiter != "" {
+		if delimiter == "\\t" || strings.EqualFold(delimiter, "tab") {
+			delimiter = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) {
+			return opts, fmt.Errorf("delimiter must be a single character: %s", delimiter)
+		}
+		opts.Delimiter = r
+	}
+
+	if opts.Delimiter == ',' && opts.DecimalSeparator == "," {
+		return opts, fmt.Errorf("delimiter and decimal separator cannot both be ','")
+	}
+
+	return opts, nil
+}
+
+// ToGoLayout converts a human readable date format, e.g. DD/MM/YYYY, into a Go time layout.
+func ToGoLayout(format string) string {
+	return strings.NewReplacer(
+		"YYYY", "2006",
+		"YY", "06",
+		"MM", "01",
+		"DD", "02",
+		"hh", "15",
+		"mm", "04",
+		"ss", "05",
+	).Replace(format)
+}
+
+// NewWriter returns a CSV writer using the configured delimiter.
+func (f FormatOptions) NewWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = f.Delimiter
+	return writer
+}
+
+// NewReader returns a CSV reader using the configured delimiter.
+func (f FormatOptions) NewReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = f.Delimiter
+	return reader
+}
+
+// FormatFloat formats a number with the configured decimal separator.
+func (f FormatOptions) FormatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if f.DecimalSeparator == "," {
+		s = strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
+
+// ParseFloat parses a number written with the configured decimal separator.
+func (f FormatOptions) ParseFloat(s string) (float64, error) {
+	if f.DecimalSeparator == "," {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// FormatDate formats an RFC3339 or yyyy-mm-dd date string with the configured date format.
+func (f FormatOptions) FormatDate(date string) (string, error) {
+	if f.DateFormat == "" {
+		return date, nil
+	}
+
+	t, err := parseStoredDate(date)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(f.DateFormat), nil
+}
+
+// ParseDate parses a date written with the configured date format, defaulting to RFC3339.
+func (f FormatOptions) ParseDate(date string) (time.Time, error) {
+	if f.DateFormat == "" {
+		return time.Parse(time.RFC3339, date)
+	}
+	return time.Parse(f.DateFormat, date)
+}
+
+// parseStoredDate parses dates as stored within the application, either RFC3339 or yyyy-mm-dd.
+func parseStoredDate(date string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse date: %w", err)
+	}
+	return t, nil
+}
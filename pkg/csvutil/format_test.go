@@ -0,0 +1,52 @@
+package csvutil
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormatOptions(t *testing.T) {
+	opts, err := ParseFormatOptions(url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultFormat, opts)
+
+	opts, err = ParseFormatOptions(url.Values{"profile": {"eu"}})
+	assert.NoError(t, err)
+	assert.Equal(t, EUFormat, opts)
+
+	opts, err = ParseFormatOptions(url.Values{"dateFormat": {"YYYY/MM/DD"}, "delimiter": {"tab"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "2006/01/02", opts.DateFormat)
+	assert.Equal(t, '\t', opts.Delimiter)
+
+	_, err = ParseFormatOptions(url.Values{"decimalSeparator": {","}})
+	assert.Error(t, err, "comma decimals clash with the default comma delimiter")
+
+	_, err = ParseFormatOptions(url.Values{"profile": {"jp"}})
+	assert.Error(t, err)
+}
+
+func TestEUFormatRoundTrip(t *testing.T) {
+	s := EUFormat.FormatFloat(1234.56)
+	assert.Equal(t, "1234,56", s)
+	v, err := EUFormat.ParseFloat(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 1234.56, v)
+
+	date, err := EUFormat.FormatDate("2024-03-15T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, "15/03/2024", date)
+	parsed, err := EUFormat.ParseDate(date)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), parsed)
+}
+
+func TestDefaultFormatKeepsDates(t *testing.T) {
+	date, err := DefaultFormat.FormatDate("2023-10-12T07:20:50Z")
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-10-12T07:20:50Z", date)
+	assert.Equal(t, "186.53", DefaultFormat.FormatFloat(186.53))
+}
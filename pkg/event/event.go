@@ -1,6 +1,7 @@
 package event
 
 import (
+	"context"
 	"sync"
 
 	"github.com/google/uuid"
@@ -8,6 +9,7 @@ import (
 
 // Event represents an event with a name and data.
 type Event struct {
+	Ctx  context.Context // context of the change which raised the event, e.g. of the request, may be nil
 	Name string
 	Data interface{}
 }
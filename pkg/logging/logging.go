@@ -1,23 +1,51 @@
 package logging
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"portfolio-manager/pkg/types"
+)
+
+// Supported log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
 )
 
 type Logger struct {
-	verbose bool
-	logFile *os.File
+	verbose   *atomic.Bool // shared with the loggers derived from it, nil when not verbose
+	logFile   *os.File
+	format    string
+	requestID string // set on the loggers of requests, see WithRequestID
 }
 
 var (
 	instance *Logger
 	once     sync.Once
+	jsonMu   sync.Mutex // serializes JSON lines, text lines go through the log package which does so itself
 )
 
+// jsonLine is a log line in the JSON format.
+type jsonLine struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Caller    string `json:"caller"`
+	Msg       string `json:"msg"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
 // InitializeLogger initializes the logger with the specified log level and log file path
 func InitializeLogger(verboseLogging bool, logFilePath string) (*Logger, error) {
 	var err error
@@ -25,8 +53,10 @@ func InitializeLogger(verboseLogging bool, logFilePath string) (*Logger, error)
 		log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
 		instance = &Logger{
-			verbose: verboseLogging,
+			verbose: new(atomic.Bool),
+			format:  FormatText,
 		}
+		instance.verbose.Store(verboseLogging)
 
 		if logFilePath != "" {
 			// Open the log file for writing
@@ -56,53 +86,133 @@ func GetLogger() *Logger {
 	return instance
 }
 
+// SetFormat sets the format of the log lines, text or json, the loggers of requests take the format of the logger
+// they derive from.
+func (l *Logger) SetFormat(format string) error {
+	switch format {
+	case "", FormatText:
+		l.format = FormatText
+	case FormatJSON:
+		l.format = FormatJSON
+	default:
+		return errors.New("invalid log format: must be 'text' or 'json'")
+	}
+	return nil
+}
+
+// SetVerbose turns debug logging on or off, also for the loggers derived from the logger.
+func (l *Logger) SetVerbose(verbose bool) {
+	if l.verbose == nil {
+		l.verbose = new(atomic.Bool)
+	}
+	l.verbose.Store(verbose)
+}
+
+// isVerbose returns whether debug messages are logged.
+func (l *Logger) isVerbose() bool {
+	return l.verbose != nil && l.verbose.Load()
+}
+
+// WithRequestID returns a logger which tags its lines with the ID of the request.
+func (l *Logger) WithRequestID(requestID string) *Logger {
+	derived := *l
+	derived.requestID = requestID
+	return &derived
+}
+
+// RequestID returns the ID of the request the logger tags its lines with, empty when not logging for a request.
+func (l *Logger) RequestID() string {
+	return l.requestID
+}
+
+// FromContext returns the logger of the context, e.g. tagged with the ID of the request, or the singleton logger.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(types.LoggerKey).(*Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return GetLogger()
+}
+
+// output writes a line of the level, calldepth counting from the caller of output like log.Output.
+func (l *Logger) output(calldepth int, level, msg string) {
+	msg = strings.TrimSuffix(msg, "\n")
+	if l.format != FormatJSON {
+		if l.requestID != "" {
+			msg = fmt.Sprintf("request_id=%s %s", l.requestID, msg)
+		}
+		log.Output(calldepth+1, fmt.Sprintf("%s: %s", level, msg))
+		return
+	}
+
+	caller := "???"
+	if _, file, line, ok := runtime.Caller(calldepth); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	b, err := json.Marshal(jsonLine{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     level,
+		Caller:    caller,
+		Msg:       msg,
+		RequestID: l.requestID,
+	})
+	if err != nil {
+		return
+	}
+
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	log.Writer().Write(append(b, '\n'))
+}
+
 // Debug logs a debug message
 func (l *Logger) Debug(v ...interface{}) {
-	if l.verbose {
-		log.Output(2, fmt.Sprintf("DEBUG: %s", fmt.Sprintln(v...)))
+	if l.isVerbose() {
+		l.output(2, "DEBUG", fmt.Sprintln(v...))
 	}
 }
 
 // Debugf logs a debug message with formatting
 func (l *Logger) Debugf(format string, v ...interface{}) {
-	if l.verbose {
-		log.Output(2, fmt.Sprintf("DEBUG: "+format, v...))
+	if l.isVerbose() {
+		l.output(2, "DEBUG", fmt.Sprintf(format, v...))
 	}
 }
 
 // Info logs an info message
 func (l *Logger) Info(v ...interface{}) {
-	log.Output(2, fmt.Sprintf("INFO: %s", fmt.Sprintln(v...)))
+	l.output(2, "INFO", fmt.Sprintln(v...))
 }
 
 // Infof logs an info message with formatting
 func (l *Logger) Infof(format string, v ...interface{}) {
-	log.Output(2, fmt.Sprintf("INFO: "+format, v...))
+	l.output(2, "INFO", fmt.Sprintf(format, v...))
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(v ...interface{}) {
-	log.Output(2, fmt.Sprintf("WARN: %s", fmt.Sprintln(v...)))
+	l.output(2, "WARN", fmt.Sprintln(v...))
 }
 
 // Warnf logs a warning message with formatting
 func (l *Logger) Warnf(format string, v ...interface{}) {
-	log.Output(2, fmt.Sprintf("WARN: "+format, v...))
+	l.output(2, "WARN", fmt.Sprintf(format, v...))
 }
 
 // Error logs an error message
 func (l *Logger) Error(v ...interface{}) {
-	log.Output(2, fmt.Sprintf("ERROR: %s", fmt.Sprintln(v...)))
+	l.output(2, "ERROR", fmt.Sprintln(v...))
 }
 
 // Errorf logs an error message with formatting
 func (l *Logger) Errorf(format string, v ...interface{}) {
-	log.Output(2, fmt.Sprintf("ERROR: "+format, v...))
+	l.output(2, "ERROR", fmt.Sprintf(format, v...))
 }
 
 // Fatalf logs a fatal error message and exits the application
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-	log.Output(2, fmt.Sprintf("FATAL: "+format, v...))
+	l.output(2, "FATAL", fmt.Sprintf(format, v...))
 	os.Exit(1)
 }
 
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureOutput redirects the log output to a buffer for the duration of the test.
+func captureOutput(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	writer, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf := captureOutput(t)
+
+	logger := &Logger{}
+	require.NoError(t, logger.SetFormat(FormatJSON))
+	logger.WithRequestID("req-1").Infof("Added trade %s", "abc")
+	logger.Warn("Stale price", "C31")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var line jsonLine
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "INFO", line.Level)
+	assert.Equal(t, "Added trade abc", line.Msg)
+	assert.Equal(t, "req-1", line.RequestID)
+	assert.True(t, strings.HasPrefix(line.Caller, "logging_test.go:"), line.Caller)
+	assert.NotEmpty(t, line.Time)
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, "WARN", line.Level)
+	assert.Equal(t, "Stale price C31", line.Msg)
+	assert.NotContains(t, lines[1], "request_id")
+
+	assert.Error(t, logger.SetFormat("xml"))
+}
+
+func TestTextFormatWithRequestID(t *testing.T) {
+	buf := captureOutput(t)
+
+	logger := &Logger{format: FormatText}
+	logger.WithRequestID("req-1").Error("Failed to add trade")
+	logger.Info("Starting")
+
+	assert.Equal(t, "ERROR: request_id=req-1 Failed to add trade\nINFO: Starting\n", buf.String())
+}
+
+func TestFromContext(t *testing.T) {
+	logger := (&Logger{}).WithRequestID("req-1")
+	ctx := context.WithValue(context.Background(), types.LoggerKey, logger)
+	assert.Equal(t, "req-1", FromContext(ctx).RequestID())
+
+	// falls back to the singleton logger
+	assert.Equal(t, GetLogger(), FromContext(context.Background()))
+}
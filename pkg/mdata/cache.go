@@ -0,0 +1,162 @@
+package mdata
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfolio-manager/pkg/event"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// historicalDataCache holds the daily bars of a ticker and the date range they cover. Coverage is tracked as a
+// range rather than derived from the bars, so weekends and holidays without bars do not trigger refetches.
+type historicalDataCache struct {
+	From   int64
+	To     int64
+	Bars   []*types.AssetData
+	Closed []string // trading days without a bar at the sources, e.g. holidays, found by repairing gaps
+}
+
+// getCachedHistoricalData serves historical data from the persistent cache, fetching only the missing head and
+// tail of the requested range from the sources before merging them into the cache.
+func (m *Manager) getCachedHistoricalData(tickerRef rdata.TickerReference, fromDate, toDate int64) ([]*types.AssetData, error) {
+	if m.db == nil {
+		return m.fetchHistoricalData(tickerRef, fromDate, toDate)
+	}
+
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+
+	// today's bar is still moving, so coverage never extends beyond now
+	toDate = min(toDate, time.Now().Unix())
+	if fromDate > toDate {
+		return nil, fmt.Errorf("invalid date range %d to %d", fromDate, toDate)
+	}
+
+	key := historicalDataKey(tickerRef.ID)
+	var cached historicalDataCache
+	if err := m.db.Get(key, &cached); err != nil || len(cached.Bars) == 0 {
+		bars, err := m.fetchHistoricalData(tickerRef, fromDate, toDate)
+		if err != nil {
+			return nil, err
+		}
+		cached = historicalDataCache{From: fromDate, To: toDate, Bars: mergeBars(nil, bars)}
+	} else {
+		updated := false
+		if fromDate < cached.From {
+			head, err := m.fetchHistoricalData(tickerRef, fromDate, cached.From)
+			if err != nil {
+				return nil, err
+			}
+			cached.Bars = mergeBars(cached.Bars, head)
+			cached.From = fromDate
+			updated = true
+		}
+		if toDate > cached.To {
+			tail, err := m.fetchHistoricalData(tickerRef, cached.To, toDate)
+			if err != nil {
+				return nil, err
+			}
+			cached.Bars = mergeBars(cached.Bars, tail)
+			cached.To = toDate
+			updated = true
+		}
+		if !updated {
+			logging.GetLogger().Infof("Returning cached historical data for ticker: %s", tickerRef.ID)
+			return barsInRange(cached.Bars, fromDate, toDate), nil
+		}
+	}
+
+	if err := m.db.Put(key, cached); err != nil {
+		logging.GetLogger().Warnf("Failed to cache historical data for ticker %s: %v", tickerRef.ID, err)
+	}
+
+	return barsInRange(cached.Bars, fromDate, toDate), nil
+}
+
+// GetCachedAssetPrice returns the last price served for the ticker, or else the latest cached historical close,
+// without ever fetching from the sources. It errors when neither is cached.
+func (m *Manager) GetCachedAssetPrice(ticker string) (*types.AssetData, error) {
+	if data, ok := m.lastPrices.Load(strings.ToUpper(ticker)); ok {
+		return data.(*types.AssetData), nil
+	}
+
+	if m.db != nil {
+		m.cacheMu.Lock()
+		defer m.cacheMu.Unlock()
+
+		var cached historicalDataCache
+		if err := m.db.Get(historicalDataKey(ticker), &cached); err == nil && len(cached.Bars) > 0 {
+			return cached.Bars[len(cached.Bars)-1], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no cached price for %s", ticker)
+}
+
+// InvalidateHistoricalData removes the cached historical data of the ticker, so it is refetched on next request.
+func (m *Manager) InvalidateHistoricalData(ticker string) error {
+	if m.db == nil {
+		return nil
+	}
+
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+
+	return m.db.Delete(historicalDataKey(ticker))
+}
+
+// SubscribeToReferenceData drops the cached prices of a ticker whenever its reference data changes, as the change
+// may point it to a different data source ticker.
+func (m *Manager) SubscribeToReferenceData(rdataSvc *rdata.Manager) {
+	rdataSvc.Subscribe(rdata.TickerChangedEvent, event.NewEventHandler(func(e event.Event) {
+		ticker := e.Data.(rdata.TickerChangedEventPayload).ID
+		m.lastPrices.Delete(strings.ToUpper(ticker))
+		if err := m.InvalidateHistoricalData(ticker); err != nil {
+			logging.GetLogger().Warnf("Failed to invalidate historical data of ticker %s: %v", ticker, err)
+		}
+	}))
+}
+
+// mergeBars merges daily bars into existing bars, keeping one bar per UTC day where the newer bar wins.
+func mergeBars(existing, bars []*types.AssetData) []*types.AssetData {
+	byDay := make(map[string]*types.AssetData, len(existing)+len(bars))
+	for _, bar := range existing {
+		byDay[barDay(bar)] = bar
+	}
+	for _, bar := range bars {
+		byDay[barDay(bar)] = bar
+	}
+
+	merged := make([]*types.AssetData, 0, len(byDay))
+	for _, bar := range byDay {
+		merged = append(merged, bar)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Timestamp < merged[j].Timestamp
+	})
+	return merged
+}
+
+// barsInRange returns the bars within the date range, inclusive.
+func barsInRange(bars []*types.AssetData, fromDate, toDate int64) []*types.AssetData {
+	var inRange []*types.AssetData
+	for _, bar := range bars {
+		if bar.Timestamp >= fromDate && bar.Timestamp <= toDate {
+			inRange = append(inRange, bar)
+		}
+	}
+	return inRange
+}
+
+func barDay(bar *types.AssetData) string {
+	return time.Unix(bar.Timestamp, 0).UTC().Format("2006-01-02")
+}
+
+func historicalDataKey(ticker string) string {
+	return fmt.Sprintf("%s:%s", types.HistoricalDataKeyPrefix, strings.ToUpper(ticker))
+}
@@ -0,0 +1,110 @@
+package mdata
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/mdata/sources"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheTestManager(t *testing.T, yahoo *fakeSource) *Manager {
+	db, err := dal.NewLevelDB(filepath.Join(t.TempDir(), "mdata.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "C31", YahooTicker: "C31.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+
+	return &Manager{
+		sources: map[string]types.DataSource{sources.YahooFinance: yahoo},
+		rdata:   rdataMgr,
+		db:      db,
+	}
+}
+
+func unix(date string) int64 {
+	t, _ := time.Parse("2006-01-02", date)
+	return t.Unix()
+}
+
+func TestHistoricalDataServedFromCache(t *testing.T) {
+	yahoo := &fakeSource{price: 3}
+	m := newCacheTestManager(t, yahoo)
+
+	// Mon 2024-01-01 to Sun 2024-01-14, 10 weekdays
+	data, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-14"))
+	require.NoError(t, err)
+	assert.Len(t, data, 10)
+	assert.Len(t, yahoo.historyFetches, 1)
+
+	// fully covered sub range, ending on a weekend, is served from cache
+	data, err = m.GetHistoricalData("C31", unix("2024-01-03"), unix("2024-01-07"))
+	require.NoError(t, err)
+	assert.Len(t, data, 3)
+	assert.Len(t, yahoo.historyFetches, 1)
+}
+
+func TestHistoricalDataFetchesOnlyMissingIncrements(t *testing.T) {
+	yahoo := &fakeSource{price: 3}
+	m := newCacheTestManager(t, yahoo)
+
+	_, err := m.GetHistoricalData("C31", unix("2024-01-08"), unix("2024-01-14"))
+	require.NoError(t, err)
+
+	data, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-21"))
+	require.NoError(t, err)
+	assert.Len(t, data, 15)
+	assert.Equal(t, [][2]int64{
+		{unix("2024-01-08"), unix("2024-01-14")},
+		{unix("2024-01-01"), unix("2024-01-08")}, // head
+		{unix("2024-01-14"), unix("2024-01-21")}, // tail
+	}, yahoo.historyFetches)
+
+	// bars are unique per day and sorted
+	for i := 1; i < len(data); i++ {
+		assert.Less(t, data[i-1].Timestamp, data[i].Timestamp)
+	}
+}
+
+func TestInvalidateHistoricalData(t *testing.T) {
+	yahoo := &fakeSource{price: 3}
+	m := newCacheTestManager(t, yahoo)
+
+	_, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-14"))
+	require.NoError(t, err)
+
+	require.NoError(t, m.InvalidateHistoricalData("c31"))
+
+	_, err = m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-14"))
+	require.NoError(t, err)
+	assert.Len(t, yahoo.historyFetches, 2)
+}
+
+func TestHistoricalDataDedupesConcurrentRequests(t *testing.T) {
+	yahoo := &fakeSource{price: 3, delay: 100 * time.Millisecond}
+	m := newCacheTestManager(t, yahoo)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-14"))
+			assert.NoError(t, err)
+			assert.Len(t, data, 10)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, yahoo.historyFetches, 1)
+	assert.Equal(t, int64(9), m.GetStats().DedupedHistoricalRequests)
+}
@@ -0,0 +1,189 @@
+package mdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-manager/pkg/types"
+)
+
+// customDividendsColumns are the columns of a custom dividends CSV, ExDate and Amount are required
+var customDividendsColumns = []string{"ExDate", "PayDate", "Amount", "Income", "CapitalReturn", "Other"}
+
+// ImportCustomDividends stores the dividends per share of the ticker from a CSV with ExDate (YYYY-MM-DD) and Amount
+// columns, an optional PayDate column, and optional Income, CapitalReturn and Other columns splitting the amount, e.g.
+// the capital return of REIT distributions. Custom dividends replace those of the data sources on the same ex date,
+// and the newer import wins. The number of dividends stored is returned, and nothing is stored if any row is invalid.
+func (m *Manager) ImportCustomDividends(ticker string, r io.Reader) (int, error) {
+	if m.db == nil {
+		return 0, errors.New("custom dividends require a database")
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		for _, column := range customDividendsColumns {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				columns[column] = i
+			}
+		}
+	}
+	_, hasExDate := columns["ExDate"]
+	_, hasAmount := columns["Amount"]
+	if !hasExDate || !hasAmount {
+		return 0, errors.New("invalid CSV header: expected ExDate,Amount and optionally PayDate,Income,CapitalReturn,Other")
+	}
+
+	ticker = strings.ToUpper(ticker)
+	var dividends []types.DividendsMetadata
+	var errs []error
+	for lineNum := 1; ; lineNum++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading CSV line %d: %w", lineNum, err)
+		}
+
+		dividend, err := parseCustomDividend(ticker, row, columns)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		dividends = append(dividends, dividend)
+	}
+	if len(errs) > 0 {
+		return 0, errors.Join(errs...)
+	}
+	if len(dividends) == 0 {
+		return 0, errors.New("no dividends in CSV")
+	}
+
+	existing, _ := m.GetCustomDividends(ticker)
+	if err := m.db.Put(customDividendsKey(ticker), overrideDividends(existing, dividends)); err != nil {
+		return 0, fmt.Errorf("failed to store custom dividends of %s: %w", ticker, err)
+	}
+	return len(dividends), nil
+}
+
+// GetCustomDividends returns the custom dividends of the ticker in ex date order.
+func (m *Manager) GetCustomDividends(ticker string) ([]types.DividendsMetadata, error) {
+	if m.db == nil {
+		return nil, nil
+	}
+
+	var dividends []types.DividendsMetadata
+	if err := m.db.Get(customDividendsKey(ticker), &dividends); err != nil {
+		return nil, nil
+	}
+	return dividends, nil
+}
+
+// DeleteCustomDividends deletes the custom dividends of the ticker.
+func (m *Manager) DeleteCustomDividends(ticker string) error {
+	if m.db == nil {
+		return nil
+	}
+	return m.db.Delete(customDividendsKey(ticker))
+}
+
+// withCustomDividends overrides the dividends of the data sources with the custom dividends of the ticker on the same
+// ex date.
+func (m *Manager) withCustomDividends(ticker string, dividends []types.DividendsMetadata) []types.DividendsMetadata {
+	custom, _ := m.GetCustomDividends(ticker)
+	if len(custom) == 0 {
+		return dividends
+	}
+	return overrideDividends(dividends, custom)
+}
+
+// parseCustomDividend parses a row of a custom dividends CSV. The components must add up to the amount when given.
+func parseCustomDividend(ticker string, row []string, columns map[string]int) (types.DividendsMetadata, error) {
+	cell := func(column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	exDate := cell("ExDate")
+	if _, err := time.Parse("2006-01-02", exDate); err != nil {
+		return types.DividendsMetadata{}, fmt.Errorf("invalid ex date %s", exDate)
+	}
+	amount, err := strconv.ParseFloat(cell("Amount"), 64)
+	if err != nil || amount < 0 {
+		return types.DividendsMetadata{}, fmt.Errorf("invalid amount %s", cell("Amount"))
+	}
+	payDate := cell("PayDate")
+	if _, err := time.Parse("2006-01-02", payDate); payDate != "" && err != nil {
+		return types.DividendsMetadata{}, fmt.Errorf("invalid pay date %s", payDate)
+	}
+	if payDate != "" && payDate < exDate {
+		return types.DividendsMetadata{}, fmt.Errorf("pay date %s is before the ex date %s", payDate, exDate)
+	}
+	dividend := types.DividendsMetadata{Ticker: ticker, ExDate: exDate, PayDate: payDate, Amount: amount}
+
+	components := 0.0
+	for _, component := range []struct {
+		column string
+		value  **float64
+	}{
+		{"Income", &dividend.Income},
+		{"CapitalReturn", &dividend.CapitalReturn},
+		{"Other", &dividend.Other},
+	} {
+		if cell(component.column) == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(cell(component.column), 64)
+		if err != nil {
+			return types.DividendsMetadata{}, fmt.Errorf("invalid %s %s", component.column, cell(component.column))
+		}
+		*component.value = &value
+		components += value
+	}
+	if dividend.HasComponents() && math.Abs(components-amount) > 1e-6 {
+		return types.DividendsMetadata{}, fmt.Errorf("components add up to %v, expected the amount %v", components, amount)
+	}
+	return dividend, nil
+}
+
+// overrideDividends merges the dividends into the existing ones by ex date, where the dividends win.
+func overrideDividends(existing, dividends []types.DividendsMetadata) []types.DividendsMetadata {
+	byExDate := make(map[string]types.DividendsMetadata, len(existing)+len(dividends))
+	for _, dividend := range existing {
+		byExDate[dividend.ExDate] = dividend
+	}
+	for _, dividend := range dividends {
+		byExDate[dividend.ExDate] = dividend
+	}
+
+	merged := make([]types.DividendsMetadata, 0, len(byExDate))
+	for _, dividend := range byExDate {
+		merged = append(merged, dividend)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ExDate < merged[j].ExDate
+	})
+	return merged
+}
+
+func customDividendsKey(ticker string) string {
+	return fmt.Sprintf("%s:%s", types.CustomDividendsKeyPrefix, strings.ToUpper(ticker))
+}
@@ -0,0 +1,76 @@
+package mdata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDividendsSource struct {
+	fakeSource
+	dividends []types.DividendsMetadata
+	err       error
+}
+
+func (f *fakeDividendsSource) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
+	return f.dividends, f.err
+}
+
+func TestCustomDividends(t *testing.T) {
+	config.SetConfig(&config.Config{DivWitholdingTaxSG: 0})
+	defer config.SetConfig(nil)
+
+	m := newCacheTestManager(t, &fakeSource{})
+	yahoo := &fakeDividendsSource{dividends: []types.DividendsMetadata{
+		{Ticker: "C31.SI", ExDate: "2024-02-01", Amount: 0.05},
+		{Ticker: "C31.SI", ExDate: "2024-08-01", Amount: 0.06},
+	}}
+	m.sources["yahoo"] = yahoo
+
+	// rows are all or nothing, and components must add up to the amount
+	_, err := m.ImportCustomDividends("C31", strings.NewReader("Date,Price\n2024-08-01,0.06\n"))
+	assert.ErrorContains(t, err, "invalid CSV header")
+	_, err = m.ImportCustomDividends("C31", strings.NewReader("ExDate,Amount,Income,CapitalReturn\n2024-08-01,0.06,0.05,0.02\n2024-13-01,0.06,,\n"))
+	assert.ErrorContains(t, err, "line 1: components add up to")
+	assert.ErrorContains(t, err, "line 2: invalid ex date")
+	custom, err := m.GetCustomDividends("C31")
+	assert.NoError(t, err)
+	assert.Empty(t, custom)
+
+	_, err = m.ImportCustomDividends("C31", strings.NewReader("ExDate,PayDate,Amount\n2024-08-01,2024-07-30,0.06\n"))
+	assert.ErrorContains(t, err, "line 1: pay date 2024-07-30 is before the ex date")
+
+	imported, err := m.ImportCustomDividends("c31", strings.NewReader("ExDate,PayDate,Amount,Income,CapitalReturn\n2024-08-01,2024-08-28,0.06,0.05,0.01\n2024-11-01,,0.02,,\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, imported)
+
+	// custom dividends replace those of the sources on the same ex date
+	dividends, err := m.GetDividendsMetadata("C31")
+	require.NoError(t, err)
+	require.Len(t, dividends, 3)
+	assert.Equal(t, "2024-02-01", dividends[0].ExDate)
+	assert.False(t, dividends[0].HasComponents())
+	assert.Equal(t, "2024-08-01", dividends[1].ExDate)
+	assert.Equal(t, "2024-08-28", dividends[1].PayDate)
+	require.NotNil(t, dividends[1].CapitalReturn)
+	assert.Equal(t, 0.01, *dividends[1].CapitalReturn)
+	assert.Equal(t, 0.05, *dividends[1].Income)
+	assert.Nil(t, dividends[1].Other)
+	assert.False(t, dividends[2].HasComponents())
+
+	// custom dividends are served when the sources fail
+	yahoo.err = errors.New("unavailable")
+	dividends, err = m.GetDividendsMetadata("C31")
+	require.NoError(t, err)
+	assert.Len(t, dividends, 2)
+
+	require.NoError(t, m.DeleteCustomDividends("C31"))
+	_, err = m.GetDividendsMetadata("C31")
+	assert.Error(t, err)
+}
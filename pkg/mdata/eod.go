@@ -0,0 +1,194 @@
+package mdata
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/scheduler"
+	"portfolio-manager/pkg/types"
+)
+
+// defaultEodCaptureTimes are the UTC times after the market close of each domicile at which the day's close is
+// captured, tickers of other domiciles are captured at defaultEodCaptureTime.
+var defaultEodCaptureTimes = map[string]string{
+	"SG": "09:30", // 17:30 SGT
+	"HK": "08:30", // 16:30 HKT
+	"US": "21:30", // 17:30 EDT
+}
+
+const defaultEodCaptureTime = "22:00"
+
+// eodCapture tracks the last UTC day captured per ticker, so each ticker is captured once a day.
+type eodCapture struct {
+	mu       sync.Mutex
+	captured map[string]string
+}
+
+// StartEndOfDayCapture captures the latest close of the held tickers, along with the configured watchlist, into the
+// historical data cache after the market close of each ticker's domicile. It runs until the scheduler is stopped.
+func (m *Manager) StartEndOfDayCapture(sched *scheduler.Scheduler, heldTickers func() []string) {
+	if !eodCaptureEnabled() {
+		logging.GetLogger().Info("End of day price capture is disabled")
+		return
+	}
+
+	sched.Every("eod_capture", time.Minute, func() error {
+		if len(m.CaptureEndOfDay(append(heldTickers(), eodWatchlist()...), time.Now())) == 0 {
+			return scheduler.ErrNotDue
+		}
+		return nil
+	})
+}
+
+// CaptureEndOfDay appends the close of now's UTC day to the historical data cache of each ticker whose capture time
+// has passed and which was not yet captured that day. Tickers whose market does not trade on weekends are skipped.
+// It returns the tickers captured.
+func (m *Manager) CaptureEndOfDay(tickers []string, now time.Time) []string {
+	now = now.UTC()
+	day := now.Format("2006-01-02")
+	startOfDay := now.Truncate(24 * time.Hour)
+
+	var captured []string
+	seen := make(map[string]struct{})
+	for _, ticker := range tickers {
+		ticker = strings.ToUpper(ticker)
+		if _, ok := seen[ticker]; ok {
+			continue
+		}
+		seen[ticker] = struct{}{}
+
+		if m.eod.capturedOn(ticker) == day {
+			continue
+		}
+
+		tickerRef, err := m.rdata.GetTicker(ticker)
+		if err != nil {
+			logging.GetLogger().Warnf("Skipping end of day capture of %s: %v", ticker, err)
+			m.eod.markCaptured(ticker, day)
+			continue
+		}
+		if now.Before(startOfDay.Add(eodCaptureOffset(tickerRef.Domicile))) {
+			continue
+		}
+		if !tradesOn(tickerRef, now) {
+			m.eod.markCaptured(ticker, day)
+			continue
+		}
+
+		// rate limits are respected by the sources, and only the tail beyond the cached range is fetched
+		bars, err := m.getCachedHistoricalData(tickerRef, startOfDay.Unix(), now.Unix())
+		if err != nil {
+			logging.GetLogger().Warnf("Failed end of day capture of %s: %v", ticker, err)
+			continue
+		}
+		if len(bars) == 0 {
+			logging.GetLogger().Infof("No close for %s on %s, market did not trade", ticker, day)
+		}
+
+		m.eod.markCaptured(ticker, day)
+		captured = append(captured, ticker)
+	}
+
+	return captured
+}
+
+// HistoricalCacheStats returns the coverage of the historical data cache of each cached ticker.
+func (m *Manager) HistoricalCacheStats() map[string]types.HistoricalCacheStats {
+	stats := make(map[string]types.HistoricalCacheStats)
+	if m.db == nil {
+		return stats
+	}
+
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+
+	prefix := string(types.HistoricalDataKeyPrefix) + ":"
+	keys, err := m.db.GetAllKeysWithPrefix(prefix)
+	if err != nil {
+		logging.GetLogger().Warnf("Failed to list cached historical data: %v", err)
+		return stats
+	}
+
+	for _, key := range keys {
+		var cached historicalDataCache
+		if err := m.db.Get(key, &cached); err != nil {
+			continue
+		}
+
+		tickerStats := types.HistoricalCacheStats{
+			From: time.Unix(cached.From, 0).UTC().Format("2006-01-02"),
+			To:   time.Unix(cached.To, 0).UTC().Format("2006-01-02"),
+			Bars: len(cached.Bars),
+		}
+		if len(cached.Bars) > 0 {
+			tickerStats.LastBar = barDay(cached.Bars[len(cached.Bars)-1])
+		}
+		ticker := strings.TrimPrefix(key, prefix)
+		m.historicalCacheGapStats(ticker, cached, &tickerStats)
+		stats[ticker] = tickerStats
+	}
+
+	return stats
+}
+
+func (e *eodCapture) capturedOn(ticker string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.captured[ticker]
+}
+
+func (e *eodCapture) markCaptured(ticker, day string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.captured == nil {
+		e.captured = make(map[string]string)
+	}
+	e.captured[ticker] = day
+}
+
+// tradesOn returns whether the ticker's market trades on the day, crypto trades every day.
+func tradesOn(tickerRef rdata.TickerReference, day time.Time) bool {
+	if tickerRef.AssetClass == rdata.AssetClassCrypto {
+		return true
+	}
+	return day.Weekday() != time.Saturday && day.Weekday() != time.Sunday
+}
+
+// eodCaptureOffset returns the UTC time of day after which the close of the domicile is captured.
+func eodCaptureOffset(domicile string) time.Duration {
+	captureTime, ok := defaultEodCaptureTimes[domicile]
+	if !ok {
+		captureTime = defaultEodCaptureTime
+	}
+
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg != nil {
+		if configured, ok := cfg.MarketData.EodCapture.Times[domicile]; ok {
+			captureTime = configured
+		}
+	}
+
+	t, err := time.Parse("15:04", captureTime)
+	if err != nil {
+		logging.GetLogger().Warnf("Invalid end of day capture time %s for %s, using %s", captureTime, domicile, defaultEodCaptureTime)
+		t, _ = time.Parse("15:04", defaultEodCaptureTime)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+func eodCaptureEnabled() bool {
+	cfg, _ := config.GetOrCreateConfig("")
+	return cfg != nil && !cfg.MarketData.EodCapture.Disabled
+}
+
+func eodWatchlist() []string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil {
+		return nil
+	}
+	return cfg.MarketData.EodCapture.Watchlist
+}
@@ -0,0 +1,50 @@
+package mdata
+
+import (
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/rdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureEndOfDay(t *testing.T) {
+	config.SetConfig(&config.Config{MarketData: config.MarketDataConfig{
+		EodCapture: config.EodCaptureConfig{Times: map[string]string{"SG": "12:30"}},
+	}})
+	defer config.SetConfig(nil)
+
+	yahoo := &fakeSource{price: 3}
+	m := newCacheTestManager(t, yahoo)
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "C31", YahooTicker: "C31.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", Domicile: "SG"})
+	m.rdata = rdataMgr
+
+	_, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-05"))
+	require.NoError(t, err)
+
+	// before the configured capture time
+	wed := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	assert.Empty(t, m.CaptureEndOfDay([]string{"C31"}, wed))
+
+	// after the close only the tail beyond the cached range is fetched, once a day
+	wed = wed.Add(time.Hour)
+	assert.Equal(t, []string{"C31"}, m.CaptureEndOfDay([]string{"c31", "C31"}, wed))
+	assert.Empty(t, m.CaptureEndOfDay([]string{"C31"}, wed.Add(time.Hour)))
+	assert.Equal(t, [2]int64{unix("2024-01-05"), wed.Unix()}, yahoo.historyFetches[len(yahoo.historyFetches)-1])
+
+	// weekends are skipped without fetching
+	fetches := len(yahoo.historyFetches)
+	assert.Empty(t, m.CaptureEndOfDay([]string{"C31"}, time.Date(2024, 1, 13, 13, 0, 0, 0, time.UTC)))
+	assert.Len(t, yahoo.historyFetches, fetches)
+
+	stats := m.GetStats().HistoricalCache["C31"]
+	assert.Equal(t, "2024-01-01", stats.From)
+	assert.Equal(t, "2024-01-10", stats.To)
+	assert.Equal(t, "2024-01-10", stats.LastBar)
+	assert.Equal(t, 8, stats.Bars)
+}
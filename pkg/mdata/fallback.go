@@ -0,0 +1,129 @@
+package mdata
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/mdata/sources"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// defaultPriceSources is the order in which sources are tried for each asset class, overridable via priceSources in config
+var defaultPriceSources = map[string][]string{
+	rdata.AssetClassCrypto:      {sources.CoinGecko, sources.YahooFinance, sources.GoogleFinance},
+	rdata.AssetClassDerivatives: {sources.YahooFinance}, // listed options by their OCC symbol, e.g. AAPL250117C00150000
+	rdata.AssetClassEquities:    {sources.YahooFinance, sources.SGX, sources.GoogleFinance},
+}
+
+// fallbackPriceSources is used for asset classes without a configured or default chain
+var fallbackPriceSources = []string{sources.YahooFinance, sources.GoogleFinance}
+
+// getAssetPriceFromSources tries each price source of the asset class in order, falling back to the next on error
+// or stale prices. If all sources fail but some returned stale prices, the first stale price is returned.
+// The returned asset data is annotated with the source which served it.
+func (m *Manager) getAssetPriceFromSources(tickerRef rdata.TickerReference) (*types.AssetData, error) {
+	staleAfter := priceStaleAfter()
+
+	var stale *types.AssetData
+	var errs []error
+	for _, sourceName := range priceSources(tickerRef.AssetClass) {
+		source, ok := m.sources[sourceName]
+		if !ok {
+			continue
+		}
+		sourceTicker := sourceTicker(sourceName, tickerRef)
+		if sourceTicker == "" {
+			continue
+		}
+
+		data, err, _ := m.priceFlights.Do(fmt.Sprintf("%s:%s:price", sourceName, sourceTicker), func() (*types.AssetData, error) {
+			return source.GetAssetPrice(sourceTicker)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sourceName, err))
+			continue
+		}
+
+		data = withSource(data, sourceName)
+		if staleAfter > 0 && time.Since(time.Unix(data.Timestamp, 0)) > staleAfter {
+			logging.GetLogger().Warnf("Stale price for ticker %s from %s, last updated %s", tickerRef.ID, sourceName, time.Unix(data.Timestamp, 0).Format(time.RFC3339))
+			if stale == nil {
+				stale = data
+			}
+			continue
+		}
+
+		return data, nil
+	}
+
+	if stale != nil {
+		return stale, nil
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("unable to fetch asset price %s from any market data sources: %w", tickerRef.ID, errors.Join(errs...))
+	}
+	return nil, fmt.Errorf("unable to fetch asset price %s from any market data sources", tickerRef.ID)
+}
+
+// priceSources returns the price sources of the asset class in the order they should be tried.
+func priceSources(assetClass string) []string {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg != nil {
+		if configured, ok := cfg.PriceSources[assetClass]; ok && len(configured) > 0 {
+			return configured
+		}
+	}
+
+	if defaults, ok := defaultPriceSources[assetClass]; ok {
+		return defaults
+	}
+	return fallbackPriceSources
+}
+
+// sourceTicker returns the ticker of the instrument for the given source, or empty if the source does not quote it.
+func sourceTicker(sourceName string, tickerRef rdata.TickerReference) string {
+	switch sourceName {
+	case sources.YahooFinance:
+		return tickerRef.YahooTicker
+	case sources.GoogleFinance:
+		return tickerRef.GoogleTicker
+	case sources.CoinGecko:
+		if tickerRef.CoinGeckoTicker == "" {
+			return ""
+		}
+		return coinGeckoTicker(tickerRef)
+	case sources.SGX:
+		// SGX quotes securities by stock code, which is derived from the Yahoo ticker, e.g. C31.SI
+		if strings.HasSuffix(tickerRef.YahooTicker, ".SI") {
+			return strings.TrimSuffix(tickerRef.YahooTicker, ".SI")
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+// priceStaleAfter returns the age after which prices are considered stale, or 0 if staleness is not checked.
+func priceStaleAfter() time.Duration {
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil || cfg.PriceStaleAfter <= 0 {
+		return 0
+	}
+	return time.Duration(cfg.PriceStaleAfter) * time.Hour
+}
+
+// withSource returns a copy of the asset data annotated with the source, leaving cached data untouched.
+func withSource(data *types.AssetData, sourceName string) *types.AssetData {
+	if data == nil {
+		return nil
+	}
+	annotated := *data
+	annotated.Source = sourceName
+	return &annotated
+}
@@ -0,0 +1,184 @@
+package mdata
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/mdata/sources"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	mu             sync.Mutex
+	delay          time.Duration
+	price          float64
+	timestamp      int64
+	err            error
+	requested      []string
+	historyFetches [][2]int64
+	holidays       map[string]bool // days without a bar
+}
+
+func (f *fakeSource) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requested = append(f.requested, ticker)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &types.AssetData{Ticker: ticker, Price: f.price, Currency: "SGD", Timestamp: f.timestamp}, nil
+}
+
+func (f *fakeSource) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
+	return nil, nil
+}
+
+// GetHistoricalData returns a daily bar at noon UTC on each weekday within the range.
+func (f *fakeSource) GetHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error) {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.historyFetches = append(f.historyFetches, [2]int64{fromDate, toDate})
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	var bars []*types.AssetData
+	from := time.Unix(fromDate, 0).UTC().Truncate(24 * time.Hour).Add(12 * time.Hour)
+	for d := from; d.Unix() <= toDate; d = d.AddDate(0, 0, 1) {
+		if d.Unix() < fromDate || d.Weekday() == time.Saturday || d.Weekday() == time.Sunday || f.holidays[d.Format("2006-01-02")] {
+			continue
+		}
+		bars = append(bars, &types.AssetData{Ticker: ticker, Price: f.price, Timestamp: d.Unix()})
+	}
+	return bars, nil
+}
+
+func newFallbackTestManager(yahoo, sgx *fakeSource) *Manager {
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "C31", YahooTicker: "C31.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD"})
+
+	return &Manager{
+		sources: map[string]types.DataSource{
+			sources.YahooFinance: yahoo,
+			sources.SGX:          sgx,
+		},
+		rdata: rdataMgr,
+	}
+}
+
+func TestGetAssetPriceFallsBackOnError(t *testing.T) {
+	config.SetConfig(&config.Config{PriceStaleAfter: 96})
+	defer config.SetConfig(nil)
+
+	yahoo := &fakeSource{err: errors.New("rate limited")}
+	sgx := &fakeSource{price: 3.12, timestamp: time.Now().Unix()}
+	m := newFallbackTestManager(yahoo, sgx)
+
+	data, err := m.GetAssetPrice("C31")
+	require.NoError(t, err)
+	assert.Equal(t, 3.12, data.Price)
+	assert.Equal(t, sources.SGX, data.Source)
+	assert.Equal(t, []string{"C31.SI"}, yahoo.requested)
+	assert.Equal(t, []string{"C31"}, sgx.requested)
+}
+
+func TestGetAssetPriceFallsBackOnStalePrice(t *testing.T) {
+	config.SetConfig(&config.Config{PriceStaleAfter: 96})
+	defer config.SetConfig(nil)
+
+	staleTimestamp := time.Now().AddDate(0, 0, -10).Unix()
+	yahoo := &fakeSource{price: 3.00, timestamp: staleTimestamp}
+	sgx := &fakeSource{price: 3.12, timestamp: time.Now().Unix()}
+	m := newFallbackTestManager(yahoo, sgx)
+
+	data, err := m.GetAssetPrice("C31")
+	require.NoError(t, err)
+	assert.Equal(t, sources.SGX, data.Source)
+
+	// when every source is stale, the first stale price is better than none
+	sgx.timestamp = staleTimestamp
+	data, err = m.GetAssetPrice("C31")
+	require.NoError(t, err)
+	assert.Equal(t, sources.YahooFinance, data.Source)
+	assert.Equal(t, 3.00, data.Price)
+}
+
+func TestGetAssetPriceConfiguredSourceOrder(t *testing.T) {
+	config.SetConfig(&config.Config{PriceSources: map[string][]string{
+		rdata.AssetClassEquities: {sources.SGX, sources.YahooFinance},
+	}})
+	defer config.SetConfig(nil)
+
+	yahoo := &fakeSource{price: 3.00, timestamp: time.Now().Unix()}
+	sgx := &fakeSource{price: 3.12, timestamp: time.Now().Unix()}
+	m := newFallbackTestManager(yahoo, sgx)
+
+	data, err := m.GetAssetPrice("C31")
+	require.NoError(t, err)
+	assert.Equal(t, sources.SGX, data.Source)
+	assert.Empty(t, yahoo.requested)
+}
+
+func TestGetAssetPriceAllSourcesFail(t *testing.T) {
+	yahoo := &fakeSource{err: errors.New("rate limited")}
+	sgx := &fakeSource{err: errors.New("not found")}
+	m := newFallbackTestManager(yahoo, sgx)
+
+	_, err := m.GetAssetPrice("C31")
+	assert.ErrorContains(t, err, "C31")
+	assert.ErrorContains(t, err, "rate limited")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestGetAssetPriceDedupesConcurrentRequests(t *testing.T) {
+	yahoo := &fakeSource{price: 3.12, timestamp: time.Now().Unix(), delay: 100 * time.Millisecond}
+	m := newFallbackTestManager(yahoo, &fakeSource{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := m.GetAssetPrice("C31")
+			assert.NoError(t, err)
+			assert.Equal(t, 3.12, data.Price)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, yahoo.requested, 1)
+	assert.Equal(t, int64(9), m.GetStats().DedupedPriceRequests)
+}
+
+func TestFetchObserverReportsEachSource(t *testing.T) {
+	config.SetConfig(&config.Config{})
+	defer config.SetConfig(nil)
+
+	yahoo := &fakeSource{err: errors.New("rate limited")}
+	sgx := &fakeSource{price: 3.12, timestamp: time.Now().Unix()}
+	m := newFallbackTestManager(yahoo, sgx)
+
+	var observed []string
+	m.SetFetchObserver(func(source, operation string, duration time.Duration, err error) {
+		observed = append(observed, source+" "+operation+" "+fmt.Sprint(err))
+	})
+	// setting the observer again replaces it rather than wrapping the sources twice
+	m.SetFetchObserver(func(source, operation string, duration time.Duration, err error) {
+		observed = append(observed, source+" "+operation+" "+fmt.Sprint(err))
+	})
+
+	_, err := m.GetAssetPrice("C31")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"yahoo price rate limited", "sgx price <nil>"}, observed)
+}
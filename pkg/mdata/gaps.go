@@ -0,0 +1,121 @@
+package mdata
+
+import (
+	"fmt"
+	"time"
+
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// historicalDataGaps returns the trading days from the first bar up to the last fully covered day which have
+// neither a bar nor were confirmed closed by the sources, e.g. days the end of day capture missed.
+func historicalDataGaps(tickerRef rdata.TickerReference, cached historicalDataCache) []string {
+	if len(cached.Bars) == 0 {
+		return nil
+	}
+
+	present := make(map[string]bool, len(cached.Bars)+len(cached.Closed))
+	for _, bar := range cached.Bars {
+		present[barDay(bar)] = true
+	}
+	for _, day := range cached.Closed {
+		present[day] = true
+	}
+
+	// the last covered day may have been cached before its close, so it is not reported
+	start := time.Unix(cached.Bars[0].Timestamp, 0).UTC().Truncate(24 * time.Hour)
+	end := time.Unix(cached.To, 0).UTC().Truncate(24 * time.Hour)
+
+	var gaps []string
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if tradesOn(tickerRef, day) && !present[day.Format("2006-01-02")] {
+			gaps = append(gaps, day.Format("2006-01-02"))
+		}
+	}
+	return gaps
+}
+
+// RepairHistoricalGaps fetches the bars of the trading days missing from the cached historical data of the ticker,
+// one request per run of consecutive missing days. Days the sources have no bar for are recorded as closed, e.g.
+// holidays, so they are no longer reported. It returns the days filled.
+func (m *Manager) RepairHistoricalGaps(ticker string) ([]string, error) {
+	if m.db == nil {
+		return nil, nil
+	}
+
+	tickerRef, err := m.getReferenceData(ticker)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+
+	key := historicalDataKey(ticker)
+	var cached historicalDataCache
+	if err := m.db.Get(key, &cached); err != nil {
+		return nil, fmt.Errorf("no cached historical data for %s", ticker)
+	}
+
+	gaps := historicalDataGaps(tickerRef, cached)
+	if len(gaps) == 0 {
+		return nil, nil
+	}
+
+	for _, run := range gapRuns(gaps) {
+		from, _ := time.Parse("2006-01-02", run[0])
+		to, _ := time.Parse("2006-01-02", run[len(run)-1])
+		bars, err := m.fetchHistoricalData(tickerRef, from.Unix(), to.AddDate(0, 0, 1).Unix()-1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s to %s: %w", run[0], run[len(run)-1], err)
+		}
+		cached.Bars = mergeBars(cached.Bars, barsInRange(bars, from.Unix(), to.AddDate(0, 0, 1).Unix()-1))
+	}
+
+	present := make(map[string]bool, len(cached.Bars))
+	for _, bar := range cached.Bars {
+		present[barDay(bar)] = true
+	}
+	var filled []string
+	for _, day := range gaps {
+		if present[day] {
+			filled = append(filled, day)
+		} else {
+			cached.Closed = append(cached.Closed, day)
+		}
+	}
+
+	if err := m.db.Put(key, cached); err != nil {
+		return nil, fmt.Errorf("failed to cache historical data for %s: %w", ticker, err)
+	}
+
+	logging.GetLogger().Infof("Repaired %d of %d missing days of %s", len(filled), len(gaps), tickerRef.ID)
+	return filled, nil
+}
+
+// gapRuns groups missing days into runs separated by no more than a weekend, each fetched with a single request.
+func gapRuns(gaps []string) [][]string {
+	var runs [][]string
+	var last time.Time
+	for _, gap := range gaps {
+		day, _ := time.Parse("2006-01-02", gap)
+		if len(runs) == 0 || day.Sub(last) > 3*24*time.Hour {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], gap)
+		last = day
+	}
+	return runs
+}
+
+// historicalCacheGapStats fills in the missing days of the cache stats of the ticker.
+func (m *Manager) historicalCacheGapStats(ticker string, cached historicalDataCache, stats *types.HistoricalCacheStats) {
+	tickerRef, err := m.rdata.GetTicker(ticker)
+	if err != nil {
+		// weekdays are still expected to trade without reference data
+		tickerRef = rdata.TickerReference{ID: ticker}
+	}
+	stats.MissingDays = historicalDataGaps(tickerRef, cached)
+}
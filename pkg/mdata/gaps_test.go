@@ -0,0 +1,75 @@
+package mdata
+
+import (
+	"testing"
+
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dropBars removes the bars of the days from the cached historical data of the ticker, as a missed capture would.
+func dropBars(t *testing.T, m *Manager, ticker string, days ...string) {
+	var cached historicalDataCache
+	require.NoError(t, m.db.Get(historicalDataKey(ticker), &cached))
+
+	drop := make(map[string]bool)
+	for _, day := range days {
+		drop[day] = true
+	}
+	var bars []*types.AssetData
+	for _, bar := range cached.Bars {
+		if !drop[barDay(bar)] {
+			bars = append(bars, bar)
+		}
+	}
+	cached.Bars = bars
+	require.NoError(t, m.db.Put(historicalDataKey(ticker), cached))
+}
+
+func TestHistoricalDataGapsReportedAndRepaired(t *testing.T) {
+	yahoo := &fakeSource{price: 3}
+	m := newCacheTestManager(t, yahoo)
+
+	// Mon 2024-01-01 to Sun 2024-01-14, missing Wed 2024-01-03 and Thu 2024-01-11
+	_, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-14"))
+	require.NoError(t, err)
+	dropBars(t, m, "C31", "2024-01-03", "2024-01-11")
+
+	stats := m.GetStats().HistoricalCache["C31"]
+	assert.Equal(t, []string{"2024-01-03", "2024-01-11"}, stats.MissingDays)
+
+	// only the missing days are fetched
+	fetches := len(yahoo.historyFetches)
+	filled, err := m.RepairHistoricalGaps("C31")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-01-03", "2024-01-11"}, filled)
+	assert.Equal(t, [][2]int64{
+		{unix("2024-01-03"), unix("2024-01-04") - 1},
+		{unix("2024-01-11"), unix("2024-01-12") - 1},
+	}, yahoo.historyFetches[fetches:])
+
+	assert.Empty(t, m.GetStats().HistoricalCache["C31"].MissingDays)
+	data, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-14"))
+	require.NoError(t, err)
+	assert.Len(t, data, 10)
+}
+
+func TestRepairRecordsDaysWithoutBarsAsClosed(t *testing.T) {
+	yahoo := &fakeSource{price: 3, holidays: map[string]bool{"2024-01-09": true}}
+	m := newCacheTestManager(t, yahoo)
+
+	_, err := m.GetHistoricalData("C31", unix("2024-01-01"), unix("2024-01-14"))
+	require.NoError(t, err)
+	dropBars(t, m, "C31", "2024-01-10")
+	assert.Equal(t, []string{"2024-01-09", "2024-01-10"}, m.GetStats().HistoricalCache["C31"].MissingDays)
+
+	// consecutive missing days are fetched together, the holiday is no longer reported
+	fetches := len(yahoo.historyFetches)
+	filled, err := m.RepairHistoricalGaps("C31")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-01-10"}, filled)
+	assert.Len(t, yahoo.historyFetches, fetches+1)
+	assert.Empty(t, m.GetStats().HistoricalCache["C31"].MissingDays)
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
+
+	"portfolio-manager/pkg/types"
 )
 
 // @Summary Get market data for a single ticker
@@ -35,6 +38,161 @@ func HandleTickerGet(mdataSvc MarketDataManager) http.HandlerFunc {
 	}
 }
 
+// PriceOverrideRequest is a manual price of a ticker as of a date
+type PriceOverrideRequest struct {
+	Price float64 `json:"price"`
+	Date  string  `json:"date"` // YYYY-MM-DD, today when empty
+}
+
+// @Summary Set a manual price for a ticker
+// @Description Stores a manual price of a ticker as of a date, e.g. the monthly NAV of an unlisted fund. Manual prices are served for tickers with data_source manual in reference data, and for other tickers when all market data sources fail.
+// @Tags market-data
+// @Accept json
+// @Produce json
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Param request body PriceOverrideRequest true "Manual price"
+// @Success 200 {object} types.AssetData "Latest manual price of the ticker"
+// @Failure 400 {string} string "Bad request"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/price/override/{ticker} [post]
+func HandlePriceOverridePost(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/price/override/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		var request PriceOverrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		var asOf time.Time
+		if request.Date != "" {
+			var err error
+			if asOf, err = time.Parse("2006-01-02", request.Date); err != nil {
+				http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+
+		data, err := mdataSvc.SetPriceOverride(ticker, request.Price, asOf)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	}
+}
+
+// @Summary Import manual prices for a ticker
+// @Description Stores the manual prices of a ticker from a CSV with Date (YYYY-MM-DD) and Price columns, e.g. historical NAVs, so historical data is available for metrics and benchmarks. Nothing is stored if any row is invalid.
+// @Tags market-data
+// @Accept multipart/form-data
+// @Produce json
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Param file formData file true "CSV file"
+// @Success 200 {object} map[string]int "Number of prices imported"
+// @Failure 400 {string} string "Bad request"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/price/override/{ticker}/import [post]
+func HandlePriceOverrideImport(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/price/override/"), "/import")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Failed to get file from request", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		imported, err := mdataSvc.ImportPriceOverrides(ticker, file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"imported": imported})
+	}
+}
+
+// @Summary Get the manual prices of a ticker
+// @Description Retrieves the manual prices of a ticker in date order
+// @Tags market-data
+// @Produce json
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Success 200 {array} types.AssetData "Manual prices of the ticker"
+// @Failure 400 {string} string "Bad request - Ticker is required"
+// @Router /api/v1/mdata/price/override/{ticker} [get]
+func HandlePriceOverrideGet(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/price/override/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		prices, err := mdataSvc.GetPriceOverrides(ticker)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if prices == nil {
+			prices = []*types.AssetData{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prices)
+	}
+}
+
+// @Summary Delete the manual prices of a ticker
+// @Description Deletes the manual prices of a ticker
+// @Tags market-data
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Success 204 "No content"
+// @Failure 400 {string} string "Bad request - Ticker is required"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/price/override/{ticker} [delete]
+func HandlePriceOverrideDelete(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/price/override/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := mdataSvc.DeletePriceOverride(ticker); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 // @Summary Get market data for multiple tickers
 // @Description Retrieves current market data for multiple asset tickers
 // @Tags market-data
@@ -98,6 +256,284 @@ func HandleDividendsGet(mdataSvc MarketDataManager) http.HandlerFunc {
 	}
 }
 
+// @Summary Import custom dividends for a ticker
+// @Description Stores the dividends per share of a ticker from a CSV with ExDate (YYYY-MM-DD) and Amount columns, and optional Income, CapitalReturn and Other columns splitting the amount, e.g. REIT distributions. Custom dividends replace those of the data sources on the same ex date. Nothing is stored if any row is invalid.
+// @Tags market-data
+// @Accept multipart/form-data
+// @Produce json
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Param file formData file true "CSV file"
+// @Success 200 {object} map[string]int "Number of dividends imported"
+// @Failure 400 {string} string "Bad request"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/dividend/custom/{ticker}/import [post]
+func HandleCustomDividendsImport(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/dividend/custom/"), "/import")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Failed to get file from request", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		imported, err := mdataSvc.ImportCustomDividends(ticker, file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"imported": imported})
+	}
+}
+
+// @Summary Get the custom dividends of a ticker
+// @Description Retrieves the custom dividends of a ticker in ex date order
+// @Tags market-data
+// @Produce json
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Success 200 {array} types.DividendsMetadata "Custom dividends of the ticker"
+// @Failure 400 {string} string "Bad request - Ticker is required"
+// @Router /api/v1/mdata/dividend/custom/{ticker} [get]
+func HandleCustomDividendsGet(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/dividend/custom/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		dividends, err := mdataSvc.GetCustomDividends(ticker)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if dividends == nil {
+			dividends = []types.DividendsMetadata{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dividends)
+	}
+}
+
+// @Summary Delete the custom dividends of a ticker
+// @Description Deletes the custom dividends of a ticker, the dividends of the data sources are served again
+// @Tags market-data
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Success 204 "No content"
+// @Failure 400 {string} string "Bad request - Ticker is required"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/dividend/custom/{ticker} [delete]
+func HandleCustomDividendsDelete(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/dividend/custom/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := mdataSvc.DeleteCustomDividends(ticker); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary Get the withholding tax rules
+// @Description Retrieves the withholding tax rates on dividends, in decimal, by domicile and the overrides by ticker. The rate of a ticker is its override when set, otherwise the rate of its domicile.
+// @Tags market-data
+// @Produce json
+// @Success 200 {object} types.WithholdingTaxRules "Withholding tax rules"
+// @Failure 500 {string} string "Internal server error"
+// @Router /api/v1/mdata/withholding [get]
+func HandleWithholdingTaxGet(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := mdataSvc.GetWithholdingTaxRules()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+// @Summary Override the withholding tax of a ticker
+// @Description Overrides the withholding tax rate on the dividends of a ticker, e.g. 0.15 for US dividends under a tax treaty. Dividends, projections and tax reports use the rate from then on.
+// @Tags market-data
+// @Accept json
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Param override body object true "Withholding tax rate in decimal, e.g. {\"rate\": 0.15}"
+// @Success 204 "No content"
+// @Failure 400 {string} string "Bad request"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/withholding/{ticker} [put]
+func HandleWithholdingTaxPut(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/withholding/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Rate *float64 `json:"rate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Rate == nil {
+			http.Error(w, "Invalid request payload, expected a rate", http.StatusBadRequest)
+			return
+		}
+
+		if err := mdataSvc.SetWithholdingTaxOverride(ticker, *req.Rate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary Delete the withholding tax override of a ticker
+// @Description Deletes the withholding tax override of a ticker, the rate of its domicile applies again
+// @Tags market-data
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Success 204 "No content"
+// @Failure 400 {string} string "Bad request - Ticker is required"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/withholding/{ticker} [delete]
+func HandleWithholdingTaxDelete(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/withholding/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := mdataSvc.DeleteWithholdingTaxOverride(ticker); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary Invalidate cached historical data for a ticker
+// @Description Removes the cached historical data of a ticker, so the full series is refetched on next request
+// @Tags market-data
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Success 204 "No content"
+// @Failure 400 {string} string "Bad request - Ticker is required"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/cache/{ticker} [delete]
+func HandleCacheDelete(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/cache/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := mdataSvc.InvalidateHistoricalData(ticker); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary Repair gaps in cached historical data for a ticker
+// @Description Fetches only the trading days missing from the cached historical data of a ticker, as reported in the health statistics. Days without a bar at the sources, e.g. holidays, are no longer reported.
+// @Tags market-data
+// @Produce json
+// @Param ticker path string true "Ticker symbol (see reference data)"
+// @Success 200 {object} map[string][]string "Days filled"
+// @Failure 400 {string} string "Bad request - Ticker is required"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/mdata/repair/{ticker} [post]
+func HandleRepairPost(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		ticker := strings.TrimPrefix(r.URL.Path, "/api/v1/mdata/repair/")
+		if ticker == "" {
+			http.Error(w, "Ticker is required", http.StatusBadRequest)
+			return
+		}
+
+		filled, err := mdataSvc.RepairHistoricalGaps(ticker)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if filled == nil {
+			filled = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"filled": filled})
+	}
+}
+
+// @Summary Get market data health statistics
+// @Description Retrieves health statistics of the market data manager, e.g. deduped upstream requests and trading days missing from the historical data cache
+// @Tags market-data
+// @Produce json
+// @Success 200 {object} types.MarketDataStats "Market data health statistics"
+// @Router /api/v1/mdata/health [get]
+func HandleHealthGet(mdataSvc MarketDataManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mdataSvc.GetStats())
+	}
+}
+
+// isAdmin returns whether the user of the request is an admin, rejecting the request otherwise.
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if user := types.UserFromContext(r.Context()); user != nil && !user.Admin {
+		http.Error(w, "Admin only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // RegisterHandlers registers the handlers for the market data service
 func RegisterHandlers(mux *http.ServeMux, mdataSvc MarketDataManager) {
 	mux.HandleFunc("/api/v1/mdata/price/", func(w http.ResponseWriter, r *http.Request) {
@@ -109,6 +545,21 @@ func RegisterHandlers(mux *http.ServeMux, mdataSvc MarketDataManager) {
 		}
 	})
 
+	mux.HandleFunc("/api/v1/mdata/price/override/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/import"):
+			HandlePriceOverrideImport(mdataSvc).ServeHTTP(w, r)
+		case r.Method == http.MethodPost:
+			HandlePriceOverridePost(mdataSvc).ServeHTTP(w, r)
+		case r.Method == http.MethodGet:
+			HandlePriceOverrideGet(mdataSvc).ServeHTTP(w, r)
+		case r.Method == http.MethodDelete:
+			HandlePriceOverrideDelete(mdataSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	mux.HandleFunc("/api/v1/mdata/tickers/price", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -126,4 +577,64 @@ func RegisterHandlers(mux *http.ServeMux, mdataSvc MarketDataManager) {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+
+	mux.HandleFunc("/api/v1/mdata/dividend/custom/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/import"):
+			HandleCustomDividendsImport(mdataSvc).ServeHTTP(w, r)
+		case r.Method == http.MethodGet:
+			HandleCustomDividendsGet(mdataSvc).ServeHTTP(w, r)
+		case r.Method == http.MethodDelete:
+			HandleCustomDividendsDelete(mdataSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/mdata/withholding", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleWithholdingTaxGet(mdataSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/mdata/withholding/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			HandleWithholdingTaxPut(mdataSvc).ServeHTTP(w, r)
+		case http.MethodDelete:
+			HandleWithholdingTaxDelete(mdataSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/mdata/cache/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			HandleCacheDelete(mdataSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/mdata/repair/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleRepairPost(mdataSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/mdata/health", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleHealthGet(mdataSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 }
@@ -3,7 +3,10 @@ package mdata
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
+	"time"
 
 	"portfolio-manager/internal/config"
 	"portfolio-manager/internal/dal"
@@ -20,12 +23,36 @@ type MarketDataManager interface {
 	GetHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error)
 	GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error)
 	GetDividendsMetadataFromTickerRef(tickerRef rdata.TickerReference) ([]types.DividendsMetadata, error)
+	GetCachedAssetPrice(ticker string) (*types.AssetData, error)
+	InvalidateHistoricalData(ticker string) error
+	RepairHistoricalGaps(ticker string) ([]string, error)
+	MoveDividendsMetadata(from, to rdata.TickerReference, dryRun bool) ([]string, error)
+	GetStats() types.MarketDataStats
+	SetPriceOverride(ticker string, price float64, asOf time.Time) (*types.AssetData, error)
+	ImportPriceOverrides(ticker string, r io.Reader) (int, error)
+	GetPriceOverrides(ticker string) ([]*types.AssetData, error)
+	DeletePriceOverride(ticker string) error
+	ImportCustomDividends(ticker string, r io.Reader) (int, error)
+	GetCustomDividends(ticker string) ([]types.DividendsMetadata, error)
+	DeleteCustomDividends(ticker string) error
+	GetWithholdingTaxRules() (types.WithholdingTaxRules, error)
+	SetWithholdingTaxOverride(ticker string, rate float64) error
+	DeleteWithholdingTaxOverride(ticker string) error
 }
 
 // Manager handles multiple data sources with fallback capability
 type Manager struct {
 	sources map[string]types.DataSource
 	rdata   rdata.ReferenceManager
+	db      dal.Database
+	cacheMu sync.Mutex // guards the historical data cache
+
+	// concurrent identical upstream requests share a single call
+	priceFlights      common.FlightGroup[*types.AssetData]
+	historicalFlights common.FlightGroup[[]*types.AssetData]
+	lastPrices        sync.Map // last price served per ticker, read by cache-only consumers
+
+	eod eodCapture
 }
 
 // NewManager creates a new data manager with initialized data sources
@@ -33,8 +60,12 @@ func NewManager(db dal.Database, rdata rdata.ReferenceManager) (*Manager, error)
 	m := &Manager{
 		sources: make(map[string]types.DataSource),
 		rdata:   rdata,
+		db:      db,
 	}
 
+	// Rate limits must be configured before the data sources request their limiters
+	ApplyRateLimitConfig()
+
 	// Initialize default data sources
 	google, err := NewDataSource(sources.GoogleFinance, db)
 	if err != nil {
@@ -56,27 +87,50 @@ func NewManager(db dal.Database, rdata rdata.ReferenceManager) (*Manager, error)
 	if err != nil {
 		return nil, err
 	}
+	masSsb, err := NewDataSource(sources.MasSsb, db)
+	if err != nil {
+		return nil, err
+	}
+	coinGecko, err := NewDataSource(sources.CoinGecko, db)
+	if err != nil {
+		return nil, err
+	}
+	sgx, err := NewDataSource(sources.SGX, db)
+	if err != nil {
+		return nil, err
+	}
 
 	m.sources[sources.GoogleFinance] = google
 	m.sources[sources.YahooFinance] = yahoo
 	m.sources[sources.DividendsSingapore] = dividendsSg
 	m.sources[sources.SSB] = iLoveSsb
 	m.sources[sources.MAS] = mas
+	m.sources[sources.MasSsb] = masSsb
+	m.sources[sources.CoinGecko] = coinGecko
+	m.sources[sources.SGX] = sgx
 
-	logging.GetLogger().Info("Market data manager initialized with Yahoo/Google finance, Dividends.sg, ILoveSsb and MAS data sources")
+	logging.GetLogger().Info("Market data manager initialized with Yahoo/Google finance, Dividends.sg, ILoveSsb, MAS, CoinGecko and SGX data sources")
 
 	return m, nil
 }
 
 // GetAssetPrice attempts to fetch asset price from available sources
 func (m *Manager) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	data, err := m.getAssetPrice(ticker)
+	if err == nil && data != nil {
+		m.lastPrices.Store(strings.ToUpper(ticker), data)
+	}
+	return data, err
+}
+
+func (m *Manager) getAssetPrice(ticker string) (*types.AssetData, error) {
 	logging.GetLogger().Info("Fetching asset price for ticker", ticker)
 
 	// for SSB, tickers are standardized against the following convention, e.g. SBJAN25
 	if common.IsSSB(ticker) {
 		if iLoveSsb, ok := m.sources[sources.SSB]; ok {
 			data, err := iLoveSsb.GetAssetPrice(ticker)
-			return data, err
+			return withSource(data, sources.SSB), err
 		}
 	}
 
@@ -84,26 +138,18 @@ func (m *Manager) GetAssetPrice(ticker string) (*types.AssetData, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	// Try Yahoo Finance first if ticker is available in ref data
-	if tickerRef.YahooTicker != "" {
-		if yahoo, ok := m.sources[sources.YahooFinance]; ok {
-			if data, err := yahoo.GetAssetPrice(tickerRef.YahooTicker); err == nil {
-				return data, nil
-			}
-		}
+	if isManuallyPriced(tickerRef) {
+		return m.getPriceOverride(tickerRef.ID)
 	}
 
-	// Fallback to Google Finance
-	if tickerRef.GoogleTicker != "" {
-		if google, ok := m.sources[sources.GoogleFinance]; ok {
-			if data, err := google.GetAssetPrice(tickerRef.GoogleTicker); err == nil {
-				return data, nil
-			}
+	data, err := m.getAssetPriceFromSources(tickerRef)
+	if err != nil {
+		if override, overrideErr := m.getPriceOverride(tickerRef.ID); overrideErr == nil {
+			logging.GetLogger().Warnf("Falling back to the manual price of ticker %s: %v", tickerRef.ID, err)
+			return override, nil
 		}
 	}
-
-	return nil, fmt.Errorf("unable to fetch asset price %s from any market data sources", ticker)
+	return data, err
 }
 
 // GetHistoricalData attempts to fetch historical data from available sources
@@ -119,10 +165,47 @@ func (m *Manager) GetHistoricalData(ticker string, fromDate, toDate int64) ([]*t
 	}
 
 	tickerRef, err := m.getReferenceData(ticker)
-	if err == nil {
+	if err != nil {
 		return nil, err
 	}
 
+	if isManuallyPriced(tickerRef) {
+		return m.getManualHistoricalData(tickerRef.ID, fromDate, toDate)
+	}
+
+	key := fmt.Sprintf("%s:%d:%d:1d", tickerRef.ID, fromDate, toDate)
+	data, err, _ := m.historicalFlights.Do(key, func() ([]*types.AssetData, error) {
+		return m.getCachedHistoricalData(tickerRef, fromDate, toDate)
+	})
+	if err != nil {
+		if manual, manualErr := m.getManualHistoricalData(tickerRef.ID, fromDate, toDate); manualErr == nil {
+			logging.GetLogger().Warnf("Falling back to the manual prices of ticker %s: %v", tickerRef.ID, err)
+			return manual, nil
+		}
+	}
+	return data, err
+}
+
+// GetStats returns health statistics of the market data manager.
+func (m *Manager) GetStats() types.MarketDataStats {
+	return types.MarketDataStats{
+		DedupedPriceRequests:      m.priceFlights.Deduped(),
+		DedupedHistoricalRequests: m.historicalFlights.Deduped(),
+		HistoricalCache:           m.HistoricalCacheStats(),
+	}
+}
+
+// fetchHistoricalData fetches historical data from the first available source which has the ticker.
+func (m *Manager) fetchHistoricalData(tickerRef rdata.TickerReference, fromDate, toDate int64) ([]*types.AssetData, error) {
+	// for crypto, try CoinGecko first if coin id is available in ref data
+	if tickerRef.AssetClass == rdata.AssetClassCrypto && tickerRef.CoinGeckoTicker != "" {
+		if coinGecko, ok := m.sources[sources.CoinGecko]; ok {
+			if data, err := coinGecko.GetHistoricalData(coinGeckoTicker(tickerRef), fromDate, toDate); err == nil {
+				return data, nil
+			}
+		}
+	}
+
 	// Try Yahoo Finance first if ticker is available in ref data
 	if tickerRef.YahooTicker != "" {
 		if yahoo, ok := m.sources[sources.YahooFinance]; ok {
@@ -157,28 +240,41 @@ func (m *Manager) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata
 	return m.GetDividendsMetadataFromTickerRef(tickerRef)
 }
 
-// GetDividendsMetadataFromTickerRef attempts to fetch dividends metadata from available sources
+// GetDividendsMetadataFromTickerRef attempts to fetch dividends metadata from available sources, overridden by the
+// custom dividends of the ticker on the same ex date. Dividends are withheld at the rate resolved for the ticker when
+// served, so a changed rule also applies to dividends cached earlier
 func (m *Manager) GetDividendsMetadataFromTickerRef(tickerRef rdata.TickerReference) ([]types.DividendsMetadata, error) {
-	witholdingTax := m.MapDomicileToWitholdingTax(tickerRef.Domicile)
+	witholdingTax := m.ResolveWithholdingTax(tickerRef)
+
+	dividends, err := m.getSourceDividendsMetadata(tickerRef)
+	if err != nil {
+		if custom, _ := m.GetCustomDividends(tickerRef.ID); len(custom) > 0 {
+			return withWithholdingTax(m.withCustomDividends(tickerRef.ID, nil), witholdingTax), nil
+		}
+		return nil, err
+	}
+	return withWithholdingTax(m.withCustomDividends(tickerRef.ID, dividends), witholdingTax), nil
+}
+
+// getSourceDividendsMetadata fetches the dividends metadata of the ticker from the first available source
+func (m *Manager) getSourceDividendsMetadata(tickerRef rdata.TickerReference) ([]types.DividendsMetadata, error) {
 
 	// for SSB, tickers are standardized against the following convention, e.g. SBJAN25
 	if common.IsSSB(tickerRef.ID) {
-		if iLoveSsb, ok := m.sources[sources.SSB]; ok {
-			return iLoveSsb.GetDividendsMetadata(tickerRef.ID, witholdingTax)
-		}
+		return m.getSsbDividendsMetadata(tickerRef)
 	}
 
 	// for SG MAS Bills, tickers are standardized against the following convention, e.g. BS24124Z
 	if common.IsSgTBill(tickerRef.ID) {
 		if mas, ok := m.sources[sources.MAS]; ok {
-			return mas.GetDividendsMetadata(tickerRef.ID, witholdingTax)
+			return mas.GetDividendsMetadata(tickerRef.ID)
 		}
 	}
 
 	// Try Dividends.sg first
 	if tickerRef.DividendsSgTicker != "" {
 		if dividendsSg, ok := m.sources[sources.DividendsSingapore]; ok {
-			if data, err := dividendsSg.GetDividendsMetadata(tickerRef.DividendsSgTicker, witholdingTax); err == nil {
+			if data, err := dividendsSg.GetDividendsMetadata(tickerRef.DividendsSgTicker); err == nil {
 				return data, nil
 			}
 		}
@@ -187,7 +283,7 @@ func (m *Manager) GetDividendsMetadataFromTickerRef(tickerRef rdata.TickerRefere
 	// Fallback to Yahoo Finance
 	if tickerRef.YahooTicker != "" {
 		if yahoo, ok := m.sources[sources.YahooFinance]; ok {
-			if data, err := yahoo.GetDividendsMetadata(tickerRef.YahooTicker, witholdingTax); err == nil {
+			if data, err := yahoo.GetDividendsMetadata(tickerRef.YahooTicker); err == nil {
 				return data, nil
 			}
 		}
@@ -209,11 +305,53 @@ func NewDataSource(sourceType string, db dal.Database) (types.DataSource, error)
 		return sources.NewILoveSsb(db), nil
 	case sources.MAS:
 		return sources.NewMas(db), nil
+	case sources.MasSsb:
+		return sources.NewMasSsb(db), nil
+	case sources.CoinGecko:
+		return sources.NewCoinGecko(coinGeckoCacheTTL()), nil
+	case sources.SGX:
+		return sources.NewSgx(), nil
 	default:
 		return nil, errors.New("unsupported data source")
 	}
 }
 
+// coinGeckoTicker returns the CoinGecko ticker quoted in the ticker's currency, e.g. bitcoin:usd.
+func coinGeckoTicker(tickerRef rdata.TickerReference) string {
+	if tickerRef.Ccy == "" {
+		return tickerRef.CoinGeckoTicker
+	}
+	return fmt.Sprintf("%s:%s", tickerRef.CoinGeckoTicker, strings.ToLower(tickerRef.Ccy))
+}
+
+// ApplyRateLimitConfig applies the configured rate limit intervals of the data sources, updating the limiters in use,
+// e.g. after the config is reloaded.
+func ApplyRateLimitConfig() {
+	common.SetRateLimitIntervals(rateLimitIntervals())
+}
+
+// rateLimitIntervals returns the configured rate limit interval of each data source.
+func rateLimitIntervals() map[string]time.Duration {
+	intervals := make(map[string]time.Duration)
+	cfg, _ := config.GetOrCreateConfig("")
+	if cfg == nil {
+		return intervals
+	}
+	for source, ms := range cfg.MarketData.RateLimits {
+		intervals[source] = time.Duration(ms) * time.Millisecond
+	}
+	return intervals
+}
+
+// coinGeckoCacheTTL returns the configured CoinGecko price cache TTL.
+func coinGeckoCacheTTL() time.Duration {
+	cfg, err := config.GetOrCreateConfig("")
+	if err != nil || cfg == nil || cfg.CoinGeckoCacheTtl <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(cfg.CoinGeckoCacheTtl) * time.Second
+}
+
 func (m *Manager) getReferenceData(ticker string) (rdata.TickerReference, error) {
 	refData, err := m.rdata.GetTicker(strings.ToUpper(ticker))
 	if err != nil {
@@ -223,12 +361,20 @@ func (m *Manager) getReferenceData(ticker string) (rdata.TickerReference, error)
 	return refData, nil
 }
 
+// MapDomicileToWitholdingTax returns the withholding tax rate of the domicile, from the withholdingTax rules when
+// configured, otherwise from the divWitholdingTax fields.
 func (m *Manager) MapDomicileToWitholdingTax(domicile string) float64 {
 	cfg, err := config.GetOrCreateConfig("")
 	if err != nil {
 		return 0.0
 	}
 
+	for ruleDomicile, rate := range cfg.WithholdingTax {
+		if strings.EqualFold(ruleDomicile, domicile) {
+			return rate
+		}
+	}
+
 	switch domicile {
 	case "SG":
 		return cfg.DivWitholdingTaxSG
@@ -0,0 +1,56 @@
+package mdata
+
+import (
+	"time"
+
+	"portfolio-manager/pkg/types"
+)
+
+// Operations of the data sources reported to the fetch observer
+const (
+	OperationPrice      = "price"
+	OperationHistorical = "historical"
+	OperationDividends  = "dividends"
+)
+
+// FetchObserver is called after each request of the manager to a data source with its duration and error, nil on
+// success. Cached and deduplicated requests which do not reach the source are not observed.
+type FetchObserver func(source, operation string, duration time.Duration, err error)
+
+// SetFetchObserver sets the observer of the requests to the data sources, it must be set before serving requests.
+func (m *Manager) SetFetchObserver(observer FetchObserver) {
+	for name, source := range m.sources {
+		if observed, ok := source.(*observedSource); ok {
+			source = observed.source
+		}
+		m.sources[name] = &observedSource{name: name, source: source, observer: observer}
+	}
+}
+
+// observedSource reports the requests to a data source to the fetch observer.
+type observedSource struct {
+	name     string
+	source   types.DataSource
+	observer FetchObserver
+}
+
+func (s *observedSource) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	start := time.Now()
+	data, err := s.source.GetAssetPrice(ticker)
+	s.observer(s.name, OperationPrice, time.Since(start), err)
+	return data, err
+}
+
+func (s *observedSource) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
+	start := time.Now()
+	data, err := s.source.GetDividendsMetadata(ticker)
+	s.observer(s.name, OperationDividends, time.Since(start), err)
+	return data, err
+}
+
+func (s *observedSource) GetHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error) {
+	start := time.Now()
+	data, err := s.source.GetHistoricalData(ticker, fromDate, toDate)
+	s.observer(s.name, OperationHistorical, time.Since(start), err)
+	return data, err
+}
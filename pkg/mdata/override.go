@@ -0,0 +1,173 @@
+package mdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// SourceManual annotates prices served from the manual prices of a ticker
+const SourceManual = "manual"
+
+// defaultManualPriceStaleAfter is the age in days after which manual prices are flagged as stale when not configured,
+// covering a monthly NAV published a couple of weeks after the month end
+const defaultManualPriceStaleAfter = 45
+
+// SetPriceOverride stores a manual price of the ticker as of the date, now when zero, replacing a manual price of the
+// same day. Manual prices are served for tickers priced manually in reference data, and for other tickers when all
+// market data sources fail.
+func (m *Manager) SetPriceOverride(ticker string, price float64, asOf time.Time) (*types.AssetData, error) {
+	if price < 0 {
+		return nil, errors.New("price must not be negative")
+	}
+	if asOf.IsZero() {
+		asOf = time.Now()
+	}
+
+	ticker = strings.ToUpper(ticker)
+	bar := &types.AssetData{Ticker: ticker, Price: price, Timestamp: asOf.Unix(), Source: SourceManual}
+	if err := m.storeManualPrices(ticker, []*types.AssetData{bar}); err != nil {
+		return nil, err
+	}
+	return m.getPriceOverride(ticker)
+}
+
+// ImportPriceOverrides stores the manual prices of the ticker from a CSV with a Date (YYYY-MM-DD) and Price column,
+// e.g. the historical NAVs of an unlisted fund, returning the number of prices stored. Nothing is stored if any row
+// is invalid.
+func (m *Manager) ImportPriceOverrides(ticker string, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	if len(header) != 2 || !strings.EqualFold(header[0], "Date") || !strings.EqualFold(header[1], "Price") {
+		return 0, errors.New("invalid CSV header: expected Date,Price")
+	}
+
+	ticker = strings.ToUpper(ticker)
+	var bars []*types.AssetData
+	var errs []error
+	for lineNum := 1; ; lineNum++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading CSV line %d: %w", lineNum, err)
+		}
+
+		date, err := time.Parse("2006-01-02", row[0])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: invalid date %s", lineNum, row[0]))
+			continue
+		}
+		price, err := strconv.ParseFloat(row[1], 64)
+		if err != nil || price < 0 {
+			errs = append(errs, fmt.Errorf("line %d: invalid price %s", lineNum, row[1]))
+			continue
+		}
+		bars = append(bars, &types.AssetData{Ticker: ticker, Price: price, Timestamp: date.Unix(), Source: SourceManual})
+	}
+	if len(errs) > 0 {
+		return 0, errors.Join(errs...)
+	}
+	if len(bars) == 0 {
+		return 0, errors.New("no prices in CSV")
+	}
+
+	return len(bars), m.storeManualPrices(ticker, bars)
+}
+
+// GetPriceOverrides returns the manual prices of the ticker in date order.
+func (m *Manager) GetPriceOverrides(ticker string) ([]*types.AssetData, error) {
+	if m.db == nil {
+		return nil, nil
+	}
+
+	var bars []*types.AssetData
+	if err := m.db.Get(manualPriceKey(ticker), &bars); err != nil {
+		return nil, nil
+	}
+	return bars, nil
+}
+
+// DeletePriceOverride deletes the manual prices of the ticker.
+func (m *Manager) DeletePriceOverride(ticker string) error {
+	if m.db == nil {
+		return nil
+	}
+	m.lastPrices.Delete(strings.ToUpper(ticker))
+	return m.db.Delete(manualPriceKey(ticker))
+}
+
+// storeManualPrices merges the prices into the manual prices of the ticker, one per day where the newer price wins.
+func (m *Manager) storeManualPrices(ticker string, bars []*types.AssetData) error {
+	if m.db == nil {
+		return errors.New("manual prices require a database")
+	}
+
+	existing, _ := m.GetPriceOverrides(ticker)
+	if err := m.db.Put(manualPriceKey(ticker), mergeBars(existing, bars)); err != nil {
+		return fmt.Errorf("failed to store manual prices of %s: %w", ticker, err)
+	}
+	// the latest price may have changed
+	m.lastPrices.Delete(ticker)
+	return nil
+}
+
+// getPriceOverride returns the latest manual price of the ticker, flagged as stale when older than the configured age.
+func (m *Manager) getPriceOverride(ticker string) (*types.AssetData, error) {
+	bars, _ := m.GetPriceOverrides(ticker)
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("no manual price for %s", ticker)
+	}
+
+	latest := *bars[len(bars)-1]
+	if tickerRef, err := m.getReferenceData(ticker); err == nil {
+		latest.Currency = tickerRef.Ccy
+	}
+	if time.Since(time.Unix(latest.Timestamp, 0)) > manualPriceStaleAfter() {
+		logging.GetLogger().Warnf("Stale manual price for ticker %s, last updated %s", ticker, time.Unix(latest.Timestamp, 0).Format(time.RFC3339))
+		latest.Stale = true
+	}
+	return &latest, nil
+}
+
+// getManualHistoricalData returns the manual prices of the ticker within the date range.
+func (m *Manager) getManualHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error) {
+	bars, _ := m.GetPriceOverrides(ticker)
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("no manual prices for %s", ticker)
+	}
+	return barsInRange(bars, fromDate, toDate), nil
+}
+
+// isManuallyPriced returns whether the ticker is priced only from its manual prices.
+func isManuallyPriced(tickerRef rdata.TickerReference) bool {
+	return tickerRef.DataSource == rdata.DataSourceManual
+}
+
+// manualPriceStaleAfter returns the age after which manual prices are flagged as stale.
+func manualPriceStaleAfter() time.Duration {
+	days := defaultManualPriceStaleAfter
+	if cfg, _ := config.GetOrCreateConfig(""); cfg != nil && cfg.MarketData.ManualPriceStaleAfter > 0 {
+		days = cfg.MarketData.ManualPriceStaleAfter
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func manualPriceKey(ticker string) string {
+	return fmt.Sprintf("%s:%s", types.ManualPriceKeyPrefix, strings.ToUpper(ticker))
+}
@@ -0,0 +1,130 @@
+package mdata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/mdata/sources"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManuallyPricedTicker(t *testing.T) {
+	yahoo := &fakeSource{price: 3}
+	m := newCacheTestManager(t, yahoo)
+	m.rdata.(*mocks.MockReferenceManager).AddTicker(rdata.TickerReference{ID: "FUND", AssetClass: rdata.AssetClassEquities, Ccy: "USD", DataSource: rdata.DataSourceManual})
+
+	_, err := m.GetAssetPrice("FUND")
+	assert.Error(t, err)
+
+	_, err = m.SetPriceOverride("fund", 10.5, time.Now().AddDate(0, 0, -1))
+	require.NoError(t, err)
+	data, err := m.GetAssetPrice("FUND")
+	require.NoError(t, err)
+	assert.Equal(t, 10.5, data.Price)
+	assert.Equal(t, "USD", data.Currency)
+	assert.Equal(t, SourceManual, data.Source)
+	assert.False(t, data.Stale)
+	assert.Empty(t, yahoo.requested)
+
+	cached, err := m.GetCachedAssetPrice("FUND")
+	require.NoError(t, err)
+	assert.Equal(t, 10.5, cached.Price)
+
+	_, err = m.SetPriceOverride("FUND", -1, time.Time{})
+	assert.Error(t, err)
+
+	require.NoError(t, m.DeletePriceOverride("FUND"))
+	_, err = m.GetAssetPrice("FUND")
+	assert.Error(t, err)
+}
+
+func TestManualPriceFallbackWhenSourcesFail(t *testing.T) {
+	config.SetConfig(&config.Config{MarketData: config.MarketDataConfig{ManualPriceStaleAfter: 30}})
+	defer config.SetConfig(nil)
+
+	yahoo := &fakeSource{price: 3, timestamp: time.Now().Unix()}
+	m := newCacheTestManager(t, yahoo)
+	_, err := m.SetPriceOverride("C31", 2.9, time.Now().AddDate(0, 0, -40))
+	require.NoError(t, err)
+
+	// the sources win while they serve a price
+	data, err := m.GetAssetPrice("C31")
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, data.Price)
+
+	// the manual price is served when they all fail, flagged as stale past the configured age
+	yahoo.err = errors.New("unavailable")
+	data, err = m.GetAssetPrice("C31")
+	require.NoError(t, err)
+	assert.Equal(t, 2.9, data.Price)
+	assert.True(t, data.Stale)
+}
+
+func TestImportPriceOverrides(t *testing.T) {
+	m := newCacheTestManager(t, &fakeSource{err: errors.New("unavailable")})
+	m.rdata.(*mocks.MockReferenceManager).AddTicker(rdata.TickerReference{ID: "FUND", AssetClass: rdata.AssetClassEquities, Ccy: "USD", DataSource: rdata.DataSourceManual})
+
+	imported, err := m.ImportPriceOverrides("FUND", strings.NewReader("Date,Price\n2024-01-31,10.1\n2024-02-29,10.3\n2024-03-31,10.2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, imported)
+
+	// a later upload replaces the price of the same day
+	_, err = m.ImportPriceOverrides("FUND", strings.NewReader("Date,Price\n2024-03-31,10.25\n"))
+	require.NoError(t, err)
+
+	bars, err := m.GetHistoricalData("FUND", unix("2024-02-01"), unix("2024-04-30"))
+	require.NoError(t, err)
+	require.Len(t, bars, 2)
+	assert.Equal(t, 10.3, bars[0].Price)
+	assert.Equal(t, 10.25, bars[1].Price)
+
+	// invalid rows reject the whole upload
+	_, err = m.ImportPriceOverrides("FUND", strings.NewReader("Date,Price\n2024-04-30,10.4\n30/05/2024,10.5\n2024-06-30,abc\n"))
+	assert.ErrorContains(t, err, "line 2")
+	assert.ErrorContains(t, err, "line 3")
+	all, err := m.GetPriceOverrides("FUND")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	_, err = m.ImportPriceOverrides("FUND", strings.NewReader("Day,Nav\n"))
+	assert.Error(t, err)
+}
+
+func TestPriceOverridesAdminOnly(t *testing.T) {
+	m := newCacheTestManager(t, &fakeSource{price: 3})
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, m)
+
+	serve := func(method string, user *types.User) int {
+		req := httptest.NewRequest(method, "/api/v1/mdata/price/override/FUND", strings.NewReader(`{"price":10.5}`))
+		req = req.WithContext(context.WithValue(req.Context(), types.UserKey, user))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	viewer := &types.User{Name: "bob", Books: []string{"traderA"}}
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, viewer))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, viewer))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, viewer))
+	prices, err := m.GetPriceOverrides("FUND")
+	require.NoError(t, err)
+	assert.Empty(t, prices)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, &types.User{Name: "alice", Admin: true}))
+}
+
+func TestDerivativesPricedFromYahoo(t *testing.T) {
+	assert.Equal(t, []string{sources.YahooFinance}, priceSources(rdata.AssetClassDerivatives))
+}
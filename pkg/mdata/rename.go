@@ -0,0 +1,99 @@
+package mdata
+
+import (
+	"fmt"
+	"sort"
+
+	"portfolio-manager/internal/audit"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// MoveDividendsMetadata moves the dividends metadata stored under the data source tickers of from to the matching
+// data source tickers of to, and the custom dividends and withholding tax override of from to to, e.g. after a change
+// of symbol. Entries already stored under to win on the same ex date, and an override of to is kept.
+// The moved keys are returned as "from -> to", and in dry run mode nothing is changed.
+func (m *Manager) MoveDividendsMetadata(from, to rdata.TickerReference, dryRun bool) ([]string, error) {
+	if m.db == nil {
+		return nil, nil
+	}
+
+	var moved []string
+	for _, move := range []struct {
+		prefix   string
+		from, to string
+	}{
+		{string(types.DividendsKeyPrefix), from.DividendsSgTicker, to.DividendsSgTicker},
+		{string(types.DividendsKeyPrefix), from.YahooTicker, to.YahooTicker},
+		{string(types.CustomDividendsKeyPrefix), from.ID, to.ID},
+	} {
+		pair := [2]string{move.from, move.to}
+		if pair[0] == "" || pair[1] == "" || pair[0] == pair[1] {
+			continue
+		}
+
+		fromKey := fmt.Sprintf("%s:%s", move.prefix, pair[0])
+		toKey := fmt.Sprintf("%s:%s", move.prefix, pair[1])
+		var fromDividends []types.DividendsMetadata
+		if err := m.db.Get(fromKey, &fromDividends); err != nil || len(fromDividends) == 0 {
+			continue
+		}
+		moved = append(moved, fmt.Sprintf("%s -> %s", fromKey, toKey))
+		if dryRun {
+			continue
+		}
+
+		var toDividends []types.DividendsMetadata
+		m.db.Get(toKey, &toDividends)
+		db := audit.WithSource(m.db, audit.SourceMigration)
+		if err := db.Put(toKey, mergeDividends(toDividends, fromDividends, pair[1])); err != nil {
+			return nil, err
+		}
+		if err := db.Delete(fromKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if from.ID != "" && to.ID != "" && from.ID != to.ID {
+		fromKey, toKey := withholdingTaxKey(from.ID), withholdingTaxKey(to.ID)
+		var rate float64
+		if err := m.db.Get(fromKey, &rate); err == nil {
+			moved = append(moved, fmt.Sprintf("%s -> %s", fromKey, toKey))
+			if !dryRun {
+				db := audit.WithSource(m.db, audit.SourceMigration)
+				var existing float64
+				if err := m.db.Get(toKey, &existing); err != nil {
+					if err := db.Put(toKey, rate); err != nil {
+						return nil, err
+					}
+				}
+				if err := db.Delete(fromKey); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return moved, nil
+}
+
+// mergeDividends merges the moved dividends into the existing ones by ex date, restamping them with the ticker.
+func mergeDividends(existing, moved []types.DividendsMetadata, ticker string) []types.DividendsMetadata {
+	exDates := make(map[string]struct{}, len(existing))
+	for _, dividend := range existing {
+		exDates[dividend.ExDate] = struct{}{}
+	}
+
+	merged := existing
+	for _, dividend := range moved {
+		if _, ok := exDates[dividend.ExDate]; ok {
+			continue
+		}
+		dividend.Ticker = ticker
+		merged = append(merged, dividend)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ExDate < merged[j].ExDate
+	})
+	return merged
+}
@@ -0,0 +1,159 @@
+package sources
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"portfolio-manager/pkg/common"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+
+	"github.com/patrickmn/go-cache"
+)
+
+const coinGeckoBaseURL = "https://api.coingecko.com/api/v3"
+
+type coinGecko struct {
+	client  *http.Client
+	cache   *cache.Cache
+	limiter *common.RateLimiter
+	logger  *logging.Logger
+}
+
+// NewCoinGecko creates a new CoinGecko data source for cryptocurrencies, caching prices for cacheTTL.
+// Tickers are CoinGecko coin ids, optionally suffixed with the quote currency, e.g. bitcoin or bitcoin:sgd.
+// Prices are quoted in USD unless another currency is requested, in which case CoinGecko converts from USD.
+func NewCoinGecko(cacheTTL time.Duration) types.DataSource {
+	return &coinGecko{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		cache:   cache.New(cacheTTL, 2*cacheTTL),
+		limiter: common.GetRateLimiter(CoinGecko, DefaultCoinGeckoRateLimit),
+		logger:  logging.GetLogger(),
+	}
+}
+
+// GetDividendsMetadata implements types.DataSource, cryptocurrencies do not pay dividends.
+func (src *coinGecko) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
+	return nil, errors.New("dividends not supported for coingecko data source")
+}
+
+func (src *coinGecko) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	if cachedData, found := src.cache.Get(ticker); found {
+		src.logger.Infof("Returning cached data for ticker: %s", ticker)
+		return cachedData.(*types.AssetData), nil
+	}
+
+	coinID, ccy := parseCoinGeckoTicker(ticker)
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s", coinGeckoBaseURL, coinID, ccy)
+
+	var response map[string]map[string]float64
+	if err := src.fetch(coinID, url, &response); err != nil {
+		return nil, err
+	}
+
+	prices, ok := response[coinID]
+	if !ok {
+		return nil, fmt.Errorf("unknown coingecko coin id: %s", coinID)
+	}
+	price, ok := prices[ccy]
+	if !ok {
+		return nil, fmt.Errorf("coingecko has no %s price for coin id: %s", strings.ToUpper(ccy), coinID)
+	}
+
+	assetData := &types.AssetData{
+		Ticker:    ticker,
+		Price:     price,
+		Currency:  strings.ToUpper(ccy),
+		Timestamp: time.Now().Unix(),
+	}
+
+	src.cache.Set(ticker, assetData, cache.DefaultExpiration)
+
+	return assetData, nil
+}
+
+// GetHistoricalData returns the daily closes, i.e. the last price of each UTC day, within the date range.
+func (src *coinGecko) GetHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error) {
+	coinID, ccy := parseCoinGeckoTicker(ticker)
+	url := fmt.Sprintf("%s/coins/%s/market_chart/range?vs_currency=%s&from=%d&to=%d",
+		coinGeckoBaseURL, coinID, ccy, fromDate, toDate)
+
+	var response struct {
+		Prices [][2]float64 `json:"prices"` // [unix millis, price]
+	}
+	if err := src.fetch(coinID, url, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Prices) == 0 {
+		return nil, fmt.Errorf("no historical data found for coin id: %s", coinID)
+	}
+
+	var data []*types.AssetData
+	for _, point := range response.Prices {
+		timestamp := int64(point[0]) / 1000
+		close := &types.AssetData{
+			Ticker:    ticker,
+			Price:     point[1],
+			Currency:  strings.ToUpper(ccy),
+			Timestamp: timestamp,
+		}
+
+		// prices are ordered by time, the last price of the day replaces earlier ones
+		if len(data) > 0 && sameUTCDay(data[len(data)-1].Timestamp, timestamp) {
+			data[len(data)-1] = close
+		} else {
+			data = append(data, close)
+		}
+	}
+
+	return data, nil
+}
+
+// fetch performs a rate limited GET request for the coin and decodes the JSON response into v.
+func (src *coinGecko) fetch(coinID, url string, v interface{}) error {
+	src.limiter.Wait()
+
+	req, err := common.NewHttpRequestWithUserAgent("GET", url)
+	if err != nil {
+		return err
+	}
+
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("unknown coingecko coin id: %s", coinID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("coingecko API returned status code: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// parseCoinGeckoTicker splits a ticker such as bitcoin:sgd into the coin id and quote currency, defaulting to usd.
+func parseCoinGeckoTicker(ticker string) (string, string) {
+	coinID, ccy, found := strings.Cut(strings.ToLower(ticker), ":")
+	if !found || ccy == "" {
+		ccy = "usd"
+	}
+	return coinID, ccy
+}
+
+func sameUTCDay(a, b int64) bool {
+	return time.Unix(a, 0).UTC().Format("2006-01-02") == time.Unix(b, 0).UTC().Format("2006-01-02")
+}
@@ -0,0 +1,45 @@
+//go:build integration
+
+package sources_test
+
+import (
+	"testing"
+	"time"
+
+	"portfolio-manager/pkg/mdata/sources"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoinGecko_GetAssetPrice_Integration(t *testing.T) {
+	cg := sources.NewCoinGecko(time.Minute)
+
+	quote, err := cg.GetAssetPrice("bitcoin")
+	require.NoError(t, err)
+	assert.NotZero(t, quote.Price)
+	assert.Equal(t, "USD", quote.Currency)
+
+	quote, err = cg.GetAssetPrice("bitcoin:sgd")
+	require.NoError(t, err)
+	assert.Equal(t, "SGD", quote.Currency)
+}
+
+func TestCoinGecko_UnknownCoin_Integration(t *testing.T) {
+	cg := sources.NewCoinGecko(time.Minute)
+
+	_, err := cg.GetAssetPrice("not-a-real-coin-id")
+	assert.ErrorContains(t, err, "unknown coingecko coin id")
+}
+
+func TestCoinGecko_GetHistoricalData_Integration(t *testing.T) {
+	cg := sources.NewCoinGecko(time.Minute)
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -7)
+
+	data, err := cg.GetHistoricalData("ethereum", start.Unix(), end.Unix())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(data), 7)
+	assert.LessOrEqual(t, len(data), 8) // one close per day
+}
@@ -5,6 +5,7 @@ import (
 	"math"
 	"net/http"
 	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/common"
 	"portfolio-manager/pkg/logging"
 	"portfolio-manager/pkg/types"
 	"sort"
@@ -17,14 +18,16 @@ import (
 )
 
 type DividendsSg struct {
-	db    dal.Database
-	cache *cache.Cache
+	db      dal.Database
+	cache   *cache.Cache
+	limiter *common.RateLimiter
 }
 
 func NewDividendsSg(db dal.Database) *DividendsSg {
 	return &DividendsSg{
-		db:    db,
-		cache: cache.New(24*time.Hour, 1*time.Hour),
+		db:      db,
+		cache:   cache.New(24*time.Hour, 1*time.Hour),
+		limiter: common.GetRateLimiter(DividendsSingapore, DefaultDividendsSgRateLimit),
 	}
 }
 
@@ -38,7 +41,7 @@ func (src *DividendsSg) GetAssetPrice(symbol string) (*types.AssetData, error) {
 	panic("unimplemented")
 }
 
-func (src *DividendsSg) GetDividendsMetadata(ticker string, withholdingTax float64) ([]types.DividendsMetadata, error) {
+func (src *DividendsSg) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
 	logger := logging.GetLogger()
 
 	// Check cache first
@@ -56,6 +59,7 @@ func (src *DividendsSg) GetDividendsMetadata(ticker string, withholdingTax float
 
 	url := fmt.Sprintf("https://www.dividends.sg/view/%s", ticker)
 
+	src.limiter.Wait()
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch dividends: %w", err)
@@ -73,6 +77,7 @@ func (src *DividendsSg) GetDividendsMetadata(ticker string, withholdingTax float
 
 	// Use map to aggregate dividends by date
 	dividendMap := make(map[string]float64)
+	payDates := make(map[string]string)
 
 	doc.Find("table.table-bordered tr").Each(func(i int, s *goquery.Selection) {
 		// Skip header row
@@ -115,16 +120,21 @@ func (src *DividendsSg) GetDividendsMetadata(ticker string, withholdingTax float
 
 		// Add amount to existing date or create new entry
 		dividendMap[dateStr] += amount
+
+		// Pay date follows the ex-date
+		if payDate := strings.TrimSpace(cells.Eq(dateIdx + 1).Text()); isDate(payDate) {
+			payDates[dateStr] = payDate
+		}
 	})
 
 	// Convert map to sorted slice
 	var dividends []types.DividendsMetadata
 	for date, amount := range dividendMap {
 		dividends = append(dividends, types.DividendsMetadata{
-			Ticker:         ticker,
-			ExDate:         date,
-			Amount:         math.Round(amount*1000) / 1000,
-			WithholdingTax: withholdingTax}) // sg dividends have no withholding tax
+			Ticker:  ticker,
+			ExDate:  date,
+			PayDate: payDates[date],
+			Amount:  math.Round(amount*1000) / 1000})
 	}
 
 	// Sort dividends by date string (works because format is yyyy-mm-dd)
@@ -145,3 +155,9 @@ func (src *DividendsSg) GetDividendsMetadata(ticker string, withholdingTax float
 
 	return dividends, nil
 }
+
+// isDate returns whether s is a date in yyyy-mm-dd format.
+func isDate(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
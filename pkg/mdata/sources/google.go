@@ -14,7 +14,8 @@ import (
 )
 
 type googleFinance struct {
-	client *http.Client
+	client  *http.Client
+	limiter *common.RateLimiter
 }
 
 // NewGoogleFinance creates a new Google Finance data source
@@ -23,11 +24,12 @@ func NewGoogleFinance() types.DataSource {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		limiter: common.GetRateLimiter(GoogleFinance, DefaultGoogleRateLimit),
 	}
 }
 
 // GetDividends implements types.DataSource.
-func (src *googleFinance) GetDividendsMetadata(ticker string, witholdingTax float64) ([]types.DividendsMetadata, error) {
+func (src *googleFinance) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
 	panic("unimplemented")
 }
 
@@ -39,6 +41,7 @@ func (src *googleFinance) GetAssetPrice(ticker string) (*types.AssetData, error)
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	src.limiter.Wait()
 	resp, err := src.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch data: %w", err)
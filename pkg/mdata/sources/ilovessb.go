@@ -14,9 +14,10 @@ import (
 )
 
 type ILoveSsb struct {
-	db     dal.Database
-	url    string
-	logger *logging.Logger
+	db      dal.Database
+	url     string
+	limiter *common.RateLimiter
+	logger  *logging.Logger
 }
 
 type SsbData struct {
@@ -27,9 +28,10 @@ type SsbData struct {
 
 func NewILoveSsb(db dal.Database) *ILoveSsb {
 	return &ILoveSsb{
-		db:     db,
-		url:    "https://www.ilovessb.com/historical-rates",
-		logger: logging.GetLogger(),
+		db:      db,
+		url:     "https://www.ilovessb.com/historical-rates",
+		limiter: common.GetRateLimiter(SSB, DefaultSsbRateLimit),
+		logger:  logging.GetLogger(),
 	}
 }
 
@@ -64,7 +66,7 @@ func (src *ILoveSsb) GetAssetPrice(ticker string) (*types.AssetData, error) {
 	}, nil
 }
 
-func (src *ILoveSsb) GetDividendsMetadata(ticker string, withholdingTax float64) ([]types.DividendsMetadata, error) {
+func (src *ILoveSsb) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
 	if !common.IsSSB(ticker) {
 		return nil, fmt.Errorf("invalid SSB ticker: %s", ticker)
 	}
@@ -79,6 +81,7 @@ func (src *ILoveSsb) GetDividendsMetadata(ticker string, withholdingTax float64)
 		}
 	}
 
+	src.limiter.Wait()
 	resp, err := http.Get(src.url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch ssb interest rates: %w", err)
@@ -172,12 +175,11 @@ func (src *ILoveSsb) GetDividendsMetadata(ticker string, withholdingTax float64)
 	for issuanceName, data := range ssbDataMap {
 		for i := 0; i < totalCoupons; i++ {
 			dividends = append(dividends, types.DividendsMetadata{
-				Ticker:         issuanceName,
-				ExDate:         data.CouponDates[i],
-				Amount:         data.InterestRates[i] / 2,    // interest per $100 notional (bi-annual dividends)
-				Interest:       data.InterestRates[i],        // interest in percentage
-				AvgInterest:    data.AverageReturnPerYear[i], // average interest in percentage
-				WithholdingTax: withholdingTax,
+				Ticker:      issuanceName,
+				ExDate:      data.CouponDates[i],
+				Amount:      data.InterestRates[i] / 2,    // interest per $100 notional (bi-annual dividends)
+				Interest:    data.InterestRates[i],        // interest in percentage
+				AvgInterest: data.AverageReturnPerYear[i], // average interest in percentage
 			})
 		}
 		if ticker == issuanceName {
@@ -13,7 +13,7 @@ import (
 func TestILoveSsb_GetDividendsMetadata_Integration(t *testing.T) {
 	src := sources.NewILoveSsb(nil)
 
-	coupons, err := src.GetDividendsMetadata("SBMAR24", 0.0)
+	coupons, err := src.GetDividendsMetadata("SBMAR24")
 	require.NoError(t, err)
 	require.NotEmpty(t, coupons)
 	assert.Equal(t, 20, len(coupons))
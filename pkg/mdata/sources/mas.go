@@ -12,10 +12,11 @@ import (
 )
 
 type Mas struct {
-	client *http.Client
-	db     dal.Database
-	url    string
-	logger *logging.Logger
+	client  *http.Client
+	db      dal.Database
+	url     string
+	limiter *common.RateLimiter
+	logger  *logging.Logger
 }
 
 func NewMas(db dal.Database) *Mas {
@@ -23,9 +24,10 @@ func NewMas(db dal.Database) *Mas {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		db:     db,
-		url:    "https://eservices.mas.gov.sg/statistics/api/v1/bondsandbills/m/listauctionbondsandbills?rows=1",
-		logger: logging.GetLogger(),
+		db:      db,
+		url:     "https://eservices.mas.gov.sg/statistics/api/v1/bondsandbills/m/listauctionbondsandbills?rows=1",
+		limiter: common.GetRateLimiter(MAS, DefaultMasRateLimit),
+		logger:  logging.GetLogger(),
 	}
 }
 
@@ -60,7 +62,7 @@ func (src *Mas) GetAssetPrice(ticker string) (*types.AssetData, error) {
 	}, nil
 }
 
-func (src *Mas) GetDividendsMetadata(ticker string, withholdingTax float64) ([]types.DividendsMetadata, error) {
+func (src *Mas) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
 	if !common.IsSgTBill(ticker) {
 		return nil, fmt.Errorf("invalid sg tbill ticker: %s", ticker)
 	}
@@ -81,6 +83,7 @@ func (src *Mas) GetDividendsMetadata(ticker string, withholdingTax float64) ([]t
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	src.limiter.Wait()
 	resp, err := src.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch sg tbill interest rates: %w", err)
@@ -112,12 +115,11 @@ func (src *Mas) GetDividendsMetadata(ticker string, withholdingTax float64) ([]t
 
 	result := response.Result.Records[0]
 	dividends := []types.DividendsMetadata{{
-		Ticker:         ticker,
-		ExDate:         result.IssueDate,
-		Amount:         100 - result.CutoffPrice,
-		Interest:       result.CutoffYield, // interest in percentage
-		AvgInterest:    result.CutoffYield, // interest in percentage
-		WithholdingTax: withholdingTax,
+		Ticker:      ticker,
+		ExDate:      result.IssueDate,
+		Amount:      100 - result.CutoffPrice,
+		Interest:    result.CutoffYield, // interest in percentage
+		AvgInterest: result.CutoffYield, // interest in percentage
 	}}
 
 	// For issuance that are not found in leveldb, store it into level db
@@ -0,0 +1,156 @@
+package sources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/common"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+	"time"
+)
+
+// ssbTenorYears is the tenor of every SSB, coupons are paid every 6 months until maturity
+const ssbTenorYears = 10
+
+// masSsb fetches the step-up coupon schedule of SSBs from the MAS savings bonds API.
+type masSsb struct {
+	client  *http.Client
+	db      dal.Database
+	url     string
+	limiter *common.RateLimiter
+	logger  *logging.Logger
+}
+
+func NewMasSsb(db dal.Database) types.DataSource {
+	return &masSsb{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		db:      db,
+		url:     "https://eservices.mas.gov.sg/statistics/api/v1/bondsandbills/m/savingsbondsinterestrates?rows=1",
+		limiter: common.GetRateLimiter(MAS, DefaultMasRateLimit), // same host as MAS bills
+		logger:  logging.GetLogger(),
+	}
+}
+
+// GetHistoricalData implements types.DataSource. SSB is always traded at par value.
+func (src *masSsb) GetHistoricalData(ticker string, fromDate int64, toDate int64) ([]*types.AssetData, error) {
+	var historicalData []*types.AssetData
+	startDate := time.Unix(fromDate, 0)
+	endDate := time.Unix(toDate, 0)
+
+	for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			historicalData = append(historicalData, &types.AssetData{
+				Ticker:    ticker,
+				Price:     100.0,
+				Currency:  "SGD",
+				Timestamp: d.Unix(),
+			})
+		}
+	}
+
+	return historicalData, nil
+}
+
+// GetAssetPrice implements types.DataSource. SSB is always traded at par value.
+func (src *masSsb) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	return &types.AssetData{
+		Ticker:    ticker,
+		Price:     100.0,
+		Currency:  "SGD",
+		Timestamp: time.Now().Unix(),
+	}, nil
+}
+
+// GetDividendsMetadata implements types.DataSource, returning the 20 semi-annual coupons of the SSB issue code, e.g.
+// SBJAN25, with ex dates every 6 months from the issue date. The last coupon is paid on maturity.
+func (src *masSsb) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
+	if !common.IsSSB(ticker) {
+		return nil, fmt.Errorf("invalid SSB ticker: %s", ticker)
+	}
+
+	// fetch from db, if exist, then don't need to hit the actual data source
+	if src.db != nil {
+		var dividends []types.DividendsMetadata
+		src.db.Get(fmt.Sprintf("%s:%s", types.DividendsKeyPrefix, ticker), &dividends)
+		if len(dividends) > 0 {
+			src.logger.Infof("Found SSB coupons for ticker %s in database", ticker)
+			return dividends, nil
+		}
+	}
+
+	url := fmt.Sprintf("%s&filters=issue_code:%s", src.url, ticker)
+	req, err := common.NewHttpRequestWithUserAgent("GET", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	src.limiter.Wait()
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ssb interest rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch coupon payments: status code %d", resp.StatusCode)
+	}
+
+	// coupons and average returns are published per year, as year1_coupon to year10_coupon and year1_return to
+	// year10_return
+	var response struct {
+		Result struct {
+			Records []map[string]any `json:"records"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(response.Result.Records) == 0 {
+		return nil, fmt.Errorf("no data found for ticker: %s", ticker)
+	}
+
+	dividends, err := ssbCoupons(ticker, response.Result.Records[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if src.db != nil {
+		src.logger.Infof("New coupons for ticker %s, storing into database", ticker)
+		src.db.Put(fmt.Sprintf("%s:%s", types.DividendsKeyPrefix, ticker), dividends)
+	}
+
+	return dividends, nil
+}
+
+// ssbCoupons builds the semi-annual coupons of the SSB from its MAS record.
+func ssbCoupons(ticker string, record map[string]any) ([]types.DividendsMetadata, error) {
+	issueDateStr, _ := record["issue_date"].(string)
+	issueDate, err := time.Parse("2006-01-02", issueDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issue date %q of ticker %s", issueDateStr, ticker)
+	}
+
+	var dividends []types.DividendsMetadata
+	for year := 1; year <= ssbTenorYears; year++ {
+		coupon, ok := record[fmt.Sprintf("year%d_coupon", year)].(float64)
+		if !ok {
+			return nil, fmt.Errorf("missing year %d coupon of ticker %s", year, ticker)
+		}
+		avgReturn, _ := record[fmt.Sprintf("year%d_return", year)].(float64)
+
+		for half := 1; half <= 2; half++ {
+			dividends = append(dividends, types.DividendsMetadata{
+				Ticker:      ticker,
+				ExDate:      issueDate.AddDate(0, 6*(2*(year-1)+half), 0).Format("2006-01-02"),
+				Amount:      coupon / 2, // interest per $100 notional (bi-annual dividends)
+				Interest:    coupon,     // interest in percentage
+				AvgInterest: avgReturn,  // average interest in percentage
+			})
+		}
+	}
+	return dividends, nil
+}
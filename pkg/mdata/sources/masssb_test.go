@@ -0,0 +1,21 @@
+//go:build integration
+
+package sources_test
+
+import (
+	"portfolio-manager/pkg/mdata/sources"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMasSsb_GetDividendsMetadata_Integration(t *testing.T) {
+	src := sources.NewMasSsb(nil)
+
+	coupons, err := src.GetDividendsMetadata("SBMAR24")
+	require.NoError(t, err)
+	require.Len(t, coupons, 20)
+	assert.Equal(t, "2024-09-01", coupons[0].ExDate)
+	assert.Equal(t, "2034-03-01", coupons[19].ExDate)
+}
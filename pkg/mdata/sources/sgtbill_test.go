@@ -13,7 +13,7 @@ import (
 func TestMas_GetDividendsMetadata_Integration(t *testing.T) {
 	src := sources.NewMas(nil)
 
-	coupons, err := src.GetDividendsMetadata("BS24124Z", 0.0)
+	coupons, err := src.GetDividendsMetadata("BS24124Z")
 	require.NoError(t, err)
 	require.NotEmpty(t, coupons)
 	assert.Equal(t, 1, len(coupons))
@@ -0,0 +1,139 @@
+package sources
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"portfolio-manager/pkg/common"
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/types"
+
+	"github.com/patrickmn/go-cache"
+)
+
+const sgxPricesURL = "https://api.sgx.com/securities/v1.1?excludetypes=bonds&params=nc,cur,lt,pv,trading_time"
+
+// sgxPricesCacheKey caches the full securities price list, SGX does not support querying a single security
+const sgxPricesCacheKey = "prices"
+
+var sgxLocation = time.FixedZone("SGT", 8*60*60)
+
+type sgx struct {
+	client  *http.Client
+	cache   *cache.Cache
+	limiter *common.RateLimiter
+	logger  *logging.Logger
+}
+
+type sgxPrice struct {
+	Code        string   `json:"nc"`
+	Currency    string   `json:"cur"`
+	LastTraded  *float64 `json:"lt"`
+	PrevClose   *float64 `json:"pv"`
+	TradingTime string   `json:"trading_time"` // yyyymmdd_hhmmss in SGT
+}
+
+// NewSgx creates a new SGX data source, quoting securities listed on SGX by their stock code, e.g. C31 or C31.SI.
+func NewSgx() types.DataSource {
+	return &sgx{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		cache:   cache.New(1*time.Minute, 5*time.Minute),
+		limiter: common.GetRateLimiter(SGX, DefaultSgxRateLimit),
+		logger:  logging.GetLogger(),
+	}
+}
+
+// GetDividendsMetadata implements types.DataSource.
+func (src *sgx) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
+	return nil, errors.New("dividends not supported for sgx data source")
+}
+
+func (src *sgx) GetAssetPrice(ticker string) (*types.AssetData, error) {
+	prices, err := src.getPrices()
+	if err != nil {
+		return nil, err
+	}
+
+	code := strings.TrimSuffix(strings.ToUpper(ticker), ".SI")
+	price, ok := prices[code]
+	if !ok {
+		return nil, fmt.Errorf("no sgx price found for ticker: %s", ticker)
+	}
+
+	// fall back to the previous close when the security has not traded today
+	last := price.LastTraded
+	if last == nil {
+		last = price.PrevClose
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no sgx price found for ticker: %s", ticker)
+	}
+
+	timestamp := time.Now().Unix()
+	if tradingTime, err := time.ParseInLocation("20060102_150405", price.TradingTime, sgxLocation); err == nil {
+		timestamp = tradingTime.Unix()
+	}
+
+	currency := price.Currency
+	if currency == "" {
+		currency = "SGD"
+	}
+
+	return &types.AssetData{
+		Ticker:    ticker,
+		Price:     *last,
+		Currency:  currency,
+		Timestamp: timestamp,
+	}, nil
+}
+
+func (src *sgx) GetHistoricalData(ticker string, fromDate, toDate int64) ([]*types.AssetData, error) {
+	return nil, errors.New("historical data not supported for sgx data source")
+}
+
+// getPrices returns the latest prices of all SGX securities keyed by stock code.
+func (src *sgx) getPrices() (map[string]sgxPrice, error) {
+	if cachedData, found := src.cache.Get(sgxPricesCacheKey); found {
+		return cachedData.(map[string]sgxPrice), nil
+	}
+
+	req, err := common.NewHttpRequestWithUserAgent("GET", sgxPricesURL)
+	if err != nil {
+		return nil, err
+	}
+
+	src.limiter.Wait()
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sgx API returned status code: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Data struct {
+			Prices []sgxPrice `json:"prices"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	prices := make(map[string]sgxPrice, len(response.Data.Prices))
+	for _, price := range response.Data.Prices {
+		prices[strings.ToUpper(price.Code)] = price
+	}
+
+	src.cache.Set(sgxPricesCacheKey, prices, cache.DefaultExpiration)
+
+	return prices, nil
+}
@@ -1,5 +1,7 @@
 package sources
 
+import "time"
+
 // Supported data sources
 const (
 	GoogleFinance      = "google"
@@ -7,4 +9,18 @@ const (
 	DividendsSingapore = "dividends_sg"
 	SSB                = "i_love_ssb"
 	MAS                = "mas"
+	MasSsb             = "mas_ssb"
+	CoinGecko          = "coingecko"
+	SGX                = "sgx"
+)
+
+// Default minimum interval between requests to each data source, overridable via marketData.rateLimits in config
+const (
+	DefaultYahooRateLimit       = 250 * time.Millisecond
+	DefaultGoogleRateLimit      = 250 * time.Millisecond
+	DefaultDividendsSgRateLimit = 1 * time.Second
+	DefaultSsbRateLimit         = 1 * time.Second
+	DefaultMasRateLimit         = 1 * time.Second
+	DefaultCoinGeckoRateLimit   = 2 * time.Second // public API allows ~30 calls per minute
+	DefaultSgxRateLimit         = 1 * time.Second
 )
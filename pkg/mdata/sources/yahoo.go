@@ -18,10 +18,11 @@ import (
 )
 
 type yahooFinance struct {
-	client *http.Client
-	db     dal.Database
-	cache  *cache.Cache
-	logger *logging.Logger
+	client  *http.Client
+	db      dal.Database
+	cache   *cache.Cache
+	limiter *common.RateLimiter
+	logger  *logging.Logger
 }
 
 // NewYahooFinance creates a new Yahoo Finance data source
@@ -30,14 +31,15 @@ func NewYahooFinance(db dal.Database) types.DataSource {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		db:     db,
-		cache:  cache.New(5*time.Minute, 10*time.Minute),
-		logger: logging.GetLogger(),
+		db:      db,
+		cache:   cache.New(5*time.Minute, 10*time.Minute),
+		limiter: common.GetRateLimiter(YahooFinance, DefaultYahooRateLimit),
+		logger:  logging.GetLogger(),
 	}
 }
 
 // GetDividends implements types.DataSource.
-func (src *yahooFinance) GetDividendsMetadata(ticker string, withholdingTax float64) ([]types.DividendsMetadata, error) {
+func (src *yahooFinance) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
 	// Check cache first
 	if cachedData, found := src.cache.Get(ticker); found {
 		src.logger.Info("Returning cached dividends data for ticker:", ticker)
@@ -51,6 +53,7 @@ func (src *yahooFinance) GetDividendsMetadata(ticker string, withholdingTax floa
 		return nil, err
 	}
 
+	src.limiter.Wait()
 	resp, err := src.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch data: %w", err)
@@ -82,10 +85,9 @@ func (src *yahooFinance) GetDividendsMetadata(ticker string, withholdingTax floa
 				return
 			}
 			dividends = append(dividends, types.DividendsMetadata{
-				Ticker:         ticker,
-				ExDate:         date,
-				Amount:         amount,
-				WithholdingTax: withholdingTax,
+				Ticker: ticker,
+				ExDate: date,
+				Amount: amount,
 			})
 		}
 	})
@@ -119,6 +121,7 @@ func (src *yahooFinance) GetAssetPrice(ticker string) (*types.AssetData, error)
 		return nil, err
 	}
 
+	src.limiter.Wait()
 	resp, err := src.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch data: %w", err)
@@ -137,6 +140,7 @@ func (src *yahooFinance) GetAssetPrice(ticker string) (*types.AssetData, error)
 					Currency string  `json:"currency"`
 					Symbol   string  `json:"symbol"`
 					Price    float64 `json:"regularMarketPrice"`
+					Time     int64   `json:"regularMarketTime"`
 				} `json:"meta"`
 			} `json:"result"`
 		} `json:"chart"`
@@ -151,11 +155,15 @@ func (src *yahooFinance) GetAssetPrice(ticker string) (*types.AssetData, error)
 	}
 
 	result := response.Chart.Result[0]
+	timestamp := result.Meta.Time
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
 	stockData := &types.AssetData{
 		Ticker:    result.Meta.Symbol,
 		Price:     result.Meta.Price,
 		Currency:  result.Meta.Currency,
-		Timestamp: time.Now().Unix(),
+		Timestamp: timestamp,
 	}
 
 	src.cache.Set(ticker, stockData, cache.DefaultExpiration)
@@ -172,6 +180,7 @@ func (src *yahooFinance) GetHistoricalData(ticker string, fromDate, toDate int64
 		return nil, err
 	}
 
+	src.limiter.Wait()
 	resp, err := src.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch historical data: %w", err)
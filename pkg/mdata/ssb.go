@@ -0,0 +1,48 @@
+package mdata
+
+import (
+	"errors"
+
+	"portfolio-manager/pkg/logging"
+	"portfolio-manager/pkg/mdata/sources"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// getSsbDividendsMetadata returns the coupon schedule of the SSB from the MAS savings bonds API, falling back to
+// ILoveSsb. The maturity date of the SSB is set in reference data from its last coupon when missing, so matured SSBs
+// are auto closed.
+func (m *Manager) getSsbDividendsMetadata(tickerRef rdata.TickerReference) ([]types.DividendsMetadata, error) {
+	var coupons []types.DividendsMetadata
+	var errs []error
+	for _, name := range []string{sources.MasSsb, sources.SSB} {
+		src, ok := m.sources[name]
+		if !ok {
+			continue
+		}
+		data, err := src.GetDividendsMetadata(tickerRef.ID)
+		if err == nil && len(data) > 0 {
+			coupons = data
+			break
+		}
+		if err == nil {
+			err = errors.New("no coupons found")
+		}
+		logging.GetLogger().Warnf("Failed to fetch SSB coupons of %s from %s: %v", tickerRef.ID, name, err)
+		errs = append(errs, err)
+	}
+	if coupons == nil {
+		if len(errs) == 0 {
+			return nil, errors.New("no SSB data source")
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	if tickerRef.MaturityDate == "" && m.rdata != nil {
+		tickerRef.MaturityDate = coupons[len(coupons)-1].ExDate
+		if err := m.rdata.UpdateTicker(&tickerRef); err != nil {
+			logging.GetLogger().Warnf("Failed to set maturity date of %s: %v", tickerRef.ID, err)
+		}
+	}
+	return coupons, nil
+}
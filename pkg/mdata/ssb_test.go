@@ -0,0 +1,64 @@
+package mdata
+
+import (
+	"errors"
+	"testing"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/mdata/sources"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCouponSource struct {
+	fakeSource
+	coupons []types.DividendsMetadata
+	err     error
+}
+
+func (f *fakeCouponSource) GetDividendsMetadata(ticker string) ([]types.DividendsMetadata, error) {
+	return f.coupons, f.err
+}
+
+func TestSsbCouponsFallBackAndSetMaturity(t *testing.T) {
+	config.SetConfig(&config.Config{})
+	defer config.SetConfig(nil)
+
+	rdataMgr := mocks.NewMockReferenceManager()
+	rdataMgr.AddTicker(rdata.TickerReference{ID: "SBMAR24", AssetClass: rdata.AssetClassBonds, Ccy: "SGD", Domicile: "SG"})
+
+	masSsb := &fakeCouponSource{err: errors.New("status code 503")}
+	iLoveSsb := &fakeCouponSource{coupons: []types.DividendsMetadata{
+		{Ticker: "SBMAR24", ExDate: "2024-09-01", Amount: 1.6},
+		{Ticker: "SBMAR24", ExDate: "2034-03-01", Amount: 1.5},
+	}}
+	m := &Manager{
+		sources: map[string]types.DataSource{sources.MasSsb: masSsb, sources.SSB: iLoveSsb},
+		rdata:   rdataMgr,
+	}
+
+	coupons, err := m.GetDividendsMetadata("SBMAR24")
+	require.NoError(t, err)
+	assert.Len(t, coupons, 2)
+
+	tickerRef, err := rdataMgr.GetTicker("SBMAR24")
+	require.NoError(t, err)
+	assert.Equal(t, "2034-03-01", tickerRef.MaturityDate)
+
+	// the MAS schedule is preferred, and a maturity already in reference data is kept
+	masSsb.err = nil
+	masSsb.coupons = []types.DividendsMetadata{{Ticker: "SBMAR24", ExDate: "2034-03-01", Amount: 1.55}}
+	coupons, err = m.GetDividendsMetadata("SBMAR24")
+	require.NoError(t, err)
+	require.Len(t, coupons, 1)
+	assert.Equal(t, 1.55, coupons[0].Amount)
+
+	masSsb.err, iLoveSsb.err = errors.New("status code 503"), errors.New("failed to parse HTML")
+	iLoveSsb.coupons = nil
+	_, err = m.GetDividendsMetadata("SBMAR24")
+	assert.ErrorContains(t, err, "failed to parse HTML")
+}
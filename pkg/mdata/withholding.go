@@ -0,0 +1,94 @@
+package mdata
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+)
+
+// ResolveWithholdingTax returns the withholding tax rate on the dividends of the ticker, from its override when set,
+// otherwise from the rule of its domicile.
+func (m *Manager) ResolveWithholdingTax(tickerRef rdata.TickerReference) float64 {
+	if m.db != nil {
+		var rate float64
+		if err := m.db.Get(withholdingTaxKey(tickerRef.ID), &rate); err == nil {
+			return rate
+		}
+	}
+	return m.MapDomicileToWitholdingTax(tickerRef.Domicile)
+}
+
+// SetWithholdingTaxOverride overrides the withholding tax rate of the ticker, in decimal, e.g. 0.15 for US dividends
+// under a tax treaty. Dividends served afterwards are withheld at the rate.
+func (m *Manager) SetWithholdingTaxOverride(ticker string, rate float64) error {
+	if m.db == nil {
+		return errors.New("withholding tax overrides require a database")
+	}
+	if rate < 0 || rate >= 1 {
+		return fmt.Errorf("invalid withholding tax rate %v, expected a decimal from 0 to below 1", rate)
+	}
+	return m.db.Put(withholdingTaxKey(ticker), rate)
+}
+
+// DeleteWithholdingTaxOverride deletes the withholding tax override of the ticker, the rule of its domicile applies
+// again.
+func (m *Manager) DeleteWithholdingTaxOverride(ticker string) error {
+	if m.db == nil {
+		return nil
+	}
+	return m.db.Delete(withholdingTaxKey(ticker))
+}
+
+// GetWithholdingTaxRules returns the withholding tax rates by domicile and the overrides by ticker.
+func (m *Manager) GetWithholdingTaxRules() (types.WithholdingTaxRules, error) {
+	rules := types.WithholdingTaxRules{Domiciles: map[string]float64{}, Tickers: map[string]float64{}}
+	if cfg, err := config.GetOrCreateConfig(""); err == nil && cfg != nil {
+		for domicile, rate := range map[string]float64{
+			"SG": cfg.DivWitholdingTaxSG,
+			"US": cfg.DivWitholdingTaxUS,
+			"HK": cfg.DivWitholdingTaxHK,
+			"IE": cfg.DivWitholdingTaxIE,
+		} {
+			rules.Domiciles[domicile] = rate
+		}
+		for domicile, rate := range cfg.WithholdingTax {
+			rules.Domiciles[strings.ToUpper(domicile)] = rate
+		}
+	}
+	if m.db == nil {
+		return rules, nil
+	}
+
+	prefix := string(types.WithholdingTaxKeyPrefix) + ":"
+	keys, err := m.db.GetAllKeysWithPrefix(prefix)
+	if err != nil {
+		return rules, err
+	}
+	for _, key := range keys {
+		var rate float64
+		if err := m.db.Get(key, &rate); err != nil {
+			return rules, err
+		}
+		rules.Tickers[strings.TrimPrefix(key, prefix)] = rate
+	}
+	return rules, nil
+}
+
+// withWithholdingTax returns a copy of the dividends withheld at the rate, leaving the dividends cached by the data
+// sources untouched.
+func withWithholdingTax(dividends []types.DividendsMetadata, rate float64) []types.DividendsMetadata {
+	withheld := make([]types.DividendsMetadata, len(dividends))
+	for i, dividend := range dividends {
+		dividend.WithholdingTax = rate
+		withheld[i] = dividend
+	}
+	return withheld
+}
+
+func withholdingTaxKey(ticker string) string {
+	return fmt.Sprintf("%s:%s", types.WithholdingTaxKeyPrefix, strings.ToUpper(ticker))
+}
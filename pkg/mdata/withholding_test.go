@@ -0,0 +1,52 @@
+package mdata
+
+import (
+	"testing"
+
+	"portfolio-manager/internal/config"
+	"portfolio-manager/internal/mocks"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithholdingTaxResolvedWhenServed(t *testing.T) {
+	config.SetConfig(&config.Config{DivWitholdingTaxUS: 0.3, DivWitholdingTaxIE: 0.15, WithholdingTax: map[string]float64{"us": 0.25}})
+	defer config.SetConfig(nil)
+
+	m := newCacheTestManager(t, &fakeSource{})
+	m.rdata.(*mocks.MockReferenceManager).AddTicker(rdata.TickerReference{ID: "AAPL", YahooTicker: "AAPL", Domicile: "US"})
+	yahoo := &fakeDividendsSource{dividends: []types.DividendsMetadata{
+		{Ticker: "AAPL", ExDate: "2024-02-09", Amount: 0.24},
+		{Ticker: "AAPL", ExDate: "2024-05-10", Amount: 0.25},
+	}}
+	m.sources["yahoo"] = yahoo
+
+	// the rule of the domicile wins over the divWitholdingTax fields
+	dividends, err := m.GetDividendsMetadata("AAPL")
+	require.NoError(t, err)
+	require.Len(t, dividends, 2)
+	assert.Equal(t, 0.25, dividends[0].WithholdingTax)
+	assert.Equal(t, 0.25, dividends[1].WithholdingTax)
+
+	// an override applies to dividends already cached by the source, which are left untouched
+	assert.Error(t, m.SetWithholdingTaxOverride("AAPL", 1))
+	require.NoError(t, m.SetWithholdingTaxOverride("aapl", 0.15))
+	dividends, err = m.GetDividendsMetadata("AAPL")
+	require.NoError(t, err)
+	assert.Equal(t, 0.15, dividends[0].WithholdingTax)
+	assert.Zero(t, yahoo.dividends[0].WithholdingTax)
+
+	rules, err := m.GetWithholdingTaxRules()
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, rules.Domiciles["US"])
+	assert.Equal(t, 0.15, rules.Domiciles["IE"])
+	assert.Equal(t, map[string]float64{"AAPL": 0.15}, rules.Tickers)
+
+	require.NoError(t, m.DeleteWithholdingTaxOverride("AAPL"))
+	dividends, err = m.GetDividendsMetadata("AAPL")
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, dividends[0].WithholdingTax)
+}
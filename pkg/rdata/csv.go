@@ -0,0 +1,94 @@
+package rdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ParseTickersCSV parses ticker references from a CSV whose header names the fields as in the seed file, e.g.
+// id,name,underlying_ticker,yahoo_ticker,asset_class,ccy,domicile. Every row is validated, and the errors of all
+// invalid rows are returned together.
+func ParseTickersCSV(r io.Reader) ([]TickerReference, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	fields := make([]int, len(header))
+	fieldIdx := tickerReferenceFields()
+	for i, name := range header {
+		idx, ok := fieldIdx[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid CSV header: unknown column %s", name)
+		}
+		fields[i] = idx
+	}
+
+	var tickers []TickerReference
+	var errs []error
+	for lineNum := 1; ; lineNum++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV line %d: %w", lineNum, err)
+		}
+
+		var ticker TickerReference
+		if err := setTickerReferenceFields(&ticker, fields, row); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		if err := ticker.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		tickers = append(tickers, ticker)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return tickers, nil
+}
+
+// tickerReferenceFields maps the yaml name of each TickerReference field to its index.
+func tickerReferenceFields() map[string]int {
+	t := reflect.TypeOf(TickerReference{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		fields[t.Field(i).Tag.Get("yaml")] = i
+	}
+	return fields
+}
+
+func setTickerReferenceFields(ticker *TickerReference, fields []int, row []string) error {
+	v := reflect.ValueOf(ticker).Elem()
+	for i, value := range row {
+		field := v.Field(fields[i])
+		value = strings.TrimSpace(value)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Float64:
+			if value == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s %s: %w", v.Type().Field(fields[i]).Tag.Get("yaml"), value, err)
+			}
+			field.SetFloat(f)
+		}
+	}
+	return nil
+}
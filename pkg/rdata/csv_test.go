@@ -0,0 +1,72 @@
+package rdata_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"portfolio-manager/pkg/event"
+	"portfolio-manager/pkg/rdata"
+	"portfolio-manager/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTickersCSV(t *testing.T) {
+	csv := `id,name,underlying_ticker,yahoo_ticker,asset_class,asset_sub_class,ccy,domicile,lot_size
+ES3.SI,SPDR STI ETF,ES3,ES3.SI,eq,etf,SGD,SG,100
+AAPL,Apple,AAPL,AAPL,eq,stock,USD,US,
+`
+	tickers, err := rdata.ParseTickersCSV(strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Len(t, tickers, 2)
+	assert.Equal(t, "ES3.SI", tickers[0].ID)
+	assert.Equal(t, "etf", tickers[0].AssetSubClass)
+	assert.Equal(t, float64(100), tickers[0].LotSize)
+	assert.Equal(t, "USD", tickers[1].Ccy)
+}
+
+func TestParseTickersCSVReportsEveryInvalidRow(t *testing.T) {
+	csv := `id,name,underlying_ticker,asset_class,ccy,domicile,lot_size
+ES3.SI,SPDR STI ETF,ES3,eq,SGD,SG,100
+D05.SI,DBS,D05,unknown,SGD,SG,100
+,Apple,AAPL,eq,USD,US,abc
+`
+	tickers, err := rdata.ParseTickersCSV(strings.NewReader(csv))
+	require.Error(t, err)
+	assert.Nil(t, tickers)
+	assert.Contains(t, err.Error(), "line 2")
+	assert.Contains(t, err.Error(), "line 3")
+	assert.NotContains(t, err.Error(), "line 1")
+
+	_, err = rdata.ParseTickersCSV(strings.NewReader("id,unknown\nAAPL,x\n"))
+	assert.ErrorContains(t, err, "unknown column")
+}
+
+func TestUpdateTickerPublishesTickerChanged(t *testing.T) {
+	mockDB := new(MockDatabase)
+	mockDB.On("GetAllKeysWithPrefix", string(types.ReferenceDataKeyPrefix)).Return([]string{"key1"}, nil)
+	mockDB.On("Put", string(types.ReferenceDataKeyPrefix)+":ES3.SI", mock.Anything).Return(nil)
+
+	rm, err := rdata.NewManager(mockDB, seedFilePath)
+	require.NoError(t, err)
+
+	changed := make(chan string, 1)
+	rm.Subscribe(rdata.TickerChangedEvent, event.NewEventHandler(func(e event.Event) {
+		changed <- e.Data.(rdata.TickerChangedEventPayload).ID
+	}))
+
+	ticker := rdata.TickerReference{ID: "ES3.SI", Name: "SPDR STI ETF", UnderlyingTicker: "ES3", YahooTicker: "ES3.SI", AssetClass: rdata.AssetClassEquities, Ccy: "SGD", Domicile: "SG"}
+	require.NoError(t, rm.UpdateTicker(&ticker))
+	assert.Equal(t, float64(100), ticker.LotSize)
+	mockDB.AssertExpectations(t)
+
+	select {
+	case id := <-changed:
+		assert.Equal(t, "ES3.SI", id)
+	case <-time.After(time.Second):
+		t.Fatal("expected a ticker changed event")
+	}
+}
@@ -0,0 +1,29 @@
+package rdata
+
+import (
+	"portfolio-manager/pkg/event"
+
+	"github.com/google/uuid"
+)
+
+// Define event names
+const (
+	TickerChangedEvent = "TickerChanged"
+)
+
+// TickerChangedEventPayload represents the payload of a ticker added, updated or deleted event.
+type TickerChangedEventPayload struct {
+	ID string
+}
+
+// Subscribe subscribes to reference data events, e.g. to invalidate caches derived from a ticker reference.
+func (rm *Manager) Subscribe(eventName string, handler event.EventHandler) uuid.UUID {
+	return rm.eventBus.Subscribe(eventName, handler)
+}
+
+func (rm *Manager) publishTickerChangedEvent(id string) {
+	rm.eventBus.Publish(event.Event{
+		Name: TickerChangedEvent,
+		Data: TickerChangedEventPayload{ID: id},
+	})
+}
@@ -2,7 +2,12 @@ package rdata
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+
+	"portfolio-manager/pkg/types"
 )
 
 // @Summary Get reference data
@@ -25,6 +30,180 @@ func HandleReferenceDataGet(refSvc ReferenceManager) http.HandlerFunc {
 	}
 }
 
+// @Summary List tickers
+// @Description Lists the ticker references sorted by id, optionally filtered by asset class
+// @Tags Reference
+// @Produce json
+// @Param assetClass query string false "Asset class, e.g. eq"
+// @Success 200 {array} TickerReference
+// @Failure 500 {string} string "Failed to get tickers"
+// @Router /api/v1/rdata/tickers [get]
+func HandleTickersGet(refSvc ReferenceManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := refSvc.GetAllTickers()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		assetClass := r.URL.Query().Get("assetClass")
+		tickers := []TickerReference{}
+		for _, ticker := range data {
+			if assetClass == "" || ticker.AssetClass == assetClass {
+				tickers = append(tickers, ticker)
+			}
+		}
+		sort.Slice(tickers, func(i, j int) bool {
+			return tickers[i].ID < tickers[j].ID
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tickers)
+	}
+}
+
+// @Summary Get a ticker
+// @Description Retrieves the reference data of a ticker
+// @Tags Reference
+// @Produce json
+// @Param id path string true "Ticker id, e.g. ES3.SI"
+// @Success 200 {object} TickerReference
+// @Failure 404 {string} string "Ticker not found"
+// @Router /api/v1/rdata/ticker/{id} [get]
+func HandleTickerGet(refSvc ReferenceManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := tickerIDFromPath(r)
+		ticker, err := refSvc.GetTicker(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ticker %s not found", id), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ticker)
+	}
+}
+
+// @Summary Create or update a ticker
+// @Description Creates or replaces the reference data of a ticker, the id in the path takes precedence. Admin only.
+// @Tags Reference
+// @Accept json
+// @Produce json
+// @Param id path string true "Ticker id, e.g. ES3.SI"
+// @Param ticker body TickerReference true "Ticker reference"
+// @Success 200 {object} TickerReference
+// @Failure 400 {string} string "Invalid ticker reference"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/rdata/ticker/{id} [put]
+func HandleTickerPut(refSvc ReferenceManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		var ticker TickerReference
+		if err := json.NewDecoder(r.Body).Decode(&ticker); err != nil {
+			http.Error(w, "invalid request payload", http.StatusBadRequest)
+			return
+		}
+		ticker.ID = tickerIDFromPath(r)
+
+		if err := ticker.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := refSvc.UpdateTicker(&ticker); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ticker)
+	}
+}
+
+// @Summary Delete a ticker
+// @Description Deletes the reference data of a ticker. Admin only.
+// @Tags Reference
+// @Param id path string true "Ticker id, e.g. ES3.SI"
+// @Success 204 {string} string "No Content"
+// @Failure 403 {string} string "Admin only"
+// @Failure 404 {string} string "Ticker not found"
+// @Router /api/v1/rdata/ticker/{id} [delete]
+func HandleTickerDelete(refSvc ReferenceManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		id := tickerIDFromPath(r)
+		if _, err := refSvc.GetTicker(id); err != nil {
+			http.Error(w, fmt.Sprintf("ticker %s not found", id), http.StatusNotFound)
+			return
+		}
+		if err := refSvc.DeleteTicker(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary Bulk upload tickers
+// @Description Creates or replaces ticker references from a CSV whose header names the fields as in the seed file, e.g. id,name,underlying_ticker,yahoo_ticker,asset_class,ccy,domicile. Nothing is imported if any row is invalid. Admin only.
+// @Tags Reference
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV file"
+// @Success 200 {array} TickerReference
+// @Failure 400 {string} string "Invalid CSV"
+// @Failure 403 {string} string "Admin only"
+// @Router /api/v1/rdata/upload [post]
+func HandleTickersUpload(refSvc ReferenceManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "failed to get file from request", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		tickers, err := ParseTickersCSV(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for i := range tickers {
+			if err := refSvc.UpdateTicker(&tickers[i]); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tickers)
+	}
+}
+
+// isAdmin returns whether the user of the request is an admin, rejecting the request otherwise.
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if user := types.UserFromContext(r.Context()); user != nil && !user.Admin {
+		http.Error(w, "admin only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func tickerIDFromPath(r *http.Request) string {
+	return strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/api/v1/rdata/ticker/"))
+}
+
 // RegisterHandlers registers the handlers for the reference data service
 func RegisterHandlers(mux *http.ServeMux, refSvc ReferenceManager) {
 	mux.HandleFunc("/api/v1/refdata", func(w http.ResponseWriter, r *http.Request) {
@@ -35,4 +214,39 @@ func RegisterHandlers(mux *http.ServeMux, refSvc ReferenceManager) {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+
+	mux.HandleFunc("/api/v1/rdata/tickers", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			HandleTickersGet(refSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/rdata/ticker/", func(w http.ResponseWriter, r *http.Request) {
+		if tickerIDFromPath(r) == "" {
+			http.Error(w, "ticker id is required", http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			HandleTickerGet(refSvc).ServeHTTP(w, r)
+		case http.MethodPut:
+			HandleTickerPut(refSvc).ServeHTTP(w, r)
+		case http.MethodDelete:
+			HandleTickerDelete(refSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/rdata/upload", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			HandleTickersUpload(refSvc).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 }
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"portfolio-manager/internal/audit"
 	"portfolio-manager/internal/dal"
 	"portfolio-manager/pkg/common"
+	"portfolio-manager/pkg/event"
 	"portfolio-manager/pkg/logging"
 	"portfolio-manager/pkg/types"
 
@@ -21,11 +23,12 @@ type ReferenceManager interface {
 }
 
 type Manager struct {
-	db dal.Database
+	db       dal.Database
+	eventBus *event.EventBus
 }
 
 func NewManager(db dal.Database, filePath string) (*Manager, error) {
-	rm := &Manager{db: db}
+	rm := &Manager{db: db, eventBus: event.NewEventBus()}
 
 	// Check if the database is empty and seed it if necessary
 	isEmpty, err := rm.isDatabaseEmpty()
@@ -66,8 +69,10 @@ func (rm *Manager) seedReferenceData(filePath string) error {
 		return err
 	}
 
+	// seeded tickers are attributed to a migration in the audit log
+	seeder := &Manager{db: audit.WithSource(rm.db, audit.SourceMigration), eventBus: rm.eventBus}
 	for _, ticker := range tickers {
-		_, err := rm.AddTicker(ticker)
+		_, err := seeder.AddTicker(ticker)
 		if err != nil {
 			return err
 		}
@@ -77,10 +82,13 @@ func (rm *Manager) seedReferenceData(filePath string) error {
 }
 
 func (rm *Manager) AddTicker(ticker TickerReference) (string, error) {
+	ticker.LotSize = ticker.GetLotSize()
+	ticker.ContractMultiplier = ticker.GetContractMultiplier()
 	err := rm.db.Put(fmt.Sprintf("%s:%s", types.ReferenceDataKeyPrefix, ticker.ID), ticker)
 	if err != nil {
 		return "", err
 	}
+	rm.publishTickerChangedEvent(ticker.ID)
 	return ticker.ID, nil
 }
 
@@ -88,11 +96,23 @@ func (rm *Manager) UpdateTicker(ticker *TickerReference) error {
 	if ticker.ID == "" {
 		return errors.New("ticker ID is required")
 	}
-	return rm.db.Put(ticker.ID, ticker)
+	ticker.LotSize = ticker.GetLotSize()
+	ticker.ContractMultiplier = ticker.GetContractMultiplier()
+	err := rm.db.Put(fmt.Sprintf("%s:%s", types.ReferenceDataKeyPrefix, ticker.ID), ticker)
+	if err != nil {
+		return err
+	}
+	rm.publishTickerChangedEvent(ticker.ID)
+	return nil
 }
 
 func (rm *Manager) DeleteTicker(id string) error {
-	return rm.db.Delete(fmt.Sprintf("%s:%s", types.ReferenceDataKeyPrefix, id))
+	err := rm.db.Delete(fmt.Sprintf("%s:%s", types.ReferenceDataKeyPrefix, id))
+	if err != nil {
+		return err
+	}
+	rm.publishTickerChangedEvent(id)
+	return nil
 }
 
 func (rm *Manager) GetTicker(id string) (TickerReference, error) {
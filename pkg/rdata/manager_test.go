@@ -1,9 +1,14 @@
 package rdata_test
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"portfolio-manager/internal/dal"
 	"portfolio-manager/pkg/rdata"
 	"portfolio-manager/pkg/types"
 
@@ -35,6 +40,16 @@ func (m *MockDatabase) Delete(key string) error {
 	return args.Error(0)
 }
 
+func (m *MockDatabase) Iterate(prefix string, fn func(key string, value []byte) error) error {
+	args := m.Called(prefix, fn)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) Batch() dal.Batch {
+	args := m.Called()
+	return args.Get(0).(dal.Batch)
+}
+
 func (m *MockDatabase) Close() error { return nil }
 
 var seedFilePath = "../../seed/refdata.yaml"
@@ -70,3 +85,51 @@ func TestNewManager_ErrorSeedingDatabase(t *testing.T) {
 	assert.Nil(t, rm)
 	mockDB.AssertExpectations(t)
 }
+
+func TestTickerReference_GetLotSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		ref      rdata.TickerReference
+		expected float64
+	}{
+		{"explicit lot size", rdata.TickerReference{ID: "D05", YahooTicker: "D05.SI", AssetClass: rdata.AssetClassEquities, LotSize: 10}, 10},
+		{"sgx equity", rdata.TickerReference{ID: "ES3", YahooTicker: "ES3.SI", AssetClass: rdata.AssetClassEquities}, rdata.SgxBoardLotSize},
+		{"us equity", rdata.TickerReference{ID: "AAPL", YahooTicker: "AAPL", AssetClass: rdata.AssetClassEquities}, 1},
+		{"ssb", rdata.TickerReference{ID: "SBJAN25", AssetClass: rdata.AssetClassBonds}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.ref.GetLotSize())
+		})
+	}
+}
+
+func TestTickerReference_Derivatives(t *testing.T) {
+	future := rdata.TickerReference{ID: "NKZ24", Name: "SGX Nikkei Dec 24", UnderlyingTicker: "NK", AssetClass: rdata.AssetClassDerivatives,
+		AssetSubClass: rdata.AssetSubClassFuture, Ccy: "JPY", Domicile: "SG", MaturityDate: "2024-12-12", ContractMultiplier: 500}
+	assert.NoError(t, future.Validate())
+	assert.Equal(t, 500.0, future.GetContractMultiplier())
+
+	// contracts default to one unit of the underlying
+	assert.Equal(t, 1.0, rdata.TickerReference{ID: "AAPL"}.GetContractMultiplier())
+
+	future.ContractMultiplier = -1
+	assert.Error(t, future.Validate())
+}
+
+func TestTickerChangesAdminOnly(t *testing.T) {
+	mux := http.NewServeMux()
+	rdata.RegisterHandlers(mux, nil) // rejected before reference data is touched
+
+	alice := &types.User{Name: "alice", Books: []string{"alice"}}
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/api/v1/rdata/ticker/ES3.SI", strings.NewReader(`{"name":"STI ETF"}`)),
+		httptest.NewRequest(http.MethodDelete, "/api/v1/rdata/ticker/ES3.SI", nil),
+		httptest.NewRequest(http.MethodPost, "/api/v1/rdata/upload", strings.NewReader("id\nES3.SI\n")),
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req.WithContext(context.WithValue(req.Context(), types.UserKey, alice)))
+		assert.Equal(t, http.StatusForbidden, rr.Code, "%s %s", req.Method, req.URL.Path)
+	}
+}
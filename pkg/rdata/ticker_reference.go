@@ -1,6 +1,8 @@
 package rdata
 
 import (
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -16,22 +18,26 @@ func init() {
 }
 
 type TickerReference struct {
-	ID                string  `json:"id" yaml:"id" validate:"required,uppercase"`
-	Name              string  `json:"name" yaml:"name" validate:"required"`
-	UnderlyingTicker  string  `json:"underlying_ticker" yaml:"underlying_ticker" validate:"required,uppercase"`
-	YahooTicker       string  `json:"yahoo_ticker" yaml:"yahoo_ticker" validate:"uppercase"`
-	GoogleTicker      string  `json:"google_ticker" yaml:"google_ticker" validate:"uppercase"`
-	DividendsSgTicker string  `json:"dividends_sg_ticker" yaml:"dividends_sg_ticker" validate:"uppercase"`
-	AssetClass        string  `json:"asset_class" yaml:"asset_class" validate:"required,asset_class"`
-	AssetSubClass     string  `json:"asset_sub_class" yaml:"asset_sub_class" validate:"asset_sub_class"`
-	Category          string  `json:"category" yaml:"category" validate:"category"`
-	SubCategory       string  `json:"sub_category" yaml:"sub_category"`
-	Ccy               string  `json:"ccy" yaml:"ccy" validate:"required,uppercase"`
-	Domicile          string  `json:"domicile" yaml:"domicile" validate:"required,uppercase"`
-	CouponRate        float64 `json:"coupon_rate" yaml:"coupon_rate"`
-	MaturityDate      string  `json:"maturity_date" yaml:"maturity_date"`
-	StrikePrice       float64 `json:"strike_price" yaml:"strike_price"`
-	CallPut           string  `json:"call_put" yaml:"call_put" validate:"oneof=call put"`
+	ID                 string  `json:"id" yaml:"id" validate:"required,uppercase"`
+	Name               string  `json:"name" yaml:"name" validate:"required"`
+	UnderlyingTicker   string  `json:"underlying_ticker" yaml:"underlying_ticker" validate:"required,uppercase"`
+	YahooTicker        string  `json:"yahoo_ticker" yaml:"yahoo_ticker" validate:"omitempty,uppercase"`
+	GoogleTicker       string  `json:"google_ticker" yaml:"google_ticker" validate:"omitempty,uppercase"`
+	DividendsSgTicker  string  `json:"dividends_sg_ticker" yaml:"dividends_sg_ticker" validate:"omitempty,uppercase"`
+	CoinGeckoTicker    string  `json:"coingecko_ticker" yaml:"coingecko_ticker" validate:"omitempty,lowercase"`
+	AssetClass         string  `json:"asset_class" yaml:"asset_class" validate:"required,asset_class"`
+	AssetSubClass      string  `json:"asset_sub_class" yaml:"asset_sub_class" validate:"omitempty,asset_sub_class"`
+	Category           string  `json:"category" yaml:"category" validate:"omitempty,category"`
+	SubCategory        string  `json:"sub_category" yaml:"sub_category"`
+	Ccy                string  `json:"ccy" yaml:"ccy" validate:"required,uppercase"`
+	Domicile           string  `json:"domicile" yaml:"domicile" validate:"required,uppercase"`
+	CouponRate         float64 `json:"coupon_rate" yaml:"coupon_rate"`
+	MaturityDate       string  `json:"maturity_date" yaml:"maturity_date"`
+	StrikePrice        float64 `json:"strike_price" yaml:"strike_price"`
+	CallPut            string  `json:"call_put" yaml:"call_put" validate:"omitempty,oneof=call put"`
+	LotSize            float64 `json:"lot_size" yaml:"lot_size" validate:"gte=0"`
+	ContractMultiplier float64 `json:"contract_multiplier" yaml:"contract_multiplier" validate:"gte=0"`
+	DataSource         string  `json:"data_source" yaml:"data_source" validate:"omitempty,oneof=manual"`
 }
 
 // Supported asset classes
@@ -40,6 +46,7 @@ const (
 	AssetClassCash        = "cash"
 	AssetClassCommodities = "cmdty"
 	AssetClassCrypto      = "crypto"
+	AssetClassDerivatives = "deriv" // listed options and futures
 	AssetClassEquities    = "eq"
 	AssetClassFX          = "fx"
 )
@@ -49,6 +56,7 @@ const (
 	AssetSubClassBond   = "bond"
 	AssetSubClassCash   = "cash"
 	AssetSubClassETF    = "etf"
+	AssetSubClassFD     = "fd" // fixed deposits
 	AssetSubClassFuture = "future"
 	AssetSubClassGovies = "govies"
 	AssetSubClassOption = "option"
@@ -57,6 +65,9 @@ const (
 	AssetSubClassStock  = "stock"
 )
 
+// DataSourceManual prices the ticker only from the manual prices stored via the market data service
+const DataSourceManual = "manual"
+
 // Supported categories
 const (
 	CategoryConsumerGoods = "consumergoods"
@@ -71,6 +82,34 @@ const (
 	CategoryTravel        = "travel"
 )
 
+// SGX equities trade in board lots of 100
+const SgxBoardLotSize = 100
+
+// GetLotSize returns the board lot size of the ticker, defaulting to 1, or to the SGX board lot for .SI equities.
+func (t TickerReference) GetLotSize() float64 {
+	if t.LotSize > 0 {
+		return t.LotSize
+	}
+	if t.AssetClass == AssetClassEquities && strings.HasSuffix(t.YahooTicker, ".SI") {
+		return SgxBoardLotSize
+	}
+	return 1
+}
+
+// GetContractMultiplier returns the number of units of the underlying per contract, defaulting to 1. Market values
+// and PnL of derivatives are quantity * price * multiplier.
+func (t TickerReference) GetContractMultiplier() float64 {
+	if t.ContractMultiplier > 0 {
+		return t.ContractMultiplier
+	}
+	return 1
+}
+
+// Validate validates the ticker reference against the supported asset classes, sub classes and categories.
+func (t TickerReference) Validate() error {
+	return validate.Struct(t)
+}
+
 // NewTickerReference creates a new TickerReference instance.
 func NewTickerReference(id, name, underlyingTicker, yahooTicker, googleTicker, dividendsSgTicker, assetClass, assetSubClass, category, subcategory, ccy, domicile string, couponRate, strikePrice float64, maturityDate, callPut string) (*TickerReference, error) {
 	ref := TickerReference{
@@ -91,6 +130,8 @@ func NewTickerReference(id, name, underlyingTicker, yahooTicker, googleTicker, d
 		StrikePrice:       strikePrice,
 		CallPut:           callPut,
 	}
+	ref.LotSize = ref.GetLotSize()
+	ref.ContractMultiplier = ref.GetContractMultiplier()
 
 	err := validate.Struct(ref)
 	return &ref, err
@@ -100,7 +141,7 @@ func validateAssetClass(fl validator.FieldLevel) bool {
 	ac := fl.Field().String()
 
 	switch ac {
-	case AssetClassBonds, AssetClassCash, AssetClassCommodities, AssetClassCrypto, AssetClassEquities, AssetClassFX:
+	case AssetClassBonds, AssetClassCash, AssetClassCommodities, AssetClassCrypto, AssetClassDerivatives, AssetClassEquities, AssetClassFX:
 		return true
 	default:
 		return false
@@ -111,7 +152,7 @@ func validateAssetSubClass(fl validator.FieldLevel) bool {
 	asc := fl.Field().String()
 
 	switch asc {
-	case AssetSubClassCash, AssetSubClassETF, AssetSubClassFuture, AssetSubClassGovies, AssetSubClassOption, AssetSubClassReit, AssetSubClassSpot, AssetSubClassStock:
+	case AssetSubClassCash, AssetSubClassETF, AssetSubClassFD, AssetSubClassFuture, AssetSubClassGovies, AssetSubClassOption, AssetSubClassReit, AssetSubClassSpot, AssetSubClassStock:
 		return true
 	default:
 		return false
@@ -0,0 +1,95 @@
+// Package scheduler runs the periodic background tasks of the services, so that shutdown can stop them and wait for
+// running tasks to finish before the database is closed.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotDue is returned by tasks which had nothing to do on a tick, e.g. before their daily time, so that the tick
+// is not observed as a run of the job.
+var ErrNotDue = errors.New("not due")
+
+// Observer is called after each run of a job with its duration and error, nil on success.
+type Observer func(job string, duration time.Duration, err error)
+
+// Scheduler runs tasks periodically until stopped.
+type Scheduler struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	observer Observer
+}
+
+// New creates a scheduler whose tasks stop when ctx is cancelled or Stop is called.
+func New(ctx context.Context) *Scheduler {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Scheduler{ctx: ctx, cancel: cancel}
+}
+
+// Context returns the context of the scheduler, cancelled once stopping, which long tasks may check to end early.
+func (s *Scheduler) Context() context.Context {
+	return s.ctx
+}
+
+// SetObserver sets the observer of the job runs, it must be set before scheduling the jobs.
+func (s *Scheduler) SetObserver(observer Observer) {
+	s.observer = observer
+}
+
+// Every runs the task of the job right away and then every interval until the scheduler stops. A task running when
+// the scheduler stops is allowed to finish. Tasks added after stopping are not run.
+func (s *Scheduler) Every(job string, interval time.Duration, task func() error) {
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for s.ctx.Err() == nil {
+			s.run(job, task)
+
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// run runs the task once, reporting the run to the observer unless the task was not due.
+func (s *Scheduler) run(job string, task func() error) {
+	start := time.Now()
+	err := task()
+	if s.observer != nil && !errors.Is(err, ErrNotDue) {
+		s.observer(job, time.Since(start), err)
+	}
+}
+
+// Stop stops scheduling tasks and waits for the running tasks to finish, giving up once ctx is done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduled tasks still running: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,122 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"portfolio-manager/internal/dal"
+	"portfolio-manager/pkg/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEveryRunsUntilStopped(t *testing.T) {
+	sched := scheduler.New(context.Background())
+
+	var runs atomic.Int32
+	sched.Every("count", 10*time.Millisecond, func() error { runs.Add(1); return nil })
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, sched.Stop(context.Background()))
+	stopped := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load())
+
+	// tasks added after stopping are not run
+	sched.Every("count", time.Millisecond, func() error { runs.Add(1); return nil })
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load())
+}
+
+func TestStopWaitsForRunningTaskBeforeDatabaseCloses(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db")
+	db, err := dal.NewLevelDB(dbPath)
+	require.NoError(t, err)
+
+	sched := scheduler.New(context.Background())
+	started := make(chan struct{})
+	sched.Every("write", time.Hour, func() error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		return db.Put("KEY", "written")
+	})
+	<-started
+
+	require.NoError(t, sched.Stop(context.Background()))
+	require.NoError(t, db.Close())
+
+	db, err = dal.NewLevelDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	var value string
+	require.NoError(t, db.Get("KEY", &value))
+	assert.Equal(t, "written", value)
+}
+
+func TestStopGivesUpAtDeadline(t *testing.T) {
+	sched := scheduler.New(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+	sched.Every("block", time.Hour, func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sched.Stop(ctx), context.DeadlineExceeded)
+}
+
+func TestCancellingParentContextStopsTasks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sched := scheduler.New(ctx)
+
+	var runs atomic.Int32
+	sched.Every("count", time.Hour, func() error { runs.Add(1); return nil })
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.Error(t, sched.Context().Err())
+	assert.NoError(t, sched.Stop(context.Background()))
+}
+
+func TestObserverSkipsRunsNotDue(t *testing.T) {
+	sched := scheduler.New(context.Background())
+
+	var mu sync.Mutex
+	observed := make(map[string][]error)
+	sched.SetObserver(func(job string, duration time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		observed[job] = append(observed[job], err)
+	})
+
+	failure := errors.New("failed")
+	var ticks atomic.Int32
+	sched.Every("job", 5*time.Millisecond, func() error {
+		switch ticks.Add(1) {
+		case 1:
+			return nil
+		case 2:
+			return failure
+		default:
+			return scheduler.ErrNotDue
+		}
+	})
+	require.Eventually(t, func() bool { return ticks.Load() >= 4 }, time.Second, time.Millisecond)
+	require.NoError(t, sched.Stop(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string][]error{"job": {nil, failure}}, observed)
+}
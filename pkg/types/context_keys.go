@@ -6,4 +6,5 @@ type contextKey string
 // Define context keys
 const (
 	LoggerKey contextKey = "logger"
+	UserKey   contextKey = "user"
 )
@@ -8,8 +8,27 @@ const (
 	HeadSequenceBlotterKey   dbKey = "BLOTTER_HEAD_SEQUENCE_NUM"
 	HeadSequencePortfolioKey dbKey = "PORTFOLIO_HEAD_SEQUENCE_NUM"
 
-	TradeKeyPrefix         dbKey = "TRADE"
-	PositionKeyPrefix      dbKey = "POSITION"
-	ReferenceDataKeyPrefix dbKey = "REFDATA"
-	DividendsKeyPrefix     dbKey = "DIVIDENDS"
+	TradeKeyPrefix           dbKey = "TRADE"
+	PositionKeyPrefix        dbKey = "POSITION"
+	ReferenceDataKeyPrefix   dbKey = "REFDATA"
+	DividendsKeyPrefix       dbKey = "DIVIDENDS"
+	CustomDividendsKeyPrefix dbKey = "CUSTOM_DIVIDENDS"
+	WithholdingTaxKeyPrefix  dbKey = "WITHHOLDING_TAX"
+	HistoricalDataKeyPrefix  dbKey = "HISTORICAL"
+	NotificationKeyPrefix    dbKey = "NOTIFICATION"
+	ReclaimKeyPrefix         dbKey = "RECLAIM"
+	CorporateActionKeyPrefix dbKey = "CORPORATE_ACTION"
+	UserKeyPrefix            dbKey = "USER"
+	AuditKeyPrefix           dbKey = "AUDIT"
+	VestingKeyPrefix         dbKey = "VESTING"
+	TargetsKeyPrefix         dbKey = "TARGETS"
+	SnapshotKeyPrefix        dbKey = "SNAPSHOT"
+	ManualPriceKeyPrefix     dbKey = "MANUAL_PRICE"
+	ExternalAssetKeyPrefix   dbKey = "EXTERNAL_ASSET"
+	NetWorthKeyPrefix        dbKey = "NETWORTH"
+	AlertKeyPrefix           dbKey = "ALERT"
+	AlertTriggeredKeyPrefix  dbKey = "ALERT_TRIGGERED"
+	ImportProfileKeyPrefix   dbKey = "IMPORT_PROFILE"
+	TrashKeyPrefix           dbKey = "TRASH"
+	SavedViewKeyPrefix       dbKey = "SAVED_VIEW"
 )
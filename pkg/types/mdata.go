@@ -5,20 +5,57 @@ type AssetData struct {
 	Price     float64
 	Currency  string
 	Timestamp int64
+	Source    string // data source which served the price
+	Stale     bool   // a manual price older than its staleness age
 }
 
 type DividendsMetadata struct {
 	Ticker         string
 	ExDate         string
+	PayDate        string `json:",omitempty"` // cash settlement date, empty when unknown to the source
 	Amount         float64
 	Interest       float64 // SSB, TBills and Bonds only, in percentage
 	AvgInterest    float64 // SSB, TBills and Bonds only, in percentage
 	WithholdingTax float64 // in decimal, not percentage
+	// Optional split of Amount, e.g. the capital return of REIT distributions, nil when the source does not know it
+	Income        *float64 `json:",omitempty"`
+	CapitalReturn *float64 `json:",omitempty"`
+	Other         *float64 `json:",omitempty"`
+}
+
+// HasComponents returns whether the split of the amount into income, capital return and other is known.
+func (d DividendsMetadata) HasComponents() bool {
+	return d.Income != nil || d.CapitalReturn != nil || d.Other != nil
+}
+
+// WithholdingTaxRules are the withholding tax rates on dividends, in decimal, by domicile from configuration and by
+// ticker overriding the rate of its domicile
+type WithholdingTaxRules struct {
+	Domiciles map[string]float64
+	Tickers   map[string]float64
+}
+
+// MarketDataStats holds health statistics of the market data manager.
+type MarketDataStats struct {
+	DedupedPriceRequests      int64 // concurrent identical price requests served by a single upstream call
+	DedupedHistoricalRequests int64 // concurrent identical historical range requests served by a single upstream call
+
+	HistoricalCache map[string]HistoricalCacheStats // coverage of the historical data cache per ticker
+}
+
+// HistoricalCacheStats holds the coverage of the historical data cache of a ticker.
+type HistoricalCacheStats struct {
+	From    string // first day covered
+	To      string // last day covered
+	Bars    int    // number of daily bars
+	LastBar string // day of the latest bar
+
+	MissingDays []string // trading days since the first bar without a bar, repaired via /api/v1/mdata/repair/{ticker}
 }
 
 // DataSource defines the interface for different data source engines
 type DataSource interface {
 	GetAssetPrice(ticker string) (*AssetData, error)
-	GetDividendsMetadata(ticker string, witholdingTax float64) ([]DividendsMetadata, error)
+	GetDividendsMetadata(ticker string) ([]DividendsMetadata, error)
 	GetHistoricalData(ticker string, fromDate, toDate int64) ([]*AssetData, error)
 }
@@ -0,0 +1,24 @@
+package types
+
+import (
+	"context"
+	"slices"
+)
+
+// User is the identity behind an API key, with the books (traders) it may see. Admins see all books.
+type User struct {
+	Name  string   `json:"name" yaml:"name"`
+	Admin bool     `json:"admin" yaml:"admin"`
+	Books []string `json:"books" yaml:"books"`
+}
+
+// CanSeeBook returns whether the user may see the book.
+func (u *User) CanSeeBook(book string) bool {
+	return u.Admin || slices.Contains(u.Books, book)
+}
+
+// UserFromContext returns the authenticated user of the request, nil when authentication is disabled.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(UserKey).(*User)
+	return user
+}